@@ -0,0 +1,340 @@
+// Package approval decides whether a bash, shell, patch or script tool call
+// may run unattended, must be confirmed by the user first, or is refused
+// outright.
+//
+// A Policy is an ordered list of rules. Bash and shell commands are split
+// into the programs they invoke (see bashkit.ExtractCommands) and each
+// program is matched separately; patch calls are matched on the file path;
+// script tool calls are matched on the tool alone.
+// The first matching rule wins, and the most restrictive outcome across all
+// programs in a command decides the call.
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"shelley.exe.dev/claudetool/bashkit"
+)
+
+// Decision is the outcome of evaluating a policy.
+type Decision string
+
+const (
+	Allow Decision = "allow"
+	Ask   Decision = "ask"
+	Deny  Decision = "deny"
+)
+
+func (d Decision) severity() int {
+	switch d {
+	case Deny:
+		return 2
+	case Ask:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (d Decision) valid() bool {
+	return d == Allow || d == Ask || d == Deny
+}
+
+// Rule matches tool calls and assigns them a decision.
+type Rule struct {
+	// Tool limits the rule to one tool ("bash", "shell", "patch", or a
+	// script tool's name). Empty matches all of them.
+	Tool string `json:"tool,omitempty"`
+	// Command is a glob (path.Match syntax) matched against each program a
+	// bash/shell command runs, e.g. "rm", "git", "docker*". Rules with a
+	// Command never match patch calls.
+	Command string `json:"command,omitempty"`
+	// Path is a glob matched against the absolute path a patch call edits.
+	// A pattern without a slash matches the base name ("*.sql"); a pattern
+	// ending in "/**" matches everything under a directory. Rules with a
+	// Path never match bash/shell calls.
+	Path string `json:"path,omitempty"`
+	// Decision is what happens when the rule matches.
+	Decision Decision `json:"decision"`
+}
+
+// Policy is an ordered rule list plus the decision for calls no rule matches.
+type Policy struct {
+	// Default applies when no rule matches. Empty means Allow.
+	Default Decision `json:"default,omitempty"`
+	Rules   []Rule   `json:"rules,omitempty"`
+}
+
+// Validate reports malformed decisions.
+func (p *Policy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Default != "" && !p.Default.valid() {
+		return fmt.Errorf("invalid default decision %q (want allow, ask or deny)", p.Default)
+	}
+	for i, r := range p.Rules {
+		if !r.Decision.valid() {
+			return fmt.Errorf("rule %d: invalid decision %q (want allow, ask or deny)", i, r.Decision)
+		}
+		if r.Command != "" && r.Path != "" {
+			return fmt.Errorf("rule %d: set command or path, not both", i)
+		}
+		if _, err := path.Match(r.Command, ""); err != nil {
+			return fmt.Errorf("rule %d: bad command pattern %q: %w", i, r.Command, err)
+		}
+		if _, err := filepath.Match(r.Path, ""); err != nil {
+			return fmt.Errorf("rule %d: bad path pattern %q: %w", i, r.Path, err)
+		}
+	}
+	return nil
+}
+
+// WithRules returns a copy of p with rules evaluated before p's own. A nil
+// p yields a policy whose default is Allow.
+func (p *Policy) WithRules(rules ...Rule) *Policy {
+	out := &Policy{}
+	if p != nil {
+		out.Default = p.Default
+		out.Rules = append(out.Rules, p.Rules...)
+	}
+	out.Rules = append(append([]Rule(nil), rules...), out.Rules...)
+	return out
+}
+
+func (p *Policy) defaultDecision() Decision {
+	if p.Default == "" {
+		return Allow
+	}
+	return p.Default
+}
+
+// Verdict is the result of checking one tool call.
+type Verdict struct {
+	Decision Decision
+	// Subjects are the programs (or the path) that produced Decision. For an
+	// Ask verdict they are what an "always allow" answer should cover.
+	Subjects []string
+	// Rule is the rule behind Decision, or nil when the default applied.
+	Rule *Rule
+}
+
+// CheckCommand evaluates a bash or shell command.
+func (p *Policy) CheckCommand(tool, command string) Verdict {
+	if p == nil {
+		return Verdict{Decision: Allow}
+	}
+	programs, err := bashkit.ExtractCommands(command)
+	if err != nil {
+		// Can't tell what will run; never quieter than asking.
+		d := p.defaultDecision()
+		if d.severity() < Ask.severity() {
+			d = Ask
+		}
+		return Verdict{Decision: d}
+	}
+	if len(programs) == 0 {
+		// Builtins only (echo, cd, ...): only tool-wide rules apply.
+		d, rule := p.match(tool, func(r Rule) bool { return r.Command == "" && r.Path == "" })
+		return Verdict{Decision: d, Rule: rule}
+	}
+	worst := Verdict{Decision: Allow}
+	for _, prog := range programs {
+		d, rule := p.match(tool, func(r Rule) bool {
+			if r.Path != "" {
+				return false
+			}
+			if r.Command == "" {
+				return true
+			}
+			ok, _ := path.Match(r.Command, prog)
+			return ok
+		})
+		switch {
+		case d.severity() > worst.Decision.severity():
+			worst = Verdict{Decision: d, Subjects: []string{prog}, Rule: rule}
+		case d == worst.Decision && d != Allow:
+			worst.Subjects = append(worst.Subjects, prog)
+		}
+	}
+	return worst
+}
+
+// CheckPath evaluates a patch to the file at absPath. The path is cleaned
+// and its symlinks resolved before matching, and the stricter of the two
+// verdicts wins, so neither ".." nor a link steps around a rule.
+func (p *Policy) CheckPath(tool, absPath string) Verdict {
+	if p == nil {
+		return Verdict{Decision: Allow}
+	}
+	clean := filepath.Clean(absPath)
+	candidates := []string{clean}
+	if resolved := resolvePath(clean); resolved != clean {
+		candidates = append(candidates, resolved)
+	}
+	var worst Verdict
+	for i, candidate := range candidates {
+		d, rule := p.match(tool, func(r Rule) bool {
+			if r.Command != "" {
+				return false
+			}
+			return r.Path == "" || matchPath(r.Path, candidate)
+		})
+		if i == 0 || d.severity() > worst.Decision.severity() {
+			worst = Verdict{Decision: d, Subjects: []string{candidate}, Rule: rule}
+		}
+	}
+	return worst
+}
+
+// resolvePath returns the clean absolute path absPath refers to once
+// symlinks are followed. Unlike filepath.EvalSymlinks it copes with a file
+// that does not exist yet, or a dangling link, by resolving as far as it
+// can.
+func resolvePath(absPath string) string {
+	for range 40 {
+		if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
+			return resolved
+		}
+		dir, base := filepath.Split(absPath)
+		if resolvedDir, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolvedDir
+		} else {
+			dir = resolvePath(filepath.Clean(dir))
+		}
+		absPath = filepath.Join(dir, base)
+		target, err := os.Readlink(absPath)
+		if err != nil {
+			return absPath
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		absPath = filepath.Clean(target)
+	}
+	return absPath
+}
+
+// CheckTool evaluates a call to a script tool, which has no command or
+// path to match: only rules with neither apply.
+func (p *Policy) CheckTool(tool string) Verdict {
+	if p == nil {
+		return Verdict{Decision: Allow}
+	}
+	d, rule := p.match(tool, func(r Rule) bool { return r.Command == "" && r.Path == "" })
+	return Verdict{Decision: d, Rule: rule}
+}
+
+func (p *Policy) match(tool string, ok func(Rule) bool) (Decision, *Rule) {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Tool != "" && r.Tool != tool {
+			continue
+		}
+		if ok(*r) {
+			return r.Decision, r
+		}
+	}
+	return p.defaultDecision(), nil
+}
+
+func matchPath(pattern, absPath string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return absPath == dir || strings.HasPrefix(absPath, dir+"/")
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, filepath.Base(absPath))
+		return ok
+	}
+	ok, _ := filepath.Match(pattern, absPath)
+	return ok
+}
+
+// Request asks the user to approve one tool call.
+type Request struct {
+	// ID identifies the request in the approve API.
+	ID        string `json:"id"`
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Tool      string `json:"tool"`
+	// Command is set for bash/shell calls, Path for patch calls and Input,
+	// the JSON input, for script tool calls.
+	Command string `json:"command,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Input   string `json:"input,omitempty"`
+	// Subjects are the programs or path that triggered the request; an
+	// "always allow" answer adds an allow rule for each.
+	Subjects []string `json:"subjects,omitempty"`
+}
+
+// AllowRules returns the rules that "always allow" for r should record. A
+// script tool call is allowed for the whole tool.
+func (r Request) AllowRules() []Rule {
+	if r.Command == "" && r.Path == "" {
+		return []Rule{{Tool: r.Tool, Decision: Allow}}
+	}
+	var rules []Rule
+	for _, s := range r.Subjects {
+		rule := Rule{Tool: r.Tool, Decision: Allow}
+		if r.Path != "" {
+			rule.Path = s
+		} else {
+			rule.Command = s
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Response is the user's answer to a Request.
+type Response struct {
+	Approved bool `json:"approved"`
+	// Always records allow rules for the request's subjects so the same
+	// programs or path are not asked about again in this conversation.
+	Always bool `json:"always,omitempty"`
+	// Reason is passed to the model when a call is rejected.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Gate asks the user about a tool call and blocks until they answer or ctx
+// ends.
+type Gate interface {
+	Ask(ctx context.Context, req Request) (Response, error)
+}
+
+// LoadPolicy reads a policy from a JSON file. A missing file yields nil.
+func LoadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read approval policy: %w", err)
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse approval policy %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("approval policy %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// DefaultPolicyPath returns ~/.config/shelley/approval.json, or "" if $HOME
+// is unknown.
+func DefaultPolicyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "shelley", "approval.json")
+}
@@ -0,0 +1,216 @@
+package approval
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCheckCommand(t *testing.T) {
+	p := &Policy{
+		Default: Ask,
+		Rules: []Rule{
+			{Command: "rm", Decision: Deny},
+			{Command: "git", Decision: Allow},
+			{Command: "ls", Decision: Allow},
+			{Tool: "shell", Command: "go", Decision: Allow},
+		},
+	}
+	tests := []struct {
+		tool, command string
+		want          Decision
+		subjects      []string
+	}{
+		{"bash", "git status", Allow, nil},
+		{"bash", "ls && git log", Allow, nil},
+		{"bash", "git status && rm -rf /tmp/x", Deny, []string{"rm"}},
+		{"bash", "go test ./...", Ask, []string{"go"}},
+		{"shell", "go test ./...", Allow, nil},
+		{"bash", "make && npm test", Ask, []string{"make", "npm"}},
+		{"bash", "echo hi", Ask, nil},
+	}
+	for _, tt := range tests {
+		v := p.CheckCommand(tt.tool, tt.command)
+		if v.Decision != tt.want || !slices.Equal(v.Subjects, tt.subjects) {
+			t.Errorf("CheckCommand(%q, %q) = %s %v, want %s %v", tt.tool, tt.command, v.Decision, v.Subjects, tt.want, tt.subjects)
+		}
+	}
+}
+
+func TestCheckCommandNilPolicy(t *testing.T) {
+	var p *Policy
+	if v := p.CheckCommand("bash", "rm -rf /"); v.Decision != Allow {
+		t.Errorf("nil policy: got %s, want allow", v.Decision)
+	}
+}
+
+func TestCheckCommandUnparseable(t *testing.T) {
+	p := &Policy{}
+	if v := p.CheckCommand("bash", "echo 'unterminated"); v.Decision != Ask {
+		t.Errorf("unparseable command: got %s, want ask", v.Decision)
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	p := &Policy{
+		Rules: []Rule{
+			{Path: "/etc/**", Decision: Deny},
+			{Path: "*.sql", Decision: Ask},
+			{Tool: "bash", Decision: Deny}, // never applies to patch
+		},
+	}
+	tests := []struct {
+		path string
+		want Decision
+	}{
+		{"/etc/hosts", Deny},
+		{"/etc", Deny},
+		{"/etcetera/x", Allow},
+		{"/src/db/migrations/001.sql", Ask},
+		{"/src/main.go", Allow},
+	}
+	for _, tt := range tests {
+		if v := p.CheckPath("patch", tt.path); v.Decision != tt.want {
+			t.Errorf("CheckPath(%q) = %s, want %s", tt.path, v.Decision, tt.want)
+		}
+	}
+}
+
+func TestCheckPathDotDotAndSymlinks(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(root, "secret")
+	work := filepath.Join(root, "work")
+	for _, dir := range []string{secret, work} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(secret, "key"), []byte("k"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"dirlink":  secret,
+		"filelink": filepath.Join(secret, "key"),
+		"dangling": filepath.Join(secret, "new"),
+		"relative": "../secret",
+	} {
+		if err := os.Symlink(target, filepath.Join(work, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := &Policy{Rules: []Rule{{Path: secret + "/**", Decision: Deny}}}
+
+	for _, path := range []string{
+		work + "/../secret/key",
+		work + "/../../" + filepath.Base(root) + "/secret/new",
+		filepath.Join(work, "dirlink", "key"),
+		filepath.Join(work, "dirlink", "new"),
+		filepath.Join(work, "filelink"),
+		filepath.Join(work, "dangling"),
+		filepath.Join(work, "relative", "key"),
+	} {
+		if v := p.CheckPath("patch", path); v.Decision != Deny {
+			t.Errorf("CheckPath(%q) = %s, want deny", path, v.Decision)
+		}
+	}
+	if v := p.CheckPath("patch", filepath.Join(work, "plain.txt")); v.Decision != Allow {
+		t.Errorf("CheckPath(plain) = %s, want allow", v.Decision)
+	}
+}
+
+func TestCheckTool(t *testing.T) {
+	p := &Policy{
+		Default: Ask,
+		Rules: []Rule{
+			{Tool: "deploy", Decision: Deny},
+			{Command: "ls", Decision: Allow}, // never applies to script tools
+			{Tool: "lint", Decision: Allow},
+		},
+	}
+	for tool, want := range map[string]Decision{"deploy": Deny, "lint": Allow, "other": Ask} {
+		if v := p.CheckTool(tool); v.Decision != want {
+			t.Errorf("CheckTool(%q) = %s, want %s", tool, v.Decision, want)
+		}
+	}
+	rules := Request{Tool: "other", Input: "{}"}.AllowRules()
+	if len(rules) != 1 || rules[0] != (Rule{Tool: "other", Decision: Allow}) {
+		t.Errorf("AllowRules = %+v", rules)
+	}
+	if v := p.WithRules(rules...).CheckTool("other"); v.Decision != Allow {
+		t.Errorf("after always allow: %s", v.Decision)
+	}
+}
+
+func TestWithRules(t *testing.T) {
+	base := &Policy{Default: Ask, Rules: []Rule{{Command: "npm", Decision: Deny}}}
+	p := base.WithRules(Rule{Command: "npm", Decision: Allow})
+	if v := p.CheckCommand("bash", "npm install"); v.Decision != Allow {
+		t.Errorf("added rule should win, got %s", v.Decision)
+	}
+	if v := base.CheckCommand("bash", "npm install"); v.Decision != Deny {
+		t.Errorf("base policy modified, got %s", v.Decision)
+	}
+	if v := p.CheckCommand("bash", "make"); v.Decision != Ask {
+		t.Errorf("default not kept, got %s", v.Decision)
+	}
+}
+
+func TestRequestAllowRules(t *testing.T) {
+	r := Request{Tool: "bash", Command: "make && npm test", Subjects: []string{"make", "npm"}}
+	got := r.AllowRules()
+	want := []Rule{{Tool: "bash", Command: "make", Decision: Allow}, {Tool: "bash", Command: "npm", Decision: Allow}}
+	if !slices.Equal(got, want) {
+		t.Errorf("AllowRules() = %+v, want %+v", got, want)
+	}
+
+	r = Request{Tool: "patch", Path: "/src/x.sql", Subjects: []string{"/src/x.sql"}}
+	if got := r.AllowRules(); len(got) != 1 || got[0].Path != "/src/x.sql" || got[0].Command != "" {
+		t.Errorf("AllowRules() for patch = %+v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []*Policy{
+		{Default: "sometimes"},
+		{Rules: []Rule{{Command: "rm"}}},
+		{Rules: []Rule{{Command: "rm", Path: "/x", Decision: Deny}}},
+		{Rules: []Rule{{Command: "[", Decision: Deny}}},
+	}
+	for i, p := range bad {
+		if err := p.Validate(); err == nil {
+			t.Errorf("policy %d: expected error", i)
+		}
+	}
+	good := &Policy{Default: Deny, Rules: []Rule{{Command: "go*", Decision: Allow}}}
+	if err := good.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	p, err := LoadPolicy(filepath.Join(dir, "missing.json"))
+	if err != nil || p != nil {
+		t.Fatalf("missing file: got %v, %v", p, err)
+	}
+
+	path := filepath.Join(dir, "approval.json")
+	os.WriteFile(path, []byte(`{"default":"ask","rules":[{"command":"git","decision":"allow"}]}`), 0o644)
+	p, err = LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Default != Ask || len(p.Rules) != 1 || p.Rules[0].Command != "git" {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+
+	os.WriteFile(path, []byte(`{"rules":[{"command":"git","decision":"yes"}]}`), 0o644)
+	if _, err := LoadPolicy(path); err == nil {
+		t.Error("expected validation error")
+	}
+}
@@ -0,0 +1,76 @@
+package claudetool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"shelley.exe.dev/claudetool/approval"
+	"shelley.exe.dev/llm"
+)
+
+// approvalChecker applies a conversation's approval policy to bash, shell,
+// patch and script tool calls.
+type approvalChecker struct {
+	policy func() *approval.Policy
+	gate   approval.Gate
+}
+
+// newApprovalChecker returns nil when cfg configures no approval policy.
+func newApprovalChecker(cfg ToolSetConfig) *approvalChecker {
+	if cfg.ApprovalPolicy == nil {
+		return nil
+	}
+	return &approvalChecker{policy: cfg.ApprovalPolicy, gate: cfg.ApprovalGate}
+}
+
+func (a *approvalChecker) commandCallback(tool string) PermissionCallback {
+	return func(ctx context.Context, command string) error {
+		v := a.policy().CheckCommand(tool, command)
+		return a.enforce(ctx, v, approval.Request{Tool: tool, Command: command, Subjects: v.Subjects})
+	}
+}
+
+func (a *approvalChecker) pathCallback(tool string) func(context.Context, string) error {
+	return func(ctx context.Context, path string) error {
+		v := a.policy().CheckPath(tool, path)
+		return a.enforce(ctx, v, approval.Request{Tool: tool, Path: path, Subjects: v.Subjects})
+	}
+}
+
+func (a *approvalChecker) toolCallback(tool string) func(context.Context, json.RawMessage) error {
+	return func(ctx context.Context, input json.RawMessage) error {
+		v := a.policy().CheckTool(tool)
+		return a.enforce(ctx, v, approval.Request{Tool: tool, Input: string(input)})
+	}
+}
+
+func (a *approvalChecker) enforce(ctx context.Context, v approval.Verdict, req approval.Request) error {
+	switch v.Decision {
+	case approval.Deny:
+		what := "this tool call"
+		if len(v.Subjects) > 0 {
+			what = strings.Join(v.Subjects, ", ")
+		}
+		return fmt.Errorf("%s is not permitted by the approval policy; do not retry it, ask the user how to proceed", what)
+	case approval.Ask:
+		if a.gate == nil {
+			return errors.New("this tool call requires user approval, but no one is available to approve it")
+		}
+		req.ToolUseID = llm.ToolUseID(ctx)
+		resp, err := a.gate.Ask(ctx, req)
+		if err != nil {
+			return fmt.Errorf("waiting for user approval: %w", err)
+		}
+		if !resp.Approved {
+			msg := "the user rejected this tool call"
+			if resp.Reason != "" {
+				msg += ": " + resp.Reason
+			}
+			return errors.New(msg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package claudetool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shelley.exe.dev/claudetool/approval"
+)
+
+type fakeGate struct {
+	resp approval.Response
+	reqs []approval.Request
+}
+
+func (g *fakeGate) Ask(ctx context.Context, req approval.Request) (approval.Response, error) {
+	g.reqs = append(g.reqs, req)
+	return g.resp, nil
+}
+
+func runApprovedPatch(t *testing.T, policy *approval.Policy, gate approval.Gate, name string) (string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	checker := newApprovalChecker(ToolSetConfig{
+		ApprovalPolicy: func() *approval.Policy { return policy },
+		ApprovalGate:   gate,
+	})
+	patch := &PatchTool{WorkingDir: NewMutableWorkingDir(dir), CheckPermission: checker.pathCallback("patch")}
+	path := filepath.Join(dir, name)
+	input, _ := json.Marshal(PatchInput{
+		Path:    path,
+		Patches: []PatchRequest{{Operation: "overwrite", NewText: "x\n"}},
+	})
+	out := patch.Run(context.Background(), input)
+	return path, out.Error
+}
+
+func TestApprovalPatchDenied(t *testing.T) {
+	policy := &approval.Policy{Rules: []approval.Rule{{Path: "*.lock", Decision: approval.Deny}}}
+	path, err := runApprovedPatch(t, policy, nil, "go.lock")
+	if err == nil || !strings.Contains(err.Error(), "not permitted") {
+		t.Fatalf("expected denial, got %v", err)
+	}
+	if _, statErr := os.Stat(path); statErr == nil {
+		t.Error("denied patch wrote the file")
+	}
+}
+
+func TestApprovalPatchAskWithoutGate(t *testing.T) {
+	_, err := runApprovedPatch(t, &approval.Policy{Default: approval.Ask}, nil, "a.txt")
+	if err == nil || !strings.Contains(err.Error(), "requires user approval") {
+		t.Fatalf("expected approval error, got %v", err)
+	}
+}
+
+func TestApprovalPatchAskApproved(t *testing.T) {
+	gate := &fakeGate{resp: approval.Response{Approved: true}}
+	path, err := runApprovedPatch(t, &approval.Policy{Default: approval.Ask}, gate, "a.txt")
+	if err != nil {
+		t.Fatalf("approved patch failed: %v", err)
+	}
+	if len(gate.reqs) != 1 || gate.reqs[0].Tool != "patch" || gate.reqs[0].Path != path {
+		t.Fatalf("unexpected requests: %+v", gate.reqs)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("approved patch did not write the file: %v", err)
+	}
+}
+
+func TestApprovalPatchAskRejected(t *testing.T) {
+	gate := &fakeGate{resp: approval.Response{Reason: "leave it alone"}}
+	path, err := runApprovedPatch(t, &approval.Policy{Default: approval.Ask}, gate, "a.txt")
+	if err == nil || !strings.Contains(err.Error(), "rejected this tool call: leave it alone") {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	if _, statErr := os.Stat(path); statErr == nil {
+		t.Error("rejected patch wrote the file")
+	}
+}
+
+func TestApprovalNoPolicy(t *testing.T) {
+	if newApprovalChecker(ToolSetConfig{}) != nil {
+		t.Error("expected no checker without a policy")
+	}
+}
@@ -16,14 +16,16 @@ import (
 	"time"
 
 	"shelley.exe.dev/claudetool/bashkit"
+	"shelley.exe.dev/claudetool/sandbox"
 	"shelley.exe.dev/llm"
 	"shelley.exe.dev/llm/llmhttp"
 
 	"mvdan.cc/sh/v3/syntax"
 )
 
-// PermissionCallback is a function type for checking if a command is allowed to run
-type PermissionCallback func(command string) error
+// PermissionCallback is a function type for checking if a command is allowed to run.
+// It may block (e.g. waiting for the user to approve the command) until ctx is done.
+type PermissionCallback func(ctx context.Context, command string) error
 
 // PreferredToolModels is the ordered list of model IDs preferred for
 // internal tool operations (validation, keyword search, etc.).
@@ -45,6 +47,11 @@ type BashTool struct {
 	// Env holds the conversation context exposed to invoked commands as
 	// SHELLEY_* environment variables.
 	Env ShelleyEnv
+	// Checkpoint, if set, receives the prior state of files each command
+	// changes in the git working tree.
+	Checkpoint CheckpointFunc
+	// Sandbox, if set, runs commands in a sandbox (see package sandbox).
+	Sandbox *sandbox.Sandbox
 }
 
 const (
@@ -180,7 +187,7 @@ func (b *BashTool) run(ctx context.Context, req bashInput) llm.ToolOut {
 
 	// Custom permission callback if set
 	if b.CheckPermission != nil {
-		if err := b.CheckPermission(req.Command); err != nil {
+		if err := b.CheckPermission(ctx, req.Command); err != nil {
 			return llm.ErrorToolOut(err)
 		}
 	}
@@ -202,7 +209,11 @@ func (b *BashTool) run(ctx context.Context, req bashInput) llm.ToolOut {
 
 	display := BashDisplayData{WorkingDir: wd}
 
-	out, execErr := b.executeBash(ctx, req, timeout)
+	var out string
+	var execErr error
+	checkpointBash(ctx, b.Checkpoint, wd, func() {
+		out, execErr = b.executeBash(ctx, req, timeout)
+	})
 	if execErr != nil {
 		return llm.ErrorToolOut(execErr)
 	}
@@ -220,7 +231,7 @@ const (
 	maxLineLength        = 200 // truncate displayed lines to this length
 )
 
-func (b *BashTool) makeBashCommand(ctx context.Context, command string, out io.Writer) *exec.Cmd {
+func (b *BashTool) makeBashCommand(ctx context.Context, command string, out io.Writer) (*exec.Cmd, error) {
 	cmd := exec.CommandContext(ctx, "bash", "--login", "-c", command)
 	// Use shared WorkingDir if available, then context, then Pwd fallback
 	cmd.Dir = b.getWorkingDir()
@@ -244,7 +255,12 @@ func (b *BashTool) makeBashCommand(ctx context.Context, command string, out io.W
 	env = append(env, "EDITOR=/bin/false") // interactive editors won't work
 	env = append(env, b.Env.Environ(cmd.Dir)...)
 	cmd.Env = env
-	return cmd
+	if b.Sandbox != nil {
+		if err := b.Sandbox.Wrap(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
 }
 
 func cmdWait(cmd *exec.Cmd) error {
@@ -371,13 +387,16 @@ func (b *BashTool) executeBash(ctx context.Context, req bashInput, timeout time.
 		getOutput = buf.String
 	}
 
-	cmd := b.makeBashCommand(execCtx, req.Command, output)
+	cmd, err := b.makeBashCommand(execCtx, req.Command, output)
+	if err != nil {
+		return "", err
+	}
 	cmd.Env = append(cmd.Env, `GIT_SEQUENCE_EDITOR=echo "To do an interactive rebase, run it in a tmux session." && exit 1`)
 	if err := cmd.Start(); err != nil {
 		return "", fmt.Errorf("command failed: %w", err)
 	}
 
-	err := cmdWait(cmd)
+	err = cmdWait(cmd)
 
 	out, formatErr := formatForegroundBashOutput(getOutput())
 	if formatErr != nil {
@@ -388,6 +407,9 @@ func (b *BashTool) executeBash(ctx context.Context, req bashInput, timeout time.
 		return "", fmt.Errorf("[command timed out after %s, showing output until timeout]\n%s", timeout, out)
 	}
 	if err != nil {
+		if v := b.Sandbox.Violation(out); v != "" {
+			return "", fmt.Errorf("[%s; command failed: %w]\n%s", v, err, out)
+		}
 		return "", fmt.Errorf("[command failed: %w]\n%s", err, out)
 	}
 
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"shelley.exe.dev/claudetool/sandbox"
 )
 
 func TestBashSlowOk(t *testing.T) {
@@ -501,3 +503,26 @@ func TestShellHasCommand(t *testing.T) {
 		t.Error("expected cancelled context to return false")
 	}
 }
+
+func TestExecuteBashSandboxed(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	box := &sandbox.Sandbox{Network: true, Writable: []string{dir}}
+	bashTool := &BashTool{WorkingDir: NewMutableWorkingDir(dir), Sandbox: box}
+
+	out, err := bashTool.executeBash(ctx, bashInput{Command: "echo ok > inside && cat inside"}, 10*time.Second)
+	if err != nil {
+		if strings.Contains(err.Error(), "shelley sandbox:") || strings.Contains(err.Error(), "operation not permitted") {
+			t.Skipf("cannot create namespaces here: %v", err)
+		}
+		t.Fatalf("writing the working directory failed: %v", err)
+	}
+	if !strings.Contains(out, "ok") {
+		t.Errorf("output = %q, want ok", out)
+	}
+
+	_, err = bashTool.executeBash(ctx, bashInput{Command: "touch /shelley-sandbox-probe"}, 10*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "sandbox violation") {
+		t.Errorf("err = %v, want a sandbox violation", err)
+	}
+}
@@ -864,7 +864,8 @@ func (b *BrowseTools) ReadImageTool() *llm.Tool {
 			},
 			"required": ["path"]
 		}`),
-		Run: llm.RunJSON(b.readImageRun),
+		ReadOnly: true,
+		Run:      llm.RunJSON(b.readImageRun),
 	}
 }
 
@@ -0,0 +1,254 @@
+package claudetool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileCheckpoint is the state of a file before a tool call changed it.
+type FileCheckpoint struct {
+	// Path is the absolute path of the file.
+	Path string
+	// Existed reports whether the file existed before the call. If not,
+	// undoing the call removes it.
+	Existed bool
+	// Content and Mode are the file's contents and permission bits before
+	// the call. They are unset when Existed is false.
+	Content []byte
+	Mode    os.FileMode
+}
+
+// CheckpointFunc records the state files had before a tool call changed
+// them, so the change can be undone later. ctx carries the tool use ID.
+// Recording is best effort: it must not fail the tool call.
+type CheckpointFunc func(ctx context.Context, tool string, files []FileCheckpoint)
+
+const (
+	// maxCheckpointFileSize bounds the content kept for one file. Larger
+	// files (typically build outputs) are not checkpointed.
+	maxCheckpointFileSize = 1 << 20
+	// maxCheckpointFiles bounds the files checkpointed for one bash call.
+	maxCheckpointFiles = 500
+	// maxSnapshotUntracked bounds the untracked files a snapshot hashes. A
+	// working tree with more is not checkpointed at all.
+	maxSnapshotUntracked = 2000
+	// workTreeSnapshotTimeout bounds one snapshot, so a huge working tree
+	// costs a missing checkpoint rather than a stalled bash call.
+	workTreeSnapshotTimeout = 3 * time.Second
+)
+
+// workTreeSnapshot is a git tree object recording a repository's working
+// tree, untracked (but not ignored) files up to maxCheckpointFileSize
+// included. Bash calls are checkpointed by comparing the snapshots taken
+// before and after them.
+type workTreeSnapshot struct {
+	root string
+	tree string
+	// env points git at the scratch object directory holding tree.
+	env []string
+	// skipped are the untracked files left out for their size. Later
+	// snapshots leave them out too, so they never look created or deleted.
+	skipped map[string]bool
+}
+
+// snapshotWorkTree snapshots the working tree of the git repository
+// containing dir. It stages into a scratch copy of the index and writes
+// the new objects to the scratch object directory objects, so neither the
+// real index, the working tree nor the repository's object store is
+// touched. Untracked files in prev.skipped are left out; prev may be nil.
+func snapshotWorkTree(ctx context.Context, dir, objects string, prev *workTreeSnapshot) (*workTreeSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, workTreeSnapshotTimeout)
+	defer cancel()
+	out, err := runGit(ctx, dir, nil, nil, "rev-parse", "--show-toplevel", "--git-path", "index", "--git-path", "objects")
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 3 {
+		return nil, fmt.Errorf("unexpected rev-parse output %q", out)
+	}
+	root, index, repoObjects := lines[0], lines[1], lines[2]
+	if !filepath.IsAbs(index) {
+		index = filepath.Join(dir, index)
+	}
+	if !filepath.IsAbs(repoObjects) {
+		repoObjects = filepath.Join(dir, repoObjects)
+	}
+
+	// Untracked files are listed honouring .gitignore; oversized ones and
+	// the ones skipped before are left out.
+	out, err = runGit(ctx, root, nil, nil, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	snap := &workTreeSnapshot{root: root, skipped: make(map[string]bool)}
+	var untracked []string
+	for _, name := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		if name == "" {
+			continue
+		}
+		if prev != nil && prev.skipped[name] {
+			snap.skipped[name] = true
+			continue
+		}
+		fi, err := os.Lstat(filepath.Join(root, name))
+		if err != nil || !fi.Mode().IsRegular() || fi.Size() > maxCheckpointFileSize {
+			snap.skipped[name] = true
+			continue
+		}
+		untracked = append(untracked, name)
+	}
+	if len(untracked) > maxSnapshotUntracked {
+		return nil, fmt.Errorf("%d untracked files, more than %d", len(untracked), maxSnapshotUntracked)
+	}
+
+	scratch, err := os.CreateTemp("", "shelley-index-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(scratch.Name())
+	// Starting from the real index lets git reuse its stat cache instead
+	// of rehashing every file.
+	if src, err := os.Open(index); err == nil {
+		_, err = io.Copy(scratch, src)
+		src.Close()
+		if err != nil {
+			scratch.Close()
+			return nil, err
+		}
+	}
+	if err := scratch.Close(); err != nil {
+		return nil, err
+	}
+
+	// The repository's objects stay readable as an alternate, so unchanged
+	// files are not rehashed, while new objects land in the scratch dir.
+	snap.env = []string{
+		"GIT_OBJECT_DIRECTORY=" + objects,
+		"GIT_ALTERNATE_OBJECT_DIRECTORIES=" + repoObjects,
+	}
+	env := append([]string{"GIT_INDEX_FILE=" + scratch.Name()}, snap.env...)
+	if _, err := runGit(ctx, root, env, nil, "add", "--update", "--", "."); err != nil {
+		return nil, err
+	}
+	if len(untracked) > 0 {
+		stdin := strings.NewReader(strings.Join(untracked, "\x00"))
+		if _, err := runGit(ctx, root, env, stdin, "add", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+			return nil, err
+		}
+	}
+	out, err = runGit(ctx, root, env, nil, "write-tree")
+	if err != nil {
+		return nil, err
+	}
+	snap.tree = strings.TrimSpace(string(out))
+	return snap, nil
+}
+
+// changedFiles returns checkpoints, as of s, for the files that differ
+// between s and after. Symlinks, submodules and oversized files are left
+// out.
+func (s *workTreeSnapshot) changedFiles(ctx context.Context, after *workTreeSnapshot) ([]FileCheckpoint, error) {
+	if s.tree == after.tree {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, workTreeSnapshotTimeout)
+	defer cancel()
+	out, err := runGit(ctx, s.root, after.env, nil, "diff-tree", "-r", "-z", "--no-renames", "--raw", s.tree, after.tree)
+	if err != nil {
+		return nil, err
+	}
+	// Each entry is ":<old mode> <new mode> <old hash> <new hash> <status>\0<path>\0".
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	var files []FileCheckpoint
+	for i := 0; i+1 < len(fields) && len(files) < maxCheckpointFiles; i += 2 {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 {
+			return nil, fmt.Errorf("unexpected diff-tree entry %q", fields[i])
+		}
+		oldMode, oldHash := meta[0], meta[2]
+		cp := FileCheckpoint{Path: filepath.Join(s.root, fields[i+1])}
+		switch oldMode {
+		case "000000":
+			// Created by the call.
+		case "100644", "100755":
+			content, err := runGit(ctx, s.root, after.env, nil, "cat-file", "blob", oldHash)
+			if err != nil {
+				return nil, err
+			}
+			if len(content) > maxCheckpointFileSize {
+				continue
+			}
+			cp.Existed = true
+			cp.Content = content
+			cp.Mode = 0o644
+			if oldMode == "100755" {
+				cp.Mode = 0o755
+			}
+		default:
+			continue
+		}
+		files = append(files, cp)
+	}
+	return files, nil
+}
+
+func runGit(ctx context.Context, dir string, env []string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// checkpointBash runs fn, recording through checkpoint the files fn changes
+// in the git working tree around dir. Outside a git repository fn simply
+// runs.
+func checkpointBash(ctx context.Context, checkpoint CheckpointFunc, dir string, fn func()) {
+	if checkpoint == nil {
+		fn()
+		return
+	}
+	objects, err := os.MkdirTemp("", "shelley-objects-*")
+	if err != nil {
+		fn()
+		return
+	}
+	defer os.RemoveAll(objects)
+	before, err := snapshotWorkTree(ctx, dir, objects, nil)
+	if err != nil {
+		slog.DebugContext(ctx, "bash checkpoint: no snapshot before command", "error", err)
+		fn()
+		return
+	}
+	fn()
+	// The command may have been cancelled; the snapshot still matters.
+	ctx = context.WithoutCancel(ctx)
+	after, err := snapshotWorkTree(ctx, dir, objects, before)
+	if err != nil {
+		slog.WarnContext(ctx, "bash checkpoint: no snapshot after command", "error", err)
+		return
+	}
+	files, err := before.changedFiles(ctx, after)
+	if err != nil {
+		slog.WarnContext(ctx, "bash checkpoint: failed to diff snapshots", "error", err)
+		return
+	}
+	if len(files) > 0 {
+		checkpoint(ctx, bashName, files)
+	}
+}
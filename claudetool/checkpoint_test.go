@@ -0,0 +1,160 @@
+package claudetool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func initCheckpointRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "Test"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestWorkTreeSnapshotChangedFiles(t *testing.T) {
+	dir := initCheckpointRepo(t)
+	ctx := context.Background()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("committed.txt", "committed\n")
+	write(".gitignore", "ignored.txt\n")
+	if out, err := exec.Command("git", "-C", dir, "add", ".").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+	if out, err := exec.Command("git", "-C", dir, "commit", "-qm", "init").CombinedOutput(); err != nil {
+		t.Fatalf("git commit: %v\n%s", err, out)
+	}
+	write("committed.txt", "edited before\n")
+	write("untracked.txt", "untracked\n")
+	write("ignored.txt", "ignored\n")
+	write("big.bin", strings.Repeat("x", maxCheckpointFileSize+1))
+	repoObjects := countFiles(t, filepath.Join(dir, ".git", "objects"))
+
+	objects := t.TempDir()
+	before, err := snapshotWorkTree(ctx, dir, objects, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("committed.txt", "edited after\n")
+	os.Remove(filepath.Join(dir, "untracked.txt"))
+	write("created.txt", "new\n")
+	write("ignored.txt", "still ignored\n")
+	write("big.bin", "small now\n")
+	after, err := snapshotWorkTree(ctx, dir, objects, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := before.changedFiles(ctx, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	want := []FileCheckpoint{
+		{Path: "committed.txt", Existed: true, Content: []byte("edited before\n")},
+		{Path: "created.txt"},
+		{Path: "untracked.txt", Existed: true, Content: []byte("untracked\n")},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %d changed files, want %d: %+v", len(files), len(want), files)
+	}
+	for i, w := range want {
+		f := files[i]
+		if filepath.Base(f.Path) != w.Path || f.Existed != w.Existed || string(f.Content) != string(w.Content) {
+			t.Errorf("file %d = %s existed=%v %q, want %s existed=%v %q", i, f.Path, f.Existed, f.Content, w.Path, w.Existed, w.Content)
+		}
+	}
+
+	// Nothing was written to the repository's object store.
+	if n := countFiles(t, filepath.Join(dir, ".git", "objects")); n != repoObjects {
+		t.Errorf("repository objects: %d, had %d", n, repoObjects)
+	}
+	// The real index is untouched.
+	out, err := exec.Command("git", "-C", dir, "diff", "--cached", "--name-only").Output()
+	if err != nil || len(out) != 0 {
+		t.Errorf("index modified: %q, %v", out, err)
+	}
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCheckpointBashOutsideRepo(t *testing.T) {
+	called := false
+	ran := false
+	checkpointBash(context.Background(), func(context.Context, string, []FileCheckpoint) { called = true }, t.TempDir(), func() { ran = true })
+	if !ran || called {
+		t.Errorf("ran=%v checkpoint called=%v", ran, called)
+	}
+}
+
+func TestPatchCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(path, []byte("hello world\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var got []FileCheckpoint
+	patch := &PatchTool{
+		WorkingDir: NewMutableWorkingDir(dir),
+		Checkpoint: func(ctx context.Context, tool string, files []FileCheckpoint) {
+			if tool != PatchName {
+				t.Errorf("tool = %q", tool)
+			}
+			got = append(got, files...)
+		},
+	}
+	run := func(input PatchInput) {
+		t.Helper()
+		m, _ := json.Marshal(input)
+		if out := patch.Run(context.Background(), m); out.Error != nil {
+			t.Fatal(out.Error)
+		}
+	}
+	run(PatchInput{Path: "file.txt", Patches: []PatchRequest{{Operation: "replace", OldText: "world", NewText: "there"}}})
+	run(PatchInput{Path: "new.txt", Patches: []PatchRequest{{Operation: "overwrite", NewText: "new"}}})
+
+	if len(got) != 2 {
+		t.Fatalf("got %d checkpoints, want 2", len(got))
+	}
+	if got[0].Path != path || !got[0].Existed || string(got[0].Content) != "hello world\n" || got[0].Mode != 0o755 {
+		t.Errorf("existing file checkpoint = %+v", got[0])
+	}
+	if got[1].Path != filepath.Join(dir, "new.txt") || got[1].Existed {
+		t.Errorf("new file checkpoint = %+v", got[1])
+	}
+}
@@ -42,6 +42,7 @@ func (k *KeywordTool) Tool() *llm.Tool {
 		Name:        keywordName,
 		Description: keywordDescription,
 		InputSchema: llm.MustSchema(keywordInputSchema),
+		ReadOnly:    true,
 		Run:         llm.RunJSON(k.keywordRun),
 	}
 }
@@ -51,6 +51,8 @@ The prompt is read from files (to handle large inputs cleanly). prompt_files
 is a list of paths: text files are concatenated in order, and image files
 (png, jpeg, gif, webp, heic) are attached as images. Attaching images requires a
 vision-capable model.
+Pass output_schema (a JSON Schema for an object) to get JSON matching it; the
+response is checked against the schema before it is returned.
 Short results are returned inline; long results are written to a file.`
 
 	if len(t.AvailableModels) > 0 {
@@ -99,6 +101,10 @@ func (t *LLMOneShotTool) llmOneShotInputSchema() string {
     "system_prompt": {
       "type": "string",
       "description": "Optional system prompt to include."
+    },
+    "output_schema": {
+      "type": "object",
+      "description": "Optional JSON Schema (with \"type\": \"object\") the response must match. The response is then a JSON object."
     }%s
   }
 }`, modelProp)
@@ -120,10 +126,11 @@ func (s *stringOrList) UnmarshalJSON(data []byte) error {
 }
 
 type llmOneShotInput struct {
-	PromptFiles  stringOrList `json:"prompt_files,omitempty"`
-	OutputFile   string       `json:"output_file,omitempty"`
-	Model        string       `json:"model,omitempty"`
-	SystemPrompt string       `json:"system_prompt,omitempty"`
+	PromptFiles  stringOrList    `json:"prompt_files,omitempty"`
+	OutputFile   string          `json:"output_file,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	SystemPrompt string          `json:"system_prompt,omitempty"`
+	OutputSchema json.RawMessage `json:"output_schema,omitempty"`
 }
 
 // Tool returns an llm.Tool for the LLM one-shot functionality.
@@ -190,6 +197,11 @@ func (t *LLMOneShotTool) run(ctx context.Context, req llmOneShotInput) llm.ToolO
 	if modelID == "" {
 		return llm.ErrorfToolOut("no model specified and no default model configured")
 	}
+	if len(req.OutputSchema) > 0 {
+		if err := llm.CheckResponseSchema(req.OutputSchema); err != nil {
+			return llm.ErrorfToolOut("invalid output_schema: %w", err)
+		}
+	}
 
 	if t.LLMProvider == nil {
 		return llm.ErrorfToolOut("LLM provider not configured")
@@ -275,7 +287,8 @@ func (t *LLMOneShotTool) run(ctx context.Context, req llmOneShotInput) llm.ToolO
 	}
 	message.Content = append(message.Content, images...)
 	llmReq := &llm.Request{
-		Messages: []llm.Message{message},
+		Messages:       []llm.Message{message},
+		ResponseSchema: req.OutputSchema,
 	}
 	if req.SystemPrompt != "" {
 		llmReq.System = []llm.SystemContent{{Type: "text", Text: req.SystemPrompt}}
@@ -288,13 +301,22 @@ func (t *LLMOneShotTool) run(ctx context.Context, req llmOneShotInput) llm.ToolO
 	}
 
 	// Extract text from the response
-	var result strings.Builder
-	for _, content := range resp.Content {
-		if content.Type == llm.ContentTypeText {
-			result.WriteString(content.Text)
+	var resultText string
+	if len(req.OutputSchema) > 0 {
+		data, err := llm.StructuredResult(resp, req.OutputSchema)
+		if err != nil {
+			return llm.ErrorfToolOut("%w", err)
+		}
+		resultText = string(data)
+	} else {
+		var result strings.Builder
+		for _, content := range resp.Content {
+			if content.Type == llm.ContentTypeText {
+				result.WriteString(content.Text)
+			}
 		}
+		resultText = result.String()
 	}
-	resultText := result.String()
 
 	// Determine where to put the result
 	outputPath := req.OutputFile
@@ -590,3 +590,52 @@ func TestLLMOneShotPromptFileErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestLLMOneShotOutputSchema(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "prompt.txt"), []byte("Classify: the build is red"), 0o644)
+	schema := json.RawMessage(`{"type":"object","required":["label"],"properties":{"label":{"enum":["ok","broken"]}}}`)
+
+	for _, tc := range []struct {
+		response string
+		wantErr  string
+	}{
+		{response: `{"label":"broken"}`},
+		{response: "```json\n{\"label\": \"ok\"}\n```"},
+		{response: `{"label":"red"}`, wantErr: "does not match the schema"},
+		{response: `broken`, wantErr: "not JSON"},
+	} {
+		var capturedReq *llm.Request
+		svc := &oneShotMockService{response: tc.response, onDo: func(req *llm.Request) { capturedReq = req }}
+		tool := &LLMOneShotTool{
+			LLMProvider: &oneShotMockProvider{services: map[string]llm.Service{"test-model": svc}},
+			ModelID:     "test-model",
+			WorkingDir:  NewMutableWorkingDir(dir),
+		}
+		input, _ := json.Marshal(llmOneShotInput{PromptFiles: []string{"prompt.txt"}, OutputSchema: schema})
+		result := tool.Tool().Run(context.Background(), input)
+
+		if tc.wantErr != "" {
+			if result.Error == nil || !strings.Contains(result.Error.Error(), tc.wantErr) {
+				t.Errorf("response %q: error = %v, want %q", tc.response, result.Error, tc.wantErr)
+			}
+			continue
+		}
+		if result.Error != nil {
+			t.Fatalf("response %q: unexpected error: %v", tc.response, result.Error)
+		}
+		if string(capturedReq.ResponseSchema) != string(schema) {
+			t.Errorf("ResponseSchema = %s", capturedReq.ResponseSchema)
+		}
+		text := result.LLMContent[0].Text
+		if !strings.HasPrefix(text, `{"label":`) {
+			t.Errorf("response %q: result = %s", tc.response, text)
+		}
+	}
+
+	tool := &LLMOneShotTool{ModelID: "test-model", WorkingDir: NewMutableWorkingDir(dir)}
+	input, _ := json.Marshal(llmOneShotInput{PromptFiles: []string{"prompt.txt"}, OutputSchema: json.RawMessage(`{"type":"string"}`)})
+	if result := tool.Tool().Run(context.Background(), input); result.Error == nil || !strings.Contains(result.Error.Error(), "invalid output_schema") {
+		t.Errorf("non-object schema: error = %v", result.Error)
+	}
+}
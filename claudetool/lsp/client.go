@@ -0,0 +1,588 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// message is a JSON-RPC message in either direction: a request, a
+// response or a notification.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("lsp error %d: %s", e.Code, e.Message)
+}
+
+const rpcMethodNotFound = -32601
+
+// Position, Range and Location are the LSP types of the same names.
+// Character offsets are in the encoding negotiated at initialize.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// Diagnostic is a problem the server reported in a file.
+type Diagnostic struct {
+	Range    Range           `json:"range"`
+	Severity int             `json:"severity,omitempty"`
+	Code     json.RawMessage `json:"code,omitempty"`
+	Source   string          `json:"source,omitempty"`
+	Message  string          `json:"message"`
+}
+
+// document is a file the client has opened on the server.
+type document struct {
+	version int
+	text    string
+}
+
+// diagnostics are the latest diagnostics published for a file. seq counts
+// publications, so callers can wait for one newer than they have seen.
+type diagnostics struct {
+	seq   int
+	items []Diagnostic
+}
+
+// client is a running language server for one workspace root.
+type client struct {
+	cfg    ServerConfig
+	root   string
+	logger *slog.Logger
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tailBuffer
+
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	nextID    int64
+	pending   map[string]chan *message
+	err       error // set once the read loop exits
+	docs      map[string]*document
+	diags     map[string]*diagnostics
+	published chan struct{} // closed and replaced on every publishDiagnostics
+	enc       encoding      // of character offsets in positions
+
+	done      chan struct{}
+	exited    chan struct{}
+	closeOnce sync.Once
+}
+
+// startClient starts the server described by cfg in root and performs the
+// initialize handshake.
+func startClient(ctx context.Context, cfg ServerConfig, root string, logger *slog.Logger) (*client, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Dir = root
+	cmd.Env = os.Environ()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true} // so close can kill the whole group
+	stderr := &tailBuffer{max: 4096}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", cfg.Command, err)
+	}
+	c := &client{
+		cfg:       cfg,
+		root:      root,
+		logger:    logger.With("lsp_server", cfg.Command, "root", root),
+		cmd:       cmd,
+		stdin:     stdin,
+		stderr:    stderr,
+		pending:   make(map[string]chan *message),
+		docs:      make(map[string]*document),
+		diags:     make(map[string]*diagnostics),
+		published: make(chan struct{}),
+		done:      make(chan struct{}),
+		exited:    make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(c.exited)
+	}()
+	go c.readLoop(stdout)
+	if err := c.initialize(ctx); err != nil {
+		c.close()
+		return nil, fmt.Errorf("%s: initialize: %w", cfg.Command, err)
+	}
+	return c, nil
+}
+
+func (c *client) initialize(ctx context.Context) error {
+	rootURI := fileURI(c.root)
+	params := map[string]any{
+		"processId": os.Getpid(),
+		"clientInfo": map[string]any{
+			"name": "shelley",
+		},
+		"rootUri": rootURI,
+		"workspaceFolders": []map[string]any{
+			{"uri": rootURI, "name": filepath.Base(c.root)},
+		},
+		"capabilities": map[string]any{
+			"general": map[string]any{
+				"positionEncodings": []string{"utf-8", "utf-16"},
+			},
+			"workspace": map[string]any{
+				"configuration":    true,
+				"workspaceFolders": true,
+				"symbol":           map[string]any{},
+			},
+			"textDocument": map[string]any{
+				"synchronization":    map[string]any{},
+				"publishDiagnostics": map[string]any{"versionSupport": true},
+				"hover":              map[string]any{"contentFormat": []string{"plaintext", "markdown"}},
+				"definition":         map[string]any{"linkSupport": true},
+				"references":         map[string]any{},
+				"rename":             map[string]any{},
+			},
+		},
+	}
+	var result struct {
+		Capabilities struct {
+			PositionEncoding string `json:"positionEncoding"`
+		} `json:"capabilities"`
+	}
+	if err := c.request(ctx, "initialize", params, &result); err != nil {
+		return err
+	}
+	if result.Capabilities.PositionEncoding == "utf-8" {
+		c.enc = utf8Encoding
+	}
+	return c.notify("initialized", map[string]any{})
+}
+
+func (c *client) readLoop(stdout io.Reader) {
+	r := bufio.NewReader(stdout)
+	var err error
+	for {
+		var body []byte
+		if body, err = readFrame(r); err != nil {
+			break
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			c.logger.Debug("lsp: ignoring malformed message", "error", err)
+			continue
+		}
+		switch {
+		case msg.Method == "" && len(msg.ID) > 0:
+			c.mu.Lock()
+			ch := c.pending[string(msg.ID)]
+			delete(c.pending, string(msg.ID))
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- &msg
+			}
+		case msg.Method != "" && len(msg.ID) > 0:
+			c.write(replyToServerRequest(&msg))
+		case msg.Method == "textDocument/publishDiagnostics":
+			c.publishDiagnostics(msg.Params)
+		default:
+			// Other notifications (progress, logging) are not used.
+		}
+	}
+	// stderr is only fully copied once the process has been reaped; give a
+	// crashing server a moment so its last words make it into the error.
+	select {
+	case <-c.exited:
+	case <-time.After(time.Second):
+	}
+	c.mu.Lock()
+	c.err = fmt.Errorf("%s exited: %w%s", c.cfg.Command, err, c.stderr.suffix())
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// readFrame reads one Content-Length framed message body.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bad Content-Length header %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (c *client) write(b []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n", len(b)); err != nil {
+		return err
+	}
+	_, err := c.stdin.Write(b)
+	return err
+}
+
+// request sends a request and decodes its result into result, which may be
+// nil. A null result leaves result untouched.
+func (c *client) request(ctx context.Context, method string, params, result any) error {
+	raw, err := marshalParams(params)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return err
+	}
+	c.nextID++
+	n := c.nextID
+	id := strconv.FormatInt(n, 10)
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	b, _ := json.Marshal(&message{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method, Params: raw})
+	if err := c.write(b); err != nil {
+		c.forget(id)
+		return fmt.Errorf("write to %s: %w", c.cfg.Command, err)
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil || len(resp.Result) == 0 || string(resp.Result) == "null" {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("decode %s result: %w", method, err)
+		}
+		return nil
+	case <-c.done:
+		c.forget(id)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	case <-ctx.Done():
+		c.forget(id)
+		c.notify("$/cancelRequest", map[string]any{"id": n})
+		return ctx.Err()
+	}
+}
+
+func (c *client) forget(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *client) notify(method string, params any) error {
+	raw, err := marshalParams(params)
+	if err != nil {
+		return err
+	}
+	b, _ := json.Marshal(&message{JSONRPC: "2.0", Method: method, Params: raw})
+	return c.write(b)
+}
+
+// marshalParams encodes params, leaving nil params out of the message.
+func marshalParams(params any) (json.RawMessage, error) {
+	if params == nil {
+		return nil, nil
+	}
+	return json.Marshal(params)
+}
+
+// replyToServerRequest builds our answer to a request initiated by the
+// server. Configuration gets defaults, registrations and progress are
+// acknowledged, and edits are refused: the lsp tool never changes files.
+func replyToServerRequest(msg *message) []byte {
+	reply := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+	switch msg.Method {
+	case "workspace/configuration":
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		reply["result"] = make([]any, len(params.Items))
+	case "window/workDoneProgress/create", "client/registerCapability", "client/unregisterCapability", "window/showMessageRequest":
+		reply["result"] = nil
+	case "workspace/applyEdit":
+		reply["result"] = map[string]any{"applied": false, "failureReason": "this client does not apply edits"}
+	case "workspace/workspaceFolders":
+		reply["result"] = nil
+	default:
+		reply["error"] = &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+	b, _ := json.Marshal(reply)
+	return b
+}
+
+func (c *client) publishDiagnostics(raw json.RawMessage) {
+	var params struct {
+		URI         string       `json:"uri"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return
+	}
+	path := uriPath(params.URI)
+	c.mu.Lock()
+	d := c.diags[path]
+	if d == nil {
+		d = &diagnostics{}
+		c.diags[path] = d
+	}
+	d.seq++
+	d.items = params.Diagnostics
+	close(c.published)
+	c.published = make(chan struct{})
+	c.mu.Unlock()
+}
+
+// syncFile makes the server's view of path match the disk, opening it if
+// need be, and resynchronizes every other open file that changed. It
+// returns the diagnostics sequence number for path from before any change
+// was sent, and whether path itself changed.
+func (c *client) syncFile(path string) (seq int, changed bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false, err
+	}
+	c.mu.Lock()
+	if d := c.diags[path]; d != nil {
+		seq = d.seq
+	}
+	others := make([]string, 0, len(c.docs))
+	for p := range c.docs {
+		if p != path {
+			others = append(others, p)
+		}
+	}
+	c.mu.Unlock()
+	for _, p := range others {
+		c.syncOpen(p)
+	}
+	changed, err = c.syncText(path, string(data))
+	return seq, changed, err
+}
+
+// syncOpen resynchronizes an already-open file from disk, closing it if it
+// has been deleted.
+func (c *client) syncOpen(path string) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		c.mu.Lock()
+		delete(c.docs, path)
+		c.mu.Unlock()
+		c.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": fileURI(path)}})
+		return
+	}
+	if err == nil {
+		c.syncText(path, string(data))
+	}
+}
+
+func (c *client) syncText(path, text string) (bool, error) {
+	c.mu.Lock()
+	doc := c.docs[path]
+	if doc != nil && doc.text == text {
+		c.mu.Unlock()
+		return false, nil
+	}
+	opening := doc == nil
+	if opening {
+		doc = &document{}
+		c.docs[path] = doc
+	}
+	doc.version++
+	doc.text = text
+	version := doc.version
+	c.mu.Unlock()
+
+	uri := fileURI(path)
+	if opening {
+		return true, c.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": languageID(path), "version": version, "text": text},
+		})
+	}
+	return true, c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": version},
+		"contentChanges": []map[string]any{{"text": text}},
+	})
+}
+
+// Timeouts for waiting on diagnostics after a change. Servers often
+// publish more than once (syntax errors first, type errors later), so
+// after the first publication the wait continues until the file has been
+// quiet for diagnosticsSettle.
+var (
+	diagnosticsWait   = 5 * time.Second
+	diagnosticsSettle = 300 * time.Millisecond
+)
+
+// waitDiagnostics returns the diagnostics for path once the server has
+// published some newer than seq, or what it has when ctx or the wait
+// times out.
+func (c *client) waitDiagnostics(ctx context.Context, path string, seq int) []Diagnostic {
+	deadline := time.NewTimer(diagnosticsWait)
+	defer deadline.Stop()
+	var settle <-chan time.Time
+	for {
+		c.mu.Lock()
+		latest := seq
+		if d := c.diags[path]; d != nil {
+			latest = d.seq
+		}
+		published := c.published
+		c.mu.Unlock()
+		if latest > seq {
+			seq = latest
+			settle = time.After(diagnosticsSettle)
+		}
+		select {
+		case <-published:
+		case <-settle:
+			return c.cachedDiagnostics(path)
+		case <-deadline.C:
+			return c.cachedDiagnostics(path)
+		case <-ctx.Done():
+			return c.cachedDiagnostics(path)
+		case <-c.done:
+			return c.cachedDiagnostics(path)
+		}
+	}
+}
+
+func (c *client) cachedDiagnostics(path string) []Diagnostic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d := c.diags[path]; d != nil {
+		return d.items
+	}
+	return nil
+}
+
+// hasDiagnostics reports whether the server has published diagnostics
+// for path at all.
+func (c *client) hasDiagnostics(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.diags[path] != nil
+}
+
+// close asks the server to shut down, then kills its process group if it
+// does not exit promptly.
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if c.request(ctx, "shutdown", nil, nil) == nil {
+			c.notify("exit", nil)
+		}
+		cancel()
+		c.stdin.Close()
+		pgid := c.cmd.Process.Pid // Setpgid: true => pgid == pid
+		for _, step := range []struct {
+			sig  syscall.Signal
+			wait time.Duration
+		}{{0, time.Second}, {syscall.SIGTERM, 2 * time.Second}, {syscall.SIGKILL, 5 * time.Second}} {
+			if step.sig != 0 {
+				syscall.Kill(-pgid, step.sig)
+			}
+			select {
+			case <-c.exited:
+				return
+			case <-time.After(step.wait):
+			}
+		}
+		c.logger.Warn("lsp: server did not exit after SIGKILL")
+	})
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// uriPath returns the file path of a file:// URI, or the URI itself if it
+// is not one.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// tailBuffer keeps the last max bytes written to it. It captures a
+// server's stderr so startup failures can be reported with some context.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = b.buf[over:]
+	}
+	return len(p), nil
+}
+
+// suffix formats the captured stderr for appending to an error message.
+func (b *tailBuffer) suffix() string {
+	b.mu.Lock()
+	s := strings.TrimSpace(string(b.buf))
+	b.mu.Unlock()
+	if s == "" {
+		return ""
+	}
+	return "; stderr: " + s
+}
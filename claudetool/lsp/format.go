@@ -0,0 +1,111 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Diagnostic severities.
+const (
+	severityError   = 1
+	severityWarning = 2
+	severityInfo    = 3
+	severityHint    = 4
+)
+
+func severityName(s int) string {
+	switch s {
+	case severityWarning:
+		return "warning"
+	case severityInfo:
+		return "info"
+	case severityHint:
+		return "hint"
+	}
+	return "error" // a missing severity is up to the client; treat it as an error
+}
+
+// formatDiagnostics lists diags for path, one per line, as
+// path:line:column: severity: message.
+func (c *client) formatDiagnostics(path string, diags []Diagnostic, wd string, src *sourceCache) string {
+	lines := make([]string, 0, len(diags))
+	for _, d := range diags {
+		line := fmt.Sprintf("%s: %s: %s", c.locationString(Location{URI: fileURI(path), Range: d.Range}, wd, src), severityName(d.Severity), d.Message)
+		if d.Source != "" {
+			line += " (" + d.Source + ")"
+		}
+		lines = append(lines, line)
+	}
+	return limitLines(lines)
+}
+
+// symbolKinds names the LSP SymbolKind values, starting at 1.
+var symbolKinds = []string{
+	"file", "module", "namespace", "package", "class", "method", "property", "field",
+	"constructor", "enum", "interface", "function", "variable", "constant", "string",
+	"number", "boolean", "array", "object", "key", "null", "enum member", "struct",
+	"event", "operator", "type parameter",
+}
+
+func symbolKind(k int) string {
+	if k >= 1 && k <= len(symbolKinds) {
+		return symbolKinds[k-1]
+	}
+	return "symbol"
+}
+
+// displayPath returns path relative to wd when it is inside it.
+func displayPath(path, wd string) string {
+	if wd != "" && isWithin(path, wd) {
+		if rel, err := filepath.Rel(wd, path); err == nil {
+			return rel
+		}
+	}
+	return path
+}
+
+// sourceCache reads files for quoting lines in results, once per call.
+type sourceCache struct {
+	files map[string]*string
+}
+
+func newSourceCache() *sourceCache {
+	return &sourceCache{files: make(map[string]*string)}
+}
+
+// text returns the contents of path.
+func (s *sourceCache) text(path string) (string, bool) {
+	p, ok := s.files[path]
+	if !ok {
+		if data, err := os.ReadFile(path); err == nil {
+			text := string(data)
+			p = &text
+		}
+		s.files[path] = p
+	}
+	if p == nil {
+		return "", false
+	}
+	return *p, true
+}
+
+// line returns the 0-based line n of path, without its line ending.
+func (s *sourceCache) line(path string, n int) (string, bool) {
+	text, ok := s.text(path)
+	if !ok || n < 0 {
+		return "", false
+	}
+	for ; n > 0; n-- {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			return "", false
+		}
+		text = text[i+1:]
+	}
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSuffix(text, "\r"), true
+}
@@ -0,0 +1,332 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+// When LSP_TEST_SERVER is set, the test binary acts as a language server
+// instead of running tests. This keeps the tests free of external
+// dependencies.
+func TestMain(m *testing.M) {
+	if os.Getenv("LSP_TEST_SERVER") == "1" {
+		serveFake(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeServer is a tiny language server for Go-like files. Identifiers are
+// words; "func NAME" defines NAME, and any line containing BROKEN gets an
+// error diagnostic.
+type fakeServer struct {
+	w    io.Writer
+	docs map[string]string
+}
+
+var wordRE = regexp.MustCompile(`\w+`)
+
+func serveFake(r io.Reader, w io.Writer) {
+	s := &fakeServer{w: w, docs: make(map[string]string)}
+	br := bufio.NewReader(r)
+	for {
+		body, err := readFrame(br)
+		if err != nil {
+			return
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			continue
+		}
+		if msg.Method == "" {
+			continue // a reply to our workspace/configuration request
+		}
+		result, notify := s.handle(&msg)
+		if len(msg.ID) > 0 {
+			s.send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+		}
+		if notify != nil {
+			notify()
+		}
+	}
+}
+
+func (s *fakeServer) send(v any) {
+	b, _ := json.Marshal(v)
+	fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(b), b)
+}
+
+func (s *fakeServer) handle(msg *message) (result any, notify func()) {
+	var params struct {
+		TextDocument struct {
+			URI  string `json:"uri"`
+			Text string `json:"text"`
+		} `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+		Position Position `json:"position"`
+		Query    string   `json:"query"`
+		NewName  string   `json:"newName"`
+	}
+	json.Unmarshal(msg.Params, &params)
+	uri := params.TextDocument.URI
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{"capabilities": map[string]any{"positionEncoding": "utf-16"}}, nil
+	case "initialized":
+		// Servers ask the client things of their own; make sure that works.
+		s.send(map[string]any{"jsonrpc": "2.0", "id": 99, "method": "workspace/configuration", "params": map[string]any{"items": []any{map[string]any{}}}})
+	case "textDocument/didOpen":
+		s.docs[uri] = params.TextDocument.Text
+		return nil, func() { s.publish(uri) }
+	case "textDocument/didChange":
+		s.docs[uri] = params.ContentChanges[0].Text
+		return nil, func() { s.publish(uri) }
+	case "textDocument/definition":
+		word := s.wordAt(uri, params.Position)
+		for i, line := range strings.Split(s.docs[uri], "\n") {
+			if j := strings.Index(line, "func "+word+"("); j >= 0 {
+				return []Location{{URI: uri, Range: lineRange(i, j+5, len(word))}}, nil
+			}
+		}
+		return nil, nil
+	case "textDocument/references":
+		return s.occurrences(uri, s.wordAt(uri, params.Position)), nil
+	case "textDocument/hover":
+		return map[string]any{"contents": map[string]any{"kind": "markdown", "value": "func " + s.wordAt(uri, params.Position) + "()"}}, nil
+	case "workspace/symbol":
+		var syms []map[string]any
+		for uri, text := range s.docs {
+			for i, line := range strings.Split(text, "\n") {
+				if name, ok := strings.CutPrefix(line, "func "); ok && strings.Contains(name, params.Query) {
+					name, _, _ = strings.Cut(name, "(")
+					syms = append(syms, map[string]any{"name": name, "kind": 12, "location": Location{URI: uri, Range: lineRange(i, 5, len(name))}})
+				}
+			}
+		}
+		return syms, nil
+	case "textDocument/rename":
+		var edits []textEdit
+		for _, loc := range s.occurrences(uri, s.wordAt(uri, params.Position)) {
+			edits = append(edits, textEdit{Range: loc.Range, NewText: params.NewName})
+		}
+		return map[string]any{"changes": map[string]any{uri: edits}}, nil
+	case "exit":
+		os.Exit(0)
+	}
+	return nil, nil
+}
+
+func (s *fakeServer) publish(uri string) {
+	diags := []Diagnostic{}
+	for i, line := range strings.Split(s.docs[uri], "\n") {
+		if j := strings.Index(line, "BROKEN"); j >= 0 {
+			diags = append(diags, Diagnostic{Range: lineRange(i, j, 6), Severity: severityError, Source: "fake", Message: "undefined: BROKEN"})
+		}
+		if j := strings.Index(line, "// TODO"); j >= 0 {
+			diags = append(diags, Diagnostic{Range: lineRange(i, j, 7), Severity: severityHint, Message: "todo"})
+		}
+	}
+	s.send(map[string]any{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": map[string]any{"uri": uri, "diagnostics": diags}})
+}
+
+func (s *fakeServer) wordAt(uri string, pos Position) string {
+	lines := strings.Split(s.docs[uri], "\n")
+	if pos.Line >= len(lines) {
+		return ""
+	}
+	for _, m := range wordRE.FindAllStringIndex(lines[pos.Line], -1) {
+		if m[0] <= pos.Character && pos.Character < m[1] {
+			return lines[pos.Line][m[0]:m[1]]
+		}
+	}
+	return ""
+}
+
+func (s *fakeServer) occurrences(uri, word string) []Location {
+	var locs []Location
+	for i, line := range strings.Split(s.docs[uri], "\n") {
+		for _, m := range wordRE.FindAllStringIndex(line, -1) {
+			if line[m[0]:m[1]] == word {
+				locs = append(locs, Location{URI: uri, Range: lineRange(i, m[0], len(word))})
+			}
+		}
+	}
+	return locs
+}
+
+func lineRange(line, col, n int) Range {
+	return Range{Start: Position{Line: line, Character: col}, End: Position{Line: line, Character: col + n}}
+}
+
+const testSource = `package main
+
+func helper() {}
+
+func main() {
+	helper()
+	helper()
+}
+`
+
+// newTestManager returns a Manager running the fake server for .go files
+// in a fresh project directory.
+func newTestManager(t *testing.T) (*Manager, string) {
+	t.Helper()
+	t.Setenv("LSP_TEST_SERVER", "1")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(testSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager([]ServerConfig{{
+		Language:    "go",
+		Command:     os.Args[0],
+		Extensions:  []string{".go"},
+		RootMarkers: []string{"go.mod"},
+	}}, nil)
+	t.Cleanup(m.Close)
+	return m, dir
+}
+
+func runTool(t *testing.T, tool *llm.Tool, input map[string]any) string {
+	t.Helper()
+	raw, _ := json.Marshal(input)
+	out := tool.Run(context.Background(), raw)
+	if out.Error != nil {
+		t.Fatalf("%v: %v", input, out.Error)
+	}
+	return out.LLMContent[0].Text
+}
+
+func TestTool(t *testing.T) {
+	m, dir := newTestManager(t)
+	tool := m.Tool(func() string { return dir })
+
+	tests := []struct {
+		input map[string]any
+		want  string
+	}{
+		{map[string]any{"action": "definition", "path": "main.go", "line": 6, "symbol": "helper"}, "main.go:3:6: func helper() {}"},
+		{map[string]any{"action": "references", "path": "main.go", "line": 3, "column": 7}, "3 references:\nmain.go:3:6: func helper() {}\nmain.go:6:2: helper()\nmain.go:7:2: helper()"},
+		{map[string]any{"action": "hover", "path": filepath.Join(dir, "main.go"), "line": 6, "symbol": "helper"}, "func helper()"},
+		{map[string]any{"action": "symbols", "query": "help"}, "function helper  main.go:3:6"},
+		{map[string]any{"action": "diagnostics", "path": "main.go"}, "No diagnostics for main.go."},
+	}
+	for _, tt := range tests {
+		if got := runTool(t, tool, tt.input); got != tt.want {
+			t.Errorf("%v:\ngot  %q\nwant %q", tt.input, got, tt.want)
+		}
+	}
+
+	got := runTool(t, tool, map[string]any{"action": "rename", "path": "main.go", "line": 3, "symbol": "helper", "new_name": "assist"})
+	for _, want := range []string{"3 edits in 1 files", "-func helper() {}", "+func assist() {}", "+\tassist()"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("rename preview missing %q:\n%s", want, got)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "main.go")); string(data) != testSource {
+		t.Error("rename preview changed the file")
+	}
+
+	for _, input := range []map[string]any{
+		{"action": "definition", "path": "main.go", "line": 6, "symbol": "nothere"},
+		{"action": "definition", "path": "main.go", "line": 60, "column": 1},
+		{"action": "definition", "path": "README.md", "line": 1, "column": 1},
+		{"action": "rename", "path": "main.go", "line": 3, "symbol": "helper"},
+	} {
+		raw, _ := json.Marshal(input)
+		if out := tool.Run(context.Background(), raw); out.Error == nil {
+			t.Errorf("%v: expected an error", input)
+		}
+	}
+}
+
+func TestPatchDiagnostics(t *testing.T) {
+	m, dir := newTestManager(t)
+	path := filepath.Join(dir, "main.go")
+	ctx := context.Background()
+
+	if got := m.PatchDiagnostics(ctx, path, dir); got != "" {
+		t.Errorf("clean file: got %q", got)
+	}
+	broken := strings.Replace(testSource, "\thelper()\n\thelper()", "\tBROKEN()\n\thelper() // TODO", 1)
+	if err := os.WriteFile(path, []byte(broken), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.PatchDiagnostics(ctx, path, dir), "main.go:6:2: error: undefined: BROKEN (fake)"; got != want {
+		t.Errorf("broken file: got %q, want %q (hints are left out)", got, want)
+	}
+	if err := os.WriteFile(path, []byte(testSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.PatchDiagnostics(ctx, path, dir); got != "" {
+		t.Errorf("fixed file: got %q", got)
+	}
+	if got := m.PatchDiagnostics(ctx, filepath.Join(dir, "notes.txt"), dir); got != "" {
+		t.Errorf("file without a server: got %q", got)
+	}
+}
+
+func TestCloseStopsServers(t *testing.T) {
+	m, dir := newTestManager(t)
+	c, err := m.clientForFile(context.Background(), filepath.Join(dir, "main.go"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+	select {
+	case <-c.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server still running after Close")
+	}
+	if _, err := m.clientForFile(context.Background(), filepath.Join(dir, "main.go"), dir); err == nil {
+		t.Error("a closed Manager should not start servers")
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	line := "a😀b"
+	if got := utf16Encoding.character(line, 2); got != 3 {
+		t.Errorf("utf-16 character = %d, want 3", got)
+	}
+	if got := utf8Encoding.character(line, 2); got != 5 {
+		t.Errorf("utf-8 character = %d, want 5", got)
+	}
+	if got := utf16Encoding.column(line, 3); got != 2 {
+		t.Errorf("utf-16 column = %d, want 2", got)
+	}
+	if got := byteOffset(line, 3, utf16Encoding); got != 5 {
+		t.Errorf("byteOffset = %d, want 5", got)
+	}
+}
+
+func TestDecodeLocations(t *testing.T) {
+	for _, raw := range []string{
+		`{"uri": "file:///a.go", "range": {"start": {"line": 1, "character": 2}, "end": {"line": 1, "character": 3}}}`,
+		`[{"uri": "file:///a.go", "range": {"start": {"line": 1, "character": 2}, "end": {"line": 1, "character": 3}}}]`,
+		`[{"targetUri": "file:///a.go", "targetRange": {}, "targetSelectionRange": {"start": {"line": 1, "character": 2}, "end": {"line": 1, "character": 3}}}]`,
+	} {
+		locs := decodeLocations(json.RawMessage(raw))
+		if len(locs) != 1 || uriPath(locs[0].URI) != "/a.go" || locs[0].Range.Start != (Position{1, 2}) {
+			t.Errorf("%s: got %+v", raw, locs)
+		}
+	}
+	if locs := decodeLocations(json.RawMessage(`null`)); len(locs) != 0 {
+		t.Errorf("null: got %+v", locs)
+	}
+}
@@ -0,0 +1,197 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Manager starts language servers on demand, one per language and
+// workspace root, and shuts them all down in Close. A Manager belongs to
+// one conversation's tool set.
+type Manager struct {
+	servers []ServerConfig
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	clients map[string]*client
+	failed  map[string]error // servers that could not be started, so we don't retry on every call
+	closed  bool
+}
+
+// NewManager returns a Manager for servers, normally DefaultServers. It
+// starts nothing until a file of one of the servers' languages is used.
+func NewManager(servers []ServerConfig, logger *slog.Logger) *Manager {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Manager{
+		servers: servers,
+		logger:  logger,
+		clients: make(map[string]*client),
+		failed:  make(map[string]error),
+	}
+}
+
+// Close shuts down every server the Manager started.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	clients := m.clients
+	m.clients = make(map[string]*client)
+	m.closed = true
+	m.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.close()
+		}()
+	}
+	wg.Wait()
+}
+
+// serverFor returns the configuration of the server that handles path.
+func (m *Manager) serverFor(path string) (ServerConfig, bool) {
+	for _, s := range m.servers {
+		if s.handles(path) {
+			return s, true
+		}
+	}
+	return ServerConfig{}, false
+}
+
+// clientForFile returns the running server for path, starting it if need
+// be. workingDir is the workspace root when no root marker is found above
+// path and path is inside it.
+func (m *Manager) clientForFile(ctx context.Context, path, workingDir string) (*client, error) {
+	cfg, ok := m.serverFor(path)
+	if !ok {
+		return nil, fmt.Errorf("no language server is available for %s files", filepath.Ext(path))
+	}
+	root := cfg.findRoot(filepath.Dir(path))
+	if root == "" {
+		root = filepath.Dir(path)
+		if workingDir != "" && isWithin(path, workingDir) {
+			root = workingDir
+		}
+	}
+	return m.client(ctx, cfg, root)
+}
+
+// clientsForDir returns a running server for each language with a
+// workspace root at or above dir.
+func (m *Manager) clientsForDir(ctx context.Context, dir string) ([]*client, error) {
+	var clients []*client
+	var errs []string
+	for _, cfg := range m.servers {
+		root := cfg.findRoot(dir)
+		if root == "" {
+			continue
+		}
+		c, err := m.client(ctx, cfg, root)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		clients = append(clients, c)
+	}
+	if len(clients) == 0 {
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+		return nil, fmt.Errorf("no language server project (%s) found at or above %s", m.markerList(), dir)
+	}
+	return clients, nil
+}
+
+func (m *Manager) markerList() string {
+	var markers []string
+	for _, s := range m.servers {
+		markers = append(markers, s.RootMarkers...)
+	}
+	return strings.Join(markers, ", ")
+}
+
+func (m *Manager) client(ctx context.Context, cfg ServerConfig, root string) (*client, error) {
+	key := cfg.Language + "\x00" + root
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, fmt.Errorf("language servers have been shut down")
+	}
+	if c := m.clients[key]; c != nil {
+		select {
+		case <-c.done:
+			// The server died; start a fresh one.
+			delete(m.clients, key)
+		default:
+			return c, nil
+		}
+	}
+	if err := m.failed[key]; err != nil {
+		return nil, err
+	}
+	// Starting is done under the lock so concurrent calls don't start
+	// duplicate servers; initialize is normally quick.
+	m.logger.InfoContext(ctx, "lsp: starting language server", "command", cfg.Command, "root", root)
+	c, err := startClient(ctx, cfg, root, m.logger)
+	if err != nil {
+		if ctx.Err() == nil {
+			m.failed[key] = err
+		}
+		return nil, err
+	}
+	m.clients[key] = c
+	return c, nil
+}
+
+// fileDiagnostics syncs path and returns its diagnostics. There is nothing
+// to wait for if the server has already reported on the unchanged file.
+func (c *client) fileDiagnostics(ctx context.Context, path string) ([]Diagnostic, error) {
+	seq, changed, err := c.syncFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !changed && c.hasDiagnostics(path) {
+		return c.cachedDiagnostics(path), nil
+	}
+	return c.waitDiagnostics(ctx, path, seq), nil
+}
+
+// PatchDiagnostics returns the errors and warnings a language server
+// reports for path after an edit, formatted for the LLM, or "" if there
+// are none or no server handles the file.
+func (m *Manager) PatchDiagnostics(ctx context.Context, path, workingDir string) string {
+	if _, ok := m.serverFor(path); !ok {
+		return ""
+	}
+	c, err := m.clientForFile(ctx, path, workingDir)
+	var diags []Diagnostic
+	if err == nil {
+		diags, err = c.fileDiagnostics(ctx, path)
+	}
+	if err != nil {
+		m.logger.WarnContext(ctx, "lsp: diagnostics after patch failed", "path", path, "error", err)
+		return ""
+	}
+	var problems []Diagnostic
+	for _, d := range diags {
+		if d.Severity == 0 || d.Severity <= severityWarning {
+			problems = append(problems, d)
+		}
+	}
+	if len(problems) == 0 {
+		return ""
+	}
+	return c.formatDiagnostics(path, problems, workingDir, newSourceCache())
+}
+
+// isWithin reports whether path is dir or inside it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
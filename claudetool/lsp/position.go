@@ -0,0 +1,65 @@
+package lsp
+
+import "unicode/utf8"
+
+// encoding is the unit of character offsets within a line. LSP positions
+// count UTF-16 code units unless the server agrees to UTF-8 bytes at
+// initialize; the lsp tool itself speaks in runes (characters).
+type encoding int
+
+const (
+	utf16Encoding encoding = iota
+	utf8Encoding
+	runeEncoding
+)
+
+func (e encoding) units(r rune) int {
+	switch e {
+	case utf8Encoding:
+		return utf8.RuneLen(r)
+	case runeEncoding:
+		return 1
+	}
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// character converts a rune column in line to an offset in e.
+func (e encoding) character(line string, col int) int {
+	n, i := 0, 0
+	for _, r := range line {
+		if i >= col {
+			break
+		}
+		n += e.units(r)
+		i++
+	}
+	return n
+}
+
+// column converts an offset in e within line to a rune column.
+func (e encoding) column(line string, char int) int {
+	col, n := 0, 0
+	for _, r := range line {
+		if n >= char {
+			break
+		}
+		n += e.units(r)
+		col++
+	}
+	return col
+}
+
+// byteOffset converts an offset in e within line to a byte offset.
+func byteOffset(line string, char int, e encoding) int {
+	n := 0
+	for i, r := range line {
+		if n >= char {
+			return i
+		}
+		n += e.units(r)
+	}
+	return len(line)
+}
@@ -0,0 +1,103 @@
+// Package lsp runs language servers (gopls, typescript-language-server,
+// pyright) on behalf of a conversation and exposes their navigation and
+// diagnostics features to the model as the lsp tool.
+package lsp
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ServerConfig describes a language server and the files it handles.
+type ServerConfig struct {
+	// Language names the server in messages and keys its instances.
+	Language string
+	// Command and Args start the server speaking LSP over stdio.
+	Command string
+	Args    []string
+	// Extensions are the file extensions, with the dot, that the server handles.
+	Extensions []string
+	// RootMarkers are files whose nearest enclosing directory becomes the
+	// server's workspace root.
+	RootMarkers []string
+}
+
+// knownServers are the language servers Shelley knows how to run.
+var knownServers = []ServerConfig{
+	{
+		Language:    "go",
+		Command:     "gopls",
+		Extensions:  []string{".go"},
+		RootMarkers: []string{"go.work", "go.mod"},
+	},
+	{
+		Language:    "typescript",
+		Command:     "typescript-language-server",
+		Args:        []string{"--stdio"},
+		Extensions:  []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".mts", ".cts"},
+		RootMarkers: []string{"tsconfig.json", "jsconfig.json", "package.json"},
+	},
+	{
+		Language:    "python",
+		Command:     "pyright-langserver",
+		Args:        []string{"--stdio"},
+		Extensions:  []string{".py", ".pyi"},
+		RootMarkers: []string{"pyrightconfig.json", "pyproject.toml", "setup.py", "setup.cfg", "requirements.txt"},
+	},
+}
+
+// DefaultServers returns the known language servers that are installed
+// (found on PATH).
+func DefaultServers() []ServerConfig {
+	var out []ServerConfig
+	for _, s := range knownServers {
+		if _, err := exec.LookPath(s.Command); err == nil {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// handles reports whether the server handles the file at path.
+func (c ServerConfig) handles(path string) bool {
+	return slices.Contains(c.Extensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// findRoot returns the nearest directory at or above dir that contains one
+// of the server's root markers, or "" if there is none.
+func (c ServerConfig) findRoot(dir string) string {
+	for {
+		for _, marker := range c.RootMarkers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return dir
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// languageID returns the LSP language identifier for path.
+func languageID(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return "go"
+	case ".ts", ".mts", ".cts":
+		return "typescript"
+	case ".tsx":
+		return "typescriptreact"
+	case ".js", ".mjs", ".cjs":
+		return "javascript"
+	case ".jsx":
+		return "javascriptreact"
+	case ".py", ".pyi":
+		return "python"
+	}
+	return "plaintext"
+}
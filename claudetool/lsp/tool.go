@@ -0,0 +1,475 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/diff"
+	"shelley.exe.dev/llm"
+)
+
+const (
+	toolName        = "lsp"
+	toolDescription = `Ask a language server about code: jump to definitions, find references, read hover docs, search workspace symbols, preview renames and get compiler diagnostics.
+
+Language servers (gopls for Go, typescript-language-server for TypeScript/JavaScript, pyright for Python) are started on first use for the project around the file.
+
+Positions are 1-based. Give the line and either the column or, more robustly, the symbol text on that line.
+
+Actions:
+- definition: where the symbol at path/line is defined
+- references: every use of the symbol at path/line
+- hover: type information and documentation for the symbol at path/line
+- symbols: workspace symbols matching query (path picks the language; otherwise every project around the working directory is searched)
+- rename: a diff of what renaming the symbol at path/line to new_name would change; nothing is written
+- diagnostics: current errors and warnings for path
+`
+	toolInputSchema = `{
+  "type": "object",
+  "required": ["action"],
+  "properties": {
+    "action": {
+      "type": "string",
+      "enum": ["definition", "references", "hover", "symbols", "rename", "diagnostics"]
+    },
+    "path": {
+      "type": "string",
+      "description": "File to query (absolute or relative to the working directory)"
+    },
+    "line": {
+      "type": "integer",
+      "description": "1-based line number"
+    },
+    "column": {
+      "type": "integer",
+      "description": "1-based column (in characters) on the line"
+    },
+    "symbol": {
+      "type": "string",
+      "description": "Text of the symbol on the line; used to find the column"
+    },
+    "query": {
+      "type": "string",
+      "description": "Symbol search query, for symbols"
+    },
+    "new_name": {
+      "type": "string",
+      "description": "New name, for rename"
+    }
+  }
+}`
+)
+
+// maxResults caps the locations and symbols listed in one result.
+const maxResults = 100
+
+// requestTimeout bounds a single tool call; a server's first request in a
+// large project can take a while as it loads the workspace.
+const requestTimeout = 2 * time.Minute
+
+type toolInput struct {
+	Action  string `json:"action"`
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Symbol  string `json:"symbol"`
+	Query   string `json:"query"`
+	NewName string `json:"new_name"`
+}
+
+// Tool returns the lsp tool. workingDir resolves relative paths and
+// shortens paths in results.
+func (m *Manager) Tool(workingDir func() string) *llm.Tool {
+	return &llm.Tool{
+		Name:        toolName,
+		Description: toolDescription,
+		InputSchema: llm.MustSchema(toolInputSchema),
+		// rename only previews its edits.
+		ReadOnly: true,
+		Run: llm.RunJSON(func(ctx context.Context, in toolInput) llm.ToolOut {
+			ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+			defer cancel()
+			text, err := m.run(ctx, in, workingDir())
+			if err != nil {
+				return llm.ErrorToolOut(err)
+			}
+			return llm.ToolOut{LLMContent: llm.TextContent(text)}
+		}),
+	}
+}
+
+func (m *Manager) run(ctx context.Context, in toolInput, wd string) (string, error) {
+	path := in.Path
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(wd, path)
+	}
+	if in.Action == "symbols" {
+		return m.symbols(ctx, path, in.Query, wd)
+	}
+	if path == "" {
+		return "", fmt.Errorf("path is required for %s", in.Action)
+	}
+	c, err := m.clientForFile(ctx, path, wd)
+	if err != nil {
+		return "", err
+	}
+	src := newSourceCache()
+	switch in.Action {
+	case "diagnostics":
+		diags, err := c.fileDiagnostics(ctx, path)
+		if err != nil {
+			return "", err
+		}
+		if len(diags) == 0 {
+			return fmt.Sprintf("No diagnostics for %s.", displayPath(path, wd)), nil
+		}
+		return c.formatDiagnostics(path, diags, wd, src), nil
+	case "definition", "references", "hover", "rename":
+	default:
+		return "", fmt.Errorf("unknown action %q", in.Action)
+	}
+
+	if _, _, err := c.syncFile(path); err != nil {
+		return "", err
+	}
+	pos, err := c.position(src, path, in.Line, in.Column, in.Symbol)
+	if err != nil {
+		return "", err
+	}
+	doc := map[string]any{"uri": fileURI(path)}
+	switch in.Action {
+	case "definition":
+		var raw json.RawMessage
+		if err := c.request(ctx, "textDocument/definition", map[string]any{"textDocument": doc, "position": pos}, &raw); err != nil {
+			return "", err
+		}
+		locs := decodeLocations(raw)
+		if len(locs) == 0 {
+			return "No definition found.", nil
+		}
+		return c.formatLocations(locs, wd, src), nil
+	case "references":
+		var locs []Location
+		params := map[string]any{"textDocument": doc, "position": pos, "context": map[string]any{"includeDeclaration": true}}
+		if err := c.request(ctx, "textDocument/references", params, &locs); err != nil {
+			return "", err
+		}
+		if len(locs) == 0 {
+			return "No references found.", nil
+		}
+		return fmt.Sprintf("%d references:\n%s", len(locs), c.formatLocations(locs, wd, src)), nil
+	case "hover":
+		var hover struct {
+			Contents json.RawMessage `json:"contents"`
+		}
+		if err := c.request(ctx, "textDocument/hover", map[string]any{"textDocument": doc, "position": pos}, &hover); err != nil {
+			return "", err
+		}
+		if text := hoverText(hover.Contents); text != "" {
+			return text, nil
+		}
+		return "No hover information.", nil
+	default: // rename
+		if in.NewName == "" {
+			return "", fmt.Errorf("new_name is required for rename")
+		}
+		var edit workspaceEdit
+		params := map[string]any{"textDocument": doc, "position": pos, "newName": in.NewName}
+		if err := c.request(ctx, "textDocument/rename", params, &edit); err != nil {
+			return "", err
+		}
+		return c.renamePreview(edit, wd, src)
+	}
+}
+
+func (m *Manager) symbols(ctx context.Context, path, query, wd string) (string, error) {
+	var clients []*client
+	if path != "" {
+		c, err := m.clientForFile(ctx, path, wd)
+		if err != nil {
+			return "", err
+		}
+		clients = []*client{c}
+	} else {
+		var err error
+		if clients, err = m.clientsForDir(ctx, wd); err != nil {
+			return "", err
+		}
+	}
+	type symbol struct {
+		Name          string `json:"name"`
+		Kind          int    `json:"kind"`
+		ContainerName string `json:"containerName"`
+		Location      struct {
+			URI   string `json:"uri"`
+			Range *Range `json:"range"`
+		} `json:"location"`
+	}
+	src := newSourceCache()
+	var lines []string
+	for _, c := range clients {
+		var syms []symbol
+		if err := c.request(ctx, "workspace/symbol", map[string]any{"query": query}, &syms); err != nil {
+			return "", fmt.Errorf("%s: %w", c.cfg.Command, err)
+		}
+		for _, s := range syms {
+			line := symbolKind(s.Kind) + " " + s.Name
+			if s.ContainerName != "" {
+				line += " (" + s.ContainerName + ")"
+			}
+			if r := s.Location.Range; r != nil {
+				line += "  " + c.locationString(Location{URI: s.Location.URI, Range: *r}, wd, src)
+			} else {
+				// A WorkspaceSymbol whose range the server resolves lazily.
+				line += "  " + displayPath(uriPath(s.Location.URI), wd)
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf("No symbols match %q.", query), nil
+	}
+	return limitLines(lines), nil
+}
+
+// position finds the server position for a 1-based line and either a
+// 1-based column or a symbol's text on that line.
+func (c *client) position(src *sourceCache, path string, line, column int, symbol string) (Position, error) {
+	if line < 1 {
+		return Position{}, fmt.Errorf("line is required (1-based)")
+	}
+	text, ok := src.line(path, line-1)
+	if !ok {
+		return Position{}, fmt.Errorf("%s has no line %d", path, line)
+	}
+	col := max(column-1, 0) // rune column
+	if symbol != "" {
+		from := byteOffset(text, col, runeEncoding)
+		i := strings.Index(text[from:], symbol)
+		if i < 0 {
+			from, i = 0, strings.Index(text, symbol)
+		}
+		if i < 0 {
+			return Position{}, fmt.Errorf("%q not found on line %d: %s", symbol, line, strings.TrimSpace(text))
+		}
+		col = utf8.RuneCountInString(text[:from+i])
+	} else if column < 1 {
+		return Position{}, fmt.Errorf("column or symbol is required")
+	}
+	return Position{Line: line - 1, Character: c.enc.character(text, col)}, nil
+}
+
+// decodeLocations decodes a definition result: a Location, a list of
+// Locations or a list of LocationLinks.
+func decodeLocations(raw json.RawMessage) []Location {
+	type link struct {
+		URI                  string `json:"uri"`
+		Range                *Range `json:"range"`
+		TargetURI            string `json:"targetUri"`
+		TargetSelectionRange *Range `json:"targetSelectionRange"`
+	}
+	var links []link
+	if err := json.Unmarshal(raw, &links); err != nil {
+		var one link
+		if json.Unmarshal(raw, &one) != nil {
+			return nil
+		}
+		links = []link{one}
+	}
+	var locs []Location
+	for _, l := range links {
+		switch {
+		case l.TargetURI != "" && l.TargetSelectionRange != nil:
+			locs = append(locs, Location{URI: l.TargetURI, Range: *l.TargetSelectionRange})
+		case l.URI != "" && l.Range != nil:
+			locs = append(locs, Location{URI: l.URI, Range: *l.Range})
+		}
+	}
+	return locs
+}
+
+func (c *client) formatLocations(locs []Location, wd string, src *sourceCache) string {
+	lines := make([]string, 0, len(locs))
+	for _, loc := range locs {
+		line := c.locationString(loc, wd, src)
+		if text, ok := src.line(uriPath(loc.URI), loc.Range.Start.Line); ok {
+			line += ": " + strings.TrimSpace(text)
+		}
+		lines = append(lines, line)
+	}
+	return limitLines(lines)
+}
+
+// locationString formats loc as path:line:column, 1-based.
+func (c *client) locationString(loc Location, wd string, src *sourceCache) string {
+	path := uriPath(loc.URI)
+	col := loc.Range.Start.Character
+	if text, ok := src.line(path, loc.Range.Start.Line); ok {
+		col = c.enc.column(text, col)
+	}
+	return fmt.Sprintf("%s:%d:%d", displayPath(path, wd), loc.Range.Start.Line+1, col+1)
+}
+
+func limitLines(lines []string) string {
+	if len(lines) > maxResults {
+		lines = append(lines[:maxResults:maxResults], fmt.Sprintf("... and %d more", len(lines)-maxResults))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hoverText renders hover contents: MarkupContent, a MarkedString or a
+// list of MarkedStrings.
+func hoverText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return strings.TrimSpace(s)
+	}
+	var markup struct {
+		Kind     string `json:"kind"`
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+	if json.Unmarshal(raw, &markup) == nil && markup.Value != "" {
+		if markup.Language != "" {
+			return "```" + markup.Language + "\n" + strings.TrimSpace(markup.Value) + "\n```"
+		}
+		return strings.TrimSpace(markup.Value)
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		var parts []string
+		for _, item := range list {
+			if text := hoverText(item); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
+
+type textEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// workspaceEdit is the result of a rename: edits keyed by file, or a list
+// of document edits and file operations.
+type workspaceEdit struct {
+	Changes         map[string][]textEdit `json:"changes"`
+	DocumentChanges []struct {
+		Kind         string `json:"kind"`
+		OldURI       string `json:"oldUri"`
+		NewURI       string `json:"newUri"`
+		URI          string `json:"uri"`
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Edits []textEdit `json:"edits"`
+	} `json:"documentChanges"`
+}
+
+// renamePreview renders edit as unified diffs without applying it.
+func (c *client) renamePreview(edit workspaceEdit, wd string, src *sourceCache) (string, error) {
+	edits := make(map[string][]textEdit)
+	for uri, e := range edit.Changes {
+		edits[uriPath(uri)] = append(edits[uriPath(uri)], e...)
+	}
+	var fileOps []string
+	for _, dc := range edit.DocumentChanges {
+		switch dc.Kind {
+		case "":
+			path := uriPath(dc.TextDocument.URI)
+			edits[path] = append(edits[path], dc.Edits...)
+		case "rename":
+			fileOps = append(fileOps, fmt.Sprintf("rename %s to %s", displayPath(uriPath(dc.OldURI), wd), displayPath(uriPath(dc.NewURI), wd)))
+		default:
+			fileOps = append(fileOps, fmt.Sprintf("%s %s", dc.Kind, displayPath(uriPath(dc.URI), wd)))
+		}
+	}
+	if len(edits) == 0 && len(fileOps) == 0 {
+		return "The rename changes nothing.", nil
+	}
+	paths := make([]string, 0, len(edits))
+	total := 0
+	for path, e := range edits {
+		paths = append(paths, path)
+		total += len(e)
+	}
+	sort.Strings(paths)
+
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "Rename preview (not applied): %d edits in %d files.\n", total, len(paths))
+	for _, op := range fileOps {
+		fmt.Fprintf(out, "Also: %s\n", op)
+	}
+	for _, path := range paths {
+		old, ok := src.text(path)
+		if !ok {
+			return "", fmt.Errorf("read %s for the rename preview", path)
+		}
+		updated, err := c.applyEdits(old, edits[path])
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		name := displayPath(path, wd)
+		if err := diff.Text(name, name, old, updated, out); err != nil {
+			return "", err
+		}
+	}
+	return out.String(), nil
+}
+
+// applyEdits applies non-overlapping text edits to text.
+func (c *client) applyEdits(text string, edits []textEdit) (string, error) {
+	lineStarts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offset := func(p Position) (int, error) {
+		if p.Line >= len(lineStarts) {
+			if p.Line == len(lineStarts) && p.Character == 0 {
+				return len(text), nil
+			}
+			return 0, fmt.Errorf("edit position %d:%d is past the end of the file", p.Line+1, p.Character)
+		}
+		start := lineStarts[p.Line]
+		end := len(text)
+		if p.Line+1 < len(lineStarts) {
+			end = lineStarts[p.Line+1]
+		}
+		return start + byteOffset(text[start:end], p.Character, c.enc), nil
+	}
+	type span struct {
+		start, end int
+		text       string
+	}
+	spans := make([]span, 0, len(edits))
+	for _, e := range edits {
+		start, err := offset(e.Range.Start)
+		if err != nil {
+			return "", err
+		}
+		end, err := offset(e.Range.End)
+		if err != nil {
+			return "", err
+		}
+		spans = append(spans, span{start, end, e.NewText})
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start > spans[j].start })
+	for _, s := range spans {
+		if s.start > s.end || s.end > len(text) {
+			return "", fmt.Errorf("invalid edit range")
+		}
+		text = text[:s.start] + s.text + text[s.end:]
+	}
+	return text, nil
+}
@@ -0,0 +1,264 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"shelley.exe.dev/version"
+)
+
+// ProtocolVersion is the MCP revision this client speaks. Servers that only
+// know an older revision answer with theirs; the subset we use (initialize,
+// tools/list, tools/call) is unchanged across revisions.
+const ProtocolVersion = "2025-06-18"
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcMessage is anything the server sends: a response to one of our
+// requests, a notification, or a request of its own (ping, roots/list).
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+func (m *rpcMessage) isResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+const rpcMethodNotFound = -32601
+
+// transport moves JSON-RPC messages between the client and one server.
+type transport interface {
+	// call sends req and waits for the matching response.
+	call(ctx context.Context, req *rpcRequest) (*rpcMessage, error)
+	// notify sends a message that has no response.
+	notify(ctx context.Context, req *rpcRequest) error
+	close() error
+}
+
+// Client is a connection to a single, initialized MCP server.
+type Client struct {
+	name   string
+	t      transport
+	nextID atomic.Int64
+	logger *slog.Logger
+
+	// ServerInfo is what the server reported about itself in initialize.
+	ServerInfo ServerInfo
+	// Instructions is the server's optional usage hint from initialize.
+	Instructions string
+}
+
+// ServerInfo identifies an MCP server implementation.
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ToolDef is a tool as advertised by tools/list.
+type ToolDef struct {
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	InputSchema json.RawMessage  `json:"inputSchema,omitempty"`
+	Annotations *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are a tool's behavior hints. Only the one Shelley acts on
+// is decoded.
+type ToolAnnotations struct {
+	// ReadOnlyHint says the tool does not modify its environment.
+	ReadOnlyHint bool `json:"readOnlyHint,omitempty"`
+}
+
+// ContentItem is one element of a tools/call result.
+type ContentItem struct {
+	Type     string           `json:"type"`
+	Text     string           `json:"text,omitempty"`
+	Data     string           `json:"data,omitempty"`
+	MimeType string           `json:"mimeType,omitempty"`
+	URI      string           `json:"uri,omitempty"`
+	Name     string           `json:"name,omitempty"`
+	Resource *EmbeddedContent `json:"resource,omitempty"`
+}
+
+// EmbeddedContent is the payload of a "resource" content item.
+type EmbeddedContent struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// CallResult is the result of tools/call.
+type CallResult struct {
+	Content           []ContentItem   `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// Connect starts (or dials) the server described by cfg and performs the MCP
+// initialize handshake. defaultDir is used as a stdio server's working
+// directory when cfg.Cwd is empty. The returned client must be closed.
+func Connect(ctx context.Context, cfg ServerConfig, defaultDir string, logger *slog.Logger) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With("mcp_server", cfg.Name)
+
+	var t transport
+	var err error
+	if cfg.URL != "" {
+		t, err = newHTTPTransport(cfg, logger)
+	} else {
+		t, err = newStdioTransport(cfg, defaultDir, logger)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{name: cfg.Name, t: t, logger: logger}
+	if err := c.initialize(ctx); err != nil {
+		t.close()
+		return nil, fmt.Errorf("mcp server %q: initialize: %w", cfg.Name, err)
+	}
+	return c, nil
+}
+
+// Name returns the configured server name.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Close shuts down the connection (and the process, for stdio servers).
+func (c *Client) Close() error {
+	return c.t.close()
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	params := map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo": map[string]any{
+			"name":    "shelley",
+			"version": version.GetInfo().Version,
+		},
+	}
+	var result struct {
+		ProtocolVersion string     `json:"protocolVersion"`
+		ServerInfo      ServerInfo `json:"serverInfo"`
+		Instructions    string     `json:"instructions"`
+	}
+	if err := c.request(ctx, "initialize", params, &result); err != nil {
+		return err
+	}
+	c.ServerInfo = result.ServerInfo
+	c.Instructions = result.Instructions
+	return c.t.notify(ctx, &rpcRequest{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+// ListTools returns every tool the server advertises, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]ToolDef, error) {
+	var tools []ToolDef
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []ToolDef `json:"tools"`
+			NextCursor string    `json:"nextCursor"`
+		}
+		if err := c.request(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool invokes a tool. A tool-level failure is reported through
+// CallResult.IsError, not the error return, which is reserved for protocol
+// and transport failures.
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (*CallResult, error) {
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	params := map[string]any{
+		"name":      name,
+		"arguments": args,
+	}
+	var result CallResult
+	if err := c.request(ctx, "tools/call", params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) request(ctx context.Context, method string, params any, result any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	id := c.nextID.Add(1)
+	resp, err := c.t.call(ctx, &rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: raw})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if len(resp.Result) == 0 {
+		return errors.New("empty result")
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+// replyToServerRequest builds our answer to a request initiated by the
+// server. We advertise no client capabilities, so apart from ping every
+// request gets "method not found".
+func replyToServerRequest(msg *rpcMessage) []byte {
+	reply := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+	if msg.Method == "ping" {
+		reply["result"] = map[string]any{}
+	} else {
+		reply["error"] = &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+	b, _ := json.Marshal(reply)
+	return b
+}
@@ -0,0 +1,140 @@
+// Package mcp is a Model Context Protocol client. It launches the MCP servers
+// configured in ~/.config/shelley/mcp.json, lists their tools, and adapts each
+// one to an llm.Tool so conversations can call them like any built-in tool.
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ServerConfig describes a single MCP server.
+//
+// A server is either a local process speaking newline-delimited JSON-RPC on
+// stdin/stdout (Command set), or a remote endpoint speaking the streamable
+// HTTP transport (URL set).
+type ServerConfig struct {
+	// Name identifies the server. It prefixes the names of the server's
+	// tools (mcp__<name>__<tool>), so it should be short and stable.
+	Name string `json:"name,omitempty"`
+
+	// Command and Args launch a stdio server.
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// Cwd is the working directory for a stdio server. Empty means the
+	// conversation's working directory.
+	Cwd string `json:"cwd,omitempty"`
+
+	// URL and Headers select the streamable HTTP transport.
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Disabled servers are kept in the config file but never started.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// StartupTimeout bounds how long initialize + tools/list may take.
+	// Zero means DefaultStartupTimeout. Accepts Go duration syntax ("20s").
+	StartupTimeout Duration `json:"startup_timeout,omitempty"`
+}
+
+// DefaultStartupTimeout is how long a server gets to answer initialize and
+// tools/list before it is skipped for the conversation.
+const DefaultStartupTimeout = 30 * time.Second
+
+// Duration is a time.Duration that unmarshals from a Go duration string.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (c ServerConfig) startupTimeout() time.Duration {
+	if c.StartupTimeout > 0 {
+		return time.Duration(c.StartupTimeout)
+	}
+	return DefaultStartupTimeout
+}
+
+// Validate reports configuration errors for a single server.
+func (c ServerConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("mcp server has no name")
+	}
+	if sanitizeName(c.Name) != c.Name {
+		return fmt.Errorf("mcp server %q: name may only contain letters, digits, '-' and '_'", c.Name)
+	}
+	switch {
+	case c.Command != "" && c.URL != "":
+		return fmt.Errorf("mcp server %q: set either command or url, not both", c.Name)
+	case c.Command == "" && c.URL == "":
+		return fmt.Errorf("mcp server %q: one of command or url is required", c.Name)
+	}
+	return nil
+}
+
+// configFile is the on-disk format. It uses the same "mcpServers" object
+// other MCP clients use, so existing server definitions can be copied over.
+type configFile struct {
+	MCPServers map[string]ServerConfig `json:"mcpServers"`
+}
+
+// DefaultConfigPath returns ~/.config/shelley/mcp.json, or "" if $HOME is
+// unknown.
+func DefaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "shelley", "mcp.json")
+}
+
+// LoadConfig reads MCP server definitions from path. A missing file is not
+// an error and yields no servers. Disabled servers are dropped. The result is
+// sorted by name so tool order is stable across conversations.
+func LoadConfig(path string) ([]ServerConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read mcp config: %w", err)
+	}
+	var f configFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse mcp config %s: %w", path, err)
+	}
+	var servers []ServerConfig
+	for name, sc := range f.MCPServers {
+		if sc.Disabled {
+			continue
+		}
+		sc.Name = name
+		if err := sc.Validate(); err != nil {
+			return nil, err
+		}
+		servers = append(servers, sc)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers, nil
+}
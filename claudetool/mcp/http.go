@@ -0,0 +1,184 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpTransport implements the MCP streamable HTTP transport: every message
+// is POSTed to a single endpoint, and the server answers a request either
+// with a JSON body or with an SSE stream that eventually carries the
+// response.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	logger  *slog.Logger
+
+	mu        sync.Mutex
+	sessionID string
+	closed    bool
+}
+
+func newHTTPTransport(cfg ServerConfig, logger *slog.Logger) (*httpTransport, error) {
+	return &httpTransport{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{},
+		logger:  logger,
+	}, nil
+}
+
+func (t *httpTransport) post(ctx context.Context, body []byte) (*http.Response, error) {
+	t.mu.Lock()
+	closed, sessionID := t.closed, t.sessionID
+	t.mu.Unlock()
+	if closed {
+		return nil, errClosed
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+		req.Header.Set("MCP-Protocol-Version", ProtocolVersion)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, req *rpcRequest) (*rpcMessage, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	wantID := fmt.Sprint(*req.ID)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return t.readStream(ctx, resp.Body, wantID)
+	}
+	var msg rpcMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &msg, nil
+}
+
+// readStream consumes SSE events until the response to wantID arrives.
+// Requests the server makes along the way are answered with their own POST.
+func (t *httpTransport) readStream(ctx context.Context, r io.Reader, wantID string) (*rpcMessage, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxStdioLine)
+	var data strings.Builder
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue // event:, id:, retry: and comments are not needed
+		}
+		payload := data.String()
+		data.Reset()
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			t.logger.Debug("mcp: ignoring undecodable SSE event", "data", payload)
+			continue
+		}
+		switch {
+		case msg.isResponse():
+			if string(msg.ID) == wantID {
+				return &msg, nil
+			}
+		case msg.Method != "" && len(msg.ID) > 0:
+			if resp, err := t.post(ctx, replyToServerRequest(&msg)); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("event stream ended without a response to request %s", wantID)
+}
+
+func (t *httpTransport) notify(ctx context.Context, req *rpcRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := t.post(ctx, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// close ends the session. Servers that don't support explicit termination
+// answer 405, which is fine.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
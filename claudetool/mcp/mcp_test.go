@@ -0,0 +1,318 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shelley.exe.dev/llm"
+)
+
+// When MCP_TEST_SERVER is set, the test binary acts as a stdio MCP server
+// instead of running tests. This keeps the tests free of external
+// dependencies.
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_TEST_SERVER") == "1" {
+		serveStdio(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func serveStdio(r io.Reader, w io.Writer) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for sc.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			continue
+		}
+		if len(msg.ID) == 0 {
+			continue // notification
+		}
+		fmt.Fprintln(os.Stdout, "this line is not JSON and must be ignored")
+		b, _ := json.Marshal(handleTestRequest(&msg))
+		w.Write(append(b, '\n'))
+	}
+}
+
+func testPNG() string {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// handleTestRequest implements a tiny MCP server with three tools:
+// echo (text), picture (image), and fail (isError).
+func handleTestRequest(msg *rpcMessage) map[string]any {
+	reply := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+	switch msg.Method {
+	case "initialize":
+		reply["result"] = map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "test-server", "version": "1.0"},
+		}
+	case "tools/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		if params.Cursor == "" {
+			reply["result"] = map[string]any{
+				"tools": []map[string]any{{
+					"name":        "echo",
+					"description": "Echo the input text.",
+					"inputSchema": map[string]any{
+						"$schema":    "http://json-schema.org/draft-07/schema#",
+						"type":       "object",
+						"properties": map[string]any{"text": map[string]any{"type": "string"}},
+					},
+					"annotations": map[string]any{"readOnlyHint": true},
+				}, {
+					"name":        "picture",
+					"description": "Return a picture.",
+				}},
+				"nextCursor": "page2",
+			}
+		} else {
+			reply["result"] = map[string]any{
+				"tools": []map[string]any{{"name": "fail", "inputSchema": map[string]any{"type": "object"}}},
+			}
+		}
+	case "tools/call":
+		var params struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		switch params.Name {
+		case "echo":
+			reply["result"] = map[string]any{"content": []map[string]any{{"type": "text", "text": "echo: " + params.Arguments.Text}}}
+		case "picture":
+			reply["result"] = map[string]any{"content": []map[string]any{
+				{"type": "text", "text": "here it is"},
+				{"type": "image", "mimeType": "image/png", "data": testPNG()},
+			}}
+		case "fail":
+			reply["result"] = map[string]any{"isError": true, "content": []map[string]any{{"type": "text", "text": "it broke"}}}
+		default:
+			reply["error"] = map[string]any{"code": -32602, "message": "unknown tool " + params.Name}
+		}
+	default:
+		reply["error"] = map[string]any{"code": rpcMethodNotFound, "message": "method not found"}
+	}
+	return reply
+}
+
+func stdioTestServer(t *testing.T, name string) ServerConfig {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ServerConfig{Name: name, Command: exe, Env: map[string]string{"MCP_TEST_SERVER": "1"}}
+}
+
+func findTool(t *testing.T, tools []*llm.Tool, name string) *llm.Tool {
+	t.Helper()
+	for _, tool := range tools {
+		if tool.Name == name {
+			return tool
+		}
+	}
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	t.Fatalf("tool %q not found in %v", name, names)
+	return nil
+}
+
+func checkTools(t *testing.T, tools []*llm.Tool) {
+	t.Helper()
+	ctx := context.Background()
+	if len(tools) != 3 {
+		t.Fatalf("got %d tools, want 3 (pagination should be followed)", len(tools))
+	}
+
+	echo := findTool(t, tools, "mcp__test__echo")
+	if !strings.Contains(echo.Description, "Echo the input text.") {
+		t.Errorf("description = %q", echo.Description)
+	}
+	if !echo.ReadOnly {
+		t.Error("echo is annotated readOnlyHint and should be read-only")
+	}
+	if strings.Contains(string(echo.InputSchema), "$schema") {
+		t.Errorf("$schema should be stripped: %s", echo.InputSchema)
+	}
+	out := echo.Run(ctx, json.RawMessage(`{"text":"hi"}`))
+	if out.Error != nil {
+		t.Fatalf("echo: %v", out.Error)
+	}
+	if len(out.LLMContent) != 1 || out.LLMContent[0].Text != "echo: hi" {
+		t.Errorf("echo output = %+v", out.LLMContent)
+	}
+
+	picture := findTool(t, tools, "mcp__test__picture")
+	var schema map[string]any
+	if err := json.Unmarshal(picture.InputSchema, &schema); err != nil || schema["type"] != "object" || schema["properties"] == nil {
+		t.Errorf("missing schema should become an empty object schema, got %s", picture.InputSchema)
+	}
+	if picture.ReadOnly {
+		t.Error("picture has no annotations and should not be read-only")
+	}
+	out = picture.Run(ctx, nil)
+	if out.Error != nil {
+		t.Fatalf("picture: %v", out.Error)
+	}
+	if len(out.LLMContent) != 2 || out.LLMContent[1].MediaType != "image/png" || out.LLMContent[1].DisplayWidth != 4 {
+		t.Errorf("picture output = %+v", out.LLMContent)
+	}
+
+	fail := findTool(t, tools, "mcp__test__fail")
+	out = fail.Run(ctx, json.RawMessage(`{}`))
+	if out.Error == nil || out.Error.Error() != "it broke" {
+		t.Errorf("fail: got error %v, want %q", out.Error, "it broke")
+	}
+}
+
+func TestStdioServer(t *testing.T) {
+	tools, session := Start(context.Background(), []ServerConfig{stdioTestServer(t, "test")}, t.TempDir(), nil)
+	defer session.Close()
+	checkTools(t, tools)
+}
+
+func TestHTTPServer(t *testing.T) {
+	var deleted bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			deleted = r.Header.Get("Mcp-Session-Id") == "sess-1"
+			return
+		}
+		var msg rpcMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if msg.Method != "initialize" && r.Header.Get("Mcp-Session-Id") != "sess-1" {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Mcp-Session-Id", "sess-1")
+		if len(msg.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		b, _ := json.Marshal(handleTestRequest(&msg))
+		if msg.Method == "tools/call" {
+			// Answer calls over SSE, preceded by a notification.
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/message\"}\n\n")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", b)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	cfg := ServerConfig{Name: "test", URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}
+	tools, session := Start(context.Background(), []ServerConfig{cfg}, "", nil)
+	checkTools(t, tools)
+	session.Close()
+	if !deleted {
+		t.Error("expected session to be terminated with DELETE on close")
+	}
+}
+
+func TestStartSkipsBrokenServers(t *testing.T) {
+	servers := []ServerConfig{
+		{Name: "missing", Command: filepath.Join(t.TempDir(), "does-not-exist")},
+		{Name: "exits", Command: "sh", Args: []string{"-c", "echo boom >&2; exit 1"}},
+		stdioTestServer(t, "test"),
+	}
+	tools, session := Start(context.Background(), servers, t.TempDir(), nil)
+	defer session.Close()
+	checkTools(t, tools)
+}
+
+func TestConnectReportsStderr(t *testing.T) {
+	cfg := ServerConfig{Name: "exits", Command: "sh", Args: []string{"-c", "echo boom >&2; exit 1"}}
+	_, err := Connect(context.Background(), cfg, t.TempDir(), nil)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err = %v, want it to include the server's stderr", err)
+	}
+}
+
+func TestToolName(t *testing.T) {
+	tests := []struct {
+		server, tool, want string
+	}{
+		{"issues", "create_issue", "mcp__issues__create_issue"},
+		{"docs", "search.v2", "mcp__docs__search_v2"},
+		{"db", strings.Repeat("x", 80), "mcp__db__" + strings.Repeat("x", 55)},
+	}
+	for _, tt := range tests {
+		if got := ToolName(tt.server, tt.tool); got != tt.want {
+			t.Errorf("ToolName(%q, %q) = %q, want %q", tt.server, tt.tool, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	if servers, err := LoadConfig(filepath.Join(dir, "missing.json")); err != nil || servers != nil {
+		t.Fatalf("missing file: got %v, %v", servers, err)
+	}
+
+	path := filepath.Join(dir, "mcp.json")
+	os.WriteFile(path, []byte(`{"mcpServers": {
+		"zeta": {"url": "http://localhost:1234/mcp", "startup_timeout": "5s"},
+		"alpha": {"command": "alpha-mcp", "args": ["--stdio"], "env": {"TOKEN": "x"}},
+		"off": {"command": "nope", "disabled": true}
+	}}`), 0o644)
+	servers, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 2 || servers[0].Name != "alpha" || servers[1].Name != "zeta" {
+		t.Fatalf("servers = %+v", servers)
+	}
+	if servers[0].Args[0] != "--stdio" || servers[0].Env["TOKEN"] != "x" {
+		t.Errorf("alpha = %+v", servers[0])
+	}
+	if servers[1].startupTimeout().String() != "5s" {
+		t.Errorf("zeta startup timeout = %v", servers[1].startupTimeout())
+	}
+
+	os.WriteFile(path, []byte(`{"mcpServers": {"both": {"command": "x", "url": "http://x"}}}`), 0o644)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected error for server with both command and url")
+	}
+	os.WriteFile(path, []byte(`{"mcpServers": {"bad name": {"command": "x"}}}`), 0o644)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected error for server name with a space")
+	}
+}
@@ -0,0 +1,262 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxStdioLine bounds a single JSON-RPC message from a stdio server. Tool
+// results carrying screenshots are routinely several megabytes.
+const maxStdioLine = 64 << 20
+
+// stdioTransport runs the server as a child process and exchanges
+// newline-delimited JSON-RPC messages over its stdin and stdout.
+type stdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	logger *slog.Logger
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan *rpcMessage
+	err     error // set once the read loop exits
+	done    chan struct{}
+	exited  chan struct{} // closed once the process has been reaped
+	stderr  *tailBuffer
+
+	closeOnce sync.Once
+}
+
+func newStdioTransport(cfg ServerConfig, defaultDir string, logger *slog.Logger) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Dir = cfg.Cwd
+	if cmd.Dir == "" {
+		cmd.Dir = defaultDir
+	}
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true} // so close can kill the whole group
+	stderr := &tailBuffer{max: 4096}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("mcp server %q: start %s: %w", cfg.Name, cfg.Command, err)
+	}
+	t := &stdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		logger:  logger,
+		pending: make(map[string]chan *rpcMessage),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+		stderr:  stderr,
+	}
+	go func() {
+		cmd.Wait()
+		close(t.exited)
+	}()
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+func (t *stdioTransport) readLoop(stdout io.Reader) {
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 0, 64<<10), maxStdioLine)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			// Some servers log to stdout by mistake. Don't let that kill
+			// the connection.
+			t.logger.Debug("mcp: ignoring non-JSON line from server", "line", string(line))
+			continue
+		}
+		switch {
+		case msg.isResponse():
+			t.mu.Lock()
+			ch := t.pending[string(msg.ID)]
+			delete(t.pending, string(msg.ID))
+			t.mu.Unlock()
+			if ch != nil {
+				ch <- &msg
+			}
+		case msg.Method != "" && len(msg.ID) > 0:
+			t.write(replyToServerRequest(&msg))
+		default:
+			// Notifications (logging, list_changed, progress) are not used.
+		}
+	}
+	err := sc.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	// stderr is only fully copied once the process has been reaped; give a
+	// crashing server a moment so its last words make it into the error.
+	select {
+	case <-t.exited:
+	case <-time.After(time.Second):
+	}
+	t.mu.Lock()
+	t.err = fmt.Errorf("server exited: %w%s", err, t.stderr.suffix())
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *stdioTransport) write(b []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	b = append(b, '\n')
+	_, err := t.stdin.Write(b)
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, req *rpcRequest) (*rpcMessage, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	key := strconv.FormatInt(*req.ID, 10)
+	ch := make(chan *rpcMessage, 1)
+	t.mu.Lock()
+	if t.err != nil {
+		err := t.err
+		t.mu.Unlock()
+		return nil, err
+	}
+	t.pending[key] = ch
+	t.mu.Unlock()
+
+	if err := t.write(b); err != nil {
+		// A failed write usually means the server died; prefer the read
+		// loop's error, which carries its stderr.
+		t.forget(key)
+		select {
+		case <-t.done:
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			return nil, t.err
+		case <-time.After(2 * time.Second):
+			return nil, fmt.Errorf("write to server: %w", err)
+		}
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		t.forget(key)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return nil, t.err
+	case <-ctx.Done():
+		t.forget(key)
+		t.cancelled(req)
+		return nil, ctx.Err()
+	}
+}
+
+// cancelled tells the server we no longer want the result of req.
+func (t *stdioTransport) cancelled(req *rpcRequest) {
+	params, _ := json.Marshal(map[string]any{"requestId": *req.ID, "reason": "cancelled by client"})
+	b, _ := json.Marshal(&rpcRequest{JSONRPC: "2.0", Method: "notifications/cancelled", Params: params})
+	t.write(b)
+}
+
+func (t *stdioTransport) forget(key string) {
+	t.mu.Lock()
+	delete(t.pending, key)
+	t.mu.Unlock()
+}
+
+func (t *stdioTransport) notify(ctx context.Context, req *rpcRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return t.write(b)
+}
+
+// close follows the MCP stdio shutdown sequence: close stdin, give the
+// server a moment to exit, then SIGTERM and finally SIGKILL its process
+// group.
+func (t *stdioTransport) close() error {
+	t.closeOnce.Do(func() {
+		t.stdin.Close()
+		pgid := t.cmd.Process.Pid // Setpgid: true => pgid == pid
+		for _, step := range []struct {
+			sig  syscall.Signal
+			wait time.Duration
+		}{{0, 2 * time.Second}, {syscall.SIGTERM, 2 * time.Second}, {syscall.SIGKILL, 5 * time.Second}} {
+			if step.sig != 0 {
+				syscall.Kill(-pgid, step.sig)
+			}
+			select {
+			case <-t.exited:
+				return
+			case <-time.After(step.wait):
+			}
+		}
+		t.logger.Warn("mcp: server did not exit after SIGKILL")
+	})
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written to it. It captures a stdio
+// server's stderr so startup failures can be reported with some context.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = b.buf[over:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// suffix formats the captured stderr for appending to an error message.
+func (b *tailBuffer) suffix() string {
+	s := strings.TrimSpace(b.String())
+	if s == "" {
+		return ""
+	}
+	return "; stderr: " + s
+}
+
+var errClosed = errors.New("mcp: connection closed")
@@ -0,0 +1,228 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"shelley.exe.dev/llm"
+	"shelley.exe.dev/llm/imageutil"
+)
+
+// ToolPrefix starts the name of every MCP-provided tool.
+const ToolPrefix = "mcp__"
+
+// maxToolNameLen is the tool name limit shared by the providers we talk to.
+const maxToolNameLen = 64
+
+// ToolName returns the llm.Tool name for tool on server:
+// mcp__<server>__<tool>, restricted to the characters providers accept.
+func ToolName(server, tool string) string {
+	name := ToolPrefix + sanitizeName(server) + "__" + sanitizeName(tool)
+	if len(name) > maxToolNameLen {
+		name = name[:maxToolNameLen]
+	}
+	return name
+}
+
+// ServerPrefix returns the common prefix of all tool names from server.
+func ServerPrefix(server string) string {
+	return ToolPrefix + sanitizeName(server) + "__"
+}
+
+func sanitizeName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// Session is the set of live connections backing one conversation's MCP
+// tools.
+type Session struct {
+	clients []*Client
+}
+
+// Close shuts down every server in the session.
+func (s *Session) Close() {
+	var wg sync.WaitGroup
+	for _, c := range s.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+// Start connects to each server concurrently and adapts its tools. Servers
+// that fail to start or list their tools are logged and skipped, so one
+// broken server doesn't take the conversation down with it. Tools are
+// returned in server order, then in the order each server listed them.
+func Start(ctx context.Context, servers []ServerConfig, workingDir string, logger *slog.Logger) ([]*llm.Tool, *Session) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	type started struct {
+		client *Client
+		defs   []ToolDef
+	}
+	results := make([]started, len(servers))
+	var wg sync.WaitGroup
+	for i, cfg := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, cfg.startupTimeout())
+			defer cancel()
+			c, err := Connect(ctx, cfg, workingDir, logger)
+			if err != nil {
+				logger.Warn("mcp: failed to start server", "server", cfg.Name, "error", err)
+				return
+			}
+			defs, err := c.ListTools(ctx)
+			if err != nil {
+				logger.Warn("mcp: failed to list tools", "server", cfg.Name, "error", err)
+				c.Close()
+				return
+			}
+			results[i] = started{client: c, defs: defs}
+		}()
+	}
+	wg.Wait()
+
+	session := &Session{}
+	var tools []*llm.Tool
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if r.client == nil {
+			continue
+		}
+		session.clients = append(session.clients, r.client)
+		for _, def := range r.defs {
+			t := adaptTool(r.client, def)
+			if seen[t.Name] {
+				logger.Warn("mcp: dropping tool with duplicate name", "server", r.client.Name(), "tool", def.Name, "name", t.Name)
+				continue
+			}
+			seen[t.Name] = true
+			tools = append(tools, t)
+		}
+	}
+	return tools, session
+}
+
+func adaptTool(c *Client, def ToolDef) *llm.Tool {
+	desc := def.Description
+	if desc == "" {
+		desc = def.Title
+	}
+	if desc == "" {
+		desc = def.Name
+	}
+	return &llm.Tool{
+		Name:        ToolName(c.Name(), def.Name),
+		Description: fmt.Sprintf("[MCP server %q] %s", c.Name(), desc),
+		InputSchema: normalizeSchema(def.InputSchema),
+		ReadOnly:    def.Annotations != nil && def.Annotations.ReadOnlyHint,
+		Run: func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+			res, err := c.CallTool(ctx, def.Name, input)
+			if err != nil {
+				return llm.ErrorfToolOut("mcp server %q: %s: %w", c.Name(), def.Name, err)
+			}
+			return toolOut(ctx, c.Name(), def.Name, res)
+		},
+	}
+}
+
+// normalizeSchema makes sure an MCP input schema satisfies what providers
+// (and llm.MustSchema) require: a JSON object of type "object" with a
+// "properties" key.
+func normalizeSchema(raw json.RawMessage) json.RawMessage {
+	var obj map[string]any
+	if len(raw) == 0 || json.Unmarshal(raw, &obj) != nil || obj == nil {
+		return llm.EmptySchema()
+	}
+	obj["type"] = "object"
+	if _, ok := obj["properties"]; !ok {
+		obj["properties"] = map[string]any{}
+	}
+	// $schema is informational and some providers reject unknown keywords.
+	delete(obj, "$schema")
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return llm.EmptySchema()
+	}
+	return b
+}
+
+// toolOut maps a tools/call result onto llm.ToolOut.
+func toolOut(ctx context.Context, server, tool string, res *CallResult) llm.ToolOut {
+	var contents []llm.Content
+	for _, item := range res.Content {
+		contents = append(contents, convertContent(ctx, item)...)
+	}
+	if len(contents) == 0 && len(res.StructuredContent) > 0 {
+		contents = llm.TextContent(string(res.StructuredContent))
+	}
+	display := map[string]any{"mcp_server": server, "mcp_tool": tool}
+	if res.IsError {
+		var msgs []string
+		for _, c := range contents {
+			if c.Text != "" && c.MediaType == "" {
+				msgs = append(msgs, c.Text)
+			}
+		}
+		if len(msgs) == 0 {
+			msgs = append(msgs, "tool reported an error without details")
+		}
+		return llm.ToolOut{Error: fmt.Errorf("%s", strings.Join(msgs, "\n")), Display: display}
+	}
+	if len(contents) == 0 {
+		contents = llm.TextContent("(no output)")
+	}
+	return llm.ToolOut{LLMContent: contents, Display: display}
+}
+
+func convertContent(ctx context.Context, item ContentItem) []llm.Content {
+	switch item.Type {
+	case "text":
+		return llm.TextContent(item.Text)
+	case "image":
+		return imageContent(ctx, item.Data, item.MimeType, "image")
+	case "resource":
+		if item.Resource == nil {
+			return nil
+		}
+		r := item.Resource
+		if r.Text != "" {
+			return llm.TextContent(fmt.Sprintf("Resource %s:\n%s", r.URI, r.Text))
+		}
+		if strings.HasPrefix(r.MimeType, "image/") && r.Blob != "" {
+			return imageContent(ctx, r.Blob, r.MimeType, r.URI)
+		}
+		return llm.TextContent(fmt.Sprintf("Resource %s (%s, binary content omitted)", r.URI, r.MimeType))
+	case "resource_link":
+		return llm.TextContent(fmt.Sprintf("Resource link: %s %s", item.Name, item.URI))
+	default:
+		return llm.TextContent(fmt.Sprintf("(%s content omitted)", item.Type))
+	}
+}
+
+// imageContent prepares a base64 image from a server for the model.
+func imageContent(ctx context.Context, data, mimeType, source string) []llm.Content {
+	return imageutil.Content(ctx, mimeType+" "+source, func() ([]byte, error) {
+		return base64.StdEncoding.DecodeString(data)
+	})
+}
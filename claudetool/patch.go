@@ -29,6 +29,16 @@ type PatchCallback func(input PatchInput, output llm.ToolOut) llm.ToolOut
 // PatchTools are not concurrency-safe.
 type PatchTool struct {
 	Callback PatchCallback // may be nil
+	// CheckPermission is called with the absolute path before any file is
+	// modified, if set. It may block until ctx is done.
+	CheckPermission func(ctx context.Context, path string) error
+	// Checkpoint, if set, receives the prior state of each file before it
+	// is written.
+	Checkpoint CheckpointFunc
+	// Diagnostics, if set, is called with the absolute path after a
+	// successful patch. Whatever it returns (e.g. compile errors from a
+	// language server) is included in the result.
+	Diagnostics func(ctx context.Context, path string) string
 	// WorkingDir is the shared mutable working directory.
 	WorkingDir *MutableWorkingDir
 	// Simplified indicates whether to use the simplified input schema.
@@ -351,7 +361,7 @@ func (p *PatchTool) patchParse(m json.RawMessage) (PatchInput, error) {
 // patchRun implements the guts of the patch tool.
 // It populates input from m.
 func (p *PatchTool) patchRun(ctx context.Context, input *PatchInput) llm.ToolOut {
-	path := input.Path
+	path := filepath.Clean(input.Path)
 	if !filepath.IsAbs(input.Path) {
 		// Use shared WorkingDir if available, then context, then Pwd fallback
 		pwd := p.getWorkingDir()
@@ -361,6 +371,11 @@ func (p *PatchTool) patchRun(ctx context.Context, input *PatchInput) llm.ToolOut
 	if len(input.Patches) == 0 {
 		return llm.ErrorToolOut(fmt.Errorf("no patches provided"))
 	}
+	if p.CheckPermission != nil {
+		if err := p.CheckPermission(ctx, input.Path); err != nil {
+			return llm.ErrorToolOut(err)
+		}
+	}
 	// TODO: check whether the file is autogenerated, and if so, require a "force" flag to modify it.
 
 	orig, err := os.ReadFile(input.Path)
@@ -378,6 +393,7 @@ func (p *PatchTool) patchRun(ctx context.Context, input *PatchInput) llm.ToolOut
 	case err != nil:
 		return llm.ErrorfToolOut("failed to read file %q: %w", input.Path, err)
 	}
+	before := FileCheckpoint{Path: input.Path, Existed: err == nil, Content: orig}
 
 	likelyGoFile := strings.HasSuffix(input.Path, ".go")
 
@@ -533,6 +549,14 @@ func (p *PatchTool) patchRun(ctx context.Context, input *PatchInput) llm.ToolOut
 	if err := os.MkdirAll(filepath.Dir(input.Path), 0o700); err != nil {
 		return llm.ErrorfToolOut("failed to create directory %q: %w", filepath.Dir(input.Path), err)
 	}
+	if p.Checkpoint != nil {
+		if before.Existed {
+			if fi, err := os.Stat(input.Path); err == nil {
+				before.Mode = fi.Mode().Perm()
+			}
+		}
+		p.Checkpoint(ctx, PatchName, []FileCheckpoint{before})
+	}
 	if err := os.WriteFile(input.Path, patched, 0o600); err != nil {
 		return llm.ErrorfToolOut("failed to write patched contents to file %q: %w", input.Path, err)
 	}
@@ -547,6 +571,12 @@ func (p *PatchTool) patchRun(ctx context.Context, input *PatchInput) llm.ToolOut
 		fmt.Fprintf(response, "<warning>%q appears to be autogenerated. Patches were applied anyway.</warning>\n", input.Path)
 	}
 
+	if p.Diagnostics != nil {
+		if diags := p.Diagnostics(ctx, input.Path); diags != "" {
+			fmt.Fprintf(response, "<diagnostics>\n%s\n</diagnostics>\n", diags)
+		}
+	}
+
 	diff := generateUnifiedDiff(input.Path, string(orig), string(patched))
 
 	// Display data for the UI includes the unified diff only.
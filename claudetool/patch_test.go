@@ -640,6 +640,41 @@ func TestPatchTool_CallbackFunction(t *testing.T) {
 	}
 }
 
+func TestPatchTool_Diagnostics(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "main.go")
+	var checked []string
+	patch := &PatchTool{
+		WorkingDir: NewMutableWorkingDir(tempDir),
+		Diagnostics: func(ctx context.Context, path string) string {
+			checked = append(checked, path)
+			if len(checked) == 1 {
+				return "main.go:1:1: error: expected 'package', found broken"
+			}
+			return ""
+		},
+	}
+
+	run := func(text string) llm.ToolOut {
+		msg, _ := json.Marshal(PatchInput{Path: "main.go", Patches: []PatchRequest{{Operation: "overwrite", NewText: text}}})
+		return patch.Run(context.Background(), msg)
+	}
+	result := run("broken")
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	if !strings.Contains(result.LLMContent[0].Text, "<diagnostics>\nmain.go:1:1: error: expected 'package', found broken\n</diagnostics>") {
+		t.Errorf("diagnostics missing from result: %q", result.LLMContent[0].Text)
+	}
+	result = run("package main\n")
+	if strings.Contains(result.LLMContent[0].Text, "<diagnostics>") {
+		t.Errorf("clean file should have no diagnostics section: %q", result.LLMContent[0].Text)
+	}
+	if len(checked) != 2 || checked[0] != testFile {
+		t.Errorf("diagnostics checked %v, want the absolute path twice", checked)
+	}
+}
+
 func TestPatchTool_DisplayDataContainsUnifiedDiffOnly(t *testing.T) {
 	tempDir := t.TempDir()
 	patch := &PatchTool{WorkingDir: NewMutableWorkingDir(tempDir)}
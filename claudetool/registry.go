@@ -1,6 +1,13 @@
 package claudetool
 
-import "shelley.exe.dev/llm"
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"shelley.exe.dev/claudetool/scripttool"
+	"shelley.exe.dev/llm"
+)
 
 // ToolInfo describes a tool available to conversations.
 type ToolInfo struct {
@@ -20,13 +27,82 @@ var ToolRegistry = []ToolInfo{
 	{Name: "patch", Summary: "Precise edits to files.", DefaultOn: true},
 	{Name: "keyword_search", Summary: "Search the codebase by keyword.", DefaultOn: true},
 	{Name: "change_dir", Summary: "Change the working directory.", DefaultOn: true},
+	{Name: "lsp", Summary: "Language server queries: definitions, references, hover, symbols, rename preview, diagnostics.", DefaultOn: true},
 	{Name: "output_iframe", Summary: "Show HTML/visualizations to the user.", DefaultOn: true},
 	{Name: "subagent", Summary: "Spawn a subagent conversation.", DefaultOn: true},
+	{Name: "subagent_map", Summary: "Run a subagent per item of a list, several at a time.", DefaultOn: true},
+	{Name: "schedule", Summary: "Schedule conversations to run later or on a recurring basis.", DefaultOn: true},
 	{Name: "llm_one_shot", Summary: "One-shot prompt to another LLM.", DefaultOn: true},
 	{Name: "browser", Summary: "Browser automation (navigate, eval, screenshot, emulate, network, accessibility, profile).", DefaultOn: true},
 	{Name: "read_image", Summary: "Read an image file for the model.", DefaultOn: true},
 }
 
+var (
+	dynamicToolsMu sync.Mutex
+	dynamicTools   = map[string]ToolInfo{}
+	// mcpTools holds the definitions of the MCP tools in dynamicTools,
+	// without their Run functions.
+	mcpTools = map[string]*llm.Tool{}
+)
+
+// RegisterDynamicTools records tools discovered at run time (MCP servers)
+// so they show up in Registry alongside the built-in ones. Re-registering a
+// name replaces its entry.
+func RegisterDynamicTools(tools []*llm.Tool) {
+	dynamicToolsMu.Lock()
+	defer dynamicToolsMu.Unlock()
+	for _, t := range tools {
+		dynamicTools[t.Name] = ToolInfo{Name: t.Name, Summary: toolSummary(t.Description), DefaultOn: true}
+		mcpTools[t.Name] = &llm.Tool{Name: t.Name, Description: t.Description, InputSchema: t.InputSchema}
+	}
+}
+
+// MCPToolDefinitions returns the MCP tools recorded by RegisterDynamicTools,
+// sorted by name. They describe the tools but cannot run them; they are for
+// listing tools without starting the MCP servers.
+func MCPToolDefinitions() []*llm.Tool {
+	dynamicToolsMu.Lock()
+	defer dynamicToolsMu.Unlock()
+	out := make([]*llm.Tool, 0, len(mcpTools))
+	for _, t := range mcpTools {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// registerScriptTools records server-wide script tools in Registry, with
+// the default-on flag from their manifests.
+func registerScriptTools(tools []scripttool.Tool) {
+	dynamicToolsMu.Lock()
+	defer dynamicToolsMu.Unlock()
+	for _, t := range tools {
+		dynamicTools[t.Name] = ToolInfo{Name: t.Name, Summary: toolSummary(t.Description), DefaultOn: t.DefaultOn}
+	}
+}
+
+// Registry returns ToolRegistry followed by every dynamically registered
+// tool, sorted by name.
+func Registry() []ToolInfo {
+	dynamicToolsMu.Lock()
+	defer dynamicToolsMu.Unlock()
+	out := make([]ToolInfo, 0, len(ToolRegistry)+len(dynamicTools))
+	out = append(out, ToolRegistry...)
+	start := len(out)
+	for _, info := range dynamicTools {
+		out = append(out, info)
+	}
+	sort.Slice(out[start:], func(i, j int) bool { return out[start+i].Name < out[start+j].Name })
+	return out
+}
+
+// toolSummary shortens a tool description to its first line, capped for
+// the gear menu.
+func toolSummary(desc string) string {
+	desc, _, _ = strings.Cut(strings.TrimSpace(desc), "\n")
+	return llm.Truncate(desc, 120)
+}
+
 // IsToolEnabled reports whether a tool with the given name is enabled for a
 // conversation given the override map and a global "disable all" flag.
 // overrides maps tool name to "on" or "off"; any other value is ignored.
@@ -45,6 +121,12 @@ func IsToolEnabled(name string, overrides map[string]string, disableAll bool) bo
 			return t.DefaultOn
 		}
 	}
+	dynamicToolsMu.Lock()
+	info, ok := dynamicTools[name]
+	dynamicToolsMu.Unlock()
+	if ok {
+		return info.DefaultOn
+	}
 	// Unknown tool: be permissive (forward-compat for tool registry lag).
 	return true
 }
@@ -3,8 +3,10 @@ package claudetool
 import (
 	"context"
 	"sort"
+	"strings"
 	"testing"
 
+	"shelley.exe.dev/claudetool/mcp"
 	"shelley.exe.dev/llm"
 )
 
@@ -84,3 +86,53 @@ func TestNewToolSetDisableAllTools(t *testing.T) {
 		t.Fatalf("expected only bash, got %v", names)
 	}
 }
+
+func TestRegisterDynamicTools(t *testing.T) {
+	RegisterDynamicTools([]*llm.Tool{
+		{Name: "mcp__zz_test__b", Description: "Second tool.\nMore detail."},
+		{Name: "mcp__zz_test__a", Description: "First tool."},
+	})
+	reg := Registry()
+	if len(reg) < len(ToolRegistry)+2 {
+		t.Fatalf("Registry() has %d entries, want at least %d", len(reg), len(ToolRegistry)+2)
+	}
+	for i, info := range ToolRegistry {
+		if reg[i] != info {
+			t.Fatalf("Registry()[%d] = %+v, want built-in %+v first", i, reg[i], info)
+		}
+	}
+	var got []ToolInfo
+	for _, info := range reg {
+		if strings.HasPrefix(info.Name, "mcp__zz_test__") {
+			got = append(got, info)
+		}
+	}
+	if len(got) != 2 || got[0].Name != "mcp__zz_test__a" || got[1].Summary != "Second tool." || !got[1].DefaultOn {
+		t.Fatalf("dynamic entries = %+v", got)
+	}
+	var defs []string
+	for _, def := range MCPToolDefinitions() {
+		if strings.HasPrefix(def.Name, "mcp__zz_test__") {
+			defs = append(defs, def.Name+": "+def.Description)
+		}
+	}
+	if len(defs) != 2 || defs[0] != "mcp__zz_test__a: First tool." {
+		t.Fatalf("MCPToolDefinitions() = %v", defs)
+	}
+}
+
+func TestMCPServersToStart(t *testing.T) {
+	servers := []mcp.ServerConfig{{Name: "issues"}, {Name: "docs"}}
+	cfg := ToolSetConfig{MCPServers: servers}
+	if got := mcpServersToStart(cfg); len(got) != 2 {
+		t.Fatalf("all servers should start by default, got %+v", got)
+	}
+	cfg.DisableAllTools = true
+	if got := mcpServersToStart(cfg); len(got) != 0 {
+		t.Fatalf("no server should start with all tools disabled, got %+v", got)
+	}
+	cfg.ToolOverrides = map[string]string{"mcp__docs__search": "on", "mcp__issues__create": "off"}
+	if got := mcpServersToStart(cfg); len(got) != 1 || got[0].Name != "docs" {
+		t.Fatalf("only docs should start, got %+v", got)
+	}
+}
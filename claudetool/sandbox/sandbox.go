@@ -0,0 +1,223 @@
+// Package sandbox runs bash, shell and script tool commands in Linux
+// namespaces, in
+// the style of bubblewrap: the filesystem is mounted read-only except for
+// the conversation's working directory and a few chosen paths, the command
+// gets its own PID namespace, and network access can be switched off.
+//
+// The sandbox is set up by re-executing the current binary (see Main) as
+// the namespace's init process, which prepares the mounts and then runs the
+// command as the original user.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Profile configures the sandbox. It is read from
+// ~/.config/shelley/sandbox.json and can be overridden per conversation.
+type Profile struct {
+	// Enabled runs bash and shell commands in the sandbox.
+	Enabled bool `json:"enabled"`
+	// NoNetwork gives commands a private network namespace with only a
+	// loopback interface.
+	NoNetwork bool `json:"no_network,omitempty"`
+	// Writable lists paths that stay writable besides the working
+	// directory and the temporary directory, e.g. "~/.cache". A leading
+	// "~/" is the user's home directory.
+	Writable []string `json:"writable,omitempty"`
+	// Hidden lists paths replaced by empty ones inside the sandbox, e.g.
+	// "~/.ssh".
+	Hidden []string `json:"hidden,omitempty"`
+}
+
+// Validate reports paths that are neither absolute nor home-relative.
+func (p *Profile) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, list := range []struct {
+		name  string
+		paths []string
+	}{{"writable", p.Writable}, {"hidden", p.Hidden}} {
+		for _, path := range list.paths {
+			if !filepath.IsAbs(path) && !strings.HasPrefix(path, "~/") {
+				return fmt.Errorf("sandbox %s path %q must be absolute or start with ~/", list.name, path)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadProfile reads a profile from path. A missing file is not an error and
+// yields a nil profile.
+func LoadProfile(path string) (*Profile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read sandbox profile: %w", err)
+	}
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse sandbox profile %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("sandbox profile %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// DefaultProfilePath returns ~/.config/shelley/sandbox.json, or "" if $HOME
+// is unknown.
+func DefaultProfilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "shelley", "sandbox.json")
+}
+
+// Sandbox is a profile resolved for one conversation: the concrete paths
+// its commands may write and cannot see.
+type Sandbox struct {
+	// Network reports whether commands can reach the network.
+	Network bool `json:"network"`
+	// Writable are the absolute paths commands may write to.
+	Writable []string `json:"writable"`
+	// Hidden are the absolute paths commands see as empty.
+	Hidden []string `json:"hidden,omitempty"`
+
+	// workingDir, if set, returns the conversation's current working
+	// directory, which is writable besides Writable (see Follow).
+	workingDir func() string
+}
+
+// New resolves p for a conversation whose working directory is
+// workingDir. It returns nil if p is nil or not enabled.
+//
+// The working directory is fixed here; use Follow for a sandbox that
+// keeps up with change_dir.
+func New(p *Profile, workingDir string) *Sandbox {
+	if p == nil || !p.Enabled {
+		return nil
+	}
+	s := &Sandbox{Network: !p.NoNetwork}
+	for _, path := range append([]string{workingDir, os.TempDir()}, p.Writable...) {
+		if path = expandHome(path); path != "" && !slices.Contains(s.Writable, path) {
+			s.Writable = append(s.Writable, path)
+		}
+	}
+	for _, path := range p.Hidden {
+		if path = expandHome(path); path != "" {
+			s.Hidden = append(s.Hidden, path)
+		}
+	}
+	return s
+}
+
+// Follow is like New, but reads the working directory from workingDir
+// each time a command starts, so the directory a conversation moves to
+// (by change_dir or into a worktree) is the one that is writable.
+func Follow(p *Profile, workingDir func() string) *Sandbox {
+	s := New(p, "")
+	if s != nil {
+		s.workingDir = workingDir
+	}
+	return s
+}
+
+// current returns s with the working directory it follows, if any,
+// resolved into Writable.
+func (s *Sandbox) current() Sandbox {
+	c := *s
+	c.workingDir = nil
+	if s.workingDir != nil {
+		if dir := expandHome(s.workingDir()); dir != "" && !slices.Contains(c.Writable, dir) {
+			c.Writable = append([]string{dir}, c.Writable...)
+		}
+	}
+	return c
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		path = filepath.Join(home, rest)
+	}
+	if !filepath.IsAbs(path) {
+		return ""
+	}
+	return filepath.Clean(path)
+}
+
+// Summary describes the sandbox for the LLM.
+func (s *Sandbox) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "bash, shell and custom tool commands run in a sandbox. Only %s are writable; the rest of the filesystem is read-only. After change_dir, the new working directory is writable instead of the old one.", strings.Join(s.current().Writable, ", "))
+	if len(s.Hidden) > 0 {
+		fmt.Fprintf(&b, " %s are hidden.", strings.Join(s.Hidden, ", "))
+	}
+	if !s.Network {
+		b.WriteString(" There is no network access.")
+	}
+	b.WriteString(" Each command runs in its own process namespace: it cannot see or signal other processes, including earlier commands, and anything it leaves running in the background (tmux sessions included) stops when it exits.")
+	return b.String()
+}
+
+// violationSignals are output fragments that show a command ran into the
+// sandbox, and what to tell the LLM about them.
+var (
+	writeSignals   = []string{"Read-only file system"}
+	networkSignals = []string{
+		"Network is unreachable",
+		"Temporary failure in name resolution",
+		"Could not resolve host",
+		"No address associated with hostname",
+		"dial tcp: lookup",
+	}
+)
+
+// Violation inspects a command's output for signs that the sandbox
+// stopped it and returns an explanation for the LLM, or "".
+func (s *Sandbox) Violation(output string) string {
+	if s == nil {
+		return ""
+	}
+	for _, sig := range writeSignals {
+		if strings.Contains(output, sig) {
+			return fmt.Sprintf("sandbox violation: the command tried to write outside the sandbox's writable paths (%s)", strings.Join(s.current().Writable, ", "))
+		}
+	}
+	if !s.Network {
+		for _, sig := range networkSignals {
+			if strings.Contains(output, sig) {
+				return "sandbox violation: the command tried to use the network, which the sandbox blocks"
+			}
+		}
+	}
+	return ""
+}
+
+// spec is what the parent passes to the init process.
+type spec struct {
+	Sandbox
+	Dir string `json:"dir"`
+	UID int    `json:"uid"`
+	GID int    `json:"gid"`
+}
+
+// initArg marks an invocation of the current binary as the sandbox's
+// init process.
+const initArg = "__shelley_sandbox_init"
@@ -0,0 +1,296 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Wrap rewrites cmd, which must not have been started, to run inside the
+// sandbox. cmd keeps its arguments, directory, environment and I/O; its
+// process becomes the sandbox's init, which exits when the command does.
+func (s *Sandbox) Wrap(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		return nil // Start reports it
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("sandbox: find own executable: %w", err)
+	}
+	dir := cmd.Dir
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return fmt.Errorf("sandbox: %w", err)
+		}
+	}
+	sp, err := json.Marshal(spec{Sandbox: s.current(), Dir: dir, UID: os.Getuid(), GID: os.Getgid()})
+	if err != nil {
+		return err
+	}
+	cmd.Args = append([]string{self, initArg, string(sp), cmd.Path}, cmd.Args...)
+	cmd.Path = self
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	attr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	if !s.Network {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	return nil
+}
+
+// Main runs the sandbox's init process if the current process was started
+// as one by Wrap, and does nothing otherwise. Programs whose commands are
+// sandboxed must call it first thing in main (and tests in TestMain).
+func Main() {
+	if len(os.Args) < 4 || os.Args[1] != initArg {
+		return
+	}
+	os.Exit(runInit(os.Args[2], os.Args[3], os.Args[4:]))
+}
+
+// runInit sets up the sandbox described by specJSON and runs path with
+// argv in it, returning the exit status to use.
+func runInit(specJSON, path string, argv []string) int {
+	var sp spec
+	if err := json.Unmarshal([]byte(specJSON), &sp); err != nil {
+		fmt.Fprintf(os.Stderr, "shelley sandbox: bad spec: %v\n", err)
+		return 125
+	}
+	if err := setupMounts(sp); err != nil {
+		fmt.Fprintf(os.Stderr, "shelley sandbox: %v\n", err)
+		return 125
+	}
+	if !sp.Network {
+		if err := loopbackUp(); err != nil {
+			fmt.Fprintf(os.Stderr, "shelley sandbox: bring up loopback: %v\n", err)
+			return 125
+		}
+	}
+
+	// The command runs in a nested user namespace that maps the original
+	// user back, so files it creates are owned by them and it has no
+	// privileges over the sandbox's mounts.
+	cmd := &exec.Cmd{
+		Path:   path,
+		Args:   argv,
+		Dir:    sp.Dir,
+		Env:    os.Environ(),
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		SysProcAttr: &syscall.SysProcAttr{
+			Cloneflags:  syscall.CLONE_NEWUSER,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: sp.UID, HostID: 0, Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: sp.GID, HostID: 0, Size: 1}},
+		},
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "shelley sandbox: %v\n", err)
+		return 127
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	go func() {
+		for sig := range sigs {
+			cmd.Process.Signal(sig)
+		}
+	}()
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return 127
+	}
+	return 0
+}
+
+// setupMounts builds the sandbox's view of the filesystem, bubblewrap
+// style: a tmpfs becomes a scratch root, the real root is bind-mounted
+// into it and made read-only, the writable paths are bound back on top,
+// and finally the bound tree becomes the root.
+func setupMounts(sp spec) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	const scratch = "/tmp"
+	if err := unix.Mount("tmpfs", scratch, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("mount scratch tmpfs: %w", err)
+	}
+	for _, d := range []string{"newroot", "oldroot"} {
+		if err := os.Mkdir(filepath.Join(scratch, d), 0o755); err != nil {
+			return err
+		}
+	}
+	if err := unix.PivotRoot(scratch, filepath.Join(scratch, "oldroot")); err != nil {
+		return fmt.Errorf("pivot to scratch root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Mount("/oldroot", "/newroot", "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind root: %w", err)
+	}
+	if err := remountReadOnly("/newroot"); err != nil {
+		return err
+	}
+	for _, w := range sp.Writable {
+		if _, err := os.Stat(filepath.Join("/oldroot", w)); err != nil {
+			continue // nothing to bind; creating it would need a writable parent
+		}
+		if err := unix.Mount(filepath.Join("/oldroot", w), filepath.Join("/newroot", w), "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind writable %s: %w", w, err)
+		}
+	}
+	if err := unix.Mount("proc", "/newroot/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %w", err)
+	}
+	if fi, err := os.Stat("/newroot/dev/shm"); err == nil && fi.IsDir() {
+		if err := unix.Mount("tmpfs", "/newroot/dev/shm", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("mount /dev/shm: %w", err)
+		}
+	}
+	for _, h := range sp.Hidden {
+		if err := hide(filepath.Join("/newroot", h)); err != nil {
+			return fmt.Errorf("hide %s: %w", h, err)
+		}
+	}
+	// pivot_root(".", ".") stacks the scratch root on top of the new one;
+	// detaching it leaves the new root, with the old one unreachable.
+	if err := os.Chdir("/newroot"); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot to sandbox root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach scratch root: %w", err)
+	}
+	return os.Chdir("/")
+}
+
+// remountReadOnly makes every mount at or below root read-only, except
+// those under root/dev (device nodes must stay writable). Flags the kernel
+// locks in a user namespace (nosuid, nodev, noexec, atime) are preserved.
+func remountReadOnly(root string) error {
+	f, err := os.Open("/oldroot/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// 36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		target := unescapeMountPath(fields[4])
+		if target != root && !strings.HasPrefix(target, root+"/") {
+			continue
+		}
+		if target == root+"/dev" || strings.HasPrefix(target, root+"/dev/") {
+			continue
+		}
+		flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+		for _, opt := range strings.Split(fields[5], ",") {
+			flags |= mountOptionFlags[opt]
+		}
+		if err := unix.Mount("", target, "", flags, ""); err != nil {
+			if errors.Is(err, unix.ENOENT) {
+				continue // a mount point that has gone away
+			}
+			return fmt.Errorf("make %s read-only: %w", strings.TrimPrefix(target, root), err)
+		}
+	}
+	return sc.Err()
+}
+
+var mountOptionFlags = map[string]uintptr{
+	"nosuid":      unix.MS_NOSUID,
+	"nodev":       unix.MS_NODEV,
+	"noexec":      unix.MS_NOEXEC,
+	"noatime":     unix.MS_NOATIME,
+	"nodiratime":  unix.MS_NODIRATIME,
+	"relatime":    unix.MS_RELATIME,
+	"strictatime": unix.MS_STRICTATIME,
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space, etc.) in a
+// mountinfo path.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// hide covers path with an empty read-only directory or file.
+func hide(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if fi.IsDir() {
+		return unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, "mode=0755")
+	}
+	if err := unix.Mount("/oldroot/dev/null", path, "", unix.MS_BIND, ""); err != nil {
+		return err
+	}
+	return unix.Mount("", path, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, "")
+}
+
+// loopbackUp brings up lo in a fresh network namespace, so servers and
+// tests that talk to localhost still work without network access.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
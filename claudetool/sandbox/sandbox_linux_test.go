@@ -0,0 +1,142 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	Main()
+	os.Exit(m.Run())
+}
+
+// run runs a bash script in s with dir as its working directory.
+func run(t *testing.T, s *Sandbox, dir, script string) (string, error) {
+	t.Helper()
+	cmd := exec.Command("bash", "-c", script)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := s.Wrap(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot create namespaces here: %v", err)
+	}
+	err := cmd.Wait()
+	if strings.Contains(out.String(), "shelley sandbox:") {
+		t.Fatalf("sandbox setup failed: %s", out.String())
+	}
+	return out.String(), err
+}
+
+func TestSandboxFilesystem(t *testing.T) {
+	work := t.TempDir()
+	outside := t.TempDir()
+	extra := t.TempDir()
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.MkdirAll(secret, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(secret, "key"), []byte("hunter2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// TempDir is under os.TempDir, which is writable by default; use a
+	// profile without it to check that everything else is read-only.
+	s := &Sandbox{Network: true, Writable: []string{work, extra}, Hidden: []string{secret}}
+
+	out, err := run(t, s, work, "echo hi > here && echo hi > "+extra+"/there && cat here && id -u")
+	if err != nil {
+		t.Fatalf("writing the working directory failed: %v\n%s", err, out)
+	}
+	if want := "hi\n" + strconv.Itoa(os.Getuid()) + "\n"; out != want {
+		t.Errorf("output = %q, want %q (the command should run as the calling user)", out, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(extra, "there")); err != nil || string(data) != "hi\n" {
+		t.Errorf("write to the extra writable path did not land: %q, %v", data, err)
+	}
+
+	out, err = run(t, s, work, "echo nope > "+outside+"/file")
+	if err == nil || !strings.Contains(out, "Read-only file system") {
+		t.Errorf("write outside the writable paths: err=%v out=%q", err, out)
+	}
+	if v := s.Violation(out); !strings.Contains(v, "sandbox violation") || !strings.Contains(v, work) {
+		t.Errorf("Violation = %q", v)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "file")); err == nil {
+		t.Error("file was created outside the sandbox")
+	}
+
+	out, _ = run(t, s, work, "ls -A "+secret+"; cat "+filepath.Join(secret, "key")+" 2>&1")
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("hidden path was visible: %q", out)
+	}
+
+	out, err = run(t, s, work, "echo $$; ls /proc | grep -c '^[0-9]'")
+	if err != nil {
+		t.Fatal(err, out)
+	}
+	if fields := strings.Fields(out); len(fields) != 2 || fields[1] == "0" || len(fields[1]) > 1 {
+		t.Errorf("the command should see only the sandbox's processes: %q", out)
+	}
+}
+
+func TestSandboxFollowsWorkingDir(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	cwd := first
+	// Not built with Follow, which would add os.TempDir (and so both
+	// directories) to Writable.
+	s := &Sandbox{Network: true, workingDir: func() string { return cwd }}
+
+	if out, err := run(t, s, cwd, "touch here"); err != nil {
+		t.Fatalf("writing the first working directory failed: %v\n%s", err, out)
+	}
+	cwd = second
+	if out, err := run(t, s, cwd, "touch here"); err != nil {
+		t.Fatalf("writing the new working directory failed: %v\n%s", err, out)
+	}
+	out, err := run(t, s, cwd, "touch "+first+"/again")
+	if err == nil || !strings.Contains(out, "Read-only file system") {
+		t.Errorf("the old working directory stayed writable: err=%v out=%q", err, out)
+	}
+	if v := s.Violation(out); !strings.Contains(v, second) || strings.Contains(v, first) {
+		t.Errorf("Violation = %q", v)
+	}
+}
+
+func TestSandboxNetwork(t *testing.T) {
+	work := t.TempDir()
+	s := &Sandbox{Network: false, Writable: []string{work}}
+	out, err := run(t, s, work, "ls /sys/class/net")
+	if err != nil {
+		t.Fatal(err, out)
+	}
+	if fields := strings.Fields(out); len(fields) == 0 || fields[len(fields)-1] != "lo" {
+		t.Errorf("only loopback should be visible: %q", out)
+	}
+	if v := s.Violation("curl: (6) Could not resolve host: example.com"); !strings.Contains(v, "network") {
+		t.Errorf("Violation = %q", v)
+	}
+	if v := (&Sandbox{Network: true}).Violation("Could not resolve host: example.com"); v != "" {
+		t.Errorf("network errors are not violations when the network is allowed: %q", v)
+	}
+}
+
+func TestSandboxExitStatus(t *testing.T) {
+	work := t.TempDir()
+	s := &Sandbox{Network: true, Writable: []string{work}}
+	_, err := run(t, s, work, "exit 7")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 7 {
+		t.Errorf("err = %v, want exit status 7", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Wrap always fails: the sandbox needs Linux namespaces.
+func (s *Sandbox) Wrap(cmd *exec.Cmd) error {
+	return errors.New("sandbox: sandboxed commands are only supported on Linux")
+}
+
+// Main does nothing; there is no sandbox init process outside Linux.
+func Main() {}
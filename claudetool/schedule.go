@@ -0,0 +1,248 @@
+package claudetool
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+// Scheduler stores scheduled conversations. The server implements it; a
+// schedule fires by starting a new conversation with its prompt.
+type Scheduler interface {
+	CreateSchedule(ctx context.Context, spec ScheduleSpec) (*ScheduleInfo, error)
+	ListSchedules(ctx context.Context) ([]ScheduleInfo, error)
+	// SetScheduleEnabled pauses or resumes a schedule.
+	SetScheduleEnabled(ctx context.Context, scheduleID string, enabled bool) (*ScheduleInfo, error)
+	DeleteSchedule(ctx context.Context, scheduleID string) error
+}
+
+// ScheduleSpec describes a schedule to create. Exactly one of Cron and
+// RunAt is set.
+type ScheduleSpec struct {
+	Name string
+	// Cron is a five-field cron expression, or a shorthand like @daily.
+	Cron string
+	// RunAt is when a one-shot schedule fires.
+	RunAt time.Time
+	// Timezone is the IANA zone Cron is evaluated in; "" is the server's.
+	Timezone string
+	Prompt   string
+	// Model and Cwd are for the conversations the schedule starts; ""
+	// means the server default.
+	Model string
+	Cwd   string
+	// CatchUp is what to do about firings missed while the server was
+	// down: "skip", "once" or "all". "" means "once".
+	CatchUp              string
+	ToolOverrides        map[string]string
+	DisableNotifications bool
+	// OriginConversationID is the conversation that created the schedule.
+	OriginConversationID string
+}
+
+// ScheduleInfo describes an existing schedule.
+type ScheduleInfo struct {
+	ID        string     `json:"schedule_id"`
+	Name      string     `json:"name"`
+	Cron      string     `json:"cron,omitempty"`
+	RunAt     *time.Time `json:"run_at,omitempty"`
+	Timezone  string     `json:"timezone,omitempty"`
+	Prompt    string     `json:"prompt"`
+	Model     string     `json:"model,omitempty"`
+	Cwd       string     `json:"cwd,omitempty"`
+	CatchUp   string     `json:"catch_up"`
+	Enabled   bool       `json:"enabled"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+}
+
+// ScheduleTool lets the agent schedule conversations to run later or on a
+// recurring basis.
+type ScheduleTool struct {
+	Scheduler Scheduler
+	// ConversationID is recorded as the origin of new schedules.
+	ConversationID string
+	WorkingDir     *MutableWorkingDir
+	// ModelID is the default model for scheduled conversations.
+	ModelID string
+}
+
+const (
+	scheduleName        = "schedule"
+	scheduleDescription = `Schedule conversations to run later, once or on a recurring basis.
+
+Each time a schedule fires, a new conversation starts with its prompt, in
+the working directory the schedule was created in. That conversation has
+none of this conversation's context, so write a self-contained prompt that
+says what to do and why. It is told which schedule started it and which
+conversation created the schedule.
+
+Actions:
+- create: needs name, prompt and either cron (five fields: minute hour
+  day-of-month month day-of-week, or @hourly, @daily, @weekly, @monthly)
+  or at (an RFC 3339 time) for a one-shot.
+- list: shows every schedule with its next run.
+- pause / resume / delete: need schedule_id.
+
+catch_up says what happens to firings missed while the server was down:
+"skip" drops them, "once" (the default) runs the latest, "all" runs each.
+`
+	scheduleInputSchema = `{
+  "type": "object",
+  "required": ["action"],
+  "properties": {
+    "action": {
+      "type": "string",
+      "enum": ["create", "list", "pause", "resume", "delete"]
+    },
+    "schedule_id": {
+      "type": "string",
+      "description": "The schedule to pause, resume or delete"
+    },
+    "name": {
+      "type": "string",
+      "description": "A short name for the schedule"
+    },
+    "prompt": {
+      "type": "string",
+      "description": "The first message of each conversation the schedule starts"
+    },
+    "cron": {
+      "type": "string",
+      "description": "Cron expression for a recurring schedule, e.g. '0 9 * * mon-fri'"
+    },
+    "at": {
+      "type": "string",
+      "description": "RFC 3339 time for a one-shot schedule, e.g. '2026-05-01T09:00:00-07:00'"
+    },
+    "timezone": {
+      "type": "string",
+      "description": "IANA time zone the cron expression is evaluated in, e.g. 'Europe/Berlin'. Defaults to the server's."
+    },
+    "model": {
+      "type": "string",
+      "description": "Model for the scheduled conversations. Defaults to this conversation's model."
+    },
+    "catch_up": {
+      "type": "string",
+      "enum": ["skip", "once", "all"]
+    },
+    "notify": {
+      "type": "boolean",
+      "description": "Send notifications when scheduled conversations finish. Defaults to true."
+    },
+    "tool_overrides": {
+      "type": "object",
+      "description": "Tools to turn \"on\" or \"off\" in the scheduled conversations, by name",
+      "additionalProperties": {"type": "string", "enum": ["on", "off"]}
+    }
+  }
+}`
+)
+
+type scheduleInput struct {
+	Action        string            `json:"action"`
+	ScheduleID    string            `json:"schedule_id"`
+	Name          string            `json:"name"`
+	Prompt        string            `json:"prompt"`
+	Cron          string            `json:"cron"`
+	At            string            `json:"at"`
+	Timezone      string            `json:"timezone"`
+	Model         string            `json:"model"`
+	CatchUp       string            `json:"catch_up"`
+	Notify        *bool             `json:"notify"`
+	ToolOverrides map[string]string `json:"tool_overrides"`
+}
+
+// Tool returns an llm.Tool for managing schedules.
+func (s *ScheduleTool) Tool() *llm.Tool {
+	return &llm.Tool{
+		Name:        scheduleName,
+		Description: scheduleDescription,
+		InputSchema: llm.MustSchema(scheduleInputSchema),
+		Run:         llm.RunJSON(s.run),
+	}
+}
+
+func (s *ScheduleTool) run(ctx context.Context, req scheduleInput) llm.ToolOut {
+	switch req.Action {
+	case "create":
+		return s.create(ctx, req)
+	case "list":
+		scheds, err := s.Scheduler.ListSchedules(ctx)
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		if len(scheds) == 0 {
+			return llm.ToolOut{LLMContent: llm.TextContent("No schedules.")}
+		}
+		return scheduleOut(scheds)
+	case "pause", "resume":
+		if req.ScheduleID == "" {
+			return llm.ErrorfToolOut("schedule_id is required")
+		}
+		info, err := s.Scheduler.SetScheduleEnabled(ctx, req.ScheduleID, req.Action == "resume")
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		return scheduleOut(info)
+	case "delete":
+		if req.ScheduleID == "" {
+			return llm.ErrorfToolOut("schedule_id is required")
+		}
+		if err := s.Scheduler.DeleteSchedule(ctx, req.ScheduleID); err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		return llm.ToolOut{LLMContent: llm.TextContent("Deleted schedule " + req.ScheduleID + ".")}
+	}
+	return llm.ErrorfToolOut("unknown action %q", req.Action)
+}
+
+func (s *ScheduleTool) create(ctx context.Context, req scheduleInput) llm.ToolOut {
+	if strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.Prompt) == "" {
+		return llm.ErrorfToolOut("name and prompt are required")
+	}
+	if (req.Cron == "") == (req.At == "") {
+		return llm.ErrorfToolOut("exactly one of cron and at is required")
+	}
+	spec := ScheduleSpec{
+		Name:                 req.Name,
+		Cron:                 req.Cron,
+		Timezone:             req.Timezone,
+		Prompt:               req.Prompt,
+		Model:                req.Model,
+		CatchUp:              req.CatchUp,
+		ToolOverrides:        req.ToolOverrides,
+		DisableNotifications: req.Notify != nil && !*req.Notify,
+		OriginConversationID: s.ConversationID,
+	}
+	if spec.Model == "" {
+		spec.Model = s.ModelID
+	}
+	if s.WorkingDir != nil {
+		spec.Cwd = s.WorkingDir.Get()
+	}
+	if req.At != "" {
+		at, err := time.Parse(time.RFC3339, req.At)
+		if err != nil {
+			return llm.ErrorfToolOut("at must be an RFC 3339 time: %w", err)
+		}
+		spec.RunAt = at
+	}
+	info, err := s.Scheduler.CreateSchedule(ctx, spec)
+	if err != nil {
+		return llm.ErrorToolOut(err)
+	}
+	return scheduleOut(info)
+}
+
+func scheduleOut(v any) llm.ToolOut {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return llm.ErrorfToolOut("encode schedules: %w", err)
+	}
+	return llm.ToolOut{LLMContent: llm.TextContent(string(out))}
+}
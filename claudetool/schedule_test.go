@@ -0,0 +1,88 @@
+package claudetool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeScheduler struct {
+	specs   []ScheduleSpec
+	enabled map[string]bool
+}
+
+func (f *fakeScheduler) CreateSchedule(ctx context.Context, spec ScheduleSpec) (*ScheduleInfo, error) {
+	f.specs = append(f.specs, spec)
+	return &ScheduleInfo{ID: "sched-1", Name: spec.Name, Cron: spec.Cron, Enabled: true}, nil
+}
+
+func (f *fakeScheduler) ListSchedules(ctx context.Context) ([]ScheduleInfo, error) {
+	return nil, nil
+}
+
+func (f *fakeScheduler) SetScheduleEnabled(ctx context.Context, scheduleID string, enabled bool) (*ScheduleInfo, error) {
+	f.enabled[scheduleID] = enabled
+	return &ScheduleInfo{ID: scheduleID, Enabled: enabled}, nil
+}
+
+func (f *fakeScheduler) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	return errors.New("no schedule " + scheduleID)
+}
+
+func TestScheduleTool(t *testing.T) {
+	sched := &fakeScheduler{enabled: map[string]bool{}}
+	tool := (&ScheduleTool{
+		Scheduler:      sched,
+		ConversationID: "conv-1",
+		WorkingDir:     NewMutableWorkingDir("/work"),
+		ModelID:        "model-1",
+	}).Tool()
+	run := func(input string) (string, error) {
+		out := tool.Run(context.Background(), json.RawMessage(input))
+		if out.Error != nil {
+			return "", out.Error
+		}
+		return out.LLMContent[0].Text, nil
+	}
+
+	for _, input := range []string{
+		`{"action":"create","name":"n","prompt":"p"}`,
+		`{"action":"create","name":"n","prompt":"p","cron":"@daily","at":"2030-01-01T00:00:00Z"}`,
+		`{"action":"create","name":"n","prompt":"p","at":"tomorrow"}`,
+		`{"action":"pause"}`,
+		`{"action":"delete","schedule_id":"sched-9"}`,
+		`{"action":"frobnicate"}`,
+	} {
+		if _, err := run(input); err == nil {
+			t.Errorf("%s succeeded", input)
+		}
+	}
+
+	if _, err := run(`{"action":"create","name":"n","prompt":"p","cron":"@daily","notify":false,"tool_overrides":{"bash":"off"}}`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := run(`{"action":"create","name":"n","prompt":"p","at":"2030-01-01T09:00:00+02:00","model":"model-2"}`); err != nil {
+		t.Fatalf("create one-shot: %v", err)
+	}
+	if len(sched.specs) != 2 {
+		t.Fatalf("specs = %+v", sched.specs)
+	}
+	recurring, oneShot := sched.specs[0], sched.specs[1]
+	if recurring.OriginConversationID != "conv-1" || recurring.Cwd != "/work" || recurring.Model != "model-1" ||
+		!recurring.DisableNotifications || recurring.ToolOverrides["bash"] != "off" {
+		t.Errorf("recurring spec = %+v", recurring)
+	}
+	if !oneShot.RunAt.Equal(time.Date(2030, 1, 1, 7, 0, 0, 0, time.UTC)) || oneShot.Model != "model-2" || oneShot.DisableNotifications {
+		t.Errorf("one-shot spec = %+v", oneShot)
+	}
+
+	if out, err := run(`{"action":"pause","schedule_id":"sched-1"}`); err != nil || !strings.Contains(out, `"enabled": false`) || sched.enabled["sched-1"] {
+		t.Errorf("pause = %q, %v", out, err)
+	}
+	if out, err := run(`{"action":"list"}`); err != nil || out != "No schedules." {
+		t.Errorf("list = %q, %v", out, err)
+	}
+}
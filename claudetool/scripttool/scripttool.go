@@ -0,0 +1,420 @@
+// Package scripttool loads tools defined by a manifest file and an
+// executable, so teams can give Shelley their own tools without forking it.
+//
+// A tools directory holds one manifest per tool, named <tool>.json,
+// <tool>.yaml or <tool>.yml:
+//
+//	name: deploy_preview
+//	description: Deploy the current branch to a preview environment.
+//	input_schema:
+//	  type: object
+//	  properties:
+//	    service: {type: string}
+//	  required: [service]
+//	command: ./deploy-preview.sh   # default: ./<manifest name without extension>
+//	timeout: 5m                    # default: 2m
+//	default_on: true               # default: true
+//	read_only: false               # default: false
+//
+// The executable runs in the conversation's working directory with the
+// tool's JSON input on stdin. Its stdout is the tool result: plain text, or
+// a JSON object {"text": ..., "images": [...], "error": ...} (see Output).
+// A non-zero exit fails the call with its stderr.
+package scripttool
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"shelley.exe.dev/llm"
+	"shelley.exe.dev/llm/imageutil"
+)
+
+const (
+	// DefaultTimeout bounds a call when the manifest sets no timeout.
+	DefaultTimeout = 2 * time.Minute
+	// maxOutputBytes bounds the stdout kept from one call.
+	maxOutputBytes = 1 << 20
+	// maxTextLen bounds the text handed to the model from one call.
+	maxTextLen = 64 * 1024
+	// maxNameLen is the tool name limit shared by the providers we talk to.
+	maxNameLen = 64
+)
+
+// Tool is a tool loaded from a manifest.
+type Tool struct {
+	Name        string
+	Description string
+	InputSchema json.RawMessage
+	// Command is the absolute path of the executable.
+	Command string
+	Timeout time.Duration
+	// DefaultOn reports whether conversations get the tool without a
+	// tool_overrides entry turning it on.
+	DefaultOn bool
+	// ReadOnly declares that the tool changes nothing, so calls to it may
+	// run concurrently with other read-only calls.
+	ReadOnly bool
+	// Manifest is the path of the manifest the tool was loaded from.
+	Manifest string
+}
+
+// manifest is the on-disk format, shared by JSON and YAML manifests.
+type manifest struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	InputSchema any    `json:"input_schema" yaml:"input_schema"`
+	Command     string `json:"command" yaml:"command"`
+	Timeout     string `json:"timeout" yaml:"timeout"`
+	DefaultOn   *bool  `json:"default_on" yaml:"default_on"`
+	ReadOnly    bool   `json:"read_only" yaml:"read_only"`
+}
+
+// DefaultDir returns ~/.config/shelley/tools, or "" if $HOME is unknown.
+func DefaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "shelley", "tools")
+}
+
+// ProjectDirs returns the .shelley/tools directories in workingDir and its
+// parents, up to and including the root of the enclosing git repository
+// (or the filesystem root outside one), nearest first.
+func ProjectDirs(workingDir string) []string {
+	var dirs []string
+	for dir := workingDir; dir != ""; {
+		candidate := filepath.Join(dir, ".shelley", "tools")
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			dirs = append(dirs, candidate)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return dirs
+}
+
+// Load reads the manifests in dirs. Invalid manifests are logged and
+// skipped, so one broken tool doesn't hide the rest. When several
+// manifests define the same name, the one in the earliest dir wins. Tools
+// are sorted by name within each dir.
+func Load(dirs []string, logger *slog.Logger) []Tool {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	var tools []Tool
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				logger.Warn("script tools: cannot read directory", "dir", dir, "error", err)
+			}
+			continue
+		}
+		var loaded []Tool
+		for _, e := range entries {
+			switch filepath.Ext(e.Name()) {
+			case ".json", ".yaml", ".yml":
+			default:
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			t, err := LoadManifest(path)
+			if err != nil {
+				logger.Warn("script tools: skipping invalid manifest", "path", path, "error", err)
+				continue
+			}
+			loaded = append(loaded, t)
+		}
+		sort.Slice(loaded, func(i, j int) bool { return loaded[i].Name < loaded[j].Name })
+		for _, t := range loaded {
+			if seen[t.Name] {
+				logger.Debug("script tools: tool shadowed by an earlier directory", "name", t.Name, "path", t.Manifest)
+				continue
+			}
+			seen[t.Name] = true
+			tools = append(tools, t)
+		}
+	}
+	return tools
+}
+
+// LoadManifest reads and validates one manifest.
+func LoadManifest(path string) (Tool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Tool{}, err
+	}
+	var m manifest
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, &m)
+	} else {
+		err = yaml.Unmarshal(data, &m)
+	}
+	if err != nil {
+		return Tool{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	if err := validateName(m.Name); err != nil {
+		return Tool{}, err
+	}
+	if strings.TrimSpace(m.Description) == "" {
+		return Tool{}, fmt.Errorf("tool %q: description is required", m.Name)
+	}
+	schema, err := inputSchema(m.InputSchema)
+	if err != nil {
+		return Tool{}, fmt.Errorf("tool %q: %w", m.Name, err)
+	}
+
+	command := m.Command
+	if command == "" {
+		command = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if !filepath.IsAbs(command) {
+		command = filepath.Join(filepath.Dir(path), command)
+	}
+	info, err := os.Stat(command)
+	if err != nil {
+		return Tool{}, fmt.Errorf("tool %q: %w", m.Name, err)
+	}
+	if info.IsDir() || info.Mode()&0o111 == 0 {
+		return Tool{}, fmt.Errorf("tool %q: %s is not executable", m.Name, command)
+	}
+
+	timeout := DefaultTimeout
+	if m.Timeout != "" {
+		timeout, err = time.ParseDuration(m.Timeout)
+		if err != nil || timeout <= 0 {
+			return Tool{}, fmt.Errorf("tool %q: invalid timeout %q", m.Name, m.Timeout)
+		}
+	}
+
+	return Tool{
+		Name:        m.Name,
+		Description: m.Description,
+		InputSchema: schema,
+		Command:     command,
+		Timeout:     timeout,
+		DefaultOn:   m.DefaultOn == nil || *m.DefaultOn,
+		ReadOnly:    m.ReadOnly,
+		Manifest:    path,
+	}, nil
+}
+
+func validateName(name string) error {
+	if name == "" || len(name) > maxNameLen {
+		return fmt.Errorf("tool name %q must be 1-%d characters", name, maxNameLen)
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return fmt.Errorf("tool name %q may only contain letters, digits, '-' and '_'", name)
+		}
+	}
+	return nil
+}
+
+// inputSchema converts the manifest's input_schema into what providers
+// require: a JSON object of type "object" with a "properties" key. A
+// missing schema means the tool takes no input.
+func inputSchema(v any) (json.RawMessage, error) {
+	if v == nil {
+		return llm.EmptySchema(), nil
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("input_schema must be an object")
+	}
+	if t, ok := obj["type"]; ok && t != "object" {
+		return nil, fmt.Errorf("input_schema type must be \"object\", not %v", t)
+	}
+	obj["type"] = "object"
+	if _, ok := obj["properties"]; !ok {
+		obj["properties"] = map[string]any{}
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("input_schema: %w", err)
+	}
+	return b, nil
+}
+
+// Options configure how a tool's executable runs.
+type Options struct {
+	// WorkingDir returns the directory to run in, normally the
+	// conversation's current working directory.
+	WorkingDir func() string
+	// Environ returns the environment for a command run in cwd. Nil means
+	// Shelley's own environment.
+	Environ func(cwd string) []string
+	// CheckPermission, if set, is consulted before each call with its
+	// input; an error refuses the call.
+	CheckPermission func(ctx context.Context, input json.RawMessage) error
+	// Wrap, if set, rewrites the command before it starts, e.g. to run it
+	// in a sandbox (see sandbox.Sandbox.Wrap).
+	Wrap func(cmd *exec.Cmd) error
+}
+
+// LLMTool adapts t for the model.
+func (t Tool) LLMTool(opts Options) *llm.Tool {
+	return &llm.Tool{
+		Name:        t.Name,
+		Description: t.Description,
+		InputSchema: t.InputSchema,
+		ReadOnly:    t.ReadOnly,
+		Run: func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+			return t.run(ctx, input, opts)
+		},
+	}
+}
+
+// Output is the structured form of a tool's stdout.
+type Output struct {
+	Text   string  `json:"text"`
+	Images []Image `json:"images,omitempty"`
+	// Error, if set, fails the call with this message.
+	Error string `json:"error,omitempty"`
+}
+
+// Image is an image attached to an Output: either a file (Path, relative to
+// the working directory) or base64 Data with its MediaType.
+type Image struct {
+	Path      string `json:"path,omitempty"`
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+}
+
+func (t Tool) run(ctx context.Context, input json.RawMessage, opts Options) llm.ToolOut {
+	if len(input) == 0 {
+		input = json.RawMessage("{}")
+	}
+	if opts.CheckPermission != nil {
+		if err := opts.CheckPermission(ctx, input); err != nil {
+			return llm.ErrorToolOut(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, t.Command)
+	if opts.WorkingDir != nil {
+		cmd.Dir = opts.WorkingDir()
+	}
+	if opts.Environ != nil {
+		cmd.Env = opts.Environ(cmd.Dir)
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	stdout := &cappedBuffer{max: maxOutputBytes}
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 5 * time.Second
+	if opts.Wrap != nil {
+		if err := opts.Wrap(cmd); err != nil {
+			return llm.ErrorToolOut(err)
+		}
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return llm.ErrorfToolOut("%s timed out after %s", t.Name, t.Timeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return llm.ErrorfToolOut("%s failed: %w\n%s", t.Name, err, truncate(msg))
+	}
+
+	out := strings.TrimSpace(stdout.String())
+	var structured Output
+	if strings.HasPrefix(out, "{") && json.Unmarshal([]byte(out), &structured) == nil {
+		return structured.toolOut(ctx, cmd.Dir)
+	}
+	if out == "" {
+		out = "(no output)"
+	}
+	return llm.ToolOut{LLMContent: llm.TextContent(truncate(out))}
+}
+
+func (o Output) toolOut(ctx context.Context, dir string) llm.ToolOut {
+	if o.Error != "" {
+		return llm.ErrorToolOut(errors.New(o.Error))
+	}
+	var contents []llm.Content
+	if o.Text != "" {
+		contents = llm.TextContent(truncate(o.Text))
+	}
+	for _, img := range o.Images {
+		contents = append(contents, imageContent(ctx, img, dir)...)
+	}
+	if len(contents) == 0 {
+		contents = llm.TextContent("(no output)")
+	}
+	return llm.ToolOut{LLMContent: contents}
+}
+
+// imageContent loads an attached image, relative to dir, for the model.
+func imageContent(ctx context.Context, img Image, dir string) []llm.Content {
+	source := img.Path
+	if source == "" {
+		source = "image"
+	}
+	return imageutil.Content(ctx, source, func() ([]byte, error) {
+		if img.Path == "" {
+			return base64.StdEncoding.DecodeString(img.Data)
+		}
+		path := img.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		return os.ReadFile(path)
+	})
+}
+
+// truncate clips tool output to maxTextLen bytes, noting the cut.
+func truncate(s string) string {
+	if len(s) <= maxTextLen {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxTextLen], "") + fmt.Sprintf("\n[output truncated: %d bytes omitted]", len(s)-maxTextLen)
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the
+// rest, so a runaway tool can't exhaust memory.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,198 @@
+package scripttool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+func writeFile(t *testing.T, path, content string, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	user, project := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(user, "greet.json"), `{
+		"name": "greet",
+		"description": "Say hello.",
+		"input_schema": {"properties": {"who": {"type": "string"}}, "required": ["who"]}
+	}`, 0o644)
+	writeFile(t, filepath.Join(user, "greet"), "#!/bin/sh\ncat\n", 0o755)
+	writeFile(t, filepath.Join(project, "greet.yaml"), "name: greet\ndescription: Shadowed.\ncommand: /bin/true\n", 0o644)
+	writeFile(t, filepath.Join(project, "lint.yml"), `name: lint
+description: Run the linters.
+command: bin/lint
+timeout: 10s
+default_on: false
+read_only: true
+`, 0o644)
+	writeFile(t, filepath.Join(project, "bin", "lint"), "#!/bin/sh\necho ok\n", 0o755)
+	writeFile(t, filepath.Join(project, "broken.json"), `{"name": "broken"}`, 0o644)
+	writeFile(t, filepath.Join(project, "noexec.json"), `{"name": "noexec", "description": "x"}`, 0o644)
+	writeFile(t, filepath.Join(project, "noexec"), "#!/bin/sh\n", 0o644)
+	writeFile(t, filepath.Join(project, "README.md"), "not a manifest", 0o644)
+
+	tools := Load([]string{user, project, filepath.Join(project, "missing")}, nil)
+	if len(tools) != 2 {
+		t.Fatalf("got %d tools, want 2: %+v", len(tools), tools)
+	}
+	greet, lint := tools[0], tools[1]
+	if greet.Name != "greet" || greet.Description != "Say hello." || greet.Command != filepath.Join(user, "greet") || !greet.DefaultOn || greet.ReadOnly || greet.Timeout != DefaultTimeout {
+		t.Errorf("greet = %+v", greet)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(greet.InputSchema, &schema); err != nil || schema["type"] != "object" {
+		t.Errorf("greet schema = %s", greet.InputSchema)
+	}
+	if lint.Name != "lint" || lint.Command != filepath.Join(project, "bin", "lint") || lint.DefaultOn || !lint.ReadOnly || lint.Timeout != 10*time.Second {
+		t.Errorf("lint = %+v", lint)
+	}
+	if string(lint.InputSchema) != string(llm.EmptySchema()) {
+		t.Errorf("lint schema = %s", lint.InputSchema)
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "run"), "#!/bin/sh\n", 0o755)
+	for name, manifest := range map[string]string{
+		"name.json":    `{"name": "bad name", "description": "x", "command": "run"}`,
+		"desc.json":    `{"name": "ok", "command": "run"}`,
+		"schema.json":  `{"name": "ok", "description": "x", "command": "run", "input_schema": {"type": "string"}}`,
+		"timeout.json": `{"name": "ok", "description": "x", "command": "run", "timeout": "soon"}`,
+		"missing.json": `{"name": "ok", "description": "x", "command": "nope"}`,
+		"syntax.yaml":  "name: [unclosed\n",
+	} {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, manifest, 0o644)
+		if _, err := LoadManifest(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func runTool(t *testing.T, script, input string) llm.ToolOut {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "tool"), script, 0o755)
+	tool := Tool{Name: "tool", Description: "x", Command: filepath.Join(dir, "tool"), Timeout: 5 * time.Second}
+	cwd := t.TempDir()
+	return tool.LLMTool(Options{
+		WorkingDir: func() string { return cwd },
+		Environ:    func(cwd string) []string { return []string{"PATH=" + os.Getenv("PATH"), "TOOL_CWD=" + cwd} },
+	}).Run(context.Background(), json.RawMessage(input))
+}
+
+func TestRunTextOutput(t *testing.T) {
+	out := runTool(t, "#!/bin/sh\ncat\necho\npwd\necho \"$TOOL_CWD\"\n", `{"who":"world"}`)
+	if out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	lines := strings.Split(out.LLMContent[0].Text, "\n")
+	if len(lines) != 3 || lines[0] != `{"who":"world"}` {
+		t.Fatalf("tool did not get its input on stdin: %q", lines)
+	}
+	if lines[1] != lines[2] {
+		t.Errorf("tool ran in %s, want the working directory %s", lines[1], lines[2])
+	}
+}
+
+func TestRunStructuredOutput(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "shot.png"), buf.String(), 0o644)
+
+	out := runTool(t, "#!/bin/sh\necho '{\"text\": \"rendered\", \"images\": [{\"path\": \""+filepath.Join(dir, "shot.png")+"\"}]}'\n", `{}`)
+	if out.Error != nil {
+		t.Fatal(out.Error)
+	}
+	if len(out.LLMContent) != 2 || out.LLMContent[0].Text != "rendered" || out.LLMContent[1].MediaType != "image/png" {
+		t.Errorf("content = %+v", out.LLMContent)
+	}
+
+	out = runTool(t, "#!/bin/sh\necho '{\"error\": \"no such service\"}'\n", `{}`)
+	if out.Error == nil || out.Error.Error() != "no such service" {
+		t.Errorf("error = %v", out.Error)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	out := runTool(t, "#!/bin/sh\necho 'bad input' >&2\nexit 3\n", `{}`)
+	if out.Error == nil || !strings.Contains(out.Error.Error(), "bad input") {
+		t.Errorf("error = %v", out.Error)
+	}
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "slow"), "#!/bin/sh\nexec sleep 10\n", 0o755)
+	tool := Tool{Name: "slow", Command: filepath.Join(dir, "slow"), Timeout: 100 * time.Millisecond}
+	out = tool.LLMTool(Options{}).Run(context.Background(), nil)
+	if out.Error == nil || !strings.Contains(out.Error.Error(), "timed out") {
+		t.Errorf("error = %v", out.Error)
+	}
+}
+
+func TestRunPermissionAndWrap(t *testing.T) {
+	dir := t.TempDir()
+	ran := filepath.Join(dir, "ran")
+	writeFile(t, filepath.Join(dir, "tool"), "#!/bin/sh\ntouch "+ran+"\necho ok\n", 0o755)
+	tool := Tool{Name: "tool", Command: filepath.Join(dir, "tool"), Timeout: time.Minute}
+
+	var checked string
+	out := tool.LLMTool(Options{CheckPermission: func(ctx context.Context, input json.RawMessage) error {
+		checked = string(input)
+		return errors.New("denied by policy")
+	}}).Run(context.Background(), json.RawMessage(`{"x":1}`))
+	if out.Error == nil || out.Error.Error() != "denied by policy" || checked != `{"x":1}` {
+		t.Errorf("refused call: error = %v, checked input %q", out.Error, checked)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("refused tool ran anyway")
+	}
+
+	var wrapped []string
+	out = tool.LLMTool(Options{Wrap: func(cmd *exec.Cmd) error {
+		wrapped = cmd.Args
+		return nil
+	}}).Run(context.Background(), nil)
+	if out.Error != nil || len(wrapped) != 1 || wrapped[0] != tool.Command {
+		t.Errorf("wrapped call: error = %v, wrapped %q", out.Error, wrapped)
+	}
+}
+
+func TestProjectDirs(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "a", "b")
+	for _, d := range []string{filepath.Join(root, ".git"), filepath.Join(root, ".shelley", "tools"), filepath.Join(sub, ".shelley", "tools")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := ProjectDirs(sub)
+	want := []string{filepath.Join(sub, ".shelley", "tools"), filepath.Join(root, ".shelley", "tools")}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ProjectDirs = %v, want %v", got, want)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"shelley.exe.dev/claudetool/bashkit"
+	"shelley.exe.dev/claudetool/sandbox"
 	"shelley.exe.dev/llm"
 )
 
@@ -47,6 +48,8 @@ type ShellTool struct {
 	MaxYield time.Duration
 	// TempDir overrides the directory used for log files (default os.TempDir).
 	TempDir string
+	// Sandbox, if set, runs commands in a sandbox (see package sandbox).
+	Sandbox *sandbox.Sandbox
 }
 
 const (
@@ -191,7 +194,7 @@ func (s *ShellTool) run(ctx context.Context, req shellInput) llm.ToolOut {
 		return llm.ErrorToolOut(err)
 	}
 	if s.CheckPermission != nil {
-		if err := s.CheckPermission(req.Command); err != nil {
+		if err := s.CheckPermission(ctx, req.Command); err != nil {
 			return llm.ErrorToolOut(err)
 		}
 	}
@@ -243,6 +246,13 @@ func (s *ShellTool) run(ctx context.Context, req shellInput) llm.ToolOut {
 	)
 	env = append(env, s.Env.Environ(cmd.Dir)...)
 	cmd.Env = env
+	if s.Sandbox != nil {
+		if err := s.Sandbox.Wrap(cmd); err != nil {
+			tmpFile.Close()
+			os.Remove(logPath)
+			return llm.ErrorToolOut(err)
+		}
+	}
 
 	if err := cmd.Start(); err != nil {
 		tmpFile.Close()
@@ -298,6 +308,9 @@ func (s *ShellTool) run(ctx context.Context, req shellInput) llm.ToolOut {
 			return llm.ErrorfToolOut("failed to read shell output: %w", ferr)
 		}
 		if waitErr != nil {
+			if v := s.Sandbox.Violation(out); v != "" {
+				return llm.ErrorToolOut(fmt.Errorf("[%s; command failed: %w]\n%s", v, waitErr, out))
+			}
 			return llm.ErrorToolOut(fmt.Errorf("[command failed: %w]\n%s", waitErr, out))
 		}
 		return llm.ToolOut{LLMContent: llm.TextContent(out), Display: display}
@@ -317,7 +330,7 @@ func (s *ShellTool) run(ctx context.Context, req shellInput) llm.ToolOut {
 		stopProgress()
 		display.Yielded = true
 		tail := readTailString(logPath, shellTailBytes)
-		payload := buildYieldPayload(req.Command, pid, pgid, logPath, tail, yield)
+		payload := buildYieldPayload(req.Command, pid, pgid, logPath, tail, yield, s.Sandbox != nil)
 		// After the yielded process eventually exits, schedule the log file
 		// for deletion. The grace period is generous so agents that come
 		// back later (after polling, waiting, or working on something else)
@@ -382,7 +395,7 @@ func readAndFormatShellOutput(path string) (string, error) {
 	return formatForegroundBashOutput(string(b))
 }
 
-func buildYieldPayload(command string, pid, pgid int, logPath, tail string, yield time.Duration) string {
+func buildYieldPayload(command string, pid, pgid int, logPath, tail string, yield time.Duration, sandboxed bool) string {
 	var b strings.Builder
 	fmt.Fprintf(&b, "[yielded after %s; still running] PID=%d PGID=%d log=%s\n", yield, pid, pgid, logPath)
 	fmt.Fprintf(&b, "command: %s\n", command)
@@ -396,6 +409,14 @@ func buildYieldPayload(command string, pid, pgid int, logPath, tail string, yiel
 		}
 	}
 	b.WriteString("--- end ---\n\n")
+	if sandboxed {
+		// Later commands run in their own PID namespaces and cannot see
+		// or signal this process; only its log is shared.
+		b.WriteString("Commands run in a sandbox, so later commands cannot signal this process.\n")
+		b.WriteString("To follow it, read the log:\n")
+		fmt.Fprintf(&b, "  tail -c 8192 %s\n", logPath)
+		return b.String()
+	}
 	b.WriteString("To check status without waiting:\n")
 	fmt.Fprintf(&b, "  kill -0 %d 2>/dev/null && echo running || echo exited; tail -c 8192 %s\n\n", pid, logPath)
 	b.WriteString("To kill the process and its children:\n")
@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"shelley.exe.dev/claudetool/sandbox"
 	"shelley.exe.dev/llm"
 )
 
@@ -394,3 +395,29 @@ func TestShellCoauthorTrailerIntegration(t *testing.T) {
 		t.Errorf("unexpected error shape: %v", err)
 	}
 }
+
+func TestShellSandboxed(t *testing.T) {
+	s := newTestShell(t)
+	dir := t.TempDir()
+	s.WorkingDir = NewMutableWorkingDir(dir)
+	s.Sandbox = &sandbox.Sandbox{Network: true, Writable: []string{dir, s.TempDir}}
+
+	_, _, err := runShell(t, s, `{"command":"touch /shelley-sandbox-probe","yield_time_seconds":10}`, 20*time.Second)
+	if err != nil && strings.Contains(err.Error(), "operation not permitted") {
+		t.Skipf("cannot create namespaces here: %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "sandbox violation") {
+		t.Errorf("err = %v, want a sandbox violation", err)
+	}
+
+	out, disp, err := runShell(t, s, `{"command":"sleep 5","yield_time_seconds":1}`, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disp == nil || !disp.Yielded {
+		t.Fatalf("expected a yielded result, got %+v", disp)
+	}
+	if strings.Contains(out, "kill -0") || !strings.Contains(out, "cannot signal") {
+		t.Errorf("yield payload should not suggest signalling a sandboxed process:\n%s", out)
+	}
+}
@@ -22,6 +22,23 @@ type SubagentRunner interface {
 	RunSubagent(ctx context.Context, conversationID, prompt string, wait bool, timeout time.Duration, modelID, reasoning string) (string, error)
 }
 
+// SubagentWorktrees is implemented by SubagentRunners that can run a
+// subagent in its own git worktree (isolation "worktree") and merge or
+// discard its branch afterwards.
+type SubagentWorktrees interface {
+	// IsolateSubagent moves a subagent that has not started yet into a new
+	// git worktree, on a branch cut from parentDir's HEAD. It does nothing
+	// for a subagent that already has a worktree.
+	IsolateSubagent(ctx context.Context, conversationID, parentDir string) error
+	// MergeSubagentWorktree commits whatever the subagent left uncommitted,
+	// merges its branch into the checkout at parentDir, and removes the
+	// worktree and branch. It returns a report for the LLM.
+	MergeSubagentWorktree(ctx context.Context, parentID, slug, parentDir string) (string, error)
+	// DiscardSubagentWorktree removes the subagent's worktree and branch,
+	// changes and all. It returns a report for the LLM.
+	DiscardSubagentWorktree(ctx context.Context, parentID, slug string) (string, error)
+}
+
 // subagentReasoningLevels are the user-facing reasoning/thinking levels a
 // subagent may be given via the "reasoning" parameter.
 var subagentReasoningLevels = []string{"off", "minimal", "low", "medium", "high", "xhigh"}
@@ -90,6 +107,7 @@ Use subagents for:
 Each subagent has its own slug identifier within this conversation.
 You can send messages to existing subagents by using the same slug.
 The tool returns the subagent's last response, or a status if the timeout is reached.
+For many similar, independent items, use subagent_map instead.
 
 When writing prompts for subagents, convey intent, nuance, and operational
 details — not just prescriptive instructions. The subagent has no context
@@ -99,6 +117,17 @@ Use the "reasoning" parameter to set the subagent's thinking effort (off,
 minimal, low, medium, high, xhigh). If omitted, the subagent inherits the
 parent conversation's reasoning level.`
 
+	if _, ok := s.Runner.(SubagentWorktrees); ok {
+		base += `
+
+Set isolation to "worktree" when starting a subagent that will change files
+in a git repository: it then works in its own git worktree, on a new branch
+cut from your HEAD, so it can't collide with you or other subagents. Its
+response ends with the branch and the diff of its changes. Review them, then
+call this tool again with the same slug and worktree_action "merge" to merge
+the branch into your working directory, or "discard" to throw it away.`
+	}
+
 	if len(s.AvailableModels) > 0 {
 		base += "\n\nAvailable models (use the \"model\" parameter to override the default):"
 		for _, m := range s.AvailableModels {
@@ -142,9 +171,24 @@ func (s *SubagentTool) subagentInputSchema() string {
       "enum": [%s]
     }`, strings.Join(reasoningEnum, ", "))
 
+	worktreeProps := ""
+	if _, ok := s.Runner.(SubagentWorktrees); ok {
+		worktreeProps = `,
+    "isolation": {
+      "type": "string",
+      "description": "Where a new subagent works: \"shared\" (default) in your working directory, or \"worktree\" in its own git worktree and branch. Only takes effect when the subagent is created.",
+      "enum": ["shared", "worktree"]
+    },
+    "worktree_action": {
+      "type": "string",
+      "description": "For a finished subagent with a worktree: \"merge\" its branch into your working directory, or \"discard\" it. No prompt is sent.",
+      "enum": ["merge", "discard"]
+    }`
+	}
+
 	return fmt.Sprintf(`{
   "type": "object",
-  "required": ["slug", "prompt"],
+  "required": ["slug"],
   "properties": {
     "slug": {
       "type": "string",
@@ -152,7 +196,7 @@ func (s *SubagentTool) subagentInputSchema() string {
     },
     "prompt": {
       "type": "string",
-      "description": "The message to send to the subagent"
+      "description": "The message to send to the subagent. Required unless worktree_action is set."
     },
     "timeout_seconds": {
       "type": "integer",
@@ -161,9 +205,9 @@ func (s *SubagentTool) subagentInputSchema() string {
     "wait": {
       "type": "boolean",
       "description": "Whether to wait for completion (default: true). If false, returns immediately; when the subagent eventually finishes, its response is delivered asynchronously. If wait=true and the subagent completes before timeout, no later asynchronous duplicate is delivered. Sending a new message to a subagent that is still working does NOT interrupt it: the message is queued and delivered after the current turn finishes."
-    }%s%s
+    }%s%s%s
   }
-}`, modelProp, reasoningProp)
+}`, modelProp, reasoningProp, worktreeProps)
 }
 
 type subagentInput struct {
@@ -173,6 +217,8 @@ type subagentInput struct {
 	Wait           *bool  `json:"wait,omitempty"`
 	Model          string `json:"model,omitempty"`
 	Reasoning      string `json:"reasoning,omitempty"`
+	Isolation      string `json:"isolation,omitempty"`
+	WorktreeAction string `json:"worktree_action,omitempty"`
 }
 
 // Tool returns an llm.Tool for the subagent functionality.
@@ -195,10 +241,22 @@ func (s *SubagentTool) run(ctx context.Context, req subagentInput) llm.ToolOut {
 		return llm.ErrorfToolOut("slug must contain alphanumeric characters")
 	}
 
+	if req.WorktreeAction != "" {
+		worktrees, ok := s.Runner.(SubagentWorktrees)
+		if !ok {
+			return llm.ErrorfToolOut("worktree isolation is not available")
+		}
+		return s.runWorktreeAction(ctx, worktrees, req)
+	}
+
 	if req.Prompt == "" {
 		return llm.ErrorfToolOut("prompt is required")
 	}
 
+	if err := s.checkIsolation(req.Isolation); err != nil {
+		return llm.ErrorToolOut(err)
+	}
+
 	// Set defaults. The default wait is generous (15 min) because subagents
 	// commonly run review/analysis tasks that take several minutes; a short
 	// timeout pushed the parent to "hurry" a still-working subagent, which
@@ -215,41 +273,18 @@ func (s *SubagentTool) run(ctx context.Context, req subagentInput) llm.ToolOut {
 		wait = *req.Wait
 	}
 
-	// Determine which model to use: explicit choice > parent's model
-	modelID := s.ModelID
-	if req.Model != "" {
-		if len(s.AvailableModels) > 0 {
-			found := false
-			for _, m := range s.AvailableModels {
-				if m.ID == req.Model {
-					found = true
-					break
-				}
-			}
-			if !found {
-				var ids []string
-				for _, m := range s.AvailableModels {
-					ids = append(ids, m.ID)
-				}
-				return llm.ErrorfToolOut("unknown model %q; available: %s", req.Model, strings.Join(ids, ", "))
-			}
-		}
-		modelID = req.Model
+	modelID, err := s.resolveModel(req.Model)
+	if err != nil {
+		return llm.ErrorToolOut(err)
 	}
-
-	// Determine reasoning level: explicit choice > parent's reasoning level.
-	reasoning := s.ParentReasoning
-	if req.Reasoning != "" {
-		if !isValidReasoningLevel(req.Reasoning) {
-			return llm.ErrorfToolOut("unknown reasoning level %q; available: %s", req.Reasoning, strings.Join(subagentReasoningLevels, ", "))
-		}
-		reasoning = req.Reasoning
+	reasoning, err := s.resolveReasoning(req.Reasoning)
+	if err != nil {
+		return llm.ErrorToolOut(err)
 	}
 
-	// Get or create the subagent conversation
-	conversationID, actualSlug, err := s.DB.GetOrCreateSubagentConversation(ctx, req.Slug, s.ParentConversationID, s.WorkingDir.Get())
+	conversationID, actualSlug, err := s.getOrCreate(ctx, req.Slug, req.Isolation)
 	if err != nil {
-		return llm.ErrorfToolOut("failed to get/create subagent conversation: %w", err)
+		return llm.ErrorToolOut(err)
 	}
 
 	// Use the runner to execute the subagent
@@ -273,6 +308,85 @@ func (s *SubagentTool) run(ctx context.Context, req subagentInput) llm.ToolOut {
 	}
 }
 
+// checkIsolation validates an "isolation" parameter.
+func (s *SubagentTool) checkIsolation(isolation string) error {
+	switch isolation {
+	case "", "shared":
+		return nil
+	case "worktree":
+		if _, ok := s.Runner.(SubagentWorktrees); !ok {
+			return fmt.Errorf("worktree isolation is not available")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown isolation %q; available: shared, worktree", isolation)
+}
+
+// getOrCreate returns the subagent conversation for slug, creating it, and
+// its worktree if isolation is "worktree", if it doesn't exist yet.
+func (s *SubagentTool) getOrCreate(ctx context.Context, slug, isolation string) (conversationID, actualSlug string, err error) {
+	conversationID, actualSlug, err = s.DB.GetOrCreateSubagentConversation(ctx, slug, s.ParentConversationID, s.WorkingDir.Get())
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get/create subagent conversation: %w", err)
+	}
+	if isolation == "worktree" {
+		if err := s.Runner.(SubagentWorktrees).IsolateSubagent(ctx, conversationID, s.WorkingDir.Get()); err != nil {
+			return "", "", fmt.Errorf("failed to create a worktree for subagent %q: %w", actualSlug, err)
+		}
+	}
+	return conversationID, actualSlug, nil
+}
+
+// resolveModel returns the model a subagent runs: the requested one, which
+// must be available, or the parent's.
+func (s *SubagentTool) resolveModel(requested string) (string, error) {
+	if requested == "" {
+		return s.ModelID, nil
+	}
+	if len(s.AvailableModels) > 0 {
+		var ids []string
+		for _, m := range s.AvailableModels {
+			if m.ID == requested {
+				return requested, nil
+			}
+			ids = append(ids, m.ID)
+		}
+		return "", fmt.Errorf("unknown model %q; available: %s", requested, strings.Join(ids, ", "))
+	}
+	return requested, nil
+}
+
+// resolveReasoning returns the reasoning level a subagent runs at: the
+// requested one, which must be valid, or the parent's.
+func (s *SubagentTool) resolveReasoning(requested string) (string, error) {
+	if requested == "" {
+		return s.ParentReasoning, nil
+	}
+	if !isValidReasoningLevel(requested) {
+		return "", fmt.Errorf("unknown reasoning level %q; available: %s", requested, strings.Join(subagentReasoningLevels, ", "))
+	}
+	return requested, nil
+}
+
+// runWorktreeAction merges or discards the worktree of an existing
+// subagent.
+func (s *SubagentTool) runWorktreeAction(ctx context.Context, worktrees SubagentWorktrees, req subagentInput) llm.ToolOut {
+	var report string
+	var err error
+	switch req.WorktreeAction {
+	case "merge":
+		report, err = worktrees.MergeSubagentWorktree(ctx, s.ParentConversationID, req.Slug, s.WorkingDir.Get())
+	case "discard":
+		report, err = worktrees.DiscardSubagentWorktree(ctx, s.ParentConversationID, req.Slug)
+	default:
+		return llm.ErrorfToolOut("unknown worktree_action %q; available: merge, discard", req.WorktreeAction)
+	}
+	if err != nil {
+		return llm.ErrorfToolOut("failed to %s the worktree of subagent %q: %w", req.WorktreeAction, req.Slug, err)
+	}
+	return llm.ToolOut{LLMContent: llm.TextContent(report)}
+}
+
 // SubagentDisplayData is the display data sent to the UI for subagent tool results.
 type SubagentDisplayData struct {
 	Slug           string `json:"slug"`
@@ -0,0 +1,354 @@
+package claudetool
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"shelley.exe.dev/llm"
+)
+
+const subagentMapName = "subagent_map"
+
+const (
+	// subagentMapDefaultConcurrency is how many subagents a map runs at
+	// once unless told otherwise.
+	subagentMapDefaultConcurrency = 4
+	// subagentMapMaxConcurrency caps an explicit concurrency.
+	subagentMapMaxConcurrency = 16
+	// subagentMapMaxItems caps the items of one call.
+	subagentMapMaxItems = 100
+	// subagentMapSummaryLen caps the summary column of the result table.
+	subagentMapSummaryLen = 200
+	// subagentMapResponseLen caps each full response after the table.
+	subagentMapResponseLen = 1000
+)
+
+const subagentMapDescription = `Run one subagent per item of a list, several at a time, and collect their results.
+
+Use this for batches of similar, independent chores, like "update these 40 call
+sites" or "summarize each of these files", instead of calling the subagent tool
+once per item. Each item gets its own subagent, named slug_prefix-1,
+slug_prefix-2, ..., whose prompt is prompt_template with {{item}} replaced by
+the item and {{index}} by its 1-based position. A template without {{item}}
+gets the item appended.
+
+The tool waits for every subagent and returns a table with each item's status
+(ok, error, or timeout if it was still working at the deadline; it then keeps
+running and reports back asynchronously), a one-line summary and any error,
+followed by the responses. Reusing a slug_prefix sends the items to the same
+subagents again.
+
+The subagents don't share context with you or each other: the template must
+carry everything they need to know.`
+
+// subagentMapInputSchema builds the JSON schema of subagent_map, sharing the
+// model and reasoning options of the subagent tool.
+func (s *SubagentTool) subagentMapInputSchema() string {
+	var enum []string
+	for _, m := range s.AvailableModels {
+		enum = append(enum, strconv.Quote(m.ID))
+	}
+	modelProp := ""
+	if len(enum) > 0 {
+		modelProp = fmt.Sprintf(`,
+    "model": {
+      "type": "string",
+      "description": "LLM model for the subagents. Defaults to the parent conversation's model.",
+      "enum": [%s]
+    }`, strings.Join(enum, ", "))
+	}
+	var reasoningEnum []string
+	for _, l := range subagentReasoningLevels {
+		reasoningEnum = append(reasoningEnum, strconv.Quote(l))
+	}
+	isolationProp := ""
+	if _, ok := s.Runner.(SubagentWorktrees); ok {
+		isolationProp = `,
+    "isolation": {
+      "type": "string",
+      "description": "\"worktree\" gives each new subagent its own git worktree and branch, to merge or discard one by one with the subagent tool's worktree_action. Default \"shared\".",
+      "enum": ["shared", "worktree"]
+    }`
+	}
+	return fmt.Sprintf(`{
+  "type": "object",
+  "required": ["slug_prefix", "prompt_template", "items"],
+  "properties": {
+    "slug_prefix": {
+      "type": "string",
+      "description": "Prefix of the subagents' slugs, e.g. 'callsite' for callsite-1, callsite-2, ..."
+    },
+    "prompt_template": {
+      "type": "string",
+      "description": "The prompt for each subagent, with {{item}} and {{index}} placeholders"
+    },
+    "items": {
+      "type": "array",
+      "items": {"type": "string"},
+      "description": "The items, at most %d"
+    },
+    "concurrency": {
+      "type": "integer",
+      "description": "How many subagents run at once (default: %d, max: %d)"
+    },
+    "timeout_seconds": {
+      "type": "integer",
+      "description": "How long to wait for each subagent, in seconds (default: 900, max: 3600)"
+    },
+    "reasoning": {
+      "type": "string",
+      "description": "Reasoning/thinking effort level for the subagents. If omitted, they inherit the parent conversation's reasoning level.",
+      "enum": [%s]
+    }%s%s
+  }
+}`, subagentMapMaxItems, subagentMapDefaultConcurrency, subagentMapMaxConcurrency, strings.Join(reasoningEnum, ", "), modelProp, isolationProp)
+}
+
+type subagentMapInput struct {
+	SlugPrefix     string   `json:"slug_prefix"`
+	PromptTemplate string   `json:"prompt_template"`
+	Items          []string `json:"items"`
+	Concurrency    int      `json:"concurrency,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+	Model          string   `json:"model,omitempty"`
+	Reasoning      string   `json:"reasoning,omitempty"`
+	Isolation      string   `json:"isolation,omitempty"`
+}
+
+// MapTool returns the subagent_map tool, which runs one subagent per item
+// of a list.
+func (s *SubagentTool) MapTool() *llm.Tool {
+	return &llm.Tool{
+		Name:        subagentMapName,
+		Description: subagentMapDescription,
+		InputSchema: llm.MustSchema(s.subagentMapInputSchema()),
+		Run:         llm.RunJSON(s.runMap),
+	}
+}
+
+// Statuses of a subagent_map item.
+const (
+	SubagentMapPending   = "pending"
+	SubagentMapRunning   = "running"
+	SubagentMapOK        = "ok"
+	SubagentMapError     = "error"
+	SubagentMapTimeout   = "timeout"
+	SubagentMapCancelled = "cancelled"
+)
+
+// SubagentMapItem is one item of a subagent_map call, as shown to the UI.
+type SubagentMapItem struct {
+	SubagentDisplayData
+	Item    string `json:"item"`
+	Status  string `json:"status"`
+	Summary string `json:"summary,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SubagentMapDisplayData is the display data of subagent_map results, and
+// of its progress reports while it runs.
+type SubagentMapDisplayData struct {
+	Items []SubagentMapItem `json:"items"`
+}
+
+// subagentMapRun tracks the items of one call. Progress is reported
+// whenever an item changes status.
+type subagentMapRun struct {
+	mu        sync.Mutex
+	items     []SubagentMapItem
+	responses []string
+	report    llm.ToolProgressFunc
+	toolUseID string
+}
+
+// update applies f to item i and reports progress.
+func (r *subagentMapRun) update(i int, f func(*SubagentMapItem)) {
+	r.mu.Lock()
+	f(&r.items[i])
+	var progress llm.ToolProgress
+	if r.report != nil {
+		progress = llm.ToolProgress{
+			ToolUseID: r.toolUseID,
+			ToolName:  subagentMapName,
+			Output:    r.progressLine(),
+			Display:   SubagentMapDisplayData{Items: append([]SubagentMapItem(nil), r.items...)},
+		}
+	}
+	r.mu.Unlock()
+	if r.report != nil {
+		r.report(progress)
+	}
+}
+
+// progressLine counts the items by status. r.mu must be held.
+func (r *subagentMapRun) progressLine() string {
+	counts := map[string]int{}
+	for _, it := range r.items {
+		counts[it.Status]++
+	}
+	done := len(r.items) - counts[SubagentMapPending] - counts[SubagentMapRunning]
+	line := fmt.Sprintf("%d/%d done, %d running", done, len(r.items), counts[SubagentMapRunning])
+	if n := counts[SubagentMapError] + counts[SubagentMapTimeout]; n > 0 {
+		line += fmt.Sprintf(", %d failed or timed out", n)
+	}
+	return line
+}
+
+func (s *SubagentTool) runMap(ctx context.Context, req subagentMapInput) llm.ToolOut {
+	prefix := sanitizeSlug(req.SlugPrefix)
+	if prefix == "" {
+		return llm.ErrorfToolOut("slug_prefix must contain alphanumeric characters")
+	}
+	if req.PromptTemplate == "" {
+		return llm.ErrorfToolOut("prompt_template is required")
+	}
+	if len(req.Items) == 0 {
+		return llm.ErrorfToolOut("items is required")
+	}
+	if len(req.Items) > subagentMapMaxItems {
+		return llm.ErrorfToolOut("at most %d items are allowed, got %d; split the list", subagentMapMaxItems, len(req.Items))
+	}
+	if err := s.checkIsolation(req.Isolation); err != nil {
+		return llm.ErrorToolOut(err)
+	}
+	modelID, err := s.resolveModel(req.Model)
+	if err != nil {
+		return llm.ErrorToolOut(err)
+	}
+	reasoning, err := s.resolveReasoning(req.Reasoning)
+	if err != nil {
+		return llm.ErrorToolOut(err)
+	}
+	timeout := subagentDefaultTimeout
+	if req.TimeoutSeconds > 0 {
+		timeout = min(time.Duration(req.TimeoutSeconds)*time.Second, subagentMaxTimeout)
+	}
+	concurrency := subagentMapDefaultConcurrency
+	if req.Concurrency > 0 {
+		concurrency = min(req.Concurrency, subagentMapMaxConcurrency)
+	}
+
+	run := &subagentMapRun{
+		items:     make([]SubagentMapItem, len(req.Items)),
+		responses: make([]string, len(req.Items)),
+		report:    llm.GetToolProgress(ctx),
+		toolUseID: llm.ToolUseID(ctx),
+	}
+	for i, item := range req.Items {
+		run.items[i] = SubagentMapItem{
+			SubagentDisplayData: SubagentDisplayData{Slug: fmt.Sprintf("%s-%d", prefix, i+1)},
+			Item:                item,
+			Status:              SubagentMapPending,
+		}
+	}
+
+	// Acquire before launching, so items start in order.
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range req.Items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			run.update(i, func(it *SubagentMapItem) { it.Status = SubagentMapCancelled })
+			continue
+		}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			s.runMapItem(ctx, run, i, expandMapTemplate(req.PromptTemplate, item, i+1), req.Isolation, modelID, reasoning, timeout)
+		})
+	}
+	wg.Wait()
+
+	return llm.ToolOut{
+		LLMContent: llm.TextContent(run.table()),
+		Display:    SubagentMapDisplayData{Items: run.items},
+	}
+}
+
+// runMapItem runs the subagent of item i and records its outcome.
+func (s *SubagentTool) runMapItem(ctx context.Context, run *subagentMapRun, i int, prompt, isolation, modelID, reasoning string, timeout time.Duration) {
+	conversationID, slug, err := s.getOrCreate(ctx, run.items[i].Slug, isolation)
+	if err != nil {
+		run.update(i, func(it *SubagentMapItem) { it.Status, it.Error = SubagentMapError, err.Error() })
+		return
+	}
+	run.update(i, func(it *SubagentMapItem) {
+		it.Slug, it.ConversationID, it.Status = slug, conversationID, SubagentMapRunning
+	})
+
+	response, err := s.Runner.RunSubagent(ctx, conversationID, prompt, true, timeout, modelID, reasoning)
+	run.update(i, func(it *SubagentMapItem) {
+		switch {
+		case err != nil:
+			it.Status, it.Error = SubagentMapError, err.Error()
+		case strings.HasPrefix(response, "[Subagent is still working"):
+			it.Status, it.Summary = SubagentMapTimeout, mapSummary(response)
+		default:
+			it.Status, it.Summary = SubagentMapOK, mapSummary(response)
+		}
+		run.responses[i] = response
+	})
+}
+
+// expandMapTemplate fills in a prompt template for one item.
+func expandMapTemplate(template, item string, index int) string {
+	prompt := strings.ReplaceAll(template, "{{index}}", strconv.Itoa(index))
+	if !strings.Contains(prompt, "{{item}}") {
+		return prompt + "\n\nItem: " + item
+	}
+	return strings.ReplaceAll(prompt, "{{item}}", item)
+}
+
+// mapSummary returns the first non-blank line of s, shortened to
+// subagentMapSummaryLen bytes.
+func mapSummary(s string) string {
+	for line := range strings.Lines(s) {
+		if line = strings.TrimSpace(line); line != "" {
+			return truncateMapText(line, subagentMapSummaryLen)
+		}
+	}
+	return ""
+}
+
+// truncateMapText shortens s to at most n bytes, without splitting a UTF-8
+// sequence, marking the cut with "...".
+func truncateMapText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+// table renders the results for the LLM: a Markdown table with a row per
+// item, then the response of every item that has one.
+func (r *subagentMapRun) table() string {
+	cell := func(s string) string {
+		return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+	}
+	var b strings.Builder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(&b, "%s\n\n", r.progressLine())
+	b.WriteString("| # | item | subagent | status | summary | error |\n|---|---|---|---|---|---|\n")
+	for i, it := range r.items {
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s |\n", i+1, cell(truncateMapText(it.Item, subagentMapSummaryLen)), it.Slug, it.Status, cell(it.Summary), cell(it.Error))
+	}
+	for i, response := range r.responses {
+		if response == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %d. %s\n%s\n", i+1, r.items[i].Slug, truncateMapText(response, subagentMapResponseLen))
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package claudetool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+// mapRunner answers each subagent with a response derived from its prompt,
+// recording the prompts and the peak number of subagents running at once.
+type mapRunner struct {
+	mu      sync.Mutex
+	prompts map[string]string // conversation ID -> prompt
+	running int
+	peak    int
+}
+
+func (m *mapRunner) RunSubagent(ctx context.Context, conversationID, prompt string, wait bool, timeout time.Duration, modelID, reasoning string) (string, error) {
+	m.mu.Lock()
+	m.prompts[conversationID] = prompt
+	m.running++
+	m.peak = max(m.peak, m.running)
+	m.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	m.mu.Lock()
+	m.running--
+	m.mu.Unlock()
+	switch {
+	case strings.Contains(prompt, "broken"):
+		return "", errors.New("model exploded")
+	case strings.Contains(prompt, "slow"):
+		return "[Subagent is still working (timeout reached). Progress summary:]\nhalfway", nil
+	}
+	return "Updated " + prompt + "\nDetails follow.", nil
+}
+
+func runMapTool(t *testing.T, tool *SubagentTool, input subagentMapInput, progress llm.ToolProgressFunc) llm.ToolOut {
+	t.Helper()
+	inputJSON, _ := json.Marshal(input)
+	ctx := llm.WithToolUseID(context.Background(), "tu_map")
+	if progress != nil {
+		ctx = llm.WithToolProgress(ctx, progress)
+	}
+	return tool.MapTool().Run(ctx, inputJSON)
+}
+
+func TestSubagentMap(t *testing.T) {
+	runner := &mapRunner{prompts: map[string]string{}}
+	tool := &SubagentTool{
+		DB:                   newMockSubagentDB(),
+		ParentConversationID: "parent-123",
+		WorkingDir:           NewMutableWorkingDir("/tmp"),
+		Runner:               runner,
+	}
+
+	var mu sync.Mutex
+	var reports []llm.ToolProgress
+	out := runMapTool(t, tool, subagentMapInput{
+		SlugPrefix:     "Call Site",
+		PromptTemplate: "fix call site {{index}}: {{item}}",
+		Items:          []string{"a.go:1", "broken.go:2", "slow.go:3", "d.go:4", "e.go:5"},
+		Concurrency:    2,
+	}, func(p llm.ToolProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, p)
+	})
+	if out.Error != nil {
+		t.Fatalf("subagent_map failed: %v", out.Error)
+	}
+
+	if runner.peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", runner.peak)
+	}
+	if got := runner.prompts["subagent-call-site-4"]; got != "fix call site 4: d.go:4" {
+		t.Errorf("prompt of item 4 = %q", got)
+	}
+
+	display := out.Display.(SubagentMapDisplayData)
+	var statuses []string
+	for _, it := range display.Items {
+		statuses = append(statuses, it.Status)
+	}
+	if want := "ok error timeout ok ok"; strings.Join(statuses, " ") != want {
+		t.Errorf("statuses = %v, want %s", statuses, want)
+	}
+	if it := display.Items[0]; it.Slug != "call-site-1" || it.ConversationID != "subagent-call-site-1" || it.Summary != "Updated fix call site 1: a.go:1" {
+		t.Errorf("item 1 = %+v", it)
+	}
+	if it := display.Items[1]; it.Error != "model exploded" {
+		t.Errorf("item 2 = %+v", it)
+	}
+
+	text := out.LLMContent[0].Text
+	for _, want := range []string{
+		"5/5 done, 0 running, 2 failed or timed out",
+		"| 2 | broken.go:2 | call-site-2 | error |  | model exploded |",
+		"## 1. call-site-1\nUpdated fix call site 1: a.go:1\nDetails follow.",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("result does not contain %q:\n%s", want, text)
+		}
+	}
+
+	// Every change of status is reported: 5 starts and 5 finishes.
+	if len(reports) != 10 {
+		t.Fatalf("got %d progress reports, want 10", len(reports))
+	}
+	last := reports[len(reports)-1]
+	if last.ToolUseID != "tu_map" || last.ToolName != "subagent_map" || !strings.HasPrefix(last.Output, "5/5 done") {
+		t.Errorf("last progress report = %+v", last)
+	}
+	if items := last.Display.(SubagentMapDisplayData).Items; len(items) != 5 || items[4].Status != "ok" {
+		t.Errorf("last progress display = %+v", items)
+	}
+}
+
+func TestSubagentMapValidation(t *testing.T) {
+	tool := &SubagentTool{
+		DB:                   newMockSubagentDB(),
+		ParentConversationID: "parent-123",
+		WorkingDir:           NewMutableWorkingDir("/tmp"),
+		Runner:               &mockSubagentRunner{response: "OK"},
+	}
+	for name, input := range map[string]subagentMapInput{
+		"no prefix":       {PromptTemplate: "x", Items: []string{"a"}},
+		"no template":     {SlugPrefix: "p", Items: []string{"a"}},
+		"no items":        {SlugPrefix: "p", PromptTemplate: "x"},
+		"too many items":  {SlugPrefix: "p", PromptTemplate: "x", Items: make([]string, subagentMapMaxItems+1)},
+		"bad reasoning":   {SlugPrefix: "p", PromptTemplate: "x", Items: []string{"a"}, Reasoning: "turbo"},
+		"worktree absent": {SlugPrefix: "p", PromptTemplate: "x", Items: []string{"a"}, Isolation: "worktree"},
+	} {
+		if out := runMapTool(t, tool, input, nil); out.Error == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestExpandMapTemplate(t *testing.T) {
+	if got := expandMapTemplate("do {{item}} ({{index}})", "x", 3); got != "do x (3)" {
+		t.Errorf("got %q", got)
+	}
+	if got := expandMapTemplate("do the thing", "x", 1); got != "do the thing\n\nItem: x" {
+		t.Errorf("got %q", got)
+	}
+	if got := truncateMapText("héllo", 2); got != "h..." {
+		t.Errorf("truncateMapText split a rune: %q", got)
+	}
+}
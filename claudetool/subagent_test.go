@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"shelley.exe.dev/llm"
 )
 
 // mockSubagentDB implements SubagentDB for testing.
 type mockSubagentDB struct {
+	mu            sync.Mutex
 	conversations map[string]string // slug -> conversationID
 }
 
@@ -20,6 +24,8 @@ func newMockSubagentDB() *mockSubagentDB {
 }
 
 func (m *mockSubagentDB) GetOrCreateSubagentConversation(ctx context.Context, slug, parentID, cwd string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	key := parentID + ":" + slug
 	if id, ok := m.conversations[key]; ok {
 		return id, slug, nil
@@ -345,3 +351,92 @@ func TestSubagentTool_ReasoningOverride_Invalid(t *testing.T) {
 		t.Errorf("expected error to mention invalid level, got %v", result.Error)
 	}
 }
+
+// mockWorktreeRunner is a mockSubagentRunner that also implements
+// SubagentWorktrees, recording the calls it gets.
+type mockWorktreeRunner struct {
+	mockSubagentRunner
+	calls []string
+}
+
+func (m *mockWorktreeRunner) RunSubagent(ctx context.Context, conversationID, prompt string, wait bool, timeout time.Duration, modelID, reasoning string) (string, error) {
+	m.calls = append(m.calls, "run "+conversationID)
+	return m.mockSubagentRunner.RunSubagent(ctx, conversationID, prompt, wait, timeout, modelID, reasoning)
+}
+
+func (m *mockWorktreeRunner) IsolateSubagent(ctx context.Context, conversationID, parentDir string) error {
+	m.calls = append(m.calls, "isolate "+conversationID+" "+parentDir)
+	return nil
+}
+
+func (m *mockWorktreeRunner) MergeSubagentWorktree(ctx context.Context, parentID, slug, parentDir string) (string, error) {
+	m.calls = append(m.calls, "merge "+parentID+" "+slug+" "+parentDir)
+	return "merged", nil
+}
+
+func (m *mockWorktreeRunner) DiscardSubagentWorktree(ctx context.Context, parentID, slug string) (string, error) {
+	m.calls = append(m.calls, "discard "+parentID+" "+slug)
+	return "discarded", nil
+}
+
+func TestSubagentTool_WorktreeIsolation(t *testing.T) {
+	runner := &mockWorktreeRunner{mockSubagentRunner: mockSubagentRunner{response: "OK"}}
+	tool := &SubagentTool{
+		DB:                   newMockSubagentDB(),
+		ParentConversationID: "parent-123",
+		WorkingDir:           NewMutableWorkingDir("/repo"),
+		Runner:               runner,
+	}
+	schemaJSON, _ := json.Marshal(tool.Tool().InputSchema)
+	if !strings.Contains(string(schemaJSON), `"worktree_action"`) {
+		t.Errorf("expected worktree properties in schema, got %s", schemaJSON)
+	}
+
+	run := func(input subagentInput) llm.ToolOut {
+		inputJSON, _ := json.Marshal(input)
+		return tool.Tool().Run(context.Background(), inputJSON)
+	}
+
+	if out := run(subagentInput{Slug: "fixer", Prompt: "fix it", Isolation: "worktree"}); out.Error != nil {
+		t.Fatalf("isolated run failed: %v", out.Error)
+	}
+	if out := run(subagentInput{Slug: "fixer", WorktreeAction: "merge"}); out.Error != nil {
+		t.Fatalf("merge failed: %v", out.Error)
+	}
+	if out := run(subagentInput{Slug: "fixer", WorktreeAction: "discard"}); out.Error != nil {
+		t.Fatalf("discard failed: %v", out.Error)
+	}
+	want := []string{
+		"isolate subagent-fixer /repo",
+		"run subagent-fixer",
+		"merge parent-123 fixer /repo",
+		"discard parent-123 fixer",
+	}
+	if strings.Join(runner.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls = %q, want %q", runner.calls, want)
+	}
+
+	if out := run(subagentInput{Slug: "fixer", Prompt: "x", Isolation: "container"}); out.Error == nil {
+		t.Error("expected error for unknown isolation")
+	}
+	if out := run(subagentInput{Slug: "fixer", WorktreeAction: "rebase"}); out.Error == nil {
+		t.Error("expected error for unknown worktree_action")
+	}
+}
+
+func TestSubagentTool_WorktreeIsolationUnsupported(t *testing.T) {
+	tool := &SubagentTool{
+		DB:                   newMockSubagentDB(),
+		ParentConversationID: "parent-123",
+		WorkingDir:           NewMutableWorkingDir("/tmp"),
+		Runner:               &mockSubagentRunner{response: "OK"},
+	}
+	schemaJSON, _ := json.Marshal(tool.Tool().InputSchema)
+	if strings.Contains(string(schemaJSON), `"isolation"`) {
+		t.Errorf("isolation should not be offered by a runner without worktrees: %s", schemaJSON)
+	}
+	inputJSON, _ := json.Marshal(subagentInput{Slug: "test", Prompt: "x", Isolation: "worktree"})
+	if out := tool.Tool().Run(context.Background(), inputJSON); out.Error == nil {
+		t.Error("expected error for worktree isolation without support")
+	}
+}
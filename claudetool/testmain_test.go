@@ -0,0 +1,14 @@
+package claudetool
+
+import (
+	"os"
+	"testing"
+
+	"shelley.exe.dev/claudetool/sandbox"
+)
+
+func TestMain(m *testing.M) {
+	// Sandboxed commands re-execute the test binary as their init process.
+	sandbox.Main()
+	os.Exit(m.Run())
+}
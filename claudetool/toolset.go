@@ -2,11 +2,18 @@ package claudetool
 
 import (
 	"context"
+	"log/slog"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 
+	"shelley.exe.dev/claudetool/approval"
 	"shelley.exe.dev/claudetool/browse"
+	"shelley.exe.dev/claudetool/lsp"
+	"shelley.exe.dev/claudetool/mcp"
+	"shelley.exe.dev/claudetool/sandbox"
+	"shelley.exe.dev/claudetool/scripttool"
 	"shelley.exe.dev/llm"
 )
 
@@ -61,6 +68,9 @@ type ToolSetConfig struct {
 	SubagentRunner SubagentRunner
 	// SubagentDB is the database for subagent conversations.
 	SubagentDB SubagentDB
+	// Scheduler stores scheduled conversations. If set, the schedule tool
+	// is available.
+	Scheduler Scheduler
 	// ParentConversationID is the ID of the parent conversation (for subagent tool).
 	ParentConversationID string
 	// ConversationID is the ID of the conversation these tools belong to.
@@ -91,6 +101,43 @@ type ToolSetConfig struct {
 	ToolOverrides map[string]string
 	// DisableAllTools disables every tool by default; ToolOverrides with "on" re-enable.
 	DisableAllTools bool
+	// MCPServers are the Model Context Protocol servers whose tools are
+	// offered to the conversation. Each ToolSet starts its own connections
+	// and closes them in Cleanup.
+	MCPServers []mcp.ServerConfig
+	// ApprovalPolicy, if set, returns the approval policy in force for this
+	// conversation. It is consulted before every bash, shell and patch call,
+	// so changes (such as "always allow" answers) apply immediately. A nil
+	// policy allows everything.
+	ApprovalPolicy func() *approval.Policy
+	// ApprovalGate asks the user about calls the policy marks "ask". Without
+	// a gate such calls are refused.
+	ApprovalGate approval.Gate
+	// Checkpoint, if set, records the prior state of files changed by patch
+	// and bash calls, so a conversation can later be rewound.
+	Checkpoint CheckpointFunc
+	// ScriptToolDirs are directories of script-defined tool manifests
+	// (normally ~/.config/shelley/tools; see package scripttool).
+	ScriptToolDirs []string
+	// LSPServers are the language servers the lsp tool may start (normally
+	// lsp.DefaultServers). The tool is only offered if there is at least one.
+	LSPServers []lsp.ServerConfig
+	// LSPDiagnosticsAfterPatch adds a language server's errors and warnings
+	// for the patched file to patch results, when the lsp tool is enabled.
+	LSPDiagnosticsAfterPatch bool
+	// Sandbox, if set and enabled, runs bash, shell and script tool
+	// commands in a sandbox whose writable paths include the current
+	// working directory. MCP and language servers are not sandboxed.
+	Sandbox *sandbox.Profile
+	// ProjectScriptTools also loads script tools from the .shelley/tools
+	// directories around WorkingDir. It is off by default, since it runs
+	// whatever a checked-out repository ships. Tools in ScriptToolDirs win
+	// over project tools of the same name.
+	ProjectScriptTools bool
+	// MaxParallelTools limits how many read-only tool calls from one
+	// response the conversation's loop runs at once; see
+	// loop.Config.MaxParallelTools.
+	MaxParallelTools int
 }
 
 // ToolSet holds a set of tools for a single conversation.
@@ -178,12 +225,15 @@ func NewToolSet(ctx context.Context, cfg ToolSetConfig) *ToolSet {
 
 	env := cfg.Env
 	env.ConversationID = cfg.ConversationID
+	box := sandbox.Follow(cfg.Sandbox, wd.Get)
 
 	bashTool := &BashTool{
 		WorkingDir:       wd,
 		LLMProvider:      cfg.LLMProvider,
 		EnableJITInstall: cfg.EnableJITInstall,
 		Env:              env,
+		Checkpoint:       cfg.Checkpoint,
+		Sandbox:          box,
 	}
 
 	// Use simplified patch schema for weaker models, full schema for sonnet/opus
@@ -192,6 +242,7 @@ func NewToolSet(ctx context.Context, cfg ToolSetConfig) *ToolSet {
 		Simplified:       simplified,
 		WorkingDir:       wd,
 		ClipboardEnabled: true,
+		Checkpoint:       cfg.Checkpoint,
 	}
 
 	keywordTool := NewKeywordToolWithWorkingDir(cfg.LLMProvider, wd)
@@ -209,6 +260,27 @@ func NewToolSet(ctx context.Context, cfg ToolSetConfig) *ToolSet {
 		EnableJITInstall: cfg.EnableJITInstall,
 		Env:              env,
 		BackgroundCtx:    ctx,
+		Sandbox:          box,
+	}
+
+	approvals := newApprovalChecker(cfg)
+	if approvals != nil {
+		bashTool.CheckPermission = approvals.commandCallback("bash")
+		shellTool.CheckPermission = approvals.commandCallback("shell")
+		patchTool.CheckPermission = approvals.pathCallback("patch")
+	}
+
+	var cleanups []func()
+	var lspTool *llm.Tool
+	if len(cfg.LSPServers) > 0 && IsToolEnabled("lsp", cfg.ToolOverrides, cfg.DisableAllTools) {
+		servers := lsp.NewManager(cfg.LSPServers, nil)
+		lspTool = servers.Tool(wd.Get)
+		if cfg.LSPDiagnosticsAfterPatch {
+			patchTool.Diagnostics = func(ctx context.Context, path string) string {
+				return servers.PatchDiagnostics(ctx, path, wd.Get())
+			}
+		}
+		cleanups = append(cleanups, servers.Close)
 	}
 
 	tools := []*llm.Tool{
@@ -219,6 +291,9 @@ func NewToolSet(ctx context.Context, cfg ToolSetConfig) *ToolSet {
 		changeDirTool.Tool(),
 		outputIframeTool.Tool(),
 	}
+	if lspTool != nil {
+		tools = append(tools, lspTool)
+	}
 
 	// Build the available models list (shared by subagent and llm_one_shot tools).
 	// Resolved fresh on each ToolSet construction so new conversations see
@@ -245,7 +320,17 @@ func NewToolSet(ctx context.Context, cfg ToolSetConfig) *ToolSet {
 			AvailableModels:      availableModels,
 			ParentReasoning:      cfg.ReasoningLevel,
 		}
-		tools = append(tools, subagentTool.Tool())
+		tools = append(tools, subagentTool.Tool(), subagentTool.MapTool())
+	}
+
+	if cfg.Scheduler != nil {
+		scheduleTool := &ScheduleTool{
+			Scheduler:      cfg.Scheduler,
+			ConversationID: cfg.ConversationID,
+			WorkingDir:     wd,
+			ModelID:        cfg.ModelID,
+		}
+		tools = append(tools, scheduleTool.Tool())
 	}
 
 	// Add LLM one-shot tool if LLM provider is configured
@@ -259,7 +344,6 @@ func NewToolSet(ctx context.Context, cfg ToolSetConfig) *ToolSet {
 		tools = append(tools, llmOneShotTool.Tool())
 	}
 
-	var cleanup func()
 	anyBrowserToolEnabled := false
 	for _, name := range []string{"browser", "read_image"} {
 		if IsToolEnabled(name, cfg.ToolOverrides, cfg.DisableAllTools) {
@@ -288,9 +372,18 @@ func NewToolSet(ctx context.Context, cfg ToolSetConfig) *ToolSet {
 				tools = append(tools, bt)
 			}
 		}
-		cleanup = browserCleanup
+		cleanups = append(cleanups, browserCleanup)
+	}
+
+	if servers := mcpServersToStart(cfg); len(servers) > 0 {
+		mcpTools, session := mcp.Start(ctx, servers, wd.Get(), nil)
+		RegisterDynamicTools(mcpTools)
+		tools = append(tools, mcpTools...)
+		cleanups = append(cleanups, session.Close)
 	}
 
+	tools = append(tools, scriptTools(cfg, wd, env, box, approvals, tools)...)
+
 	// Add server-side tools (e.g., web search for Anthropic models, or for
 	// OpenAI's Responses API).
 	if cfg.LLMProvider != nil && cfg.ModelID != "" {
@@ -301,8 +394,112 @@ func NewToolSet(ctx context.Context, cfg ToolSetConfig) *ToolSet {
 
 	tools = FilterTools(tools, cfg.ToolOverrides, cfg.DisableAllTools)
 	return &ToolSet{
-		tools:   tools,
-		cleanup: cleanup,
-		wd:      wd,
+		tools: tools,
+		cleanup: func() {
+			for _, c := range cleanups {
+				c()
+			}
+		},
+		wd: wd,
+	}
+}
+
+// DiscoverMCPTools starts each configured MCP server once, records its tools
+// in Registry and shuts it down again, so /api/tools can list MCP tools
+// before any conversation has started them.
+func DiscoverMCPTools(ctx context.Context, servers []mcp.ServerConfig, workingDir string) {
+	if len(servers) == 0 {
+		return
+	}
+	tools, session := mcp.Start(ctx, servers, workingDir, nil)
+	defer session.Close()
+	RegisterDynamicTools(tools)
+}
+
+// DiscoverScriptTools loads the server-wide script tools in dirs and
+// records them in Registry, so /api/tools can list them. Project tools are
+// never recorded there: they differ from one repository to the next, so
+// each ToolSet resolves its own.
+func DiscoverScriptTools(dirs []string) {
+	registerScriptTools(scripttool.Load(dirs, nil))
+}
+
+// scriptTools loads the script-defined tools for a conversation, skipping
+// any whose name is already taken by one of existing. Like bash, they run
+// in box and are subject to approvals, when those are set.
+func scriptTools(cfg ToolSetConfig, wd *MutableWorkingDir, env ShelleyEnv, box *sandbox.Sandbox, approvals *approvalChecker, existing []*llm.Tool) []*llm.Tool {
+	dirs := slices.Clone(cfg.ScriptToolDirs)
+	if cfg.ProjectScriptTools {
+		dirs = append(dirs, scripttool.ProjectDirs(wd.Get())...)
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, t := range existing {
+		taken[t.Name] = true
+	}
+	for _, t := range ToolRegistry {
+		taken[t.Name] = true
+	}
+	var loaded []scripttool.Tool
+	for _, t := range scripttool.Load(dirs, nil) {
+		if taken[t.Name] {
+			slog.Warn("script tools: name conflicts with another tool", "name", t.Name, "path", t.Manifest)
+			continue
+		}
+		if scriptToolEnabled(t, cfg) {
+			loaded = append(loaded, t)
+		}
+	}
+
+	opts := scripttool.Options{
+		WorkingDir: wd.Get,
+		Environ: func(cwd string) []string {
+			return append(stripShelleyEnv(os.Environ()), env.Environ(cwd)...)
+		},
+	}
+	if box != nil {
+		opts.Wrap = box.Wrap
+	}
+	tools := make([]*llm.Tool, 0, len(loaded))
+	for _, t := range loaded {
+		if approvals != nil {
+			opts.CheckPermission = approvals.toolCallback(t.Name)
+		}
+		tools = append(tools, t.LLMTool(opts))
+	}
+	return tools
+}
+
+// scriptToolEnabled is IsToolEnabled for a script tool, taking its default
+// from the manifest just loaded rather than from Registry.
+func scriptToolEnabled(t scripttool.Tool, cfg ToolSetConfig) bool {
+	switch cfg.ToolOverrides[t.Name] {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	return t.DefaultOn && !cfg.DisableAllTools
+}
+
+// mcpServersToStart returns the configured MCP servers, minus those whose
+// tools could not be enabled anyway: with DisableAllTools set, a server is
+// only worth launching if some override turns one of its tools back on.
+func mcpServersToStart(cfg ToolSetConfig) []mcp.ServerConfig {
+	if !cfg.DisableAllTools {
+		return cfg.MCPServers
+	}
+	var out []mcp.ServerConfig
+	for _, s := range cfg.MCPServers {
+		prefix := mcp.ServerPrefix(s.Name)
+		for name, v := range cfg.ToolOverrides {
+			if v == "on" && strings.HasPrefix(name, prefix) {
+				out = append(out, s)
+				break
+			}
+		}
 	}
+	return out
 }
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"shelley.exe.dev/claudetool/lsp"
 	"shelley.exe.dev/llm"
 )
 
@@ -657,3 +659,99 @@ func TestNewToolSet_WebSearchForAnthropicModels(t *testing.T) {
 		t.Error("web_search tool not found")
 	})
 }
+
+func TestNewToolSet_ScriptTools(t *testing.T) {
+	userDir := t.TempDir()
+	cwd := t.TempDir()
+	projectDir := filepath.Join(cwd, ".shelley", "tools")
+	write := func(path, content string, mode os.FileMode) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(userDir, "st_greet.json"), `{"name": "st_greet", "description": "Greet."}`, 0o644)
+	write(filepath.Join(userDir, "st_greet"), "#!/bin/sh\necho hello from $SHELLEY_CONVERSATION_ID\n", 0o755)
+	write(filepath.Join(userDir, "bash.json"), `{"name": "bash", "description": "Shadow bash.", "command": "st_greet"}`, 0o644)
+	write(filepath.Join(projectDir, "st_deploy.yaml"), "name: st_deploy\ndescription: Deploy.\ncommand: /bin/true\ndefault_on: false\n", 0o644)
+
+	names := func(cfg ToolSetConfig) map[string]*llm.Tool {
+		ts := NewToolSet(context.Background(), cfg)
+		defer ts.Cleanup()
+		out := make(map[string]*llm.Tool)
+		for _, tool := range ts.Tools() {
+			out[tool.Name] = tool
+		}
+		return out
+	}
+	cfg := ToolSetConfig{WorkingDir: cwd, ConversationID: "c-1", ScriptToolDirs: []string{userDir}, ProjectScriptTools: true}
+
+	tools := names(cfg)
+	greet := tools["st_greet"]
+	if greet == nil {
+		t.Fatal("user script tool not loaded")
+	}
+	if _, ok := tools["st_deploy"]; ok {
+		t.Error("default-off project tool should need an override")
+	}
+	if strings.Contains(tools["bash"].Description, "Shadow") {
+		t.Error("a script tool must not replace a built-in tool")
+	}
+	out := greet.Run(context.Background(), nil)
+	if out.Error != nil || out.LLMContent[0].Text != "hello from c-1" {
+		t.Errorf("st_greet = %+v, %v", out.LLMContent, out.Error)
+	}
+
+	cfg.ToolOverrides = map[string]string{"st_deploy": "on", "st_greet": "off"}
+	tools = names(cfg)
+	if _, ok := tools["st_deploy"]; !ok {
+		t.Error("override should enable the project tool")
+	}
+	if _, ok := tools["st_greet"]; ok {
+		t.Error("override should disable the user tool")
+	}
+
+	// Project tools stay out of the process-wide registry, so they cannot
+	// leak into conversations in other repositories.
+	for _, ti := range Registry() {
+		if ti.Name == "st_deploy" {
+			t.Errorf("project tool registered: %+v", ti)
+		}
+	}
+	cfg.WorkingDir = t.TempDir()
+	if _, ok := names(cfg)["st_deploy"]; ok {
+		t.Error("project tool offered in another repository")
+	}
+}
+
+func TestNewToolSet_LSP(t *testing.T) {
+	hasTool := func(ts *ToolSet, name string) bool {
+		for _, tool := range ts.Tools() {
+			if tool.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	ts := NewToolSet(context.Background(), ToolSetConfig{WorkingDir: t.TempDir()})
+	defer ts.Cleanup()
+	if hasTool(ts, "lsp") {
+		t.Error("lsp tool offered without any language servers")
+	}
+
+	servers := []lsp.ServerConfig{{Language: "go", Command: "gopls", Extensions: []string{".go"}, RootMarkers: []string{"go.mod"}}}
+	ts = NewToolSet(context.Background(), ToolSetConfig{WorkingDir: t.TempDir(), LSPServers: servers, LSPDiagnosticsAfterPatch: true})
+	defer ts.Cleanup()
+	if !hasTool(ts, "lsp") {
+		t.Error("lsp tool missing")
+	}
+
+	ts = NewToolSet(context.Background(), ToolSetConfig{WorkingDir: t.TempDir(), LSPServers: servers, ToolOverrides: map[string]string{"lsp": "off"}})
+	defer ts.Cleanup()
+	if hasTool(ts, "lsp") {
+		t.Error("lsp tool offered despite the override")
+	}
+}
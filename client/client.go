@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -118,6 +119,8 @@ func Run(args []string) {
 		fmt.Fprintf(fs.Output(), "  list     List conversations\n")
 		fmt.Fprintf(fs.Output(), "  search   Search conversations by content\n")
 		fmt.Fprintf(fs.Output(), "  archive  Archive a conversation\n")
+		fmt.Fprintf(fs.Output(), "  export   Export a conversation transcript\n")
+		fmt.Fprintf(fs.Output(), "  import   Import a conversation (JSON export, Claude Code or Codex log)\n")
 		fmt.Fprintf(fs.Output(), "  help     Print detailed help\n")
 	}
 	fs.Parse(args)
@@ -151,6 +154,10 @@ func Run(args []string) {
 		cmdSearch(cc, subArgs[1:])
 	case "archive":
 		cmdArchive(cc, subArgs[1:])
+	case "export":
+		cmdExport(cc, subArgs[1:])
+	case "import":
+		cmdImport(cc, subArgs[1:])
 	case "help":
 		cmdHelp()
 	default:
@@ -627,6 +634,122 @@ func cmdArchive(cc *clientConfig, args []string) {
 	fmt.Fprintf(os.Stderr, "Archived %s\n", conversationID)
 }
 
+func cmdExport(cc *clientConfig, args []string) {
+	fs := flag.NewFlagSet("client export", flag.ExitOnError)
+	format := fs.String("format", "markdown", "Transcript format: markdown, json or html")
+	output := fs.String("o", "", "Write to FILE instead of stdout")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: shelley client export [-format markdown|json|html] [-o FILE] CONVERSATION_ID\n")
+		os.Exit(1)
+	}
+	conversationID := fs.Arg(0)
+
+	client, baseURL, err := cc.newHTTPClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	u := baseURL + "/api/conversation/" + conversationID + "/export?format=" + url.QueryEscape(*format)
+	req, err := cc.newRequest("GET", u, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating request: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: HTTP %d: %s\n", resp.StatusCode, strings.TrimSpace(string(body)))
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func cmdImport(cc *clientConfig, args []string) {
+	fs := flag.NewFlagSet("client import", flag.ExitOnError)
+	format := fs.String("format", "", "Input format: shelley, claude-code or codex (default: detect)")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: shelley client import [-format shelley|claude-code|codex] FILE (or - for stdin)\n")
+		os.Exit(1)
+	}
+
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, baseURL, err := cc.newHTTPClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	u := baseURL + "/api/conversations/import"
+	if *format != "" {
+		u += "?format=" + url.QueryEscape(*format)
+	}
+	req, err := cc.newRequest("POST", u, strings.NewReader(string(data)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating request: %v\n", err)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: HTTP %d: %s\n", resp.StatusCode, strings.TrimSpace(string(body)))
+		os.Exit(1)
+	}
+
+	var conv struct {
+		ConversationID string  `json:"conversation_id"`
+		Slug           *string `json:"slug"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&conv); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+	json.NewEncoder(os.Stdout).Encode(conv)
+}
+
 // --- Wire types for JSON parsing ---
 
 type streamResponseWire struct {
@@ -733,6 +856,16 @@ Subcommands:
   archive CONVERSATION_ID
       Archive a conversation.
 
+  export [-format markdown|json|html] [-o FILE] CONVERSATION_ID
+      Export a conversation transcript, subagents included.
+      The json format can be imported back with "import".
+
+  import [-format shelley|claude-code|codex] FILE
+      Recreate a conversation from a JSON export, or from a Claude Code
+      or Codex JSONL session log (- reads stdin). The format is detected
+      unless given. The conversation gets new ids. Prints JSON with
+      conversation_id.
+
   help
       Print this help text.
 
@@ -750,6 +883,12 @@ Examples:
   # Read current state
   shelley client read "$ID"
 
+  # Bring a Claude Code session into Shelley
+  shelley client import ~/.claude/projects/-home-me-src-app/SESSION.jsonl
+
+  # Copy a conversation to another server
+  shelley client export -format json "$ID" | shelley client -url http://other:9999 import -
+
 NOTE: This feature is EXPERIMENTAL and may change without notice.
 `, DefaultSocketPath())
 }
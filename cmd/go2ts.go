@@ -101,9 +101,10 @@ type apiMessageForTS struct {
 }
 
 type conversationStateForTS struct {
-	ConversationID string `json:"conversation_id"`
-	Working        bool   `json:"working"`
-	Model          string `json:"model,omitempty"`
+	ConversationID   string                 `json:"conversation_id"`
+	Working          bool                   `json:"working"`
+	Model            string                 `json:"model,omitempty"`
+	PendingApprovals []approvalRequestForTS `json:"pending_approvals,omitempty"`
 }
 
 type conversationWithStateForTS struct {
@@ -144,6 +145,17 @@ type streamResponseForTS struct {
 	Heartbeat         bool                    `json:"heartbeat,omitempty"`
 	NotificationEvent *notificationEventForTS `json:"notification_event,omitempty"`
 	MaxSequenceID     int64                   `json:"max_sequence_id,omitempty"`
+	ApprovalRequest   *approvalRequestForTS   `json:"approval_request,omitempty"`
+}
+
+type approvalRequestForTS struct {
+	ID        string   `json:"id"`
+	ToolUseID string   `json:"tool_use_id,omitempty"`
+	Tool      string   `json:"tool"`
+	Command   string   `json:"command,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	Input     string   `json:"input,omitempty"`
+	Subjects  []string `json:"subjects,omitempty"`
 }
 
 type notificationEventForTS struct {
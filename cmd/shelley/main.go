@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"flag"
@@ -11,11 +12,19 @@ import (
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/claudetool/approval"
+	"shelley.exe.dev/claudetool/lsp"
+	"shelley.exe.dev/claudetool/mcp"
+	"shelley.exe.dev/claudetool/sandbox"
+	"shelley.exe.dev/claudetool/scripttool"
 	"shelley.exe.dev/client"
 	"shelley.exe.dev/db"
 	"shelley.exe.dev/exeenv"
+	"shelley.exe.dev/llm/ant"
+	"shelley.exe.dev/llm/cassette"
 	"shelley.exe.dev/llm/llmhttp"
 	"shelley.exe.dev/models"
 	"shelley.exe.dev/modelsources"
@@ -40,6 +49,37 @@ type shelleyConfig struct {
 	LLMGateway     string                `json:"llm_gateway"`
 	DefaultModel   string                `json:"default_model"`
 	ExeEnvironment *exeEnvironmentConfig `json:"exe_environment"`
+	// AutoCompact sets the server-wide automatic compaction defaults;
+	// conversations can override them in their options.
+	AutoCompact *db.AutoCompactOptions `json:"auto_compact"`
+	// Budget and SubagentBudget set the server-wide budgets of top-level
+	// and subagent conversations; conversations can override them in
+	// their options.
+	Budget         *db.BudgetOptions `json:"budget"`
+	SubagentBudget *db.BudgetOptions `json:"subagent_budget"`
+	// MaxParallelTools limits how many read-only tool calls from one
+	// response run at once; see loop.Config.MaxParallelTools.
+	MaxParallelTools int `json:"max_parallel_tools"`
+	// ProjectScriptTools loads script tools from the .shelley/tools
+	// directories of the repositories conversations work in. Off by
+	// default: those tools run whatever a checkout ships.
+	ProjectScriptTools bool `json:"project_script_tools"`
+	// ApprovalTimeout is how long a tool call waits for an answer to its
+	// approval request before it is rejected, in Go duration syntax
+	// ("10m"). Empty means server.Server's default.
+	ApprovalTimeout string `json:"approval_timeout"`
+	// LLMMaxInFlight limits how many requests to one model run at once;
+	// see llmhttp.Governor. Zero means llmhttp.DefaultMaxInFlight.
+	LLMMaxInFlight int `json:"llm_max_in_flight"`
+	// ModelFallbacks sets the models to switch to when a model keeps
+	// failing with retryable errors.
+	ModelFallbacks *server.ModelFallbacks `json:"model_fallbacks"`
+	// Bedrock and Vertex serve Anthropic models through Amazon Bedrock
+	// and Google Vertex AI.
+	Bedrock *modelsources.BedrockConfig `json:"bedrock"`
+	Vertex  *modelsources.VertexConfig  `json:"vertex"`
+	// Ollama serves the tool-capable models installed on an Ollama server.
+	Ollama *modelsources.OllamaConfig `json:"ollama"`
 }
 
 type exeEnvironmentConfig struct {
@@ -49,6 +89,8 @@ type exeEnvironmentConfig struct {
 
 var discoverLLMIntegrations = modelsources.DiscoverLLMIntegrations
 
+var discoverOllama = modelsources.DiscoverOllama
+
 // registerGlobalFlags binds the process-wide global flags onto fs, writing into
 // global. Extracted from main so tests can parse flags through a fresh FlagSet
 // and assert defaults (notably that -default-model defaults to empty, which is
@@ -64,6 +106,10 @@ func registerGlobalFlags(fs *flag.FlagSet, global *GlobalConfig) {
 }
 
 func main() {
+	// Sandboxed bash and shell commands re-execute this binary as the
+	// sandbox's init process; see package sandbox.
+	sandbox.Main()
+
 	// Define global flags
 	var global GlobalConfig
 	registerGlobalFlags(flag.CommandLine, &global)
@@ -177,6 +223,8 @@ func runServe(global GlobalConfig, args []string) {
 	requireHeader := fs.String("require-header", "", "Require this header on all API requests (e.g., X-Exedev-Userid)")
 	socketPath := fs.String("socket", client.DefaultSocketPath(), "Path to Unix socket for local CLI client access (set to 'none' to disable)")
 	banner := fs.String("banner", "", "If set, shows this text in a banner at the top of the UI (useful for marking demo instances)")
+	cassettePath := fs.String("llm-cassette", "", "Record LLM requests and responses to this cassette file, or replay them from it (see -llm-cassette-mode)")
+	cassetteMode := fs.String("llm-cassette-mode", "record", "What to do with -llm-cassette: record or replay")
 	fs.Parse(args)
 
 	logger := setupLogging(global.Debug)
@@ -196,17 +244,58 @@ func runServe(global GlobalConfig, args []string) {
 
 	// Initialize LLM service manager (includes custom model support via database)
 	llmManager := server.NewLLMServiceManager(llmConfig)
+	if *cassettePath != "" {
+		mode, err := cassette.ParseMode(*cassetteMode)
+		if err != nil {
+			logger.Error("Invalid -llm-cassette-mode", "error", err)
+			os.Exit(1)
+		}
+		llmCassette, err := cassette.Open(*cassettePath, mode)
+		if err != nil {
+			logger.Error("Failed to open LLM cassette", "path", *cassettePath, "error", err)
+			os.Exit(1)
+		}
+		defer llmCassette.Close()
+		llmManager = server.NewCassetteLLMProvider(llmManager, llmCassette)
+		logger.Info("Using LLM cassette", "path", *cassettePath, "mode", *cassetteMode)
+	}
 
 	// Log available models
 	availableModels := llmManager.GetAvailableModels()
 	logger.Info("Available models", "models", strings.Join(availableModels, ", "))
 
+	// buildLLMConfig has already reported a bad config file.
+	config, _ := loadConfig(global.ConfigPath)
+
 	toolSetConfig := setupToolSetConfig(llmManager, llmManager)
+	toolSetConfig.MaxParallelTools = config.MaxParallelTools
+	toolSetConfig.ProjectScriptTools = config.ProjectScriptTools
+	go claudetool.DiscoverMCPTools(context.Background(), toolSetConfig.MCPServers, toolSetConfig.WorkingDir)
+	claudetool.DiscoverScriptTools(toolSetConfig.ScriptToolDirs)
 
 	// Create server
 	svr := server.NewServer(database, llmManager, toolSetConfig, logger, global.PredictableOnly, llmConfig.DefaultModel, *requireHeader)
 	svr.SetModelRefresher(llmConfig.RefreshBuiltModels)
+	if config.Ollama != nil && len(config.Ollama.Pull) > 0 {
+		go pullOllamaModels(svr, *config.Ollama, logger)
+	}
 	svr.Banner = *banner
+	if config.AutoCompact != nil {
+		svr.AutoCompact = *config.AutoCompact
+	}
+	if config.Budget != nil {
+		svr.Budget = *config.Budget
+	}
+	if config.SubagentBudget != nil {
+		svr.SubagentBudget = *config.SubagentBudget
+	}
+	if config.ModelFallbacks != nil {
+		svr.ModelFallbacks = *config.ModelFallbacks
+	}
+	if config.ApprovalTimeout != "" {
+		// loadConfig has validated it.
+		svr.ApprovalTimeout, _ = time.ParseDuration(config.ApprovalTimeout)
+	}
 
 	// Load notification channels from DB.
 	svr.ReloadNotificationChannels()
@@ -391,12 +480,40 @@ func setupToolSetConfig(llmProvider claudetool.LLMServiceProvider, llmManager se
 		return out
 	}
 
+	mcpServers, err := mcp.LoadConfig(mcp.DefaultConfigPath())
+	if err != nil {
+		slog.Warn("Ignoring MCP server config", "error", err)
+	}
+
+	var scriptToolDirs []string
+	if dir := scripttool.DefaultDir(); dir != "" {
+		scriptToolDirs = append(scriptToolDirs, dir)
+	}
+
+	sandboxProfile, err := sandbox.LoadProfile(sandbox.DefaultProfilePath())
+	if err != nil {
+		slog.Warn("Ignoring sandbox profile", "error", err)
+	}
+
+	var approvalPolicy func() *approval.Policy
+	if p, err := approval.LoadPolicy(approval.DefaultPolicyPath()); err != nil {
+		slog.Warn("Ignoring approval policy", "error", err)
+	} else if p != nil {
+		approvalPolicy = func() *approval.Policy { return p }
+	}
+
 	return claudetool.ToolSetConfig{
-		WorkingDir:           wd,
-		LLMProvider:          llmProvider,
-		EnableJITInstall:     claudetool.EnableBashToolJITInstall,
-		EnableBrowser:        true,
-		BuildAvailableModels: buildAvailableModels,
+		WorkingDir:               wd,
+		LLMProvider:              llmProvider,
+		EnableJITInstall:         claudetool.EnableBashToolJITInstall,
+		EnableBrowser:            true,
+		BuildAvailableModels:     buildAvailableModels,
+		MCPServers:               mcpServers,
+		ApprovalPolicy:           approvalPolicy,
+		ScriptToolDirs:           scriptToolDirs,
+		LSPServers:               lsp.DefaultServers(),
+		LSPDiagnosticsAfterPatch: true,
+		Sandbox:                  sandboxProfile,
 	}
 }
 
@@ -412,7 +529,8 @@ func setupToolSetConfig(llmProvider claudetool.LLMServiceProvider, llmManager se
 //     provider env var overrides the gateway's implicit credential for
 //     that provider (legacy behavior).
 //  3. Provider env vars (ANTHROPIC_API_KEY, ...) when no gateway is set.
-//  4. Predictable (always available).
+//  4. The models installed on shelley.json's ollama server, if set.
+//  5. Predictable (always available).
 //
 // Custom DB-backed models load on top of the returned set.
 func buildLLMConfig(global GlobalConfig, logger *slog.Logger, database *db.DB) (*server.LLMConfig, error) {
@@ -430,6 +548,9 @@ func buildLLMConfig(global GlobalConfig, logger *slog.Logger, database *db.DB) (
 
 	defaultModel, sources := buildLLMModelSources(context.Background(), global, config, logger)
 
+	if config.LLMMaxInFlight > 0 {
+		llmhttp.DefaultGovernor.SetMaxInFlight(config.LLMMaxInFlight)
+	}
 	httpc := llmhttp.NewClient(nil)
 	return &server.LLMConfig{
 		Models:       modelsources.Build(models.All(), sources, httpc, logger),
@@ -459,9 +580,54 @@ func loadConfig(path string) (shelleyConfig, error) {
 	if err := json.Unmarshal(data, &config); err != nil {
 		return shelleyConfig{}, fmt.Errorf("parse config file: %w", err)
 	}
+	if err := config.AutoCompact.Validate(); err != nil {
+		return shelleyConfig{}, fmt.Errorf("config file: %w", err)
+	}
+	if err := config.Budget.Validate(); err != nil {
+		return shelleyConfig{}, fmt.Errorf("config file: %w", err)
+	}
+	if err := config.SubagentBudget.Validate(); err != nil {
+		return shelleyConfig{}, fmt.Errorf("config file: subagent_%w", err)
+	}
+	if config.MaxParallelTools < 0 {
+		return shelleyConfig{}, fmt.Errorf("config file: max_parallel_tools must not be negative, got %d", config.MaxParallelTools)
+	}
+	if config.LLMMaxInFlight < 0 {
+		return shelleyConfig{}, fmt.Errorf("config file: llm_max_in_flight must not be negative, got %d", config.LLMMaxInFlight)
+	}
+	if err := config.ModelFallbacks.Validate(); err != nil {
+		return shelleyConfig{}, fmt.Errorf("config file: %w", err)
+	}
+	if config.Bedrock != nil && config.Bedrock.Region == "" && ant.BedrockRegion(config.Bedrock.URL) == "" {
+		return shelleyConfig{}, fmt.Errorf("config file: bedrock needs a region")
+	}
+	if config.Vertex != nil && config.Vertex.Region == "" {
+		return shelleyConfig{}, fmt.Errorf("config file: vertex needs a region")
+	}
+	if config.ApprovalTimeout != "" {
+		if d, err := time.ParseDuration(config.ApprovalTimeout); err != nil || d <= 0 {
+			return shelleyConfig{}, fmt.Errorf("config file: approval_timeout must be a positive duration like \"10m\", got %q", config.ApprovalTimeout)
+		}
+	}
+	if config.Ollama != nil && config.Ollama.NumCtx < 0 {
+		return shelleyConfig{}, fmt.Errorf("config file: ollama num_ctx must not be negative, got %d", config.Ollama.NumCtx)
+	}
 	return config, nil
 }
 
+// pullOllamaModels downloads the Ollama models shelley.json asks for and
+// refreshes the model list once any arrive, so the server need not wait
+// for them before listening.
+func pullOllamaModels(svr *server.Server, config modelsources.OllamaConfig, logger *slog.Logger) {
+	ctx := context.Background()
+	if !modelsources.PullOllama(ctx, config, nil, logger) {
+		return
+	}
+	if err := svr.RefreshModels(ctx); err != nil {
+		logger.Warn("Failed to refresh models after pulling Ollama models", "error", err)
+	}
+}
+
 func buildLLMModelSources(ctx context.Context, global GlobalConfig, config shelleyConfig, logger *slog.Logger) (string, []modelsources.Source) {
 	defaultModel := global.DefaultModel
 	anthropicKey := os.Getenv("ANTHROPIC_API_KEY")
@@ -521,11 +687,55 @@ func buildLLMModelSources(ctx context.Context, global GlobalConfig, config shell
 		sources = append(sources, modelsources.Env(anthropicKey, openAIKey, geminiKey, fireworksKey))
 	}
 
-	// 4. Predictable always available.
+	// 4. Anthropic models through Amazon Bedrock and Google Vertex AI.
+	if config.Bedrock != nil {
+		if creds := ant.AWSCredentialsFromEnv(); creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			logger.Warn("Skipping Bedrock: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+		} else {
+			sources = append(sources, modelsources.Bedrock(*config.Bedrock, creds))
+		}
+	}
+	if config.Vertex != nil {
+		if account, err := loadVertexAccount(*config.Vertex); err != nil {
+			logger.Error("Skipping Vertex AI", "error", err)
+		} else {
+			sources = append(sources, modelsources.Vertex(*config.Vertex, account))
+		}
+	}
+
+	// 5. Models installed on a configured Ollama server.
+	if config.Ollama != nil {
+		if host := discoverOllama(ctx, *config.Ollama, nil, logger); host != nil {
+			sources = append(sources, modelsources.Ollama(host))
+		}
+	}
+
+	// 6. Predictable always available.
 	sources = append(sources, modelsources.Predictable())
 	return defaultModel, sources
 }
 
+// loadVertexAccount reads the service account Vertex AI requests are
+// authenticated as.
+func loadVertexAccount(config modelsources.VertexConfig) (*ant.GoogleServiceAccount, error) {
+	path := cmp.Or(config.CredentialsFile, os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	if path == "" {
+		return nil, fmt.Errorf("no credentials_file and GOOGLE_APPLICATION_CREDENTIALS is not set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	account, err := ant.ParseGoogleServiceAccount(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if config.Project == "" && account.ProjectID == "" {
+		return nil, fmt.Errorf("%s: no project_id; set the project in the vertex config", path)
+	}
+	return account, nil
+}
+
 func modelsCommandDefaultID(configured string, modelList []models.Built, predictableOnly bool) string {
 	visible := func(model models.Built) bool {
 		return (model.ID == "predictable") == predictableOnly
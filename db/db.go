@@ -281,6 +281,150 @@ type ConversationOptions struct {
 	// discord, ntfy) for this conversation. Useful for cron-style or
 	// self-invoked conversations that shouldn't ping the user.
 	DisableNotifications bool `json:"disable_notifications,omitempty"`
+	// ApprovalPolicy overrides the server-wide approval policy for bash,
+	// shell and patch calls in this conversation. Nil means use the server's.
+	ApprovalPolicy *ApprovalPolicy `json:"approval_policy,omitempty"`
+	// ApprovalAllowRules records "always allow for this conversation"
+	// answers. They are evaluated ahead of the policy's own rules.
+	ApprovalAllowRules []ApprovalRule `json:"approval_allow_rules,omitempty"`
+	// AutoCompact overrides the server-wide automatic compaction settings
+	// for this conversation. Nil means use the server's.
+	AutoCompact *AutoCompactOptions `json:"auto_compact,omitempty"`
+	// Sandbox overrides the server-wide sandbox profile for bash and shell
+	// commands in this conversation and its subagents. Nil means use the
+	// parent conversation's, or the server's.
+	Sandbox *SandboxProfile `json:"sandbox,omitempty"`
+	// Budget overrides the server-wide spending limits for this
+	// conversation. Nil means use the server's.
+	Budget *BudgetOptions `json:"budget,omitempty"`
+}
+
+// ApprovalPolicy is the stored form of an approval policy. It has the same
+// JSON shape as approval.Policy; the server converts between the two.
+type ApprovalPolicy struct {
+	// Default is "allow", "ask" or "deny". Empty means allow.
+	Default string         `json:"default,omitempty"`
+	Rules   []ApprovalRule `json:"rules,omitempty"`
+}
+
+// SandboxProfile is the stored form of a sandbox profile. It has the same
+// JSON shape as sandbox.Profile; the server converts between the two.
+type SandboxProfile struct {
+	Enabled   bool     `json:"enabled"`
+	NoNetwork bool     `json:"no_network,omitempty"`
+	Writable  []string `json:"writable,omitempty"`
+	Hidden    []string `json:"hidden,omitempty"`
+}
+
+// ApprovalRule is the stored form of an approval.Rule.
+type ApprovalRule struct {
+	Tool     string `json:"tool,omitempty"`
+	Command  string `json:"command,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Decision string `json:"decision"`
+}
+
+// AutoCompactOptions configures automatic compaction: when a response
+// reports that the context window is filling up, older history is summarized
+// into a new generation and the turn continues there. Zero fields inherit
+// the server-wide setting (or the built-in default).
+type AutoCompactOptions struct {
+	// Enabled switches automatic compaction on or off. Nil inherits.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Threshold is the fraction of the model's context window, in (0, 1],
+	// at which compaction starts.
+	Threshold float64 `json:"threshold,omitempty"`
+	// KeepRecentTokens is roughly how much recent history is carried into
+	// the new generation verbatim rather than summarized. It also applies
+	// to compactions the user starts.
+	KeepRecentTokens int `json:"keep_recent_tokens,omitempty"`
+}
+
+// Validate reports out-of-range settings.
+func (o *AutoCompactOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Threshold < 0 || o.Threshold > 1 {
+		return fmt.Errorf("auto_compact.threshold must be between 0 and 1, got %v", o.Threshold)
+	}
+	if o.KeepRecentTokens < 0 {
+		return fmt.Errorf("auto_compact.keep_recent_tokens must not be negative, got %d", o.KeepRecentTokens)
+	}
+	return nil
+}
+
+// Over returns o with its unset fields taken from base.
+func (o *AutoCompactOptions) Over(base AutoCompactOptions) AutoCompactOptions {
+	if o == nil {
+		return base
+	}
+	out := *o
+	if out.Enabled == nil {
+		out.Enabled = base.Enabled
+	}
+	if out.Threshold == 0 {
+		out.Threshold = base.Threshold
+	}
+	if out.KeepRecentTokens == 0 {
+		out.KeepRecentTokens = base.KeepRecentTokens
+	}
+	return out
+}
+
+// BudgetOptions caps what a conversation may spend. A conversation's
+// spending includes its subagents', so their usage counts against every
+// ancestor's budget too. Zero fields are unlimited, or inherit when the
+// options override server-wide ones.
+type BudgetOptions struct {
+	// MaxInputTokens caps input tokens, cache reads and writes included.
+	MaxInputTokens int64 `json:"max_input_tokens,omitempty"`
+	// MaxOutputTokens caps output tokens.
+	MaxOutputTokens int64 `json:"max_output_tokens,omitempty"`
+	// MaxCostUSD caps the cost in US dollars: as reported by the LLM
+	// gateway where it does, else estimated from models.dev pricing.
+	MaxCostUSD float64 `json:"max_cost_usd,omitempty"`
+	// MaxRoundsPerTurn caps the LLM requests in a single turn.
+	MaxRoundsPerTurn int `json:"max_rounds_per_turn,omitempty"`
+}
+
+// Validate reports negative limits.
+func (o *BudgetOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	switch {
+	case o.MaxInputTokens < 0:
+		return fmt.Errorf("budget.max_input_tokens must not be negative, got %d", o.MaxInputTokens)
+	case o.MaxOutputTokens < 0:
+		return fmt.Errorf("budget.max_output_tokens must not be negative, got %d", o.MaxOutputTokens)
+	case o.MaxCostUSD < 0:
+		return fmt.Errorf("budget.max_cost_usd must not be negative, got %v", o.MaxCostUSD)
+	case o.MaxRoundsPerTurn < 0:
+		return fmt.Errorf("budget.max_rounds_per_turn must not be negative, got %d", o.MaxRoundsPerTurn)
+	}
+	return nil
+}
+
+// Over returns o with its unset fields taken from base.
+func (o *BudgetOptions) Over(base BudgetOptions) BudgetOptions {
+	if o == nil {
+		return base
+	}
+	out := *o
+	if out.MaxInputTokens == 0 {
+		out.MaxInputTokens = base.MaxInputTokens
+	}
+	if out.MaxOutputTokens == 0 {
+		out.MaxOutputTokens = base.MaxOutputTokens
+	}
+	if out.MaxCostUSD == 0 {
+		out.MaxCostUSD = base.MaxCostUSD
+	}
+	if out.MaxRoundsPerTurn == 0 {
+		out.MaxRoundsPerTurn = base.MaxRoundsPerTurn
+	}
+	return out
 }
 
 // ParseConversationOptions parses a JSON string into ConversationOptions.
@@ -1845,11 +1989,556 @@ func (db *DB) ForkConversation(ctx context.Context, sourceConversationID string,
 		}); err != nil {
 			return fmt.Errorf("failed to copy messages: %w", err)
 		}
+		if err := q.CopyFileCheckpoints(ctx, generated.CopyFileCheckpointsParams{
+			SourceConversationID: sourceConversationID,
+			BeforeSequenceID:     cutoffSequenceID + 1,
+			DestConversationID:   conversationID,
+			DestGeneration:       1,
+		}); err != nil {
+			return fmt.Errorf("failed to copy file checkpoints: %w", err)
+		}
 		return nil
 	})
 	return &conversation, err
 }
 
+// ImportConversationParams describes a conversation for ImportConversation.
+type ImportConversationParams struct {
+	Slug                *string
+	Cwd                 *string
+	Model               *string
+	ConversationOptions string
+	Tags                []string
+	// Messages are in conversation order. Their ConversationID is ignored.
+	Messages  []ImportedMessage
+	Subagents []ImportConversationParams
+}
+
+// ImportedMessage is a message of an imported conversation: its contents,
+// and the generation it belongs to, counted from 1.
+type ImportedMessage struct {
+	CreateMessageParams
+	Generation int64
+}
+
+// ImportConversation recreates a conversation, and its subagents as
+// subagents of it, in one transaction. Conversations and messages get new
+// ids and sequence ids; messages keep their generation and CreatedAt. A slug
+// already in use gets an "-imported" suffix. Returns the top-level
+// conversation.
+func (db *DB) ImportConversation(ctx context.Context, params ImportConversationParams) (*generated.Conversation, error) {
+	var conversation generated.Conversation
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		conversation, err = importConversationTx(ctx, generated.New(tx.Conn()), params, nil)
+		return err
+	})
+	return &conversation, err
+}
+
+func importConversationTx(ctx context.Context, q *generated.Queries, params ImportConversationParams, parentID *string) (generated.Conversation, error) {
+	conversationID, err := generateConversationID()
+	if err != nil {
+		return generated.Conversation{}, fmt.Errorf("failed to generate conversation ID: %w", err)
+	}
+	slug, err := freeImportSlug(ctx, q, params.Slug)
+	if err != nil {
+		return generated.Conversation{}, err
+	}
+	options := params.ConversationOptions
+	if options == "" {
+		options = "{}"
+	}
+	conversation, err := q.CreateConversation(ctx, generated.CreateConversationParams{
+		ConversationID:      conversationID,
+		Slug:                slug,
+		UserInitiated:       parentID == nil,
+		Cwd:                 params.Cwd,
+		Model:               params.Model,
+		ConversationOptions: options,
+	})
+	if err != nil {
+		return generated.Conversation{}, fmt.Errorf("failed to create conversation: %w", err)
+	}
+	if parentID != nil {
+		conversation, err = q.UpdateConversationParent(ctx, generated.UpdateConversationParentParams{
+			ParentConversationID: parentID,
+			ConversationID:       conversationID,
+		})
+		if err != nil {
+			return generated.Conversation{}, fmt.Errorf("failed to set parent: %w", err)
+		}
+	}
+	if len(params.Tags) > 0 {
+		tagsJSON, err := json.Marshal(params.Tags)
+		if err != nil {
+			return generated.Conversation{}, fmt.Errorf("failed to marshal tags: %w", err)
+		}
+		conversation, err = q.UpdateConversationTags(ctx, generated.UpdateConversationTagsParams{
+			Tags:           string(tagsJSON),
+			ConversationID: conversationID,
+		})
+		if err != nil {
+			return generated.Conversation{}, fmt.Errorf("failed to set tags: %w", err)
+		}
+	}
+	for _, m := range params.Messages {
+		if m.Generation > conversation.CurrentGeneration {
+			conversation, err = q.SetConversationGeneration(ctx, generated.SetConversationGenerationParams{
+				CurrentGeneration: m.Generation,
+				ConversationID:    conversationID,
+			})
+			if err != nil {
+				return generated.Conversation{}, fmt.Errorf("failed to start generation: %w", err)
+			}
+		}
+		m.ConversationID = conversationID
+		if _, err := insertMessageTx(ctx, q, m.CreateMessageParams); err != nil {
+			return generated.Conversation{}, fmt.Errorf("failed to import message: %w", err)
+		}
+	}
+	for _, sub := range params.Subagents {
+		if _, err := importConversationTx(ctx, q, sub, &conversationID); err != nil {
+			return generated.Conversation{}, err
+		}
+	}
+	return q.GetConversation(ctx, conversationID)
+}
+
+// freeImportSlug returns slug, or the first free variant of it with an
+// "-imported" suffix.
+func freeImportSlug(ctx context.Context, q *generated.Queries, slug *string) (*string, error) {
+	if slug == nil || *slug == "" {
+		return nil, nil
+	}
+	candidate := *slug
+	for i := 1; ; i++ {
+		_, err := q.GetConversationBySlug(ctx, &candidate)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &candidate, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to check slug: %w", err)
+		}
+		candidate = *slug + "-imported"
+		if i > 1 {
+			candidate += fmt.Sprintf("-%d", i)
+		}
+	}
+}
+
+// RewindConversation rewinds a conversation in place to cutoffSequenceID. It
+// starts a new generation holding copies of the messages up to and including
+// the cutoff (from the generation active there, as ForkConversation does),
+// appended after the existing messages: the log is append-only, so the
+// messages after the cutoff stay, in an older generation. File checkpoints
+// of the copied messages, the cutoff message's included, are carried over to
+// their copies, so a later rewind further back can still undo them. It
+// returns ErrInvalidForkPoint when no message exists at or before the cutoff.
+func (db *DB) RewindConversation(ctx context.Context, conversationID string, cutoffSequenceID int64) (*generated.Conversation, error) {
+	var conversation generated.Conversation
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		q := generated.New(tx.Conn())
+		sourceGeneration, err := q.GetGenerationAtOrBeforeSequence(ctx, generated.GetGenerationAtOrBeforeSequenceParams{
+			ConversationID: conversationID,
+			SequenceID:     cutoffSequenceID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidForkPoint
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resolve rewind-point generation: %w", err)
+		}
+		conversation, err = q.IncrementConversationGeneration(ctx, conversationID)
+		if err != nil {
+			return fmt.Errorf("failed to start new generation: %w", err)
+		}
+		next, err := q.GetNextSequenceID(ctx, conversationID)
+		if err != nil {
+			return fmt.Errorf("failed to get next sequence ID: %w", err)
+		}
+		if err := q.CopyMessagesForRewind(ctx, generated.CopyMessagesForRewindParams{
+			FirstSequenceID:  next,
+			DestGeneration:   conversation.CurrentGeneration,
+			ConversationID:   conversationID,
+			CutoffSequenceID: cutoffSequenceID,
+			SourceGeneration: sourceGeneration,
+		}); err != nil {
+			return fmt.Errorf("failed to copy messages: %w", err)
+		}
+		if err := q.CopyFileCheckpoints(ctx, generated.CopyFileCheckpointsParams{
+			SourceConversationID: conversationID,
+			BeforeSequenceID:     cutoffSequenceID + 1,
+			DestConversationID:   conversationID,
+			DestGeneration:       conversation.CurrentGeneration,
+		}); err != nil {
+			return fmt.Errorf("failed to copy file checkpoints: %w", err)
+		}
+		return nil
+	})
+	return &conversation, err
+}
+
+// CreateFileCheckpoints records the prior state of files changed by a tool
+// call, attached to the conversation's latest agent message: the one whose
+// tool call is running. ConversationID and MessageID are filled in.
+func (db *DB) CreateFileCheckpoints(ctx context.Context, conversationID string, checkpoints []generated.CreateFileCheckpointParams) error {
+	return db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		q := generated.New(tx.Conn())
+		messageID, err := q.GetLatestAgentMessageID(ctx, conversationID)
+		if err != nil {
+			return fmt.Errorf("failed to find the tool call's message: %w", err)
+		}
+		for _, cp := range checkpoints {
+			cp.ConversationID = conversationID
+			cp.MessageID = messageID
+			if err := q.CreateFileCheckpoint(ctx, cp); err != nil {
+				return fmt.Errorf("failed to create file checkpoint: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListFileCheckpointsAfter returns the file checkpoints a rewind to
+// afterSequenceID undoes: those of later messages, oldest first.
+func (db *DB) ListFileCheckpointsAfter(ctx context.Context, conversationID string, afterSequenceID int64) ([]generated.FileCheckpoint, error) {
+	var checkpoints []generated.FileCheckpoint
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		q := generated.New(rx.Conn())
+		var err error
+		checkpoints, err = q.ListFileCheckpointsAfter(ctx, generated.ListFileCheckpointsAfterParams{
+			ConversationID:  conversationID,
+			AfterSequenceID: afterSequenceID,
+		})
+		return err
+	})
+	return checkpoints, err
+}
+
+// CreateSubagentWorktree records the git worktree a subagent works in.
+func (db *DB) CreateSubagentWorktree(ctx context.Context, params generated.CreateSubagentWorktreeParams) error {
+	return db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		return generated.New(tx.Conn()).CreateSubagentWorktree(ctx, params)
+	})
+}
+
+// GetSubagentWorktree returns the git worktree a subagent works in, or nil
+// if it has none.
+func (db *DB) GetSubagentWorktree(ctx context.Context, conversationID string) (*generated.SubagentWorktree, error) {
+	var worktree generated.SubagentWorktree
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		var err error
+		worktree, err = generated.New(rx.Conn()).GetSubagentWorktree(ctx, conversationID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &worktree, nil
+}
+
+// DeleteSubagentWorktree forgets a subagent's git worktree.
+func (db *DB) DeleteSubagentWorktree(ctx context.Context, conversationID string) error {
+	return db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		return generated.New(tx.Conn()).DeleteSubagentWorktree(ctx, conversationID)
+	})
+}
+
+// CreateShareLink records a share link for a conversation.
+func (db *DB) CreateShareLink(ctx context.Context, params generated.CreateShareLinkParams) (*generated.ShareLink, error) {
+	var link generated.ShareLink
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		link, err = generated.New(tx.Conn()).CreateShareLink(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetShareLink returns a share link, or nil if there is none with that id.
+// Revoked and expired links are returned too; callers check.
+func (db *DB) GetShareLink(ctx context.Context, shareID string) (*generated.ShareLink, error) {
+	var link generated.ShareLink
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		var err error
+		link, err = generated.New(rx.Conn()).GetShareLink(ctx, shareID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// ListShareLinks returns a conversation's share links, newest first.
+func (db *DB) ListShareLinks(ctx context.Context, conversationID string) ([]generated.ShareLink, error) {
+	var links []generated.ShareLink
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		var err error
+		links, err = generated.New(rx.Conn()).ListShareLinks(ctx, conversationID)
+		return err
+	})
+	return links, err
+}
+
+// RevokeShareLink revokes one of a conversation's share links. It returns
+// nil if the conversation has no such link or it was already revoked.
+func (db *DB) RevokeShareLink(ctx context.Context, conversationID, shareID string) (*generated.ShareLink, error) {
+	var link generated.ShareLink
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		link, err = generated.New(tx.Conn()).RevokeShareLink(ctx, generated.RevokeShareLinkParams{
+			ShareID:        shareID,
+			ConversationID: conversationID,
+		})
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// CreateSchedule creates a scheduled conversation.
+func (db *DB) CreateSchedule(ctx context.Context, params generated.CreateScheduleParams) (*generated.Schedule, error) {
+	var sched generated.Schedule
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		sched, err = generated.New(tx.Conn()).CreateSchedule(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sched, nil
+}
+
+// GetSchedule returns a schedule, or nil if there is none with that id.
+func (db *DB) GetSchedule(ctx context.Context, scheduleID string) (*generated.Schedule, error) {
+	var sched generated.Schedule
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		var err error
+		sched, err = generated.New(rx.Conn()).GetSchedule(ctx, scheduleID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sched, nil
+}
+
+// ListSchedules returns all schedules, newest first.
+func (db *DB) ListSchedules(ctx context.Context) ([]generated.Schedule, error) {
+	var scheds []generated.Schedule
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		var err error
+		scheds, err = generated.New(rx.Conn()).ListSchedules(ctx)
+		return err
+	})
+	return scheds, err
+}
+
+// ListEnabledSchedules returns the enabled schedules that have a next run.
+func (db *DB) ListEnabledSchedules(ctx context.Context) ([]generated.Schedule, error) {
+	var scheds []generated.Schedule
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		var err error
+		scheds, err = generated.New(rx.Conn()).ListEnabledSchedules(ctx)
+		return err
+	})
+	return scheds, err
+}
+
+// UpdateSchedule updates a schedule. It returns nil if there is none with
+// that id.
+func (db *DB) UpdateSchedule(ctx context.Context, params generated.UpdateScheduleParams) (*generated.Schedule, error) {
+	var sched generated.Schedule
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		sched, err = generated.New(tx.Conn()).UpdateSchedule(ctx, params)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sched, nil
+}
+
+// AdvanceSchedule records that a schedule fired at lastRunAt and is next
+// due at nextRunAt, or never again if nextRunAt is nil.
+func (db *DB) AdvanceSchedule(ctx context.Context, scheduleID string, nextRunAt, lastRunAt *time.Time) error {
+	return db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		return generated.New(tx.Conn()).AdvanceSchedule(ctx, generated.AdvanceScheduleParams{
+			NextRunAt:  nextRunAt,
+			LastRunAt:  lastRunAt,
+			ScheduleID: scheduleID,
+		})
+	})
+}
+
+// DeleteSchedule deletes a schedule and its run history. It reports
+// whether there was such a schedule.
+func (db *DB) DeleteSchedule(ctx context.Context, scheduleID string) (bool, error) {
+	var n int64
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		n, err = generated.New(tx.Conn()).DeleteSchedule(ctx, scheduleID)
+		return err
+	})
+	return n > 0, err
+}
+
+// CreateScheduleRun records one firing of a schedule.
+func (db *DB) CreateScheduleRun(ctx context.Context, params generated.CreateScheduleRunParams) (*generated.ScheduleRun, error) {
+	var run generated.ScheduleRun
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		run, err = generated.New(tx.Conn()).CreateScheduleRun(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ListScheduleRuns returns a schedule's most recent runs, newest first.
+func (db *DB) ListScheduleRuns(ctx context.Context, scheduleID string, limit int64) ([]generated.ScheduleRun, error) {
+	var runs []generated.ScheduleRun
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		var err error
+		runs, err = generated.New(rx.Conn()).ListScheduleRuns(ctx, generated.ListScheduleRunsParams{
+			ScheduleID: scheduleID,
+			Limit:      limit,
+		})
+		return err
+	})
+	return runs, err
+}
+
+// CreateTrigger creates a webhook trigger.
+func (db *DB) CreateTrigger(ctx context.Context, params generated.CreateTriggerParams) (*generated.Trigger, error) {
+	var trigger generated.Trigger
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		trigger, err = generated.New(tx.Conn()).CreateTrigger(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &trigger, nil
+}
+
+// GetTrigger returns a trigger, or nil if there is none with that name.
+func (db *DB) GetTrigger(ctx context.Context, name string) (*generated.Trigger, error) {
+	var trigger generated.Trigger
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		var err error
+		trigger, err = generated.New(rx.Conn()).GetTrigger(ctx, name)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &trigger, nil
+}
+
+// ListTriggers returns all triggers by name.
+func (db *DB) ListTriggers(ctx context.Context) ([]generated.Trigger, error) {
+	var triggers []generated.Trigger
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		var err error
+		triggers, err = generated.New(rx.Conn()).ListTriggers(ctx)
+		return err
+	})
+	return triggers, err
+}
+
+// UpdateTrigger updates a trigger. It returns nil if there is none with
+// that name.
+func (db *DB) UpdateTrigger(ctx context.Context, params generated.UpdateTriggerParams) (*generated.Trigger, error) {
+	var trigger generated.Trigger
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		trigger, err = generated.New(tx.Conn()).UpdateTrigger(ctx, params)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &trigger, nil
+}
+
+// SetTriggerSecret replaces a trigger's secret. It returns nil if there is
+// none with that name.
+func (db *DB) SetTriggerSecret(ctx context.Context, name, secret string) (*generated.Trigger, error) {
+	var trigger generated.Trigger
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		trigger, err = generated.New(tx.Conn()).SetTriggerSecret(ctx, generated.SetTriggerSecretParams{
+			Secret: secret,
+			Name:   name,
+		})
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &trigger, nil
+}
+
+// RecordTriggerFired records that a trigger started a conversation.
+func (db *DB) RecordTriggerFired(ctx context.Context, name, conversationID string, at time.Time) error {
+	return db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		return generated.New(tx.Conn()).RecordTriggerFired(ctx, generated.RecordTriggerFiredParams{
+			LastFiredAt:        &at,
+			LastConversationID: &conversationID,
+			Name:               name,
+		})
+	})
+}
+
+// DeleteTrigger deletes a trigger. It reports whether there was such a
+// trigger.
+func (db *DB) DeleteTrigger(ctx context.Context, name string) (bool, error) {
+	var n int64
+	err := db.pool.Tx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		n, err = generated.New(tx.Conn()).DeleteTrigger(ctx, name)
+		return err
+	})
+	return n > 0, err
+}
+
 // CreateSubagentConversation creates a new subagent conversation with a parent
 func (db *DB) CreateSubagentConversation(ctx context.Context, slug, parentID string, cwd *string) (*generated.Conversation, error) {
 	conversationID, err := generateConversationID()
@@ -1897,6 +2586,24 @@ func (db *DB) GetSubagentOtherUsage(ctx context.Context, parentID string) ([]gen
 	return rows, err
 }
 
+// GetConversationTreeUsage aggregates the LLM usage of conversationID and
+// all its descendants (recursively), grouped by model: direct usage, and
+// indirect usage from other_usage_data entries.
+func (db *DB) GetConversationTreeUsage(ctx context.Context, conversationID string) ([]generated.GetConversationTreeUsageRow, []generated.GetConversationTreeOtherUsageRow, error) {
+	var rows []generated.GetConversationTreeUsageRow
+	var otherRows []generated.GetConversationTreeOtherUsageRow
+	err := db.pool.Rx(ctx, func(ctx context.Context, rx *Rx) error {
+		q := generated.New(rx.Conn())
+		var err error
+		if rows, err = q.GetConversationTreeUsage(ctx, conversationID); err != nil {
+			return err
+		}
+		otherRows, err = q.GetConversationTreeOtherUsage(ctx, conversationID)
+		return err
+	})
+	return rows, otherRows, err
+}
+
 // GetSubagentCounts returns a map of parent_conversation_id -> subagent count.
 func (db *DB) GetSubagentCounts(ctx context.Context) (map[string]int64, error) {
 	var rows []generated.GetSubagentCountsRow
@@ -342,6 +342,135 @@ func (q *Queries) GetConversationQueuedMessages(ctx context.Context, conversatio
 	return queued_messages, err
 }
 
+const getConversationTreeOtherUsage = `-- name: GetConversationTreeOtherUsage :many
+WITH RECURSIVE tree(conversation_id) AS (
+  SELECT r.conversation_id FROM conversations r WHERE r.conversation_id = ?
+  UNION ALL
+  SELECT c.conversation_id FROM conversations c
+  JOIN tree t ON c.parent_conversation_id = t.conversation_id
+)
+SELECT
+  CAST(COALESCE(je.value ->> 'model', '') AS TEXT) AS model_name,
+  CAST(COALESCE(je.value ->> 'url', '') AS TEXT) AS llm_api_url,
+  CAST(COALESCE(SUM(je.value ->> 'input_tokens'), 0) AS INTEGER) AS input_tokens,
+  CAST(COALESCE(SUM(je.value ->> 'cache_creation_input_tokens'), 0) AS INTEGER) AS cache_creation_input_tokens,
+  CAST(COALESCE(SUM(je.value ->> 'cache_read_input_tokens'), 0) AS INTEGER) AS cache_read_input_tokens,
+  CAST(COALESCE(SUM(je.value ->> 'output_tokens'), 0) AS INTEGER) AS output_tokens,
+  CAST(COALESCE(SUM(je.value ->> 'cost_usd'), 0) AS REAL) AS cost_usd
+FROM messages m
+JOIN tree t ON m.conversation_id = t.conversation_id,
+  json_each(m.other_usage_data) je
+WHERE m.other_usage_data IS NOT NULL
+GROUP BY je.value ->> 'model', je.value ->> 'url'
+`
+
+type GetConversationTreeOtherUsageRow struct {
+	ModelName                string  `json:"model_name"`
+	LlmApiUrl                string  `json:"llm_api_url"`
+	InputTokens              int64   `json:"input_tokens"`
+	CacheCreationInputTokens int64   `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64   `json:"cache_read_input_tokens"`
+	OutputTokens             int64   `json:"output_tokens"`
+	CostUsd                  float64 `json:"cost_usd"`
+}
+
+// Aggregate indirect LLM usage (messages.other_usage_data entries) of a
+// conversation and all its descendants, grouped by model.
+func (q *Queries) GetConversationTreeOtherUsage(ctx context.Context, conversationID string) ([]GetConversationTreeOtherUsageRow, error) {
+	rows, err := q.db.QueryContext(ctx, getConversationTreeOtherUsage, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetConversationTreeOtherUsageRow{}
+	for rows.Next() {
+		var i GetConversationTreeOtherUsageRow
+		if err := rows.Scan(
+			&i.ModelName,
+			&i.LlmApiUrl,
+			&i.InputTokens,
+			&i.CacheCreationInputTokens,
+			&i.CacheReadInputTokens,
+			&i.OutputTokens,
+			&i.CostUsd,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConversationTreeUsage = `-- name: GetConversationTreeUsage :many
+WITH RECURSIVE tree(conversation_id) AS (
+  SELECT r.conversation_id FROM conversations r WHERE r.conversation_id = ?
+  UNION ALL
+  SELECT c.conversation_id FROM conversations c
+  JOIN tree t ON c.parent_conversation_id = t.conversation_id
+)
+SELECT
+  m.model_name,
+  m.llm_api_url,
+  CAST(COALESCE(SUM(m.usage_data ->> 'input_tokens'), 0) AS INTEGER) AS input_tokens,
+  CAST(COALESCE(SUM(m.usage_data ->> 'cache_creation_input_tokens'), 0) AS INTEGER) AS cache_creation_input_tokens,
+  CAST(COALESCE(SUM(m.usage_data ->> 'cache_read_input_tokens'), 0) AS INTEGER) AS cache_read_input_tokens,
+  CAST(COALESCE(SUM(m.usage_data ->> 'output_tokens'), 0) AS INTEGER) AS output_tokens,
+  CAST(COALESCE(SUM(m.usage_data ->> 'cost_usd'), 0) AS REAL) AS cost_usd
+FROM messages m
+JOIN tree t ON m.conversation_id = t.conversation_id
+WHERE m.type = 'agent' AND m.usage_data IS NOT NULL
+GROUP BY m.model_name, m.llm_api_url
+`
+
+type GetConversationTreeUsageRow struct {
+	ModelName                *string `json:"model_name"`
+	LlmApiUrl                *string `json:"llm_api_url"`
+	InputTokens              int64   `json:"input_tokens"`
+	CacheCreationInputTokens int64   `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64   `json:"cache_read_input_tokens"`
+	OutputTokens             int64   `json:"output_tokens"`
+	CostUsd                  float64 `json:"cost_usd"`
+}
+
+// Aggregate LLM usage of a conversation and all its descendants, grouped
+// by model: what the conversation's budget is charged against.
+func (q *Queries) GetConversationTreeUsage(ctx context.Context, conversationID string) ([]GetConversationTreeUsageRow, error) {
+	rows, err := q.db.QueryContext(ctx, getConversationTreeUsage, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetConversationTreeUsageRow{}
+	for rows.Next() {
+		var i GetConversationTreeUsageRow
+		if err := rows.Scan(
+			&i.ModelName,
+			&i.LlmApiUrl,
+			&i.InputTokens,
+			&i.CacheCreationInputTokens,
+			&i.CacheReadInputTokens,
+			&i.OutputTokens,
+			&i.CostUsd,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSubagentCounts = `-- name: GetSubagentCounts :many
 SELECT parent_conversation_id, COUNT(*) AS count
 FROM conversations
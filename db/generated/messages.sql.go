@@ -47,6 +47,40 @@ func (q *Queries) CopyMessagesForFork(ctx context.Context, arg CopyMessagesForFo
 	return err
 }
 
+const copyMessagesForRewind = `-- name: CopyMessagesForRewind :exec
+INSERT INTO messages (message_id, conversation_id, sequence_id, generation, type, llm_data, user_data, usage_data, display_data, excluded_from_context, llm_api_url, model_name, user_email, forked_from_message_id, created_at, other_usage_data)
+SELECT lower(hex(randomblob(16))), m.conversation_id, CAST(?1 AS INTEGER) + ROW_NUMBER() OVER (ORDER BY m.sequence_id) - 1, ?2, m.type, m.llm_data, m.user_data, m.usage_data, m.display_data, m.excluded_from_context, m.llm_api_url, m.model_name, m.user_email, m.message_id, m.created_at, m.other_usage_data
+FROM messages m
+WHERE m.conversation_id = ?3
+  AND m.sequence_id <= ?4
+  AND m.generation = ?5
+  AND m.type != 'slug'
+ORDER BY m.sequence_id ASC
+`
+
+type CopyMessagesForRewindParams struct {
+	FirstSequenceID  int64  `json:"first_sequence_id"`
+	DestGeneration   int64  `json:"dest_generation"`
+	ConversationID   string `json:"conversation_id"`
+	CutoffSequenceID int64  `json:"cutoff_sequence_id"`
+	SourceGeneration int64  `json:"source_generation"`
+}
+
+// Like CopyMessagesForFork, but copies into a new generation of the SAME
+// conversation, appending the copies after its existing messages with
+// sequence_ids from first_sequence_id on. Used to rewind a conversation in
+// place: the messages after the cutoff stay in the log, in an older generation.
+func (q *Queries) CopyMessagesForRewind(ctx context.Context, arg CopyMessagesForRewindParams) error {
+	_, err := q.db.ExecContext(ctx, copyMessagesForRewind,
+		arg.FirstSequenceID,
+		arg.DestGeneration,
+		arg.ConversationID,
+		arg.CutoffSequenceID,
+		arg.SourceGeneration,
+	)
+	return err
+}
+
 const countConsecutiveMessagesByType = `-- name: CountConsecutiveMessagesByType :one
 SELECT COUNT(*) FROM messages m
 WHERE m.conversation_id = ?1
@@ -34,6 +34,19 @@ type Conversation struct {
 	QueuedMessages       string    `json:"queued_messages"`
 }
 
+type FileCheckpoint struct {
+	CheckpointID   int64     `json:"checkpoint_id"`
+	ConversationID string    `json:"conversation_id"`
+	MessageID      string    `json:"message_id"`
+	ToolUseID      string    `json:"tool_use_id"`
+	ToolName       string    `json:"tool_name"`
+	Path           string    `json:"path"`
+	Existed        bool      `json:"existed"`
+	Content        []byte    `json:"content"`
+	Mode           int64     `json:"mode"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
 type Message struct {
 	MessageID           string    `json:"message_id"`
 	ConversationID      string    `json:"conversation_id"`
@@ -79,3 +92,65 @@ type NotificationChannel struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+type Schedule struct {
+	ScheduleID           string     `json:"schedule_id"`
+	Name                 string     `json:"name"`
+	Cron                 *string    `json:"cron"`
+	RunAt                *time.Time `json:"run_at"`
+	Timezone             string     `json:"timezone"`
+	Prompt               string     `json:"prompt"`
+	Model                *string    `json:"model"`
+	Cwd                  *string    `json:"cwd"`
+	ConversationOptions  string     `json:"conversation_options"`
+	CatchUp              string     `json:"catch_up"`
+	Enabled              bool       `json:"enabled"`
+	OriginConversationID *string    `json:"origin_conversation_id"`
+	NextRunAt            *time.Time `json:"next_run_at"`
+	LastRunAt            *time.Time `json:"last_run_at"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+type ScheduleRun struct {
+	RunID          int64     `json:"run_id"`
+	ScheduleID     string    `json:"schedule_id"`
+	ConversationID *string   `json:"conversation_id"`
+	ScheduledFor   time.Time `json:"scheduled_for"`
+	StartedAt      time.Time `json:"started_at"`
+	Error          *string   `json:"error"`
+}
+
+type ShareLink struct {
+	ShareID          string     `json:"share_id"`
+	ConversationID   string     `json:"conversation_id"`
+	IncludeSubagents bool       `json:"include_subagents"`
+	RedactToolOutput bool       `json:"redact_tool_output"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+}
+
+type SubagentWorktree struct {
+	ConversationID string    `json:"conversation_id"`
+	RepoRoot       string    `json:"repo_root"`
+	Path           string    `json:"path"`
+	Branch         string    `json:"branch"`
+	BaseCommit     string    `json:"base_commit"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type Trigger struct {
+	Name                string     `json:"name"`
+	Secret              string     `json:"secret"`
+	PromptTemplate      string     `json:"prompt_template"`
+	Model               *string    `json:"model"`
+	Cwd                 *string    `json:"cwd"`
+	ConversationOptions string     `json:"conversation_options"`
+	Tags                string     `json:"tags"`
+	Enabled             bool       `json:"enabled"`
+	LastFiredAt         *time.Time `json:"last_fired_at"`
+	LastConversationID  *string    `json:"last_conversation_id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,35 @@
+-- name: GetLatestAgentMessageID :one
+-- The agent message a running tool call belongs to: the loop records the
+-- assistant message before it executes the message's tool calls.
+SELECT message_id FROM messages
+WHERE conversation_id = ? AND type = 'agent'
+ORDER BY sequence_id DESC
+LIMIT 1;
+
+-- name: CreateFileCheckpoint :exec
+INSERT INTO file_checkpoints (conversation_id, message_id, tool_use_id, tool_name, path, existed, content, mode)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListFileCheckpointsAfter :many
+-- The checkpoints a rewind to after_sequence_id undoes: those attached to
+-- messages after it, oldest first. The target message's own are kept.
+SELECT c.* FROM file_checkpoints c
+INNER JOIN messages m ON m.message_id = c.message_id
+WHERE c.conversation_id = sqlc.arg('conversation_id')
+  AND m.sequence_id > sqlc.arg('after_sequence_id')
+ORDER BY c.checkpoint_id ASC;
+
+-- name: CopyFileCheckpoints :exec
+-- Copies the checkpoints attached to source messages before before_sequence_id
+-- onto the copies of those messages in the destination generation (see
+-- CopyMessagesForFork and CopyMessagesForRewind), preserving their order.
+INSERT INTO file_checkpoints (conversation_id, message_id, tool_use_id, tool_name, path, existed, content, mode, created_at)
+SELECT copy.conversation_id, copy.message_id, c.tool_use_id, c.tool_name, c.path, c.existed, c.content, c.mode, c.created_at
+FROM file_checkpoints c
+INNER JOIN messages orig ON orig.message_id = c.message_id
+INNER JOIN messages copy ON copy.forked_from_message_id = c.message_id
+WHERE c.conversation_id = sqlc.arg('source_conversation_id')
+  AND orig.sequence_id < sqlc.arg('before_sequence_id')
+  AND copy.conversation_id = sqlc.arg('dest_conversation_id')
+  AND copy.generation = sqlc.arg('dest_generation')
+ORDER BY c.checkpoint_id ASC;
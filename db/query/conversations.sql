@@ -370,6 +370,51 @@ WHERE m.other_usage_data IS NOT NULL
 -- would resolve to the messages table's own columns (NULL here).
 GROUP BY je.value ->> 'model', je.value ->> 'url';
 
+-- name: GetConversationTreeUsage :many
+-- Aggregate LLM usage of a conversation and all its descendants, grouped
+-- by model: what the conversation's budget is charged against.
+WITH RECURSIVE tree(conversation_id) AS (
+  SELECT r.conversation_id FROM conversations r WHERE r.conversation_id = ?
+  UNION ALL
+  SELECT c.conversation_id FROM conversations c
+  JOIN tree t ON c.parent_conversation_id = t.conversation_id
+)
+SELECT
+  m.model_name,
+  m.llm_api_url,
+  CAST(COALESCE(SUM(m.usage_data ->> 'input_tokens'), 0) AS INTEGER) AS input_tokens,
+  CAST(COALESCE(SUM(m.usage_data ->> 'cache_creation_input_tokens'), 0) AS INTEGER) AS cache_creation_input_tokens,
+  CAST(COALESCE(SUM(m.usage_data ->> 'cache_read_input_tokens'), 0) AS INTEGER) AS cache_read_input_tokens,
+  CAST(COALESCE(SUM(m.usage_data ->> 'output_tokens'), 0) AS INTEGER) AS output_tokens,
+  CAST(COALESCE(SUM(m.usage_data ->> 'cost_usd'), 0) AS REAL) AS cost_usd
+FROM messages m
+JOIN tree t ON m.conversation_id = t.conversation_id
+WHERE m.type = 'agent' AND m.usage_data IS NOT NULL
+GROUP BY m.model_name, m.llm_api_url;
+
+-- name: GetConversationTreeOtherUsage :many
+-- Aggregate indirect LLM usage (messages.other_usage_data entries) of a
+-- conversation and all its descendants, grouped by model.
+WITH RECURSIVE tree(conversation_id) AS (
+  SELECT r.conversation_id FROM conversations r WHERE r.conversation_id = ?
+  UNION ALL
+  SELECT c.conversation_id FROM conversations c
+  JOIN tree t ON c.parent_conversation_id = t.conversation_id
+)
+SELECT
+  CAST(COALESCE(je.value ->> 'model', '') AS TEXT) AS model_name,
+  CAST(COALESCE(je.value ->> 'url', '') AS TEXT) AS llm_api_url,
+  CAST(COALESCE(SUM(je.value ->> 'input_tokens'), 0) AS INTEGER) AS input_tokens,
+  CAST(COALESCE(SUM(je.value ->> 'cache_creation_input_tokens'), 0) AS INTEGER) AS cache_creation_input_tokens,
+  CAST(COALESCE(SUM(je.value ->> 'cache_read_input_tokens'), 0) AS INTEGER) AS cache_read_input_tokens,
+  CAST(COALESCE(SUM(je.value ->> 'output_tokens'), 0) AS INTEGER) AS output_tokens,
+  CAST(COALESCE(SUM(je.value ->> 'cost_usd'), 0) AS REAL) AS cost_usd
+FROM messages m
+JOIN tree t ON m.conversation_id = t.conversation_id,
+  json_each(m.other_usage_data) je
+WHERE m.other_usage_data IS NOT NULL
+GROUP BY je.value ->> 'model', je.value ->> 'url';
+
 -- name: GetConversationBySlugAndParent :one
 SELECT * FROM conversations
 WHERE slug = ? AND parent_conversation_id = ?;
@@ -72,6 +72,20 @@ WHERE m.conversation_id = sqlc.arg('source_conversation_id')
   AND m.type != 'slug'
 ORDER BY m.sequence_id ASC;
 
+-- name: CopyMessagesForRewind :exec
+-- Like CopyMessagesForFork, but copies into a new generation of the SAME
+-- conversation, appending the copies after its existing messages with
+-- sequence_ids from first_sequence_id on. Used to rewind a conversation in
+-- place: the messages after the cutoff stay in the log, in an older generation.
+INSERT INTO messages (message_id, conversation_id, sequence_id, generation, type, llm_data, user_data, usage_data, display_data, excluded_from_context, llm_api_url, model_name, user_email, forked_from_message_id, created_at, other_usage_data)
+SELECT lower(hex(randomblob(16))), m.conversation_id, CAST(sqlc.arg('first_sequence_id') AS INTEGER) + ROW_NUMBER() OVER (ORDER BY m.sequence_id) - 1, sqlc.arg('dest_generation'), m.type, m.llm_data, m.user_data, m.usage_data, m.display_data, m.excluded_from_context, m.llm_api_url, m.model_name, m.user_email, m.message_id, m.created_at, m.other_usage_data
+FROM messages m
+WHERE m.conversation_id = sqlc.arg('conversation_id')
+  AND m.sequence_id <= sqlc.arg('cutoff_sequence_id')
+  AND m.generation = sqlc.arg('source_generation')
+  AND m.type != 'slug'
+ORDER BY m.sequence_id ASC;
+
 -- name: ListMessagesByType :many
 SELECT * FROM messages
 WHERE conversation_id = ? AND type = ?
@@ -0,0 +1,44 @@
+-- name: CreateSchedule :one
+INSERT INTO schedules (schedule_id, name, cron, run_at, timezone, prompt, model, cwd, conversation_options, catch_up, enabled, origin_conversation_id, next_run_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetSchedule :one
+SELECT * FROM schedules
+WHERE schedule_id = ?;
+
+-- name: ListSchedules :many
+SELECT * FROM schedules
+ORDER BY created_at DESC;
+
+-- name: ListEnabledSchedules :many
+SELECT * FROM schedules
+WHERE enabled = TRUE AND next_run_at IS NOT NULL;
+
+-- name: UpdateSchedule :one
+UPDATE schedules
+SET name = ?, cron = ?, run_at = ?, timezone = ?, prompt = ?, model = ?, cwd = ?,
+    conversation_options = ?, catch_up = ?, enabled = ?, next_run_at = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE schedule_id = ?
+RETURNING *;
+
+-- name: AdvanceSchedule :exec
+UPDATE schedules
+SET next_run_at = ?, last_run_at = ?
+WHERE schedule_id = ?;
+
+-- name: DeleteSchedule :execrows
+DELETE FROM schedules
+WHERE schedule_id = ?;
+
+-- name: CreateScheduleRun :one
+INSERT INTO schedule_runs (schedule_id, conversation_id, scheduled_for, error)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: ListScheduleRuns :many
+SELECT * FROM schedule_runs
+WHERE schedule_id = ?
+ORDER BY run_id DESC
+LIMIT ?;
@@ -0,0 +1,19 @@
+-- name: CreateShareLink :one
+INSERT INTO share_links (share_id, conversation_id, include_subagents, redact_tool_output, expires_at)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetShareLink :one
+SELECT * FROM share_links
+WHERE share_id = ?;
+
+-- name: ListShareLinks :many
+SELECT * FROM share_links
+WHERE conversation_id = ?
+ORDER BY created_at DESC;
+
+-- name: RevokeShareLink :one
+UPDATE share_links
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE share_id = ? AND conversation_id = ? AND revoked_at IS NULL
+RETURNING *;
@@ -0,0 +1,34 @@
+-- name: CreateTrigger :one
+INSERT INTO triggers (name, secret, prompt_template, model, cwd, conversation_options, tags, enabled)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetTrigger :one
+SELECT * FROM triggers
+WHERE name = ?;
+
+-- name: ListTriggers :many
+SELECT * FROM triggers
+ORDER BY name;
+
+-- name: UpdateTrigger :one
+UPDATE triggers
+SET prompt_template = ?, model = ?, cwd = ?, conversation_options = ?, tags = ?, enabled = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE name = ?
+RETURNING *;
+
+-- name: SetTriggerSecret :one
+UPDATE triggers
+SET secret = ?, updated_at = CURRENT_TIMESTAMP
+WHERE name = ?
+RETURNING *;
+
+-- name: RecordTriggerFired :exec
+UPDATE triggers
+SET last_fired_at = ?, last_conversation_id = ?
+WHERE name = ?;
+
+-- name: DeleteTrigger :execrows
+DELETE FROM triggers
+WHERE name = ?;
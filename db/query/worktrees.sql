@@ -0,0 +1,11 @@
+-- name: CreateSubagentWorktree :exec
+INSERT INTO subagent_worktrees (conversation_id, repo_root, path, branch, base_commit)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: GetSubagentWorktree :one
+SELECT * FROM subagent_worktrees
+WHERE conversation_id = ?;
+
+-- name: DeleteSubagentWorktree :exec
+DELETE FROM subagent_worktrees
+WHERE conversation_id = ?;
@@ -0,0 +1,29 @@
+-- File checkpoints record what a file looked like before a tool call changed
+-- it, so a conversation can be rewound to an earlier message with its files
+-- restored to match.
+--
+-- The patch tool records every file it writes; bash records the files that
+-- differ in the git working tree before and after the command. A checkpoint is
+-- attached to the agent message whose tool call made the change. Rewinding to a
+-- message undoes every checkpoint attached to that message or a later one,
+-- restoring each path to the content of its earliest such checkpoint.
+--
+-- Rows are never updated. When a rewind or fork copies messages, the
+-- checkpoints of the copied messages are copied with them (attached to the
+-- copies), so the copied history can itself be rewound.
+CREATE TABLE file_checkpoints (
+    checkpoint_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    conversation_id TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    tool_use_id TEXT NOT NULL,
+    tool_name TEXT NOT NULL,
+    path TEXT NOT NULL,
+    existed BOOLEAN NOT NULL, -- FALSE: the file was created; undoing removes it
+    content BLOB, -- contents before the call; NULL when existed is FALSE
+    mode INTEGER NOT NULL DEFAULT 0, -- permission bits before the call
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(conversation_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_file_checkpoints_conversation ON file_checkpoints(conversation_id, checkpoint_id);
+CREATE INDEX idx_file_checkpoints_message ON file_checkpoints(message_id);
@@ -0,0 +1,15 @@
+-- A subagent started with isolation "worktree" works in its own git worktree,
+-- on a new branch cut from its parent's HEAD, so subagents editing the same
+-- repository in parallel don't step on each other or on the parent.
+--
+-- The row lives until the parent merges or discards the branch, or the
+-- subagent is cancelled mid-turn with its parent, which removes the worktree.
+CREATE TABLE subagent_worktrees (
+    conversation_id TEXT PRIMARY KEY, -- the subagent
+    repo_root TEXT NOT NULL, -- the main repository's working tree
+    path TEXT NOT NULL,
+    branch TEXT NOT NULL,
+    base_commit TEXT NOT NULL, -- the commit the branch was cut from
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(conversation_id) ON DELETE CASCADE
+);
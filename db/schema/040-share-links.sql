@@ -0,0 +1,17 @@
+-- A share link grants read-only access to one conversation's snapshot and
+-- live stream to whoever holds its token, without access to the rest of the
+-- instance. The token carries the share_id and expiry, signed with a secret
+-- kept in settings; this row is what lets a link be revoked early and
+-- records what the holder may see.
+CREATE TABLE share_links (
+    share_id TEXT PRIMARY KEY,
+    conversation_id TEXT NOT NULL,
+    include_subagents BOOLEAN NOT NULL DEFAULT FALSE, -- also grant the conversation's subagents
+    redact_tool_output BOOLEAN NOT NULL DEFAULT FALSE, -- hide tool results and progress
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(conversation_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_share_links_conversation ON share_links(conversation_id, created_at);
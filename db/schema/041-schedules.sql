@@ -0,0 +1,42 @@
+-- A schedule starts a new conversation with a fixed prompt, either on a
+-- cron schedule or once at run_at. Each firing creates its own
+-- conversation, so none grows without bound; schedule_runs links them back
+-- to the schedule, and the schedule to the conversation it was set up from.
+--
+-- next_run_at is when the server's scheduler fires it next; NULL once a
+-- one-shot schedule has fired. Firings missed while the server was down
+-- are handled per catch_up: 'skip', 'once' or 'all'.
+CREATE TABLE schedules (
+    schedule_id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    cron TEXT, -- five-field cron expression; NULL for a one-shot schedule
+    run_at DATETIME, -- when a one-shot schedule fires
+    timezone TEXT NOT NULL DEFAULT '', -- IANA zone cron is evaluated in; '' is the server's
+    prompt TEXT NOT NULL,
+    model TEXT, -- NULL uses the default model at firing time
+    cwd TEXT,
+    conversation_options TEXT NOT NULL DEFAULT '{}', -- as conversations.conversation_options
+    catch_up TEXT NOT NULL DEFAULT 'once',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    origin_conversation_id TEXT,
+    next_run_at DATETIME,
+    last_run_at DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((cron IS NULL) != (run_at IS NULL)),
+    FOREIGN KEY (origin_conversation_id) REFERENCES conversations(conversation_id) ON DELETE SET NULL
+);
+
+CREATE TABLE schedule_runs (
+    run_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    schedule_id TEXT NOT NULL,
+    conversation_id TEXT, -- NULL if the firing failed, or the conversation was deleted
+    scheduled_for DATETIME NOT NULL,
+    started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    error TEXT,
+    FOREIGN KEY (schedule_id) REFERENCES schedules(schedule_id) ON DELETE CASCADE,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(conversation_id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_schedule_runs_schedule ON schedule_runs(schedule_id, run_id);
+CREATE INDEX idx_schedule_runs_conversation ON schedule_runs(conversation_id);
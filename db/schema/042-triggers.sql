@@ -0,0 +1,18 @@
+-- A trigger is a named webhook: POST /api/triggers/<name>, signed with the
+-- trigger's secret, renders the JSON payload through prompt_template and
+-- starts a conversation with the result.
+CREATE TABLE triggers (
+    name TEXT PRIMARY KEY,
+    secret TEXT NOT NULL, -- HMAC key for payload signatures; also accepted as a bearer token
+    prompt_template TEXT NOT NULL, -- Go text/template; dot is the decoded payload
+    model TEXT, -- NULL uses the default model at firing time
+    cwd TEXT,
+    conversation_options TEXT NOT NULL DEFAULT '{}', -- as conversations.conversation_options
+    tags TEXT NOT NULL DEFAULT '[]', -- JSON array, copied to each conversation
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_fired_at DATETIME,
+    last_conversation_id TEXT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (last_conversation_id) REFERENCES conversations(conversation_id) ON DELETE SET NULL
+);
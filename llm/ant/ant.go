@@ -94,6 +94,10 @@ func (s *Service) Provider() string { return "anthropic" }
 // anthropic_messages for a third-party model); those reject the tool, so gate
 // on the model name.
 func (s *Service) SupportsServerSideWebSearch() bool {
+	// Bedrock does not offer Anthropic's server-side tools.
+	if _, ok := s.Transport.(*Bedrock); ok {
+		return false
+	}
 	return strings.HasPrefix(strings.ToLower(cmp.Or(s.Model, DefaultModel)), "claude")
 }
 
@@ -161,6 +165,7 @@ type Service struct {
 	ThinkingLevel   llm.ThinkingLevel // service-level default; ThinkingLevelDefault (zero) means "none configured"
 	Backoff         []time.Duration   // retry backoff durations; defaults to {15s, 30s, 60s} if nil
 	SupportsImages_ bool              // whether this service accepts image inputs
+	Transport       Transport         // nil sends requests to the Anthropic API at URL with APIKey
 }
 
 var _ llm.Service = (*Service)(nil)
@@ -402,18 +407,19 @@ type outputConfig struct {
 type request struct {
 	// Field order matters for JSON serialization - stable fields should come first
 	// to maximize prefix deduplication when storing LLM requests.
-	Model         string          `json:"model"`
-	MaxTokens     int             `json:"max_tokens"`
-	Stream        bool            `json:"stream,omitempty"`
-	System        []systemContent `json:"system,omitempty"`
-	Tools         []*tool         `json:"tools,omitempty"`
-	ToolChoice    *toolChoice     `json:"tool_choice,omitempty"`
-	Thinking      *thinking       `json:"thinking,omitempty"`
-	OutputConfig  *outputConfig   `json:"output_config,omitempty"`
-	Temperature   float64         `json:"temperature,omitempty"`
-	TopK          int             `json:"top_k,omitempty"`
-	TopP          float64         `json:"top_p,omitempty"`
-	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Model            string          `json:"model,omitempty"`
+	AnthropicVersion string          `json:"anthropic_version,omitempty"`
+	MaxTokens        int             `json:"max_tokens"`
+	Stream           bool            `json:"stream,omitempty"`
+	System           []systemContent `json:"system,omitempty"`
+	Tools            []*tool         `json:"tools,omitempty"`
+	ToolChoice       *toolChoice     `json:"tool_choice,omitempty"`
+	Thinking         *thinking       `json:"thinking,omitempty"`
+	OutputConfig     *outputConfig   `json:"output_config,omitempty"`
+	Temperature      float64         `json:"temperature,omitempty"`
+	TopK             int             `json:"top_k,omitempty"`
+	TopP             float64         `json:"top_p,omitempty"`
+	StopSequences    []string        `json:"stop_sequences,omitempty"`
 	// Messages comes last since it grows with each request in a conversation
 	Messages []message `json:"messages"`
 }
@@ -780,6 +786,7 @@ func (s *Service) fromLLMRequest(r *llm.Request) *request {
 	}
 
 	applyAnthropicThinking(req, model, llm.EffectiveThinkingLevel(s.ThinkingLevel, r.ThinkingLevel), maxTokens)
+	applyResponseSchema(req, r.ResponseSchema)
 
 	// Cap max_tokens at the model's maximum allowed output tokens
 	if limit := s.maxOutputTokens(); req.MaxTokens > limit {
@@ -823,6 +830,35 @@ func applyAnthropicThinking(req *request, model string, level llm.ThinkingLevel,
 	req.Thinking = &thinking{Type: "enabled", BudgetTokens: budget}
 }
 
+// applyResponseSchema asks for structured output the Anthropic way: the
+// model must answer by calling a tool whose input schema is the response
+// schema. Anthropic rejects extended thinking when a tool is forced.
+func applyResponseSchema(req *request, schema json.RawMessage) {
+	if len(schema) == 0 {
+		return
+	}
+	req.Tools = append(req.Tools, &tool{
+		Name:        llm.ResponseSchemaToolName,
+		Description: "Deliver the response. Its input is the complete answer.",
+		InputSchema: schema,
+	})
+	req.ToolChoice = &toolChoice{Type: "tool", Name: llm.ResponseSchemaToolName}
+	req.Thinking = nil
+}
+
+// structuredResponse turns the forced call of applyResponseSchema back into
+// the text response callers of a structured request expect.
+func structuredResponse(resp *llm.Response) {
+	for i, c := range resp.Content {
+		if c.Type == llm.ContentTypeToolUse && c.ToolName == llm.ResponseSchemaToolName {
+			resp.Content[i] = llm.Content{Type: llm.ContentTypeText, Text: string(c.ToolInput)}
+			if resp.StopReason == llm.StopReasonToolUse {
+				resp.StopReason = llm.StopReasonEndTurn
+			}
+		}
+	}
+}
+
 // fromLLMRequestStrippingAllThinking is like fromLLMRequest but strips thinking
 // blocks from ALL assistant messages (including the last one). Used as a fallback
 // when the API rejects thinking signatures — e.g. after model version rotation.
@@ -850,6 +886,7 @@ func (s *Service) fromLLMRequestStrippingAllThinking(r *llm.Request) *request {
 	}
 
 	applyAnthropicThinking(req, model, llm.EffectiveThinkingLevel(s.ThinkingLevel, r.ThinkingLevel), maxTokens)
+	applyResponseSchema(req, r.ResponseSchema)
 
 	if limit := s.maxOutputTokens(); req.MaxTokens > limit {
 		req.MaxTokens = limit
@@ -1067,13 +1104,20 @@ func truncateForError(data string, maxLen int) string {
 // parseSSEStream reads an SSE stream and assembles the complete response.
 // If onStream is non-nil, it is called with each text/thinking delta as it arrives.
 func parseSSEStream(r io.Reader, onStream func(llm.StreamDelta)) (*response, error) {
+	return parseStream(r, iterSSEEvents, onStream)
+}
+
+// parseStream assembles the complete response from the stream events that
+// iter decodes from r. Transports whose platforms frame the events
+// differently (see Bedrock) supply their own iter.
+func parseStream(r io.Reader, iter func(io.Reader, func(sseEvent) error) error, onStream func(llm.StreamDelta)) (*response, error) {
 	var (
 		resp        *response
 		contents    []content // indexed by content block index
 		messageDone bool
 	)
 
-	err := iterSSEEvents(r, func(sse sseEvent) error {
+	err := iter(r, func(sse sseEvent) error {
 		data := sse.Data
 		if data == "[DONE]" {
 			return nil
@@ -1219,13 +1263,10 @@ func parseSSEStream(r io.Reader, onStream func(llm.StreamDelta)) (*response, err
 // Do sends a streaming request to Anthropic and collects the full response.
 func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error) {
 	startTime := time.Now()
-	request := s.fromLLMRequest(ir)
-	request.Stream = true
-	payload, err := json.Marshal(request)
+	payload, err := s.marshalRequest(s.fromLLMRequest(ir))
 	if err != nil {
 		return nil, err
 	}
-	payload = append(payload, '\n')
 
 	// strippedPayload is built lazily on the first "Invalid signature" error.
 	// It strips ALL thinking blocks from the request as a fallback.
@@ -1248,6 +1289,11 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 	}
 
 	url := cmp.Or(s.URL, DefaultURL)
+	iter := iterSSEEvents
+	if s.Transport != nil {
+		url = s.Transport.endpoint()
+		iter = s.Transport.events
+	}
 	httpc := cmp.Or(s.HTTPC, http.DefaultClient)
 
 	// retry loop
@@ -1288,8 +1334,14 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 		}
 
 		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-API-Key", s.APIKey)
-		req.Header.Set("Anthropic-Version", "2023-06-01")
+		if s.Transport != nil {
+			if err := s.Transport.authorize(ctx, httpc, req, payload); err != nil {
+				return nil, errors.Join(errs, err)
+			}
+		} else {
+			req.Header.Set("X-API-Key", s.APIKey)
+			req.Header.Set("Anthropic-Version", "2023-06-01")
+		}
 
 		resp, err := httpc.Do(req)
 		if err != nil {
@@ -1304,7 +1356,7 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 
 		switch {
 		case resp.StatusCode == http.StatusOK:
-			response, err := parseSSEStream(resp.Body, ir.OnStream)
+			response, err := parseStream(resp.Body, iter, ir.OnStream)
 			resp.Body.Close()
 			if err != nil {
 				// Stream parse errors might be transient (connection reset, etc.)
@@ -1317,6 +1369,9 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 
 			endTime := time.Now()
 			result := toLLMResponse(response)
+			if len(ir.ResponseSchema) > 0 {
+				structuredResponse(result)
+			}
 			result.StartTime = &startTime
 			result.EndTime = &endTime
 			result.URL = url
@@ -1348,13 +1403,10 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 				if strippedPayload == nil && strings.Contains(string(buf), "Invalid `signature`") {
 					slog.WarnContext(ctx, "anthropic_invalid_thinking_signature, retrying without thinking blocks",
 						"response", string(buf), "url", url, "model", s.Model)
-					strippedReq := s.fromLLMRequestStrippingAllThinking(ir)
-					strippedReq.Stream = true
-					strippedPayload, err = json.Marshal(strippedReq)
+					strippedPayload, err = s.marshalRequest(s.fromLLMRequestStrippingAllThinking(ir))
 					if err != nil {
 						return nil, errors.Join(errs, fmt.Errorf("failed to marshal stripped request: %w", err))
 					}
-					strippedPayload = append(strippedPayload, '\n')
 					payload = strippedPayload
 					errs = errors.Join(errs, fmt.Errorf("attempt %d at %s: invalid thinking signature, retrying without thinking blocks", attempts+1, time.Now().Format(time.DateTime)))
 					continue
@@ -1381,9 +1433,29 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 func (s *Service) ConfigDetails() map[string]string {
 	model := cmp.Or(s.Model, DefaultModel)
 	url := cmp.Or(s.URL, DefaultURL)
+	if s.Transport != nil {
+		return map[string]string{
+			"url":       s.Transport.endpoint(),
+			"model":     model,
+			"transport": s.Transport.name(),
+		}
+	}
 	return map[string]string{
 		"url":             url,
 		"model":           model,
 		"has_api_key_set": fmt.Sprintf("%v", s.APIKey != ""),
 	}
 }
+
+// marshalRequest encodes a streaming request for the service's transport.
+func (s *Service) marshalRequest(r *request) ([]byte, error) {
+	r.Stream = true
+	if s.Transport != nil {
+		s.Transport.prepare(r)
+	}
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return append(payload, '\n'), nil
+}
@@ -3289,3 +3289,34 @@ func postRawAnthropic(t *testing.T, apiKey string, req *request) error {
 	}
 	return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
 }
+
+func TestResponseSchemaForcesTool(t *testing.T) {
+	s := &Service{Model: Claude46Sonnet, ThinkingLevel: llm.ThinkingLevelMedium}
+	schema := json.RawMessage(`{"type":"object","properties":{"slug":{"type":"string"}}}`)
+	got := s.fromLLMRequest(&llm.Request{
+		Messages:       []llm.Message{llm.UserStringMessage("name this")},
+		ResponseSchema: schema,
+	})
+	if len(got.Tools) != 1 || got.Tools[0].Name != llm.ResponseSchemaToolName || string(got.Tools[0].InputSchema) != string(schema) {
+		t.Fatalf("tools = %+v", got.Tools)
+	}
+	if got.ToolChoice == nil || got.ToolChoice.Type != "tool" || got.ToolChoice.Name != llm.ResponseSchemaToolName {
+		t.Errorf("tool choice = %+v", got.ToolChoice)
+	}
+	if got.Thinking != nil {
+		t.Error("thinking must be off when forcing a tool")
+	}
+
+	resp := &llm.Response{
+		StopReason: llm.StopReasonToolUse,
+		Content: []llm.Content{{
+			Type:      llm.ContentTypeToolUse,
+			ToolName:  llm.ResponseSchemaToolName,
+			ToolInput: json.RawMessage(`{"slug":"fix-tests"}`),
+		}},
+	}
+	structuredResponse(resp)
+	if resp.StopReason != llm.StopReasonEndTurn || resp.Content[0].Type != llm.ContentTypeText || resp.Content[0].Text != `{"slug":"fix-tests"}` {
+		t.Errorf("structured response = %+v", resp)
+	}
+}
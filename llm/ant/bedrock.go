@@ -0,0 +1,380 @@
+package ant
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// bedrockVersion is the anthropic_version Bedrock requires in request bodies.
+const bedrockVersion = "bedrock-2023-05-31"
+
+// AWSCredentials are the credentials Bedrock requests are signed with.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // set for temporary credentials
+}
+
+// AWSCredentialsFromEnv reads credentials from the standard AWS
+// environment variables.
+func AWSCredentialsFromEnv() AWSCredentials {
+	return AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// ParseAWSCredentials parses credentials written as
+// "ACCESS_KEY_ID:SECRET_ACCESS_KEY" or
+// "ACCESS_KEY_ID:SECRET_ACCESS_KEY:SESSION_TOKEN", the form custom models
+// store them in.
+func ParseAWSCredentials(s string) (AWSCredentials, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return AWSCredentials{}, errors.New("AWS credentials must be ACCESS_KEY_ID:SECRET_ACCESS_KEY[:SESSION_TOKEN]")
+	}
+	creds := AWSCredentials{AccessKeyID: parts[0], SecretAccessKey: parts[1]}
+	if len(parts) == 3 {
+		creds.SessionToken = parts[2]
+	}
+	return creds, nil
+}
+
+// Bedrock is a Transport for Claude on Amazon Bedrock. Requests go to
+// InvokeModelWithResponseStream, signed with AWS Signature Version 4, and
+// responses arrive as AWS event-stream frames wrapping the Anthropic
+// stream events.
+type Bedrock struct {
+	URL         string // bedrock-runtime endpoint; defaults to BedrockURL(Region)
+	Region      string // defaults to the region in URL
+	Model       string // Bedrock model or inference profile ID, e.g. "us.anthropic.claude-opus-4-6-v1"
+	Credentials AWSCredentials
+
+	now func() time.Time // for tests; defaults to time.Now
+}
+
+var _ Transport = (*Bedrock)(nil)
+
+// BedrockURL returns the public bedrock-runtime endpoint of an AWS region.
+func BedrockURL(region string) string {
+	return "https://bedrock-runtime." + region + ".amazonaws.com"
+}
+
+// BedrockRegion returns the AWS region of a bedrock-runtime endpoint,
+// including VPC endpoints such as
+// "https://vpce-0abc.bedrock-runtime.us-east-1.vpce.amazonaws.com", or ""
+// if the URL does not name one.
+func BedrockRegion(endpoint string) string {
+	_, rest, ok := strings.Cut(endpoint, "bedrock-runtime.")
+	if !ok {
+		return ""
+	}
+	region, _, _ := strings.Cut(rest, ".")
+	return region
+}
+
+// BedrockModelID returns the Bedrock model ID of an Anthropic model name:
+// "claude-sonnet-4-5-20250929" is "anthropic.claude-sonnet-4-5-20250929-v1:0"
+// and "claude-opus-4-6" is "anthropic.claude-opus-4-6-v1". Newer models are
+// only offered through inference profiles, whose IDs add a geography prefix
+// such as "us." or "global.".
+func BedrockModelID(model string) string {
+	if datedModel.MatchString(model) {
+		return "anthropic." + model + "-v1:0"
+	}
+	return "anthropic." + model + "-v1"
+}
+
+// ModelFromBedrock returns the Anthropic model name of a Bedrock model ID,
+// inference profile ID or inference profile ARN.
+func ModelFromBedrock(id string) string {
+	if i := strings.LastIndexByte(id, '/'); i >= 0 {
+		id = id[i+1:]
+	}
+	if _, model, ok := strings.Cut(id, "anthropic."); ok {
+		id = model
+	}
+	return bedrockVersionSuffix.ReplaceAllString(id, "")
+}
+
+var (
+	datedModel           = regexp.MustCompile(`-\d{8}$`)
+	bedrockVersionSuffix = regexp.MustCompile(`-v\d+(:\d+)?$`)
+)
+
+func (b *Bedrock) name() string { return "bedrock" }
+
+func (b *Bedrock) region() string {
+	return cmp.Or(b.Region, BedrockRegion(b.URL))
+}
+
+func (b *Bedrock) endpoint() string {
+	base := strings.TrimSuffix(cmp.Or(b.URL, BedrockURL(b.region())), "/")
+	return base + "/model/" + awsEscape(b.Model) + "/invoke-with-response-stream"
+}
+
+func (b *Bedrock) prepare(r *request) {
+	// The model is in the URL, and the endpoint decides whether to stream.
+	r.Model = ""
+	r.Stream = false
+	r.AnthropicVersion = bedrockVersion
+}
+
+func (b *Bedrock) authorize(ctx context.Context, httpc *http.Client, req *http.Request, payload []byte) error {
+	if b.Credentials.AccessKeyID == "" || b.Credentials.SecretAccessKey == "" {
+		return errors.New("bedrock: no AWS credentials")
+	}
+	region := b.region()
+	if region == "" {
+		return errors.New("bedrock: no AWS region")
+	}
+	now := time.Now
+	if b.now != nil {
+		now = b.now
+	}
+	req.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	signV4(req, payload, b.Credentials, region, "bedrock", now())
+	return nil
+}
+
+// events decodes the event-stream frames of an InvokeModelWithResponseStream
+// response. Each "chunk" event carries one Anthropic stream event, base64
+// encoded; exceptions, such as throttling mid-stream, end the stream with an
+// error.
+func (b *Bedrock) events(r io.Reader, yield func(sseEvent) error) error {
+	br := bufio.NewReader(r)
+	for {
+		msg, err := readEventStreamMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading Bedrock event stream: %w", err)
+		}
+		switch msg.headers[":message-type"] {
+		case "event":
+			if msg.headers[":event-type"] != "chunk" {
+				continue
+			}
+			var chunk struct {
+				Bytes []byte `json:"bytes"` // base64 in the JSON
+			}
+			if err := json.Unmarshal(msg.payload, &chunk); err != nil {
+				return fmt.Errorf("parsing Bedrock chunk: %w", err)
+			}
+			if err := yield(sseEvent{EventType: "chunk", Data: string(chunk.Bytes)}); err != nil {
+				return err
+			}
+		case "exception":
+			var exc struct {
+				Message string `json:"message"`
+			}
+			json.Unmarshal(msg.payload, &exc)
+			return fmt.Errorf("bedrock %s: %s", msg.headers[":exception-type"], cmp.Or(exc.Message, string(msg.payload)))
+		default:
+			return fmt.Errorf("bedrock %s: %s", msg.headers[":error-code"], msg.headers[":error-message"])
+		}
+	}
+}
+
+// eventStreamMessage is one frame of the AWS event-stream encoding. Only
+// string header values are kept; Bedrock sends no others.
+type eventStreamMessage struct {
+	headers map[string]string
+	payload []byte
+}
+
+// maxEventStreamMessage bounds a frame, so a corrupt length cannot make us
+// allocate without limit.
+const maxEventStreamMessage = 16 << 20
+
+// readEventStreamMessage reads one frame: a prelude of total length,
+// headers length and prelude CRC, then the headers, the payload and a CRC
+// of everything before it. It returns io.EOF only between frames.
+func readEventStreamMessage(r io.Reader) (*eventStreamMessage, error) {
+	var prelude [12]byte
+	if _, err := io.ReadFull(r, prelude[:]); err != nil {
+		return nil, err
+	}
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, errors.New("prelude checksum mismatch")
+	}
+	if total < 16 || total > maxEventStreamMessage || headersLen > total-16 {
+		return nil, fmt.Errorf("bad frame lengths %d and %d", total, headersLen)
+	}
+	frame := make([]byte, total)
+	copy(frame, prelude[:])
+	if _, err := io.ReadFull(r, frame[12:]); err != nil {
+		return nil, fmt.Errorf("truncated frame: %w", noEOF(err))
+	}
+	if crc32.ChecksumIEEE(frame[:total-4]) != binary.BigEndian.Uint32(frame[total-4:]) {
+		return nil, errors.New("message checksum mismatch")
+	}
+	headers, err := parseEventStreamHeaders(frame[12 : 12+headersLen])
+	if err != nil {
+		return nil, err
+	}
+	return &eventStreamMessage{headers: headers, payload: frame[12+headersLen : total-4]}, nil
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF: inside a frame, the end of
+// the stream means it was cut short.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// eventStreamValueSizes gives the size of each fixed-size header value
+// type; -1 marks the length-prefixed byte array (6) and string (7) types.
+var eventStreamValueSizes = [...]int{0, 0, 1, 2, 4, 8, -1, -1, 8, 16}
+
+func parseEventStreamHeaders(b []byte) (map[string]string, error) {
+	headers := map[string]string{}
+	errShort := errors.New("truncated event-stream headers")
+	for len(b) > 0 {
+		n := int(b[0])
+		if len(b) < 1+n+1 {
+			return nil, errShort
+		}
+		name := string(b[1 : 1+n])
+		typ := int(b[1+n])
+		b = b[2+n:]
+		if typ >= len(eventStreamValueSizes) {
+			return nil, fmt.Errorf("unknown event-stream header type %d", typ)
+		}
+		size := eventStreamValueSizes[typ]
+		if size < 0 {
+			if len(b) < 2 {
+				return nil, errShort
+			}
+			size = int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+		}
+		if len(b) < size {
+			return nil, errShort
+		}
+		if typ == 7 {
+			headers[name] = string(b[:size])
+		}
+		b = b[size:]
+	}
+	return headers, nil
+}
+
+// signV4 signs req, whose body is payload, with AWS Signature Version 4.
+// It signs the host, the content type and every X-Amz-* header.
+// See https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html
+func signV4(req *http.Request, payload []byte, creds AWSCredentials, region, service string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": cmp.Or(req.Host, req.URL.Host)}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// Non-S3 services encode each path segment twice: once on the wire,
+	// and again here.
+	segments := strings.Split(req.URL.EscapedPath(), "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	canonicalURI := cmp.Or(strings.Join(segments, "/"), "/")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var params []string
+	for _, k := range keys {
+		values := slices.Sorted(slices.Values(query[k]))
+		for _, v := range values {
+			params = append(params, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(payload),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but the RFC 3986 unreserved
+// characters, as SigV4 requires.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
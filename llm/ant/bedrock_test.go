@@ -0,0 +1,172 @@
+package ant
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+// encodeEventStreamMessage frames payload with string headers the way
+// Bedrock does.
+func encodeEventStreamMessage(headers map[string]string, payload []byte) []byte {
+	var hdrs bytes.Buffer
+	for name, value := range headers {
+		hdrs.WriteByte(byte(len(name)))
+		hdrs.WriteString(name)
+		hdrs.WriteByte(7)
+		binary.Write(&hdrs, binary.BigEndian, uint16(len(value)))
+		hdrs.WriteString(value)
+	}
+	total := 12 + hdrs.Len() + len(payload) + 4
+	var msg bytes.Buffer
+	binary.Write(&msg, binary.BigEndian, uint32(total))
+	binary.Write(&msg, binary.BigEndian, uint32(hdrs.Len()))
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(hdrs.Bytes())
+	msg.Write(payload)
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+// bedrockStream wraps each event of an Anthropic SSE stream in a Bedrock
+// chunk frame.
+func bedrockStream(t *testing.T, sse string) []byte {
+	var out bytes.Buffer
+	err := iterSSEEvents(strings.NewReader(sse), func(ev sseEvent) error {
+		payload, err := json.Marshal(map[string][]byte{"bytes": []byte(ev.Data)})
+		if err != nil {
+			return err
+		}
+		out.Write(encodeEventStreamMessage(map[string]string{":message-type": "event", ":event-type": "chunk", ":content-type": "application/json"}, payload))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// TestSignV4 checks the signer against the get-vanilla case of the AWS
+// Signature Version 4 test suite.
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestBedrockModelIDs(t *testing.T) {
+	for _, tc := range []struct{ model, bedrock string }{
+		{Claude45Sonnet, "anthropic.claude-sonnet-4-5-20250929-v1:0"},
+		{Claude46Opus, "anthropic.claude-opus-4-6-v1"},
+	} {
+		if got := BedrockModelID(tc.model); got != tc.bedrock {
+			t.Errorf("BedrockModelID(%q) = %q, want %q", tc.model, got, tc.bedrock)
+		}
+		if got := ModelFromBedrock("us." + tc.bedrock); got != tc.model {
+			t.Errorf("ModelFromBedrock(us.%s) = %q, want %q", tc.bedrock, got, tc.model)
+		}
+	}
+	if got := ModelFromBedrock("arn:aws:bedrock:us-east-1:123456789012:inference-profile/global.anthropic.claude-opus-4-6-v1"); got != Claude46Opus {
+		t.Errorf("ModelFromBedrock(ARN) = %q", got)
+	}
+	if got := BedrockRegion("https://vpce-0abc.bedrock-runtime.eu-west-1.vpce.amazonaws.com"); got != "eu-west-1" {
+		t.Errorf("BedrockRegion = %q", got)
+	}
+	if _, err := ParseAWSCredentials("AKID"); err == nil {
+		t.Error("ParseAWSCredentials accepted a bare key ID")
+	}
+	if c, err := ParseAWSCredentials("AKID:secret:tok:en"); err != nil || c.SessionToken != "tok:en" {
+		t.Errorf("ParseAWSCredentials = %+v, %v", c, err)
+	}
+}
+
+func TestBedrockDo(t *testing.T) {
+	var gotPath, gotAuth, gotToken string
+	var gotBody map[string]json.RawMessage
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// Bedrock throttles with a 429 before the stream starts.
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message":"Too many requests"}`))
+			return
+		}
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization")
+		gotToken = r.Header.Get("X-Amz-Security-Token")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &gotBody)
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		w.Write(bedrockStream(t, mockSSEResponse("msg_1", Claude45Sonnet, "Hello from Bedrock", 10, 5)))
+	}))
+	defer srv.Close()
+
+	svc := &Service{
+		Model:         Claude45Sonnet,
+		ThinkingLevel: llm.ThinkingLevelMedium,
+		Backoff:       []time.Duration{time.Millisecond},
+		Transport: &Bedrock{
+			URL:         srv.URL,
+			Region:      "us-east-1",
+			Model:       "anthropic.claude-sonnet-4-5-20250929-v1:0",
+			Credentials: AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"},
+		},
+	}
+	resp, err := svc.Do(context.Background(), &llm.Request{Messages: []llm.Message{llm.UserStringMessage("hi")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Content) != 1 || resp.Content[0].Text != "Hello from Bedrock" || resp.Usage.OutputTokens != 5 {
+		t.Errorf("response = %+v", resp)
+	}
+	if gotPath != "/model/anthropic.claude-sonnet-4-5-20250929-v1%3A0/invoke-with-response-stream" {
+		t.Errorf("path = %s", gotPath)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(gotAuth, "/us-east-1/bedrock/aws4_request") || gotToken != "session" {
+		t.Errorf("Authorization = %q, token %q", gotAuth, gotToken)
+	}
+	if string(gotBody["anthropic_version"]) != `"bedrock-2023-05-31"` || gotBody["model"] != nil || gotBody["stream"] != nil || gotBody["thinking"] == nil {
+		t.Errorf("body = %v", gotBody)
+	}
+	if svc.SupportsServerSideWebSearch() {
+		t.Error("Bedrock services should not offer server-side web search")
+	}
+}
+
+func TestBedrockEvents(t *testing.T) {
+	b := &Bedrock{}
+	stream := bedrockStream(t, mockSSEResponse("msg_1", "m", "partial", 1, 1))
+	exception := encodeEventStreamMessage(map[string]string{":message-type": "exception", ":exception-type": "throttlingException"}, []byte(`{"message":"slow down"}`))
+
+	// An exception mid-stream fails the stream, so Do retries it.
+	first := binary.BigEndian.Uint32(stream)
+	withException := append(bytes.Clone(stream[:first]), exception...)
+	_, err := parseStream(bytes.NewReader(withException), b.events, nil)
+	if err == nil || !strings.Contains(err.Error(), "throttlingException: slow down") {
+		t.Errorf("exception err = %v", err)
+	}
+
+	corrupt := bytes.Clone(stream)
+	corrupt[20] ^= 0xff
+	if _, err := parseStream(bytes.NewReader(corrupt), b.events, nil); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("corrupt frame err = %v", err)
+	}
+	if _, err := parseStream(bytes.NewReader(stream[:len(stream)-3]), b.events, nil); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("truncated frame err = %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package ant
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// A Transport carries Messages API requests to a cloud platform that
+// serves Claude, instead of to the Anthropic API. The request and response
+// bodies are the Anthropic ones, so thinking, caching, tools and images
+// work unchanged; only the endpoint, authentication and stream framing
+// differ. The implementations are Bedrock and Vertex.
+type Transport interface {
+	// name identifies the transport in ConfigDetails.
+	name() string
+	// endpoint is the URL streaming requests are posted to.
+	endpoint() string
+	// prepare adapts a streaming request body to the platform.
+	prepare(r *request)
+	// authorize adds the platform's credentials to req, whose body is payload.
+	authorize(ctx context.Context, httpc *http.Client, req *http.Request, payload []byte) error
+	// events decodes the stream events of a successful response.
+	events(r io.Reader, yield func(sseEvent) error) error
+}
@@ -0,0 +1,231 @@
+package ant
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vertexVersion is the anthropic_version Vertex AI requires in request bodies.
+const vertexVersion = "vertex-2023-10-16"
+
+// vertexScope is the OAuth scope Vertex AI calls need.
+const vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Vertex is a Transport for Claude on Google Cloud Vertex AI. Requests go
+// to the model's streamRawPredict method (Shelley always streams, so never
+// to rawPredict) with an OAuth access token minted from a service account.
+// Responses are ordinary Anthropic SSE streams.
+type Vertex struct {
+	URL     string // the Anthropic publisher's models; see VertexURL
+	Model   string // Vertex model ID, e.g. "claude-sonnet-4-5@20250929"
+	Account *GoogleServiceAccount
+}
+
+var _ Transport = (*Vertex)(nil)
+
+// VertexURL returns the URL under which Vertex AI serves Anthropic's models
+// in a project and region. The region may be "global".
+func VertexURL(project, region string) string {
+	host := region + "-aiplatform.googleapis.com"
+	if region == "global" {
+		host = "aiplatform.googleapis.com"
+	}
+	return "https://" + host + "/v1/projects/" + project + "/locations/" + region + "/publishers/anthropic/models"
+}
+
+// VertexModelID returns the Vertex model ID of an Anthropic model name:
+// "claude-sonnet-4-5-20250929" is "claude-sonnet-4-5@20250929", and
+// undated names are the same on Vertex.
+func VertexModelID(model string) string {
+	if loc := datedModel.FindStringIndex(model); loc != nil {
+		return model[:loc[0]] + "@" + model[loc[0]+1:]
+	}
+	return model
+}
+
+// ModelFromVertex returns the Anthropic model name of a Vertex model ID.
+func ModelFromVertex(id string) string {
+	return strings.Replace(id, "@", "-", 1)
+}
+
+func (v *Vertex) name() string { return "vertex" }
+
+func (v *Vertex) endpoint() string {
+	return strings.TrimSuffix(v.URL, "/") + "/" + v.Model + ":streamRawPredict"
+}
+
+func (v *Vertex) prepare(r *request) {
+	// The model is in the URL.
+	r.Model = ""
+	r.AnthropicVersion = vertexVersion
+}
+
+func (v *Vertex) authorize(ctx context.Context, httpc *http.Client, req *http.Request, payload []byte) error {
+	if v.Account == nil {
+		return errors.New("vertex: no service account")
+	}
+	token, err := v.Account.Token(ctx, httpc)
+	if err != nil {
+		return fmt.Errorf("vertex: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (v *Vertex) events(r io.Reader, yield func(sseEvent) error) error {
+	return iterSSEEvents(r, yield)
+}
+
+// GoogleServiceAccount mints OAuth access tokens for a Google Cloud service
+// account using the JWT bearer grant, caching each token until shortly
+// before it expires. It is safe for concurrent use, so one account can back
+// every Vertex model.
+type GoogleServiceAccount struct {
+	ProjectID string // the project the account belongs to
+
+	email    string
+	keyID    string
+	tokenURI string
+	key      *rsa.PrivateKey
+	now      func() time.Time // for tests; defaults to time.Now
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// ParseGoogleServiceAccount parses a service-account key file, the JSON
+// the Google Cloud console downloads.
+func ParseGoogleServiceAccount(data []byte) (*GoogleServiceAccount, error) {
+	var f struct {
+		Type         string `json:"type"`
+		ProjectID    string `json:"project_id"`
+		PrivateKeyID string `json:"private_key_id"`
+		PrivateKey   string `json:"private_key"`
+		ClientEmail  string `json:"client_email"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing service account: %w", err)
+	}
+	if f.Type != "service_account" {
+		return nil, fmt.Errorf("credentials are of type %q, want %q", f.Type, "service_account")
+	}
+	if f.ClientEmail == "" || f.PrivateKey == "" {
+		return nil, errors.New("service account has no client_email or private_key")
+	}
+	block, _ := pem.Decode([]byte(f.PrivateKey))
+	if block == nil {
+		return nil, errors.New("service account private_key is not PEM")
+	}
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("service account private_key is %T, want RSA", parsed)
+		}
+	} else if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return nil, fmt.Errorf("parsing service account private_key: %w", err)
+	}
+	tokenURI := f.TokenURI
+	if tokenURI == "" {
+		tokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &GoogleServiceAccount{
+		ProjectID: f.ProjectID,
+		email:     f.ClientEmail,
+		keyID:     f.PrivateKeyID,
+		tokenURI:  tokenURI,
+		key:       key,
+	}, nil
+}
+
+// Token returns an access token for the cloud-platform scope.
+func (a *GoogleServiceAccount) Token(ctx context.Context, httpc *http.Client) (string, error) {
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && now().Add(time.Minute).Before(a.expiry) {
+		return a.token, nil
+	}
+
+	assertion, err := a.assertion(now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", a.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if httpc == nil {
+		httpc = http.DefaultClient
+	}
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching access token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching access token: status %s: %s", resp.Status, body)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil || tok.AccessToken == "" {
+		return "", fmt.Errorf("fetching access token: bad response %s", body)
+	}
+	a.token = tok.AccessToken
+	a.expiry = now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return a.token, nil
+}
+
+// assertion is the signed JWT exchanged for an access token.
+func (a *GoogleServiceAccount) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": a.keyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   a.email,
+		"scope": vertexScope,
+		"aud":   a.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("signing token request: %w", err)
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
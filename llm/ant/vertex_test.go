@@ -0,0 +1,144 @@
+package ant
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"shelley.exe.dev/llm"
+)
+
+// testServiceAccount returns a service-account key file whose tokens are
+// minted at tokenURI, and the key it signs with.
+func testServiceAccount(t *testing.T, tokenURI string) ([]byte, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "my-project",
+		"private_key_id": "key1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "shelley@my-project.iam.gserviceaccount.com",
+		"token_uri":      tokenURI,
+	})
+	return data, key
+}
+
+func TestVertexDo(t *testing.T) {
+	var key *rsa.PrivateKey
+	var tokenCalls atomic.Int32
+	var gotPath, gotAuth string
+	var gotBody map[string]json.RawMessage
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		tokenCalls.Add(1)
+		r.ParseForm()
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if !strings.Contains(string(claims), `"scope":"https://www.googleapis.com/auth/cloud-platform"`) {
+			http.Error(w, `{"error":"invalid_scope"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`))
+	})
+	mux.HandleFunc("POST /v1/", func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &gotBody)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(mockSSEResponse("msg_1", Claude45Sonnet, "Hello from Vertex", 10, 5)))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var creds []byte
+	creds, key = testServiceAccount(t, srv.URL+"/token")
+	account, err := ParseGoogleServiceAccount(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ProjectID != "my-project" {
+		t.Errorf("ProjectID = %q", account.ProjectID)
+	}
+	svc := &Service{
+		Model:           Claude45Sonnet,
+		ThinkingLevel:   llm.ThinkingLevelMedium,
+		SupportsImages_: true,
+		Transport: &Vertex{
+			URL:     srv.URL + "/v1/projects/my-project/locations/us-east5/publishers/anthropic/models",
+			Model:   VertexModelID(Claude45Sonnet),
+			Account: account,
+		},
+	}
+	for range 2 {
+		resp, err := svc.Do(context.Background(), &llm.Request{Messages: []llm.Message{llm.UserStringMessage("hi")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Content) != 1 || resp.Content[0].Text != "Hello from Vertex" {
+			t.Errorf("response = %+v", resp)
+		}
+	}
+	if n := tokenCalls.Load(); n != 1 {
+		t.Errorf("fetched %d access tokens, want 1 cached", n)
+	}
+	if gotPath != "/v1/projects/my-project/locations/us-east5/publishers/anthropic/models/claude-sonnet-4-5@20250929:streamRawPredict" {
+		t.Errorf("path = %s", gotPath)
+	}
+	if gotAuth != "Bearer ya29.token" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	if string(gotBody["anthropic_version"]) != `"vertex-2023-10-16"` || gotBody["model"] != nil || string(gotBody["stream"]) != "true" || gotBody["thinking"] == nil {
+		t.Errorf("body = %v", gotBody)
+	}
+	if !svc.SupportsServerSideWebSearch() {
+		t.Error("Vertex services should offer server-side web search")
+	}
+}
+
+func TestVertexModelIDs(t *testing.T) {
+	if got := VertexModelID(Claude45Sonnet); got != "claude-sonnet-4-5@20250929" {
+		t.Errorf("VertexModelID(%q) = %q", Claude45Sonnet, got)
+	}
+	if got := VertexModelID(Claude46Opus); got != Claude46Opus {
+		t.Errorf("VertexModelID(%q) = %q", Claude46Opus, got)
+	}
+	if got := ModelFromVertex("claude-sonnet-4-5@20250929"); got != Claude45Sonnet {
+		t.Errorf("ModelFromVertex = %q", got)
+	}
+	if got := VertexURL("p", "global"); got != "https://aiplatform.googleapis.com/v1/projects/p/locations/global/publishers/anthropic/models" {
+		t.Errorf("VertexURL(global) = %q", got)
+	}
+	if _, err := ParseGoogleServiceAccount([]byte(`{"type":"authorized_user"}`)); err == nil {
+		t.Error("ParseGoogleServiceAccount accepted user credentials")
+	}
+}
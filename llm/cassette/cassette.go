@@ -0,0 +1,470 @@
+// Package cassette records the requests and responses of llm.Services into
+// a file and replays them, so a conversation held with a real model can be
+// run again offline, deterministically, as a regression test.
+//
+// A cassette is a JSON Lines file. Each line is an entry: either the
+// capabilities of a model (written the first time the model is used) or
+// one request to a model together with its response or error. Requests are
+// normalized before they are stored: prompt-cache flags, timings and
+// display-only fields are dropped, image data is replaced by its hash, and
+// the system prompt and tool descriptions are left out, since they mention
+// dates and directories that differ from run to run. The names of the tools
+// offered are recorded but not matched on, so adding a tool to Shelley does
+// not invalidate every cassette.
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"shelley.exe.dev/llm"
+)
+
+// Mode says whether a Cassette records or replays.
+type Mode int
+
+const (
+	// Record passes requests on to the wrapped services and appends them,
+	// with their responses, to the cassette.
+	Record Mode = iota
+	// Replay answers requests from the cassette without any service.
+	Replay
+)
+
+// ParseMode parses "record" or "replay".
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "record":
+		return Record, nil
+	case "replay":
+		return Replay, nil
+	}
+	return 0, fmt.Errorf("unknown cassette mode %q (want record or replay)", s)
+}
+
+// Cassette is an open cassette file. It is safe for concurrent use.
+type Cassette struct {
+	path string
+	mode Mode
+
+	mu         sync.Mutex
+	file       *os.File                // Record
+	written    map[string]bool         // Record: models whose ServiceInfo is written
+	models     map[string]*ServiceInfo // Replay, in order of modelOrder
+	modelOrder []string
+	entries    []entry          // Replay: the recorded requests
+	byKey      map[string][]int // Replay: indexes into entries, by request key
+	used       []bool
+	mismatches []error
+}
+
+// ServiceInfo is what a cassette knows about a model besides its answers:
+// the capabilities its llm.Service reports.
+type ServiceInfo struct {
+	Provider              string   `json:"provider,omitempty"`
+	TokenContextWindow    int      `json:"token_context_window,omitempty"`
+	MaxImageDimension     int      `json:"max_image_dimension,omitempty"`
+	MaxImageBytes         int      `json:"max_image_bytes,omitempty"`
+	SupportsImages        bool     `json:"supports_images,omitempty"`
+	SupportsReasoning     bool     `json:"supports_reasoning,omitempty"`
+	ReasoningLevels       []string `json:"reasoning_levels,omitempty"`
+	DefaultReasoningLevel string   `json:"default_reasoning_level,omitempty"`
+	SimplifiedPatch       bool     `json:"simplified_patch,omitempty"`
+	ServerSideWebSearch   bool     `json:"server_side_web_search,omitempty"`
+}
+
+// Request is a normalized llm.Request.
+type Request struct {
+	Messages      []Message       `json:"messages"`
+	Tools         []string        `json:"tools,omitempty"`
+	ToolChoice    *llm.ToolChoice `json:"tool_choice,omitempty"`
+	ThinkingLevel string          `json:"thinking_level,omitempty"`
+}
+
+// Message is a normalized llm.Message.
+type Message struct {
+	Role    string    `json:"role"`
+	Content []Content `json:"content"`
+}
+
+// Content is a normalized llm.Content.
+type Content struct {
+	Type       string          `json:"type"`
+	ID         string          `json:"id,omitempty"`
+	Text       string          `json:"text,omitempty"`
+	MediaType  string          `json:"media_type,omitempty"`
+	DataSHA256 string          `json:"data_sha256,omitempty"`
+	Thinking   string          `json:"thinking,omitempty"`
+	ToolName   string          `json:"tool_name,omitempty"`
+	ToolInput  json.RawMessage `json:"tool_input,omitempty"`
+	ToolUseID  string          `json:"tool_use_id,omitempty"`
+	ToolError  bool            `json:"tool_error,omitempty"`
+	ToolResult []Content       `json:"tool_result,omitempty"`
+}
+
+// entry is one line of a cassette: a model's ServiceInfo, or a request
+// and its outcome.
+type entry struct {
+	Model    string        `json:"model"`
+	Service  *ServiceInfo  `json:"service,omitempty"`
+	Request  *Request      `json:"request,omitempty"`
+	Response *llm.Response `json:"response,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Open opens the cassette at path. In Record mode the file is created if
+// needed and appended to; in Replay mode it must exist.
+func Open(path string, mode Mode) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode}
+	if mode == Record {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("cassette: %w", err)
+		}
+		c.file = f
+		c.written = map[string]bool{}
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: %w", err)
+	}
+	c.models = map[string]*ServiceInfo{}
+	c.byKey = map[string][]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("cassette: %s:%d: %w", path, line, err)
+		}
+		switch {
+		case e.Service != nil:
+			if c.models[e.Model] == nil {
+				c.modelOrder = append(c.modelOrder, e.Model)
+			}
+			c.models[e.Model] = e.Service
+		case e.Request != nil:
+			key := requestKey(e.Model, e.Request)
+			c.byKey[key] = append(c.byKey[key], len(c.entries))
+			c.entries = append(c.entries, e)
+		default:
+			return nil, fmt.Errorf("cassette: %s:%d: neither a service nor a request", path, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cassette: %s: %w", path, err)
+	}
+	c.used = make([]bool, len(c.entries))
+	return c, nil
+}
+
+// Mode returns the mode the cassette was opened in.
+func (c *Cassette) Mode() Mode { return c.mode }
+
+// Close closes the cassette's file.
+func (c *Cassette) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+// Models returns the IDs of the models a replayed cassette has answers
+// from, in the order they first appear.
+func (c *Cassette) Models() []string {
+	return slices.Clone(c.modelOrder)
+}
+
+// Wrap returns a service for modelID that records the requests it passes
+// on to svc, or, in Replay mode, answers them from the cassette. A replayed
+// model that the cassette has no record of reports zero capabilities; svc
+// may be nil in Replay mode.
+func (c *Cassette) Wrap(modelID string, svc llm.Service) llm.Service {
+	s := &service{c: c, model: modelID, inner: svc}
+	if c.mode == Replay {
+		s.info = c.models[modelID]
+		if s.info == nil {
+			s.info = &ServiceInfo{}
+		}
+		return s
+	}
+	s.info = describe(svc)
+	return s
+}
+
+// Unused returns how many recorded requests have not been replayed.
+func (c *Cassette) Unused() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, u := range c.used {
+		if !u {
+			n++
+		}
+	}
+	return n
+}
+
+// Err returns the mismatches met while replaying: one error for each
+// request the cassette had no answer for.
+func (c *Cassette) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return errors.Join(c.mismatches...)
+}
+
+// describe captures svc's capabilities.
+func describe(svc llm.Service) *ServiceInfo {
+	info := &ServiceInfo{
+		Provider:              svc.Provider(),
+		TokenContextWindow:    svc.TokenContextWindow(),
+		MaxImageDimension:     svc.MaxImageDimension(),
+		MaxImageBytes:         svc.MaxImageBytes(),
+		SupportsImages:        svc.SupportsImages(),
+		SupportsReasoning:     llm.SupportsReasoning(svc),
+		DefaultReasoningLevel: llm.ServiceDefaultReasoningLevel(svc),
+		SimplifiedPatch:       llm.UseSimplifiedPatch(svc),
+	}
+	for _, level := range llm.SupportedReasoningLevels(svc) {
+		info.ReasoningLevels = append(info.ReasoningLevels, level.Name())
+	}
+	if ws, ok := svc.(interface{ SupportsServerSideWebSearch() bool }); ok {
+		info.ServerSideWebSearch = ws.SupportsServerSideWebSearch()
+	}
+	return info
+}
+
+// record appends a request and its outcome to the cassette, preceded by
+// the model's ServiceInfo the first time the model is seen.
+func (c *Cassette) record(model string, info *ServiceInfo, req *Request, resp *llm.Response, err error) error {
+	e := entry{Model: model, Request: req, Response: resp}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	line, merr := json.Marshal(e)
+	if merr != nil {
+		return merr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.written[model] {
+		header, err := json.Marshal(entry{Model: model, Service: info})
+		if err != nil {
+			return err
+		}
+		if _, err := c.file.Write(append(header, '\n')); err != nil {
+			return err
+		}
+		c.written[model] = true
+	}
+	_, werr := c.file.Write(append(line, '\n'))
+	return werr
+}
+
+// replay returns the first unused recorded entry for req, or a mismatch
+// error that points at the nearest recorded request.
+func (c *Cassette) replay(model string, req *Request) (entry, error) {
+	key := requestKey(model, req)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, i := range c.byKey[key] {
+		if !c.used[i] {
+			c.used[i] = true
+			return c.entries[i], nil
+		}
+	}
+	err := c.mismatch(model, key)
+	c.mismatches = append(c.mismatches, err)
+	return entry{}, err
+}
+
+// mismatch describes a request with key that the cassette has no answer
+// for, by comparing it with the unused recorded request to the same model
+// that shares the longest prefix with it.
+func (c *Cassette) mismatch(model, key string) error {
+	best, bestLen := -1, -1
+	for i, e := range c.entries {
+		if c.used[i] || e.Model != model {
+			continue
+		}
+		recorded := requestKey(model, e.Request)
+		n := 0
+		for n < len(recorded) && n < len(key) && recorded[n] == key[n] {
+			n++
+		}
+		if n > bestLen {
+			best, bestLen = i, n
+		}
+	}
+	if best < 0 {
+		return fmt.Errorf("cassette %s has no unused request to %s left", c.path, model)
+	}
+	recorded := requestKey(model, c.entries[best].Request)
+	return fmt.Errorf("cassette %s has no answer for this request to %s; the nearest recorded request differs at byte %d: recorded %q, got %q",
+		c.path, model, bestLen, excerpt(recorded, bestLen), excerpt(key, bestLen))
+}
+
+// excerpt returns the text of s around offset.
+func excerpt(s string, offset int) string {
+	const context = 60
+	start, end := max(offset-context, 0), min(offset+context, len(s))
+	return s[start:end]
+}
+
+// requestKey is the canonical form of a request to model, which replayed
+// requests are matched by. It leaves out the tools offered: a request that
+// only differs in them gets the same answer.
+func requestKey(model string, req *Request) string {
+	matched := *req
+	matched.Tools = nil
+	data, _ := json.Marshal(struct {
+		Model   string   `json:"model"`
+		Request *Request `json:"request"`
+	}{model, &matched})
+	return string(data)
+}
+
+// normalize converts req to the form it is recorded and matched in.
+func normalize(req *llm.Request) *Request {
+	out := &Request{ToolChoice: req.ToolChoice, ThinkingLevel: req.ThinkingLevel.Name()}
+	for _, t := range req.Tools {
+		out.Tools = append(out.Tools, t.Name)
+	}
+	for _, m := range req.Messages {
+		out.Messages = append(out.Messages, Message{Role: snakeName(m.Role.String(), "MessageRole"), Content: normalizeContents(m.Content)})
+	}
+	return out
+}
+
+func normalizeContents(contents []llm.Content) []Content {
+	var out []Content
+	for _, c := range contents {
+		nc := Content{
+			Type:       snakeName(c.Type.String(), "ContentType"),
+			ID:         c.ID,
+			Text:       c.Text,
+			MediaType:  c.MediaType,
+			Thinking:   c.Thinking,
+			ToolName:   c.ToolName,
+			ToolUseID:  c.ToolUseID,
+			ToolError:  c.ToolError,
+			ToolResult: normalizeContents(c.ToolResult),
+		}
+		if c.Data != "" {
+			sum := sha256.Sum256([]byte(c.Data))
+			nc.DataSHA256 = hex.EncodeToString(sum[:])
+		}
+		// Messages read back from the database carry a null input on
+		// blocks that had none.
+		if len(c.ToolInput) > 0 && string(c.ToolInput) != "null" {
+			var buf bytes.Buffer
+			if json.Compact(&buf, c.ToolInput) == nil {
+				nc.ToolInput = buf.Bytes()
+			} else {
+				nc.ToolInput = c.ToolInput
+			}
+		}
+		out = append(out, nc)
+	}
+	return out
+}
+
+// snakeName turns a stringer name such as ContentTypeToolUse into
+// tool_use, dropping prefix.
+func snakeName(name, prefix string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimPrefix(name, prefix) {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// service is a model seen through a cassette.
+type service struct {
+	c     *Cassette
+	model string
+	inner llm.Service // nil when replaying
+	info  *ServiceInfo
+}
+
+func (s *service) Do(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	normalized := normalize(req)
+	if s.c.mode == Record {
+		resp, err := s.inner.Do(ctx, req)
+		// A cancelled request says nothing about the model.
+		if ctx.Err() == nil {
+			if rerr := s.c.record(s.model, s.info, normalized, resp, err); rerr != nil {
+				return nil, fmt.Errorf("cassette: failed to record: %w", rerr)
+			}
+		}
+		return resp, err
+	}
+
+	e, err := s.c.replay(s.model, normalized)
+	if err != nil {
+		return nil, err
+	}
+	if e.Error != "" {
+		return nil, errors.New(e.Error)
+	}
+	resp := *e.Response
+	// Recorded times are shifted to now, keeping the recorded duration.
+	if resp.StartTime != nil && resp.EndTime != nil {
+		end := time.Now()
+		start := end.Add(-resp.EndTime.Sub(*resp.StartTime))
+		resp.StartTime, resp.EndTime = &start, &end
+	}
+	if req.OnStream != nil {
+		for i, c := range resp.Content {
+			switch {
+			case c.Type == llm.ContentTypeText && c.Text != "":
+				req.OnStream(llm.StreamDelta{Type: "text", Text: c.Text, Index: i})
+			case c.Type == llm.ContentTypeThinking && c.Thinking != "":
+				req.OnStream(llm.StreamDelta{Type: "thinking", Text: c.Thinking, Index: i})
+			}
+		}
+	}
+	return &resp, nil
+}
+
+func (s *service) Provider() string         { return s.info.Provider }
+func (s *service) TokenContextWindow() int  { return s.info.TokenContextWindow }
+func (s *service) MaxImageDimension() int   { return s.info.MaxImageDimension }
+func (s *service) MaxImageBytes() int       { return s.info.MaxImageBytes }
+func (s *service) SupportsImages() bool     { return s.info.SupportsImages }
+func (s *service) SupportsReasoning() bool  { return s.info.SupportsReasoning }
+func (s *service) UseSimplifiedPatch() bool { return s.info.SimplifiedPatch }
+
+func (s *service) SupportedReasoningLevels() []llm.ThinkingLevel {
+	var levels []llm.ThinkingLevel
+	for _, name := range s.info.ReasoningLevels {
+		levels = append(levels, llm.ParseThinkingLevel(name))
+	}
+	return levels
+}
+
+func (s *service) DefaultReasoningLevel() string     { return s.info.DefaultReasoningLevel }
+func (s *service) SupportsServerSideWebSearch() bool { return s.info.ServerSideWebSearch }
@@ -0,0 +1,160 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/llm"
+	"shelley.exe.dev/loop"
+)
+
+// failingService fails every request with err.
+type failingService struct {
+	llm.Service
+	err error
+}
+
+func (f *failingService) Do(context.Context, *llm.Request) (*llm.Response, error) {
+	return nil, f.err
+}
+
+func userRequest(text string) *llm.Request {
+	return &llm.Request{
+		Messages: []llm.Message{llm.UserStringMessage(text)},
+		System:   []llm.SystemContent{{Text: "It is " + time.Now().String()}},
+		Tools:    []*llm.Tool{{Name: "bash", Description: "runs commands"}},
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.cassette")
+
+	rec, err := Open(path, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := loop.NewPredictableService()
+	svc := rec.Wrap("model-a", ps)
+	want := map[string]string{}
+	for _, text := range []string{"echo: one", "echo: two"} {
+		resp, err := svc.Do(ctx, userRequest(text))
+		if err != nil {
+			t.Fatalf("record %q: %v", text, err)
+		}
+		want[text] = resp.Content[0].Text
+	}
+	failing := rec.Wrap("model-b", &failingService{ps, errors.New("status 529: overloaded")})
+	if _, err := failing.Do(ctx, userRequest("echo: one")); err == nil {
+		t.Fatal("expected the failure to pass through")
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	play, err := Open(path, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := play.Models(); len(got) != 2 || got[0] != "model-a" || got[1] != "model-b" {
+		t.Errorf("Models() = %v", got)
+	}
+	replayed := play.Wrap("model-a", nil)
+	if replayed.TokenContextWindow() != ps.TokenContextWindow() || !replayed.SupportsImages() {
+		t.Errorf("replayed capabilities differ: window %d, images %v", replayed.TokenContextWindow(), replayed.SupportsImages())
+	}
+	// Out of order, with a different system prompt and another tool: none
+	// of that matters.
+	var streamed strings.Builder
+	req := userRequest("echo: two")
+	req.Tools = append(req.Tools, &llm.Tool{Name: "new_tool"})
+	req.OnStream = func(d llm.StreamDelta) { streamed.WriteString(d.Text) }
+	resp, err := replayed.Do(ctx, req)
+	if err != nil {
+		t.Fatalf("replay two: %v", err)
+	}
+	if resp.Content[0].Text != want["echo: two"] || streamed.String() != want["echo: two"] {
+		t.Errorf("replayed %q, streamed %q, want %q", resp.Content[0].Text, streamed.String(), want["echo: two"])
+	}
+	if resp, err := replayed.Do(ctx, userRequest("echo: one")); err != nil || resp.Content[0].Text != want["echo: one"] {
+		t.Errorf("replay one = %v, %v", resp, err)
+	}
+	if _, err := play.Wrap("model-b", nil).Do(ctx, userRequest("echo: one")); err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Errorf("replayed error = %v, want the recorded one", err)
+	}
+	if play.Unused() != 0 || play.Err() != nil {
+		t.Errorf("Unused() = %d, Err() = %v", play.Unused(), play.Err())
+	}
+
+	// Every recorded answer is used once.
+	if _, err := replayed.Do(ctx, userRequest("echo: one")); err == nil || !strings.Contains(err.Error(), "no unused request") {
+		t.Errorf("second replay err = %v", err)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.cassette")
+	rec, err := Open(path, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.Wrap("model-a", loop.NewPredictableService()).Do(ctx, userRequest("echo: recorded")); err != nil {
+		t.Fatal(err)
+	}
+	rec.Close()
+
+	play, err := Open(path, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = play.Wrap("model-a", nil).Do(ctx, userRequest("echo: changed"))
+	if err == nil {
+		t.Fatal("expected a mismatch")
+	}
+	for _, want := range []string{"no answer", "recorded", "changed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("mismatch error does not mention %q: %v", want, err)
+		}
+	}
+	if play.Err() == nil || play.Unused() != 1 {
+		t.Errorf("Err() = %v, Unused() = %d", play.Err(), play.Unused())
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	start := time.Now()
+	a := &llm.Request{Messages: []llm.Message{{
+		Role: llm.MessageRoleUser,
+		Content: []llm.Content{
+			{Type: llm.ContentTypeText, Text: "look", Cache: true, ToolInput: json.RawMessage("null")},
+			{Type: llm.ContentTypeText, MediaType: "image/png", Data: "aW1hZ2U=", DisplayImageURL: "/img/1"},
+			{Type: llm.ContentTypeToolResult, ToolUseID: "t1", ToolUseStartTime: &start, Display: "shown",
+				ToolResult: []llm.Content{{Type: llm.ContentTypeText, Text: "ok"}}},
+		},
+	}}}
+	b := &llm.Request{Messages: []llm.Message{{
+		Role: llm.MessageRoleUser,
+		Content: []llm.Content{
+			{Type: llm.ContentTypeText, Text: "look"},
+			{Type: llm.ContentTypeText, MediaType: "image/png", Data: "aW1hZ2U="},
+			{Type: llm.ContentTypeToolResult, ToolUseID: "t1",
+				ToolResult: []llm.Content{{Type: llm.ContentTypeText, Text: "ok"}}},
+		},
+	}}}
+	if ka, kb := requestKey("m", normalize(a)), requestKey("m", normalize(b)); ka != kb {
+		t.Errorf("keys differ:\n%s\n%s", ka, kb)
+	}
+	if strings.Contains(requestKey("m", normalize(a)), "aW1hZ2U=") {
+		t.Error("image data is stored verbatim")
+	}
+	b.ThinkingLevel = llm.ThinkingLevelHigh
+	if requestKey("m", normalize(a)) == requestKey("m", normalize(b)) {
+		t.Error("the thinking level does not count")
+	}
+}
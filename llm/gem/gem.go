@@ -351,6 +351,18 @@ func (s *Service) buildGeminiRequest(req *llm.Request) (*gemini.Request, error)
 		}
 	}
 
+	if len(req.ResponseSchema) > 0 {
+		var schemaJSON map[string]any
+		if err := json.Unmarshal(req.ResponseSchema, &schemaJSON); err != nil {
+			return nil, fmt.Errorf("failed to parse response schema: %w", err)
+		}
+		schema := convertJSONSchemaToGeminiSchema(schemaJSON)
+		gemReq.GenerationConfig = &gemini.GenerationConfig{
+			ResponseMimeType: "application/json",
+			ResponseSchema:   &schema,
+		}
+	}
+
 	if tc := s.thinkingConfig(req); tc != nil {
 		if gemReq.GenerationConfig == nil {
 			gemReq.GenerationConfig = &gemini.GenerationConfig{}
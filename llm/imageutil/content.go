@@ -0,0 +1,40 @@
+package imageutil
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"shelley.exe.dev/llm"
+)
+
+// Content prepares an image a tool returns for the model, fitting it inside
+// the limits of the service in ctx (see llm.ServiceFromContext). load
+// supplies the image bytes; source names the image in notes. Models without
+// image input, and images that cannot be loaded or prepared, get a text
+// note instead, mirroring the browser screenshot tool.
+func Content(ctx context.Context, source string, load func() ([]byte, error)) []llm.Content {
+	svc := llm.ServiceFromContext(ctx)
+	if svc != nil && !svc.SupportsImages() {
+		return llm.TextContent(fmt.Sprintf("(%s omitted: model does not accept images)", source))
+	}
+	raw, err := load()
+	if err != nil {
+		return llm.TextContent(fmt.Sprintf("(%s omitted: %v)", source, err))
+	}
+	var maxDimension, maxBytes int
+	if svc != nil {
+		maxDimension, maxBytes = svc.MaxImageDimension(), svc.MaxImageBytes()
+	}
+	prepared, err := Prepare(raw, source, maxDimension, maxBytes)
+	if err != nil {
+		return llm.TextContent(fmt.Sprintf("(%s omitted: %v)", source, err))
+	}
+	return []llm.Content{{
+		Type:          llm.ContentTypeText,
+		MediaType:     prepared.MediaType,
+		Data:          base64.StdEncoding.EncodeToString(prepared.Data),
+		DisplayWidth:  prepared.Width,
+		DisplayHeight: prepared.Height,
+	}}
+}
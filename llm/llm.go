@@ -125,6 +125,7 @@ const (
 	ErrorTypeTruncation ErrorType = "truncation"  // Response truncated due to max tokens
 	ErrorTypeLLMRequest ErrorType = "llm_request" // LLM request failed
 	ErrorTypeRefusal    ErrorType = "refusal"     // Model declined to continue (stop_reason=refusal)
+	ErrorTypeBudget     ErrorType = "budget"      // Turn stopped by a spending budget
 )
 
 // StreamDelta represents a partial content update during streaming.
@@ -154,11 +155,20 @@ type Request struct {
 	// ReasoningEffort is an optional provider-verbatim request override used by
 	// custom-model level mappings (for example mapping off to "none").
 	ReasoningEffort string
+	// ResponseSchema, when set, asks for a response whose text is a single
+	// JSON object matching this JSON Schema, using each provider's native
+	// structured output mode (or, for Anthropic, a forced call to the
+	// ResponseSchemaToolName tool). Requests with a ResponseSchema should
+	// not carry Tools. See DoJSON, which also validates the result.
+	ResponseSchema json.RawMessage `json:",omitempty"`
 	// OnStream is called with each streaming delta as the LLM generates content.
 	// If nil, no streaming callbacks are made. The full response is still returned from Do.
 	OnStream func(StreamDelta) `json:"-"`
 	// OnRetry is called before sleeping for a retryable LLM request failure.
 	OnRetry func(RetryEvent) `json:"-"`
+	// OnQueue is called when the request is held back to stay under the
+	// provider's rate limits (see llmhttp.Governor) for long enough to notice.
+	OnQueue func(QueueEvent) `json:"-"`
 }
 
 type RetryEvent struct {
@@ -192,6 +202,39 @@ func FormatRetryEvent(event RetryEvent) string {
 	return msg
 }
 
+// QueueEvent describes an LLM request waiting in the rate governor.
+type QueueEvent struct {
+	// Wait is the expected wait, or 0 when the request waits for another
+	// request to the same model to finish.
+	Wait     time.Duration
+	Reason   string
+	Provider string
+	Model    string
+}
+
+func FormatQueueEvent(event QueueEvent) string {
+	parts := []string{}
+	if event.Provider != "" {
+		parts = append(parts, event.Provider)
+	}
+	if event.Model != "" {
+		parts = append(parts, event.Model)
+	}
+	msg := "LLM request queued"
+	if len(parts) > 0 {
+		msg += ": " + strings.Join(parts, " ")
+	}
+	if event.Wait > 0 {
+		msg += fmt.Sprintf("; waiting %s", event.Wait.Round(time.Second))
+	} else {
+		msg += "; waiting"
+	}
+	if event.Reason != "" {
+		msg += " (" + event.Reason + ")"
+	}
+	return msg + "."
+}
+
 // Message represents a message in the conversation.
 type Message struct {
 	Role      MessageRole `json:"Role"`
@@ -255,6 +298,11 @@ type Tool struct {
 	// be filtered out when sending requests to other providers.
 	ServerSide bool
 
+	// ReadOnly marks tools whose calls have no side effects that another
+	// call could observe: they change no files, processes or conversation
+	// state. The loop runs consecutive read-only calls concurrently.
+	ReadOnly bool
+
 	// The Run function is automatically called when the tool is used.
 	// Run functions may be called concurrently with each other and themselves.
 	// The input to Run function is the input to the tool, as provided by Claude, in compliance with the input schema.
@@ -284,6 +332,9 @@ type ToolProgress struct {
 	ToolName string `json:"tool_name"`
 	// Output is the last chunk of output (tail of output, max ~10KB).
 	Output string `json:"output"`
+	// Display is optional structured progress for UIs, in the shape of
+	// the tool's ToolOut.Display.
+	Display any `json:"display,omitempty"`
 }
 
 // ToolProgressFunc is called by tools to report progress during execution.
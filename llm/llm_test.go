@@ -619,6 +619,20 @@ func TestFormatRetryEvent(t *testing.T) {
 	}
 }
 
+func TestFormatQueueEvent(t *testing.T) {
+	for _, tc := range []struct {
+		event QueueEvent
+		want  string
+	}{
+		{QueueEvent{Wait: 12400 * time.Millisecond, Reason: "tokens per minute", Provider: "anthropic", Model: "claude-opus-4-7"}, "LLM request queued: anthropic claude-opus-4-7; waiting 12s (tokens per minute)."},
+		{QueueEvent{Reason: "8 requests in flight", Model: "gpt-5.5"}, "LLM request queued: gpt-5.5; waiting (8 requests in flight)."},
+	} {
+		if got := FormatQueueEvent(tc.event); got != tc.want {
+			t.Errorf("FormatQueueEvent() = %q, want %q", got, tc.want)
+		}
+	}
+}
+
 func TestIsServerSideContentType(t *testing.T) {
 	serverSide := []ContentType{
 		ContentTypeServerToolUse,
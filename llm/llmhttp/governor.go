@@ -0,0 +1,381 @@
+package llmhttp
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+// DefaultMaxInFlight is how many requests to one model DefaultGovernor lets
+// run at once.
+const DefaultMaxInFlight = 8
+
+// DefaultGovernor is the Governor of clients made by NewClient.
+var DefaultGovernor = NewGovernor(DefaultMaxInFlight)
+
+const (
+	// queueNoticeAfter is how long a request must wait before the wait is
+	// reported through the context's queue notifier.
+	queueNoticeAfter = time.Second
+
+	// maxRecordedWaits bounds the queue waits kept per model for Stats.
+	maxRecordedWaits = 500
+)
+
+// Governor holds LLM requests back instead of letting them fail with 429s.
+// It keeps a limiter per provider and model, each bounding the requests in
+// flight and tracking the requests-per-minute and tokens-per-minute budgets
+// the provider reports in its rate-limit response headers. A request that
+// would exceed a limit waits until the budget resets. Requests through the
+// exe.dev gateway carry no rate-limit headers, so for those only the
+// in-flight bound and Retry-After apply.
+type Governor struct {
+	mu          sync.Mutex
+	maxInFlight int
+	limiters    map[string]*limiter
+}
+
+// NewGovernor returns a Governor letting maxInFlight requests run at once
+// per model. maxInFlight <= 0 means no bound.
+func NewGovernor(maxInFlight int) *Governor {
+	return &Governor{maxInFlight: maxInFlight, limiters: map[string]*limiter{}}
+}
+
+// SetMaxInFlight changes the per-model bound on concurrent requests.
+func (g *Governor) SetMaxInFlight(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxInFlight = n
+	for _, l := range g.limiters {
+		l.signal()
+	}
+}
+
+// limiter is the state of one model. It is guarded by Governor.mu.
+type limiter struct {
+	inFlight int
+	queued   int
+	requests bucket
+	tokens   bucket
+	// blockedUntil is when the provider's last Retry-After ends.
+	blockedUntil time.Time
+	// changed is closed, and replaced, whenever a waiting request might now
+	// be admitted.
+	changed chan struct{}
+
+	admitted    int64
+	delayed     int64
+	rateLimited int64
+	waits       []time.Duration
+}
+
+// bucket is a budget the provider refills at reset.
+type bucket struct {
+	limit     int64
+	remaining int64
+	// reset is when remaining is back to limit; zero when unknown.
+	reset time.Time
+}
+
+func (b *bucket) delay(now time.Time, cost int64) time.Duration {
+	if b.reset.IsZero() || !now.Before(b.reset) {
+		return 0
+	}
+	need := cost
+	if b.limit > 0 {
+		need = min(cost, b.limit)
+	}
+	if b.remaining > 0 && b.remaining >= need {
+		return 0
+	}
+	return b.reset.Sub(now)
+}
+
+func (b *bucket) take(now time.Time, cost int64) {
+	if b.reset.IsZero() {
+		return
+	}
+	if !now.Before(b.reset) {
+		b.remaining, b.reset = b.limit, time.Time{}
+		return
+	}
+	b.remaining -= cost
+}
+
+func (b *bucket) learn(limit, remaining, reset string, now time.Time) {
+	r, err := strconv.ParseInt(remaining, 10, 64)
+	if err != nil {
+		return
+	}
+	at, ok := parseReset(reset, now)
+	if !ok {
+		return
+	}
+	if l, err := strconv.ParseInt(limit, 10, 64); err == nil {
+		b.limit = l
+	}
+	b.remaining, b.reset = r, at
+}
+
+// parseReset parses a rate-limit reset header: an RFC 3339 time
+// (Anthropic), a Go-style duration like "6m0s" (OpenAI), or seconds.
+func parseReset(v string, now time.Time) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), true
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return now.Add(time.Duration(secs * float64(time.Second))), true
+	}
+	return time.Time{}, false
+}
+
+// rateLimitHeaders are the limit, remaining and reset headers of
+// Anthropic's and OpenAI's (and OpenAI-compatible) request and token budgets.
+var rateLimitHeaders = []struct {
+	requests, tokens []string // {limit, remaining, reset}
+}{
+	{
+		requests: []string{"Anthropic-Ratelimit-Requests-Limit", "Anthropic-Ratelimit-Requests-Remaining", "Anthropic-Ratelimit-Requests-Reset"},
+		tokens:   []string{"Anthropic-Ratelimit-Input-Tokens-Limit", "Anthropic-Ratelimit-Input-Tokens-Remaining", "Anthropic-Ratelimit-Input-Tokens-Reset"},
+	},
+	{
+		requests: []string{"X-Ratelimit-Limit-Requests", "X-Ratelimit-Remaining-Requests", "X-Ratelimit-Reset-Requests"},
+		tokens:   []string{"X-Ratelimit-Limit-Tokens", "X-Ratelimit-Remaining-Tokens", "X-Ratelimit-Reset-Tokens"},
+	},
+}
+
+func (l *limiter) signal() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// delay reports how long a request costing cost tokens must wait and why,
+// or an empty reason if it may go now. A zero delay with a reason means it
+// waits for a request in flight to finish.
+func (l *limiter) delay(now time.Time, cost int64, maxInFlight int) (time.Duration, string) {
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now), "rate limited by the provider"
+	}
+	if d := l.requests.delay(now, 1); d > 0 {
+		return d, "requests per minute limit"
+	}
+	if d := l.tokens.delay(now, cost); d > 0 {
+		return d, "tokens per minute limit"
+	}
+	if maxInFlight > 0 && l.inFlight >= maxInFlight {
+		return 0, fmt.Sprintf("%d requests in flight", l.inFlight)
+	}
+	return 0, ""
+}
+
+func (g *Governor) limiter(key string) *limiter {
+	l := g.limiters[key]
+	if l == nil {
+		l = &limiter{changed: make(chan struct{})}
+		g.limiters[key] = l
+	}
+	return l
+}
+
+// acquire waits until a request to key costing cost input tokens may be
+// sent, and returns the function to call once it is done.
+func (g *Governor) acquire(ctx context.Context, key string, cost int64) (release func(), err error) {
+	start := time.Now()
+	queued, notified := false, false
+	for {
+		g.mu.Lock()
+		l := g.limiter(key)
+		now := time.Now()
+		wait, reason := l.delay(now, cost, g.maxInFlight)
+		if reason == "" {
+			if queued {
+				l.queued--
+				l.delayed++
+				l.waits = append(l.waits, now.Sub(start))
+				if len(l.waits) > maxRecordedWaits {
+					l.waits = slices.Delete(l.waits, 0, len(l.waits)-maxRecordedWaits)
+				}
+			}
+			l.inFlight++
+			l.admitted++
+			l.requests.take(now, 1)
+			l.tokens.take(now, cost)
+			g.mu.Unlock()
+			return sync.OnceFunc(func() { g.release(key) }), nil
+		}
+		if !queued {
+			queued = true
+			l.queued++
+		}
+		changed := l.changed
+		g.mu.Unlock()
+
+		waited := now.Sub(start)
+		if !notified && (waited >= queueNoticeAfter || wait >= queueNoticeAfter) {
+			notified = true
+			if notify := queueNotifierFromContext(ctx); notify != nil {
+				notify(llm.QueueEvent{Wait: wait, Reason: reason, Provider: ProviderFromContext(ctx), Model: ModelIDFromContext(ctx)})
+			}
+		}
+
+		// Wake when the limiter changes, when the wait is over, or when
+		// it is time to report a wait for a free slot.
+		var timeout <-chan time.Time
+		switch {
+		case wait > 0:
+			timeout = time.After(wait)
+		case !notified:
+			timeout = time.After(queueNoticeAfter - waited)
+		}
+		select {
+		case <-ctx.Done():
+			g.mu.Lock()
+			l.queued--
+			g.mu.Unlock()
+			return nil, ctx.Err()
+		case <-changed:
+		case <-timeout:
+		}
+	}
+}
+
+func (g *Governor) release(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	l := g.limiter(key)
+	l.inFlight--
+	l.signal()
+}
+
+// observe learns key's budgets from a response's rate-limit headers, and
+// honors the Retry-After of a 429.
+func (g *Governor) observe(key string, resp *http.Response) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	l := g.limiter(key)
+	now := time.Now()
+	h := resp.Header
+	for _, family := range rateLimitHeaders {
+		if h.Get(family.requests[1]) != "" {
+			l.requests.learn(h.Get(family.requests[0]), h.Get(family.requests[1]), h.Get(family.requests[2]), now)
+		}
+		if h.Get(family.tokens[1]) != "" {
+			l.tokens.learn(h.Get(family.tokens[0]), h.Get(family.tokens[1]), h.Get(family.tokens[2]), now)
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		l.rateLimited++
+		if d := llm.ParseRetryAfter(h.Get("Retry-After")); d > 0 {
+			l.blockedUntil = now.Add(d)
+		}
+	}
+	l.signal()
+}
+
+// GovernorStats describes one model's limiter, for /debug/histograms.
+type GovernorStats struct {
+	Key         string `json:"key"`
+	InFlight    int    `json:"in_flight"`
+	Queued      int    `json:"queued"`
+	Admitted    int64  `json:"admitted"`
+	Delayed     int64  `json:"delayed"`
+	RateLimited int64  `json:"rate_limited"`
+	// The learned budgets; zero when the provider did not report them.
+	RequestsLimit     int64 `json:"requests_limit,omitempty"`
+	RequestsRemaining int64 `json:"requests_remaining,omitempty"`
+	TokensLimit       int64 `json:"tokens_limit,omitempty"`
+	TokensRemaining   int64 `json:"tokens_remaining,omitempty"`
+	// WaitsMS are the recent queue waits of delayed requests.
+	WaitsMS []int64 `json:"waits_ms"`
+}
+
+// Stats returns the state of every model the Governor has seen, sorted by key.
+func (g *Governor) Stats() []GovernorStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]GovernorStats, 0, len(g.limiters))
+	for key, l := range g.limiters {
+		st := GovernorStats{
+			Key:               key,
+			InFlight:          l.inFlight,
+			Queued:            l.queued,
+			Admitted:          l.admitted,
+			Delayed:           l.delayed,
+			RateLimited:       l.rateLimited,
+			RequestsLimit:     l.requests.limit,
+			RequestsRemaining: l.requests.remaining,
+			TokensLimit:       l.tokens.limit,
+			TokensRemaining:   l.tokens.remaining,
+			WaitsMS:           make([]int64, len(l.waits)),
+		}
+		for i, w := range l.waits {
+			st.WaitsMS[i] = w.Milliseconds()
+		}
+		out = append(out, st)
+	}
+	slices.SortFunc(out, func(a, b GovernorStats) int { return cmp.Compare(a.Key, b.Key) })
+	return out
+}
+
+// governorKey is the limiter a request counts against: its provider and
+// model when the context names them, else its host.
+func governorKey(req *http.Request) string {
+	model := ModelIDFromContext(req.Context())
+	if model == "" {
+		return req.URL.Host
+	}
+	return ProviderFromContext(req.Context()) + "/" + model
+}
+
+// estimateTokens guesses a request's input tokens from its body size, at
+// about four bytes per token.
+func estimateTokens(req *http.Request) int64 {
+	return max(req.ContentLength, 0) / 4
+}
+
+// releaseReadCloser releases a governed request's slot once its response
+// has been read to the end or closed.
+type releaseReadCloser struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil {
+		r.release()
+	}
+	return n, err
+}
+
+func (r *releaseReadCloser) Close() error {
+	r.release()
+	return r.ReadCloser.Close()
+}
+
+// WithQueueNotifier returns a context whose governed LLM requests report
+// waits longer than a second to notify.
+func WithQueueNotifier(ctx context.Context, notify func(llm.QueueEvent)) context.Context {
+	return context.WithValue(ctx, queueNotifierKey, notify)
+}
+
+func queueNotifierFromContext(ctx context.Context) func(llm.QueueEvent) {
+	if v := ctx.Value(queueNotifierKey); v != nil {
+		return v.(func(llm.QueueEvent))
+	}
+	return nil
+}
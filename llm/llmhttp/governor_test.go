@@ -0,0 +1,204 @@
+package llmhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+func governedClient(g *Governor) *http.Client {
+	return &http.Client{Transport: &Transport{Governor: g}}
+}
+
+func governedGet(t *testing.T, ctx context.Context, c *http.Client, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(strings.Repeat("x", 400)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Do(req)
+}
+
+func TestGovernorMaxInFlight(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first chunk"))
+		w.(http.Flusher).Flush()
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	g := NewGovernor(1)
+	c := governedClient(g)
+	ctx := WithProvider(WithModelID(context.Background(), "m1"), "anthropic")
+
+	first, err := governedGet(t, ctx, c, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first response is still streaming, so the second request queues.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var secondErr error
+	go func() {
+		defer wg.Done()
+		resp, err := governedGet(t, ctx, c, server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		secondErr = err
+	}()
+	waitFor(t, func() bool { return g.Stats()[0].Queued == 1 })
+	if st := g.Stats()[0]; st.Key != "anthropic/m1" || st.InFlight != 1 {
+		t.Errorf("stats while queued = %+v", st)
+	}
+
+	first.Body.Close()
+	wg.Wait()
+	if secondErr != nil {
+		t.Fatal(secondErr)
+	}
+	st := g.Stats()[0]
+	if st.InFlight != 0 || st.Queued != 0 || st.Admitted != 2 || st.Delayed != 1 || len(st.WaitsMS) != 1 {
+		t.Errorf("final stats = %+v", st)
+	}
+
+	// A request that gives up while queued leaves the queue.
+	held, err := governedGet(t, ctx, c, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Body.Close()
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := governedGet(t, short, c, server.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("queued request error = %v, want deadline exceeded", err)
+	}
+	if st := g.Stats()[0]; st.Queued != 0 {
+		t.Errorf("queued = %d after the request gave up", st.Queued)
+	}
+}
+
+func TestGovernorLearnsRateLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ratelimit-Limit-Requests", "60")
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "0")
+		w.Header().Set("X-Ratelimit-Reset-Requests", "1200ms")
+		w.Header().Set("X-Ratelimit-Limit-Tokens", "1000")
+		w.Header().Set("X-Ratelimit-Remaining-Tokens", "900")
+		w.Header().Set("X-Ratelimit-Reset-Tokens", "1s")
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	g := NewGovernor(0)
+	c := governedClient(g)
+	var events []llm.QueueEvent
+	ctx := WithProvider(WithModelID(context.Background(), "gpt"), "openai")
+	ctx = WithQueueNotifier(ctx, func(e llm.QueueEvent) { events = append(events, e) })
+	resp, err := governedGet(t, ctx, c, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if st := g.Stats()[0]; st.RequestsLimit != 60 || st.RequestsRemaining != 0 || st.TokensLimit != 1000 || st.TokensRemaining != 900 {
+		t.Errorf("learned stats = %+v", st)
+	}
+
+	// No requests are left until the window resets, which is long enough
+	// to tell the conversation about.
+	start := time.Now()
+	resp, err = governedGet(t, ctx, c, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("second request waited %s, want the 1.2s reset", waited)
+	}
+	if len(events) != 1 || events[0].Reason != "requests per minute limit" || events[0].Model != "gpt" || events[0].Provider != "openai" || events[0].Wait <= 0 {
+		t.Errorf("queue events = %+v", events)
+	}
+}
+
+func TestGovernorRetryAfter(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	g := NewGovernor(0)
+	c := governedClient(g)
+	ctx := WithModelID(context.Background(), "claude")
+
+	resp, err := governedGet(t, ctx, c, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	start := time.Now()
+	resp, err = governedGet(t, ctx, c, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if waited := time.Since(start); waited < 900*time.Millisecond {
+		t.Errorf("retry waited %s, want the 1s Retry-After", waited)
+	}
+	if st := g.Stats()[0]; st.RateLimited != 1 || st.Delayed != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestParseReset(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"2026-01-02T03:04:35Z", now.Add(30 * time.Second)},
+		{"6m0s", now.Add(6 * time.Minute)},
+		{"20ms", now.Add(20 * time.Millisecond)},
+		{"1.5", now.Add(1500 * time.Millisecond)},
+	} {
+		got, ok := parseReset(tc.in, now)
+		if !ok || !got.Equal(tc.want) {
+			t.Errorf("parseReset(%q) = %v, %v; want %v", tc.in, got, ok, tc.want)
+		}
+	}
+	if _, ok := parseReset("soon", now); ok {
+		t.Error("parseReset accepted garbage")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -1,6 +1,7 @@
 // Package llmhttp provides HTTP utilities for LLM requests, namely a
-// custom transport that adds Shelley-specific headers and enforces an
-// idle/stall timeout on streaming responses.
+// custom transport that adds Shelley-specific headers, enforces an
+// idle/stall timeout on streaming responses, and queues requests that would
+// exceed a provider's rate limits.
 package llmhttp
 
 import (
@@ -28,6 +29,7 @@ const (
 	requestTraceKey
 	purposeKey
 	usageCollectorKey
+	queueNotifierKey
 )
 
 // shelleyRequestIDHeader is the header Shelley sets on every LLM request with a
@@ -250,10 +252,15 @@ var ErrIdleTimeout = errors.New("llm stream idle timeout: no data received withi
 // runs to completion as long as it keeps making progress.
 const DefaultIdleTimeout = 3 * time.Minute
 
-// Transport wraps an http.RoundTripper to add Shelley-specific headers and
-// enforce an idle/stall timeout on the response body.
+// Transport wraps an http.RoundTripper to add Shelley-specific headers,
+// enforce an idle/stall timeout on the response body, and govern request
+// rates.
 type Transport struct {
 	Base http.RoundTripper
+	// Governor, when set, holds requests back to stay under the provider's
+	// rate limits. A governed request keeps its slot until its response
+	// body is read or closed.
+	Governor *Governor
 	// IdleTimeout, when > 0, aborts a request if no response bytes are
 	// received for this long. The timer resets on every successful read, so
 	// it measures the gap between chunks (and time-to-first-byte), not total
@@ -302,7 +309,27 @@ func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if base == nil {
 		base = http.DefaultTransport
 	}
+	if t.Governor == nil {
+		return t.send(base, req, trace)
+	}
+
+	key := governorKey(req)
+	release, err := t.Governor.acquire(req.Context(), key, estimateTokens(req))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.send(base, req, trace)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	t.Governor.observe(key, resp)
+	resp.Body = &releaseReadCloser{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
 
+// send sends req, under the idle watchdog when IdleTimeout is set.
+func (t *Transport) send(base http.RoundTripper, req *http.Request, trace *RequestTrace) (*http.Response, error) {
 	if t.IdleTimeout <= 0 {
 		resp, err := base.RoundTrip(req)
 		if resp != nil {
@@ -440,8 +467,8 @@ func (r *idleReadCloser) Close() error {
 	return r.ReadCloser.Close()
 }
 
-// NewClient creates an http.Client with Shelley headers applied via Transport
-// and the default idle/stall timeout.
+// NewClient creates an http.Client with Shelley headers applied via Transport,
+// the default idle/stall timeout, and DefaultGovernor.
 func NewClient(base *http.Client) *http.Client {
 	return NewClientWithIdleTimeout(base, DefaultIdleTimeout)
 }
@@ -459,7 +486,7 @@ func NewClientWithIdleTimeout(base *http.Client, idleTimeout time.Duration) *htt
 	}
 
 	return &http.Client{
-		Transport: &Transport{Base: transport, IdleTimeout: idleTimeout},
+		Transport: &Transport{Base: transport, IdleTimeout: idleTimeout, Governor: DefaultGovernor},
 		Timeout:   base.Timeout,
 	}
 }
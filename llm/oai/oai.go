@@ -1254,6 +1254,14 @@ func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error
 		ToolChoice:          fromLLMToolChoice(ir.ToolChoice), // TODO: make fromLLMToolChoice return an error when a perfect translation is not possible
 		MaxCompletionTokens: cmp.Or(s.MaxTokens, DefaultMaxTokens),
 	}
+	if len(ir.ResponseSchema) > 0 {
+		// Not strict: strict mode rejects schemas with optional properties.
+		// The caller validates the result instead.
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type:       openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{Name: "response", Schema: ir.ResponseSchema},
+		}
+	}
 
 	// Reasoning effort. Precedence:
 	//   1. ir.ThinkingLevel (request-level override)
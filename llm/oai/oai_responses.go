@@ -68,7 +68,17 @@ type responsesReasoning struct {
 }
 
 type responsesText struct {
-	Verbosity string `json:"verbosity,omitempty"`
+	Verbosity string               `json:"verbosity,omitempty"`
+	Format    *responsesTextFormat `json:"format,omitempty"`
+}
+
+// responsesTextFormat asks for structured output.
+// https://platform.openai.com/docs/guides/structured-outputs
+type responsesTextFormat struct {
+	Type   string          `json:"type"` // "json_schema"
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"`
 }
 
 type responsesInputItem struct {
@@ -579,6 +589,14 @@ func (s *ResponsesService) Do(ctx context.Context, ir *llm.Request) (*llm.Respon
 			req.Text = &responsesText{Verbosity: model.TextVerbosity}
 		}
 	}
+	if len(ir.ResponseSchema) > 0 {
+		if req.Text == nil {
+			req.Text = &responsesText{}
+		}
+		// Not strict: strict mode rejects schemas with optional properties.
+		// The caller validates the result instead.
+		req.Text.Format = &responsesTextFormat{Type: "json_schema", Name: "response", Schema: ir.ResponseSchema}
+	}
 
 	// Add reasoning. Precedence:
 	//   1. ir.ThinkingLevel (request-level override from the caller)
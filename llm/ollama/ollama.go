@@ -0,0 +1,546 @@
+// Package ollama talks to a local Ollama server through its native API
+// (https://github.com/ollama/ollama/blob/main/docs/api.md): /api/chat for
+// completions, and /api/tags, /api/show and /api/pull to find out which
+// models are installed and what they can do.
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+const (
+	// DefaultURL is where Ollama listens unless told otherwise.
+	DefaultURL = "http://localhost:11434"
+	// DefaultContextLength is the context window assumed for a model whose
+	// context length is unknown.
+	DefaultContextLength = 8192
+)
+
+// Service provides chat completions from one Ollama model.
+// Fields should not be altered concurrently with calling any method on Service.
+type Service struct {
+	HTTPC *http.Client // defaults to http.DefaultClient if nil
+	URL   string       // Ollama server, defaults to DefaultURL
+	Model string       // e.g. "qwen3:8b"
+
+	// ContextLength is the longest context the model supports, as
+	// reported by /api/show. NumCtx, if set, runs the model with a shorter
+	// one to save memory. The effective window is sent as num_ctx: Ollama
+	// otherwise loads models with a small default and silently drops the
+	// start of longer prompts.
+	ContextLength int
+	NumCtx        int
+
+	// KeepAlive is how long Ollama keeps the model loaded after a request
+	// (e.g. "30m", or "-1" for ever). Empty leaves Ollama's default.
+	KeepAlive string
+
+	// SupportsImages_ and SupportsThinking report the model's "vision"
+	// and "thinking" capabilities.
+	SupportsImages_  bool
+	SupportsThinking bool
+
+	Backoff []time.Duration // retry backoff durations; defaults to {1s, 2s, 5s, 10s, 30s} if nil
+}
+
+var _ llm.Service = (*Service)(nil)
+
+func (s *Service) Provider() string { return "ollama" }
+
+// SupportsImages reports whether the model accepts image inputs.
+func (s *Service) SupportsImages() bool { return s.SupportsImages_ }
+
+// TokenContextWindow returns the context window the model is run with.
+func (s *Service) TokenContextWindow() int {
+	return cmp.Or(s.NumCtx, s.ContextLength, DefaultContextLength)
+}
+
+// MaxImageDimension returns the maximum allowed image dimension.
+func (s *Service) MaxImageDimension() int {
+	return 0 // No known limit; the model's projector resizes.
+}
+
+// MaxImageBytes returns the maximum allowed encoded size for a single image.
+func (s *Service) MaxImageBytes() int {
+	return 0 // No known limit
+}
+
+// SupportsReasoning reports whether the model can think. Ollama turns
+// thinking on or off; every level other than off turns it on.
+func (s *Service) SupportsReasoning() bool { return s.SupportsThinking }
+
+func (s *Service) SupportedReasoningLevels() []llm.ThinkingLevel { return nil }
+
+// DefaultReasoningLevel leaves thinking to the model's own default.
+func (s *Service) DefaultReasoningLevel() string { return "" }
+
+// ConfigDetails returns configuration information for logging
+func (s *Service) ConfigDetails() map[string]string {
+	return map[string]string{
+		"base_url":   s.url(),
+		"model_name": s.Model,
+		"full_url":   s.url() + "/api/chat",
+		"num_ctx":    fmt.Sprint(s.TokenContextWindow()),
+		"keep_alive": s.KeepAlive,
+	}
+}
+
+func (s *Service) url() string {
+	return strings.TrimSuffix(cmp.Or(s.URL, DefaultURL), "/")
+}
+
+// chatRequest is the body of POST /api/chat.
+type chatRequest struct {
+	Model     string          `json:"model"`
+	Messages  []message       `json:"messages"`
+	Tools     []tool          `json:"tools,omitempty"`
+	Stream    bool            `json:"stream"`
+	Think     *bool           `json:"think,omitempty"`
+	Format    json.RawMessage `json:"format,omitempty"` // a JSON Schema for structured output
+	KeepAlive string          `json:"keep_alive,omitempty"`
+	Options   map[string]any  `json:"options,omitempty"`
+}
+
+type message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Thinking  string     `json:"thinking,omitempty"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+type toolCall struct {
+	ID       string `json:"id,omitempty"`
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type tool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// chatChunk is one line of a streamed /api/chat response; the last one has
+// Done set and carries the counts.
+type chatChunk struct {
+	Model           string  `json:"model"`
+	Message         message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason"`
+	PromptEvalCount uint64  `json:"prompt_eval_count"`
+	EvalCount       uint64  `json:"eval_count"`
+	Error           string  `json:"error"`
+}
+
+// objectOrEmpty stands in {} for missing tool arguments.
+func objectOrEmpty(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 || string(raw) == "null" {
+		return json.RawMessage("{}")
+	}
+	return raw
+}
+
+func isImageContent(c llm.Content) bool {
+	return c.MediaType != "" && c.Data != ""
+}
+
+// fromLLMMessages converts the system prompt and messages. Tool results
+// become "tool" messages named after the tool they answer, which Ollama
+// needs because its tool calls carry no IDs.
+func fromLLMMessages(system []llm.SystemContent, msgs []llm.Message) []message {
+	var out []message
+	var sys []string
+	for _, sc := range system {
+		if sc.Text != "" {
+			sys = append(sys, sc.Text)
+		}
+	}
+	if len(sys) > 0 {
+		out = append(out, message{Role: "system", Content: strings.Join(sys, "\n\n")})
+	}
+
+	toolNames := map[string]string{}
+	for _, msg := range msgs {
+		m := message{Role: "user"}
+		if msg.Role == llm.MessageRoleAssistant {
+			m.Role = "assistant"
+		}
+		var text []string
+		for _, c := range msg.Content {
+			switch {
+			case c.Type == llm.ContentTypeToolUse:
+				toolNames[c.ID] = c.ToolName
+				var tc toolCall
+				tc.Function.Name = c.ToolName
+				tc.Function.Arguments = objectOrEmpty(c.ToolInput)
+				m.ToolCalls = append(m.ToolCalls, tc)
+			case c.Type == llm.ContentTypeToolResult:
+				tm := message{Role: "tool", ToolName: toolNames[c.ToolUseID]}
+				var result []string
+				for _, r := range c.ToolResult {
+					if isImageContent(r) {
+						tm.Images = append(tm.Images, r.Data)
+					} else if r.Text != "" {
+						result = append(result, r.Text)
+					}
+				}
+				tm.Content = strings.Join(result, "\n")
+				out = append(out, tm)
+			case c.Type == llm.ContentTypeThinking:
+				m.Thinking += c.Thinking
+			case isImageContent(c):
+				m.Images = append(m.Images, c.Data)
+			case c.Type == llm.ContentTypeText && c.Text != "":
+				text = append(text, c.Text)
+			}
+		}
+		m.Content = strings.Join(text, "\n\n")
+		if m.Content != "" || len(m.Images) > 0 || len(m.ToolCalls) > 0 || m.Thinking != "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func fromLLMTools(tools []*llm.Tool) []tool {
+	var out []tool
+	for _, t := range tools {
+		if t.ServerSide {
+			continue
+		}
+		var ot tool
+		ot.Type = "function"
+		ot.Function.Name = t.Name
+		ot.Function.Description = t.Description
+		ot.Function.Parameters = t.InputSchema
+		out = append(out, ot)
+	}
+	return out
+}
+
+func (s *Service) think(level llm.ThinkingLevel) *bool {
+	if !s.SupportsThinking || level == llm.ThinkingLevelDefault {
+		return nil
+	}
+	on := level != llm.ThinkingLevelOff
+	return &on
+}
+
+// statusError is a failed HTTP response from Ollama.
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.status, e.msg)
+}
+
+// responseError reads Ollama's {"error": "..."} body.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var e struct {
+		Error string `json:"error"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		msg = e.Error
+	}
+	return &statusError{status: resp.StatusCode, msg: msg}
+}
+
+// Do sends a request to Ollama, streaming the answer.
+func (s *Service) Do(ctx context.Context, ir *llm.Request) (*llm.Response, error) {
+	req := chatRequest{
+		Model:     s.Model,
+		Messages:  fromLLMMessages(ir.System, ir.Messages),
+		Tools:     fromLLMTools(ir.Tools),
+		Stream:    true,
+		Think:     s.think(ir.ThinkingLevel),
+		Format:    ir.ResponseSchema,
+		KeepAlive: s.KeepAlive,
+		Options:   map[string]any{"num_ctx": s.TokenContextWindow()},
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: marshal request: %w", err)
+	}
+	fullURL := s.url() + "/api/chat"
+
+	backoff := s.Backoff
+	if len(backoff) == 0 {
+		// A local server is either up or not; a short tail is enough to
+		// ride out a model load or restart.
+		backoff = []time.Duration{1 * time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second}
+	}
+	var errs error // accumulated errors across all attempts
+	var lastErr *statusError
+	for attempts := 0; ; attempts++ {
+		if attempts > 0 {
+			if attempts > len(backoff) {
+				return nil, fmt.Errorf("ollama request failed after %d attempts (url=%s, model=%s): %w", attempts, fullURL, s.Model, errs)
+			}
+			base := backoff[attempts-1]
+			sleep := base + time.Duration(rand.Int64N(max(min(int64(base), int64(time.Second)), 1)))
+			slog.WarnContext(ctx, "ollama_request_retry", "error", lastErr, "attempt", attempts, "sleep", sleep)
+			if ir.OnRetry != nil {
+				ir.OnRetry(llm.RetryEvent{Attempt: attempts + 1, Sleep: sleep, Err: llm.Truncate(lastErr.Error(), 160), Status: lastErr.status, Provider: "ollama", Model: s.Model})
+			}
+			select {
+			case <-time.After(sleep):
+			case <-ctx.Done():
+				return nil, fmt.Errorf("ollama request failed after %d attempts (context cancelled during backoff): %w", attempts, errs)
+			}
+		}
+
+		resp, err := s.chat(ctx, fullURL, body, ir.OnStream)
+		if err == nil {
+			return resp, nil
+		}
+		errs = errors.Join(errs, fmt.Errorf("attempt %d at %s: %w", attempts+1, time.Now().Format(time.DateTime), err))
+		// Only overloaded or failing servers are worth another try; a
+		// refused connection means Ollama is not running, and a 4xx (most
+		// often an unknown model) will not change.
+		if !errors.As(err, &lastErr) || ctx.Err() != nil ||
+			lastErr.status != http.StatusTooManyRequests && lastErr.status < 500 {
+			return nil, fmt.Errorf("ollama request failed (url=%s, model=%s): %w", fullURL, s.Model, errs)
+		}
+	}
+}
+
+// chat makes one /api/chat call and assembles the streamed answer.
+func (s *Service) chat(ctx context.Context, fullURL string, body []byte, onStream func(llm.StreamDelta)) (*llm.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", fullURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	startTime := time.Now()
+	httpResp, err := cmp.Or(s.HTTPC, http.DefaultClient).Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, responseError(httpResp)
+	}
+
+	var text, thinking strings.Builder
+	var calls []toolCall
+	var last chatChunk
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk chatChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("decode stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("stream error: %s", chunk.Error)
+		}
+		// Thinking comes first, then the text: index them like the
+		// content blocks they end up in.
+		if chunk.Message.Thinking != "" {
+			thinking.WriteString(chunk.Message.Thinking)
+			if onStream != nil {
+				onStream(llm.StreamDelta{Type: "thinking", Text: chunk.Message.Thinking, Index: 0})
+			}
+		}
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			if onStream != nil {
+				onStream(llm.StreamDelta{Type: "text", Text: chunk.Message.Content, Index: min(thinking.Len(), 1)})
+			}
+		}
+		calls = append(calls, chunk.Message.ToolCalls...)
+		if chunk.Done {
+			last = chunk
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+	if !last.Done {
+		return nil, fmt.Errorf("stream ended before the response was done")
+	}
+	endTime := time.Now()
+
+	var content []llm.Content
+	if thinking.Len() > 0 {
+		content = append(content, llm.Content{Type: llm.ContentTypeThinking, Thinking: thinking.String()})
+	}
+	if text.Len() > 0 || len(calls) == 0 {
+		content = append(content, llm.Content{Type: llm.ContentTypeText, Text: text.String()})
+	}
+	for i, call := range calls {
+		content = append(content, llm.Content{
+			ID:        cmp.Or(call.ID, fmt.Sprintf("ollama_call_%d_%d", startTime.UnixNano(), i)),
+			Type:      llm.ContentTypeToolUse,
+			ToolName:  call.Function.Name,
+			ToolInput: objectOrEmpty(call.Function.Arguments),
+		})
+	}
+	stopReason := llm.StopReasonEndTurn
+	switch {
+	case len(calls) > 0:
+		stopReason = llm.StopReasonToolUse
+	case last.DoneReason == "length":
+		stopReason = llm.StopReasonMaxTokens
+	}
+	return &llm.Response{
+		Role:       llm.MessageRoleAssistant,
+		Model:      cmp.Or(last.Model, s.Model),
+		Content:    content,
+		StopReason: stopReason,
+		Usage: llm.Usage{
+			InputTokens:  last.PromptEvalCount,
+			OutputTokens: last.EvalCount,
+		},
+		StartTime: &startTime,
+		EndTime:   &endTime,
+		URL:       fullURL,
+	}, nil
+}
+
+// Client asks an Ollama server about its models.
+type Client struct {
+	HTTPC *http.Client // defaults to http.DefaultClient if nil
+	URL   string       // defaults to DefaultURL
+}
+
+// ListedModel is an installed model, from /api/tags.
+type ListedModel struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// ModelInfo is what /api/show says about a model.
+type ModelInfo struct {
+	// ContextLength is the longest context the model supports, or 0 if
+	// Ollama does not say.
+	ContextLength int
+	// Capabilities are e.g. "completion", "tools", "vision", "thinking".
+	Capabilities []string
+}
+
+func (m *ModelInfo) Has(capability string) bool {
+	return slices.Contains(m.Capabilities, capability)
+}
+
+func (c *Client) url() string {
+	return strings.TrimSuffix(cmp.Or(c.URL, DefaultURL), "/")
+}
+
+// call sends in (if not nil) to path and decodes the answer into out.
+func (c *Client) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url()+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := cmp.Or(c.HTTPC, http.DefaultClient).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama %s: %w", path, responseError(resp))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("ollama %s: decode: %w", path, err)
+	}
+	return nil
+}
+
+// List returns the installed models.
+func (c *Client) List(ctx context.Context) ([]ListedModel, error) {
+	var tags struct {
+		Models []ListedModel `json:"models"`
+	}
+	if err := c.call(ctx, "GET", "/api/tags", nil, &tags); err != nil {
+		return nil, err
+	}
+	return tags.Models, nil
+}
+
+// Show describes an installed model.
+func (c *Client) Show(ctx context.Context, model string) (*ModelInfo, error) {
+	var show struct {
+		ModelInfo     map[string]any `json:"model_info"`
+		ProjectorInfo map[string]any `json:"projector_info"`
+		Capabilities  []string       `json:"capabilities"`
+	}
+	if err := c.call(ctx, "POST", "/api/show", map[string]string{"model": model}, &show); err != nil {
+		return nil, err
+	}
+	info := &ModelInfo{Capabilities: show.Capabilities}
+	// Servers from before capabilities were reported have a projector for
+	// vision models.
+	if len(show.ProjectorInfo) > 0 && !info.Has("vision") {
+		info.Capabilities = append(info.Capabilities, "vision")
+	}
+	// The context length is under "<architecture>.context_length".
+	arch, _ := show.ModelInfo["general.architecture"].(string)
+	if n, ok := show.ModelInfo[arch+".context_length"].(float64); ok {
+		info.ContextLength = int(n)
+	} else {
+		for k, v := range show.ModelInfo {
+			if n, ok := v.(float64); ok && strings.HasSuffix(k, ".context_length") {
+				info.ContextLength = int(n)
+				break
+			}
+		}
+	}
+	return info, nil
+}
+
+// Pull downloads model, which can take a long time.
+func (c *Client) Pull(ctx context.Context, model string) error {
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := c.call(ctx, "POST", "/api/pull", map[string]any{"model": model, "stream": false}, &status); err != nil {
+		return err
+	}
+	if status.Status != "success" {
+		return fmt.Errorf("ollama pull %s: %s", model, status.Status)
+	}
+	return nil
+}
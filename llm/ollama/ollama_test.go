@@ -0,0 +1,200 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+// fakeOllama serves canned /api/chat streams and records what it was sent.
+type fakeOllama struct {
+	mu       sync.Mutex
+	requests []chatRequest
+	// replies are NDJSON streams, one per /api/chat call; a reply that is
+	// a number is sent as that HTTP status instead.
+	replies []string
+}
+
+func (f *fakeOllama) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/chat":
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		reply := f.replies[0]
+		f.replies = f.replies[1:]
+		f.mu.Unlock()
+		var status int
+		if _, err := fmt.Sscan(reply, &status); err == nil {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error":"status %d from the fake"}`, status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprint(w, reply)
+	case "/api/tags":
+		fmt.Fprint(w, `{"models":[{"name":"qwen3:8b","size":5000},{"name":"llava:7b","size":4000}]}`)
+	case "/api/show":
+		var req struct{ Model string }
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Model {
+		case "qwen3:8b":
+			fmt.Fprint(w, `{"model_info":{"general.architecture":"qwen3","qwen3.context_length":40960},"capabilities":["completion","tools","thinking"]}`)
+		case "llava:7b":
+			fmt.Fprint(w, `{"model_info":{"general.architecture":"llama","llama.context_length":32768},"projector_info":{"clip.has_vision_encoder":true}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":"model '%s' not found"}`, req.Model)
+		}
+	case "/api/pull":
+		fmt.Fprint(w, `{"status":"success"}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDoStreamsToolCalls(t *testing.T) {
+	fake := &fakeOllama{replies: []string{
+		`{"model":"qwen3:8b","message":{"role":"assistant","thinking":"Need to "},"done":false}
+{"model":"qwen3:8b","message":{"role":"assistant","thinking":"look."},"done":false}
+{"model":"qwen3:8b","message":{"role":"assistant","content":"Listing "},"done":false}
+{"model":"qwen3:8b","message":{"role":"assistant","content":"files.","tool_calls":[{"function":{"name":"bash","arguments":{"command":"ls"}}}]},"done":false}
+{"model":"qwen3:8b","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":120,"eval_count":15}
+`,
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	svc := &Service{URL: srv.URL, Model: "qwen3:8b", ContextLength: 40960, NumCtx: 16384, KeepAlive: "30m", SupportsThinking: true}
+
+	var deltas []llm.StreamDelta
+	resp, err := svc.Do(context.Background(), &llm.Request{
+		System: []llm.SystemContent{{Text: "You are helpful."}},
+		Messages: []llm.Message{
+			llm.UserStringMessage("what is here?"),
+			{Role: llm.MessageRoleAssistant, Content: []llm.Content{
+				{Type: llm.ContentTypeToolUse, ID: "t1", ToolName: "bash", ToolInput: json.RawMessage(`{"command":"pwd"}`)},
+			}},
+			{Role: llm.MessageRoleUser, Content: []llm.Content{
+				{Type: llm.ContentTypeToolResult, ToolUseID: "t1", ToolResult: []llm.Content{{Type: llm.ContentTypeText, Text: "/src"}}},
+				{Type: llm.ContentTypeText, MediaType: "image/png", Data: "aW1n"},
+			}},
+		},
+		Tools:         []*llm.Tool{{Name: "bash", Description: "runs", InputSchema: json.RawMessage(`{"type":"object"}`)}, {Name: "web_search", ServerSide: true}},
+		ThinkingLevel: llm.ThinkingLevelHigh,
+		OnStream:      func(d llm.StreamDelta) { deltas = append(deltas, d) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := fake.requests[0]
+	if !req.Stream || req.KeepAlive != "30m" || req.Options["num_ctx"] != float64(16384) || req.Think == nil || !*req.Think {
+		t.Errorf("request settings = stream %v, keep_alive %q, options %v, think %v", req.Stream, req.KeepAlive, req.Options, req.Think)
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Function.Name != "bash" {
+		t.Errorf("tools = %+v", req.Tools)
+	}
+	var roles []string
+	for _, m := range req.Messages {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,tool,user" {
+		t.Fatalf("roles = %s", got)
+	}
+	if tm := req.Messages[3]; tm.ToolName != "bash" || tm.Content != "/src" {
+		t.Errorf("tool message = %+v", tm)
+	}
+	if um := req.Messages[4]; len(um.Images) != 1 || um.Images[0] != "aW1n" {
+		t.Errorf("image message = %+v", um)
+	}
+
+	if len(resp.Content) != 3 || resp.Content[0].Thinking != "Need to look." || resp.Content[1].Text != "Listing files." {
+		t.Fatalf("content = %+v", resp.Content)
+	}
+	call := resp.Content[2]
+	if call.Type != llm.ContentTypeToolUse || call.ToolName != "bash" || string(call.ToolInput) != `{"command":"ls"}` || call.ID == "" {
+		t.Errorf("tool call = %+v", call)
+	}
+	if resp.StopReason != llm.StopReasonToolUse || resp.Usage.InputTokens != 120 || resp.Usage.OutputTokens != 15 {
+		t.Errorf("stop reason %v, usage %+v", resp.StopReason, resp.Usage)
+	}
+	var streamed strings.Builder
+	for _, d := range deltas {
+		if d.Type == "text" {
+			streamed.WriteString(d.Text)
+		}
+	}
+	if len(deltas) != 4 || streamed.String() != "Listing files." {
+		t.Errorf("deltas = %+v", deltas)
+	}
+}
+
+func TestDoRetriesServerErrors(t *testing.T) {
+	fake := &fakeOllama{replies: []string{
+		"503",
+		`{"message":{"role":"assistant","content":"cut"},"done":true,"done_reason":"length"}` + "\n",
+		"404",
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	svc := &Service{URL: srv.URL, Model: "qwen3:8b", Backoff: []time.Duration{time.Millisecond}}
+
+	var retries []llm.RetryEvent
+	resp, err := svc.Do(context.Background(), &llm.Request{
+		Messages: []llm.Message{llm.UserStringMessage("hi")},
+		OnRetry:  func(e llm.RetryEvent) { retries = append(retries, e) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retries) != 1 || retries[0].Status != 503 {
+		t.Errorf("retries = %+v", retries)
+	}
+	if resp.StopReason != llm.StopReasonMaxTokens || fake.requests[1].Think != nil {
+		t.Errorf("stop reason %v, think %v", resp.StopReason, fake.requests[1].Think)
+	}
+
+	// A missing model is not retried.
+	_, err = svc.Do(context.Background(), &llm.Request{Messages: []llm.Message{llm.UserStringMessage("hi")}})
+	if err == nil || !strings.Contains(err.Error(), "status 404") || len(fake.requests) != 3 {
+		t.Errorf("err = %v after %d requests", err, len(fake.requests))
+	}
+}
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(&fakeOllama{})
+	defer srv.Close()
+	c := &Client{URL: srv.URL}
+	ctx := context.Background()
+
+	models, err := c.List(ctx)
+	if err != nil || len(models) != 2 || models[0].Name != "qwen3:8b" {
+		t.Fatalf("List() = %+v, %v", models, err)
+	}
+	qwen, err := c.Show(ctx, "qwen3:8b")
+	if err != nil || qwen.ContextLength != 40960 || !qwen.Has("thinking") || qwen.Has("vision") {
+		t.Errorf("Show(qwen3) = %+v, %v", qwen, err)
+	}
+	llava, err := c.Show(ctx, "llava:7b")
+	if err != nil || llava.ContextLength != 32768 || !llava.Has("vision") {
+		t.Errorf("Show(llava) = %+v, %v", llava, err)
+	}
+	if _, err := c.Show(ctx, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Show(missing) err = %v", err)
+	}
+	if err := c.Pull(ctx, "qwen3:8b"); err != nil {
+		t.Errorf("Pull() = %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ResponseSchemaToolName is the tool providers without a native structured
+// output mode force the model to call to deliver a ResponseSchema answer.
+const ResponseSchemaToolName = "structured_output"
+
+// CheckResponseSchema reports whether schema can be a Request's
+// ResponseSchema: a JSON Schema describing an object, which every provider
+// accepts at the root.
+func CheckResponseSchema(schema json.RawMessage) error {
+	var root struct {
+		Type any `json:"type"`
+	}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return fmt.Errorf("response schema is not a JSON object: %w", err)
+	}
+	if root.Type != "object" {
+		return errors.New(`response schema must have "type": "object"`)
+	}
+	return nil
+}
+
+// DoJSON sends req, which must have a ResponseSchema, and decodes the
+// structured response into a T after checking it against the schema.
+// The *Response is returned even when the result is invalid, for usage
+// accounting.
+func DoJSON[T any](ctx context.Context, svc Service, req *Request) (T, *Response, error) {
+	var result T
+	if err := CheckResponseSchema(req.ResponseSchema); err != nil {
+		return result, nil, err
+	}
+	resp, err := svc.Do(ctx, req)
+	if err != nil {
+		return result, nil, err
+	}
+	data, err := StructuredResult(resp, req.ResponseSchema)
+	if err != nil {
+		return result, resp, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, resp, fmt.Errorf("decoding structured response: %w", err)
+	}
+	return result, resp, nil
+}
+
+// StructuredResult extracts the JSON value of a response to a request with
+// a ResponseSchema and validates it against schema.
+func StructuredResult(resp *Response, schema json.RawMessage) (json.RawMessage, error) {
+	var text strings.Builder
+	for _, c := range resp.Content {
+		if c.Type == ContentTypeText {
+			text.WriteString(c.Text)
+		}
+	}
+	data := []byte(stripCodeFence(strings.TrimSpace(text.String())))
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty structured response (stop reason %s)", resp.StopReason)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("structured response is not JSON: %s", Truncate(string(data), 200))
+	}
+	if err := ValidateJSON(schema, data); err != nil {
+		return nil, fmt.Errorf("structured response does not match the schema: %w", err)
+	}
+	return json.RawMessage(data), nil
+}
+
+// stripCodeFence removes a Markdown code fence around s. Native JSON modes
+// never add one, but models answering from instructions alone sometimes do.
+func stripCodeFence(s string) string {
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	s = strings.TrimSuffix(s[3:], "```")
+	// Drop the info string, e.g. "json".
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
+}
+
+// ValidateJSON checks data, a JSON value, against schema. It implements
+// the JSON Schema keywords that structured output schemas use: type, enum,
+// const, properties, required, additionalProperties, items, minItems,
+// maxItems, minLength, maxLength, pattern, minimum, maximum, anyOf, oneOf
+// and allOf. Other keywords are ignored.
+func ValidateJSON(schema, data json.RawMessage) error {
+	var s map[string]any
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return fmt.Errorf("parsing schema: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("parsing value: %w", err)
+	}
+	return validateValue(s, v, "$")
+}
+
+func validateValue(s map[string]any, v any, path string) error {
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := s["type"]; ok {
+		var types []string
+		switch t := t.(type) {
+		case string:
+			types = []string{t}
+		case []any:
+			for _, name := range t {
+				if name, ok := name.(string); ok {
+					types = append(types, name)
+				}
+			}
+		}
+		if !slices.ContainsFunc(types, func(t string) bool { return hasJSONType(v, t) }) {
+			return fail("expected %s, got %s", strings.Join(types, " or "), jsonTypeName(v))
+		}
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(e any) bool { return jsonEqual(e, v) }) {
+			return fail("%s is not one of the allowed values", Truncate(jsonString(v), 80))
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(c, v) {
+		return fail("expected %s", jsonString(c))
+	}
+
+	for _, kw := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, ok := s[kw].([]any)
+		if !ok {
+			continue
+		}
+		matched := 0
+		var firstErr error
+		for _, sub := range subs {
+			sub, ok := sub.(map[string]any)
+			if !ok {
+				continue
+			}
+			if err := validateValue(sub, v, path); err != nil {
+				if kw == "allOf" {
+					return err
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			matched++
+		}
+		switch {
+		case kw == "anyOf" && matched == 0 && firstErr != nil:
+			return fail("matches none of anyOf: %v", firstErr)
+		case kw == "oneOf" && matched != 1:
+			return fail("matches %d of oneOf, want exactly 1", matched)
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		props, _ := s["properties"].(map[string]any)
+		if required, ok := s["required"].([]any); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, present := v[name]; !present {
+						return fail("missing required property %q", name)
+					}
+				}
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if ps, ok := props[name].(map[string]any); ok {
+				if err := validateValue(ps, v[name], path+"."+name); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, declared := props[name]; declared {
+				continue
+			}
+			switch extra := s["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fail("unexpected property %q", name)
+				}
+			case map[string]any:
+				if err := validateValue(extra, v[name], path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if n, ok := schemaNumber(s, "minItems"); ok && float64(len(v)) < n {
+			return fail("has %d items, want at least %v", len(v), n)
+		}
+		if n, ok := schemaNumber(s, "maxItems"); ok && float64(len(v)) > n {
+			return fail("has %d items, want at most %v", len(v), n)
+		}
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateValue(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := schemaNumber(s, "minLength"); ok && length < n {
+			return fail("is shorter than %v characters", n)
+		}
+		if n, ok := schemaNumber(s, "maxLength"); ok && length > n {
+			return fail("is longer than %v characters", n)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err == nil && !re.MatchString(v) {
+				return fail("%q does not match pattern %q", Truncate(v, 80), pattern)
+			}
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n, ok := schemaNumber(s, "minimum"); ok && f < n {
+			return fail("%v is less than the minimum %v", v, n)
+		}
+		if n, ok := schemaNumber(s, "maximum"); ok && f > n {
+			return fail("%v is greater than the maximum %v", v, n)
+		}
+	}
+	return nil
+}
+
+func schemaNumber(s map[string]any, kw string) (float64, bool) {
+	n, ok := s[kw].(float64)
+	return n, ok
+}
+
+func hasJSONType(v any, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		f, err := v.Float64()
+		return t == "integer" && err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+func jsonTypeName(v any) string {
+	for _, t := range []string{"null", "boolean", "string", "array", "object", "integer", "number"} {
+		if hasJSONType(v, t) {
+			return t
+		}
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonEqual compares a schema value (decoded without UseNumber) with an
+// instance value (decoded with it).
+func jsonEqual(a, b any) bool {
+	return jsonString(a) == jsonString(b)
+}
+
+func jsonString(v any) string {
+	if n, ok := v.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			v = f
+		}
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"required": ["title", "steps"],
+		"additionalProperties": false,
+		"properties": {
+			"title": {"type": "string", "minLength": 3, "pattern": "^[a-z-]+$"},
+			"priority": {"type": "integer", "minimum": 1, "maximum": 3},
+			"kind": {"enum": ["bug", "feature"]},
+			"steps": {
+				"type": "array",
+				"minItems": 1,
+				"items": {
+					"type": "object",
+					"required": ["cmd"],
+					"properties": {"cmd": {"type": "string"}, "timeout": {"type": ["number", "null"]}}
+				}
+			},
+			"owner": {"anyOf": [{"type": "string"}, {"type": "null"}]}
+		}
+	}`)
+	for _, tc := range []struct {
+		data    string
+		wantErr string
+	}{
+		{data: `{"title":"fix-tests","steps":[{"cmd":"go test"}]}`},
+		{data: `{"title":"fix-tests","priority":2,"kind":"bug","steps":[{"cmd":"make","timeout":null}],"owner":null}`},
+		{data: `{"title":"fix-tests"}`, wantErr: `$: missing required property "steps"`},
+		{data: `{"title":"Fix","steps":[{"cmd":"x"}]}`, wantErr: `$.title: "Fix" does not match pattern`},
+		{data: `{"title":"ab","steps":[{"cmd":"x"}]}`, wantErr: "$.title: is shorter than 3"},
+		{data: `{"title":"abc","priority":1.5,"steps":[{"cmd":"x"}]}`, wantErr: "$.priority: expected integer, got number"},
+		{data: `{"title":"abc","priority":4,"steps":[{"cmd":"x"}]}`, wantErr: "$.priority: 4 is greater than the maximum 3"},
+		{data: `{"title":"abc","kind":"chore","steps":[{"cmd":"x"}]}`, wantErr: "$.kind: \"chore\" is not one of the allowed values"},
+		{data: `{"title":"abc","steps":[]}`, wantErr: "$.steps: has 0 items, want at least 1"},
+		{data: `{"title":"abc","steps":[{"cmd":1}]}`, wantErr: "$.steps[0].cmd: expected string, got integer"},
+		{data: `{"title":"abc","steps":[{"cmd":"x"}],"extra":1}`, wantErr: `$: unexpected property "extra"`},
+		{data: `{"title":"abc","steps":[{"cmd":"x"}],"owner":3}`, wantErr: "$.owner: matches none of anyOf"},
+		{data: `["abc"]`, wantErr: "$: expected object, got array"},
+	} {
+		err := ValidateJSON(schema, json.RawMessage(tc.data))
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("ValidateJSON(%s) = %v", tc.data, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("ValidateJSON(%s) = %v, want %q", tc.data, err, tc.wantErr)
+		}
+	}
+}
+
+type jsonReplyService struct {
+	mockService
+	reply string
+}
+
+func (s *jsonReplyService) Do(ctx context.Context, req *Request) (*Response, error) {
+	return &Response{Content: []Content{StringContent(s.reply)}, StopReason: StopReasonEndTurn}, nil
+}
+
+func TestDoJSON(t *testing.T) {
+	type slug struct {
+		Slug  string   `json:"slug"`
+		Words []string `json:"words"`
+	}
+	req := &Request{
+		Messages:       []Message{UserStringMessage("name this conversation")},
+		ResponseSchema: json.RawMessage(`{"type":"object","required":["slug"],"properties":{"slug":{"type":"string"},"words":{"type":"array","items":{"type":"string"}}}}`),
+	}
+
+	got, resp, err := DoJSON[slug](context.Background(), &jsonReplyService{reply: "```json\n{\"slug\":\"fix-ci\",\"words\":[\"fix\",\"ci\"]}\n```"}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || got.Slug != "fix-ci" || len(got.Words) != 2 {
+		t.Errorf("DoJSON = %+v, %v", got, resp)
+	}
+
+	if _, resp, err := DoJSON[slug](context.Background(), &jsonReplyService{reply: `{"words":[]}`}, req); err == nil || resp == nil {
+		t.Errorf("DoJSON without a required property = %v, response %v", err, resp)
+	}
+	if _, _, err := DoJSON[slug](context.Background(), &jsonReplyService{}, &Request{}); err == nil {
+		t.Error("DoJSON accepted a request without a ResponseSchema")
+	}
+}
@@ -0,0 +1,78 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"shelley.exe.dev/llm"
+)
+
+// BudgetError reports a spending limit that stopped a turn.
+type BudgetError struct {
+	// Scope says whose budget ran out, e.g. "this conversation".
+	Scope string
+	// Limit is the limit reached: one of the Budget* constants.
+	Limit string
+	// Used and Max are the spending so far and the limit, in the limit's
+	// unit (tokens, US dollars or requests).
+	Used, Max float64
+}
+
+// Limits a BudgetError can report.
+const (
+	BudgetInputTokens  = "input tokens"
+	BudgetOutputTokens = "output tokens"
+	BudgetCost         = "cost"
+	BudgetRounds       = "LLM requests per turn"
+)
+
+func (e *BudgetError) Error() string {
+	switch e.Limit {
+	case BudgetCost:
+		return fmt.Sprintf("%s has spent $%.2f of its $%.2f budget", e.Scope, e.Used, e.Max)
+	case BudgetRounds:
+		return fmt.Sprintf("this turn has reached the per-turn limit of %.0f LLM requests for %s", e.Max, e.Scope)
+	default:
+		return fmt.Sprintf("%s has used %.0f %s of its budget of %.0f", e.Scope, e.Used, e.Limit, e.Max)
+	}
+}
+
+// budgetExceeded returns why the turn may not send its next request, which
+// would be its round'th (counting from 0), or nil if it may.
+func (l *Loop) budgetExceeded(ctx context.Context, round int) error {
+	if l.maxRounds > 0 && round >= l.maxRounds {
+		return &BudgetError{Scope: "this conversation", Limit: BudgetRounds, Used: float64(round), Max: float64(l.maxRounds)}
+	}
+	if l.checkBudget != nil {
+		return l.checkBudget(ctx)
+	}
+	return nil
+}
+
+// handleBudgetExceeded ends the turn with a visible, non-retryable error
+// message explaining which budget ran out. Like other error messages it is
+// recorded but not appended to history.
+func (l *Loop) handleBudgetExceeded(ctx context.Context, err error) error {
+	l.logger.Warn("budget exceeded; stopping turn", "error", err)
+	text := fmt.Sprintf("[Budget exceeded: %s. The turn was stopped.", err)
+	if _, ok := errors.AsType[*BudgetError](err); ok {
+		text += " Raise the conversation's budget, or start a new turn if the limit is per turn."
+	}
+	text += "]"
+	errorMessage := llm.Message{
+		Role:           llm.MessageRoleAssistant,
+		Content:        []llm.Content{{Type: llm.ContentTypeText, Text: text}},
+		EndOfTurn:      true,
+		ErrorType:      llm.ErrorTypeBudget,
+		ErrorRetryable: false,
+	}
+	if recordErr := l.recordMessage(ctx, errorMessage, llm.Usage{}, nil); recordErr != nil {
+		l.logger.Error("failed to record budget error message", "error", recordErr)
+	}
+	if l.onBudgetExceeded != nil {
+		l.onBudgetExceeded(ctx, err)
+	}
+	l.checkGitStateChange(ctx)
+	return nil
+}
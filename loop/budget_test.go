@@ -0,0 +1,91 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"shelley.exe.dev/llm"
+)
+
+// runBudgetTurn runs one turn of fillingLLMService, which wants two LLM
+// requests, and returns the requests sent, the recorded messages and the
+// errors passed to OnBudgetExceeded.
+func runBudgetTurn(t *testing.T, cfg Config) (*fillingLLMService, []llm.Message, []error) {
+	t.Helper()
+	svc := &fillingLLMService{}
+	var recorded []llm.Message
+	var exceeded []error
+	cfg.LLM = svc
+	cfg.Tools = []*llm.Tool{noopTool()}
+	cfg.RecordMessage = func(ctx context.Context, msg llm.Message, usage llm.Usage, _ []llm.PurposedUsage) error {
+		recorded = append(recorded, msg)
+		return nil
+	}
+	cfg.OnBudgetExceeded = func(ctx context.Context, err error) {
+		exceeded = append(exceeded, err)
+	}
+	l := NewLoop(cfg)
+	l.QueueUserMessage(llm.UserStringMessage("go"))
+	if err := l.ProcessOneTurn(context.Background()); err != nil {
+		t.Fatalf("ProcessOneTurn: %v", err)
+	}
+	return svc, recorded, exceeded
+}
+
+func TestMaxRoundsPerTurn(t *testing.T) {
+	svc, recorded, exceeded := runBudgetTurn(t, Config{MaxRoundsPerTurn: 1})
+	if len(svc.sent) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(svc.sent))
+	}
+	if len(exceeded) != 1 {
+		t.Fatalf("OnBudgetExceeded called %d times, want 1", len(exceeded))
+	}
+	var budgetErr *BudgetError
+	if !errors.As(exceeded[0], &budgetErr) || budgetErr.Limit != BudgetRounds {
+		t.Errorf("exceeded with %v, want a rounds BudgetError", exceeded[0])
+	}
+	last := recorded[len(recorded)-1]
+	if last.ErrorType != llm.ErrorTypeBudget || !last.EndOfTurn || last.ErrorRetryable {
+		t.Errorf("last message = %+v, want a non-retryable end-of-turn budget error", last)
+	}
+	if text := last.Content[0].Text; !strings.Contains(text, "Budget exceeded") || !strings.Contains(text, "limit of 1 LLM requests") {
+		t.Errorf("error text = %q", text)
+	}
+}
+
+func TestCheckBudgetStopsTurn(t *testing.T) {
+	checks := 0
+	svc, recorded, exceeded := runBudgetTurn(t, Config{
+		CheckBudget: func(ctx context.Context) error {
+			checks++
+			if checks > 1 {
+				return &BudgetError{Scope: "this conversation", Limit: BudgetCost, Used: 1.25, Max: 1}
+			}
+			return nil
+		},
+	})
+	if len(svc.sent) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(svc.sent))
+	}
+	if len(exceeded) != 1 {
+		t.Fatalf("OnBudgetExceeded called %d times, want 1", len(exceeded))
+	}
+	want := "this conversation has spent $1.25 of its $1.00 budget"
+	if text := recorded[len(recorded)-1].Content[0].Text; !strings.Contains(text, want) {
+		t.Errorf("error text = %q, want it to contain %q", text, want)
+	}
+}
+
+func TestNoBudget(t *testing.T) {
+	svc, recorded, exceeded := runBudgetTurn(t, Config{})
+	if len(svc.sent) != 2 || len(exceeded) != 0 {
+		t.Errorf("sent %d requests and exceeded %d budgets, want 2 and 0", len(svc.sent), len(exceeded))
+	}
+	for _, m := range recorded {
+		if m.ErrorType != llm.ErrorTypeNone {
+			t.Errorf("unexpected error message %+v", m)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package loop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"shelley.exe.dev/llm"
+)
+
+// fillingLLMService runs one tool round reporting a nearly full context
+// window, then ends the turn. It records the messages of each request.
+type fillingLLMService struct {
+	sent [][]llm.Message
+}
+
+func (f *fillingLLMService) Do(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	f.sent = append(f.sent, req.Messages)
+	if len(f.sent) == 1 {
+		return &llm.Response{
+			Role: llm.MessageRoleAssistant,
+			Content: []llm.Content{
+				{Type: llm.ContentTypeToolUse, ID: "tu_1", ToolName: "noop", ToolInput: json.RawMessage(`{}`)},
+			},
+			StopReason: llm.StopReasonToolUse,
+			Usage:      llm.Usage{InputTokens: 850, OutputTokens: 50},
+		}, nil
+	}
+	return &llm.Response{
+		Role:       llm.MessageRoleAssistant,
+		Content:    []llm.Content{{Type: llm.ContentTypeText, Text: "done"}},
+		StopReason: llm.StopReasonEndTurn,
+		Usage:      llm.Usage{InputTokens: 100, OutputTokens: 5},
+	}, nil
+}
+
+func (f *fillingLLMService) Provider() string        { return "" }
+func (f *fillingLLMService) TokenContextWindow() int { return 1000 }
+func (f *fillingLLMService) MaxImageDimension() int  { return 2000 }
+func (f *fillingLLMService) MaxImageBytes() int      { return 5 * 1024 * 1024 }
+func (f *fillingLLMService) SupportsImages() bool    { return false }
+
+func noopTool() *llm.Tool {
+	return &llm.Tool{
+		Name:        "noop",
+		InputSchema: llm.EmptySchema(),
+		Run: func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+			return llm.ToolOut{LLMContent: llm.TextContent("ok")}
+		},
+	}
+}
+
+func runFillingTurn(t *testing.T, threshold float64, compact func(context.Context) ([]llm.Message, error)) *fillingLLMService {
+	t.Helper()
+	svc := &fillingLLMService{}
+	l := NewLoop(Config{
+		LLM:              svc,
+		Tools:            []*llm.Tool{noopTool()},
+		RecordMessage:    func(context.Context, llm.Message, llm.Usage, []llm.PurposedUsage) error { return nil },
+		Compact:          compact,
+		CompactThreshold: threshold,
+	})
+	l.QueueUserMessage(llm.UserStringMessage("go"))
+	if err := l.ProcessOneTurn(context.Background()); err != nil {
+		t.Fatalf("ProcessOneTurn: %v", err)
+	}
+	return svc
+}
+
+func TestCompactBetweenToolRounds(t *testing.T) {
+	summary := llm.UserStringMessage("summary of earlier work")
+	calls := 0
+	svc := runFillingTurn(t, 0.8, func(ctx context.Context) ([]llm.Message, error) {
+		calls++
+		return []llm.Message{summary}, nil
+	})
+	if calls != 1 {
+		t.Fatalf("Compact called %d times, want 1", calls)
+	}
+	if len(svc.sent) != 2 {
+		t.Fatalf("got %d requests, want 2", len(svc.sent))
+	}
+	second := svc.sent[1]
+	if len(second) != 1 || second[0].Content[0].Text != "summary of earlier work" {
+		t.Errorf("second request did not use the compacted history: %+v", second)
+	}
+}
+
+func TestCompactBelowThreshold(t *testing.T) {
+	calls := 0
+	runFillingTurn(t, 0.95, func(ctx context.Context) ([]llm.Message, error) {
+		calls++
+		return nil, nil
+	})
+	if calls != 0 {
+		t.Errorf("Compact called %d times below the threshold", calls)
+	}
+}
+
+func TestCompactFailureKeepsHistory(t *testing.T) {
+	svc := runFillingTurn(t, 0.8, func(ctx context.Context) ([]llm.Message, error) {
+		return nil, errors.New("summarizer unavailable")
+	})
+	if len(svc.sent) != 2 {
+		t.Fatalf("got %d requests, want 2", len(svc.sent))
+	}
+	// user message, assistant tool_use, tool result
+	if got := len(svc.sent[1]); got != 3 {
+		t.Errorf("second request has %d messages, want the full 3", got)
+	}
+}
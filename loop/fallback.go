@@ -0,0 +1,134 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"shelley.exe.dev/llm"
+)
+
+// Fallback is a service the loop may switch to when its current one keeps
+// failing; see Config.Fallbacks.
+type Fallback struct {
+	// Model is the fallback's model ID, for OnFallback and logging.
+	Model string
+	LLM   llm.Service
+}
+
+// DefaultFallbackAfter is how many retryable failures of one request make
+// the loop switch to a fallback when Config.FallbackAfter is zero.
+const DefaultFallbackAfter = 3
+
+// errFallback cancels a request the loop has given up on in favour of a
+// fallback.
+var errFallback = errors.New("switching to a fallback model")
+
+// doWithFallback sends req to the current service. When that fails
+// fallbackAfter times in a row with retryable errors, or gives up with a
+// retryable error, the loop switches to the next fallback that can serve
+// req and sends it there.
+func (l *Loop) doWithFallback(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	threshold := l.fallbackAfter
+	if threshold <= 0 {
+		threshold = DefaultFallbackAfter
+	}
+	for {
+		l.mu.Lock()
+		service := l.llm
+		l.mu.Unlock()
+		next := l.nextFallback(req)
+		if next < 0 {
+			return service.Do(ctx, req)
+		}
+
+		// Providers retry retryable failures themselves and report each one
+		// through OnRetry; count them, and cut the request short once there
+		// are enough. The failure that does so isn't announced as a retry.
+		attemptCtx, cancel := context.WithCancelCause(ctx)
+		failures := 0
+		var lastFailure string
+		r := *req
+		r.OnRetry = func(event llm.RetryEvent) {
+			failures++
+			lastFailure = event.Err
+			if failures >= threshold {
+				cancel(errFallback)
+				return
+			}
+			if req.OnRetry != nil {
+				req.OnRetry(event)
+			}
+		}
+		resp, err := service.Do(attemptCtx, &r)
+		gaveUp := errors.Is(context.Cause(attemptCtx), errFallback)
+		cancel(nil)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil || (!gaveUp && !IsRetryableLLMError(err)) {
+			return nil, err
+		}
+		if gaveUp {
+			err = fmt.Errorf("%d failed attempts, the last: %s", failures, lastFailure)
+		}
+		l.switchToFallback(ctx, next, err)
+	}
+}
+
+// nextFallback returns the index in l.fallbacks of the first fallback that
+// can serve req, or -1 if there is none.
+func (l *Loop) nextFallback(req *llm.Request) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, fb := range l.fallbacks {
+		if canServe(fb.LLM, req) {
+			return i
+		}
+	}
+	return -1
+}
+
+// switchToFallback makes l.fallbacks[i] the loop's service for the rest of
+// its life, dropping it and the fallbacks before it from the chain.
+func (l *Loop) switchToFallback(ctx context.Context, i int, err error) {
+	l.mu.Lock()
+	fb := l.fallbacks[i]
+	l.llm = fb.LLM
+	l.fallbacks = l.fallbacks[i+1:]
+	l.mu.Unlock()
+	l.logger.Warn("LLM keeps failing; switching to a fallback model", "model", fb.Model, "error", err)
+	if l.onFallback != nil {
+		l.onFallback(ctx, fb, err)
+	}
+}
+
+// canServe reports whether svc can take over req: it must accept images if
+// req has any, and the reasoning level req asks for.
+func canServe(svc llm.Service, req *llm.Request) bool {
+	if !svc.SupportsImages() && slices.ContainsFunc(req.Messages, func(m llm.Message) bool {
+		return hasImage(m.Content)
+	}) {
+		return false
+	}
+	level := req.ThinkingLevel
+	if level == llm.ThinkingLevelDefault || level == llm.ThinkingLevelOff {
+		return true
+	}
+	if !llm.SupportsReasoning(svc) {
+		return false
+	}
+	levels := llm.SupportedReasoningLevels(svc)
+	return len(levels) == 0 || slices.Contains(levels, level)
+}
+
+// hasImage reports whether contents, tool results included, carry an image.
+func hasImage(contents []llm.Content) bool {
+	for _, c := range contents {
+		if c.MediaType != "" && c.Data != "" || hasImage(c.ToolResult) {
+			return true
+		}
+	}
+	return false
+}
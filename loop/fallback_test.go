@@ -0,0 +1,221 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+// overloadedService behaves like a provider in an outage: it reports a
+// retryable failure through OnRetry and retries until its context ends, or
+// fails at once with err if that is set.
+type overloadedService struct {
+	err    error
+	images bool
+	levels []llm.ThinkingLevel
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *overloadedService) Do(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	for attempt := 2; ; attempt++ {
+		if req.OnRetry != nil {
+			req.OnRetry(llm.RetryEvent{Attempt: attempt, Err: "overloaded_error", Status: 529})
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (s *overloadedService) Provider() string        { return "" }
+func (s *overloadedService) TokenContextWindow() int { return 200000 }
+func (s *overloadedService) MaxImageDimension() int  { return 2000 }
+func (s *overloadedService) MaxImageBytes() int      { return 5 * 1024 * 1024 }
+func (s *overloadedService) SupportsImages() bool    { return s.images }
+func (s *overloadedService) SupportsReasoning() bool { return len(s.levels) > 0 }
+func (s *overloadedService) SupportedReasoningLevels() []llm.ThinkingLevel {
+	return s.levels
+}
+
+func (s *overloadedService) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// answeringService answers every request with its name.
+type answeringService struct {
+	overloadedService
+	name string
+}
+
+func (s *answeringService) Do(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	return &llm.Response{
+		Role:       llm.MessageRoleAssistant,
+		Content:    []llm.Content{{Type: llm.ContentTypeText, Text: "answered by " + s.name}},
+		StopReason: llm.StopReasonEndTurn,
+	}, nil
+}
+
+type fallbackTurn struct {
+	recorded  []llm.Message
+	warnings  []string
+	fallbacks []string
+	errs      []error
+}
+
+func runFallbackTurn(t *testing.T, cfg Config, user llm.Message) *fallbackTurn {
+	t.Helper()
+	turn := &fallbackTurn{}
+	cfg.RecordMessage = func(_ context.Context, m llm.Message, _ llm.Usage, _ []llm.PurposedUsage) error {
+		turn.recorded = append(turn.recorded, m)
+		return nil
+	}
+	cfg.RecordWarning = func(_ context.Context, text string) error {
+		turn.warnings = append(turn.warnings, text)
+		return nil
+	}
+	cfg.OnFallback = func(_ context.Context, to Fallback, err error) {
+		turn.fallbacks = append(turn.fallbacks, to.Model)
+		turn.errs = append(turn.errs, err)
+	}
+	l := NewLoop(cfg)
+	l.QueueUserMessage(user)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := l.ProcessOneTurn(ctx); err != nil && !strings.Contains(err.Error(), "LLM request failed") {
+		t.Fatalf("ProcessOneTurn: %v", err)
+	}
+	return turn
+}
+
+func (turn *fallbackTurn) answer(t *testing.T) string {
+	t.Helper()
+	if len(turn.recorded) != 1 {
+		t.Fatalf("recorded %d messages, want 1: %+v", len(turn.recorded), turn.recorded)
+	}
+	return turn.recorded[0].Content[0].Text
+}
+
+func TestFallbackAfterRetryableFailures(t *testing.T) {
+	primary := &overloadedService{}
+	second := &answeringService{name: "second"}
+	turn := runFallbackTurn(t, Config{
+		LLM:           primary,
+		Fallbacks:     []Fallback{{Model: "second", LLM: second}},
+		FallbackAfter: 2,
+	}, llm.UserStringMessage("hello"))
+
+	if got := turn.answer(t); got != "answered by second" {
+		t.Errorf("answer = %q", got)
+	}
+	if len(turn.fallbacks) != 1 || turn.fallbacks[0] != "second" {
+		t.Fatalf("fallbacks = %v", turn.fallbacks)
+	}
+	if !strings.Contains(turn.errs[0].Error(), "2 failed attempts") || !strings.Contains(turn.errs[0].Error(), "overloaded_error") {
+		t.Errorf("fallback error = %v", turn.errs[0])
+	}
+	// The failure that triggers the switch is not announced as a retry.
+	if len(turn.warnings) != 1 {
+		t.Errorf("warnings = %v, want 1", turn.warnings)
+	}
+	if primary.callCount() != 1 {
+		t.Errorf("primary called %d times, want 1", primary.callCount())
+	}
+}
+
+func TestFallbackWhenProviderGivesUp(t *testing.T) {
+	primary := &overloadedService{err: errors.New("anthropic request failed after 16 attempts: status 529 overloaded")}
+	second := &answeringService{name: "second"}
+	turn := runFallbackTurn(t, Config{
+		LLM:       primary,
+		Fallbacks: []Fallback{{Model: "second", LLM: second}},
+	}, llm.UserStringMessage("hello"))
+	if got := turn.answer(t); got != "answered by second" {
+		t.Errorf("answer = %q", got)
+	}
+}
+
+func TestNoFallbackOnPermanentError(t *testing.T) {
+	primary := &overloadedService{err: errors.New("status 401: invalid api key")}
+	second := &answeringService{name: "second"}
+	turn := runFallbackTurn(t, Config{
+		LLM:       primary,
+		Fallbacks: []Fallback{{Model: "second", LLM: second}},
+	}, llm.UserStringMessage("hello"))
+	if len(turn.fallbacks) != 0 || second.callCount() != 0 {
+		t.Errorf("fell back on a permanent error: %v", turn.fallbacks)
+	}
+	if turn.recorded[0].ErrorType != llm.ErrorTypeLLMRequest {
+		t.Errorf("recorded %+v, want an error message", turn.recorded[0])
+	}
+}
+
+func TestFallbackSkipsIncapableCandidates(t *testing.T) {
+	withImage := llm.Message{Role: llm.MessageRoleUser, Content: []llm.Content{
+		{Type: llm.ContentTypeText, Text: "what is this?"},
+		{Type: llm.ContentTypeText, MediaType: "image/png", Data: "iVBORw0KGgo="},
+	}}
+	for _, tc := range []struct {
+		name  string
+		user  llm.Message
+		level llm.ThinkingLevel
+	}{
+		{"image", withImage, llm.ThinkingLevelDefault},
+		{"reasoning", llm.UserStringMessage("think hard"), llm.ThinkingLevelHigh},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			blind := &answeringService{name: "blind", overloadedService: overloadedService{levels: []llm.ThinkingLevel{llm.ThinkingLevelLow}}}
+			capable := &answeringService{name: "capable", overloadedService: overloadedService{images: true, levels: []llm.ThinkingLevel{llm.ThinkingLevelHigh}}}
+			turn := runFallbackTurn(t, Config{
+				LLM:           &overloadedService{images: true},
+				ThinkingLevel: tc.level,
+				Fallbacks: []Fallback{
+					{Model: "blind", LLM: blind},
+					{Model: "capable", LLM: capable},
+				},
+				FallbackAfter: 1,
+			}, tc.user)
+			if got := turn.answer(t); got != "answered by capable" {
+				t.Errorf("answer = %q", got)
+			}
+			if blind.callCount() != 0 {
+				t.Error("the incapable fallback was used")
+			}
+		})
+	}
+}
+
+func TestFallbackChainExhausted(t *testing.T) {
+	primary := &overloadedService{}
+	second := &overloadedService{err: errors.New("status 503: service unavailable")}
+	turn := runFallbackTurn(t, Config{
+		LLM:           primary,
+		Fallbacks:     []Fallback{{Model: "second", LLM: second}},
+		FallbackAfter: 1,
+	}, llm.UserStringMessage("hello"))
+	if len(turn.fallbacks) != 1 || second.callCount() != 1 {
+		t.Errorf("fallbacks = %v, second called %d times; want one switch to second", turn.fallbacks, second.callCount())
+	}
+	if len(turn.recorded) != 1 || !strings.Contains(turn.recorded[0].Content[0].Text, "service unavailable") {
+		t.Errorf("recorded %+v, want second's error", turn.recorded)
+	}
+}
@@ -2,6 +2,7 @@ package loop
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -25,6 +26,10 @@ import (
 // genuinely long, steadily-streaming turns are unaffected.
 const maxTurnDuration = 15 * time.Minute
 
+// DefaultMaxParallelTools is how many read-only tool calls from one response
+// run at once when Config.MaxParallelTools is zero.
+const DefaultMaxParallelTools = 8
+
 // MessageRecordFunc is called to record new messages to persistent storage.
 // otherUsage carries the usage of indirect LLM calls affiliated with the
 // message (e.g. LLM-backed tools for a tool-result message); nil for most
@@ -74,6 +79,50 @@ type Config struct {
 	// returning them, so the DB sequence order matches the in-memory splice
 	// point.
 	InjectMessages func(ctx context.Context) []llm.Message
+	// Compact, if set, is called before a request when the previous
+	// response reported a context window usage of at least CompactThreshold
+	// of the service's TokenContextWindow. It returns the history to
+	// continue the turn with (typically a summary plus a verbatim recent
+	// tail). The callback owns persistence. On error the loop keeps its
+	// current history and stops trying to compact.
+	Compact func(ctx context.Context) ([]llm.Message, error)
+	// CompactThreshold is the fraction (0, 1] of the context window that
+	// triggers Compact. Zero disables automatic compaction.
+	CompactThreshold float64
+	// PreToolUse, if set, is called before each tool call with the
+	// tool_use content. It returns the input to run the tool with (nil
+	// keeps the original), or an error to refuse the call; the error is
+	// sent to the LLM as the tool result.
+	PreToolUse func(ctx context.Context, call llm.Content) (json.RawMessage, error)
+	// PostToolUse, if set, is called after each tool call with the content
+	// about to be sent to the LLM as its result, and returns the content
+	// to send instead. An error is sent to the LLM in place of the result.
+	PostToolUse func(ctx context.Context, call llm.Content, result []llm.Content, isError bool) ([]llm.Content, error)
+	// MaxParallelTools limits how many read-only tool calls from one
+	// response run at once. Zero means DefaultMaxParallelTools; 1 runs every
+	// call sequentially.
+	MaxParallelTools int
+	// MaxRoundsPerTurn, if positive, is the most LLM requests one turn may
+	// make. The request that would exceed it is not sent.
+	MaxRoundsPerTurn int
+	// CheckBudget, if set, is called before each LLM request. An error,
+	// normally a *BudgetError, stops the turn without sending the request.
+	CheckBudget func(ctx context.Context) error
+	// OnBudgetExceeded, if set, is called after a budget (MaxRoundsPerTurn
+	// or CheckBudget) stops a turn.
+	OnBudgetExceeded func(ctx context.Context, err error)
+	// Fallbacks are services to switch to, in order, when requests to the
+	// current one keep failing with retryable errors. Fallbacks that can't
+	// serve the conversation, because it has images they don't accept or
+	// a reasoning level they don't support, are skipped. A switch lasts
+	// for the rest of the loop.
+	Fallbacks []Fallback
+	// FallbackAfter is how many retryable failures of one request make the
+	// loop switch to the next fallback. Zero means DefaultFallbackAfter.
+	FallbackAfter int
+	// OnFallback, if set, is called after the loop switches to a fallback,
+	// with the error that made it give up on the previous service.
+	OnFallback func(ctx context.Context, to Fallback, err error)
 }
 
 // Loop manages a conversation turn with an LLM including tool execution and message recording.
@@ -97,7 +146,20 @@ type Loop struct {
 	onStreamDelta    func(llm.StreamDelta)
 	onStreamDone     func()
 	injectMessages   func(ctx context.Context) []llm.Message
+	compact          func(ctx context.Context) ([]llm.Message, error)
+	compactThreshold float64
+	contextUsed      uint64 // context window usage reported by the last response
+	compactFailed    bool   // set after a failed Compact; no further attempts
+	preToolUse       func(ctx context.Context, call llm.Content) (json.RawMessage, error)
+	postToolUse      func(ctx context.Context, call llm.Content, result []llm.Content, isError bool) ([]llm.Content, error)
 	thinkingLevel    llm.ThinkingLevel
+	maxParallelTools int
+	maxRounds        int
+	checkBudget      func(ctx context.Context) error
+	onBudgetExceeded func(ctx context.Context, err error)
+	fallbacks        []Fallback // remaining fallbacks; guarded by mu
+	fallbackAfter    int
+	onFallback       func(ctx context.Context, to Fallback, err error)
 	notify           chan struct{} // signaled when a message is queued or retry requested
 	retryPending     bool          // set by Retry() to re-run processLLMRequest with current history
 }
@@ -133,7 +195,18 @@ func NewLoop(config Config) *Loop {
 		onStreamDelta:    config.OnStreamDelta,
 		onStreamDone:     config.OnStreamDone,
 		injectMessages:   config.InjectMessages,
+		compact:          config.Compact,
+		compactThreshold: config.CompactThreshold,
+		preToolUse:       config.PreToolUse,
+		postToolUse:      config.PostToolUse,
 		thinkingLevel:    config.ThinkingLevel,
+		maxParallelTools: config.MaxParallelTools,
+		maxRounds:        config.MaxRoundsPerTurn,
+		checkBudget:      config.CheckBudget,
+		onBudgetExceeded: config.OnBudgetExceeded,
+		fallbacks:        config.Fallbacks,
+		fallbackAfter:    config.FallbackAfter,
+		onFallback:       config.OnFallback,
 		notify:           make(chan struct{}, 1),
 	}
 }
@@ -312,7 +385,17 @@ func (l *Loop) ProcessOneTurn(ctx context.Context) error {
 // mutual recursion (processLLMRequest ↔ executeToolCalls) caused, because
 // each iteration's locals are freed before the next iteration starts.
 func (l *Loop) processLLMRequest(ctx context.Context) error {
-	for {
+	for round := 0; ; round++ {
+		// Check the budget before anything that costs money, compaction
+		// included.
+		if err := l.budgetExceeded(ctx, round); err != nil {
+			return l.handleBudgetExceeded(ctx, err)
+		}
+
+		// Compact first, so that anything injected below is recorded into
+		// the new generation rather than summarized away.
+		l.maybeCompact(ctx)
+
 		// Splice in externally injected messages (e.g. subagent completion
 		// notifications) so this request already carries them. This runs
 		// between tool rounds too, letting an in-flight turn react to a
@@ -330,7 +413,6 @@ func (l *Loop) processLLMRequest(ctx context.Context) error {
 		messages := append([]llm.Message(nil), l.history...)
 		tools := l.tools
 		system := l.system
-		llmService := l.llm
 		l.mu.Unlock()
 
 		// Enable prompt caching: set cache flag on last tool and last user message content
@@ -365,6 +447,7 @@ func (l *Loop) processLLMRequest(ctx context.Context) error {
 			ThinkingLevel: l.thinkingLevel,
 			OnStream:      l.onStreamDelta,
 			OnRetry:       l.recordRetryWarning(ctx),
+			OnQueue:       l.recordQueueWarning(ctx),
 		}
 
 		// Insert missing tool results if the previous message had tool_use blocks
@@ -407,7 +490,7 @@ func (l *Loop) processLLMRequest(ctx context.Context) error {
 			var resp *llm.Response
 			var err error
 			for attempt := 1; attempt <= maxRetries; attempt++ {
-				resp, err = llmService.Do(llmCtx, req)
+				resp, err = l.doWithFallback(llmCtx, req)
 				if err == nil {
 					return resp, nil
 				}
@@ -476,6 +559,7 @@ func (l *Loop) processLLMRequest(ctx context.Context) error {
 		// Update total usage
 		l.mu.Lock()
 		l.totalUsage.Add(resp.Usage)
+		l.contextUsed = resp.Usage.ContextWindowUsed()
 		l.mu.Unlock()
 
 		// Handle max tokens truncation BEFORE adding to history - truncated responses
@@ -521,6 +605,37 @@ func (l *Loop) processLLMRequest(ctx context.Context) error {
 	}
 }
 
+// maybeCompact replaces the history with a compacted one when the last
+// response filled the context window past the configured threshold.
+func (l *Loop) maybeCompact(ctx context.Context) {
+	l.mu.Lock()
+	used := l.contextUsed
+	skip := l.compact == nil || l.compactThreshold <= 0 || l.compactFailed || used == 0
+	compact := l.compact
+	threshold := l.compactThreshold
+	llmService := l.llm
+	l.mu.Unlock()
+	if skip {
+		return
+	}
+	window := llmService.TokenContextWindow()
+	if window <= 0 || float64(used) < threshold*float64(window) {
+		return
+	}
+
+	l.logger.Info("context window nearly full; compacting", "used", used, "window", window, "threshold", threshold)
+	history, err := compact(ctx)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		l.logger.Warn("automatic compaction failed; continuing with full history", "error", err)
+		l.compactFailed = true
+		return
+	}
+	l.history = history
+	l.contextUsed = 0
+}
+
 // maxPauseContinuations bounds how many times we will re-request to resolve a
 // chain of server-side tool pauses, guarding against a pathological loop where
 // the provider keeps returning pause_turn forever.
@@ -600,6 +715,17 @@ func (l *Loop) recordRetryWarning(ctx context.Context) func(llm.RetryEvent) {
 	}
 }
 
+func (l *Loop) recordQueueWarning(ctx context.Context) func(llm.QueueEvent) {
+	if l.recordWarning == nil {
+		return nil
+	}
+	return func(event llm.QueueEvent) {
+		if err := l.recordWarning(ctx, llm.FormatQueueEvent(event)); err != nil {
+			l.logger.Error("failed to record queue warning", "error", err)
+		}
+	}
+}
+
 // checkGitStateChange checks if the git state has changed and calls the callback if so.
 // This is called at the end of each turn.
 func (l *Loop) checkGitStateChange(ctx context.Context) {
@@ -756,81 +882,55 @@ func (l *Loop) handleRefusal(ctx context.Context, resp *llm.Response) error {
 	return nil
 }
 
+// runTool runs one tool call, giving the PreToolUse callback the chance to
+// rewrite its input or refuse it first.
+func (l *Loop) runTool(ctx context.Context, tool *llm.Tool, call llm.Content) llm.ToolOut {
+	input := call.ToolInput
+	if l.preToolUse != nil {
+		rewritten, err := l.preToolUse(ctx, call)
+		if err != nil {
+			return llm.ErrorToolOut(err)
+		}
+		if rewritten != nil {
+			input = rewritten
+		}
+	}
+	return tool.Run(ctx, input)
+}
+
 // executeToolCalls runs the tools from an LLM response and appends the results
 // to l.history. It does NOT call processLLMRequest — the caller loops instead.
+//
+// Consecutive calls to read-only tools (llm.Tool.ReadOnly) run concurrently,
+// up to maxParallelTools at a time. Any other call runs alone: after every
+// call before it has finished and before any call after it starts, so the
+// model's ordering of reads and writes holds. Results keep the order of the
+// calls.
 func (l *Loop) executeToolCalls(ctx context.Context, content []llm.Content) error {
-	var toolResults []llm.Content
 	// Collect the usage of indirect LLM calls made by tools (keyword_search,
 	// llm_one_shot, tool install validation, subagent progress summaries, ...)
-	// so it can be attached to the tool-result message below. Tools run
-	// sequentially in this loop, but a tool may fan out goroutines internally;
-	// the accumulator is mutex-guarded.
+	// so it can be attached to the tool-result message below. Tools may run
+	// concurrently, and may fan out goroutines internally; the accumulator is
+	// mutex-guarded.
 	var otherUsage llmhttp.UsageAccumulator
 	ctx = llmhttp.WithUsageCollector(ctx, otherUsage.Collect)
 
+	var calls []llm.Content
 	for _, c := range content {
-		if c.Type != llm.ContentTypeToolUse {
-			continue
-		}
-
-		l.logger.Debug("executing tool", "name", c.ToolName, "id", c.ID)
-
-		// Find the tool
-		var tool *llm.Tool
-		for _, t := range l.tools {
-			if t.Name == c.ToolName {
-				tool = t
-				break
-			}
-		}
-
-		if tool == nil {
-			l.logger.Error("tool not found", "name", c.ToolName)
-			toolResults = append(toolResults, llm.Content{
-				Type:      llm.ContentTypeToolResult,
-				ToolUseID: c.ID,
-				ToolError: true,
-				ToolResult: []llm.Content{
-					{Type: llm.ContentTypeText, Text: fmt.Sprintf("Tool '%s' not found", c.ToolName)},
-				},
-			})
-			continue
+		if c.Type == llm.ContentTypeToolUse {
+			calls = append(calls, c)
 		}
-
-		// Execute the tool with working directory and progress callback set in context
-		toolCtx := ctx
-		if l.workingDir != "" {
-			toolCtx = llm.WithWorkingDir(ctx, l.workingDir)
-		}
-		if l.onToolProgress != nil {
-			toolCtx = llm.WithToolProgress(toolCtx, l.onToolProgress)
-		}
-		toolCtx = llm.WithToolUseID(toolCtx, c.ID)
-		toolCtx = llm.WithLLMService(toolCtx, l.llm)
-		startTime := time.Now()
-		result := tool.Run(toolCtx, c.ToolInput)
-		endTime := time.Now()
-
-		var toolResultContent []llm.Content
-		if result.Error != nil {
-			l.logger.Error("tool execution failed", "name", c.ToolName, "error", result.Error)
-			toolResultContent = []llm.Content{
-				{Type: llm.ContentTypeText, Text: result.Error.Error()},
+	}
+	toolResults := make([]llm.Content, len(calls))
+	for start := 0; start < len(calls); {
+		end := start + 1
+		if l.isReadOnlyCall(calls[start]) {
+			for end < len(calls) && l.isReadOnlyCall(calls[end]) {
+				end++
 			}
-		} else {
-			toolResultContent = result.LLMContent
-			l.logger.Debug("tool executed successfully", "name", c.ToolName, "duration", endTime.Sub(startTime))
 		}
-
-		toolResults = append(toolResults, llm.Content{
-			Type:             llm.ContentTypeToolResult,
-			ToolUseID:        c.ID,
-			ToolError:        result.Error != nil,
-			ToolResult:       toolResultContent,
-			ToolUseStartTime: &startTime,
-			ToolUseEndTime:   &endTime,
-			Display:          result.Display,
-		})
+		l.executeToolBatch(ctx, calls[start:end], toolResults[start:end])
+		start = end
 	}
 
 	if len(toolResults) > 0 {
@@ -862,6 +962,112 @@ func (l *Loop) executeToolCalls(ctx context.Context, content []llm.Content) erro
 	return nil
 }
 
+// findTool returns the tool named name, or nil.
+func (l *Loop) findTool(name string) *llm.Tool {
+	for _, t := range l.tools {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// isReadOnlyCall reports whether call may run concurrently with other
+// read-only calls.
+func (l *Loop) isReadOnlyCall(call llm.Content) bool {
+	tool := l.findTool(call.ToolName)
+	return tool != nil && tool.ReadOnly
+}
+
+// executeToolBatch runs calls, writing each one's tool_result to the same
+// index of results. A batch of more than one call is all read-only and
+// runs concurrently, at most maxParallelTools at a time, started in order.
+func (l *Loop) executeToolBatch(ctx context.Context, calls, results []llm.Content) {
+	limit := l.maxParallelTools
+	if limit <= 0 {
+		limit = DefaultMaxParallelTools
+	}
+	if len(calls) == 1 || limit == 1 {
+		for i, c := range calls {
+			results[i] = l.executeToolCall(ctx, c)
+		}
+		return
+	}
+	l.logger.Debug("executing read-only tools concurrently", "count", len(calls), "limit", limit)
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, c := range calls {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			results[i] = l.executeToolCall(ctx, c)
+		})
+	}
+	wg.Wait()
+}
+
+// executeToolCall runs one tool call and returns its tool_result.
+func (l *Loop) executeToolCall(ctx context.Context, c llm.Content) llm.Content {
+	l.logger.Debug("executing tool", "name", c.ToolName, "id", c.ID)
+
+	tool := l.findTool(c.ToolName)
+	if tool == nil {
+		l.logger.Error("tool not found", "name", c.ToolName)
+		return llm.Content{
+			Type:      llm.ContentTypeToolResult,
+			ToolUseID: c.ID,
+			ToolError: true,
+			ToolResult: []llm.Content{
+				{Type: llm.ContentTypeText, Text: fmt.Sprintf("Tool '%s' not found", c.ToolName)},
+			},
+		}
+	}
+
+	// Execute the tool with working directory and progress callback set in context
+	toolCtx := ctx
+	if l.workingDir != "" {
+		toolCtx = llm.WithWorkingDir(ctx, l.workingDir)
+	}
+	if l.onToolProgress != nil {
+		toolCtx = llm.WithToolProgress(toolCtx, l.onToolProgress)
+	}
+	toolCtx = llm.WithToolUseID(toolCtx, c.ID)
+	toolCtx = llm.WithLLMService(toolCtx, l.llm)
+	startTime := time.Now()
+	result := l.runTool(toolCtx, tool, c)
+	endTime := time.Now()
+
+	var toolResultContent []llm.Content
+	if result.Error != nil {
+		l.logger.Error("tool execution failed", "name", c.ToolName, "error", result.Error)
+		toolResultContent = []llm.Content{
+			{Type: llm.ContentTypeText, Text: result.Error.Error()},
+		}
+	} else {
+		toolResultContent = result.LLMContent
+		l.logger.Debug("tool executed successfully", "name", c.ToolName, "duration", endTime.Sub(startTime))
+	}
+	if l.postToolUse != nil {
+		replaced, err := l.postToolUse(toolCtx, c, toolResultContent, result.Error != nil)
+		if err != nil {
+			l.logger.Error("post-tool-use hook failed", "name", c.ToolName, "error", err)
+			result.Error = err
+			replaced = []llm.Content{{Type: llm.ContentTypeText, Text: err.Error()}}
+		}
+		toolResultContent = replaced
+	}
+
+	return llm.Content{
+		Type:             llm.ContentTypeToolResult,
+		ToolUseID:        c.ID,
+		ToolError:        result.Error != nil,
+		ToolResult:       toolResultContent,
+		ToolUseStartTime: &startTime,
+		ToolUseEndTime:   &endTime,
+		Display:          result.Display,
+	}
+}
+
 // insertMissingToolResults fixes tool_result issues in the conversation history:
 //  1. Adds error results for tool_uses that were requested but not included in the next message.
 //     This can happen when a request is cancelled or fails after the LLM responds with tool_use
@@ -0,0 +1,213 @@
+package loop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+// multiCallLLMService answers the first request with the given tool calls
+// and the second by ending the turn. It records the messages of each
+// request.
+type multiCallLLMService struct {
+	calls []llm.Content
+	sent  [][]llm.Message
+}
+
+func (m *multiCallLLMService) Do(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	m.sent = append(m.sent, req.Messages)
+	if len(m.sent) == 1 {
+		return &llm.Response{Role: llm.MessageRoleAssistant, Content: m.calls, StopReason: llm.StopReasonToolUse}, nil
+	}
+	return &llm.Response{
+		Role:       llm.MessageRoleAssistant,
+		Content:    []llm.Content{{Type: llm.ContentTypeText, Text: "done"}},
+		StopReason: llm.StopReasonEndTurn,
+	}, nil
+}
+
+func (m *multiCallLLMService) Provider() string        { return "" }
+func (m *multiCallLLMService) TokenContextWindow() int { return 200000 }
+func (m *multiCallLLMService) MaxImageDimension() int  { return 2000 }
+func (m *multiCallLLMService) MaxImageBytes() int      { return 5 * 1024 * 1024 }
+func (m *multiCallLLMService) SupportsImages() bool    { return false }
+
+// toolCalls returns tool_use blocks calling the named tools in order, with
+// IDs tu_0, tu_1, ...
+func toolCalls(names ...string) []llm.Content {
+	var calls []llm.Content
+	for i, name := range names {
+		calls = append(calls, llm.Content{Type: llm.ContentTypeToolUse, ID: fmt.Sprintf("tu_%d", i), ToolName: name, ToolInput: json.RawMessage(`{}`)})
+	}
+	return calls
+}
+
+// runToolCalls runs one turn whose response makes calls and returns the
+// tool results sent back to the LLM.
+func runToolCalls(t *testing.T, cfg Config, calls []llm.Content) []llm.Content {
+	t.Helper()
+	svc := &multiCallLLMService{calls: calls}
+	cfg.LLM = svc
+	cfg.RecordMessage = func(context.Context, llm.Message, llm.Usage, []llm.PurposedUsage) error { return nil }
+	l := NewLoop(cfg)
+	l.QueueUserMessage(llm.UserStringMessage("go"))
+	if err := l.ProcessOneTurn(context.Background()); err != nil {
+		t.Fatalf("ProcessOneTurn: %v", err)
+	}
+	if len(svc.sent) != 2 {
+		t.Fatalf("got %d requests, want 2", len(svc.sent))
+	}
+	msgs := svc.sent[1]
+	return msgs[len(msgs)-1].Content
+}
+
+// concurrencyProbe counts the calls of the tools it makes that are running.
+type concurrencyProbe struct {
+	running atomic.Int32
+	mu      sync.Mutex
+	peak    int32
+}
+
+func (p *concurrencyProbe) tool(name string, readOnly bool, hold time.Duration) *llm.Tool {
+	return &llm.Tool{
+		Name:        name,
+		InputSchema: llm.EmptySchema(),
+		ReadOnly:    readOnly,
+		Run: func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+			n := p.running.Add(1)
+			p.mu.Lock()
+			p.peak = max(p.peak, n)
+			p.mu.Unlock()
+			time.Sleep(hold)
+			p.running.Add(-1)
+			return llm.ToolOut{LLMContent: llm.TextContent(fmt.Sprintf("%s %s alone=%v", name, llm.ToolUseID(ctx), n == 1))}
+		},
+	}
+}
+
+func TestReadOnlyToolsRunConcurrently(t *testing.T) {
+	probe := &concurrencyProbe{}
+	read := probe.tool("read", true, 50*time.Millisecond)
+	write := probe.tool("write", false, 10*time.Millisecond)
+	results := runToolCalls(t, Config{Tools: []*llm.Tool{read, write}},
+		toolCalls("read", "read", "read", "write", "read", "read"))
+
+	if probe.peak != 3 {
+		t.Errorf("peak concurrency = %d, want 3", probe.peak)
+	}
+	if len(results) != 6 {
+		t.Fatalf("got %d results, want 6", len(results))
+	}
+	for i, r := range results {
+		if want := fmt.Sprintf("tu_%d", i); r.ToolUseID != want {
+			t.Errorf("result %d is for %s, want %s", i, r.ToolUseID, want)
+		}
+	}
+	// The mutating call runs on its own, between the two read batches.
+	if got := results[3].ToolResult[0].Text; got != "write tu_3 alone=true" {
+		t.Errorf("write result = %q", got)
+	}
+}
+
+func TestMaxParallelTools(t *testing.T) {
+	probe := &concurrencyProbe{}
+	read := probe.tool("read", true, 20*time.Millisecond)
+	runToolCalls(t, Config{Tools: []*llm.Tool{read}, MaxParallelTools: 2},
+		toolCalls("read", "read", "read", "read", "read"))
+	if probe.peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", probe.peak)
+	}
+
+	probe = &concurrencyProbe{}
+	read = probe.tool("read", true, time.Millisecond)
+	runToolCalls(t, Config{Tools: []*llm.Tool{read}, MaxParallelTools: 1},
+		toolCalls("read", "read", "read"))
+	if probe.peak != 1 {
+		t.Errorf("MaxParallelTools 1: peak concurrency = %d, want 1", probe.peak)
+	}
+}
+
+func TestMutatingToolsRunSequentially(t *testing.T) {
+	probe := &concurrencyProbe{}
+	write := probe.tool("write", false, 5*time.Millisecond)
+	results := runToolCalls(t, Config{Tools: []*llm.Tool{write}}, toolCalls("write", "write", "missing", "write"))
+	if probe.peak != 1 {
+		t.Errorf("peak concurrency = %d, want 1", probe.peak)
+	}
+	if !results[2].ToolError {
+		t.Errorf("call to an unknown tool should fail: %+v", results[2])
+	}
+}
+
+func TestConcurrentToolsReportProgress(t *testing.T) {
+	var mu sync.Mutex
+	progress := map[string]string{}
+	read := &llm.Tool{
+		Name:        "read",
+		InputSchema: llm.EmptySchema(),
+		ReadOnly:    true,
+		Run: func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+			if report := llm.GetToolProgress(ctx); report != nil {
+				report(llm.ToolProgress{ToolUseID: llm.ToolUseID(ctx), ToolName: "read", Output: "working on " + llm.ToolUseID(ctx)})
+			}
+			return llm.ToolOut{LLMContent: llm.TextContent("ok")}
+		},
+	}
+	runToolCalls(t, Config{
+		Tools: []*llm.Tool{read},
+		OnToolProgress: func(p llm.ToolProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress[p.ToolUseID] = p.Output
+		},
+	}, toolCalls("read", "read", "read"))
+	for i := range 3 {
+		id := fmt.Sprintf("tu_%d", i)
+		if got := progress[id]; got != "working on "+id {
+			t.Errorf("progress for %s = %q", id, got)
+		}
+	}
+}
+
+func TestConcurrentToolsCancelled(t *testing.T) {
+	started := make(chan struct{}, 3)
+	read := &llm.Tool{
+		Name:        "read",
+		InputSchema: llm.EmptySchema(),
+		ReadOnly:    true,
+		Run: func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+			started <- struct{}{}
+			<-ctx.Done()
+			return llm.ErrorToolOut(ctx.Err())
+		},
+	}
+	svc := &multiCallLLMService{calls: toolCalls("read", "read", "read")}
+	l := NewLoop(Config{
+		LLM:           svc,
+		Tools:         []*llm.Tool{read},
+		RecordMessage: func(context.Context, llm.Message, llm.Usage, []llm.PurposedUsage) error { return nil },
+	})
+	l.QueueUserMessage(llm.UserStringMessage("go"))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.ProcessOneTurn(ctx) }()
+	for range 3 {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("read-only calls did not all start")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("turn did not stop after cancellation")
+	}
+}
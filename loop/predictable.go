@@ -72,6 +72,10 @@ func requestMentions(req *llm.Request, needle string) bool {
 //   - "delay: <seconds>" - delays response by specified seconds
 //   - "fail <error>" - emits a retry warning and returns a failure
 //   - See Do() method for complete list of supported patterns
+//
+// Tests that need scripted multi-turn behavior play a Scenario instead (see
+// NewPredictableScenarioService); the patterns above answer whatever the
+// scenario does not.
 type PredictableService struct {
 	// TokenContextWindow size
 	tokenContextWindow int
@@ -79,6 +83,8 @@ type PredictableService struct {
 	// Recent requests for testing inspection
 	recentRequests []*llm.Request
 	responseDelay  time.Duration
+	// scenario, if set, answers the requests it has a step for.
+	scenario *scenarioPlayer
 }
 
 // NewPredictableService creates a new predictable LLM service
@@ -140,6 +146,22 @@ func (s *PredictableService) Do(ctx context.Context, req *llm.Request) (*llm.Res
 	// Calculate input token count based on the request content
 	inputTokens := s.countRequestTokens(req)
 
+	if s.scenario != nil {
+		if resp, ok, err := s.scenario.respond(ctx, req, inputTokens); ok {
+			return resp, err
+		}
+	}
+
+	// Structured requests get the simplest value matching their schema.
+	if len(req.ResponseSchema) > 0 {
+		var schema map[string]any
+		if err := json.Unmarshal(req.ResponseSchema, &schema); err != nil {
+			return nil, fmt.Errorf("predictable: bad response schema: %w", err)
+		}
+		data, _ := json.Marshal(exampleValue(schema))
+		return s.makeResponse(string(data), inputTokens), nil
+	}
+
 	// Extract the text content from the last user message
 	var inputText string
 	var hasToolResult bool
@@ -1182,3 +1204,56 @@ const wideTablesMarkdown = `Here are some wide tables to test rendering:
 | NPS Score | 42 | 45 | 48 | 52 | +23.8% | 📈 |
 
 That's a variety of table widths for testing!`
+
+// exampleValue returns a simple value matching a JSON Schema: the first
+// allowed value where there is a choice, and the smallest one otherwise.
+func exampleValue(schema map[string]any) any {
+	if c, ok := schema["const"]; ok {
+		return c
+	}
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	for _, kw := range []string{"anyOf", "oneOf"} {
+		if subs, ok := schema[kw].([]any); ok && len(subs) > 0 {
+			if sub, ok := subs[0].(map[string]any); ok {
+				return exampleValue(sub)
+			}
+		}
+	}
+	typ := schema["type"]
+	if types, ok := typ.([]any); ok && len(types) > 0 {
+		typ = types[0]
+	}
+	number := func(kw string) float64 {
+		n, _ := schema[kw].(float64)
+		return n
+	}
+	switch typ {
+	case "object":
+		obj := map[string]any{}
+		props, _ := schema["properties"].(map[string]any)
+		for name, prop := range props {
+			if prop, ok := prop.(map[string]any); ok {
+				obj[name] = exampleValue(prop)
+			}
+		}
+		return obj
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		arr := []any{}
+		for range int(max(number("minItems"), 1)) {
+			arr = append(arr, exampleValue(items))
+		}
+		return arr
+	case "string":
+		return "example" + strings.Repeat("x", max(int(number("minLength"))-len("example"), 0))
+	case "integer", "number":
+		return number("minimum")
+	case "boolean":
+		return false
+	case "null":
+		return nil
+	}
+	return "example"
+}
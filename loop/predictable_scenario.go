@@ -0,0 +1,499 @@
+package loop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"shelley.exe.dev/llm"
+)
+
+// PredictableScenarioPrefix selects a scripted predictable model: the model
+// id "predictable:testdata/fix-bug.yaml" is the predictable service playing
+// that scenario file.
+const PredictableScenarioPrefix = "predictable:"
+
+// A Scenario scripts the predictable service for tests that need more than
+// its built-in patterns: call bash with X, then patch Y, then reply Z.
+// Scenario files are YAML (or JSON):
+//
+//	steps:
+//	  - match: {user: "fix the bug"}
+//	    respond:
+//	      text: "Let me look."
+//	      tool_calls:
+//	        - {tool: bash, input: {command: "go test ./..."}}
+//	  - match: {tool: bash, tool_result_regex: "FAIL: (\\w+)"}
+//	    respond:
+//	      thinking: "{{index .Groups 1}} fails."
+//	      text: "{{index .Groups 1}} is failing; that is the bug."
+//	      stream: true
+//	      usage: {input_tokens: 1200, output_tokens: 40}
+//
+// Each request is answered by the first step not used yet whose match
+// accepts it; a step with repeat set is never used up. Requests no step
+// accepts get the built-in behavior, so slug generation and the like keep
+// working.
+type Scenario struct {
+	Steps []ScenarioStep `yaml:"steps"`
+}
+
+// ScenarioStep is one scripted answer and the requests it applies to.
+type ScenarioStep struct {
+	Match   ScenarioMatch    `yaml:"match"`
+	Respond ScenarioResponse `yaml:"respond"`
+	Repeat  bool             `yaml:"repeat"`
+}
+
+// ScenarioMatch looks at the last message of a request, which holds either
+// the user's text or the results of the tools the model called. Every field
+// set must match; an empty match accepts anything.
+type ScenarioMatch struct {
+	// User must be contained in the user's text; UserRegex must match it.
+	User      string `yaml:"user"`
+	UserRegex string `yaml:"user_regex"`
+	// Tool is the name of a tool whose result the message carries.
+	Tool string `yaml:"tool"`
+	// ToolResult must be contained in the tool results' text;
+	// ToolResultRegex must match it.
+	ToolResult      string `yaml:"tool_result"`
+	ToolResultRegex string `yaml:"tool_result_regex"`
+	// ToolError requires a failed (true) or successful (false) tool result.
+	ToolError *bool `yaml:"tool_error"`
+
+	userRegex, toolResultRegex *regexp.Regexp
+}
+
+// ScenarioResponse is what the model answers. Text, thinking and string
+// values in tool inputs are text/template templates over scenarioData.
+type ScenarioResponse struct {
+	Text      string             `yaml:"text"`
+	Thinking  string             `yaml:"thinking"`
+	ToolCalls []ScenarioToolCall `yaml:"tool_calls"`
+	// StopReason is one of end_turn, tool_use, max_tokens, refusal or
+	// stop_sequence. It defaults to tool_use when there are tool calls and
+	// end_turn otherwise.
+	StopReason string `yaml:"stop_reason"`
+	// Error fails the request with this message instead of answering.
+	Error string `yaml:"error"`
+	// Delay holds the answer back, e.g. "1.5s".
+	Delay string `yaml:"delay"`
+	// Stream sends the thinking and text as word-by-word deltas first.
+	Stream bool          `yaml:"stream"`
+	Usage  ScenarioUsage `yaml:"usage"`
+
+	delay      time.Duration
+	stopReason llm.StopReason
+	templates  map[string]*template.Template
+}
+
+// ScenarioToolCall is a tool use in a scripted answer.
+type ScenarioToolCall struct {
+	Tool  string `yaml:"tool"`
+	Input any    `yaml:"input"`
+}
+
+// ScenarioUsage overrides the token counts and cost the predictable service
+// would report. Zero fields keep its estimates.
+type ScenarioUsage struct {
+	InputTokens              uint64  `yaml:"input_tokens"`
+	OutputTokens             uint64  `yaml:"output_tokens"`
+	CacheCreationInputTokens uint64  `yaml:"cache_creation_input_tokens"`
+	CacheReadInputTokens     uint64  `yaml:"cache_read_input_tokens"`
+	CostUSD                  float64 `yaml:"cost_usd"`
+}
+
+// scenarioData is what response templates see.
+type scenarioData struct {
+	// User is the user's text and ToolResult the tool results' text.
+	User       string
+	ToolResult string
+	// Tool is the name of the tool whose result came back.
+	Tool string
+	// Groups holds the submatches of whichever regex matched, user_regex
+	// taking precedence.
+	Groups []string
+}
+
+var scenarioStopReasons = map[string]llm.StopReason{
+	"end_turn":      llm.StopReasonEndTurn,
+	"tool_use":      llm.StopReasonToolUse,
+	"max_tokens":    llm.StopReasonMaxTokens,
+	"refusal":       llm.StopReasonRefusal,
+	"stop_sequence": llm.StopReasonStopSequence,
+}
+
+// LoadScenario reads and checks the scenario file at path.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read scenario: %w", err)
+	}
+	var sc Scenario
+	if err := yaml.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("parse scenario %s: %w", path, err)
+	}
+	if len(sc.Steps) == 0 {
+		return nil, fmt.Errorf("scenario %s has no steps", path)
+	}
+	for i := range sc.Steps {
+		if err := sc.Steps[i].compile(); err != nil {
+			return nil, fmt.Errorf("scenario %s: step %d: %w", path, i+1, err)
+		}
+	}
+	return &sc, nil
+}
+
+func (st *ScenarioStep) compile() error {
+	m := &st.Match
+	var err error
+	if m.UserRegex != "" {
+		if m.userRegex, err = regexp.Compile(m.UserRegex); err != nil {
+			return fmt.Errorf("user_regex: %w", err)
+		}
+	}
+	if m.ToolResultRegex != "" {
+		if m.toolResultRegex, err = regexp.Compile(m.ToolResultRegex); err != nil {
+			return fmt.Errorf("tool_result_regex: %w", err)
+		}
+	}
+
+	r := &st.Respond
+	if r.Delay != "" {
+		if r.delay, err = time.ParseDuration(r.Delay); err != nil {
+			return fmt.Errorf("delay: %w", err)
+		}
+	}
+	switch {
+	case r.StopReason != "":
+		var ok bool
+		if r.stopReason, ok = scenarioStopReasons[r.StopReason]; !ok {
+			return fmt.Errorf("unknown stop_reason %q", r.StopReason)
+		}
+	case len(r.ToolCalls) > 0:
+		r.stopReason = llm.StopReasonToolUse
+	default:
+		r.stopReason = llm.StopReasonEndTurn
+	}
+	r.templates = map[string]*template.Template{}
+	texts := []string{r.Text, r.Thinking}
+	for i, call := range r.ToolCalls {
+		if call.Tool == "" {
+			return fmt.Errorf("tool call %d has no tool", i+1)
+		}
+		texts = append(texts, templateStrings(call.Input)...)
+	}
+	for _, text := range texts {
+		if _, ok := r.templates[text]; ok || !strings.Contains(text, "{{") {
+			continue
+		}
+		t, err := template.New("").Option("missingkey=error").Parse(text)
+		if err != nil {
+			return err
+		}
+		r.templates[text] = t
+	}
+	return nil
+}
+
+// templateStrings returns the strings in a decoded tool input.
+func templateStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case map[string]any:
+		var out []string
+		for _, e := range v {
+			out = append(out, templateStrings(e)...)
+		}
+		return out
+	case []any:
+		var out []string
+		for _, e := range v {
+			out = append(out, templateStrings(e)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// scenarioPlayer is a Scenario being played by one PredictableService.
+type scenarioPlayer struct {
+	path  string
+	steps []ScenarioStep
+	mu    sync.Mutex
+	used  []bool
+}
+
+// lastTurn describes the last message of req for matching.
+func lastTurn(req *llm.Request) scenarioData {
+	var d scenarioData
+	if len(req.Messages) == 0 {
+		return d
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != llm.MessageRoleUser {
+		return d
+	}
+	toolNames := map[string]string{}
+	for _, m := range req.Messages {
+		for _, c := range m.Content {
+			if c.Type == llm.ContentTypeToolUse {
+				toolNames[c.ID] = c.ToolName
+			}
+		}
+	}
+	var user, results []string
+	for _, c := range last.Content {
+		switch c.Type {
+		case llm.ContentTypeText:
+			user = append(user, strings.TrimSpace(c.Text))
+		case llm.ContentTypeToolResult:
+			if d.Tool == "" {
+				d.Tool = toolNames[c.ToolUseID]
+			}
+			for _, tr := range c.ToolResult {
+				results = append(results, tr.Text)
+			}
+		}
+	}
+	d.User = strings.Join(user, "\n")
+	d.ToolResult = strings.Join(results, "\n")
+	return d
+}
+
+// toolErrored reports whether a tool result in the last message failed.
+func toolErrored(req *llm.Request) bool {
+	if len(req.Messages) == 0 {
+		return false
+	}
+	for _, c := range req.Messages[len(req.Messages)-1].Content {
+		if c.Type == llm.ContentTypeToolResult && c.ToolError {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether m accepts the request, and the regex submatches.
+func (m *ScenarioMatch) match(req *llm.Request, d scenarioData) ([]string, bool) {
+	if m.User != "" && !strings.Contains(d.User, m.User) ||
+		m.ToolResult != "" && !strings.Contains(d.ToolResult, m.ToolResult) ||
+		m.Tool != "" && m.Tool != d.Tool ||
+		m.ToolError != nil && *m.ToolError != toolErrored(req) {
+		return nil, false
+	}
+	var groups []string
+	if m.toolResultRegex != nil {
+		if groups = m.toolResultRegex.FindStringSubmatch(d.ToolResult); groups == nil {
+			return nil, false
+		}
+	}
+	if m.userRegex != nil {
+		if groups = m.userRegex.FindStringSubmatch(d.User); groups == nil {
+			return nil, false
+		}
+	}
+	return groups, true
+}
+
+// next finds the step that answers req and uses it up.
+func (p *scenarioPlayer) next(req *llm.Request) (*ScenarioResponse, scenarioData, bool) {
+	d := lastTurn(req)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.steps {
+		if p.used[i] {
+			continue
+		}
+		groups, ok := p.steps[i].Match.match(req, d)
+		if !ok {
+			continue
+		}
+		if !p.steps[i].Repeat {
+			p.used[i] = true
+		}
+		d.Groups = groups
+		return &p.steps[i].Respond, d, true
+	}
+	return nil, d, false
+}
+
+// render executes text if it is a template.
+func (r *ScenarioResponse) render(text string, d scenarioData) (string, error) {
+	t, ok := r.templates[text]
+	if !ok {
+		return text, nil
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// renderInput renders the strings in a decoded tool input.
+func (r *ScenarioResponse) renderInput(v any, d scenarioData) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return r.render(v, d)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			re, err := r.renderInput(e, d)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = re
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			re, err := r.renderInput(e, d)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = re
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// respond answers req from the scenario. It reports false when no step
+// accepts req.
+func (p *scenarioPlayer) respond(ctx context.Context, req *llm.Request, inputTokens uint64) (*llm.Response, bool, error) {
+	r, d, ok := p.next(req)
+	if !ok {
+		return nil, false, nil
+	}
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+	if r.Error != "" {
+		return nil, true, fmt.Errorf("predictable error: %s", r.Error)
+	}
+	resp, err := r.build(d, inputTokens)
+	if err != nil {
+		return nil, true, fmt.Errorf("scenario %s: %w", p.path, err)
+	}
+	if r.Stream && req.OnStream != nil {
+		for i, c := range resp.Content {
+			switch c.Type {
+			case llm.ContentTypeThinking:
+				streamWords(req.OnStream, "thinking", c.Thinking, i)
+			case llm.ContentTypeText:
+				streamWords(req.OnStream, "text", c.Text, i)
+			}
+		}
+	}
+	return resp, true, nil
+}
+
+func streamWords(onStream func(llm.StreamDelta), typ, text string, index int) {
+	for _, word := range strings.SplitAfter(text, " ") {
+		if word != "" {
+			onStream(llm.StreamDelta{Type: typ, Text: word, Index: index})
+		}
+	}
+}
+
+func (r *ScenarioResponse) build(d scenarioData, inputTokens uint64) (*llm.Response, error) {
+	var content []llm.Content
+	thinking, err := r.render(r.Thinking, d)
+	if err != nil {
+		return nil, err
+	}
+	if thinking != "" {
+		content = append(content, llm.Content{Type: llm.ContentTypeThinking, Thinking: thinking, Signature: "pred-sig"})
+	}
+	text, err := r.render(r.Text, d)
+	if err != nil {
+		return nil, err
+	}
+	// A refusal's text is its explanation, not something the model said.
+	if r.stopReason != llm.StopReasonRefusal && (text != "" || len(r.ToolCalls) == 0 && thinking == "") {
+		content = append(content, llm.Content{Type: llm.ContentTypeText, Text: text})
+	}
+	outputLen := len(thinking) + len(text)
+	now := time.Now().UnixNano()
+	for i, call := range r.ToolCalls {
+		input, err := r.renderInput(call.Input, d)
+		if err != nil {
+			return nil, err
+		}
+		if input == nil {
+			input = map[string]any{}
+		}
+		inputJSON, err := json.Marshal(input)
+		if err != nil {
+			return nil, fmt.Errorf("tool call %d input: %w", i+1, err)
+		}
+		outputLen += len(inputJSON)
+		content = append(content, llm.Content{
+			ID:        fmt.Sprintf("tool_%d_%d", now%1000000, i),
+			Type:      llm.ContentTypeToolUse,
+			ToolName:  call.Tool,
+			ToolInput: inputJSON,
+		})
+	}
+
+	usage := llm.Usage{
+		InputTokens:              inputTokens,
+		OutputTokens:             max(uint64(outputLen/4), 1),
+		CacheCreationInputTokens: r.Usage.CacheCreationInputTokens,
+		CacheReadInputTokens:     r.Usage.CacheReadInputTokens,
+		CostUSD:                  0.001,
+	}
+	if r.Usage.InputTokens != 0 {
+		usage.InputTokens = r.Usage.InputTokens
+	}
+	if r.Usage.OutputTokens != 0 {
+		usage.OutputTokens = r.Usage.OutputTokens
+	}
+	if r.Usage.CostUSD != 0 {
+		usage.CostUSD = r.Usage.CostUSD
+	}
+	resp := &llm.Response{
+		ID:         fmt.Sprintf("pred-scenario-%d", now),
+		Type:       "message",
+		Role:       llm.MessageRoleAssistant,
+		Model:      "predictable-v1",
+		Content:    content,
+		StopReason: r.stopReason,
+		Usage:      usage,
+	}
+	if r.stopReason == llm.StopReasonRefusal {
+		// Like makeRefusalResponse: providers often send only a thinking block.
+		if len(resp.Content) == 0 {
+			resp.Content = []llm.Content{{Type: llm.ContentTypeThinking, Signature: "pred-sig"}}
+		}
+		resp.RefusalDetails = &llm.RefusalDetails{Category: "scenario", Explanation: text}
+	}
+	return resp, nil
+}
+
+// NewPredictableScenarioService returns a predictable service that plays
+// the scenario at path, from its first step.
+func NewPredictableScenarioService(path string) (*PredictableService, error) {
+	sc, err := LoadScenario(path)
+	if err != nil {
+		return nil, err
+	}
+	svc := NewPredictableService()
+	svc.scenario = &scenarioPlayer{path: path, steps: sc.Steps, used: make([]bool, len(sc.Steps))}
+	return svc, nil
+}
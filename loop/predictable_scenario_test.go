@@ -0,0 +1,135 @@
+package loop
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shelley.exe.dev/llm"
+)
+
+const fixBugScenario = `
+steps:
+  - match: {user_regex: "fix (\\w+)"}
+    respond:
+      text: "Let me run the tests for {{index .Groups 1}}."
+      tool_calls:
+        - tool: bash
+          input: {command: "go test ./{{index .Groups 1}}/...", slow_ok: true}
+  - match: {tool: bash, tool_result_regex: "FAIL: (\\w+)"}
+    respond:
+      thinking: "{{index .Groups 1}} fails."
+      text: "{{index .Groups 1}} is the bug."
+      stream: true
+      usage: {input_tokens: 1200, output_tokens: 40, cost_usd: 0.25}
+  - match: {user: "too long"}
+    respond: {text: "This is cut", stop_reason: max_tokens}
+  - match: {user: "broken"}
+    respond: {error: "overloaded"}
+    repeat: true
+`
+
+func writeScenario(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPredictableScenario(t *testing.T) {
+	ctx := context.Background()
+	svc, err := NewPredictableScenarioService(writeScenario(t, fixBugScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := []llm.Message{llm.UserStringMessage("please fix parser")}
+	resp, err := svc.Do(ctx, &llm.Request{Messages: history})
+	if err != nil {
+		t.Fatalf("first turn: %v", err)
+	}
+	if resp.StopReason != llm.StopReasonToolUse || len(resp.Content) != 2 {
+		t.Fatalf("first turn = %+v", resp)
+	}
+	call := resp.Content[1]
+	var input struct {
+		Command string `json:"command"`
+		SlowOK  bool   `json:"slow_ok"`
+	}
+	if err := json.Unmarshal(call.ToolInput, &input); err != nil {
+		t.Fatal(err)
+	}
+	if call.ToolName != "bash" || input.Command != "go test ./parser/..." || !input.SlowOK {
+		t.Errorf("tool call = %s %s", call.ToolName, call.ToolInput)
+	}
+
+	history = append(history, resp.ToMessage(), llm.Message{
+		Role: llm.MessageRoleUser,
+		Content: []llm.Content{{
+			Type:       llm.ContentTypeToolResult,
+			ToolUseID:  call.ID,
+			ToolResult: []llm.Content{{Type: llm.ContentTypeText, Text: "--- FAIL: TestLexer"}},
+		}},
+	})
+	var streamed strings.Builder
+	resp, err = svc.Do(ctx, &llm.Request{Messages: history, OnStream: func(d llm.StreamDelta) {
+		if d.Type == "text" {
+			streamed.WriteString(d.Text)
+		}
+	}})
+	if err != nil {
+		t.Fatalf("second turn: %v", err)
+	}
+	if resp.Content[0].Thinking != "TestLexer fails." || resp.Content[1].Text != "TestLexer is the bug." {
+		t.Errorf("second turn = %+v", resp.Content)
+	}
+	if streamed.String() != "TestLexer is the bug." {
+		t.Errorf("streamed %q", streamed.String())
+	}
+	if resp.StopReason != llm.StopReasonEndTurn || resp.Usage.InputTokens != 1200 || resp.Usage.OutputTokens != 40 || resp.Usage.CostUSD != 0.25 {
+		t.Errorf("stop reason %v, usage %+v", resp.StopReason, resp.Usage)
+	}
+
+	// Used steps do not answer again; the built-in patterns take over.
+	resp, err = svc.Do(ctx, &llm.Request{Messages: []llm.Message{llm.UserStringMessage("fix parser")}})
+	if err != nil || resp.Content[0].Text == "Let me run the tests for parser." {
+		t.Errorf("a used step answered again: %+v, %v", resp, err)
+	}
+	resp, err = svc.Do(ctx, &llm.Request{Messages: []llm.Message{llm.UserStringMessage("echo: built in")}})
+	if err != nil || resp.Content[0].Text != "built in" {
+		t.Errorf("built-in pattern = %+v, %v", resp, err)
+	}
+
+	resp, err = svc.Do(ctx, &llm.Request{Messages: []llm.Message{llm.UserStringMessage("this is too long")}})
+	if err != nil || resp.StopReason != llm.StopReasonMaxTokens {
+		t.Errorf("max tokens = %+v, %v", resp, err)
+	}
+	for range 2 {
+		if _, err := svc.Do(ctx, &llm.Request{Messages: []llm.Message{llm.UserStringMessage("broken")}}); err == nil || !strings.Contains(err.Error(), "overloaded") {
+			t.Errorf("repeated error step = %v", err)
+		}
+	}
+}
+
+func TestLoadScenarioErrors(t *testing.T) {
+	for _, tc := range []struct {
+		text, want string
+	}{
+		{"steps: []", "no steps"},
+		{"steps:\n  - match: {user_regex: \"(\"}", "user_regex"},
+		{"steps:\n  - respond: {stop_reason: done}", "stop_reason"},
+		{"steps:\n  - respond: {delay: soon}", "delay"},
+		{"steps:\n  - respond: {tool_calls: [{input: {}}]}", "no tool"},
+		{"steps:\n  - respond: {text: \"{{.Missing\"}", "step 1"},
+	} {
+		_, err := LoadScenario(writeScenario(t, tc.text))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("LoadScenario(%q) = %v, want %q", tc.text, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package loop
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"shelley.exe.dev/llm"
+)
+
+// TestPredictableResponseSchema verifies structured requests to the
+// predictable model get JSON that passes their own schema, so callers of
+// llm.DoJSON can be tested without a real model.
+func TestPredictableResponseSchema(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"required": ["slug", "steps", "kind"],
+		"properties": {
+			"slug": {"type": "string", "minLength": 12},
+			"kind": {"enum": ["bug", "feature"]},
+			"count": {"type": "integer", "minimum": 2},
+			"steps": {"type": "array", "minItems": 2, "items": {"type": "object", "properties": {"done": {"type": "boolean"}}}}
+		}
+	}`)
+	type result struct {
+		Slug  string `json:"slug"`
+		Kind  string `json:"kind"`
+		Count int    `json:"count"`
+		Steps []struct {
+			Done bool `json:"done"`
+		} `json:"steps"`
+	}
+	got, _, err := llm.DoJSON[result](context.Background(), NewPredictableService(), &llm.Request{
+		Messages:       []llm.Message{llm.UserStringMessage("hello")},
+		ResponseSchema: schema,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != "bug" || got.Count != 2 || len(got.Steps) != 2 {
+		t.Errorf("result = %+v", got)
+	}
+}
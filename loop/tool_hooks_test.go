@@ -0,0 +1,89 @@
+package loop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"shelley.exe.dev/llm"
+)
+
+// runHookedTurn runs one tool round of the "noop" tool through the given
+// hooks and returns the tool result the LLM received.
+func runHookedTurn(t *testing.T, tool *llm.Tool, cfg Config) llm.Content {
+	t.Helper()
+	svc := &fillingLLMService{}
+	cfg.LLM = svc
+	cfg.Tools = []*llm.Tool{tool}
+	cfg.RecordMessage = func(context.Context, llm.Message, llm.Usage, []llm.PurposedUsage) error { return nil }
+	l := NewLoop(cfg)
+	l.QueueUserMessage(llm.UserStringMessage("go"))
+	if err := l.ProcessOneTurn(context.Background()); err != nil {
+		t.Fatalf("ProcessOneTurn: %v", err)
+	}
+	if len(svc.sent) != 2 {
+		t.Fatalf("got %d requests, want 2", len(svc.sent))
+	}
+	msgs := svc.sent[1]
+	return msgs[len(msgs)-1].Content[0]
+}
+
+func TestPreToolUseRewritesInput(t *testing.T) {
+	var ran json.RawMessage
+	tool := noopTool()
+	tool.Run = func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+		ran = input
+		return llm.ToolOut{LLMContent: llm.TextContent("ok")}
+	}
+	runHookedTurn(t, tool, Config{
+		PreToolUse: func(ctx context.Context, call llm.Content) (json.RawMessage, error) {
+			if call.ToolName != "noop" || llm.ToolUseID(ctx) != "tu_1" {
+				t.Errorf("unexpected call %s %s", call.ToolName, llm.ToolUseID(ctx))
+			}
+			return json.RawMessage(`{"rewritten":true}`), nil
+		},
+	})
+	if string(ran) != `{"rewritten":true}` {
+		t.Errorf("tool ran with %s", ran)
+	}
+}
+
+func TestPreToolUseDenies(t *testing.T) {
+	tool := noopTool()
+	tool.Run = func(ctx context.Context, input json.RawMessage) llm.ToolOut {
+		t.Error("denied tool ran")
+		return llm.ToolOut{}
+	}
+	result := runHookedTurn(t, tool, Config{
+		PreToolUse: func(ctx context.Context, call llm.Content) (json.RawMessage, error) {
+			return nil, errors.New("not today")
+		},
+	})
+	if !result.ToolError || result.ToolResult[0].Text != "not today" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestPostToolUseReplacesResult(t *testing.T) {
+	result := runHookedTurn(t, noopTool(), Config{
+		PostToolUse: func(ctx context.Context, call llm.Content, result []llm.Content, isError bool) ([]llm.Content, error) {
+			if isError || result[0].Text != "ok" {
+				t.Errorf("hook saw %+v, error %v", result, isError)
+			}
+			return append(result, llm.Content{Type: llm.ContentTypeText, Text: "checked"}), nil
+		},
+	})
+	if result.ToolError || len(result.ToolResult) != 2 || result.ToolResult[1].Text != "checked" {
+		t.Errorf("result = %+v", result)
+	}
+
+	result = runHookedTurn(t, noopTool(), Config{
+		PostToolUse: func(ctx context.Context, call llm.Content, result []llm.Content, isError bool) ([]llm.Content, error) {
+			return nil, errors.New("hook broke")
+		},
+	})
+	if !result.ToolError || result.ToolResult[0].Text != "hook broke" {
+		t.Errorf("result after failed hook = %+v", result)
+	}
+}
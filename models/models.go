@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,6 +31,7 @@ const (
 	ProviderFireworks Provider = "fireworks"
 	ProviderGemini    Provider = "gemini"
 	ProviderXAI       Provider = "xai"
+	ProviderOllama    Provider = "ollama"
 	ProviderBuiltIn   Provider = "builtin"
 )
 
@@ -57,6 +60,7 @@ const (
 	APITypeOpenAIResponses   APIType = "openai-responses"
 	APITypeOpenAIChat        APIType = "openai-chat-completions"
 	APITypeGemini            APIType = "gemini"
+	APITypeOllama            APIType = "ollama"
 	APITypeBuiltIn           APIType = "builtin"
 )
 
@@ -464,6 +468,9 @@ func (l *loggingService) Do(ctx context.Context, request *llm.Request) (*llm.Res
 	start := time.Now()
 	ctx = llmhttp.WithModelID(ctx, l.modelID)
 	ctx = llmhttp.WithProvider(ctx, string(l.provider))
+	if request.OnQueue != nil {
+		ctx = llmhttp.WithQueueNotifier(ctx, request.OnQueue)
+	}
 	response, err := l.service.Do(ctx, request)
 	durationSeconds := time.Since(start).Seconds()
 
@@ -668,10 +675,22 @@ func (m *Manager) RefreshBuiltModels(built []Built) error {
 }
 
 // GetService returns the LLM service for modelID, wrapped with logging.
+// Where the predictable model is available, "predictable:<path>" is a fresh
+// predictable service playing the scenario file at path.
 func (m *Manager) GetService(modelID string) (llm.Service, error) {
 	m.mu.RLock()
 	entry, ok := m.services[modelID]
 	m.mu.RUnlock()
+	if path, isScenario := strings.CutPrefix(modelID, loop.PredictableScenarioPrefix); isScenario && !ok {
+		if entry, ok = m.scenarioEntry(modelID, path); !ok {
+			return nil, fmt.Errorf("unsupported model: %s (the predictable model is not available)", modelID)
+		}
+		svc, err := loop.NewPredictableScenarioService(path)
+		if err != nil {
+			return nil, err
+		}
+		entry.service = svc
+	}
 	if !ok {
 		return nil, fmt.Errorf("unsupported model: %s", modelID)
 	}
@@ -698,9 +717,26 @@ func (m *Manager) HasModel(modelID string) bool {
 	m.mu.RLock()
 	_, ok := m.services[modelID]
 	m.mu.RUnlock()
+	if path, isScenario := strings.CutPrefix(modelID, loop.PredictableScenarioPrefix); isScenario && !ok {
+		_, ok = m.scenarioEntry(modelID, path)
+	}
 	return ok
 }
 
+// scenarioEntry describes the scenario model modelID, if the predictable
+// model it builds on is available.
+func (m *Manager) scenarioEntry(modelID, path string) (serviceEntry, bool) {
+	m.mu.RLock()
+	entry, ok := m.services["predictable"]
+	m.mu.RUnlock()
+	if !ok {
+		return serviceEntry{}, false
+	}
+	entry.modelID = modelID
+	entry.displayName = "predictable (" + filepath.Base(path) + ")"
+	return entry, true
+}
+
 // ModelInfo contains display name, tags, source, base URL, and API type for a model.
 type ModelInfo struct {
 	DisplayName string
@@ -714,6 +750,9 @@ func (m *Manager) GetModelInfo(modelID string) *ModelInfo {
 	m.mu.RLock()
 	entry, ok := m.services[modelID]
 	m.mu.RUnlock()
+	if path, isScenario := strings.CutPrefix(modelID, loop.PredictableScenarioPrefix); isScenario && !ok {
+		entry, ok = m.scenarioEntry(modelID, path)
+	}
 	if !ok {
 		return nil
 	}
@@ -832,6 +871,17 @@ func (m *Manager) createServiceFromModel(model *generated.Model) llm.Service {
 			ThinkingLevel:   llm.ThinkingLevelMedium,
 			SupportsImages_: supportsImages,
 		}
+	case ProviderTypeBedrock, ProviderTypeVertex:
+		svc, err := CloudAnthropicService(model.ProviderType, model.Endpoint, model.ApiKey, model.ModelName)
+		if err != nil {
+			if m.logger != nil {
+				m.logger.Error("Invalid cloud platform model", "model_id", model.ModelID, "error", err)
+			}
+			return nil
+		}
+		svc.HTTPC = m.httpc
+		svc.SupportsImages_ = supportsImages
+		service = svc
 	case "openai":
 		service = &oai.Service{
 			APIKey:   model.ApiKey,
@@ -889,6 +939,48 @@ func (m *Manager) createServiceFromModel(model *generated.Model) llm.Service {
 	return wrapReasoningService(service, model)
 }
 
+// Custom model provider types for Anthropic models on cloud platforms.
+const (
+	ProviderTypeBedrock = "anthropic-bedrock"
+	ProviderTypeVertex  = "anthropic-vertex"
+)
+
+// CloudAnthropicService builds the service of a ProviderTypeBedrock or
+// ProviderTypeVertex custom model.
+//
+// For Bedrock, endpoint is the bedrock-runtime URL of a region (see
+// ant.BedrockURL), apiKey is "ACCESS_KEY_ID:SECRET_ACCESS_KEY" with an
+// optional ":SESSION_TOKEN", and modelName is a Bedrock model or inference
+// profile ID. For Vertex, endpoint is ant.VertexURL of a project and
+// region, apiKey is the JSON of a service-account key file, and modelName
+// is a Vertex model ID.
+func CloudAnthropicService(providerType, endpoint, apiKey, modelName string) (*ant.Service, error) {
+	svc := &ant.Service{ThinkingLevel: llm.ThinkingLevelMedium}
+	switch providerType {
+	case ProviderTypeBedrock:
+		region := ant.BedrockRegion(endpoint)
+		if region == "" {
+			return nil, fmt.Errorf("endpoint %q is not a bedrock-runtime URL", endpoint)
+		}
+		creds, err := ant.ParseAWSCredentials(apiKey)
+		if err != nil {
+			return nil, err
+		}
+		svc.Model = ant.ModelFromBedrock(modelName)
+		svc.Transport = &ant.Bedrock{URL: endpoint, Region: region, Model: modelName, Credentials: creds}
+	case ProviderTypeVertex:
+		account, err := ant.ParseGoogleServiceAccount([]byte(apiKey))
+		if err != nil {
+			return nil, err
+		}
+		svc.Model = ant.ModelFromVertex(modelName)
+		svc.Transport = &ant.Vertex{URL: endpoint, Model: modelName, Account: account}
+	default:
+		return nil, fmt.Errorf("provider type %q is not a cloud platform", providerType)
+	}
+	return svc, nil
+}
+
 // ResolveSupportsImages turns a stored image_support value ("auto"|"yes"|"no")
 // into a SupportsImages bool. "auto" is resolved from the model's endpoint URL
 // and name; unknown models default to allowing images.
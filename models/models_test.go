@@ -4,6 +4,8 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
@@ -13,6 +15,7 @@ import (
 	"shelley.exe.dev/db"
 	"shelley.exe.dev/db/generated"
 	"shelley.exe.dev/llm"
+	"shelley.exe.dev/llm/ant"
 	"shelley.exe.dev/llm/llmhttp"
 	"shelley.exe.dev/loop"
 )
@@ -322,6 +325,43 @@ func TestManagerHasModel(t *testing.T) {
 	}
 }
 
+func TestManagerScenarioModels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.yaml")
+	if err := os.WriteFile(path, []byte("steps:\n  - respond: {text: scripted}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	id := "predictable:" + path
+	mgr, err := NewManager(&Config{Models: []Built{predictableBuilt()}})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if !mgr.HasModel(id) {
+		t.Errorf("HasModel(%s) should return true", id)
+	}
+	if info := mgr.GetModelInfo(id); info == nil || info.DisplayName != "predictable (hello.yaml)" {
+		t.Errorf("GetModelInfo(%s) = %+v", id, info)
+	}
+	svc, err := mgr.GetService(id)
+	if err != nil {
+		t.Fatalf("GetService(%s): %v", id, err)
+	}
+	resp, err := svc.Do(context.Background(), &llm.Request{Messages: []llm.Message{llm.UserStringMessage("hi")}})
+	if err != nil || resp.Content[0].Text != "scripted" {
+		t.Errorf("scenario answer = %v, %v", resp, err)
+	}
+	if _, err := mgr.GetService("predictable:" + filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("GetService with a missing scenario should have failed")
+	}
+
+	empty, err := NewManager(&Config{})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if empty.HasModel(id) {
+		t.Error("scenario models need the predictable model")
+	}
+}
+
 func TestModelBuildSignature(t *testing.T) {
 	// Each catalog model's Build must produce a non-nil llm.Service when
 	// given any URL/key and an http.Client.
@@ -552,3 +592,25 @@ func TestReasoningServiceMapsServiceDefault(t *testing.T) {
 type defaultThinkingService struct{ captureThinkingService }
 
 func (s *defaultThinkingService) DefaultReasoningLevel() string { return "medium" }
+
+func TestCloudAnthropicService(t *testing.T) {
+	svc, err := CloudAnthropicService(ProviderTypeBedrock, "https://bedrock-runtime.eu-central-1.amazonaws.com", "AKID:secret", "eu.anthropic.claude-sonnet-4-5-20250929-v1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bedrock, ok := svc.Transport.(*ant.Bedrock)
+	if !ok || svc.Model != ant.Claude45Sonnet || bedrock.Region != "eu-central-1" || bedrock.Credentials.SecretAccessKey != "secret" {
+		t.Errorf("bedrock service = %+v, transport %+v", svc, svc.Transport)
+	}
+
+	for _, tc := range []struct{ providerType, endpoint, apiKey string }{
+		{ProviderTypeBedrock, "https://example.com", "AKID:secret"},
+		{ProviderTypeBedrock, "https://bedrock-runtime.us-east-1.amazonaws.com", "sk-ant-123"},
+		{ProviderTypeVertex, ant.VertexURL("p", "us-east5"), "sk-ant-123"},
+		{"anthropic", "https://api.anthropic.com/v1/messages", "sk-ant-123"},
+	} {
+		if _, err := CloudAnthropicService(tc.providerType, tc.endpoint, tc.apiKey, "claude-sonnet-4-6"); err == nil {
+			t.Errorf("CloudAnthropicService(%q, %q, %q) succeeded", tc.providerType, tc.endpoint, tc.apiKey)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package modelsources
+
+import (
+	"cmp"
+	"log/slog"
+	"net/http"
+
+	"shelley.exe.dev/llm/ant"
+	"shelley.exe.dev/models"
+)
+
+// BedrockConfig is the "bedrock" section of shelley.json: Claude on Amazon
+// Bedrock. Requests are signed with the credentials in the standard AWS
+// environment variables.
+type BedrockConfig struct {
+	// Region is the AWS region, e.g. "us-east-1".
+	Region string `json:"region"`
+	// URL overrides the bedrock-runtime endpoint, e.g. for a VPC endpoint.
+	URL string `json:"url"`
+	// InferenceProfile is the cross-region inference profile geography
+	// ("us", "eu", "global", ...) put in front of derived model IDs.
+	// Newer models are only offered through inference profiles.
+	InferenceProfile string `json:"inference_profile"`
+	// Models maps Shelley model IDs to Bedrock model IDs. When set, only
+	// these models are served through Bedrock and an empty Bedrock ID is
+	// derived; otherwise every Anthropic model is, under derived IDs.
+	Models map[string]string `json:"models"`
+}
+
+// VertexConfig is the "vertex" section of shelley.json: Claude on Google
+// Cloud Vertex AI, authenticated as a service account.
+type VertexConfig struct {
+	// Project is the Google Cloud project; empty means the service
+	// account's own project.
+	Project string `json:"project"`
+	// Region is the Vertex AI region, e.g. "us-east5", or "global".
+	Region string `json:"region"`
+	// CredentialsFile is the service-account key file; empty means
+	// $GOOGLE_APPLICATION_CREDENTIALS.
+	CredentialsFile string `json:"credentials_file"`
+	// Models maps Shelley model IDs to Vertex model IDs, like
+	// BedrockConfig.Models.
+	Models map[string]string `json:"models"`
+}
+
+// cloudPlatform serves the catalog's Anthropic models through a cloud
+// platform's ant.Transport instead of the Anthropic API.
+type cloudPlatform struct {
+	baseURL   string
+	models    map[string]string
+	modelID   func(apiModelName string) string
+	transport func(modelID string) ant.Transport
+}
+
+// Bedrock returns a Source serving Anthropic models from Amazon Bedrock.
+func Bedrock(config BedrockConfig, creds ant.AWSCredentials) Source {
+	url := cmp.Or(config.URL, ant.BedrockURL(config.Region))
+	region := cmp.Or(config.Region, ant.BedrockRegion(url))
+	return Source{
+		label: "bedrock " + region,
+		cloud: &cloudPlatform{
+			baseURL: url,
+			models:  config.Models,
+			modelID: func(name string) string {
+				id := ant.BedrockModelID(name)
+				if config.InferenceProfile != "" {
+					id = config.InferenceProfile + "." + id
+				}
+				return id
+			},
+			transport: func(id string) ant.Transport {
+				return &ant.Bedrock{URL: url, Region: region, Model: id, Credentials: creds}
+			},
+		},
+	}
+}
+
+// Vertex returns a Source serving Anthropic models from Vertex AI as the
+// given service account. All its models share the account's access token.
+func Vertex(config VertexConfig, account *ant.GoogleServiceAccount) Source {
+	project := cmp.Or(config.Project, account.ProjectID)
+	url := ant.VertexURL(project, config.Region)
+	return Source{
+		label: "vertex " + project + "/" + config.Region,
+		cloud: &cloudPlatform{
+			baseURL: url,
+			models:  config.Models,
+			modelID: ant.VertexModelID,
+			transport: func(id string) ant.Transport {
+				return &ant.Vertex{URL: url, Model: id, Account: account}
+			},
+		},
+	}
+}
+
+func (p *cloudPlatform) build(catalog []models.Model, src Source, httpc *http.Client, seen map[string]bool, logger *slog.Logger) []models.Built {
+	var out []models.Built
+	for _, m := range catalog {
+		if m.Provider != models.ProviderAnthropic || m.APIType != models.APITypeAnthropicMessages {
+			continue
+		}
+		platformID, listed := p.models[m.ID]
+		if len(p.models) > 0 && !listed {
+			continue
+		}
+		id := m.ID + src.idSuffix
+		if seen[id] {
+			continue
+		}
+		svc, ok := m.Build("", "", httpc).(*ant.Service)
+		if !ok {
+			continue
+		}
+		seen[id] = true
+		svc.Transport = p.transport(cmp.Or(platformID, p.modelID(m.APIModelName)))
+		out = append(out, models.Built{
+			ID:          id,
+			DisplayName: id,
+			Provider:    m.Provider,
+			Tags:        m.Tags,
+			Source:      src.label,
+			Service:     svc,
+			APIType:     m.APIType,
+			BaseURL:     p.baseURL,
+		})
+		logger.Debug("Materialized cloud platform model", "id", id, "source", src.label)
+	}
+	for id := range p.models {
+		if !seen[id+src.idSuffix] {
+			logger.Warn("Model is not an Anthropic model in Shelley's catalog; ignoring", "id", id, "source", src.label)
+		}
+	}
+	return out
+}
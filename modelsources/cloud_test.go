@@ -0,0 +1,77 @@
+package modelsources
+
+import (
+	"net/http"
+	"testing"
+
+	"shelley.exe.dev/llm/ant"
+	"shelley.exe.dev/models"
+)
+
+func TestBedrockSource(t *testing.T) {
+	creds := ant.AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	config := BedrockConfig{Region: "us-west-2", InferenceProfile: "us"}
+	bs := Build(models.All(), []Source{Bedrock(config, creds), Predictable()}, &http.Client{}, nil)
+
+	for _, m := range models.All() {
+		if m.Provider != models.ProviderAnthropic {
+			continue
+		}
+		b := findBuilt(bs, m.ID)
+		if b == nil {
+			t.Errorf("%s not built", m.ID)
+			continue
+		}
+		svc := b.Service.(*ant.Service)
+		bedrock, ok := svc.Transport.(*ant.Bedrock)
+		if !ok {
+			t.Fatalf("%s transport = %T", m.ID, svc.Transport)
+		}
+		if svc.Model != m.APIModelName || bedrock.Model != "us."+ant.BedrockModelID(m.APIModelName) || bedrock.Region != "us-west-2" || bedrock.Credentials != creds {
+			t.Errorf("%s: model %q, bedrock %+v", m.ID, svc.Model, bedrock)
+		}
+		if b.Source != "bedrock us-west-2" || b.BaseURL != "https://bedrock-runtime.us-west-2.amazonaws.com" {
+			t.Errorf("%s = %+v", m.ID, b)
+		}
+	}
+	if findBuilt(bs, "gpt-5.5") != nil {
+		t.Error("Bedrock served an OpenAI model")
+	}
+}
+
+func TestVertexSourceModels(t *testing.T) {
+	var sonnet, opus models.Model
+	for _, m := range models.All() {
+		switch m.APIModelName {
+		case ant.Claude45Sonnet:
+			sonnet = m
+		case ant.Claude46Opus:
+			opus = m
+		}
+	}
+	if sonnet.ID == "" || opus.ID == "" {
+		t.Skip("catalog lacks the models this test uses")
+	}
+	account := &ant.GoogleServiceAccount{ProjectID: "sa-project"}
+	config := VertexConfig{Region: "global", Models: map[string]string{sonnet.ID: "", opus.ID: "claude-opus-4-6@pinned"}}
+	bs := Build(models.All(), []Source{Vertex(config, account)}, &http.Client{}, nil)
+	if len(bs) != 2 {
+		t.Fatalf("built %d models, want only the 2 listed", len(bs))
+	}
+	for _, tc := range []struct{ id, vertexModel string }{
+		{sonnet.ID, "claude-sonnet-4-5@20250929"},
+		{opus.ID, "claude-opus-4-6@pinned"},
+	} {
+		b := findBuilt(bs, tc.id)
+		if b == nil {
+			t.Fatalf("%s not built", tc.id)
+		}
+		vertex := b.Service.(*ant.Service).Transport.(*ant.Vertex)
+		if vertex.Model != tc.vertexModel || vertex.Account != account || vertex.URL != ant.VertexURL("sa-project", "global") {
+			t.Errorf("%s: vertex %+v", tc.id, vertex)
+		}
+		if b.Source != "vertex sa-project/global" {
+			t.Errorf("%s source = %q", tc.id, b.Source)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 // Package modelsources composes built-in Shelley models from credential
 // origins (exe.dev LLM integrations, the exe.dev gateway, provider env
-// vars, and the predictable test service) and materializes them into a
-// flat []models.Built that the server can register directly.
+// vars, Amazon Bedrock, Google Vertex AI, a local Ollama server, and the
+// predictable test service) and
+// materializes them into a flat []models.Built that the server can
+// register directly.
 package modelsources
 
 import (
@@ -58,6 +60,14 @@ type Source struct {
 	// integration is set only for exe.dev LLM integrations, whose
 	// models.json catalog is authoritative instead of Shelley's catalog.
 	integration *LLMIntegrationConfig
+
+	// ollama is set only for Ollama sources, which serve the models
+	// installed on the host rather than catalog ones.
+	ollama *OllamaHost
+
+	// cloud is set only for Bedrock and Vertex sources, which serve the
+	// catalog's Anthropic models through a cloud platform.
+	cloud *cloudPlatform
 }
 
 func (s *Source) labelFor(p models.Provider) string {
@@ -193,6 +203,14 @@ func Build(catalog []models.Model, sources []Source, httpc *http.Client, logger
 			}
 			continue
 		}
+		if src.ollama != nil {
+			out = append(out, src.ollama.build(src, httpc, seen, logger)...)
+			continue
+		}
+		if src.cloud != nil {
+			out = append(out, src.cloud.build(catalog, src, httpc, seen, logger)...)
+			continue
+		}
 		for _, m := range catalog {
 			conn := src.providers[m.Provider]
 			if conn == nil {
@@ -0,0 +1,192 @@
+package modelsources
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"shelley.exe.dev/llm/ollama"
+	"shelley.exe.dev/models"
+)
+
+// ollamaDiscoveryTimeout bounds each model listing or description during
+// Ollama discovery. Short because the server is local.
+const ollamaDiscoveryTimeout = 10 * time.Second
+
+// ollamaPullTimeout bounds each model download by PullOllama.
+const ollamaPullTimeout = time.Hour
+
+// OllamaConfig is the "ollama" section of shelley.json.
+type OllamaConfig struct {
+	// URL is the Ollama server; empty means ollama.DefaultURL.
+	URL string `json:"url"`
+	// Pull lists models to download at startup if they are not installed.
+	Pull []string `json:"pull"`
+	// KeepAlive is how long Ollama keeps a model loaded after a request.
+	KeepAlive string `json:"keep_alive"`
+	// NumCtx caps the context window models are run with, to save memory.
+	// Zero runs each model with its full context length.
+	NumCtx int `json:"num_ctx"`
+}
+
+// OllamaHost is an Ollama server and the usable models installed on it.
+type OllamaHost struct {
+	Config OllamaConfig
+	Models []OllamaModel
+}
+
+// OllamaModel is one installed model and what /api/show says about it.
+type OllamaModel struct {
+	Name string
+	Info ollama.ModelInfo
+}
+
+// Ollama returns a Source for the models discovered on an Ollama host.
+// Their IDs are "ollama/" and the Ollama model name, e.g. "ollama/qwen3:8b".
+func Ollama(host *OllamaHost) Source {
+	return Source{label: "ollama " + host.url(), ollama: host}
+}
+
+func (h *OllamaHost) url() string {
+	if h.Config.URL != "" {
+		return strings.TrimSuffix(h.Config.URL, "/")
+	}
+	return ollama.DefaultURL
+}
+
+// service builds the service for one of the host's models.
+func (h *OllamaHost) service(m OllamaModel, httpc *http.Client) *ollama.Service {
+	svc := &ollama.Service{
+		HTTPC:            httpc,
+		URL:              h.url(),
+		Model:            m.Name,
+		ContextLength:    m.Info.ContextLength,
+		KeepAlive:        h.Config.KeepAlive,
+		SupportsImages_:  m.Info.Has("vision"),
+		SupportsThinking: m.Info.Has("thinking"),
+	}
+	if h.Config.NumCtx > 0 && h.Config.NumCtx < svc.TokenContextWindow() {
+		svc.NumCtx = h.Config.NumCtx
+	}
+	return svc
+}
+
+func (h *OllamaHost) build(src Source, httpc *http.Client, seen map[string]bool, logger *slog.Logger) []models.Built {
+	var out []models.Built
+	for _, m := range h.Models {
+		id := "ollama/" + m.Name + src.idSuffix
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, models.Built{
+			ID:          id,
+			DisplayName: id,
+			Provider:    models.ProviderOllama,
+			Source:      src.label,
+			Service:     h.service(m, httpc),
+			APIType:     models.APITypeOllama,
+			BaseURL:     h.url(),
+		})
+		logger.Debug("Materialized Ollama model", "id", id, "source", src.label)
+	}
+	return out
+}
+
+// DiscoverOllama lists the models installed on the Ollama server and
+// describes each. Models Ollama says cannot call tools are skipped: Shelley
+// cannot work without them. It returns nil if the server cannot be reached.
+// It does not download anything; see PullOllama.
+func DiscoverOllama(ctx context.Context, config OllamaConfig, httpc *http.Client, logger *slog.Logger) *OllamaHost {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	host := &OllamaHost{Config: config}
+	client := &ollama.Client{HTTPC: httpc, URL: host.url()}
+
+	installed, ok := listOllama(ctx, client, logger)
+	if !ok {
+		return nil
+	}
+
+	for _, m := range installed {
+		showCtx, cancel := context.WithTimeout(ctx, ollamaDiscoveryTimeout)
+		info, err := client.Show(showCtx, m.Name)
+		cancel()
+		if err != nil {
+			logger.Warn("Ollama discovery: describing model failed; skipping", "model", m.Name, "error", err)
+			continue
+		}
+		// Servers too old to report capabilities get the benefit of the doubt.
+		if len(info.Capabilities) > 0 && !info.Has("tools") {
+			logger.Debug("Ollama discovery: model cannot call tools; skipping", "model", m.Name)
+			continue
+		}
+		host.Models = append(host.Models, OllamaModel{Name: m.Name, Info: *info})
+	}
+	logger.Info("Discovered Ollama models", "url", host.url(), "models", len(host.Models))
+	return host
+}
+
+// PullOllama downloads the configured models that are not installed yet,
+// each within ollamaPullTimeout, and reports whether any was pulled, in
+// which case the models should be discovered again. Downloads can take a
+// long time, so callers run it in the background.
+func PullOllama(ctx context.Context, config OllamaConfig, httpc *http.Client, logger *slog.Logger) bool {
+	if len(config.Pull) == 0 {
+		return false
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	host := &OllamaHost{Config: config}
+	client := &ollama.Client{HTTPC: httpc, URL: host.url()}
+	installed, ok := listOllama(ctx, client, logger)
+	if !ok {
+		return false
+	}
+	pulled := false
+	for _, name := range config.Pull {
+		if slices.ContainsFunc(installed, func(m ollama.ListedModel) bool { return sameOllamaModel(m.Name, name) }) {
+			continue
+		}
+		logger.Info("Pulling Ollama model", "model", name, "url", host.url())
+		pullCtx, cancel := context.WithTimeout(ctx, ollamaPullTimeout)
+		err := client.Pull(pullCtx, name)
+		cancel()
+		if err != nil {
+			logger.Warn("Ollama pull failed", "model", name, "error", err)
+			continue
+		}
+		logger.Info("Pulled Ollama model", "model", name)
+		pulled = true
+	}
+	return pulled
+}
+
+// listOllama lists the models installed on the server, logging a failure.
+func listOllama(ctx context.Context, client *ollama.Client, logger *slog.Logger) ([]ollama.ListedModel, bool) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaDiscoveryTimeout)
+	defer cancel()
+	installed, err := client.List(ctx)
+	if err != nil {
+		logger.Warn("Ollama discovery: listing models failed", "url", client.URL, "error", err)
+		return nil, false
+	}
+	return installed, true
+}
+
+// sameOllamaModel reports whether two model names refer to the same model,
+// "qwen3" being short for "qwen3:latest".
+func sameOllamaModel(a, b string) bool {
+	withTag := func(name string) string {
+		if strings.Contains(name, ":") {
+			return name
+		}
+		return name + ":latest"
+	}
+	return withTag(a) == withTag(b)
+}
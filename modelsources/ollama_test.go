@@ -0,0 +1,122 @@
+package modelsources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"shelley.exe.dev/llm/ollama"
+	"shelley.exe.dev/models"
+)
+
+// fakeOllamaServer has qwen3 (tools, thinking), llava (vision, tools) and
+// an embedding model installed; pulling adds gemma3.
+type fakeOllamaServer struct {
+	mu     sync.Mutex
+	pulled []string
+}
+
+func (f *fakeOllamaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct{ Model string }
+	if r.Method == "POST" {
+		json.NewDecoder(r.Body).Decode(&req)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/api/tags":
+		list := `{"name":"qwen3:8b"},{"name":"llava:latest"},{"name":"nomic-embed-text:latest"}`
+		if len(f.pulled) > 0 {
+			list += `,{"name":"gemma3:4b"}`
+		}
+		fmt.Fprintf(w, `{"models":[%s]}`, list)
+	case "/api/show":
+		switch req.Model {
+		case "qwen3:8b":
+			fmt.Fprint(w, `{"model_info":{"general.architecture":"qwen3","qwen3.context_length":40960},"capabilities":["completion","tools","thinking"]}`)
+		case "llava:latest":
+			fmt.Fprint(w, `{"model_info":{"general.architecture":"llama","llama.context_length":4096},"capabilities":["completion","tools","vision"]}`)
+		case "gemma3:4b":
+			fmt.Fprint(w, `{"model_info":{"general.architecture":"gemma3","gemma3.context_length":131072},"capabilities":["completion","tools","vision"]}`)
+		default:
+			fmt.Fprint(w, `{"model_info":{"general.architecture":"nomic-bert","nomic-bert.context_length":2048},"capabilities":["embedding"]}`)
+		}
+	case "/api/pull":
+		f.pulled = append(f.pulled, req.Model)
+		fmt.Fprint(w, `{"status":"success"}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDiscoverOllama(t *testing.T) {
+	fake := &fakeOllamaServer{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	config := OllamaConfig{URL: srv.URL + "/", Pull: []string{"llava", "gemma3:4b"}, KeepAlive: "1h", NumCtx: 32768}
+	if host := DiscoverOllama(context.Background(), config, nil, nil); host == nil || len(fake.pulled) != 0 {
+		t.Fatalf("discovery should list without pulling: host %v, pulled %v", host, fake.pulled)
+	}
+	if !PullOllama(context.Background(), config, nil, nil) {
+		t.Fatal("PullOllama pulled nothing")
+	}
+	// llava is installed as llava:latest, so only gemma3 is pulled.
+	if len(fake.pulled) != 1 || fake.pulled[0] != "gemma3:4b" {
+		t.Errorf("pulled %v", fake.pulled)
+	}
+	if PullOllama(context.Background(), config, nil, nil) {
+		t.Error("a second pull found models missing")
+	}
+	host := DiscoverOllama(context.Background(), config, nil, nil)
+	if host == nil {
+		t.Fatal("DiscoverOllama found nothing")
+	}
+
+	bs := Build(models.All(), []Source{Ollama(host), Predictable()}, &http.Client{}, nil)
+	if findBuilt(bs, "ollama/nomic-embed-text:latest") != nil {
+		t.Error("an embedding model was registered")
+	}
+	for _, tc := range []struct {
+		id      string
+		window  int
+		images  bool
+		thinks  bool
+		wantCtx int
+	}{
+		{"ollama/qwen3:8b", 32768, false, true, 32768},
+		{"ollama/llava:latest", 4096, true, false, 0},
+		{"ollama/gemma3:4b", 32768, true, false, 32768},
+	} {
+		b := findBuilt(bs, tc.id)
+		if b == nil {
+			t.Errorf("%s not built; got %v", tc.id, bs)
+			continue
+		}
+		svc, ok := b.Service.(*ollama.Service)
+		if !ok {
+			t.Fatalf("%s service is %T", tc.id, b.Service)
+		}
+		if b.Provider != models.ProviderOllama || b.APIType != models.APITypeOllama || b.BaseURL != srv.URL || svc.KeepAlive != "1h" {
+			t.Errorf("%s = %+v", tc.id, b)
+		}
+		if svc.TokenContextWindow() != tc.window || svc.SupportsImages() != tc.images || svc.SupportsReasoning() != tc.thinks || svc.NumCtx != tc.wantCtx {
+			t.Errorf("%s: window %d, images %v, thinking %v, num_ctx %d", tc.id, svc.TokenContextWindow(), svc.SupportsImages(), svc.SupportsReasoning(), svc.NumCtx)
+		}
+	}
+	if findBuilt(bs, "predictable") == nil {
+		t.Error("predictable not built")
+	}
+}
+
+func TestDiscoverOllamaUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	if host := DiscoverOllama(context.Background(), OllamaConfig{URL: srv.URL}, nil, nil); host != nil {
+		t.Errorf("DiscoverOllama = %+v, want nil", host)
+	}
+}
@@ -0,0 +1,72 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// CatchUp is what a schedule does about firings missed while the server
+// was down.
+type CatchUp string
+
+const (
+	// CatchUpSkip drops missed firings.
+	CatchUpSkip CatchUp = "skip"
+	// CatchUpOnce runs one firing, the latest, however many were missed.
+	CatchUpOnce CatchUp = "once"
+	// CatchUpAll runs every missed firing, up to MaxCatchUpRuns of them.
+	CatchUpAll CatchUp = "all"
+)
+
+const (
+	// Grace is how late a firing may run and still count as on time.
+	Grace = 5 * time.Minute
+	// MaxCatchUpRuns caps how many firings CatchUpAll runs at once.
+	MaxCatchUpRuns = 10
+)
+
+// ParseCatchUp validates a catch-up policy; "" means CatchUpOnce.
+func ParseCatchUp(s string) (CatchUp, error) {
+	switch p := CatchUp(s); p {
+	case "":
+		return CatchUpOnce, nil
+	case CatchUpSkip, CatchUpOnce, CatchUpAll:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown catch-up policy %q; want skip, once or all", s)
+}
+
+// Due returns the firings to run at now of a schedule next due at next,
+// oldest first, and when the schedule is due after them. c is nil for a
+// one-shot schedule, which is never due again: following is zero. Cron
+// schedules match in the location of now.
+func Due(c *Cron, next, now time.Time, policy CatchUp) (fire []time.Time, following time.Time) {
+	if next.After(now) {
+		return nil, next
+	}
+	firings := []time.Time{next}
+	if c != nil {
+		for t := c.Next(next.In(now.Location())); !t.IsZero() && !t.After(now); t = c.Next(t) {
+			firings = append(firings, t)
+			if len(firings) > MaxCatchUpRuns {
+				firings = firings[1:]
+			}
+		}
+		following = c.Next(now)
+	}
+
+	last := firings[len(firings)-1]
+	switch {
+	case now.Sub(last) <= Grace:
+		// The latest firing is on time; catching up only concerns the others.
+		if policy == CatchUpAll {
+			return firings, following
+		}
+		return firings[len(firings)-1:], following
+	case policy == CatchUpSkip:
+		return nil, following
+	case policy == CatchUpOnce:
+		return firings[len(firings)-1:], following
+	}
+	return firings, following
+}
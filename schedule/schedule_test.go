@@ -0,0 +1,107 @@
+package schedule
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, expr string) *Cron {
+	t.Helper()
+	c, err := ParseCron(expr)
+	if err != nil {
+		t.Fatalf("ParseCron(%q): %v", expr, err)
+	}
+	return c
+}
+
+func TestCronNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	for _, tt := range []struct {
+		expr      string
+		from      time.Time
+		want      time.Time
+		wantLater time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 3, 4, 10, 7, 30, 0, time.UTC), time.Date(2026, 3, 4, 10, 15, 0, 0, time.UTC), time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, 3, 6, 9, 0, 0, 0, time.UTC), time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC), time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 12, 15, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 2 29 2 *", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 2, 30, 0, 0, time.UTC), time.Date(2032, 2, 29, 2, 30, 0, 0, time.UTC)},
+		// Restricted day of month and day of week: either matches.
+		{"0 0 1 * 7", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		// 02:30 does not exist on the day clocks spring forward.
+		{"30 2 * * *", time.Date(2026, 3, 7, 12, 0, 0, 0, ny), time.Date(2026, 3, 9, 2, 30, 0, 0, ny), time.Date(2026, 3, 10, 2, 30, 0, 0, ny)},
+		{"0 0 30 2 *", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}, time.Time{}},
+	} {
+		c := mustParse(t, tt.expr)
+		got := c.Next(tt.from)
+		if !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.expr, tt.from, got, tt.want)
+			continue
+		}
+		if got.IsZero() {
+			continue
+		}
+		if later := c.Next(got); !later.Equal(tt.wantLater) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.expr, got, later, tt.wantLater)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *", "* * * * funday"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestDue(t *testing.T) {
+	hourly := mustParse(t, "@hourly")
+	at := func(h, m int) time.Time { return time.Date(2026, 5, 1, h, m, 0, 0, time.UTC) }
+	times := func(hours ...int) []time.Time {
+		var out []time.Time
+		for _, h := range hours {
+			out = append(out, at(h, 0))
+		}
+		return out
+	}
+
+	for _, tt := range []struct {
+		name          string
+		c             *Cron
+		next, now     time.Time
+		policy        CatchUp
+		wantFire      []time.Time
+		wantFollowing time.Time
+	}{
+		{"not yet due", hourly, at(3, 0), at(2, 59), CatchUpOnce, nil, at(3, 0)},
+		{"on time", hourly, at(3, 0), at(3, 1), CatchUpSkip, times(3), at(4, 0)},
+		{"missed, skip", hourly, at(3, 0), at(5, 30), CatchUpSkip, nil, at(6, 0)},
+		{"missed, once", hourly, at(3, 0), at(5, 30), CatchUpOnce, times(5), at(6, 0)},
+		{"missed, all", hourly, at(3, 0), at(5, 30), CatchUpAll, times(3, 4, 5), at(6, 0)},
+		{"missed then on time, skip", hourly, at(3, 0), at(5, 2), CatchUpSkip, times(5), at(6, 0)},
+		{"missed then on time, all", hourly, at(3, 0), at(5, 2), CatchUpAll, times(3, 4, 5), at(6, 0)},
+		{"all is capped", hourly, at(0, 0), at(23, 30), CatchUpAll, times(14, 15, 16, 17, 18, 19, 20, 21, 22, 23), at(24, 0)},
+		{"one-shot on time", nil, at(3, 0), at(3, 4), CatchUpSkip, times(3), time.Time{}},
+		{"one-shot missed, skip", nil, at(3, 0), at(9, 0), CatchUpSkip, nil, time.Time{}},
+		{"one-shot missed, once", nil, at(3, 0), at(9, 0), CatchUpOnce, times(3), time.Time{}},
+	} {
+		fire, following := Due(tt.c, tt.next, tt.now, tt.policy)
+		if !slices.EqualFunc(fire, tt.wantFire, time.Time.Equal) || !following.Equal(tt.wantFollowing) {
+			t.Errorf("%s: Due = %v, %v; want %v, %v", tt.name, fire, following, tt.wantFire, tt.wantFollowing)
+		}
+	}
+}
+
+func TestParseCatchUp(t *testing.T) {
+	if p, err := ParseCatchUp(""); p != CatchUpOnce || err != nil {
+		t.Errorf(`ParseCatchUp("") = %q, %v`, p, err)
+	}
+	if _, err := ParseCatchUp("sometimes"); err == nil {
+		t.Error("ParseCatchUp accepted an unknown policy")
+	}
+}
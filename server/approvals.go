@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"shelley.exe.dev/claudetool/approval"
+	"shelley.exe.dev/db"
+)
+
+// errApprovalNotFound is returned when an approval answer names a request
+// that is not (or no longer) pending, e.g. because the turn was cancelled.
+var errApprovalNotFound = errors.New("approval request not found")
+
+// defaultApprovalTimeout is how long a tool call waits for an approval
+// answer when Server.ApprovalTimeout is unset.
+const defaultApprovalTimeout = 10 * time.Minute
+
+// pendingApproval is a tool call paused until the user answers.
+type pendingApproval struct {
+	req approval.Request
+	ch  chan approval.Response
+}
+
+// approvalGate implements approval.Gate for a conversation: it publishes the
+// request on the conversation stream and waits for ResolveApproval. A
+// request left unanswered for the manager's approvalTimeout is rejected, so
+// a client that never answers cannot hang the turn.
+type approvalGate struct {
+	cm *ConversationManager
+}
+
+func (g approvalGate) Ask(ctx context.Context, req approval.Request) (approval.Response, error) {
+	cm := g.cm
+	req.ID = "ap" + rand.Text()[:10]
+	p := &pendingApproval{req: req, ch: make(chan approval.Response, 1)}
+
+	cm.mu.Lock()
+	cm.pendingApprovals = append(cm.pendingApprovals, p)
+	cm.mu.Unlock()
+	cm.logger.Info("Waiting for tool call approval", "id", req.ID, "tool", req.Tool, "subjects", req.Subjects)
+	cm.broadcastStream(StreamResponse{ApprovalRequest: &req, ConversationState: cm.approvalState()})
+
+	defer func() {
+		cm.mu.Lock()
+		cm.pendingApprovals = slices.DeleteFunc(cm.pendingApprovals, func(q *pendingApproval) bool { return q == p })
+		cm.mu.Unlock()
+		cm.broadcastStream(StreamResponse{ConversationState: cm.approvalState()})
+	}()
+
+	timeout := cm.approvalTimeout
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-p.ch:
+		return resp, nil
+	case <-timer.C:
+		cm.logger.Warn("Tool call approval timed out", "id", req.ID, "tool", req.Tool, "timeout", timeout)
+		return approval.Response{Reason: fmt.Sprintf("no answer within %v", timeout)}, nil
+	case <-ctx.Done():
+		return approval.Response{}, ctx.Err()
+	}
+}
+
+// approvalState snapshots the conversation state, including pending
+// approvals, for broadcasting.
+func (cm *ConversationManager) approvalState() *ConversationState {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return &ConversationState{
+		ConversationID:   cm.conversationID,
+		Working:          cm.agentWorking,
+		Model:            cm.modelID,
+		PendingApprovals: cm.pendingApprovalRequestsLocked(),
+	}
+}
+
+// PendingApprovals returns the tool calls currently waiting for the user.
+func (cm *ConversationManager) PendingApprovals() []approval.Request {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.pendingApprovalRequestsLocked()
+}
+
+func (cm *ConversationManager) pendingApprovalRequestsLocked() []approval.Request {
+	var out []approval.Request
+	for _, p := range cm.pendingApprovals {
+		out = append(out, p.req)
+	}
+	return out
+}
+
+// ResolveApproval answers a pending approval request. An approval with
+// resp.Always set is persisted as allow rules in the conversation options
+// before the paused tool call resumes.
+func (cm *ConversationManager) ResolveApproval(ctx context.Context, id string, resp approval.Response) error {
+	cm.mu.Lock()
+	var p *pendingApproval
+	for _, q := range cm.pendingApprovals {
+		if q.req.ID == id {
+			p = q
+			break
+		}
+	}
+	cm.mu.Unlock()
+	if p == nil {
+		return errApprovalNotFound
+	}
+
+	if resp.Approved && resp.Always {
+		cm.mu.Lock()
+		opts := cm.conversationOptions
+		opts.ApprovalAllowRules = append(slices.Clone(opts.ApprovalAllowRules), storedApprovalRules(p.req.AllowRules())...)
+		cm.conversationOptions = opts
+		cm.mu.Unlock()
+		if _, err := cm.db.UpdateConversationOptions(ctx, cm.conversationID, opts); err != nil {
+			return fmt.Errorf("failed to persist approval: %w", err)
+		}
+	}
+
+	select {
+	case p.ch <- resp:
+	default:
+		// Already answered by a concurrent request.
+	}
+	return nil
+}
+
+// effectiveApprovalPolicy combines the conversation's approval settings with
+// the server-wide policy from base. It returns nil when neither configures
+// anything, which disables approval checks entirely.
+func (cm *ConversationManager) effectiveApprovalPolicy(base func() *approval.Policy) *approval.Policy {
+	cm.mu.Lock()
+	policy := approvalPolicy(cm.conversationOptions.ApprovalPolicy)
+	allow := approvalRules(cm.conversationOptions.ApprovalAllowRules)
+	cm.mu.Unlock()
+	if policy == nil && base != nil {
+		policy = base()
+	}
+	if policy == nil {
+		return nil
+	}
+	return policy.WithRules(allow...)
+}
+
+// approvalPolicy converts a conversation's stored approval policy. A nil
+// policy stays nil.
+func approvalPolicy(p *db.ApprovalPolicy) *approval.Policy {
+	if p == nil {
+		return nil
+	}
+	return &approval.Policy{Default: approval.Decision(p.Default), Rules: approvalRules(p.Rules)}
+}
+
+// approvalRules converts stored approval rules.
+func approvalRules(rules []db.ApprovalRule) []approval.Rule {
+	if rules == nil {
+		return nil
+	}
+	out := make([]approval.Rule, len(rules))
+	for i, r := range rules {
+		out[i] = approval.Rule{Tool: r.Tool, Command: r.Command, Path: r.Path, Decision: approval.Decision(r.Decision)}
+	}
+	return out
+}
+
+// storedApprovalRules converts approval rules to their stored form.
+func storedApprovalRules(rules []approval.Rule) []db.ApprovalRule {
+	if rules == nil {
+		return nil
+	}
+	out := make([]db.ApprovalRule, len(rules))
+	for i, r := range rules {
+		out[i] = db.ApprovalRule{Tool: r.Tool, Command: r.Command, Path: r.Path, Decision: string(r.Decision)}
+	}
+	return out
+}
+
+// handleApproveToolCall handles POST /api/conversation/<id>/approve, the
+// user's answer to an approval request published on the conversation stream.
+func (s *Server) handleApproveToolCall(w http.ResponseWriter, r *http.Request, conversationID string) {
+	var req struct {
+		RequestID string `json:"request_id"`
+		approval.Response
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.RequestID == "" {
+		http.Error(w, "request_id is required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	manager := s.activeConversations[conversationID]
+	s.mu.Unlock()
+	if manager == nil {
+		http.Error(w, "Approval request not found", http.StatusNotFound)
+		return
+	}
+	if err := manager.ResolveApproval(r.Context(), req.RequestID, req.Response); err != nil {
+		if errors.Is(err, errApprovalNotFound) {
+			http.Error(w, "Approval request not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Error("Failed to resolve approval", "conversationID", conversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/claudetool/approval"
+	"shelley.exe.dev/db"
+)
+
+// newApprovalHarness starts a conversation whose policy asks before running
+// touch, with cwd as its working directory.
+func newApprovalHarness(t *testing.T, cwd string) *TestHarness {
+	t.Helper()
+	h := NewTestHarness(t)
+	opts := db.ConversationOptions{ApprovalPolicy: &db.ApprovalPolicy{
+		Rules: []db.ApprovalRule{{Tool: "bash", Command: "touch", Decision: "ask"}},
+	}}
+	conv, err := h.db.CreateConversation(context.Background(), nil, true, &cwd, nil, opts)
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+	h.convID = conv.ConversationID
+	return h
+}
+
+// waitPendingApproval waits for the conversation to publish an approval request.
+func waitPendingApproval(t *testing.T, h *TestHarness) approval.Request {
+	t.Helper()
+	deadline := time.Now().Add(h.timeout)
+	for time.Now().Before(deadline) {
+		h.server.mu.Lock()
+		manager := h.server.activeConversations[h.convID]
+		h.server.mu.Unlock()
+		if manager != nil {
+			if pending := manager.PendingApprovals(); len(pending) > 0 {
+				return pending[0]
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for an approval request")
+	return approval.Request{}
+}
+
+func postApproval(h *TestHarness, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/conversation/"+h.convID+"/approve", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.server.handleApproveToolCall(w, req, h.convID)
+	return w
+}
+
+func TestApprovalAlwaysAllowPersists(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	h := newApprovalHarness(t, dir)
+	h.Chat("bash: touch approved.txt")
+
+	req := waitPendingApproval(t, h)
+	if req.Tool != "bash" || req.Command != "touch approved.txt" {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if len(req.Subjects) != 1 || req.Subjects[0] != "touch" {
+		t.Fatalf("subjects = %v, want [touch]", req.Subjects)
+	}
+	if req.ToolUseID == "" {
+		t.Error("request has no tool_use_id")
+	}
+
+	if w := postApproval(h, `{"request_id":"`+req.ID+`","approved":true,"always":true}`); w.Code != http.StatusOK {
+		t.Fatalf("approve: status %d: %s", w.Code, w.Body.String())
+	}
+	h.WaitToolResult()
+	if _, err := os.Stat(filepath.Join(dir, "approved.txt")); err != nil {
+		t.Fatalf("approved command did not run: %v", err)
+	}
+
+	conv, err := h.db.GetConversationByID(context.Background(), h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := db.ParseConversationOptions(conv.ConversationOptions)
+	want := db.ApprovalRule{Tool: "bash", Command: "touch", Decision: "allow"}
+	if len(opts.ApprovalAllowRules) != 1 || opts.ApprovalAllowRules[0] != want {
+		t.Fatalf("allow rules = %+v, want [%+v]", opts.ApprovalAllowRules, want)
+	}
+}
+
+func TestApprovalRejectReportsReason(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	h := newApprovalHarness(t, dir)
+	h.Chat("bash: touch rejected.txt")
+
+	req := waitPendingApproval(t, h)
+	if w := postApproval(h, `{"request_id":"`+req.ID+`","approved":false,"reason":"use a fixture"}`); w.Code != http.StatusOK {
+		t.Fatalf("approve: status %d: %s", w.Code, w.Body.String())
+	}
+	result := h.WaitToolResult()
+	if !strings.Contains(result, "rejected") || !strings.Contains(result, "use a fixture") {
+		t.Errorf("tool result = %q, want rejection with reason", result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rejected.txt")); err == nil {
+		t.Error("rejected command ran")
+	}
+}
+
+func TestApprovalTimesOut(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	h := NewTestHarness(t)
+	h.server.ApprovalTimeout = 50 * time.Millisecond
+	opts := db.ConversationOptions{ApprovalPolicy: &db.ApprovalPolicy{
+		Rules: []db.ApprovalRule{{Tool: "bash", Command: "touch", Decision: "ask"}},
+	}}
+	conv, err := h.db.CreateConversation(context.Background(), nil, true, &dir, nil, opts)
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+	h.convID = conv.ConversationID
+	h.Chat("bash: touch unanswered.txt")
+
+	result := h.WaitToolResult()
+	if !strings.Contains(result, "rejected") || !strings.Contains(result, "no answer within") {
+		t.Errorf("tool result = %q, want a rejection for the missing answer", result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unanswered.txt")); err == nil {
+		t.Error("unanswered command ran")
+	}
+}
+
+func TestApproveUnknownRequest(t *testing.T) {
+	t.Parallel()
+	h := newApprovalHarness(t, t.TempDir())
+	h.Chat("echo: hi")
+	h.WaitResponse()
+
+	if w := postApproval(h, `{"request_id":"apnope","approved":true}`); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+	if w := postApproval(h, `{"approved":true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing request_id: status = %d, want 400", w.Code)
+	}
+}
+
+func TestValidateApprovalPolicyOption(t *testing.T) {
+	opts := db.ConversationOptions{ApprovalPolicy: &db.ApprovalPolicy{Default: "maybe"}}
+	if msg := validateConversationOptions(opts); msg == "" {
+		t.Error("expected invalid default decision to be rejected")
+	}
+}
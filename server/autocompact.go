@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+	"shelley.exe.dev/llm"
+)
+
+// defaultAutoCompactThreshold is the share of the model's context window at
+// which a turn is compacted when neither the server nor the conversation
+// configures one. It leaves room for the next response and a round of tool
+// output before the window is actually exhausted.
+const defaultAutoCompactThreshold = 0.85
+
+// autoCompactSettings resolves a conversation's compaction settings over the
+// server-wide ones and the built-in defaults. Enabled is always set.
+func (s *Server) autoCompactSettings(opts db.ConversationOptions) db.AutoCompactOptions {
+	base := s.AutoCompact
+	if s.piDistillKeepRecentTokens > 0 {
+		base.KeepRecentTokens = s.piDistillKeepRecentTokens
+	}
+	out := opts.AutoCompact.Over(base)
+	if out.Enabled == nil {
+		enabled := true
+		out.Enabled = &enabled
+	}
+	if out.Threshold == 0 {
+		out.Threshold = defaultAutoCompactThreshold
+	}
+	if out.KeepRecentTokens == 0 {
+		out.KeepRecentTokens = defaultPiDistillSettings.keepRecentTokens
+	}
+	return out
+}
+
+// wireAutoCompact connects a new manager's loops to automatic compaction.
+func (s *Server) wireAutoCompact(manager *ConversationManager) {
+	manager.autoCompactSettings = s.autoCompactSettings
+	manager.autoCompact = func(ctx context.Context) ([]llm.Message, error) {
+		return s.autoCompact(ctx, manager)
+	}
+}
+
+// autoCompact compacts a conversation whose loop is mid-turn: it moves the
+// conversation to a new generation holding a summary of older history plus a
+// verbatim recent tail, exactly as a user-started compaction does, and
+// returns that generation's history so the loop can carry on with the turn.
+//
+// Unlike handleDistillNewGeneration it neither resets nor rehydrates the
+// loop — the loop is the caller — and on failure the generation is rolled
+// back without disturbing it.
+func (s *Server) autoCompact(ctx context.Context, cm *ConversationManager) ([]llm.Message, error) {
+	conversationID := cm.conversationID
+	logger := cm.logger.With("method", "auto-compact")
+
+	if !cm.BeginDistillingSetup() {
+		return nil, errors.New("a compaction is already in progress")
+	}
+	setupComplete := false
+	defer func() {
+		if !setupComplete {
+			cm.FinishDistillingSetup()
+		}
+		cm.SetDistilling(false)
+	}()
+
+	conv, err := s.db.GetConversationByID(ctx, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("load conversation: %w", err)
+	}
+	sourceGeneration := conv.CurrentGeneration
+	messages, err := s.db.ListMessages(ctx, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("list messages: %w", err)
+	}
+	modelID := cm.GetModel()
+	if modelID == "" && conv.Model != nil {
+		modelID = *conv.Model
+	}
+	settings := s.autoCompactSettings(db.ParseConversationOptions(conv.ConversationOptions))
+
+	if _, err := db.WithTxRes(s.db, ctx, func(q *generated.Queries) (generated.Conversation, error) {
+		return q.IncrementConversationGeneration(ctx, conversationID)
+	}); err != nil {
+		return nil, fmt.Errorf("increment generation: %w", err)
+	}
+
+	sourceSlug := "unknown"
+	if conv.Slug != nil {
+		sourceSlug = *conv.Slug
+	}
+	statusMsg, err := s.db.CreateMessage(ctx, db.CreateMessageParams{
+		ConversationID: conversationID,
+		Type:           db.MessageTypeAgent,
+		LLMData: llm.Message{
+			Role:    llm.MessageRoleAssistant,
+			Content: []llm.Content{{Type: llm.ContentTypeText, Text: "Context window nearly full; compacting conversation…"}},
+		},
+		UserData: map[string]string{
+			"distill_status": "in_progress",
+			"source_slug":    sourceSlug,
+			"new_generation": "true",
+			"distill_method": distillMethodCompact,
+			"auto":           "true",
+		},
+		ExcludedFromContext: true,
+	})
+	if err != nil {
+		s.rollbackCompactionFailure(ctx, logger, conversationID, "Automatic compaction failed during setup", sourceGeneration, true)
+		return nil, fmt.Errorf("create status message: %w", err)
+	}
+	go s.notifySubscribersNewMessage(context.WithoutCancel(ctx), conversationID, statusMsg)
+
+	// The new generation needs its own system prompt, as Hydrate would
+	// create for a user-started compaction. The loop keeps the one it has.
+	if err := cm.createGenerationSystemPrompt(ctx, conv); err != nil {
+		s.rollbackCompactionFailure(ctx, logger, conversationID, "Automatic compaction failed during setup", sourceGeneration, true)
+		return nil, err
+	}
+	setupComplete = true
+	cm.FinishDistillingSetup()
+
+	if _, err := s.performPiDistillation(ctx, conversationID, sourceSlug, modelID, "", sourceGeneration, messages, settings.KeepRecentTokens, true); err != nil {
+		return nil, err
+	}
+
+	var dbMessages []generated.Message
+	if err := s.db.Queries(ctx, func(q *generated.Queries) error {
+		var err error
+		dbMessages, err = q.ListMessagesForContext(ctx, conversationID)
+		return err
+	}); err != nil {
+		// The new generation is in place; only the in-memory copy is
+		// missing. The turn finishes on its full history and the next
+		// loop hydrates from the compacted one.
+		return nil, fmt.Errorf("reload compacted history: %w", err)
+	}
+	history, _ := cm.partitionMessages(dbMessages)
+	s.broadcastEstimatedContextSize(ctx, conversationID)
+	go s.notifySubscribers(context.WithoutCancel(ctx), conversationID)
+	logger.Info("automatic compaction complete", "source_generation", sourceGeneration, "history", len(history))
+	return history, nil
+}
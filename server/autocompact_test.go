@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"shelley.exe.dev/db"
+)
+
+func TestAutoCompactSettings(t *testing.T) {
+	s := &Server{}
+	got := s.autoCompactSettings(db.ConversationOptions{})
+	if !*got.Enabled || got.Threshold != defaultAutoCompactThreshold || got.KeepRecentTokens != defaultPiDistillSettings.keepRecentTokens {
+		t.Errorf("defaults = %+v", got)
+	}
+
+	off := false
+	s.AutoCompact = db.AutoCompactOptions{Enabled: &off, Threshold: 0.5}
+	got = s.autoCompactSettings(db.ConversationOptions{})
+	if *got.Enabled || got.Threshold != 0.5 {
+		t.Errorf("server settings not applied: %+v", got)
+	}
+
+	on := true
+	got = s.autoCompactSettings(db.ConversationOptions{AutoCompact: &db.AutoCompactOptions{Enabled: &on, KeepRecentTokens: 500}})
+	if !*got.Enabled || got.Threshold != 0.5 || got.KeepRecentTokens != 500 {
+		t.Errorf("conversation override not applied: %+v", got)
+	}
+
+	// The server's keep_recent_tokens override yields to the conversation's.
+	s.piDistillKeepRecentTokens = 1
+	if got = s.autoCompactSettings(db.ConversationOptions{AutoCompact: &db.AutoCompactOptions{KeepRecentTokens: 500}}); got.KeepRecentTokens != 500 {
+		t.Errorf("conversation keep_recent_tokens overwritten: %+v", got)
+	}
+	if got = s.autoCompactSettings(db.ConversationOptions{AutoCompact: &db.AutoCompactOptions{Threshold: 0.7}}); got.KeepRecentTokens != 1 || got.Threshold != 0.7 {
+		t.Errorf("server keep_recent_tokens not applied: %+v", got)
+	}
+}
+
+func TestValidateAutoCompactOption(t *testing.T) {
+	for _, opts := range []db.AutoCompactOptions{{Threshold: 1.5}, {Threshold: -0.1}, {KeepRecentTokens: -1}} {
+		if msg := validateConversationOptions(db.ConversationOptions{AutoCompact: &opts}); msg == "" {
+			t.Errorf("expected %+v to be rejected", opts)
+		}
+	}
+	if msg := validateConversationOptions(db.ConversationOptions{AutoCompact: &db.AutoCompactOptions{Threshold: 0.7}}); msg != "" {
+		t.Errorf("unexpected rejection: %s", msg)
+	}
+}
+
+// TestAutoCompactMidTurn fills the (tiny) compaction threshold with a tool
+// round and checks that the turn finishes in a new, compacted generation.
+func TestAutoCompactMidTurn(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	defer stopActiveConversationLoops(h.server)
+	ctx := context.Background()
+
+	cwd := t.TempDir()
+	opts := db.ConversationOptions{AutoCompact: &db.AutoCompactOptions{Threshold: 0.000001, KeepRecentTokens: 1}}
+	conv, err := h.db.CreateConversation(ctx, nil, true, &cwd, nil, opts)
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+	h.convID = conv.ConversationID
+
+	h.Chat("bash: echo hi")
+	h.WaitResponse()
+
+	after, err := h.db.GetConversationByID(ctx, h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.CurrentGeneration != conv.CurrentGeneration+1 {
+		t.Fatalf("generation = %d, want %d", after.CurrentGeneration, conv.CurrentGeneration+1)
+	}
+
+	msgs, err := h.db.ListMessages(ctx, h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sawAutoStatus, sawSummary, sawFinalAgent bool
+	for _, m := range msgs {
+		if m.Generation != after.CurrentGeneration {
+			continue
+		}
+		var ud map[string]string
+		if m.UserData != nil {
+			json.Unmarshal([]byte(*m.UserData), &ud)
+		}
+		switch {
+		case ud["distill_status"] == "in_progress" && ud["auto"] == "true":
+			sawAutoStatus = true
+		case ud["distilled"] == "true":
+			sawSummary = true
+		case m.Type == string(db.MessageTypeAgent) && ud == nil && !m.ExcludedFromContext:
+			sawFinalAgent = true
+		}
+	}
+	if !sawAutoStatus || !sawSummary || !sawFinalAgent {
+		t.Errorf("new generation: auto status %v, summary %v, final response %v", sawAutoStatus, sawSummary, sawFinalAgent)
+	}
+	if after.AgentWorking {
+		t.Error("agent still marked working after the turn ended")
+	}
+}
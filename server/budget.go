@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/loop"
+	"shelley.exe.dev/server/notifications"
+)
+
+// budgetFor resolves a conversation's budget over the server-wide one for
+// its kind.
+func (s *Server) budgetFor(opts db.ConversationOptions, subagent bool) db.BudgetOptions {
+	if subagent {
+		return opts.Budget.Over(s.SubagentBudget)
+	}
+	return opts.Budget.Over(s.Budget)
+}
+
+// wireBudget connects a new manager's loops to budget enforcement.
+func (s *Server) wireBudget(manager *ConversationManager) {
+	manager.budget = s.budgetFor
+	manager.checkBudget = func(ctx context.Context) error {
+		return s.checkBudget(ctx, manager.conversationID)
+	}
+	manager.onBudgetExceeded = func(ctx context.Context, err error) {
+		s.notifyBudgetExceeded(ctx, manager.conversationID, err)
+	}
+}
+
+// checkBudget returns a *loop.BudgetError if the conversation, or any of
+// its ancestors, has reached a token or cost limit. Each conversation's
+// spending includes its descendants', so a subagent is stopped by its
+// parent's budget as well as its own.
+//
+// A database error is logged and lets the request through: a budget is a
+// guard rail, not a reason to wedge a conversation.
+func (s *Server) checkBudget(ctx context.Context, conversationID string) error {
+	for id := conversationID; id != ""; {
+		conv, err := s.db.GetConversationByID(ctx, id)
+		if err != nil {
+			s.logger.Warn("budget check: failed to load conversation", "conversationID", id, "error", err)
+			return nil
+		}
+		budget := s.budgetFor(db.ParseConversationOptions(conv.ConversationOptions), conv.ParentConversationID != nil)
+		if budget.MaxInputTokens > 0 || budget.MaxOutputTokens > 0 || budget.MaxCostUSD > 0 {
+			spent, err := s.conversationSpend(ctx, id)
+			if err != nil {
+				s.logger.Warn("budget check: failed to load usage", "conversationID", id, "error", err)
+				return nil
+			}
+			scope := "this conversation"
+			if id != conversationID {
+				scope = "its parent conversation"
+				if conv.Slug != nil {
+					scope = fmt.Sprintf("parent conversation %q", *conv.Slug)
+				}
+			}
+			if err := spent.exceeds(budget, scope); err != nil {
+				return err
+			}
+		}
+		id = derefString(conv.ParentConversationID)
+	}
+	return nil
+}
+
+// budgetSpend is what a conversation and its descendants have spent.
+type budgetSpend struct {
+	inputTokens  int64 // cache reads and writes included
+	outputTokens int64
+	costUSD      float64
+}
+
+// conversationSpend totals the LLM usage of a conversation and its
+// descendants. Costs the LLM gateway reported are used as is; the rest are
+// estimated from models.dev pricing, and count as free if there is none.
+func (s *Server) conversationSpend(ctx context.Context, conversationID string) (budgetSpend, error) {
+	rows, otherRows, err := s.db.GetConversationTreeUsage(ctx, conversationID)
+	if err != nil {
+		return budgetSpend{}, err
+	}
+	var spent budgetSpend
+	add := func(model, url string, in, cacheWrite, cacheRead, out int64, costUSD float64) {
+		spent.inputTokens += in + cacheWrite + cacheRead
+		spent.outputTokens += out
+		if costUSD > 0 {
+			spent.costUSD += costUSD
+		} else if usd, found := estimateCostUSD(url, model, in, cacheWrite, cacheRead, out); found {
+			spent.costUSD += usd
+		}
+	}
+	for _, row := range rows {
+		add(derefString(row.ModelName), derefString(row.LlmApiUrl), row.InputTokens, row.CacheCreationInputTokens, row.CacheReadInputTokens, row.OutputTokens, row.CostUsd)
+	}
+	for _, row := range otherRows {
+		add(row.ModelName, row.LlmApiUrl, row.InputTokens, row.CacheCreationInputTokens, row.CacheReadInputTokens, row.OutputTokens, row.CostUsd)
+	}
+	return spent, nil
+}
+
+// exceeds returns the first of budget's limits that spent has reached, or
+// nil.
+func (spent budgetSpend) exceeds(budget db.BudgetOptions, scope string) error {
+	switch {
+	case budget.MaxCostUSD > 0 && spent.costUSD >= budget.MaxCostUSD:
+		return &loop.BudgetError{Scope: scope, Limit: loop.BudgetCost, Used: spent.costUSD, Max: budget.MaxCostUSD}
+	case budget.MaxInputTokens > 0 && spent.inputTokens >= budget.MaxInputTokens:
+		return &loop.BudgetError{Scope: scope, Limit: loop.BudgetInputTokens, Used: float64(spent.inputTokens), Max: float64(budget.MaxInputTokens)}
+	case budget.MaxOutputTokens > 0 && spent.outputTokens >= budget.MaxOutputTokens:
+		return &loop.BudgetError{Scope: scope, Limit: loop.BudgetOutputTokens, Used: float64(spent.outputTokens), Max: float64(budget.MaxOutputTokens)}
+	}
+	return nil
+}
+
+// notifyBudgetExceeded sends an agent error notification for a turn a
+// budget stopped. Like end-of-turn notifications, it is skipped for
+// subagents (their parent's next request hits the same budget if it is
+// the parent's) and for conversations with notifications off or quiet.
+func (s *Server) notifyBudgetExceeded(ctx context.Context, conversationID string, budgetErr error) {
+	conv, err := s.db.GetConversationByID(ctx, conversationID)
+	if err != nil || conv.ParentConversationID != nil {
+		return
+	}
+	if opts := db.ParseConversationOptions(conv.ConversationOptions); opts.DisableNotifications || opts.Quiet {
+		return
+	}
+	s.notifDispatcher.Dispatch(ctx, notifications.Event{
+		Type:           notifications.EventAgentError,
+		ConversationID: conversationID,
+		Timestamp:      time.Now(),
+		Payload: notifications.AgentErrorPayload{
+			Hostname:        publicHostname(),
+			ErrorMessage:    "Budget exceeded: " + budgetErr.Error(),
+			ConversationURL: s.conversationURL(derefString(conv.Slug)),
+		},
+	})
+}
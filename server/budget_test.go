@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/llm"
+	"shelley.exe.dev/loop"
+	"shelley.exe.dev/server/notifications"
+)
+
+func TestSubagentUsageCountsAgainstParentBudget(t *testing.T) {
+	t.Parallel()
+	srv, database, _ := newTestServer(t)
+	ctx := t.Context()
+
+	parent, err := database.CreateConversation(ctx, nil, true, nil, nil, db.ConversationOptions{
+		Budget: &db.BudgetOptions{MaxCostUSD: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := database.CreateSubagentConversation(ctx, "budget-child", parent.ConversationID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.checkBudget(ctx, child.ConversationID); err != nil {
+		t.Fatalf("checkBudget before any spending = %v", err)
+	}
+
+	// $1.25 of direct usage plus $0.75 of indirect usage reaches the
+	// parent's $2 budget.
+	if _, err := database.CreateMessage(ctx, db.CreateMessageParams{
+		ConversationID: child.ConversationID,
+		Type:           db.MessageTypeAgent,
+		UsageData:      map[string]any{"input_tokens": 1000, "output_tokens": 100, "cost_usd": 1.25},
+		ModelName:      "predictable",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.checkBudget(ctx, child.ConversationID); err != nil {
+		t.Fatalf("checkBudget under budget = %v", err)
+	}
+	if _, err := database.CreateMessage(ctx, db.CreateMessageParams{
+		ConversationID: child.ConversationID,
+		Type:           db.MessageTypeUser,
+		LLMData:        llm.Message{Role: llm.MessageRoleUser},
+		OtherUsageData: []llm.PurposedUsage{{
+			Purpose: "keyword_search",
+			Usage:   llm.Usage{InputTokens: 10, CostUSD: 0.75, Model: "predictable"},
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var budgetErr *loop.BudgetError
+	err = srv.checkBudget(ctx, child.ConversationID)
+	if !errors.As(err, &budgetErr) || budgetErr.Limit != loop.BudgetCost || budgetErr.Used != 2 {
+		t.Fatalf("child checkBudget = %v, want the parent's cost budget exceeded at $2", err)
+	}
+	if !strings.Contains(budgetErr.Scope, "parent") {
+		t.Errorf("scope = %q, want it to name the parent", budgetErr.Scope)
+	}
+	err = srv.checkBudget(ctx, parent.ConversationID)
+	if !errors.As(err, &budgetErr) || budgetErr.Scope != "this conversation" {
+		t.Errorf("parent checkBudget = %v, want its own budget exceeded", err)
+	}
+}
+
+func TestSubagentBudgetDefault(t *testing.T) {
+	t.Parallel()
+	srv, database, _ := newTestServer(t)
+	ctx := t.Context()
+	srv.SubagentBudget = db.BudgetOptions{MaxOutputTokens: 100}
+
+	parent, err := database.CreateConversation(ctx, nil, true, nil, nil, db.ConversationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := database.CreateSubagentConversation(ctx, "budget-default", parent.ConversationID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateMessage(ctx, db.CreateMessageParams{
+		ConversationID: child.ConversationID,
+		Type:           db.MessageTypeAgent,
+		UsageData:      map[string]any{"input_tokens": 10, "output_tokens": 150},
+		ModelName:      "predictable",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var budgetErr *loop.BudgetError
+	if err := srv.checkBudget(ctx, child.ConversationID); !errors.As(err, &budgetErr) || budgetErr.Limit != loop.BudgetOutputTokens {
+		t.Errorf("child checkBudget = %v, want the subagent output token budget exceeded", err)
+	}
+	// The subagent default does not apply to top-level conversations.
+	if err := srv.checkBudget(ctx, parent.ConversationID); err != nil {
+		t.Errorf("parent checkBudget = %v, want nil", err)
+	}
+}
+
+func TestMaxRoundsPerTurnStopsTurnAndNotifies(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	ch := &recordingChannel{}
+	h.server.RegisterNotificationChannel(ch)
+	conv, err := h.db.CreateConversation(context.Background(), nil, true, nil, nil, db.ConversationOptions{
+		Budget: &db.BudgetOptions{MaxRoundsPerTurn: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.convID = conv.ConversationID
+
+	h.Chat("bash: echo hi")
+
+	deadline := time.Now().Add(h.timeout)
+	for errorText(t, h) == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("no budget error message")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := errorText(t, h); !strings.Contains(got, "Budget exceeded") {
+		t.Fatalf("error message = %q, want a budget error", got)
+	}
+	for {
+		ch.mu.Lock()
+		var found *notifications.Event
+		for i := range ch.events {
+			if ch.events[i].Type == notifications.EventAgentError {
+				found = &ch.events[i]
+			}
+		}
+		ch.mu.Unlock()
+		if found != nil {
+			if p, ok := found.Payload.(notifications.AgentErrorPayload); !ok || !strings.Contains(p.ErrorMessage, "LLM requests") {
+				t.Errorf("payload = %+v", found.Payload)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no agent error notification")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// errorText returns the text of the conversation's latest error message,
+// or "".
+func errorText(t *testing.T, h *TestHarness) string {
+	t.Helper()
+	messages, err := h.db.ListMessages(context.Background(), h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Type != string(db.MessageTypeError) || messages[i].LlmData == nil {
+			continue
+		}
+		var msg llm.Message
+		if err := json.Unmarshal([]byte(*messages[i].LlmData), &msg); err != nil || len(msg.Content) == 0 {
+			t.Fatalf("bad error message: %v", err)
+		}
+		return msg.Content[0].Text
+	}
+	return ""
+}
+
+func TestValidateBudgetOption(t *testing.T) {
+	opts := db.ConversationOptions{Budget: &db.BudgetOptions{MaxCostUSD: -1}}
+	if msg := validateConversationOptions(opts); !strings.Contains(msg, "max_cost_usd") {
+		t.Errorf("validateConversationOptions = %q, want a negative max_cost_usd rejected", msg)
+	}
+}
+
+func TestBudgetFor(t *testing.T) {
+	s := &Server{
+		Budget:         db.BudgetOptions{MaxCostUSD: 10, MaxRoundsPerTurn: 50},
+		SubagentBudget: db.BudgetOptions{MaxCostUSD: 1},
+	}
+	if got := s.budgetFor(db.ConversationOptions{}, false); got != s.Budget {
+		t.Errorf("top-level default = %+v, want %+v", got, s.Budget)
+	}
+	if got := s.budgetFor(db.ConversationOptions{}, true); got != s.SubagentBudget {
+		t.Errorf("subagent default = %+v, want %+v", got, s.SubagentBudget)
+	}
+	got := s.budgetFor(db.ConversationOptions{Budget: &db.BudgetOptions{MaxOutputTokens: 5000}}, false)
+	want := db.BudgetOptions{MaxOutputTokens: 5000, MaxCostUSD: 10, MaxRoundsPerTurn: 50}
+	if got != want {
+		t.Errorf("override = %+v, want %+v", got, want)
+	}
+}
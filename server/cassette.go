@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+
+	"shelley.exe.dev/llm"
+	"shelley.exe.dev/llm/cassette"
+	"shelley.exe.dev/models"
+)
+
+// cassetteProvider sends every model of an LLMProvider through a cassette.
+// When recording, the provider's models are recorded as they are used; when
+// replaying, the models are those the cassette has answers from.
+type cassetteProvider struct {
+	LLMProvider
+	cassette *cassette.Cassette
+}
+
+// NewCassetteLLMProvider returns an LLMProvider that records the requests
+// to provider's models into c, or replays them from it.
+func NewCassetteLLMProvider(provider LLMProvider, c *cassette.Cassette) LLMProvider {
+	return &cassetteProvider{LLMProvider: provider, cassette: c}
+}
+
+func (p *cassetteProvider) replaying() bool {
+	return p.cassette.Mode() == cassette.Replay
+}
+
+func (p *cassetteProvider) GetService(modelID string) (llm.Service, error) {
+	if p.replaying() {
+		if !p.HasModel(modelID) {
+			return nil, fmt.Errorf("unsupported model: %s (the cassette has no requests to it)", modelID)
+		}
+		return p.cassette.Wrap(modelID, nil), nil
+	}
+	svc, err := p.LLMProvider.GetService(modelID)
+	if err != nil {
+		return nil, err
+	}
+	return p.cassette.Wrap(modelID, svc), nil
+}
+
+func (p *cassetteProvider) GetAvailableModels() []string {
+	if p.replaying() {
+		return p.cassette.Models()
+	}
+	return p.LLMProvider.GetAvailableModels()
+}
+
+func (p *cassetteProvider) HasModel(modelID string) bool {
+	if p.replaying() {
+		return slices.Contains(p.cassette.Models(), modelID)
+	}
+	return p.LLMProvider.HasModel(modelID)
+}
+
+// RefreshBuiltModels implements builtModelRefresher for a recording
+// provider whose underlying one does.
+func (p *cassetteProvider) RefreshBuiltModels(built []models.Built) error {
+	refresher, ok := p.LLMProvider.(builtModelRefresher)
+	if p.replaying() || !ok {
+		return fmt.Errorf("model refresh is not available while replaying a cassette")
+	}
+	return refresher.RefreshBuiltModels(built)
+}
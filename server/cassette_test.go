@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/llm/cassette"
+)
+
+// newCassetteTestServer creates a Server whose models answer from the
+// cassette at path (relative to the package directory), replaying what a
+// real model said when it was recorded with shelley serve -llm-cassette.
+// The test fails if the server sends a request the cassette has no answer to.
+func newCassetteTestServer(t *testing.T, path string) (*Server, *db.DB, *cassette.Cassette) {
+	t.Helper()
+	database, cleanup := setupTestDB(t)
+	t.Cleanup(cleanup)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(packageDir, path)
+	}
+	c, err := cassette.Open(path, cassette.Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	models := c.Models()
+	if len(models) == 0 {
+		t.Fatalf("cassette %s has no recorded requests", path)
+	}
+	svr := NewServer(database, NewCassetteLLMProvider(&testLLMManager{}, c),
+		claudetool.ToolSetConfig{EnableBrowser: false},
+		slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn})),
+		false, models[0], "")
+	svr.hooksDir = t.TempDir()
+	t.Cleanup(func() {
+		if err := c.Err(); err != nil {
+			t.Error(err)
+		}
+	})
+	return svr, database, c
+}
+
+func TestCassetteReplay(t *testing.T) {
+	t.Parallel()
+	srv, database, c := newCassetteTestServer(t, "testdata/echo.cassette")
+	ctx := context.Background()
+
+	model := "recorded-model"
+	conv, err := database.CreateConversation(ctx, nil, true, nil, &model, db.ConversationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := conv.ConversationID
+	if w := postChat(t, srv, id, "Change to the root directory"); w.Code != http.StatusAccepted {
+		t.Fatalf("chat: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		for _, m := range listMessages(t, database, id) {
+			if m.Type == string(db.MessageTypeAgent) && m.LlmData != nil && strings.Contains(*m.LlmData, "working directory is now /") {
+				return true
+			}
+		}
+		return false
+	})
+	waitFor(t, 5*time.Second, func() bool { return c.Unused() == 0 })
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+	"shelley.exe.dev/llm"
+)
+
+// recordFileCheckpoints implements claudetool.CheckpointFunc for the
+// conversation's patch and bash calls.
+func (cm *ConversationManager) recordFileCheckpoints(ctx context.Context, tool string, files []claudetool.FileCheckpoint) {
+	toolUseID := llm.ToolUseID(ctx)
+	params := make([]generated.CreateFileCheckpointParams, 0, len(files))
+	for _, f := range files {
+		params = append(params, generated.CreateFileCheckpointParams{
+			ToolUseID: toolUseID,
+			ToolName:  tool,
+			Path:      f.Path,
+			Existed:   f.Existed,
+			Content:   f.Content,
+			Mode:      int64(f.Mode),
+		})
+	}
+	if err := cm.db.CreateFileCheckpoints(ctx, cm.conversationID, params); err != nil {
+		cm.logger.Warn("Failed to record file checkpoints", "tool", tool, "tool_use_id", toolUseID, "files", len(files), "error", err)
+	}
+}
+
+// RewindFileError reports a file a rewind could not restore.
+type RewindFileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// restoreFileCheckpoints undoes the changes recorded by checkpoints (oldest
+// first): each path gets the state of its earliest checkpoint. It returns the
+// restored paths in checkpoint order and the paths it failed to restore.
+func restoreFileCheckpoints(checkpoints []generated.FileCheckpoint) (restored []string, failed []RewindFileError) {
+	seen := make(map[string]bool)
+	for _, cp := range checkpoints {
+		if seen[cp.Path] {
+			continue
+		}
+		seen[cp.Path] = true
+		if err := restoreFileCheckpoint(cp); err != nil {
+			failed = append(failed, RewindFileError{Path: cp.Path, Error: err.Error()})
+			continue
+		}
+		restored = append(restored, cp.Path)
+	}
+	return restored, failed
+}
+
+func restoreFileCheckpoint(cp generated.FileCheckpoint) error {
+	if !cp.Existed {
+		if err := os.Remove(cp.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	mode := os.FileMode(cp.Mode).Perm()
+	if mode == 0 {
+		mode = 0o644
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.Path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(cp.Path, cp.Content, mode); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file that still exists.
+	return os.Chmod(cp.Path, mode)
+}
+
+// RewindRequest is the body for POST /conversation/<id>/rewind. The target
+// message is identified by MessageID (preferred) or SequenceID.
+type RewindRequest struct {
+	MessageID  string `json:"message_id,omitempty"`
+	SequenceID int64  `json:"sequence_id,omitempty"`
+	// Mode is "truncate" (the default) to rewind the conversation in place,
+	// or "fork" to continue from the target message in a new conversation.
+	Mode string `json:"mode,omitempty"`
+}
+
+// RewindResponse is the result of a rewind.
+type RewindResponse struct {
+	// Conversation is the rewound conversation, or the new one for a fork.
+	Conversation  *generated.Conversation `json:"conversation"`
+	RestoredFiles []string                `json:"restored_files"`
+	FailedFiles   []RewindFileError       `json:"failed_files,omitempty"`
+}
+
+// handleRewindConversation handles POST /conversation/<id>/rewind. It
+// either rewinds the conversation in place — a new generation holding
+// the messages up to and including the target — or forks it there, then
+// undoes the file changes that patch and bash calls made after the target.
+func (s *Server) handleRewindConversation(w http.ResponseWriter, r *http.Request, conversationID string) {
+	ctx := r.Context()
+
+	var req RewindRequest
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	switch req.Mode {
+	case "":
+		req.Mode = "truncate"
+	case "truncate", "fork":
+	default:
+		http.Error(w, `mode must be "truncate" or "fork"`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.db.GetConversationByID(ctx, conversationID); err != nil {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	cutoff := req.SequenceID
+	if req.MessageID != "" {
+		msg, err := s.db.GetMessageByID(ctx, req.MessageID)
+		if err != nil {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		if msg.ConversationID != conversationID {
+			http.Error(w, "Message does not belong to this conversation", http.StatusBadRequest)
+			return
+		}
+		cutoff = msg.SequenceID
+	}
+	if cutoff <= 0 {
+		http.Error(w, "message_id or sequence_id is required", http.StatusBadRequest)
+		return
+	}
+
+	manager, err := s.getOrCreateConversationManager(ctx, conversationID, "")
+	if err != nil {
+		s.logger.Error("Failed to get conversation manager for rewind", "conversationID", conversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Hold off queued messages until the rewind is done, and refuse to pull
+	// files out from under a running turn.
+	if !manager.BeginDistillingSetup() {
+		http.Error(w, "Wait for the compaction in progress to finish before rewinding", http.StatusConflict)
+		return
+	}
+	defer func() {
+		manager.FinishDistillingSetup()
+		manager.SetDistilling(false)
+		go manager.drainPendingMessages(s)
+	}()
+	if manager.IsAgentWorking() {
+		http.Error(w, "Finish or stop the current turn to rewind", http.StatusConflict)
+		return
+	}
+
+	checkpoints, err := s.db.ListFileCheckpointsAfter(ctx, conversationID, cutoff)
+	if err != nil {
+		s.logger.Error("Failed to list file checkpoints", "conversationID", conversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Files are only touched once the conversation side of the rewind has
+	// succeeded, so a rejected or failed rewind leaves the tree alone.
+	var restored []string
+	var failed []RewindFileError
+	restore := func() int {
+		restored, failed = restoreFileCheckpoints(checkpoints)
+		if len(failed) > 0 {
+			s.logger.Warn("Rewind could not restore some files", "conversationID", conversationID, "failed", failed)
+		}
+		return len(restored)
+	}
+
+	var conv *generated.Conversation
+	if req.Mode == "fork" {
+		conv, err = s.db.ForkConversation(ctx, conversationID, cutoff)
+		if err == nil {
+			conv, err = s.finishFork(ctx, conversationID, conv, cutoff)
+		}
+		if err == nil {
+			restore()
+		}
+	} else {
+		conv, err = s.rewindInPlace(ctx, manager, cutoff, restore)
+	}
+	if errors.Is(err, db.ErrInvalidForkPoint) {
+		http.Error(w, "Invalid rewind point: no message at or before the requested cutoff", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to rewind conversation", "conversationID", conversationID, "mode", req.Mode, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if req.Mode == "fork" {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(RewindResponse{Conversation: conv, RestoredFiles: restored, FailedFiles: failed})
+}
+
+// rewindInPlace moves the conversation to a new generation holding its
+// messages up to and including cutoff, calls restore to put the files back,
+// records a marker saying so, and drops the loop so the next turn hydrates
+// from the rewound history.
+func (s *Server) rewindInPlace(ctx context.Context, manager *ConversationManager, cutoff int64, restore func() int) (*generated.Conversation, error) {
+	conversationID := manager.conversationID
+	conv, err := s.db.RewindConversation(ctx, conversationID, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyForkPointModelState(ctx, conversationID, conversationID, cutoff); err != nil {
+		return nil, err
+	}
+	manager.ResetLoop()
+
+	text := "Conversation rewound to an earlier message."
+	switch restoredFiles := restore(); restoredFiles {
+	case 0:
+	case 1:
+		text += " Restored 1 file."
+	default:
+		text += fmt.Sprintf(" Restored %d files.", restoredFiles)
+	}
+	if _, err := s.db.CreateMessage(ctx, db.CreateMessageParams{
+		ConversationID:      conversationID,
+		Type:                db.MessageTypeWarning,
+		UserData:            map[string]string{"text": text},
+		ExcludedFromContext: true,
+	}); err != nil {
+		return nil, fmt.Errorf("record rewind marker: %w", err)
+	}
+
+	// Deliver the copied messages and the marker in one go, so clients see
+	// no hole in the sequence.
+	conv, err = s.db.GetConversationByID(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.db.ListMessages(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	var added []generated.Message
+	for _, m := range messages {
+		if m.Generation == conv.CurrentGeneration {
+			added = append(added, m)
+		}
+	}
+	if len(added) > 0 {
+		manager.publishStream(added[len(added)-1].SequenceID, StreamResponse{
+			Messages:     toAPIMessages(added),
+			Conversation: conv,
+		})
+	}
+	go s.publishConversationListUpdate(ConversationListUpdate{Type: "update", Conversation: conv})
+	return conv, nil
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+)
+
+// patchedConversation runs a turn in which the predictable model patches a
+// file, returning the file path and the user message that started the turn.
+func patchedConversation(t *testing.T, h *TestHarness) (string, generated.Message) {
+	t.Helper()
+	ctx := context.Background()
+	cwd := t.TempDir()
+	path := filepath.Join(cwd, "notes.txt")
+	if err := os.WriteFile(path, []byte("an example file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	conv, err := h.db.CreateConversation(ctx, nil, true, &cwd, nil, db.ConversationOptions{})
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+	h.convID = conv.ConversationID
+
+	h.Chat("patch: " + path)
+	h.WaitResponse()
+	waitAgentIdle(t, h)
+
+	if got, _ := os.ReadFile(path); string(got) != "an updated example file\n" {
+		t.Fatalf("patch did not apply: %q", got)
+	}
+	users, err := h.db.ListMessagesByType(ctx, h.convID, db.MessageTypeUser)
+	if err != nil || len(users) == 0 {
+		t.Fatalf("no user message: %v", err)
+	}
+	return path, users[0]
+}
+
+func waitAgentIdle(t *testing.T, h *TestHarness) {
+	t.Helper()
+	deadline := time.Now().Add(h.timeout)
+	for time.Now().Before(deadline) {
+		h.server.mu.Lock()
+		cm := h.server.activeConversations[h.convID]
+		h.server.mu.Unlock()
+		if cm == nil || !cm.IsAgentWorking() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("agent still working")
+}
+
+func rewind(t *testing.T, h *TestHarness, req RewindRequest, wantStatus int) RewindResponse {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest("POST", "/api/conversation/"+h.convID+"/rewind", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	h.server.handleRewindConversation(w, r, h.convID)
+	if w.Code != wantStatus {
+		t.Fatalf("rewind: status %d, want %d: %s", w.Code, wantStatus, w.Body.String())
+	}
+	var resp RewindResponse
+	if wantStatus < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func TestRewindRestoresPatchedFile(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	defer stopActiveConversationLoops(h.server)
+	ctx := context.Background()
+	path, first := patchedConversation(t, h)
+
+	before, err := h.db.GetConversationByID(ctx, h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := rewind(t, h, RewindRequest{MessageID: first.MessageID}, http.StatusOK)
+
+	if got, _ := os.ReadFile(path); string(got) != "an example file\n" {
+		t.Errorf("file not restored: %q", got)
+	}
+	if len(resp.RestoredFiles) != 1 || resp.RestoredFiles[0] != path {
+		t.Errorf("restored_files = %v", resp.RestoredFiles)
+	}
+	if resp.Conversation.CurrentGeneration != before.CurrentGeneration+1 {
+		t.Errorf("generation = %d, want %d", resp.Conversation.CurrentGeneration, before.CurrentGeneration+1)
+	}
+
+	history, err := h.db.ListMessagesForContext(ctx, h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := history[len(history)-1]
+	if last.Type != string(db.MessageTypeUser) || last.ForkedFromMessageID == nil || *last.ForkedFromMessageID != first.MessageID {
+		t.Errorf("rewound history should end with a copy of the first user message, got %s %v", last.Type, last.ForkedFromMessageID)
+	}
+
+	// The rewound conversation carries on, and its new edits can be undone
+	// in turn.
+	h.Chat("patch: " + path)
+	h.WaitResponse()
+	waitAgentIdle(t, h)
+	history, _ = h.db.ListMessagesForContext(ctx, h.convID)
+	var copiedFirst generated.Message
+	for _, m := range history {
+		if m.ForkedFromMessageID != nil && *m.ForkedFromMessageID == first.MessageID {
+			copiedFirst = m
+		}
+	}
+	rewind(t, h, RewindRequest{SequenceID: copiedFirst.SequenceID}, http.StatusOK)
+	if got, _ := os.ReadFile(path); string(got) != "an example file\n" {
+		t.Errorf("file not restored after second rewind: %q", got)
+	}
+}
+
+func TestRewindFork(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	defer stopActiveConversationLoops(h.server)
+	ctx := context.Background()
+	path, first := patchedConversation(t, h)
+
+	msgs, err := h.db.ListMessages(ctx, h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := rewind(t, h, RewindRequest{MessageID: first.MessageID, Mode: "fork"}, http.StatusCreated)
+	if resp.Conversation.ConversationID == h.convID {
+		t.Fatal("fork should create a new conversation")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "an example file\n" {
+		t.Errorf("file not restored: %q", got)
+	}
+	after, err := h.db.ListMessages(ctx, h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(msgs) {
+		t.Errorf("source conversation changed: %d messages, had %d", len(after), len(msgs))
+	}
+}
+
+func TestForkCarriesFileCheckpoints(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	defer stopActiveConversationLoops(h.server)
+	ctx := context.Background()
+	_, first := patchedConversation(t, h)
+
+	msgs, err := h.db.ListMessages(ctx, h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forked, err := h.db.ForkConversation(ctx, h.convID, msgs[len(msgs)-1].SequenceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoints, err := h.db.ListFileCheckpointsAfter(ctx, forked.ConversationID, first.SequenceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].ToolName != "patch" {
+		t.Fatalf("fork checkpoints = %+v", checkpoints)
+	}
+	copied, err := h.db.GetMessageByID(ctx, checkpoints[0].MessageID)
+	if err != nil || copied.ConversationID != forked.ConversationID {
+		t.Errorf("checkpoint not attached to the fork's copy: %+v, %v", copied, err)
+	}
+}
+
+func TestRewindRejectsBadRequests(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	defer stopActiveConversationLoops(h.server)
+	_, first := patchedConversation(t, h)
+
+	rewind(t, h, RewindRequest{}, http.StatusBadRequest)
+	rewind(t, h, RewindRequest{MessageID: first.MessageID, Mode: "sideways"}, http.StatusBadRequest)
+	rewind(t, h, RewindRequest{MessageID: "nope"}, http.StatusNotFound)
+}
+
+func TestRewindKeepsTargetMessageEdits(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	defer stopActiveConversationLoops(h.server)
+	ctx := context.Background()
+	path, first := patchedConversation(t, h)
+
+	checkpoints, err := h.db.ListFileCheckpointsAfter(ctx, h.convID, first.SequenceID)
+	if err != nil || len(checkpoints) != 1 {
+		t.Fatalf("checkpoints = %+v, %v", checkpoints, err)
+	}
+	resp := rewind(t, h, RewindRequest{MessageID: checkpoints[0].MessageID}, http.StatusOK)
+	if len(resp.RestoredFiles) != 0 {
+		t.Errorf("restored_files = %v", resp.RestoredFiles)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "an updated example file\n" {
+		t.Errorf("the kept message's edit was undone: %q", got)
+	}
+}
+
+func TestRewindTwiceUndoesKeptEdits(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	defer stopActiveConversationLoops(h.server)
+	ctx := context.Background()
+	path, first := patchedConversation(t, h)
+
+	checkpoints, err := h.db.ListFileCheckpointsAfter(ctx, h.convID, first.SequenceID)
+	if err != nil || len(checkpoints) != 1 {
+		t.Fatalf("checkpoints = %+v, %v", checkpoints, err)
+	}
+	// The first rewind keeps the patch message, so its checkpoint must come
+	// along for a second rewind past it to undo the edit.
+	rewind(t, h, RewindRequest{MessageID: checkpoints[0].MessageID}, http.StatusOK)
+	history, err := h.db.ListMessagesForContext(ctx, h.convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var copiedFirst generated.Message
+	for _, m := range history {
+		if m.ForkedFromMessageID != nil && *m.ForkedFromMessageID == first.MessageID {
+			copiedFirst = m
+		}
+	}
+	if copiedFirst.MessageID == "" {
+		t.Fatal("first user message not copied into the rewound generation")
+	}
+	resp := rewind(t, h, RewindRequest{MessageID: copiedFirst.MessageID}, http.StatusOK)
+	if len(resp.RestoredFiles) != 1 || resp.RestoredFiles[0] != path {
+		t.Errorf("restored_files = %v", resp.RestoredFiles)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "an example file\n" {
+		t.Errorf("file not restored by the second rewind: %q", got)
+	}
+}
+
+func TestRewindRejectedLeavesFiles(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	defer stopActiveConversationLoops(h.server)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	conv, err := h.db.CreateConversation(ctx, nil, true, nil, nil, db.ConversationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.convID = conv.ConversationID
+	// A slug marker is not a valid rewind point, so a rewind to it is
+	// refused; the later agent message's checkpoint must stay unapplied.
+	slugMsg, err := h.db.CreateMessage(ctx, db.CreateMessageParams{ConversationID: h.convID, Type: db.MessageTypeSlug})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.db.CreateMessage(ctx, db.CreateMessageParams{ConversationID: h.convID, Type: db.MessageTypeAgent}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.db.CreateFileCheckpoints(ctx, h.convID, []generated.CreateFileCheckpointParams{
+		{ToolUseID: "tu", ToolName: "patch", Path: path, Existed: true, Content: []byte("original\n"), Mode: 0o644},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rewind(t, h, RewindRequest{SequenceID: slugMsg.SequenceID}, http.StatusBadRequest)
+	if got, _ := os.ReadFile(path); string(got) != "edited\n" {
+		t.Errorf("rejected rewind touched the file: %q", got)
+	}
+}
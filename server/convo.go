@@ -13,12 +13,15 @@ import (
 
 	"github.com/google/uuid"
 	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/claudetool/approval"
+	"shelley.exe.dev/claudetool/sandbox"
 	"shelley.exe.dev/db"
 	"shelley.exe.dev/db/generated"
 	"shelley.exe.dev/gitstate"
 	"shelley.exe.dev/llm"
 	"shelley.exe.dev/llm/llmhttp"
 	"shelley.exe.dev/loop"
+	"shelley.exe.dev/skills"
 	"shelley.exe.dev/subpub"
 )
 
@@ -136,6 +139,49 @@ type ConversationManager struct {
 	serverPort            int    // TCP port the shelley server listens on, for SHELLEY_PORT/SHELLEY_URL
 	slug                  string // conversation slug, for SHELLEY_CONVERSATION_SLUG
 
+	// autoCompactSettings and autoCompact connect the loop's automatic
+	// compaction to the server (see Server.wireAutoCompact). Nil disables
+	// automatic compaction.
+	autoCompactSettings func(db.ConversationOptions) db.AutoCompactOptions
+	autoCompact         func(ctx context.Context) ([]llm.Message, error)
+
+	// hooksDir is the directory searched for the pre-tool-use and
+	// post-tool-use hooks. Empty disables them.
+	hooksDir string
+
+	// inheritedSandbox is the sandbox option of the nearest ancestor
+	// conversation that sets one; see effectiveSandbox.
+	inheritedSandbox *sandbox.Profile
+
+	// budget resolves the conversation's budget over the server-wide
+	// defaults, and checkBudget and onBudgetExceeded connect the loop's
+	// budget enforcement to the server (see Server.wireBudget). Nil
+	// disables budgets.
+	budget           func(opts db.ConversationOptions, subagent bool) db.BudgetOptions
+	checkBudget      func(ctx context.Context) error
+	onBudgetExceeded func(ctx context.Context, err error)
+	// modelFallbacks returns the models to fall back to from a model,
+	// fallbackAfter is how many retryable failures trigger a fallback, and
+	// onModelFallback records a switch (see Server.wireModelFallback). Nil
+	// disables fallbacks.
+	modelFallbacks  func(modelID string) []loop.Fallback
+	fallbackAfter   int
+	onModelFallback func(ctx context.Context, to loop.Fallback, err error)
+	// isSubagent is set by Hydrate for conversations with a parent.
+	isSubagent bool
+
+	// activeSkill is the skill the agent activated during the current turn,
+	// whose allowed-tools restrict its tool calls (see checkSkillScope).
+	// Cleared when the turn ends. Guarded by mu.
+	activeSkill *skills.Skill
+
+	// pendingApprovals are tool calls waiting for the user to approve them
+	// (see approvalGate). Guarded by mu.
+	pendingApprovals []*pendingApproval
+	// approvalTimeout is how long a pending approval waits before it is
+	// rejected; zero means defaultApprovalTimeout.
+	approvalTimeout time.Duration
+
 	// agentWorking tracks whether the agent is currently working.
 	// This is explicitly managed and broadcast to subscribers when it changes.
 	agentWorking bool
@@ -415,6 +461,9 @@ func (cm *ConversationManager) setAgentWorking(working, persist bool) {
 		return
 	}
 	cm.agentWorking = working
+	if !working {
+		cm.activeSkill = nil
+	}
 	onStateChange := cm.onStateChange
 	onDone := cm.onDone
 	convID := cm.conversationID
@@ -665,6 +714,10 @@ func (cm *ConversationManager) Hydrate(ctx context.Context) error {
 
 	// Load conversation options
 	cm.conversationOptions = db.ParseConversationOptions(conversation.ConversationOptions)
+	if conversation.ParentConversationID != nil {
+		cm.inheritedSandbox = ancestorSandbox(ctx, cm.db, *conversation.ParentConversationID)
+		cm.isSubagent = true
+	}
 
 	// Set ParentConversationID on toolSetConfig so that subagent tool is included
 	// in the display_data tools list when generating system prompt.
@@ -685,17 +738,9 @@ func (cm *ConversationManager) Hydrate(ctx context.Context) error {
 	}
 
 	if !hasSystemMessage(messages) {
-		var systemMsg *generated.Message
-		var err error
-		if conversation.ParentConversationID != nil {
-			systemMsg, err = cm.createSubagentSystemPrompt(ctx, *conversation.ParentConversationID)
-		} else if conversation.UserInitiated {
-			systemMsg, err = cm.createSystemPrompt(ctx)
-		}
-		if err != nil {
+		if err := cm.createGenerationSystemPrompt(ctx, conversation); err != nil {
 			return err
 		}
-		_ = systemMsg // persisted to DB; ensureLoop will read it
 	}
 
 	// Parse the persisted queued_messages array up front (outside cm.mu).
@@ -1607,11 +1652,33 @@ func hasNonSystemMessages(messages []generated.Message) bool {
 	return false
 }
 
+// createGenerationSystemPrompt stores the system prompt for the
+// conversation's current generation: the minimal subagent prompt for
+// subagents, the full prompt for user-initiated conversations.
+func (cm *ConversationManager) createGenerationSystemPrompt(ctx context.Context, conversation *generated.Conversation) error {
+	var err error
+	if conversation.ParentConversationID != nil {
+		_, err = cm.createSubagentSystemPrompt(ctx, *conversation.ParentConversationID)
+	} else if conversation.UserInitiated {
+		_, err = cm.createSystemPrompt(ctx)
+	}
+	return err
+}
+
 func (cm *ConversationManager) createSystemPrompt(ctx context.Context) (*generated.Message, error) {
 	var opts []SystemPromptOption
 	if cm.userEmail != "" {
 		opts = append(opts, WithUserEmail(cm.userEmail))
 	}
+	if provider, modelID := cm.toolSetConfig.LLMProvider, cm.toolSetConfig.ModelID; provider != nil && modelID != "" {
+		if svc, err := provider.GetService(modelID); err == nil {
+			opts = append(opts, WithModelCapabilities(modelCapabilities(svc)))
+		}
+	}
+	displayData := cm.systemPromptDisplayData()
+	if box, ok := displayData["sandbox"].(*sandbox.Sandbox); ok {
+		opts = append(opts, WithSandbox(box.Summary()))
+	}
 	systemPrompt, err := GenerateSystemPrompt(cm.cwd, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate system prompt: %w", err)
@@ -1632,7 +1699,7 @@ func (cm *ConversationManager) createSystemPrompt(ctx context.Context) (*generat
 		Type:           db.MessageTypeSystem,
 		LLMData:        systemMessage,
 		UsageData:      llm.Usage{},
-		DisplayData:    cm.systemPromptDisplayData(),
+		DisplayData:    displayData,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to store system prompt: %w", err)
@@ -1672,16 +1739,30 @@ func toolDisplayData(tools []*llm.Tool) map[string]any {
 }
 
 // systemPromptDisplayData returns display data for normal system prompt messages.
+// MCP tools are listed from what discovery recorded rather than by starting
+// the servers, which the conversation's loop does for itself.
 func systemPromptDisplayData(cfg claudetool.ToolSetConfig) map[string]any {
+	withMCP := len(cfg.MCPServers) > 0
+	cfg.MCPServers = nil
 	ts := claudetool.NewToolSet(context.Background(), cfg)
 	defer ts.Cleanup()
-	return toolDisplayData(ts.Tools())
+	tools := ts.Tools()
+	if withMCP {
+		tools = append(tools, claudetool.FilterTools(claudetool.MCPToolDefinitions(), cfg.ToolOverrides, cfg.DisableAllTools)...)
+	}
+	data := toolDisplayData(tools)
+	if box := sandbox.New(cfg.Sandbox, ts.WorkingDir().Get()); box != nil {
+		data["sandbox"] = box
+	}
+	return data
 }
 
 func (cm *ConversationManager) systemPromptDisplayData() map[string]any {
 	cfg := cm.toolSetConfig
+	cfg.WorkingDir = cm.cwd
 	cfg.ToolOverrides = cm.conversationOptions.ToolOverrides
 	cfg.DisableAllTools = cm.conversationOptions.DisableAllTools
+	cfg.Sandbox = cm.effectiveSandbox()
 	return systemPromptDisplayData(cfg)
 }
 
@@ -1813,6 +1894,23 @@ func (cm *ConversationManager) ensureLoop(service llm.Service, modelID string) e
 	conversationID := cm.conversationID
 	conversationOpts := cm.conversationOptions
 	database := cm.db
+	var compactThreshold float64
+	if cm.autoCompact != nil {
+		if settings := cm.autoCompactSettings(conversationOpts); *settings.Enabled {
+			compactThreshold = settings.Threshold
+		}
+	}
+	compact := cm.autoCompact
+	var maxRounds int
+	if cm.budget != nil {
+		maxRounds = cm.budget(conversationOpts, cm.isSubagent).MaxRoundsPerTurn
+	}
+	checkBudget, onBudgetExceeded := cm.checkBudget, cm.onBudgetExceeded
+	var fallbacks []loop.Fallback
+	if cm.modelFallbacks != nil {
+		fallbacks = cm.modelFallbacks(modelID)
+	}
+	fallbackAfter, onModelFallback := cm.fallbackAfter, cm.onModelFallback
 	toolSetConfig.Env = claudetool.ShelleyEnv{
 		ConversationSlug: cm.slug,
 		Model:            modelID,
@@ -1878,7 +1976,15 @@ func (cm *ConversationManager) ensureLoop(service llm.Service, modelID string) e
 	toolSetConfig.ToolOverrides = conversationOpts.ToolOverrides
 	toolSetConfig.DisableAllTools = conversationOpts.DisableAllTools
 	toolSetConfig.ReasoningLevel = conversationOpts.ThinkingLevel
+	serverApprovalPolicy := toolSetConfig.ApprovalPolicy
+	toolSetConfig.ApprovalPolicy = func() *approval.Policy {
+		return cm.effectiveApprovalPolicy(serverApprovalPolicy)
+	}
+	toolSetConfig.ApprovalGate = approvalGate{cm: cm}
+	toolSetConfig.Checkpoint = cm.recordFileCheckpoints
+	toolSetConfig.Sandbox = cm.effectiveSandbox()
 	toolSet := claudetool.NewToolSet(processCtx, toolSetConfig)
+	preToolUse, postToolUse := cm.toolUseHooks(modelID, toolSet.WorkingDir())
 
 	// streamFlusher batches LLM stream deltas and flushes them periodically
 	// to avoid overwhelming the bounded subpub queue with hundreds
@@ -1911,6 +2017,17 @@ func (cm *ConversationManager) ensureLoop(service llm.Service, modelID string) e
 		InjectMessages: func(ctx context.Context) []llm.Message {
 			return cm.takeInjectableSubagentDone(ctx)
 		},
+		Compact:          compact,
+		CompactThreshold: compactThreshold,
+		PreToolUse:       preToolUse,
+		PostToolUse:      postToolUse,
+		MaxParallelTools: toolSetConfig.MaxParallelTools,
+		MaxRoundsPerTurn: maxRounds,
+		CheckBudget:      checkBudget,
+		OnBudgetExceeded: onBudgetExceeded,
+		Fallbacks:        fallbacks,
+		FallbackAfter:    fallbackAfter,
+		OnFallback:       onModelFallback,
 	})
 
 	cm.mu.Lock()
@@ -5,11 +5,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/claudetool/mcp"
 	"shelley.exe.dev/db"
 	"shelley.exe.dev/db/generated"
+	"shelley.exe.dev/llm"
 )
 
 func TestHydrateGeneratesSystemPromptWithSubagentTool(t *testing.T) {
@@ -139,3 +144,25 @@ func TestHydrateSystemPromptDisplayDataRespectsToolOverrides(t *testing.T) {
 		t.Fatalf("display data should include enabled shell tool: %+v", displayData.Tools)
 	}
 }
+
+func TestSystemPromptDisplayDataDoesNotStartMCPServers(t *testing.T) {
+	t.Parallel()
+	marker := filepath.Join(t.TempDir(), "started")
+	claudetool.RegisterDynamicTools([]*llm.Tool{{Name: "mcp__display_test__lookup", Description: "Look things up."}})
+	cfg := claudetool.ToolSetConfig{
+		WorkingDir: t.TempDir(),
+		MCPServers: []mcp.ServerConfig{{Name: "display_test", Command: "sh", Args: []string{"-c", "touch " + marker}}},
+	}
+
+	data := systemPromptDisplayData(cfg)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("listing tools for display started an MCP server")
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "mcp__display_test__lookup") {
+		t.Errorf("display data lacks the discovered MCP tool: %s", out)
+	}
+}
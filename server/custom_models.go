@@ -177,8 +177,15 @@ func (s *Server) handleCreateModel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate provider type
-	if req.ProviderType != "anthropic" && req.ProviderType != "openai" && req.ProviderType != "openai-responses" && req.ProviderType != "gemini" {
-		http.Error(w, "provider_type must be 'anthropic', 'openai', 'openai-responses', or 'gemini'", http.StatusBadRequest)
+	switch req.ProviderType {
+	case "anthropic", "openai", "openai-responses", "gemini":
+	case models.ProviderTypeBedrock, models.ProviderTypeVertex:
+		if _, err := models.CloudAnthropicService(req.ProviderType, req.Endpoint, req.APIKey, req.ModelName); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "provider_type must be 'anthropic', 'anthropic-bedrock', 'anthropic-vertex', 'openai', 'openai-responses', or 'gemini'", http.StatusBadRequest)
 		return
 	}
 
@@ -305,6 +312,12 @@ func (s *Server) handleUpdateModel(w http.ResponseWriter, r *http.Request, model
 	if apiKey == "" {
 		apiKey = existing.ApiKey
 	}
+	if req.ProviderType == models.ProviderTypeBedrock || req.ProviderType == models.ProviderTypeVertex {
+		if _, err := models.CloudAnthropicService(req.ProviderType, req.Endpoint, apiKey, req.ModelName); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Default max tokens
 	if req.MaxTokens <= 0 {
@@ -494,6 +507,13 @@ func (s *Server) handleTestModel(w http.ResponseWriter, r *http.Request) {
 			Model:         req.ModelName,
 			ThinkingLevel: llm.ThinkingLevelMedium,
 		}
+	case models.ProviderTypeBedrock, models.ProviderTypeVertex:
+		svc, err := models.CloudAnthropicService(req.ProviderType, req.Endpoint, req.APIKey, req.ModelName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		service = svc
 	case "openai":
 		service = &oai.Service{
 			APIKey:          req.APIKey,
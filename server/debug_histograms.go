@@ -9,12 +9,14 @@ import (
 	"strings"
 
 	"shelley.exe.dev/db"
+	"shelley.exe.dev/llm/llmhttp"
 )
 
 // handleDebugHistograms renders a page summarizing the size distribution of
 // the conversations in the current database: messages per conversation,
 // stored bytes per conversation, the distribution of generations (how many
-// times conversations have been compacted), and message-type counts. It is
+// times conversations have been compacted), and message-type counts, plus
+// the queues of the LLM rate governor. It is
 // the reusable, in-product version of the one-off analysis that informed the
 // /debug/loremipsum size presets, so other users can see their own numbers.
 func (s *Server) handleDebugHistograms(w http.ResponseWriter, r *http.Request) {
@@ -61,6 +63,10 @@ type histogramStats struct {
 
 	// TypeCounts is the total number of messages of each type across the DB.
 	TypeCounts []labelCount `json:"type_counts"`
+
+	// LLMQueues is the rate governor's state for each model this process
+	// has sent requests to. Unlike the rest, it is not from the DB.
+	LLMQueues []llmhttp.GovernorStats `json:"llm_queues"`
 }
 
 type percentiles struct {
@@ -164,6 +170,7 @@ func (s *Server) collectHistogramStats(ctx context.Context) (*histogramStats, er
 	st.Conversations = len(st.MessagesPerConv)
 	st.MessagesPercentiles = computePercentiles(st.MessagesPerConv)
 	st.BytesPercentiles = computePercentiles(st.BytesPerConv)
+	st.LLMQueues = llmhttp.DefaultGovernor.Stats()
 	return st, nil
 }
 
@@ -68,6 +68,11 @@ code { background: var(--bg-secondary, rgba(127,127,127,0.12)); padding: 0.1rem
 <h2>Message types</h2>
 <div class="chart" id="type-chart"></div>
 
+<h2>LLM request queues</h2>
+<div class="note">Requests held back by the rate governor since this server started, per model. Budgets are the provider's last reported rate-limit headers.</div>
+<table id="queue-table"></table>
+<div class="chart" id="queue-chart"></div>
+
 <script>
 const STATS = __STATS_JSON__;
 
@@ -139,6 +144,30 @@ vegaEmbed('#msg-chart', histSpec(STATS.messages_per_conv, 'v', 'messages per con
 vegaEmbed('#bytes-chart', histSpec(STATS.bytes_per_conv, 'v', 'bytes per conversation', true), embedOpts);
 vegaEmbed('#gen-chart', barSpec(STATS.generation_counts, 'generation'), embedOpts);
 vegaEmbed('#type-chart', barSpec(STATS.type_counts, 'message type'), embedOpts);
+
+// Rate governor queues.
+function fmtBudget(remaining, limit) {
+  return limit ? fmtInt(remaining) + ' / ' + fmtInt(limit) : '';
+}
+document.getElementById('queue-table').innerHTML =
+  '<thead><tr><th>model</th><th>in flight</th><th>queued</th><th>sent</th><th>delayed</th>' +
+  '<th>429s</th><th>requests left</th><th>tokens left</th></tr></thead><tbody>' +
+  STATS.llm_queues.map(q => '<tr><td>' + q.key + '</td><td>' + q.in_flight + '</td><td>' + q.queued +
+    '</td><td>' + fmtInt(q.admitted) + '</td><td>' + fmtInt(q.delayed) + '</td><td>' + fmtInt(q.rate_limited) +
+    '</td><td>' + fmtBudget(q.requests_remaining, q.requests_limit) +
+    '</td><td>' + fmtBudget(q.tokens_remaining, q.tokens_limit) + '</td></tr>').join('') +
+  '</tbody>';
+const queueWaits = STATS.llm_queues.flatMap(q => q.waits_ms.map(ms => ({ v: ms, model: q.key })));
+vegaEmbed('#queue-chart', Object.assign({}, chartBase, {
+  $schema: 'https://vega.github.io/schema/vega-lite/v5.json',
+  data: { values: queueWaits },
+  mark: { type: 'bar', tooltip: true },
+  encoding: {
+    x: { field: 'v', bin: { maxbins: 40 }, type: 'quantitative', title: 'queue wait (ms)' },
+    y: { aggregate: 'count', type: 'quantitative', title: 'requests' },
+    color: { field: 'model', type: 'nominal' },
+  },
+}), embedOpts);
 </script>
 </body>
 </html>`
@@ -66,6 +66,9 @@ func TestDebugHistograms(t *testing.T) {
 	if len(st.TypeCounts) == 0 {
 		t.Error("expected message-type counts")
 	}
+	if st.LLMQueues == nil {
+		t.Error("expected llm_queues, even if empty")
+	}
 
 	// HTML output embeds the stats blob.
 	req = httptest.NewRequest("GET", "/debug/histograms", nil)
@@ -130,7 +130,11 @@ func (s *Server) runDistillNewGeneration(ctx context.Context, conversationID, so
 		}
 	}()
 
-	s.performPiDistillation(ctx, conversationID, sourceSlug, modelID, instructions, sourceGeneration, messages)
+	keepRecentTokens := defaultPiDistillSettings.keepRecentTokens
+	if conv, err := s.db.GetConversationByID(ctx, conversationID); err == nil {
+		keepRecentTokens = s.autoCompactSettings(db.ParseConversationOptions(conv.ConversationOptions)).KeepRecentTokens
+	}
+	s.performPiDistillation(ctx, conversationID, sourceSlug, modelID, instructions, sourceGeneration, messages, keepRecentTokens, false)
 	// The new generation's messages carry no usage data yet, so the UI's
 	// context-usage bar would keep showing the pre-distillation size until the
 	// next agent turn. Broadcast an estimate of the new generation's context
@@ -344,7 +348,7 @@ func (s *Server) handleDistillNewGeneration(w http.ResponseWriter, r *http.Reque
 		s.logger.Error("Failed to create status message", "conversationID", req.SourceConversationID, "error", err)
 		// WithoutCancel: a client disconnect mid-setup must not strand the
 		// conversation on the just-created empty generation.
-		s.rollbackCompactionFailure(context.WithoutCancel(ctx), s.logger, req.SourceConversationID, "Compaction failed during setup", sourceGeneration)
+		s.rollbackCompactionFailure(context.WithoutCancel(ctx), s.logger, req.SourceConversationID, "Compaction failed during setup", sourceGeneration, false)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -354,7 +358,7 @@ func (s *Server) handleDistillNewGeneration(w http.ResponseWriter, r *http.Reque
 		s.logger.Error("Failed to hydrate new generation", "conversationID", req.SourceConversationID, "error", err)
 		// WithoutCancel: a client disconnect mid-setup must not strand the
 		// conversation on the just-created empty generation.
-		s.rollbackCompactionFailure(context.WithoutCancel(ctx), s.logger, req.SourceConversationID, "Compaction failed during setup", sourceGeneration)
+		s.rollbackCompactionFailure(context.WithoutCancel(ctx), s.logger, req.SourceConversationID, "Compaction failed during setup", sourceGeneration, false)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -152,7 +152,11 @@ func findPiCutPoint(messages []llm.Message, keepRecentTokens int) int {
 	for i := len(messages) - 1; i >= 0; i-- {
 		accumulated += estimatePiMessageTokens(messages[i])
 		if accumulated >= keepRecentTokens {
-			// Pick the first valid cut point at or after i.
+			// Pick the first valid cut point at or after i. If the budget
+			// ran out inside a trailing tool result (the usual state in the
+			// middle of a turn) there is none; keep the tail from the last
+			// cut point before it instead of keeping everything.
+			cutIndex = cutPoints[len(cutPoints)-1]
 			for _, c := range cutPoints {
 				if c >= i {
 					cutIndex = c
@@ -475,7 +479,13 @@ func (s *Server) generatePiSummary(ctx context.Context, svc llm.Service, older [
 // abandoned generation's rows are not deleted — a later retry re-increments
 // into the same generation number and Hydrate's hasSystemMessage guard
 // prevents a duplicate system prompt.
-func (s *Server) rollbackCompactionFailure(ctx context.Context, logger *slog.Logger, conversationID, errMsg string, sourceGeneration int64) {
+//
+// An automatic compaction (inTurn) runs inside the conversation's live loop,
+// which still holds the restored generation's history, so the loop is left
+// alone and the turn carries on uncompacted.
+func (s *Server) rollbackCompactionFailure(ctx context.Context, logger *slog.Logger, conversationID, errMsg string, sourceGeneration int64, inTurn bool) {
+	// A cancelled turn must still restore the generation.
+	ctx = context.WithoutCancel(ctx)
 	if err := s.db.QueriesTx(ctx, func(q *generated.Queries) error {
 		_, err := q.SetConversationGeneration(ctx, generated.SetConversationGenerationParams{
 			CurrentGeneration: sourceGeneration,
@@ -490,7 +500,7 @@ func (s *Server) rollbackCompactionFailure(ctx context.Context, logger *slog.Log
 	s.mu.Lock()
 	manager, ok := s.activeConversations[conversationID]
 	s.mu.Unlock()
-	if ok {
+	if ok && !inTurn {
 		manager.ResetLoop()
 	}
 	logger.Info("rolled back generation after compaction failure", "generation", sourceGeneration)
@@ -499,8 +509,11 @@ func (s *Server) rollbackCompactionFailure(ctx context.Context, logger *slog.Log
 
 // performPiDistillation summarizes older history and copies recent messages
 // verbatim into the conversation's (already-incremented) new generation. It is
-// the pi-algorithm counterpart to performDistillation.
-func (s *Server) performPiDistillation(ctx context.Context, conversationID, sourceSlug, modelID, instructions string, sourceGeneration int64, messages []generated.Message) string {
+// the pi-algorithm counterpart to performDistillation. keepRecentTokens is
+// the verbatim tail budget (see Server.autoCompactSettings); inTurn marks an
+// automatic compaction running inside the conversation's loop. On failure the
+// generation is rolled back and the error returned.
+func (s *Server) performPiDistillation(ctx context.Context, conversationID, sourceSlug, modelID, instructions string, sourceGeneration int64, messages []generated.Message, keepRecentTokens int, inTurn bool) (string, error) {
 	logger := s.logger.With("conversationID", conversationID, "sourceSlug", sourceSlug, "method", "compact")
 
 	// Tag the ctx so the summarization calls' usage is collected (and so the
@@ -516,21 +529,17 @@ func (s *Server) performPiDistillation(ctx context.Context, conversationID, sour
 		logger.Error("Failed to get LLM service for pi distillation", "model", modelID, "error", err)
 		// The generation was already incremented; roll back so the old
 		// (intact) generation stays active (see rollbackCompactionFailure).
-		s.rollbackCompactionFailure(ctx, logger, conversationID, fmt.Sprintf("Compaction failed: model %q unavailable: %v", modelID, err), sourceGeneration)
-		return ""
+		s.rollbackCompactionFailure(ctx, logger, conversationID, fmt.Sprintf("Compaction failed: model %q unavailable: %v", modelID, err), sourceGeneration, inTurn)
+		return "", err
 	}
 
 	ctxMsgs := piContextMessages(sourceGeneration, messages)
 	if len(ctxMsgs) == 0 {
 		logger.Warn("pi distillation found no context messages")
 		s.insertDistillStatus(ctx, conversationID, "complete")
-		return ""
+		return "", nil
 	}
 
-	keepRecentTokens := defaultPiDistillSettings.keepRecentTokens
-	if s.piDistillKeepRecentTokens > 0 {
-		keepRecentTokens = s.piDistillKeepRecentTokens
-	}
 	llmMsgs := make([]llm.Message, len(ctxMsgs))
 	for i, entry := range ctxMsgs {
 		llmMsgs[i] = entry.llm
@@ -584,8 +593,8 @@ func (s *Server) performPiDistillation(ctx context.Context, conversationID, sour
 			// the conversation's context (and any fork of it) would be wiped.
 			// Roll back to the old generation so the failure is loud but
 			// harmless.
-			s.rollbackCompactionFailure(ctx, logger, conversationID, fmt.Sprintf("Compaction failed: %v", err), sourceGeneration)
-			return ""
+			s.rollbackCompactionFailure(ctx, logger, conversationID, fmt.Sprintf("Compaction failed: %v", err), sourceGeneration, inTurn)
+			return "", err
 		}
 	}
 
@@ -650,7 +659,7 @@ func (s *Server) performPiDistillation(ctx context.Context, conversationID, sour
 			ud = map[string]string{}
 		}
 		ud["compaction_carried"] = "true"
-		batch = append(batch, recordMessageInput{message: entry.llm, userData: []interface{}{ud}})
+		batch = append(batch, recordMessageInput{message: entry.llm, userData: []interface{}{ud}, replay: true})
 	}
 
 	// Append the terminal "complete" status message as an additional INSERT in
@@ -672,12 +681,12 @@ func (s *Server) performPiDistillation(ctx context.Context, conversationID, sour
 	if rerr := s.recordMessages(ctx, conversationID, batch); rerr != nil {
 		logger.Error("Failed to record compaction messages", "error", rerr)
 		// Same empty-new-generation hazard as a summarization failure.
-		s.rollbackCompactionFailure(ctx, logger, conversationID, fmt.Sprintf("Compaction failed: could not record messages: %v", rerr), sourceGeneration)
-		return ""
+		s.rollbackCompactionFailure(ctx, logger, conversationID, fmt.Sprintf("Compaction failed: could not record messages: %v", rerr), sourceGeneration, inTurn)
+		return "", rerr
 	}
 	if !foldedStatus {
 		s.insertDistillStatus(ctx, conversationID, "complete")
 	}
 	logger.Info("pi distillation complete", "summary_length", len(summary), "kept_messages", len(recent))
-	return summary
+	return summary, nil
 }
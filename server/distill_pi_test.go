@@ -53,6 +53,19 @@ func TestFindPiCutPointNeverLandsOnToolResult(t *testing.T) {
 	}
 }
 
+func TestFindPiCutPointTrailingToolResult(t *testing.T) {
+	msgs := []llm.Message{
+		textMsg(llm.MessageRoleUser, "run it"),
+		{Role: llm.MessageRoleAssistant, Content: []llm.Content{{Type: llm.ContentTypeToolUse, ToolName: "bash", ToolInput: json.RawMessage(`{}`)}}},
+		toolResultMsg(strings.Repeat("x", 4000)),
+	}
+	// The budget is exhausted inside the tool result: keep the tool call
+	// and its result, summarize what came before.
+	if cut := findPiCutPoint(msgs, 10); cut != 1 {
+		t.Fatalf("expected cut=1, got %d", cut)
+	}
+}
+
 func TestFindPiCutPointKeepsAllWhenSmall(t *testing.T) {
 	msgs := []llm.Message{
 		textMsg(llm.MessageRoleUser, "hi"),
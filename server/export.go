@@ -0,0 +1,710 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+	"shelley.exe.dev/llm"
+	"shelley.exe.dev/transcripts"
+)
+
+// conversationExportFormat and conversationExportVersion identify the JSON
+// export, which is also what POST /api/conversations/import accepts.
+const (
+	conversationExportFormat  = "shelley-conversation"
+	conversationExportVersion = 1
+
+	// maxImportBytes caps the body of POST /api/conversations/import.
+	maxImportBytes = 256 << 20
+)
+
+// ConversationExport is the JSON export of a conversation.
+type ConversationExport struct {
+	Format       string                `json:"format"`
+	Version      int                   `json:"version"`
+	ExportedAt   time.Time             `json:"exported_at"`
+	Conversation *ExportedConversation `json:"conversation"`
+}
+
+// ExportedConversation is a conversation with its messages and, nested, its
+// subagent conversations.
+type ExportedConversation struct {
+	ConversationID      string            `json:"conversation_id"`
+	Slug                *string           `json:"slug,omitempty"`
+	Cwd                 *string           `json:"cwd,omitempty"`
+	Model               *string           `json:"model,omitempty"`
+	ConversationOptions json.RawMessage   `json:"conversation_options,omitempty"`
+	Tags                []string          `json:"tags,omitempty"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+	Messages            []ExportedMessage `json:"messages"`
+	// Usage totals the LLM calls of this conversation; TotalUsage adds
+	// those of its subagents. Both are ignored on import.
+	Usage      llm.Usage               `json:"usage"`
+	TotalUsage llm.Usage               `json:"total_usage"`
+	Subagents  []*ExportedConversation `json:"subagents,omitempty"`
+}
+
+// ExportedMessage is a message as stored, with its JSON columns inline.
+type ExportedMessage struct {
+	MessageID           string          `json:"message_id"`
+	SequenceID          int64           `json:"sequence_id"`
+	Type                string          `json:"type"`
+	Generation          int64           `json:"generation"`
+	CreatedAt           time.Time       `json:"created_at"`
+	ExcludedFromContext bool            `json:"excluded_from_context,omitempty"`
+	LLMData             json.RawMessage `json:"llm_data,omitempty"`
+	UserData            json.RawMessage `json:"user_data,omitempty"`
+	UsageData           json.RawMessage `json:"usage_data,omitempty"`
+	DisplayData         json.RawMessage `json:"display_data,omitempty"`
+	OtherUsageData      json.RawMessage `json:"other_usage_data,omitempty"`
+	ModelName           string          `json:"model_name,omitempty"`
+	LLMAPIURL           string          `json:"llm_api_url,omitempty"`
+	UserEmail           string          `json:"user_email,omitempty"`
+}
+
+// handleExportConversation handles GET /api/conversation/<id>/export. The
+// format query parameter picks markdown (the default), json or html.
+func (s *Server) handleExportConversation(w http.ResponseWriter, r *http.Request, conversationID string) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "markdown"
+	}
+	var contentType, ext string
+	switch format {
+	case "markdown", "md":
+		contentType, ext = "text/markdown; charset=utf-8", "md"
+	case "json":
+		contentType, ext = "application/json", "json"
+	case "html":
+		contentType, ext = "text/html; charset=utf-8", "html"
+	default:
+		http.Error(w, "format must be markdown, json or html", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	conv, err := s.db.GetConversationByID(ctx, conversationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to get conversation", "conversationID", conversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	exported, err := s.buildConversationExport(ctx, *conv)
+	if err != nil {
+		s.logger.Error("Failed to export conversation", "conversationID", conversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	name := conversationID
+	if conv.Slug != nil && *conv.Slug != "" {
+		name = *conv.Slug
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+ext))
+	switch ext {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(ConversationExport{
+			Format:       conversationExportFormat,
+			Version:      conversationExportVersion,
+			ExportedAt:   time.Now().UTC(),
+			Conversation: exported,
+		})
+	case "md":
+		io.WriteString(w, renderMarkdownTranscript(exported))
+	case "html":
+		if err := renderHTMLTranscript(w, exported); err != nil {
+			s.logger.Error("Failed to render HTML export", "conversationID", conversationID, "error", err)
+		}
+	}
+}
+
+// buildConversationExport loads conv's messages and, recursively, its
+// subagents.
+func (s *Server) buildConversationExport(ctx context.Context, conv generated.Conversation) (*ExportedConversation, error) {
+	exported := &ExportedConversation{
+		ConversationID: conv.ConversationID,
+		Slug:           conv.Slug,
+		Cwd:            conv.Cwd,
+		Model:          conv.Model,
+		CreatedAt:      conv.CreatedAt,
+		UpdatedAt:      conv.UpdatedAt,
+		Messages:       []ExportedMessage{},
+	}
+	if conv.ConversationOptions != "" && conv.ConversationOptions != "{}" {
+		exported.ConversationOptions = json.RawMessage(conv.ConversationOptions)
+	}
+	if conv.Tags != "" {
+		json.Unmarshal([]byte(conv.Tags), &exported.Tags)
+	}
+
+	msgs, err := s.db.ListMessages(ctx, conv.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("listing messages: %w", err)
+	}
+	for _, m := range msgs {
+		em := ExportedMessage{
+			MessageID:           m.MessageID,
+			SequenceID:          m.SequenceID,
+			Type:                m.Type,
+			Generation:          m.Generation,
+			CreatedAt:           m.CreatedAt,
+			ExcludedFromContext: m.ExcludedFromContext,
+			LLMData:             rawJSON(m.LlmData),
+			UserData:            rawJSON(m.UserData),
+			UsageData:           rawJSON(m.UsageData),
+			DisplayData:         rawJSON(m.DisplayData),
+			OtherUsageData:      rawJSON(m.OtherUsageData),
+		}
+		if m.ModelName != nil {
+			em.ModelName = *m.ModelName
+		}
+		if m.LlmApiUrl != nil {
+			em.LLMAPIURL = *m.LlmApiUrl
+		}
+		if m.UserEmail != nil {
+			em.UserEmail = *m.UserEmail
+		}
+		exported.Messages = append(exported.Messages, em)
+		exported.Usage.Add(messageUsage(em))
+	}
+	exported.TotalUsage = exported.Usage
+
+	subagents, err := s.db.GetSubagents(ctx, conv.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("listing subagents: %w", err)
+	}
+	for _, sub := range subagents {
+		child, err := s.buildConversationExport(ctx, sub)
+		if err != nil {
+			return nil, err
+		}
+		exported.Subagents = append(exported.Subagents, child)
+		exported.TotalUsage.Add(child.TotalUsage)
+	}
+	return exported, nil
+}
+
+// messageUsage is the usage of a message's own LLM call plus the indirect
+// calls affiliated with it.
+func messageUsage(m ExportedMessage) llm.Usage {
+	var total llm.Usage
+	if len(m.UsageData) > 0 {
+		var u llm.Usage
+		if json.Unmarshal(m.UsageData, &u) == nil {
+			total.Add(u)
+		}
+	}
+	if len(m.OtherUsageData) > 0 {
+		var others []llm.PurposedUsage
+		if json.Unmarshal(m.OtherUsageData, &others) == nil {
+			for _, u := range others {
+				total.Add(u.Usage)
+			}
+		}
+	}
+	return total
+}
+
+func rawJSON(s *string) json.RawMessage {
+	if s == nil || *s == "" || *s == "null" {
+		return nil
+	}
+	return json.RawMessage(*s)
+}
+
+// handleImportConversation handles POST /api/conversations/import. It
+// recreates a conversation, with new ids, from its JSON export or from
+// another agent's session log. The format query parameter names the format
+// (shelley or one of transcripts.Formats); by default it is detected.
+func (s *Server) handleImportConversation(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Import larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "shelley"
+		if detected, ok := transcripts.Detect(body); ok {
+			format = string(detected)
+		}
+	}
+
+	var params db.ImportConversationParams
+	if format == "shelley" {
+		var export ConversationExport
+		if err := json.Unmarshal(body, &export); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if export.Format != conversationExportFormat || export.Conversation == nil {
+			http.Error(w, fmt.Sprintf("Not a %s export", conversationExportFormat), http.StatusBadRequest)
+			return
+		}
+		if export.Version != conversationExportVersion {
+			http.Error(w, fmt.Sprintf("Unsupported export version %d", export.Version), http.StatusBadRequest)
+			return
+		}
+		params = importParams(export.Conversation)
+	} else {
+		params, err = transcripts.Parse(transcripts.Format(format), bytes.NewReader(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if msg := validateImport(params); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	conv, err := s.db.ImportConversation(ctx, params)
+	if err != nil {
+		s.logger.Error("Failed to import conversation", "format", format, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	go s.publishConversationListUpdate(ConversationListUpdate{Type: "update", Conversation: conv})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(conv)
+}
+
+// validateImport checks what an import would store that conversations
+// created through the API are checked for: each conversation's options,
+// as validateConversationOptions does, and its message types.
+func validateImport(params db.ImportConversationParams) string {
+	if params.ConversationOptions != "" {
+		var opts db.ConversationOptions
+		if err := json.Unmarshal([]byte(params.ConversationOptions), &opts); err != nil {
+			return fmt.Sprintf("Invalid conversation_options: %v", err)
+		}
+		if msg := validateConversationOptions(opts); msg != "" {
+			return msg
+		}
+	}
+	for _, m := range params.Messages {
+		if !slices.Contains(importableMessageTypes, m.Type) {
+			return fmt.Sprintf("Invalid message type %q", m.Type)
+		}
+	}
+	for _, sub := range params.Subagents {
+		if msg := validateImport(sub); msg != "" {
+			return "Subagent: " + msg
+		}
+	}
+	return ""
+}
+
+// importableMessageTypes are the message types an import may contain.
+var importableMessageTypes = []db.MessageType{
+	db.MessageTypeUser,
+	db.MessageTypeAgent,
+	db.MessageTypeTool,
+	db.MessageTypeSystem,
+	db.MessageTypeError,
+	db.MessageTypeGitInfo,
+	db.MessageTypeWarning,
+	db.MessageTypeModelChange,
+	db.MessageTypeSlug,
+}
+
+func importParams(c *ExportedConversation) db.ImportConversationParams {
+	params := db.ImportConversationParams{
+		Slug:                c.Slug,
+		Cwd:                 c.Cwd,
+		Model:               c.Model,
+		ConversationOptions: string(c.ConversationOptions),
+		Tags:                c.Tags,
+	}
+	for _, m := range c.Messages {
+		createdAt := m.CreatedAt
+		params.Messages = append(params.Messages, db.ImportedMessage{
+			CreateMessageParams: db.CreateMessageParams{
+				Type:                db.MessageType(m.Type),
+				LLMData:             rawOrNil(m.LLMData),
+				UserData:            rawOrNil(m.UserData),
+				UsageData:           rawOrNil(m.UsageData),
+				DisplayData:         rawOrNil(m.DisplayData),
+				OtherUsageData:      rawOrNil(m.OtherUsageData),
+				LLMAPIURL:           m.LLMAPIURL,
+				ModelName:           m.ModelName,
+				UserEmail:           m.UserEmail,
+				ExcludedFromContext: m.ExcludedFromContext,
+				CreatedAt:           &createdAt,
+			},
+			Generation: m.Generation,
+		})
+	}
+	for _, sub := range c.Subagents {
+		params.Subagents = append(params.Subagents, importParams(sub))
+	}
+	return params
+}
+
+// rawOrNil keeps an absent JSON column NULL: a nil json.RawMessage in an
+// interface would be stored as the JSON null.
+func rawOrNil(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
+
+// transcriptEntry is one message of a rendered transcript.
+type transcriptEntry struct {
+	Heading string
+	Time    time.Time
+	// Generation is set on the first message of every generation after the
+	// first, where the transcript shows a divider.
+	Generation int64
+	Collapsed  bool
+	Blocks     []transcriptBlock
+}
+
+// transcriptBlock is one piece of a message's content.
+type transcriptBlock struct {
+	Kind      string // text, thinking, tool_use, tool_result or image
+	Label     string // the tool name
+	Text      string
+	Error     bool
+	MediaType string
+	Data      string // base64 image data
+}
+
+var imageMediaType = regexp.MustCompile(`^image/[a-z0-9.+-]+$`)
+
+// ImageURL is the image as a data URI, for the HTML transcript.
+func (b transcriptBlock) ImageURL() template.URL {
+	if !imageMediaType.MatchString(b.MediaType) {
+		return ""
+	}
+	return template.URL("data:" + b.MediaType + ";base64," + b.Data)
+}
+
+// transcriptEntries turns c's messages into transcript entries, skipping
+// bookkeeping messages (slug and git info).
+func transcriptEntries(c *ExportedConversation) []transcriptEntry {
+	var entries []transcriptEntry
+	toolNames := map[string]string{}
+	var generation int64
+	for i, m := range c.Messages {
+		entry := transcriptEntry{Time: m.CreatedAt}
+		if i > 0 && m.Generation != generation {
+			entry.Generation = m.Generation
+		}
+		generation = m.Generation
+
+		var msg llm.Message
+		if len(m.LLMData) > 0 {
+			json.Unmarshal(m.LLMData, &msg)
+		}
+		switch db.MessageType(m.Type) {
+		case db.MessageTypeSlug, db.MessageTypeGitInfo:
+			continue
+		case db.MessageTypeSystem:
+			entry.Heading = "System prompt"
+			entry.Collapsed = true
+			entry.Blocks = contentBlocks(msg.Content, toolNames)
+		case db.MessageTypeModelChange:
+			var data ModelChangeUserData
+			json.Unmarshal(m.UserData, &data)
+			entry.Heading = "Model change"
+			entry.Blocks = []transcriptBlock{{Kind: "text", Text: data.Text}}
+		case db.MessageTypeWarning, db.MessageTypeError:
+			entry.Heading = "Warning"
+			if m.Type == string(db.MessageTypeError) {
+				entry.Heading = "Error"
+			}
+			entry.Blocks = contentBlocks(msg.Content, toolNames)
+			if len(entry.Blocks) == 0 {
+				var data struct {
+					Text string `json:"text"`
+				}
+				json.Unmarshal(m.UserData, &data)
+				entry.Blocks = []transcriptBlock{{Kind: "text", Text: data.Text}}
+			}
+		default:
+			entry.Heading = transcriptHeading(m, msg)
+			entry.Blocks = contentBlocks(msg.Content, toolNames)
+		}
+		if len(entry.Blocks) == 0 {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func transcriptHeading(m ExportedMessage, msg llm.Message) string {
+	switch db.MessageType(m.Type) {
+	case db.MessageTypeAgent:
+		if m.ModelName != "" {
+			return "Agent (" + m.ModelName + ")"
+		}
+		return "Agent"
+	case db.MessageTypeUser:
+		for _, c := range msg.Content {
+			if c.Type != llm.ContentTypeToolResult {
+				return "User"
+			}
+		}
+		return "Tool results"
+	case db.MessageTypeTool:
+		return "Tool results"
+	}
+	return m.Type
+}
+
+func contentBlocks(contents []llm.Content, toolNames map[string]string) []transcriptBlock {
+	var blocks []transcriptBlock
+	for _, c := range contents {
+		switch c.Type {
+		case llm.ContentTypeText:
+			if c.MediaType != "" && c.Data != "" {
+				blocks = append(blocks, transcriptBlock{Kind: "image", MediaType: c.MediaType, Data: c.Data})
+			} else if c.Text != "" {
+				blocks = append(blocks, transcriptBlock{Kind: "text", Text: c.Text})
+			}
+		case llm.ContentTypeThinking:
+			if c.Thinking != "" {
+				blocks = append(blocks, transcriptBlock{Kind: "thinking", Text: c.Thinking})
+			}
+		case llm.ContentTypeToolUse, llm.ContentTypeServerToolUse:
+			toolNames[c.ID] = c.ToolName
+			blocks = append(blocks, transcriptBlock{Kind: "tool_use", Label: c.ToolName, Text: prettyJSON(c.ToolInput)})
+		case llm.ContentTypeToolResult, llm.ContentTypeWebSearchToolResult:
+			result := transcriptBlock{Kind: "tool_result", Label: toolNames[c.ToolUseID], Error: c.ToolError}
+			var texts []string
+			var images []transcriptBlock
+			for _, r := range c.ToolResult {
+				switch {
+				case r.MediaType != "" && r.Data != "":
+					images = append(images, transcriptBlock{Kind: "image", MediaType: r.MediaType, Data: r.Data})
+				case r.Type == llm.ContentTypeWebSearchResult:
+					texts = append(texts, r.Title+" — "+r.URL)
+				case r.Text != "":
+					texts = append(texts, r.Text)
+				}
+			}
+			result.Text = strings.Join(texts, "\n")
+			blocks = append(blocks, result)
+			blocks = append(blocks, images...)
+		}
+	}
+	return blocks
+}
+
+func prettyJSON(data json.RawMessage) string {
+	var v any
+	if json.Unmarshal(data, &v) != nil {
+		return string(data)
+	}
+	pretty, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return string(data)
+	}
+	return string(pretty)
+}
+
+func formatExportUsage(u llm.Usage) string {
+	return fmt.Sprintf("%d input tokens (%d cache write, %d cache read), %d output tokens, $%.4f",
+		u.InputTokens, u.CacheCreationInputTokens, u.CacheReadInputTokens, u.OutputTokens, u.CostUSD)
+}
+
+func exportTitle(c *ExportedConversation) string {
+	if c.Slug != nil && *c.Slug != "" {
+		return *c.Slug
+	}
+	return c.ConversationID
+}
+
+// renderMarkdownTranscript renders c, with its subagents nested as deeper
+// sections.
+func renderMarkdownTranscript(c *ExportedConversation) string {
+	var b strings.Builder
+	writeMarkdownConversation(&b, c, 1)
+	return b.String()
+}
+
+func writeMarkdownConversation(b *strings.Builder, c *ExportedConversation, level int) {
+	heading := func(level int) string { return strings.Repeat("#", min(level, 6)) }
+
+	fmt.Fprintf(b, "%s %s\n\n", heading(level), exportTitle(c))
+	fmt.Fprintf(b, "- Conversation: `%s`\n", c.ConversationID)
+	if c.Model != nil {
+		fmt.Fprintf(b, "- Model: %s\n", *c.Model)
+	}
+	if c.Cwd != nil {
+		fmt.Fprintf(b, "- Working directory: `%s`\n", *c.Cwd)
+	}
+	fmt.Fprintf(b, "- Created: %s\n", c.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(b, "- Usage: %s\n", formatExportUsage(c.Usage))
+	if len(c.Subagents) > 0 {
+		fmt.Fprintf(b, "- Usage including subagents: %s\n", formatExportUsage(c.TotalUsage))
+	}
+	b.WriteString("\n")
+
+	for _, e := range transcriptEntries(c) {
+		if e.Generation != 0 {
+			fmt.Fprintf(b, "---\n\n*Generation %d*\n\n", e.Generation)
+		}
+		if e.Collapsed {
+			fmt.Fprintf(b, "<details><summary>%s</summary>\n\n", e.Heading)
+		} else {
+			fmt.Fprintf(b, "%s %s · %s\n\n", heading(level+1), e.Heading, e.Time.UTC().Format(time.RFC3339))
+		}
+		for _, block := range e.Blocks {
+			switch block.Kind {
+			case "text":
+				b.WriteString(block.Text + "\n\n")
+			case "thinking":
+				b.WriteString("> *Thinking*\n>\n")
+				for _, line := range strings.Split(block.Text, "\n") {
+					b.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+				}
+				b.WriteString("\n")
+			case "tool_use":
+				fmt.Fprintf(b, "**Tool call: %s**\n\n", block.Label)
+				writeFenced(b, "json", block.Text)
+			case "tool_result":
+				title := "Tool result"
+				if block.Label != "" {
+					title += ": " + block.Label
+				}
+				if block.Error {
+					title += " (error)"
+				}
+				fmt.Fprintf(b, "**%s**\n\n", title)
+				writeFenced(b, "", block.Text)
+			case "image":
+				fmt.Fprintf(b, "*[image: %s, %d bytes]*\n\n", block.MediaType, base64Len(block.Data))
+			}
+		}
+		if e.Collapsed {
+			b.WriteString("</details>\n\n")
+		}
+	}
+
+	for _, sub := range c.Subagents {
+		writeMarkdownConversation(b, sub, level+1)
+	}
+}
+
+// base64Len is the decoded length of the base64 data.
+func base64Len(data string) int {
+	padding := strings.Count(data[max(0, len(data)-2):], "=")
+	return len(data)*3/4 - padding
+}
+
+// writeFenced writes text as a code block, with a fence longer than any
+// run of backticks in it.
+func writeFenced(b *strings.Builder, lang, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n\n", fence, lang, strings.TrimRight(text, "\n"), fence)
+}
+
+type htmlTranscript struct {
+	*ExportedConversation
+	Title   string
+	Entries []transcriptEntry
+	Nested  []htmlTranscript
+}
+
+func newHTMLTranscript(c *ExportedConversation) htmlTranscript {
+	t := htmlTranscript{ExportedConversation: c, Title: exportTitle(c), Entries: transcriptEntries(c)}
+	for _, sub := range c.Subagents {
+		t.Nested = append(t.Nested, newHTMLTranscript(sub))
+	}
+	return t
+}
+
+// renderHTMLTranscript writes c as a self-contained HTML page, images
+// inlined.
+func renderHTMLTranscript(w io.Writer, c *ExportedConversation) error {
+	return transcriptTemplate.Execute(w, newHTMLTranscript(c))
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"usage": formatExportUsage,
+	"rfc3339": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; color: #1a1a1a; }
+.meta { color: #555; font-size: 0.9rem; }
+.entry { border-left: 3px solid #ccc; margin: 1rem 0; padding: 0.25rem 0 0.25rem 1rem; }
+.entry h3 { font-size: 0.95rem; margin: 0 0 0.5rem; }
+.entry h3 time { color: #777; font-weight: normal; }
+.text { white-space: pre-wrap; }
+.thinking { white-space: pre-wrap; color: #666; font-style: italic; }
+pre { background: #f5f5f5; padding: 0.5rem; overflow-x: auto; white-space: pre-wrap; }
+.tool-error pre { background: #fff0f0; }
+img { max-width: 100%; }
+.subagent { margin-left: 1.5rem; border-top: 1px dashed #aaa; }
+p.generation { color: #777; font-style: italic; }
+</style>
+</head>
+<body>
+{{template "conversation" .}}
+</body>
+</html>
+{{define "conversation"}}
+<section>
+<h2>{{.Title}}</h2>
+<p class="meta">
+Conversation <code>{{.ConversationID}}</code>{{if .Model}} · {{.Model}}{{end}}{{if .Cwd}} · <code>{{.Cwd}}</code>{{end}} · {{rfc3339 .CreatedAt}}<br>
+Usage: {{usage .Usage}}{{if .Nested}}<br>Usage including subagents: {{usage .TotalUsage}}{{end}}
+</p>
+{{range .Entries}}
+{{if .Generation}}<hr><p class="generation">Generation {{.Generation}}</p>{{end}}
+{{if .Collapsed}}<details class="entry"><summary>{{.Heading}}</summary>{{else}}<div class="entry"><h3>{{.Heading}} <time>{{rfc3339 .Time}}</time></h3>{{end}}
+{{range .Blocks}}
+{{if eq .Kind "text"}}<div class="text">{{.Text}}</div>
+{{else if eq .Kind "thinking"}}<div class="thinking">{{.Text}}</div>
+{{else if eq .Kind "tool_use"}}<div class="tool-use"><strong>Tool call: {{.Label}}</strong><pre>{{.Text}}</pre></div>
+{{else if eq .Kind "tool_result"}}<div class="tool-result{{if .Error}} tool-error{{end}}"><strong>Tool result{{if .Label}}: {{.Label}}{{end}}{{if .Error}} (error){{end}}</strong><pre>{{.Text}}</pre></div>
+{{else if eq .Kind "image"}}<img src="{{.ImageURL}}" alt="image">
+{{end}}
+{{end}}
+{{if .Collapsed}}</details>{{else}}</div>{{end}}
+{{end}}
+{{range .Nested}}<div class="subagent">{{template "conversation" .}}</div>{{end}}
+</section>
+{{end}}`))
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+	"shelley.exe.dev/llm"
+)
+
+// seedExportConversation creates a conversation with a tool call, a tool
+// result carrying an image, and a subagent.
+func seedExportConversation(t *testing.T, database *db.DB) *generated.Conversation {
+	t.Helper()
+	ctx := context.Background()
+	model := "predictable"
+	slug := "export-me"
+	conv, err := database.CreateConversation(ctx, &slug, true, nil, &model, db.ConversationOptions{})
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	add := func(conversationID string, typ db.MessageType, msg llm.Message, usage *llm.Usage) {
+		t.Helper()
+		params := db.CreateMessageParams{ConversationID: conversationID, Type: typ, LLMData: msg}
+		if usage != nil {
+			params.UsageData = usage
+		}
+		if _, err := database.CreateMessage(ctx, params); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+	}
+	add(conv.ConversationID, db.MessageTypeUser, makeForkTestMessage("list the files"), nil)
+	add(conv.ConversationID, db.MessageTypeAgent, llm.Message{
+		Role: llm.MessageRoleAssistant,
+		Content: []llm.Content{
+			{Type: llm.ContentTypeText, Text: "Listing them."},
+			{Type: llm.ContentTypeToolUse, ID: "tu1", ToolName: "bash", ToolInput: json.RawMessage(`{"command":"ls"}`)},
+		},
+	}, &llm.Usage{InputTokens: 100, OutputTokens: 10, CostUSD: 0.5})
+	add(conv.ConversationID, db.MessageTypeUser, llm.Message{
+		Role: llm.MessageRoleUser,
+		Content: []llm.Content{{
+			Type:      llm.ContentTypeToolResult,
+			ToolUseID: "tu1",
+			ToolResult: []llm.Content{
+				{Type: llm.ContentTypeText, Text: "main.go\n```go.mod```"},
+				{Type: llm.ContentTypeText, MediaType: "image/png", Data: "iVBORw0KGgo="},
+			},
+		}},
+	}, nil)
+
+	sub, err := database.CreateSubagentConversation(ctx, "helper", conv.ConversationID, nil)
+	if err != nil {
+		t.Fatalf("create subagent: %v", err)
+	}
+	add(sub.ConversationID, db.MessageTypeUser, makeForkTestMessage("help out"), nil)
+	add(sub.ConversationID, db.MessageTypeAgent, llm.Message{
+		Role:    llm.MessageRoleAssistant,
+		Content: []llm.Content{{Type: llm.ContentTypeText, Text: "Done helping."}},
+	}, &llm.Usage{InputTokens: 20, OutputTokens: 2, CostUSD: 0.25})
+	return conv
+}
+
+func exportConversation(t *testing.T, server *Server, conversationID, format string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/conversation/"+conversationID+"/export?format="+format, nil)
+	w := httptest.NewRecorder()
+	server.handleExportConversation(w, req, conversationID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export %s: status=%d body=%s", format, w.Code, w.Body.String())
+	}
+	return w
+}
+
+func TestExportConversationFormats(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	conv := seedExportConversation(t, database)
+
+	w := exportConversation(t, server, conv.ConversationID, "json")
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="export-me.json"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	var export ConversationExport
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatalf("decode export: %v", err)
+	}
+	c := export.Conversation
+	if export.Format != conversationExportFormat || len(c.Messages) != 3 || len(c.Subagents) != 1 || len(c.Subagents[0].Messages) != 2 {
+		t.Fatalf("export = %+v", export)
+	}
+	if c.Usage.InputTokens != 100 || c.Usage.CostUSD != 0.5 || c.TotalUsage.InputTokens != 120 || c.TotalUsage.CostUSD != 0.75 {
+		t.Errorf("usage = %+v, total = %+v", c.Usage, c.TotalUsage)
+	}
+
+	md := exportConversation(t, server, conv.ConversationID, "markdown").Body.String()
+	for _, want := range []string{
+		"# export-me\n",
+		"**Tool call: bash**",
+		`"command": "ls"`,
+		"**Tool result: bash**\n\n````\nmain.go\n```go.mod```\n````",
+		"*[image: image/png, 8 bytes]*",
+		"## helper\n",
+		"### Agent",
+		"Done helping.",
+		"Usage including subagents: 120 input tokens",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown lacks %q:\n%s", want, md)
+		}
+	}
+
+	html := exportConversation(t, server, conv.ConversationID, "html").Body.String()
+	for _, want := range []string{
+		`<img src="data:image/png;base64,iVBORw0KGgo=" alt="image">`,
+		"Tool call: bash",
+		"Done helping.",
+		`<div class="subagent">`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("html lacks %q", want)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/conversation/"+conv.ConversationID+"/export?format=pdf", nil)
+	bad := httptest.NewRecorder()
+	server.handleExportConversation(bad, req, conv.ConversationID)
+	if bad.Code != http.StatusBadRequest {
+		t.Errorf("unknown format status = %d", bad.Code)
+	}
+}
+
+func TestImportConversationRoundTrip(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	ctx := context.Background()
+	conv := seedExportConversation(t, database)
+
+	var export ConversationExport
+	json.Unmarshal(exportConversation(t, server, conv.ConversationID, "json").Body.Bytes(), &export)
+	// The last message belongs to a later generation, as after a compaction.
+	export.Conversation.Messages[2].Generation = 2
+	body, _ := json.Marshal(export)
+
+	req := httptest.NewRequest("POST", "/api/conversations/import", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	server.handleImportConversation(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var imported generated.Conversation
+	if err := json.Unmarshal(w.Body.Bytes(), &imported); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if imported.ConversationID == conv.ConversationID {
+		t.Fatal("imported conversation should have a new id")
+	}
+	if imported.Slug == nil || *imported.Slug != "export-me-imported" {
+		t.Errorf("slug = %v, want export-me-imported", imported.Slug)
+	}
+	if imported.CurrentGeneration != 2 {
+		t.Errorf("current generation = %d, want 2", imported.CurrentGeneration)
+	}
+
+	msgs, err := database.ListMessages(ctx, imported.ConversationID)
+	if err != nil {
+		t.Fatalf("list messages: %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("imported %d messages, want 3", len(msgs))
+	}
+	for i, m := range msgs {
+		orig := export.Conversation.Messages[i]
+		if m.MessageID == orig.MessageID || m.Type != orig.Type || m.Generation != orig.Generation || !m.CreatedAt.Equal(orig.CreatedAt) {
+			t.Errorf("message %d = %+v, exported %+v", i, m, orig)
+		}
+		if (m.UsageData == nil) != (orig.UsageData == nil) {
+			t.Errorf("message %d usage = %v, exported %s", i, m.UsageData, orig.UsageData)
+		}
+	}
+
+	subs, err := database.GetSubagents(ctx, imported.ConversationID)
+	if err != nil {
+		t.Fatalf("get subagents: %v", err)
+	}
+	if len(subs) != 1 || subs[0].UserInitiated {
+		t.Fatalf("subagents = %+v", subs)
+	}
+	subMsgs, _ := database.ListMessages(ctx, subs[0].ConversationID)
+	if len(subMsgs) != 2 {
+		t.Errorf("subagent has %d messages, want 2", len(subMsgs))
+	}
+
+	req = httptest.NewRequest("POST", "/api/conversations/import", strings.NewReader(`{"format":"something-else"}`))
+	w = httptest.NewRecorder()
+	server.handleImportConversation(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("foreign format status = %d", w.Code)
+	}
+}
+
+func TestImportConversationRejectsInvalid(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	conv := seedExportConversation(t, database)
+	var export ConversationExport
+	json.Unmarshal(exportConversation(t, server, conv.ConversationID, "json").Body.Bytes(), &export)
+	before, err := database.ListConversations(context.Background(), 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importBody := func(edit func(*ExportedConversation)) string {
+		var e ConversationExport
+		data, _ := json.Marshal(export)
+		json.Unmarshal(data, &e)
+		edit(e.Conversation)
+		data, _ = json.Marshal(e)
+		return string(data)
+	}
+	for name, body := range map[string]string{
+		"options": importBody(func(c *ExportedConversation) {
+			c.ConversationOptions = json.RawMessage(`{"tool_overrides":{"bash":"maybe"}}`)
+		}),
+		"subagent options": importBody(func(c *ExportedConversation) {
+			c.Subagents[0].ConversationOptions = json.RawMessage(`{"sandbox":{"enabled":true,"writable":["relative"]}}`)
+		}),
+		"malformed options": importBody(func(c *ExportedConversation) {
+			c.ConversationOptions = json.RawMessage(`[]`)
+		}),
+		"message type": importBody(func(c *ExportedConversation) {
+			c.Messages[0].Type = "bogus"
+		}),
+	} {
+		w := httptest.NewRecorder()
+		server.handleImportConversation(w, httptest.NewRequest("POST", "/api/conversations/import", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d body=%s", name, w.Code, w.Body.String())
+		}
+	}
+
+	after, err := database.ListConversations(context.Background(), 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("rejected imports created conversations: %d before, %d after", len(before), len(after))
+	}
+}
+
+func TestImportClaudeCodeTranscript(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	ctx := context.Background()
+
+	log := `{"type":"user","sessionId":"s1","cwd":"/nonexistent","timestamp":"2026-03-01T10:00:00Z","message":{"role":"user","content":"why does the frobnicator leak"}}
+{"type":"assistant","sessionId":"s1","timestamp":"2026-03-01T10:00:01Z","message":{"id":"m1","role":"assistant","content":[{"type":"text","text":"It never closes its quuxfile."}]}}
+`
+	req := httptest.NewRequest("POST", "/api/conversations/import", strings.NewReader(log))
+	w := httptest.NewRecorder()
+	server.handleImportConversation(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var imported generated.Conversation
+	if err := json.Unmarshal(w.Body.Bytes(), &imported); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if imported.Tags != `["claude-code"]` || imported.Model != nil {
+		t.Errorf("imported = %+v", imported)
+	}
+
+	results, err := database.SearchConversationsFTS(ctx, "quuxfile", 10, 0)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 1 || results[0].ConversationID != imported.ConversationID {
+		t.Errorf("search results = %+v", results)
+	}
+
+	req = httptest.NewRequest("POST", "/api/conversations/import?format=codex", strings.NewReader(`{"timestamp":"2026-03-02T09:00:00Z","type":"session_meta","payload":{"cwd":"/x"}}`))
+	w = httptest.NewRecorder()
+	server.handleImportConversation(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "no messages") {
+		t.Errorf("empty transcript: status=%d body=%s", w.Code, w.Body.String())
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -832,48 +833,11 @@ func (s *Server) handleGitCreateWorktree(w http.ResponseWriter, r *http.Request)
 		mainRoot = root
 	}
 
-	// Worktrees are siblings of the repo dir: ../reponame-YYYY-MM-DD-N
-	repoName := filepath.Base(mainRoot)
-	parentDir := filepath.Dir(mainRoot)
-	dateStr := time.Now().Format("2006-01-02")
-
-	// Find next available suffix
-	var worktreePath string
-	for i := 1; i <= 100; i++ {
-		var name string
-		if i == 1 {
-			name = repoName + "-" + dateStr
-		} else {
-			name = repoName + "-" + dateStr + "-" + strconv.Itoa(i)
-		}
-		candidate := filepath.Join(parentDir, name)
-		_, err := os.Stat(candidate)
-		if os.IsNotExist(err) {
-			worktreePath = candidate
-			break
-		}
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "failed to check path: " + err.Error()})
-			return
-		}
-	}
-	if worktreePath == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "too many worktrees for today"})
-		return
-	}
-
 	// Fetch origin first (best-effort)
 	fetchCmd := exec.Command("git", "fetch", "origin")
 	fetchCmd.Dir = mainRoot
 	fetchCmd.Run() // ignore errors
 
-	// Determine the branch name from the worktree path
-	branchName := filepath.Base(worktreePath)
-
 	// Create the worktree with a new branch based on origin/main (or HEAD)
 	base := "HEAD"
 	checkCmd := exec.Command("git", "rev-parse", "--verify", "origin/main")
@@ -882,13 +846,13 @@ func (s *Server) handleGitCreateWorktree(w http.ResponseWriter, r *http.Request)
 		base = "origin/main"
 	}
 
-	cmd := exec.Command("git", "worktree", "add", "-b", branchName, worktreePath, base)
-	cmd.Dir = mainRoot
-	output, err := cmd.CombinedOutput()
+	// Worktrees are siblings of the repo dir: ../reponame-YYYY-MM-DD-N
+	name := filepath.Base(mainRoot) + "-" + time.Now().Format("2006-01-02")
+	worktreePath, err := addWorktree(mainRoot, name, base)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "failed to create worktree: " + string(output)})
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
@@ -896,6 +860,45 @@ func (s *Server) handleGitCreateWorktree(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(map[string]string{"path": worktreePath})
 }
 
+// addWorktree creates a git worktree of the repository at mainRoot, on a new
+// branch cut from base. The worktree is a sibling of mainRoot named name, or
+// name-N for the first N whose directory and branch are both free; the
+// branch is named after the directory.
+func addWorktree(mainRoot, name, base string) (string, error) {
+	parentDir := filepath.Dir(mainRoot)
+	var worktreePath string
+	for i := 1; i <= 100; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = name + "-" + strconv.Itoa(i)
+		}
+		branchCmd := exec.Command("git", "rev-parse", "--verify", "--quiet", "refs/heads/"+candidate)
+		branchCmd.Dir = mainRoot
+		if branchCmd.Run() == nil {
+			continue // the branch outlived its worktree
+		}
+		candidate = filepath.Join(parentDir, candidate)
+		_, err := os.Stat(candidate)
+		if os.IsNotExist(err) {
+			worktreePath = candidate
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to check path: %w", err)
+		}
+	}
+	if worktreePath == "" {
+		return "", fmt.Errorf("too many worktrees named %s", name)
+	}
+
+	cmd := exec.Command("git", "worktree", "add", "-b", filepath.Base(worktreePath), worktreePath, base)
+	cmd.Dir = mainRoot
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to create worktree: %s", output)
+	}
+	return worktreePath, nil
+}
+
 // GitGraphCommit is a single commit node in the graph view.
 type GitGraphCommit struct {
 	Hash      string   `json:"hash"`
@@ -919,6 +919,10 @@ func (s *Server) conversationMux() *http.ServeMux {
 	mux.HandleFunc("GET /{id}/subagent-usage", func(w http.ResponseWriter, r *http.Request) {
 		s.handleSubagentUsage(w, r, r.PathValue("id"))
 	})
+	// GET /api/conversation/<id>/export - transcript as markdown, json or html
+	mux.Handle("GET /{id}/export", compressionHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handleExportConversation(w, r, r.PathValue("id"))
+	})))
 	// GET /api/conversation/<id>/stream - legacy SSE stream. Compression is
 	// negotiated inside the handler (zstd/gzip per Accept-Encoding) with a
 	// compressor flush after every event so messages stream promptly.
@@ -962,6 +966,16 @@ func (s *Server) conversationMux() *http.ServeMux {
 	mux.HandleFunc("GET /{id}/subagents", func(w http.ResponseWriter, r *http.Request) {
 		s.handleGetSubagents(w, r, r.PathValue("id"))
 	})
+	// Share links: read-only access to the conversation under /api/shared/
+	mux.HandleFunc("GET /{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		s.handleListShareLinks(w, r, r.PathValue("id"))
+	})
+	mux.HandleFunc("POST /{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		s.handleCreateShareLink(w, r, r.PathValue("id"))
+	})
+	mux.HandleFunc("POST /{id}/shares/{share_id}/revoke", func(w http.ResponseWriter, r *http.Request) {
+		s.handleRevokeShareLink(w, r, r.PathValue("id"), r.PathValue("share_id"))
+	})
 	mux.HandleFunc("POST /{id}/cancel-queued", func(w http.ResponseWriter, r *http.Request) {
 		s.handleCancelQueued(w, r, r.PathValue("id"))
 	})
@@ -974,14 +988,26 @@ func (s *Server) conversationMux() *http.ServeMux {
 	mux.HandleFunc("POST /{id}/fork", func(w http.ResponseWriter, r *http.Request) {
 		s.handleForkConversation(w, r, r.PathValue("id"))
 	})
+	mux.HandleFunc("POST /{id}/rewind", func(w http.ResponseWriter, r *http.Request) {
+		s.handleRewindConversation(w, r, r.PathValue("id"))
+	})
 	mux.HandleFunc("POST /{id}/cwd", func(w http.ResponseWriter, r *http.Request) {
 		s.handleSetConversationCwd(w, r, r.PathValue("id"))
 	})
+	mux.HandleFunc("POST /{id}/approve", func(w http.ResponseWriter, r *http.Request) {
+		s.handleApproveToolCall(w, r, r.PathValue("id"))
+	})
 	return mux
 }
 
 // handleGetConversation handles GET /conversation/<id>
 func (s *Server) handleGetConversation(w http.ResponseWriter, r *http.Request, conversationID string) {
+	s.serveConversation(w, r, conversationID, nil)
+}
+
+// serveConversation writes the snapshot of a conversation, through view if
+// it isn't nil.
+func (s *Server) serveConversation(w http.ResponseWriter, r *http.Request, conversationID string, view streamView) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -1040,13 +1066,17 @@ func (s *Server) handleGetConversation(w http.ResponseWriter, r *http.Request, c
 			maxSeq = m.SequenceID
 		}
 	}
-	json.NewEncoder(w).Encode(StreamResponse{
+	resp := StreamResponse{
 		Messages:     apiMessages,
 		Conversation: &conversation,
 		// ConversationState is sent via the streaming endpoint, not on initial load
 		ContextWindowSize: calculateContextWindowSize(apiMessages),
 		MaxSequenceID:     maxSeq,
-	})
+	}
+	if view != nil {
+		resp, _ = view(resp)
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
 // derefString returns the value pointed to by p, or "" if p is nil.
@@ -1305,30 +1335,77 @@ func (s *Server) handleChatConversation(w http.ResponseWriter, r *http.Request,
 	}
 
 	if firstMessage {
-		ctxNoCancel := context.WithoutCancel(ctx)
-		go func() {
-			slugCtx, cancel := context.WithTimeout(ctxNoCancel, 15*time.Second)
-			defer cancel()
-			_, marker, err := slug.GenerateSlug(slugCtx, s.llmManager, s.db, s.logger, conversationID, req.Message, modelID)
-			// Publish the usage marker before anything else. It owns a real
-			// sequence_id, so a client that never sees it observes a hole and
-			// throws away its cached history. Publish even when slug assignment
-			// failed: the row exists regardless.
-			if marker != nil {
-				s.notifySubscribersNewMessage(ctxNoCancel, conversationID, marker)
-			}
-			if err != nil {
-				s.logger.Warn("Failed to generate slug for conversation", "conversationID", conversationID, "error", err)
-			} else {
-				go s.notifySubscribers(ctxNoCancel, conversationID)
-			}
-		}()
+		go s.generateSlug(context.WithoutCancel(ctx), conversationID, req.Message, modelID)
 	}
 
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
 }
 
+// generateSlug names a conversation from its first message with an LLM
+// call, then tells subscribers.
+func (s *Server) generateSlug(ctx context.Context, conversationID, message, modelID string) {
+	slugCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	_, marker, err := slug.GenerateSlug(slugCtx, s.llmManager, s.db, s.logger, conversationID, message, modelID)
+	// Publish the usage marker before anything else. It owns a real
+	// sequence_id, so a client that never sees it observes a hole and
+	// throws away its cached history. Publish even when slug assignment
+	// failed: the row exists regardless.
+	if marker != nil {
+		s.notifySubscribersNewMessage(ctx, conversationID, marker)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to generate slug for conversation", "conversationID", conversationID, "error", err)
+	} else {
+		go s.notifySubscribers(ctx, conversationID)
+	}
+}
+
+// startConversation creates a conversation and sends it its first
+// message, for conversations the server starts on its own, such as
+// scheduled ones. An empty modelID means the default model. Unlike
+// POST /api/conversations/new it runs no hooks. It returns the
+// conversation's id even if the message could not be sent.
+func (s *Server) startConversation(ctx context.Context, modelID string, cwd *string, opts db.ConversationOptions, tags []string, message string) (string, error) {
+	if modelID == "" {
+		modelID = s.effectiveDefaultModel(s.getModelList())
+	}
+	llmService, err := s.llmManager.GetService(modelID)
+	if err != nil {
+		return "", fmt.Errorf("model %s: %w", modelID, err)
+	}
+
+	conversation, err := s.db.CreateConversation(ctx, nil, true, cwd, &modelID, opts)
+	if err != nil {
+		return "", err
+	}
+	conversationID := conversation.ConversationID
+	if len(tags) > 0 {
+		if conversation, err = s.db.UpdateConversationTags(ctx, conversationID, tags); err != nil {
+			return conversationID, err
+		}
+	}
+	go s.publishConversationListUpdate(ConversationListUpdate{
+		Type:         "update",
+		Conversation: conversation,
+	})
+
+	manager, err := s.getOrCreateConversationManager(ctx, conversationID, "")
+	if err != nil {
+		return conversationID, err
+	}
+	userMessage := llm.Message{
+		Role:    llm.MessageRoleUser,
+		Content: llm.TextContent(message),
+	}
+	if _, err := manager.AcceptUserMessage(ctx, llmService, modelID, userMessage); err != nil {
+		return conversationID, err
+	}
+	go s.generateSlug(context.WithoutCancel(ctx), conversationID, message, modelID)
+	return conversationID, nil
+}
+
 // handleNewConversation handles POST /api/conversations/new - creates conversation implicitly on first message
 func (s *Server) handleNewConversation(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -1503,24 +1580,7 @@ func (s *Server) handleNewConversation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if firstMessage && !hookSlugApplied {
-		ctxNoCancel := context.WithoutCancel(ctx)
-		go func() {
-			slugCtx, cancel := context.WithTimeout(ctxNoCancel, 15*time.Second)
-			defer cancel()
-			_, marker, err := slug.GenerateSlug(slugCtx, s.llmManager, s.db, s.logger, conversationID, req.Message, modelID)
-			// Publish the usage marker before anything else. It owns a real
-			// sequence_id, so a client that never sees it observes a hole and
-			// throws away its cached history. Publish even when slug assignment
-			// failed: the row exists regardless.
-			if marker != nil {
-				s.notifySubscribersNewMessage(ctxNoCancel, conversationID, marker)
-			}
-			if err != nil {
-				s.logger.Warn("Failed to generate slug for conversation", "conversationID", conversationID, "error", err)
-			} else {
-				go s.notifySubscribers(ctxNoCancel, conversationID)
-			}
-		}()
+		go s.generateSlug(context.WithoutCancel(ctx), conversationID, req.Message, modelID)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1774,14 +1834,14 @@ func (s *Server) handleContinueConversation(w http.ResponseWriter, r *http.Reque
 // handleStreamConversation handles GET /conversation/<id>/stream.
 // See API.md for query params; see handleStream for the unified stream.
 func (s *Server) handleStreamConversation(w http.ResponseWriter, r *http.Request, conversationID string) {
-	s.runStream(w, r, conversationID, false)
+	s.runStream(w, r, conversationID, false, nil)
 }
 
 // handleStream handles GET /api/stream2 — the unified SSE stream that
 // combines per-conversation messages with conversation-list patch
 // events. See API.md for query params.
 func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
-	s.runStream(w, r, r.URL.Query().Get("conversation"), true)
+	s.runStream(w, r, r.URL.Query().Get("conversation"), true, nil)
 }
 
 const streamUpdatesQueueCapacity = 200
@@ -1827,7 +1887,12 @@ func (s *Server) newStreamUpdatesQueue(ctx context.Context, conversationID strin
 	})
 }
 
-func (s *Server) runStream(w http.ResponseWriter, r *http.Request, conversationID string, includeConversationListPatches bool) {
+// streamView rewrites a frame before it is written to a client, or drops it
+// by returning false. Shared conversations are served through one; see
+// shareView.
+type streamView func(StreamResponse) (StreamResponse, bool)
+
+func (s *Server) runStream(w http.ResponseWriter, r *http.Request, conversationID string, includeConversationListPatches bool, view streamView) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -1965,6 +2030,12 @@ func (s *Server) runStream(w http.ResponseWriter, r *http.Request, conversationI
 	}
 
 	writeStreamData := func(streamData StreamResponse) bool {
+		if view != nil {
+			var ok bool
+			if streamData, ok = view(streamData); !ok {
+				return true
+			}
+		}
 		if !initCompression() {
 			return false
 		}
@@ -2237,9 +2308,10 @@ func (s *Server) runStream(w http.ResponseWriter, r *http.Request, conversationI
 			Messages:       apiMessages,
 			Conversation:   &conversation,
 			ConversationState: &ConversationState{
-				ConversationID: conversationID,
-				Working:        conversation.AgentWorking,
-				Model:          manager.GetModel(),
+				ConversationID:   conversationID,
+				Working:          conversation.AgentWorking,
+				Model:            manager.GetModel(),
+				PendingApprovals: manager.PendingApprovals(),
 			},
 			ContextWindowSize: ctxSize,
 		}
@@ -2252,9 +2324,10 @@ func (s *Server) runStream(w http.ResponseWriter, r *http.Request, conversationI
 			ConversationID: conversationID,
 			Conversation:   &conversation,
 			ConversationState: &ConversationState{
-				ConversationID: conversationID,
-				Working:        conversation.AgentWorking,
-				Model:          manager.GetModel(),
+				ConversationID:   conversationID,
+				Working:          conversation.AgentWorking,
+				Model:            manager.GetModel(),
+				PendingApprovals: manager.PendingApprovals(),
 			},
 			Heartbeat: true,
 		}
@@ -2295,9 +2368,10 @@ func (s *Server) runStream(w http.ResponseWriter, r *http.Request, conversationI
 				heartbeat := StreamResponse{
 					Conversation: &conv,
 					ConversationState: &ConversationState{
-						ConversationID: conversationID,
-						Working:        conv.AgentWorking,
-						Model:          manager.GetModel(),
+						ConversationID:   conversationID,
+						Working:          conv.AgentWorking,
+						Model:            manager.GetModel(),
+						PendingApprovals: manager.PendingApprovals(),
 					},
 					Heartbeat: true,
 				}
@@ -2799,12 +2873,7 @@ func (s *Server) handleModelRefresh(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "model manager does not support refresh", http.StatusInternalServerError)
 		return
 	}
-	builtModels, err := s.refreshBuiltModels(r.Context())
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err := refresher.RefreshBuiltModels(builtModels); err != nil {
+	if err := s.refreshModels(r.Context(), refresher); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -2814,6 +2883,24 @@ func (s *Server) handleModelRefresh(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(modelList)
 }
 
+// RefreshModels refreshes the non-custom model catalog, as POST
+// /api/models/refresh does. It does nothing when refresh is not configured.
+func (s *Server) RefreshModels(ctx context.Context) error {
+	refresher, ok := s.llmManager.(builtModelRefresher)
+	if s.refreshBuiltModels == nil || !ok {
+		return nil
+	}
+	return s.refreshModels(ctx, refresher)
+}
+
+func (s *Server) refreshModels(ctx context.Context, refresher builtModelRefresher) error {
+	builtModels, err := s.refreshBuiltModels(ctx)
+	if err != nil {
+		return err
+	}
+	return refresher.RefreshBuiltModels(builtModels)
+}
+
 // markDefaultModel sets IsDefault=true on the entry matching defaultID.
 func markDefaultModel(modelList []ModelInfo, defaultID string) {
 	if defaultID == "" {
@@ -2835,7 +2922,7 @@ func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"tools": claudetool.ToolRegistry,
+		"tools": claudetool.Registry(),
 	})
 }
 
@@ -3741,14 +3828,28 @@ func (s *Server) handleForkConversation(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	forked, err = s.finishFork(ctx, conversationID, forked, cutoff)
+	if err != nil {
+		s.logger.Error("Failed to set fork-point model state", "conversationID", forked.ConversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(forked)
+}
+
+// finishFork completes a fork made by db.ForkConversation at cutoff: it
+// rewinds the fork's model state, names it after the source and announces it
+// on the conversation list.
+func (s *Server) finishFork(ctx context.Context, conversationID string, forked *generated.Conversation, cutoff int64) (*generated.Conversation, error) {
 	// ForkConversation copies the source's CURRENT model/options, but the fork
 	// should continue from the state as of the cutoff. If the source switched
 	// model or reasoning via /model AFTER the cutoff, rewind those changes so
 	// the fork uses what was in effect at the fork point.
 	if err := s.applyForkPointModelState(ctx, conversationID, forked.ConversationID, cutoff); err != nil {
-		s.logger.Error("Failed to set fork-point model state", "conversationID", forked.ConversationID, "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return forked, err
 	}
 
 	// Give the fork a distinct slug derived from the source's, so it shows up
@@ -3778,10 +3879,7 @@ func (s *Server) handleForkConversation(w http.ResponseWriter, r *http.Request,
 
 	// Notify conversation list subscribers about the new conversation.
 	go s.publishConversationListUpdate(ConversationListUpdate{Type: "update", Conversation: forked})
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(forked)
+	return forked, nil
 }
 
 // applyForkPointModelState rewinds the fork's model and reasoning level to what
@@ -4002,6 +4100,18 @@ func validateConversationOptions(opts db.ConversationOptions) string {
 			return fmt.Sprintf("Invalid thinking_level: %q; must be one of off, minimal, low, medium, high, xhigh", opts.ThinkingLevel)
 		}
 	}
+	if err := approvalPolicy(opts.ApprovalPolicy).Validate(); err != nil {
+		return fmt.Sprintf("Invalid approval_policy: %v", err)
+	}
+	if err := opts.AutoCompact.Validate(); err != nil {
+		return fmt.Sprintf("Invalid %v", err)
+	}
+	if err := sandboxProfile(opts.Sandbox).Validate(); err != nil {
+		return fmt.Sprintf("Invalid %v", err)
+	}
+	if err := opts.Budget.Validate(); err != nil {
+		return fmt.Sprintf("Invalid %v", err)
+	}
 	return ""
 }
 
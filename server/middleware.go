@@ -27,11 +27,13 @@ func LoggerMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 
 // RequireHeaderMiddleware requires a specific header to be present on all API requests.
 // This is used to ensure requests come through an authenticated proxy.
+// Share link routes (/api/shared/) are exempt: the token is their credential.
+// So is firing a trigger, which is authenticated by the trigger's secret.
 func RequireHeaderMiddleware(headerName string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Only check API routes
-			if strings.HasPrefix(r.URL.Path, "/api/") {
+			if strings.HasPrefix(r.URL.Path, "/api/") && !headerExempt(r) {
 				if r.Header.Get(headerName) == "" {
 					http.Error(w, "missing required header: "+headerName, http.StatusForbidden)
 					return
@@ -42,6 +44,16 @@ func RequireHeaderMiddleware(headerName string) func(http.Handler) http.Handler
 	}
 }
 
+// headerExempt reports whether r is an API request that carries its own
+// credential rather than coming through the proxy.
+func headerExempt(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/shared/") {
+		return true
+	}
+	name, ok := strings.CutPrefix(r.URL.Path, "/api/triggers/")
+	return ok && r.Method == http.MethodPost && name != "" && !strings.Contains(name, "/")
+}
+
 // compressedResponseWriter compresses non-streaming HTTP responses.
 type compressedResponseWriter struct {
 	http.ResponseWriter
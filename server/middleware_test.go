@@ -77,6 +77,45 @@ func TestRequireHeaderMiddleware_AllowsVersionEndpointWithoutHeader(t *testing.T
 	}
 }
 
+func TestRequireHeaderMiddleware_AllowsSharedWithoutHeader(t *testing.T) {
+	t.Parallel()
+	handler := RequireHeaderMiddleware("X-Exedev-Userid")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/shared/token/conversation/c1", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200 for /api/shared/ without required header, got %d", w.Code)
+	}
+}
+
+func TestRequireHeaderMiddleware_AllowsTriggerFireWithoutHeader(t *testing.T) {
+	t.Parallel()
+	handler := RequireHeaderMiddleware("X-Exedev-Userid")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"POST", "/api/triggers/ci-failure", http.StatusOK},
+		{"GET", "/api/triggers/ci-failure", http.StatusForbidden},
+		{"POST", "/api/triggers", http.StatusForbidden},
+		{"POST", "/api/triggers/ci-failure/secret", http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, w.Code, tc.want)
+		}
+	}
+}
+
 func TestCompressionHandler_CompressesResponse(t *testing.T) {
 	t.Parallel()
 	handler := compressionHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -62,11 +62,8 @@ func (s *Server) handleSubagentUsage(w http.ResponseWriter, r *http.Request, con
 	fold := func(model, url string, llmCalls, in, cacheWrite, cacheRead, out int64, costUsd float64) {
 		resp.LLMCalls += llmCalls
 		resp.ReportedUsd += costUsd
-		if c, found := modelsdev.LookupCost(url, model); found {
-			resp.EstimatedUsd += float64(in)*c.Input/1e6 +
-				float64(cacheWrite)*c.CacheWrite/1e6 +
-				float64(cacheRead)*c.CacheRead/1e6 +
-				float64(out)*c.Output/1e6
+		if usd, found := estimateCostUSD(url, model, in, cacheWrite, cacheRead, out); found {
+			resp.EstimatedUsd += usd
 		} else {
 			resp.UnpricedModels = append(resp.UnpricedModels, model)
 			resp.UnpricedCalls += llmCalls
@@ -88,3 +85,16 @@ func (s *Server) handleSubagentUsage(w http.ResponseWriter, r *http.Request, con
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// estimateCostUSD prices token counts with models.dev pricing. found is
+// false if the model has none.
+func estimateCostUSD(url, model string, in, cacheWrite, cacheRead, out int64) (usd float64, found bool) {
+	c, found := modelsdev.LookupCost(url, model)
+	if !found {
+		return 0, false
+	}
+	return float64(in)*c.Input/1e6 +
+		float64(cacheWrite)*c.CacheWrite/1e6 +
+		float64(cacheRead)*c.CacheRead/1e6 +
+		float64(out)*c.Output/1e6, true
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"shelley.exe.dev/loop"
+)
+
+// ModelFallbacks configures the models a conversation switches to when its
+// own keeps failing with retryable errors, such as a provider that has been
+// overloaded for minutes.
+type ModelFallbacks struct {
+	// Chains maps a model ID to the models to fall back to, in order.
+	Chains map[string][]string `json:"chains"`
+	// AfterFailures is how many retryable failures of one request move it
+	// to the next model of the chain. Zero means loop.DefaultFallbackAfter.
+	AfterFailures int `json:"after_failures"`
+}
+
+// Validate reports a malformed configuration. Models that are not
+// available are not an error: they may come and go, and are skipped.
+func (f *ModelFallbacks) Validate() error {
+	if f == nil {
+		return nil
+	}
+	if f.AfterFailures < 0 {
+		return fmt.Errorf("model_fallbacks.after_failures must not be negative, got %d", f.AfterFailures)
+	}
+	for model, chain := range f.Chains {
+		if model == "" || slices.Contains(chain, "") {
+			return fmt.Errorf("model_fallbacks.chains: model IDs must not be empty")
+		}
+		if slices.Contains(chain, model) {
+			return fmt.Errorf("model_fallbacks.chains: %s falls back to itself", model)
+		}
+	}
+	return nil
+}
+
+// wireModelFallback connects a new manager's loops to the server's
+// fallback chains.
+func (s *Server) wireModelFallback(manager *ConversationManager) {
+	manager.modelFallbacks = s.modelFallbacks
+	manager.fallbackAfter = s.ModelFallbacks.AfterFailures
+	manager.onModelFallback = func(ctx context.Context, to loop.Fallback, err error) {
+		s.switchToFallbackModel(ctx, manager, to, err)
+	}
+}
+
+// modelFallbacks returns the available models of modelID's fallback chain.
+func (s *Server) modelFallbacks(modelID string) []loop.Fallback {
+	var fallbacks []loop.Fallback
+	for _, id := range s.ModelFallbacks.Chains[modelID] {
+		service, err := s.llmManager.GetService(id)
+		if err != nil {
+			s.logger.Warn("Fallback model is not available", "model", modelID, "fallback", id, "error", err)
+			continue
+		}
+		fallbacks = append(fallbacks, loop.Fallback{Model: id, LLM: service})
+	}
+	return fallbacks
+}
+
+// switchToFallbackModel makes the model a conversation's loop has fallen
+// back to the conversation's model, as if the user had switched to it, and
+// records a modelchange marker saying why.
+func (s *Server) switchToFallbackModel(ctx context.Context, cm *ConversationManager, to loop.Fallback, cause error) {
+	cm.mu.Lock()
+	from := cm.modelID
+	cm.modelID = to.Model
+	cm.mu.Unlock()
+	if err := s.db.ForceUpdateConversationModel(ctx, cm.conversationID, to.Model); err != nil {
+		cm.logger.Error("Failed to persist fallback model", "model", to.Model, "error", err)
+	}
+
+	modelList := s.getModelList()
+	fromName, toName := modelDisplayName(from, modelList), modelDisplayName(to.Model, modelList)
+	if err := cm.recordModelChangeMarker(ctx, ModelChangeUserData{
+		From:        from,
+		To:          to.Model,
+		FromDisplay: fromName,
+		ToDisplay:   toName,
+		Text:        fmt.Sprintf("Model changed from %s to %s because %s kept failing (%v).", fromName, toName, fromName, cause),
+	}); err != nil {
+		cm.logger.Error("Failed to record model fallback", "error", err)
+	}
+}
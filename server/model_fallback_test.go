@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/llm"
+	"shelley.exe.dev/loop"
+)
+
+// overloadedLLM keeps reporting overloaded errors through OnRetry until its
+// request is cancelled, like a provider in an outage.
+type overloadedLLM struct {
+	llm.Service
+}
+
+func (o *overloadedLLM) Do(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	for attempt := 2; ; attempt++ {
+		if req.OnRetry != nil {
+			req.OnRetry(llm.RetryEvent{Attempt: attempt, Err: "overloaded_error", Status: 529, Provider: "test", Model: "model-a"})
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// fallbackLLMManager serves model-a, which is overloaded, and model-b.
+type fallbackLLMManager struct {
+	twoModelLLMManager
+}
+
+func (m *fallbackLLMManager) GetService(modelID string) (llm.Service, error) {
+	if modelID == "model-a" {
+		return &overloadedLLM{m.service}, nil
+	}
+	return m.twoModelLLMManager.GetService(modelID)
+}
+
+func TestModelFallbackSwitchesAndRecordsMarker(t *testing.T) {
+	t.Parallel()
+	database, cleanup := setupTestDB(t)
+	t.Cleanup(cleanup)
+	srv := NewServer(database, &fallbackLLMManager{twoModelLLMManager{service: loop.NewPredictableService()}},
+		claudetool.ToolSetConfig{EnableBrowser: false},
+		slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn})),
+		false, "model-a", "")
+	srv.hooksDir = t.TempDir()
+	srv.ModelFallbacks = ModelFallbacks{
+		Chains:        map[string][]string{"model-a": {"missing-model", "model-b"}},
+		AfterFailures: 2,
+	}
+	ctx := context.Background()
+
+	modelA := "model-a"
+	conv, err := database.CreateConversation(ctx, nil, true, nil, &modelA, db.ConversationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := conv.ConversationID
+	if w := postChat(t, srv, id, "echo: rescued"); w.Code != http.StatusAccepted {
+		t.Fatalf("chat: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		for _, m := range listMessages(t, database, id) {
+			if m.Type == string(db.MessageTypeAgent) && m.LlmData != nil && strings.Contains(*m.LlmData, "rescued") {
+				return true
+			}
+		}
+		return false
+	})
+
+	marker := lastModelChange(listMessages(t, database, id))
+	if marker == nil || marker.UserData == nil {
+		t.Fatal("no modelchange marker was recorded")
+	}
+	var ud ModelChangeUserData
+	if err := json.Unmarshal([]byte(*marker.UserData), &ud); err != nil {
+		t.Fatal(err)
+	}
+	if ud.From != "model-a" || ud.To != "model-b" || ud.ToDisplay != "Model B" {
+		t.Errorf("marker = %+v, want model-a to Model B", ud)
+	}
+	if !strings.Contains(ud.Text, "kept failing") || !strings.Contains(ud.Text, "overloaded_error") {
+		t.Errorf("marker text = %q", ud.Text)
+	}
+	if updated, _ := database.GetConversationByID(ctx, id); updated.Model == nil || *updated.Model != "model-b" {
+		t.Errorf("conversation model = %v, want model-b", updated.Model)
+	}
+
+	// The conversation carries on with the fallback.
+	if w := postChat(t, srv, id, "echo: still here"); w.Code != http.StatusAccepted {
+		t.Fatalf("second chat: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		for _, m := range listMessages(t, database, id) {
+			if m.Type == string(db.MessageTypeAgent) && m.LlmData != nil && strings.Contains(*m.LlmData, "still here") {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestModelFallbacksValidate(t *testing.T) {
+	for _, tc := range []struct {
+		f    *ModelFallbacks
+		want string
+	}{
+		{nil, ""},
+		{&ModelFallbacks{Chains: map[string][]string{"a": {"b", "c"}}, AfterFailures: 3}, ""},
+		{&ModelFallbacks{AfterFailures: -1}, "after_failures"},
+		{&ModelFallbacks{Chains: map[string][]string{"a": {"b", "a"}}}, "itself"},
+		{&ModelFallbacks{Chains: map[string][]string{"a": {""}}}, "empty"},
+	} {
+		err := tc.f.Validate()
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("Validate(%+v) = %v, want %q", tc.f, err, tc.want)
+		}
+	}
+}
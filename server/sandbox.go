@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"shelley.exe.dev/claudetool/sandbox"
+	"shelley.exe.dev/db"
+)
+
+// effectiveSandbox returns the sandbox profile in force for the
+// conversation: its own sandbox option, else the one inherited from its
+// parent, else the server-wide profile. The result may be nil or disabled.
+func (cm *ConversationManager) effectiveSandbox() *sandbox.Profile {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if p := cm.conversationOptions.Sandbox; p != nil {
+		return sandboxProfile(p)
+	}
+	if cm.inheritedSandbox != nil {
+		return cm.inheritedSandbox
+	}
+	return cm.toolSetConfig.Sandbox
+}
+
+// ancestorSandbox returns the sandbox option of the nearest ancestor of a
+// subagent conversation that sets one, so subagents cannot escape their
+// parent's sandbox. It returns nil if none does.
+func ancestorSandbox(ctx context.Context, database *db.DB, parentID string) *sandbox.Profile {
+	for parentID != "" {
+		conv, err := database.GetConversationByID(ctx, parentID)
+		if err != nil {
+			return nil
+		}
+		if p := db.ParseConversationOptions(conv.ConversationOptions).Sandbox; p != nil {
+			return sandboxProfile(p)
+		}
+		parentID = derefString(conv.ParentConversationID)
+	}
+	return nil
+}
+
+// sandboxProfile converts a conversation's stored sandbox option. A nil
+// profile stays nil.
+func sandboxProfile(p *db.SandboxProfile) *sandbox.Profile {
+	if p == nil {
+		return nil
+	}
+	return &sandbox.Profile{
+		Enabled:   p.Enabled,
+		NoNetwork: p.NoNetwork,
+		Writable:  slices.Clone(p.Writable),
+		Hidden:    slices.Clone(p.Hidden),
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"shelley.exe.dev/claudetool/sandbox"
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+	"shelley.exe.dev/llm"
+)
+
+// newSandboxHarness starts a conversation whose bash commands run in a
+// sandbox, with cwd as its working directory.
+func newSandboxHarness(t *testing.T, cwd string) *TestHarness {
+	t.Helper()
+	h := NewTestHarness(t)
+	opts := db.ConversationOptions{Sandbox: &db.SandboxProfile{Enabled: true, NoNetwork: true}}
+	conv, err := h.db.CreateConversation(context.Background(), nil, true, &cwd, nil, opts)
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+	h.convID = conv.ConversationID
+	return h
+}
+
+func TestSandboxViolationIsToolError(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	h := newSandboxHarness(t, dir)
+	h.Chat("bash: touch /shelley-sandbox-probe")
+	out := h.WaitToolResult()
+	if strings.Contains(out, "shelley sandbox:") || strings.Contains(out, "operation not permitted") {
+		t.Skipf("cannot create namespaces here: %s", out)
+	}
+	if !strings.Contains(out, "sandbox violation") || !strings.Contains(out, dir) {
+		t.Errorf("tool result = %q, want a sandbox violation naming %s", out, dir)
+	}
+}
+
+func TestSandboxInSystemPrompt(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	h := newSandboxHarness(t, dir)
+	ctx := context.Background()
+	if _, err := h.server.getOrCreateConversationManager(ctx, h.convID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []generated.Message
+	if err := h.db.Queries(ctx, func(q *generated.Queries) error {
+		var err error
+		messages, err = q.ListMessages(ctx, h.convID)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var system *generated.Message
+	for i := range messages {
+		if messages[i].Type == string(db.MessageTypeSystem) {
+			system = &messages[i]
+		}
+	}
+	if system == nil || system.DisplayData == nil || system.LlmData == nil {
+		t.Fatal("no system prompt with display data")
+	}
+
+	var display struct {
+		Sandbox *sandbox.Sandbox `json:"sandbox"`
+	}
+	if err := json.Unmarshal([]byte(*system.DisplayData), &display); err != nil {
+		t.Fatal(err)
+	}
+	if display.Sandbox == nil || display.Sandbox.Network || len(display.Sandbox.Writable) == 0 || display.Sandbox.Writable[0] != dir {
+		t.Errorf("display data sandbox = %+v", display.Sandbox)
+	}
+
+	var prompt llm.Message
+	if err := json.Unmarshal([]byte(*system.LlmData), &prompt); err != nil {
+		t.Fatal(err)
+	}
+	if text := prompt.Content[0].Text; !strings.Contains(text, "<sandbox>") || !strings.Contains(text, "no network access") {
+		t.Errorf("system prompt does not describe the sandbox:\n%s", text)
+	}
+}
+
+func TestSubagentInheritsSandbox(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	ctx := context.Background()
+	profile := &db.SandboxProfile{Enabled: true, Writable: []string{"/srv/cache"}}
+	parent, err := h.db.CreateConversation(ctx, nil, true, nil, nil, db.ConversationOptions{Sandbox: profile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := h.db.CreateSubagentConversation(ctx, "child", parent.ConversationID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grandchild, err := h.db.CreateSubagentConversation(ctx, "grandchild", child.ConversationID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := h.server.getOrCreateSubagentConversationManager(ctx, grandchild.ConversationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := manager.effectiveSandbox(); got == nil || !got.Enabled || len(got.Writable) != 1 || got.Writable[0] != "/srv/cache" {
+		t.Errorf("effectiveSandbox() = %+v, want the grandparent's profile", got)
+	}
+}
+
+func TestValidateSandboxOption(t *testing.T) {
+	opts := db.ConversationOptions{Sandbox: &db.SandboxProfile{Enabled: true, Writable: []string{"relative/dir"}}}
+	if msg := validateConversationOptions(opts); msg == "" {
+		t.Error("expected a relative writable path to be rejected")
+	}
+	opts.Sandbox.Writable = []string{"~/.cache", "/var/cache"}
+	if msg := validateConversationOptions(opts); msg != "" {
+		t.Errorf("valid sandbox rejected: %s", msg)
+	}
+}
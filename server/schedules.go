@@ -0,0 +1,603 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+	"shelley.exe.dev/schedule"
+)
+
+const (
+	// maxScheduleSleep bounds how long the schedule routine sleeps, so
+	// it notices schedules edited behind its back.
+	maxScheduleSleep = time.Minute
+	// scheduleRunHistory is how many recent runs GET /api/schedules/{id}
+	// returns.
+	scheduleRunHistory = 20
+)
+
+// ScheduleAPI is a schedule as the API returns it.
+type ScheduleAPI struct {
+	ScheduleID           string                 `json:"schedule_id"`
+	Name                 string                 `json:"name"`
+	Cron                 string                 `json:"cron,omitempty"`
+	RunAt                *time.Time             `json:"run_at,omitempty"`
+	Timezone             string                 `json:"timezone,omitempty"`
+	Prompt               string                 `json:"prompt"`
+	Model                string                 `json:"model,omitempty"`
+	Cwd                  string                 `json:"cwd,omitempty"`
+	ConversationOptions  db.ConversationOptions `json:"conversation_options"`
+	CatchUp              string                 `json:"catch_up"`
+	Enabled              bool                   `json:"enabled"`
+	OriginConversationID string                 `json:"origin_conversation_id,omitempty"`
+	NextRunAt            *time.Time             `json:"next_run_at,omitempty"`
+	LastRunAt            *time.Time             `json:"last_run_at,omitempty"`
+	CreatedAt            time.Time              `json:"created_at"`
+	UpdatedAt            time.Time              `json:"updated_at"`
+	// Runs are the most recent firings, newest first. Only
+	// GET /api/schedules/{id} fills them in.
+	Runs []generated.ScheduleRun `json:"runs,omitempty"`
+}
+
+// ScheduleRequest creates or replaces a schedule. Exactly one of Cron and
+// RunAt is set.
+type ScheduleRequest struct {
+	Name                string                  `json:"name"`
+	Cron                string                  `json:"cron,omitempty"`
+	RunAt               *time.Time              `json:"run_at,omitempty"`
+	Timezone            string                  `json:"timezone,omitempty"`
+	Prompt              string                  `json:"prompt"`
+	Model               string                  `json:"model,omitempty"`
+	Cwd                 string                  `json:"cwd,omitempty"`
+	ConversationOptions *db.ConversationOptions `json:"conversation_options,omitempty"`
+	CatchUp             string                  `json:"catch_up,omitempty"`
+	// Enabled defaults to true.
+	Enabled *bool `json:"enabled,omitempty"`
+	// OriginConversationID is the conversation the schedule was created
+	// from. It is ignored when replacing a schedule.
+	OriginConversationID string `json:"origin_conversation_id,omitempty"`
+}
+
+func toScheduleAPI(sched generated.Schedule) ScheduleAPI {
+	var opts db.ConversationOptions
+	json.Unmarshal([]byte(sched.ConversationOptions), &opts)
+	return ScheduleAPI{
+		ScheduleID:           sched.ScheduleID,
+		Name:                 sched.Name,
+		Cron:                 derefString(sched.Cron),
+		RunAt:                sched.RunAt,
+		Timezone:             sched.Timezone,
+		Prompt:               sched.Prompt,
+		Model:                derefString(sched.Model),
+		Cwd:                  derefString(sched.Cwd),
+		ConversationOptions:  opts,
+		CatchUp:              sched.CatchUp,
+		Enabled:              sched.Enabled,
+		OriginConversationID: derefString(sched.OriginConversationID),
+		NextRunAt:            sched.NextRunAt,
+		LastRunAt:            sched.LastRunAt,
+		CreatedAt:            sched.CreatedAt,
+		UpdatedAt:            sched.UpdatedAt,
+	}
+}
+
+// scheduleRequest is the request that would recreate sched.
+func scheduleRequest(sched generated.Schedule) ScheduleRequest {
+	api := toScheduleAPI(sched)
+	return ScheduleRequest{
+		Name:                 api.Name,
+		Cron:                 api.Cron,
+		RunAt:                api.RunAt,
+		Timezone:             api.Timezone,
+		Prompt:               api.Prompt,
+		Model:                api.Model,
+		Cwd:                  api.Cwd,
+		ConversationOptions:  &api.ConversationOptions,
+		CatchUp:              api.CatchUp,
+		Enabled:              &api.Enabled,
+		OriginConversationID: api.OriginConversationID,
+	}
+}
+
+// scheduleParams validates req and works out when it is next due after
+// now. Errors are the client's fault. ScheduleID is left unset.
+func (s *Server) scheduleParams(req ScheduleRequest, now time.Time) (generated.UpdateScheduleParams, error) {
+	var p generated.UpdateScheduleParams
+	p.Name = strings.TrimSpace(req.Name)
+	p.Prompt = strings.TrimSpace(req.Prompt)
+	if p.Name == "" || p.Prompt == "" {
+		return p, errors.New("name and prompt are required")
+	}
+	if (req.Cron == "") == (req.RunAt == nil) {
+		return p, errors.New("exactly one of cron and run_at is required")
+	}
+
+	loc := time.Local
+	if req.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(req.Timezone); err != nil {
+			return p, fmt.Errorf("unknown timezone %q", req.Timezone)
+		}
+	}
+	p.Timezone = req.Timezone
+	var cron *schedule.Cron
+	if req.Cron != "" {
+		var err error
+		if cron, err = schedule.ParseCron(req.Cron); err != nil {
+			return p, err
+		}
+		if cron.Next(now.In(loc)).IsZero() {
+			return p, fmt.Errorf("cron expression %q never fires", req.Cron)
+		}
+		p.Cron = &req.Cron
+	} else {
+		runAt := req.RunAt.UTC()
+		p.RunAt = &runAt
+	}
+	p.NextRunAt = nextScheduleRun(cron, loc, p.RunAt, now)
+
+	catchUp, err := schedule.ParseCatchUp(req.CatchUp)
+	if err != nil {
+		return p, err
+	}
+	p.CatchUp = string(catchUp)
+
+	modelID := req.Model
+	if modelID != "" {
+		if _, err := s.llmManager.GetService(modelID); err != nil {
+			return p, errors.New(unsupportedModelMessage(modelID, s.getModelList()))
+		}
+		p.Model = &modelID
+	} else {
+		modelID = s.effectiveDefaultModel(s.getModelList())
+	}
+	var opts db.ConversationOptions
+	if req.ConversationOptions != nil {
+		opts = *req.ConversationOptions
+	}
+	if msg := validateConversationOptions(opts); msg != "" {
+		return p, errors.New(msg)
+	}
+	if msg := validateModelReasoningLevel(findModelInfo(modelID, s.getModelList()), opts.ThinkingLevel); msg != "" {
+		return p, errors.New(msg)
+	}
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return p, err
+	}
+	p.ConversationOptions = string(optsJSON)
+
+	if req.Cwd != "" {
+		p.Cwd = &req.Cwd
+	}
+	p.Enabled = req.Enabled == nil || *req.Enabled
+	return p, nil
+}
+
+// nextScheduleRun returns when a schedule is next due after now: the next
+// match of cron in loc, or runAt for a one-shot that is not yet overdue.
+// It returns nil if the schedule will not fire again.
+func nextScheduleRun(cron *schedule.Cron, loc *time.Location, runAt *time.Time, now time.Time) *time.Time {
+	var next time.Time
+	switch {
+	case cron != nil:
+		next = cron.Next(now.In(loc))
+	case now.Sub(*runAt) <= schedule.Grace:
+		next = *runAt
+	}
+	if next.IsZero() {
+		return nil
+	}
+	next = next.UTC()
+	return &next
+}
+
+// newScheduleParams validates a request for a new schedule. Errors are
+// the client's fault.
+func (s *Server) newScheduleParams(ctx context.Context, req ScheduleRequest) (generated.CreateScheduleParams, error) {
+	p, err := s.scheduleParams(req, time.Now())
+	if err != nil {
+		return generated.CreateScheduleParams{}, err
+	}
+	if p.Cron == nil && p.NextRunAt == nil {
+		return generated.CreateScheduleParams{}, fmt.Errorf("run_at %s is in the past", p.RunAt.Format(time.RFC3339))
+	}
+	var origin *string
+	if req.OriginConversationID != "" {
+		if _, err := s.db.GetConversationByID(ctx, req.OriginConversationID); err != nil {
+			return generated.CreateScheduleParams{}, fmt.Errorf("unknown origin conversation %s", req.OriginConversationID)
+		}
+		origin = &req.OriginConversationID
+	}
+	return generated.CreateScheduleParams{
+		ScheduleID:           "sched-" + uuid.New().String()[:8],
+		Name:                 p.Name,
+		Cron:                 p.Cron,
+		RunAt:                p.RunAt,
+		Timezone:             p.Timezone,
+		Prompt:               p.Prompt,
+		Model:                p.Model,
+		Cwd:                  p.Cwd,
+		ConversationOptions:  p.ConversationOptions,
+		CatchUp:              p.CatchUp,
+		Enabled:              p.Enabled,
+		OriginConversationID: origin,
+		NextRunAt:            p.NextRunAt,
+	}, nil
+}
+
+// wakeScheduler makes the schedule routine look at schedules again, after
+// one was created or changed.
+func (s *Server) wakeScheduler() {
+	select {
+	case s.scheduleWake <- struct{}{}:
+	default:
+	}
+}
+
+// scheduleRoutine fires schedules as they fall due, until shutdown.
+func (s *Server) scheduleRoutine() {
+	for {
+		timer := time.NewTimer(s.runDueSchedules(context.Background(), time.Now()))
+		select {
+		case <-timer.C:
+		case <-s.scheduleWake:
+			timer.Stop()
+		case <-s.shutdownCh:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runDueSchedules fires every enabled schedule due at now, applying its
+// catch-up policy to firings missed while the server was down, and
+// returns how long to wait before looking again.
+func (s *Server) runDueSchedules(ctx context.Context, now time.Time) time.Duration {
+	scheds, err := s.db.ListEnabledSchedules(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list schedules", "error", err)
+		return maxScheduleSleep
+	}
+	wait := maxScheduleSleep
+	for _, sched := range scheds {
+		next := sched.NextRunAt
+		if next.After(now) {
+			if d := next.Sub(now); d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		loc := time.Local
+		if sched.Timezone != "" {
+			if loc, err = time.LoadLocation(sched.Timezone); err != nil {
+				s.logger.Error("Schedule has an unknown timezone", "scheduleID", sched.ScheduleID, "timezone", sched.Timezone)
+				continue
+			}
+		}
+		var cron *schedule.Cron
+		if sched.Cron != nil {
+			if cron, err = schedule.ParseCron(*sched.Cron); err != nil {
+				s.logger.Error("Schedule has a bad cron expression", "scheduleID", sched.ScheduleID, "error", err)
+				continue
+			}
+		}
+		fire, following := schedule.Due(cron, next.In(loc), now.In(loc), schedule.CatchUp(sched.CatchUp))
+		if len(fire) == 0 {
+			s.logger.Info("Skipping missed schedule firings", "scheduleID", sched.ScheduleID, "since", next)
+		}
+
+		// Advance before firing, so a crash part way through cannot fire
+		// the same runs twice.
+		var nextRunAt *time.Time
+		if !following.IsZero() {
+			following = following.UTC()
+			nextRunAt = &following
+			if d := following.Sub(now); d < wait {
+				wait = d
+			}
+		}
+		lastRunAt := sched.LastRunAt
+		if len(fire) > 0 {
+			last := fire[len(fire)-1].UTC()
+			lastRunAt = &last
+		}
+		if err := s.db.AdvanceSchedule(ctx, sched.ScheduleID, nextRunAt, lastRunAt); err != nil {
+			s.logger.Error("Failed to advance schedule", "scheduleID", sched.ScheduleID, "error", err)
+			continue
+		}
+		for _, at := range fire {
+			s.runSchedule(ctx, sched, at)
+		}
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+// runSchedule starts the conversation for one firing of sched, due at at,
+// and records the run, failed or not.
+func (s *Server) runSchedule(ctx context.Context, sched generated.Schedule, at time.Time) (*generated.ScheduleRun, error) {
+	params := generated.CreateScheduleRunParams{
+		ScheduleID:   sched.ScheduleID,
+		ScheduledFor: at.UTC(),
+	}
+	conversationID, err := s.startScheduledConversation(ctx, sched, at)
+	if conversationID != "" {
+		params.ConversationID = &conversationID
+	}
+	if err != nil {
+		s.logger.Error("Scheduled conversation failed to start", "scheduleID", sched.ScheduleID, "conversationID", conversationID, "error", err)
+		msg := err.Error()
+		params.Error = &msg
+	}
+	run, err := s.db.CreateScheduleRun(ctx, params)
+	if err != nil {
+		s.logger.Error("Failed to record schedule run", "scheduleID", sched.ScheduleID, "error", err)
+	}
+	return run, err
+}
+
+// startScheduledConversation starts a new conversation with sched's
+// prompt. It returns the conversation's id even if the prompt could not
+// be sent.
+func (s *Server) startScheduledConversation(ctx context.Context, sched generated.Schedule, at time.Time) (string, error) {
+	var opts db.ConversationOptions
+	if err := json.Unmarshal([]byte(sched.ConversationOptions), &opts); err != nil {
+		return "", fmt.Errorf("decode conversation options: %w", err)
+	}
+	return s.startConversation(ctx, derefString(sched.Model), sched.Cwd, opts, nil, scheduledPrompt(sched, at))
+}
+
+// scheduledPrompt is sched's prompt with a note of where it came from, so
+// the conversation can find the schedule and the conversation that made it.
+func scheduledPrompt(sched generated.Schedule, at time.Time) string {
+	note := fmt.Sprintf("This conversation was started by schedule %q (%s) for %s", sched.Name, sched.ScheduleID, at.Format(time.RFC3339))
+	if sched.OriginConversationID != nil {
+		note += ", which was created in conversation " + *sched.OriginConversationID
+	}
+	return sched.Prompt + "\n\n[" + note + ".]"
+}
+
+func (s *Server) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	scheds, err := s.db.ListSchedules(r.Context())
+	if err != nil {
+		s.logger.Error("Failed to list schedules", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	out := make([]ScheduleAPI, 0, len(scheds))
+	for _, sched := range scheds {
+		out = append(out, toScheduleAPI(sched))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (s *Server) handleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	params, err := s.newScheduleParams(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sched, err := s.db.CreateSchedule(r.Context(), params)
+	if err != nil {
+		s.logger.Error("Failed to create schedule", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.wakeScheduler()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toScheduleAPI(*sched))
+}
+
+func (s *Server) handleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sched, err := s.db.GetSchedule(ctx, r.PathValue("id"))
+	if err != nil {
+		s.logger.Error("Failed to get schedule", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if sched == nil {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	runs, err := s.db.ListScheduleRuns(ctx, sched.ScheduleID, scheduleRunHistory)
+	if err != nil {
+		s.logger.Error("Failed to list schedule runs", "scheduleID", sched.ScheduleID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	out := toScheduleAPI(*sched)
+	out.Runs = runs
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleUpdateSchedule replaces a schedule. Its next run is worked out
+// afresh, so firings missed while it was paused are not caught up.
+func (s *Server) handleUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	p, err := s.scheduleParams(req, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.ScheduleID = r.PathValue("id")
+	sched, err := s.db.UpdateSchedule(r.Context(), p)
+	if err != nil {
+		s.logger.Error("Failed to update schedule", "scheduleID", p.ScheduleID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if sched == nil {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	s.wakeScheduler()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toScheduleAPI(*sched))
+}
+
+func (s *Server) handleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.db.DeleteSchedule(r.Context(), r.PathValue("id"))
+	if err != nil {
+		s.logger.Error("Failed to delete schedule", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRunSchedule fires a schedule now, whether or not it is due or
+// enabled. Its next regular run is unaffected.
+func (s *Server) handleRunSchedule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sched, err := s.db.GetSchedule(ctx, r.PathValue("id"))
+	if err != nil {
+		s.logger.Error("Failed to get schedule", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if sched == nil {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	run, err := s.runSchedule(context.WithoutCancel(ctx), *sched, time.Now())
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(run)
+}
+
+// serverScheduler gives the schedule tool access to the server's
+// schedules.
+type serverScheduler struct {
+	s *Server
+}
+
+func toScheduleInfo(sched generated.Schedule) claudetool.ScheduleInfo {
+	return claudetool.ScheduleInfo{
+		ID:        sched.ScheduleID,
+		Name:      sched.Name,
+		Cron:      derefString(sched.Cron),
+		RunAt:     sched.RunAt,
+		Timezone:  sched.Timezone,
+		Prompt:    sched.Prompt,
+		Model:     derefString(sched.Model),
+		Cwd:       derefString(sched.Cwd),
+		CatchUp:   sched.CatchUp,
+		Enabled:   sched.Enabled,
+		NextRunAt: sched.NextRunAt,
+		LastRunAt: sched.LastRunAt,
+	}
+}
+
+func (ss serverScheduler) CreateSchedule(ctx context.Context, spec claudetool.ScheduleSpec) (*claudetool.ScheduleInfo, error) {
+	req := ScheduleRequest{
+		Name:     spec.Name,
+		Cron:     spec.Cron,
+		Timezone: spec.Timezone,
+		Prompt:   spec.Prompt,
+		Model:    spec.Model,
+		Cwd:      spec.Cwd,
+		ConversationOptions: &db.ConversationOptions{
+			ToolOverrides:        spec.ToolOverrides,
+			DisableNotifications: spec.DisableNotifications,
+		},
+		CatchUp:              spec.CatchUp,
+		OriginConversationID: spec.OriginConversationID,
+	}
+	if !spec.RunAt.IsZero() {
+		req.RunAt = &spec.RunAt
+	}
+	params, err := ss.s.newScheduleParams(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	sched, err := ss.s.db.CreateSchedule(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	ss.s.wakeScheduler()
+	info := toScheduleInfo(*sched)
+	return &info, nil
+}
+
+func (ss serverScheduler) ListSchedules(ctx context.Context) ([]claudetool.ScheduleInfo, error) {
+	scheds, err := ss.s.db.ListSchedules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]claudetool.ScheduleInfo, 0, len(scheds))
+	for _, sched := range scheds {
+		out = append(out, toScheduleInfo(sched))
+	}
+	return out, nil
+}
+
+func (ss serverScheduler) SetScheduleEnabled(ctx context.Context, scheduleID string, enabled bool) (*claudetool.ScheduleInfo, error) {
+	sched, err := ss.s.db.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if sched == nil {
+		return nil, fmt.Errorf("no schedule %s", scheduleID)
+	}
+	req := scheduleRequest(*sched)
+	req.Enabled = &enabled
+	p, err := ss.s.scheduleParams(req, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	p.ScheduleID = scheduleID
+	if sched, err = ss.s.db.UpdateSchedule(ctx, p); err != nil {
+		return nil, err
+	}
+	if sched == nil {
+		return nil, fmt.Errorf("no schedule %s", scheduleID)
+	}
+	ss.s.wakeScheduler()
+	info := toScheduleInfo(*sched)
+	return &info, nil
+}
+
+func (ss serverScheduler) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	deleted, err := ss.s.db.DeleteSchedule(ctx, scheduleID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("no schedule %s", scheduleID)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+)
+
+func TestScheduleCRUD(t *testing.T) {
+	t.Parallel()
+	server, _, _ := newTestServer(t)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	for _, body := range []string{
+		`{"name":"x","prompt":"p"}`,
+		`{"name":"x","prompt":"p","cron":"@daily","run_at":"2030-01-01T00:00:00Z"}`,
+		`{"name":"x","prompt":"p","cron":"61 * * * *"}`,
+		`{"name":"x","prompt":"p","cron":"0 0 30 2 *"}`,
+		`{"name":"x","prompt":"p","cron":"@daily","timezone":"Mars/Olympus"}`,
+		`{"name":"x","prompt":"p","cron":"@daily","catch_up":"sometimes"}`,
+		`{"name":"x","prompt":"p","run_at":"` + past + `"}`,
+	} {
+		if w := do("POST", "/api/schedules", body); w.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status=%d body=%s", body, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("POST", "/api/schedules", `{"name":"report","prompt":"Summarize the logs.","cron":"0 9 * * mon-fri","timezone":"UTC","catch_up":"skip"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status=%d body=%s", w.Code, w.Body.String())
+	}
+	var created ScheduleAPI
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !created.Enabled || created.CatchUp != "skip" || created.NextRunAt == nil || created.NextRunAt.UTC().Hour() != 9 {
+		t.Errorf("created = %+v", created)
+	}
+
+	var list []ScheduleAPI
+	json.Unmarshal(do("GET", "/api/schedules", "").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ScheduleID != created.ScheduleID {
+		t.Errorf("list = %+v", list)
+	}
+
+	path := "/api/schedules/" + created.ScheduleID
+	w = do("PUT", path, `{"name":"report","prompt":"Summarize the logs.","cron":"@hourly","enabled":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: status=%d body=%s", w.Code, w.Body.String())
+	}
+	var updated ScheduleAPI
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	if updated.Enabled || updated.Cron != "@hourly" || updated.CatchUp != "once" {
+		t.Errorf("updated = %+v", updated)
+	}
+	if w := do("PUT", "/api/schedules/sched-nope", `{"name":"x","prompt":"p","cron":"@daily"}`); w.Code != http.StatusNotFound {
+		t.Errorf("update missing: status=%d", w.Code)
+	}
+
+	if w := do("DELETE", path, ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status=%d", w.Code)
+	}
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted: status=%d", w.Code)
+	}
+	if w := do("DELETE", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete twice: status=%d", w.Code)
+	}
+}
+
+func TestRunDueSchedules(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	ctx := context.Background()
+	origin, err := database.CreateConversation(ctx, nil, true, nil, nil, db.ConversationOptions{})
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+
+	now := time.Date(2026, 5, 1, 12, 30, 0, 0, time.UTC)
+	hourly := "@hourly"
+	create := func(id, catchUp string, cron *string, next time.Time) {
+		t.Helper()
+		p := generated.CreateScheduleParams{
+			ScheduleID:           id,
+			Name:                 id,
+			Cron:                 cron,
+			Timezone:             "UTC",
+			Prompt:               "echo: " + id,
+			ConversationOptions:  "{}",
+			CatchUp:              catchUp,
+			Enabled:              true,
+			OriginConversationID: &origin.ConversationID,
+			NextRunAt:            &next,
+		}
+		if cron == nil {
+			p.RunAt = &next
+		}
+		if _, err := database.CreateSchedule(ctx, p); err != nil {
+			t.Fatalf("create schedule: %v", err)
+		}
+	}
+	// Missed 10:00, 11:00 and 12:00.
+	create("all", "all", &hourly, now.Add(-150*time.Minute))
+	create("skip", "skip", &hourly, now.Add(-150*time.Minute))
+	create("oneshot", "once", nil, now.Add(-time.Minute))
+	create("later", "once", &hourly, now.Add(20*time.Second))
+
+	if wait := server.runDueSchedules(ctx, now); wait != 20*time.Second {
+		t.Errorf("wait = %v, want 20s", wait)
+	}
+
+	for id, want := range map[string]int{"all": 3, "skip": 0, "oneshot": 1, "later": 0} {
+		runs, err := database.ListScheduleRuns(ctx, id, 10)
+		if err != nil {
+			t.Fatalf("list runs: %v", err)
+		}
+		if len(runs) != want {
+			t.Errorf("%s: %d runs, want %d", id, len(runs), want)
+		}
+		sched, err := database.GetSchedule(ctx, id)
+		if err != nil {
+			t.Fatalf("get schedule: %v", err)
+		}
+		switch id {
+		case "oneshot":
+			if sched.NextRunAt != nil {
+				t.Errorf("one-shot still due at %v", sched.NextRunAt)
+			}
+		case "later":
+			if !sched.NextRunAt.Equal(now.Add(20 * time.Second)) {
+				t.Errorf("later moved to %v", sched.NextRunAt)
+			}
+		default:
+			if !sched.NextRunAt.Equal(now.Add(30*time.Minute)) || (want > 0) != (sched.LastRunAt != nil) {
+				t.Errorf("%s: next=%v last=%v", id, sched.NextRunAt, sched.LastRunAt)
+			}
+		}
+		for _, run := range runs {
+			if run.Error != nil || run.ConversationID == nil {
+				t.Fatalf("%s: run %+v", id, run)
+			}
+			msgs, err := database.ListMessagesByType(ctx, *run.ConversationID, db.MessageTypeUser)
+			if err != nil || len(msgs) == 0 {
+				t.Fatalf("%s: messages = %v, %v", id, msgs, err)
+			}
+			if body := derefString(msgs[0].LlmData); !strings.Contains(body, "echo: "+id) || !strings.Contains(body, origin.ConversationID) {
+				t.Errorf("%s: prompt = %s", id, body)
+			}
+		}
+	}
+
+	// Nothing is due any more.
+	server.runDueSchedules(ctx, now)
+	if runs, _ := database.ListScheduleRuns(ctx, "all", 10); len(runs) != 3 {
+		t.Errorf("fired again: %d runs", len(runs))
+	}
+}
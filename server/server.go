@@ -23,6 +23,7 @@ import (
 	"tailscale.com/util/singleflight"
 
 	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/claudetool/approval"
 	"shelley.exe.dev/db"
 	"shelley.exe.dev/db/generated"
 	"shelley.exe.dev/llm"
@@ -72,6 +73,9 @@ type ConversationState struct {
 	ConversationID string `json:"conversation_id"`
 	Working        bool   `json:"working"`
 	Model          string `json:"model,omitempty"`
+	// PendingApprovals are tool calls paused until the user answers them via
+	// POST /api/conversation/<id>/approve.
+	PendingApprovals []approval.Request `json:"pending_approvals,omitempty"`
 }
 
 // ConversationWithState combines a conversation with its working state.
@@ -128,6 +132,9 @@ type StreamResponse struct {
 	ToolProgress *llm.ToolProgress `json:"tool_progress,omitempty"`
 	// StreamDelta is set when the LLM streams partial text content.
 	StreamDelta *llm.StreamDelta `json:"stream_delta,omitempty"`
+	// ApprovalRequest is set when a tool call is paused waiting for the user
+	// to approve or reject it.
+	ApprovalRequest *approval.Request `json:"approval_request,omitempty"`
 	// MaxSequenceID, when non-zero, reports the highest message sequence_id
 	// known for this conversation. Set by the REST GET /api/conversation/<id>
 	// handler (computed from the returned message list) so the client can
@@ -376,6 +383,28 @@ type Server struct {
 	listenPort int           // TCP port the server is listening on
 	terminals  *TerminalSessions
 
+	// scheduleWake tells the schedule routine that schedules changed.
+	scheduleWake chan struct{}
+
+	// AutoCompact holds the server-wide automatic compaction settings,
+	// which conversations may override. Set from shelley.json's
+	// auto_compact by `serve`.
+	AutoCompact db.AutoCompactOptions
+
+	// Budget and SubagentBudget are the server-wide budgets of top-level
+	// and subagent conversations, which conversations may override. Set
+	// from shelley.json's budget and subagent_budget by `serve`.
+	Budget         db.BudgetOptions
+	SubagentBudget db.BudgetOptions
+
+	// ModelFallbacks are the server's model fallback chains. Set from
+	// shelley.json's model_fallbacks by `serve`.
+	ModelFallbacks ModelFallbacks
+
+	// ApprovalTimeout is how long a tool call waits for the user to answer
+	// an approval request before it is rejected. Zero means ten minutes.
+	ApprovalTimeout time.Duration
+
 	// Banner, when non-empty, is shown in a full-width bar at the top of
 	// the UI. Useful for marking demo instances so they're not confused
 	// with the primary Shelley. Set by `serve --banner`.
@@ -389,8 +418,9 @@ type Server struct {
 	hooksDir string
 
 	// piDistillKeepRecentTokens overrides the pi-distillation recent-token
-	// retention budget. Zero means use defaultPiDistillSettings. Tests set it
-	// to force summarization without a giant transcript.
+	// retention budget of conversations that don't set keep_recent_tokens.
+	// Zero means use defaultPiDistillSettings. Tests set it to force
+	// summarization without a giant transcript.
 	piDistillKeepRecentTokens int
 
 	// IndexedDB cache encryption master secret — see cache_key.go.
@@ -398,6 +428,15 @@ type Server struct {
 	// independent DBs don't share state.
 	cacheMasterSecretMu    sync.Mutex
 	cacheMasterSecretCache []byte
+
+	// Key share link tokens are signed with — see share.go.
+	shareSecretMu    sync.Mutex
+	shareSecretCache []byte
+
+	// Streams open on share links, by share ID, so revoking a link can
+	// end them — see share.go.
+	shareStreamsMu sync.Mutex
+	shareStreams   map[string]map[*shareStream]struct{}
 }
 
 // NewServer creates a new server instance
@@ -414,6 +453,7 @@ func NewServer(database *db.DB, llmManager LLMProvider, toolSetConfig claudetool
 		versionChecker:      NewVersionChecker(),
 		notifDispatcher:     notifications.NewDispatcher(logger),
 		shutdownCh:          make(chan struct{}),
+		scheduleWake:        make(chan struct{}, 1),
 		hooksDir:            defaultHooksDir(),
 	}
 
@@ -451,6 +491,7 @@ func NewServer(database *db.DB, llmManager LLMProvider, toolSetConfig claudetool
 	s.toolSetConfig.SubagentRunner = NewSubagentRunner(s)
 	s.toolSetConfig.SubagentDB = &db.SubagentDBAdapter{DB: database}
 	s.toolSetConfig.MaxSubagentDepth = 1 // Only top-level conversations can spawn subagents
+	s.toolSetConfig.Scheduler = serverScheduler{s}
 
 	return s
 }
@@ -476,8 +517,11 @@ func (s *Server) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("/api/conversations/archived", compressionHandler(http.HandlerFunc(s.handleArchivedConversations)))
 	mux.Handle("/api/conversations/new", http.HandlerFunc(s.handleNewConversation))                         // Small response
 	mux.Handle("POST /api/conversations/draft", http.HandlerFunc(s.handleCreateDraft))                      // Small response
+	mux.Handle("POST /api/conversations/import", http.HandlerFunc(s.handleImportConversation))              // Small response
 	mux.Handle("/api/conversations/distill-new-generation", http.HandlerFunc(s.handleDistillNewGeneration)) // Small response
 	mux.Handle("/api/conversation/", http.StripPrefix("/api/conversation", s.conversationMux()))
+	// Read-only access through share links; exempt from -require-header
+	mux.Handle("/api/shared/", http.StripPrefix("/api/shared", s.sharedMux()))
 	mux.Handle("/api/conversation-by-slug/", compressionHandler(http.HandlerFunc(s.handleConversationBySlug)))
 	mux.Handle("/api/validate-cwd", http.HandlerFunc(s.handleValidateCwd)) // Small response
 	mux.Handle("POST /api/model-costs", http.HandlerFunc(s.handleModelCosts))
@@ -518,6 +562,24 @@ func (s *Server) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("/api/notification-channels/", http.HandlerFunc(s.handleNotificationChannel))
 	mux.Handle("/api/notification-channel-types", http.HandlerFunc(s.handleNotificationChannelTypes))
 
+	// Schedules API
+	mux.Handle("GET /api/schedules", http.HandlerFunc(s.handleListSchedules))
+	mux.Handle("POST /api/schedules", http.HandlerFunc(s.handleCreateSchedule))
+	mux.Handle("GET /api/schedules/{id}", http.HandlerFunc(s.handleGetSchedule))
+	mux.Handle("PUT /api/schedules/{id}", http.HandlerFunc(s.handleUpdateSchedule))
+	mux.Handle("DELETE /api/schedules/{id}", http.HandlerFunc(s.handleDeleteSchedule))
+	mux.Handle("POST /api/schedules/{id}/run", http.HandlerFunc(s.handleRunSchedule))
+
+	// Triggers API. POST /api/triggers/{name} fires a trigger and is
+	// authenticated by its secret; the rest manage them.
+	mux.Handle("GET /api/triggers", http.HandlerFunc(s.handleListTriggers))
+	mux.Handle("POST /api/triggers", http.HandlerFunc(s.handleCreateTrigger))
+	mux.Handle("GET /api/triggers/{name}", http.HandlerFunc(s.handleGetTrigger))
+	mux.Handle("PUT /api/triggers/{name}", http.HandlerFunc(s.handleUpdateTrigger))
+	mux.Handle("DELETE /api/triggers/{name}", http.HandlerFunc(s.handleDeleteTrigger))
+	mux.Handle("POST /api/triggers/{name}", http.HandlerFunc(s.handleFireTrigger))
+	mux.Handle("POST /api/triggers/{name}/secret", http.HandlerFunc(s.handleRotateTriggerSecret))
+
 	// Models API (dynamic list refresh)
 	mux.Handle("POST /api/models/refresh", compressionHandler(http.HandlerFunc(s.handleModelRefresh)))
 	mux.Handle("/api/models", compressionHandler(http.HandlerFunc(s.handleModels)))
@@ -945,6 +1007,11 @@ func (s *Server) getOrCreateConversationManager(ctx context.Context, conversatio
 		manager := NewConversationManager(conversationID, s.db, s.logger, s.toolSetConfig, recordMessage, recordTurnStart, recordBatch, onStateChange, s.streamPub)
 		manager.userEmail = userEmail
 		manager.serverPort = s.listenPort
+		s.wireAutoCompact(manager)
+		s.wireBudget(manager)
+		s.wireModelFallback(manager)
+		manager.hooksDir = s.hooksDir
+		manager.approvalTimeout = s.ApprovalTimeout
 		// Hydrate runs DB transactions, which fire OnCommit hooks. Those hooks
 		// (e.g. notify on the conversation list patch stream) acquire s.mu, so
 		// we must not hold it here.
@@ -1001,6 +1068,11 @@ func (s *Server) getOrCreateSubagentConversationManager(ctx context.Context, con
 
 		manager := NewConversationManager(conversationID, s.db, s.logger, subagentConfig, recordMessage, recordTurnStart, recordBatch, onStateChange, s.streamPub)
 		manager.serverPort = s.listenPort
+		s.wireAutoCompact(manager)
+		s.wireBudget(manager)
+		s.wireModelFallback(manager)
+		manager.hooksDir = s.hooksDir
+		manager.approvalTimeout = s.ApprovalTimeout
 		// Wire up done notification: when this subagent finishes, notify the
 		// parent by splicing a synthetic tool_use/result pair into the
 		// parent's conversation. dispatchSubagentDone captures the completed
@@ -1277,6 +1349,9 @@ func (s *Server) recordMessages(ctx context.Context, conversationID string, msgs
 		if err != nil {
 			return err
 		}
+		if m.replay {
+			params.MarkAgentDone = false
+		}
 		paramsList = append(paramsList, params)
 	}
 	// Whether any message ends the turn — used to sync the manager's in-memory
@@ -1317,6 +1392,9 @@ type recordMessageInput struct {
 	usage      llm.Usage
 	otherUsage []llm.PurposedUsage
 	userData   []interface{}
+	// replay marks a verbatim copy of an earlier message (a compaction's
+	// carried tail). It never ends the turn, even if the original did.
+	replay bool
 }
 
 // getMessageType determines the message type from an LLM message
@@ -1860,6 +1938,9 @@ func (s *Server) StartWithListeners(tcpListener net.Listener, socketPath string)
 	// Start auto-upgrade routine
 	go s.autoUpgradeRoutine()
 
+	// Start firing scheduled conversations
+	go s.scheduleRoutine()
+
 	// Get actual port from listener
 	actualPort := tcpListener.Addr().(*net.TCPAddr).Port
 	s.listenPort = actualPort
@@ -0,0 +1,520 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"shelley.exe.dev/db/generated"
+	"shelley.exe.dev/llm"
+)
+
+// Share links give read-only access to one conversation — its snapshot and
+// live stream, and optionally its subagents' — to whoever holds the token,
+// under /api/shared/<token>/. Those routes are exempt from -require-header,
+// so a teammate can follow a link without access to the rest of the
+// instance.
+//
+// A token is "<share_id>.<expires unix>.<signature>", the signature being an
+// HMAC-SHA256 of the first two parts under a per-instance secret. The
+// signature lets forged tokens be rejected without a lookup; the share_links
+// row is what makes a link revocable.
+
+const (
+	shareSecretKey = "share_link_secret"
+
+	defaultShareLinkTTL = 24 * time.Hour
+	maxShareLinkTTL     = 30 * 24 * time.Hour
+
+	// maxShareSubagentDepth bounds the walk from a subagent up to the shared
+	// conversation. Subagents nest far less deeply than this.
+	maxShareSubagentDepth = 8
+)
+
+// errShareLinkInvalid covers every reason a token grants nothing: a bad
+// signature, an unknown, revoked or expired link. Callers answer all of them
+// alike so a token holder learns nothing about why.
+var errShareLinkInvalid = errors.New("share link not found or expired")
+
+// shareSecret returns the key share tokens are signed with, creating it on
+// first use. Replacing it invalidates every outstanding token.
+func (s *Server) shareSecret(ctx context.Context) ([]byte, error) {
+	s.shareSecretMu.Lock()
+	defer s.shareSecretMu.Unlock()
+	if s.shareSecretCache != nil {
+		return s.shareSecretCache, nil
+	}
+	val, err := s.db.GetSetting(ctx, shareSecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("get share secret: %w", err)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(val); val != "" && err == nil && len(decoded) == 32 {
+		s.shareSecretCache = decoded
+		return s.shareSecretCache, nil
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate share secret: %w", err)
+	}
+	if err := s.db.SetSetting(ctx, shareSecretKey, base64.StdEncoding.EncodeToString(secret)); err != nil {
+		return nil, fmt.Errorf("persist share secret: %w", err)
+	}
+	s.shareSecretCache = secret
+	return s.shareSecretCache, nil
+}
+
+func signShare(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// shareToken returns the token for link.
+func (s *Server) shareToken(ctx context.Context, link *generated.ShareLink) (string, error) {
+	secret, err := s.shareSecret(ctx)
+	if err != nil {
+		return "", err
+	}
+	payload := link.ShareID + "." + strconv.FormatInt(link.ExpiresAt.Unix(), 10)
+	return payload + "." + signShare(secret, payload), nil
+}
+
+// resolveShareToken returns the link a token was issued for, or
+// errShareLinkInvalid if it grants nothing now.
+func (s *Server) resolveShareToken(ctx context.Context, token string) (*generated.ShareLink, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errShareLinkInvalid
+	}
+	secret, err := s.shareSecret(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(signShare(secret, parts[0]+"."+parts[1]))) {
+		return nil, errShareLinkInvalid
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	now := time.Now()
+	if err != nil || now.Unix() >= expires {
+		return nil, errShareLinkInvalid
+	}
+	link, err := s.db.GetShareLink(ctx, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if link == nil || link.RevokedAt != nil || !now.Before(link.ExpiresAt) {
+		return nil, errShareLinkInvalid
+	}
+	return link, nil
+}
+
+// shareGrants reports whether link grants access to conversationID: the
+// shared conversation itself or, if the link includes them, any subagent
+// beneath it.
+func (s *Server) shareGrants(ctx context.Context, link *generated.ShareLink, conversationID string) (bool, error) {
+	if conversationID == link.ConversationID {
+		return true, nil
+	}
+	if !link.IncludeSubagents {
+		return false, nil
+	}
+	id := conversationID
+	for range maxShareSubagentDepth {
+		var conv generated.Conversation
+		err := s.db.Queries(ctx, func(q *generated.Queries) error {
+			var err error
+			conv, err = q.GetConversation(ctx, id)
+			return err
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if conv.ParentConversationID == nil {
+			return false, nil
+		}
+		if *conv.ParentConversationID == link.ConversationID {
+			return true, nil
+		}
+		id = *conv.ParentConversationID
+	}
+	return false, nil
+}
+
+// shareView returns the stream view of conversationID a link's holder gets.
+// Frames are rebuilt from the fields a viewer needs, so approvals,
+// notifications, the conversation list and other conversations' state
+// never reach them.
+func shareView(link *generated.ShareLink, conversationID string) streamView {
+	return func(resp StreamResponse) (StreamResponse, bool) {
+		if resp.ConversationID != "" && resp.ConversationID != conversationID {
+			return resp, false
+		}
+		out := StreamResponse{
+			ConversationID:    resp.ConversationID,
+			Messages:          resp.Messages,
+			ContextWindowSize: resp.ContextWindowSize,
+			StreamDelta:       resp.StreamDelta,
+			MaxSequenceID:     resp.MaxSequenceID,
+			Heartbeat:         resp.Heartbeat,
+			SnapshotComplete:  resp.SnapshotComplete,
+		}
+		if resp.Conversation != nil && resp.Conversation.ConversationID == conversationID {
+			out.Conversation = resp.Conversation
+		}
+		if resp.ConversationState != nil && resp.ConversationState.ConversationID == conversationID {
+			state := *resp.ConversationState
+			state.PendingApprovals = nil
+			out.ConversationState = &state
+		}
+		if link.RedactToolOutput {
+			out.Messages = redactToolOutput(out.Messages)
+		} else {
+			out.ToolProgress = resp.ToolProgress
+		}
+		empty := out.Messages == nil && out.Conversation == nil && out.ConversationState == nil &&
+			out.StreamDelta == nil && out.ToolProgress == nil && !out.Heartbeat && !out.SnapshotComplete
+		return out, !empty
+	}
+}
+
+// redactedToolOutput replaces the result of every tool call in a redacting
+// share.
+const redactedToolOutput = "[tool output redacted]"
+
+// redactToolOutput returns messages with tool results replaced by a
+// placeholder and the display data derived from them dropped. Tool calls
+// themselves are kept.
+func redactToolOutput(messages []APIMessage) []APIMessage {
+	if messages == nil {
+		return nil
+	}
+	out := make([]APIMessage, len(messages))
+	for i, m := range messages {
+		out[i] = m
+		if m.LlmData == nil {
+			continue
+		}
+		var msg llm.Message
+		if err := json.Unmarshal([]byte(*m.LlmData), &msg); err != nil {
+			out[i].LlmData = nil
+			out[i].DisplayData = nil
+			continue
+		}
+		redacted := false
+		for j, c := range msg.Content {
+			if c.Type != llm.ContentTypeToolResult {
+				continue
+			}
+			msg.Content[j] = llm.Content{
+				Type:             c.Type,
+				ToolUseID:        c.ToolUseID,
+				ToolError:        c.ToolError,
+				ToolResult:       []llm.Content{{Type: llm.ContentTypeText, Text: redactedToolOutput}},
+				ToolUseStartTime: c.ToolUseStartTime,
+				ToolUseEndTime:   c.ToolUseEndTime,
+			}
+			redacted = true
+		}
+		if !redacted {
+			continue
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			out[i].LlmData = nil
+		} else {
+			s := string(data)
+			out[i].LlmData = &s
+		}
+		out[i].DisplayData = nil
+	}
+	return out
+}
+
+// ShareLinkInfo is a share link as the management API returns it. Token
+// and URL are empty once the link is revoked.
+type ShareLinkInfo struct {
+	generated.ShareLink
+	Token string `json:"token,omitempty"`
+	// URL is the path of the shared conversation's snapshot.
+	URL string `json:"url,omitempty"`
+}
+
+func (s *Server) shareLinkInfo(ctx context.Context, link *generated.ShareLink) (ShareLinkInfo, error) {
+	info := ShareLinkInfo{ShareLink: *link}
+	if link.RevokedAt != nil {
+		return info, nil
+	}
+	token, err := s.shareToken(ctx, link)
+	if err != nil {
+		return info, err
+	}
+	info.Token = token
+	info.URL = "/api/shared/" + token + "/conversation/" + link.ConversationID
+	return info, nil
+}
+
+// CreateShareLinkRequest is the body of POST /api/conversation/<id>/shares.
+type CreateShareLinkRequest struct {
+	// ExpiresIn is a Go duration; it defaults to 24h and may be at most 720h.
+	ExpiresIn        string `json:"expires_in,omitempty"`
+	IncludeSubagents bool   `json:"include_subagents,omitempty"`
+	RedactToolOutput bool   `json:"redact_tool_output,omitempty"`
+}
+
+// handleCreateShareLink handles POST /api/conversation/<id>/shares.
+func (s *Server) handleCreateShareLink(w http.ResponseWriter, r *http.Request, conversationID string) {
+	ctx := r.Context()
+	var req CreateShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	ttl := defaultShareLinkTTL
+	if req.ExpiresIn != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 || ttl > maxShareLinkTTL {
+			http.Error(w, fmt.Sprintf("expires_in must be a positive duration of at most %v", maxShareLinkTTL), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := s.db.Queries(ctx, func(q *generated.Queries) error {
+		_, err := q.GetConversation(ctx, conversationID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to get conversation", "conversationID", conversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	link, err := s.db.CreateShareLink(ctx, generated.CreateShareLinkParams{
+		ShareID:          "sh" + rand.Text()[:16],
+		ConversationID:   conversationID,
+		IncludeSubagents: req.IncludeSubagents,
+		RedactToolOutput: req.RedactToolOutput,
+		// Tokens carry the expiry in whole seconds.
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second).UTC(),
+	})
+	if err != nil {
+		s.logger.Error("Failed to create share link", "conversationID", conversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	info, err := s.shareLinkInfo(ctx, link)
+	if err != nil {
+		s.logger.Error("Failed to sign share link", "shareID", link.ShareID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// handleListShareLinks handles GET /api/conversation/<id>/shares.
+func (s *Server) handleListShareLinks(w http.ResponseWriter, r *http.Request, conversationID string) {
+	ctx := r.Context()
+	links, err := s.db.ListShareLinks(ctx, conversationID)
+	if err != nil {
+		s.logger.Error("Failed to list share links", "conversationID", conversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]ShareLinkInfo, 0, len(links))
+	for i := range links {
+		info, err := s.shareLinkInfo(ctx, &links[i])
+		if err != nil {
+			s.logger.Error("Failed to sign share link", "shareID", links[i].ShareID, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		infos = append(infos, info)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+// handleRevokeShareLink handles POST /api/conversation/<id>/shares/<share_id>/revoke.
+func (s *Server) handleRevokeShareLink(w http.ResponseWriter, r *http.Request, conversationID, shareID string) {
+	link, err := s.db.RevokeShareLink(r.Context(), conversationID, shareID)
+	if err != nil {
+		s.logger.Error("Failed to revoke share link", "shareID", shareID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if link == nil {
+		http.Error(w, "Share link not found or already revoked", http.StatusNotFound)
+		return
+	}
+	s.closeShareStreams(shareID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ShareLinkInfo{ShareLink: *link})
+}
+
+// shareStream is a stream open on a share link.
+type shareStream struct {
+	cancel context.CancelFunc
+}
+
+// openShareStream registers a stream on link. The returned context ends
+// when the link expires or is revoked; call done when the stream ends.
+func (s *Server) openShareStream(ctx context.Context, link *generated.ShareLink) (_ context.Context, done func()) {
+	ctx, cancel := context.WithDeadline(ctx, link.ExpiresAt)
+	stream := &shareStream{cancel: cancel}
+	s.shareStreamsMu.Lock()
+	if s.shareStreams == nil {
+		s.shareStreams = make(map[string]map[*shareStream]struct{})
+	}
+	if s.shareStreams[link.ShareID] == nil {
+		s.shareStreams[link.ShareID] = make(map[*shareStream]struct{})
+	}
+	s.shareStreams[link.ShareID][stream] = struct{}{}
+	s.shareStreamsMu.Unlock()
+	return ctx, func() {
+		cancel()
+		s.shareStreamsMu.Lock()
+		defer s.shareStreamsMu.Unlock()
+		delete(s.shareStreams[link.ShareID], stream)
+		if len(s.shareStreams[link.ShareID]) == 0 {
+			delete(s.shareStreams, link.ShareID)
+		}
+	}
+}
+
+// closeShareStreams ends the streams open on a share link.
+func (s *Server) closeShareStreams(shareID string) {
+	s.shareStreamsMu.Lock()
+	defer s.shareStreamsMu.Unlock()
+	for stream := range s.shareStreams[shareID] {
+		stream.cancel()
+	}
+}
+
+// sharedMux serves /api/shared/<token>/..., stripped of "/api/shared".
+func (s *Server) sharedMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	// GET /api/shared/<token> - what the link grants
+	mux.HandleFunc("GET /{token}", s.withShareLink(func(w http.ResponseWriter, r *http.Request, link *generated.ShareLink) {
+		s.handleGetSharedLink(w, r, link)
+	}))
+	// GET /api/shared/<token>/conversation/<id> - snapshot, as GET /api/conversation/<id>
+	mux.Handle("GET /{token}/conversation/{id}", compressionHandler(s.withSharedConversation(func(w http.ResponseWriter, r *http.Request, link *generated.ShareLink, conversationID string) {
+		s.serveConversation(w, r, conversationID, shareView(link, conversationID))
+	})))
+	// GET /api/shared/<token>/conversation/<id>/stream - as the legacy stream
+	// The stream ends when the link expires or is revoked.
+	mux.HandleFunc("GET /{token}/conversation/{id}/stream", s.withSharedConversation(func(w http.ResponseWriter, r *http.Request, link *generated.ShareLink, conversationID string) {
+		ctx, done := s.openShareStream(r.Context(), link)
+		defer done()
+		// A revoke that landed after the token was resolved but before the
+		// stream was registered had nothing to close; check again.
+		current, err := s.db.GetShareLink(ctx, link.ShareID)
+		if err != nil {
+			s.logger.Error("Failed to resolve share link", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if current == nil || current.RevokedAt != nil {
+			http.Error(w, "Share link not found or expired", http.StatusNotFound)
+			return
+		}
+		s.runStream(w, r.WithContext(ctx), conversationID, false, shareView(link, conversationID))
+	}))
+	// GET /api/shared/<token>/conversation/<id>/subagents - only for links including them
+	mux.HandleFunc("GET /{token}/conversation/{id}/subagents", s.withSharedConversation(func(w http.ResponseWriter, r *http.Request, link *generated.ShareLink, conversationID string) {
+		if !link.IncludeSubagents {
+			http.Error(w, "Share link does not include subagents", http.StatusNotFound)
+			return
+		}
+		s.handleGetSubagents(w, r, conversationID)
+	}))
+	return mux
+}
+
+// withShareLink resolves the {token} path value before calling h.
+func (s *Server) withShareLink(h func(http.ResponseWriter, *http.Request, *generated.ShareLink)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, err := s.resolveShareToken(r.Context(), r.PathValue("token"))
+		if errors.Is(err, errShareLinkInvalid) {
+			http.Error(w, "Share link not found or expired", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			s.logger.Error("Failed to resolve share link", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		h(w, r, link)
+	}
+}
+
+// withSharedConversation additionally checks the link grants the {id}
+// conversation.
+func (s *Server) withSharedConversation(h func(http.ResponseWriter, *http.Request, *generated.ShareLink, string)) http.HandlerFunc {
+	return s.withShareLink(func(w http.ResponseWriter, r *http.Request, link *generated.ShareLink) {
+		conversationID := r.PathValue("id")
+		ok, err := s.shareGrants(r.Context(), link, conversationID)
+		if err != nil {
+			s.logger.Error("Failed to check share link", "shareID", link.ShareID, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		h(w, r, link, conversationID)
+	})
+}
+
+// SharedLink is the response of GET /api/shared/<token>.
+type SharedLink struct {
+	ConversationID   string    `json:"conversation_id"`
+	Slug             *string   `json:"slug,omitempty"`
+	IncludeSubagents bool      `json:"include_subagents"`
+	RedactToolOutput bool      `json:"redact_tool_output"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+func (s *Server) handleGetSharedLink(w http.ResponseWriter, r *http.Request, link *generated.ShareLink) {
+	ctx := r.Context()
+	var conv generated.Conversation
+	err := s.db.Queries(ctx, func(q *generated.Queries) error {
+		var err error
+		conv, err = q.GetConversation(ctx, link.ConversationID)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("Failed to get shared conversation", "conversationID", link.ConversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SharedLink{
+		ConversationID:   link.ConversationID,
+		Slug:             conv.Slug,
+		IncludeSubagents: link.IncludeSubagents,
+		RedactToolOutput: link.RedactToolOutput,
+		ExpiresAt:        link.ExpiresAt,
+	})
+}
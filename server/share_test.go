@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/claudetool/approval"
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+	"shelley.exe.dev/llm"
+)
+
+func createShareLink(t *testing.T, server *Server, conversationID, body string) ShareLinkInfo {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/conversation/"+conversationID+"/shares", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.handleCreateShareLink(w, req, conversationID)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create share link: status=%d body=%s", w.Code, w.Body.String())
+	}
+	var info ShareLinkInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode share link: %v", err)
+	}
+	return info
+}
+
+func TestShareLinkSnapshot(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	ctx := context.Background()
+	conv := seedExportConversation(t, database)
+	subs, err := database.GetSubagents(ctx, conv.ConversationID)
+	if err != nil || len(subs) != 1 {
+		t.Fatalf("subagents = %v, %v", subs, err)
+	}
+	other, err := database.CreateConversation(ctx, nil, true, nil, nil, db.ConversationOptions{})
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	handler := RequireHeaderMiddleware("X-Exedev-Userid")(mux)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	plain := createShareLink(t, server, conv.ConversationID, "")
+	if want := "/api/shared/" + plain.Token + "/conversation/" + conv.ConversationID; plain.URL != want {
+		t.Errorf("url = %q, want %q", plain.URL, want)
+	}
+	if d := time.Until(plain.ExpiresAt); d < 23*time.Hour || d > 24*time.Hour {
+		t.Errorf("expires in %v, want 24h", d)
+	}
+	w := get(plain.URL)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "main.go") {
+		t.Fatalf("shared snapshot: status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := get("/api/conversation/" + conv.ConversationID); w.Code != http.StatusForbidden {
+		t.Errorf("unshared route without header: status=%d", w.Code)
+	}
+	if w := get("/api/shared/" + plain.Token + "/conversation/" + subs[0].ConversationID); w.Code != http.StatusNotFound {
+		t.Errorf("subagent of a link without subagents: status=%d", w.Code)
+	}
+
+	redacted := createShareLink(t, server, conv.ConversationID, `{"expires_in":"1h","include_subagents":true,"redact_tool_output":true}`)
+	w = get(redacted.URL)
+	if w.Code != http.StatusOK {
+		t.Fatalf("redacted snapshot: status=%d body=%s", w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); strings.Contains(body, "main.go") || !strings.Contains(body, redactedToolOutput) || !strings.Contains(body, `\"command\":\"ls\"`) {
+		t.Errorf("redacted snapshot = %s", body)
+	}
+	prefix := "/api/shared/" + redacted.Token + "/conversation/"
+	if w := get(prefix + subs[0].ConversationID); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Done helping.") {
+		t.Errorf("subagent snapshot: status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := get(prefix + conv.ConversationID + "/subagents"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), subs[0].ConversationID) {
+		t.Errorf("subagents: status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := get(prefix + other.ConversationID); w.Code != http.StatusNotFound {
+		t.Errorf("unrelated conversation: status=%d", w.Code)
+	}
+
+	tampered := strings.Replace(redacted.Token, redacted.ShareID, plain.ShareID, 1)
+	if w := get("/api/shared/" + tampered + "/conversation/" + conv.ConversationID); w.Code != http.StatusNotFound {
+		t.Errorf("tampered token: status=%d", w.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	rw := httptest.NewRecorder()
+	server.handleRevokeShareLink(rw, req, conv.ConversationID, plain.ShareID)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("revoke: status=%d body=%s", rw.Code, rw.Body.String())
+	}
+	if w := get(plain.URL); w.Code != http.StatusNotFound {
+		t.Errorf("revoked link: status=%d", w.Code)
+	}
+	rw = httptest.NewRecorder()
+	server.handleRevokeShareLink(rw, req, conv.ConversationID, plain.ShareID)
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("revoking twice: status=%d", rw.Code)
+	}
+
+	rw = httptest.NewRecorder()
+	server.handleListShareLinks(rw, httptest.NewRequest("GET", "/", nil), conv.ConversationID)
+	var links []ShareLinkInfo
+	json.Unmarshal(rw.Body.Bytes(), &links)
+	if len(links) != 2 {
+		t.Fatalf("links = %+v", links)
+	}
+	for _, l := range links {
+		if revoked := l.ShareID == plain.ShareID; revoked != (l.RevokedAt != nil) || revoked != (l.Token == "") {
+			t.Errorf("link %+v", l)
+		}
+	}
+}
+
+func TestShareLinkExpired(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	ctx := context.Background()
+	conv := seedExportConversation(t, database)
+
+	link, err := database.CreateShareLink(ctx, generated.CreateShareLinkParams{
+		ShareID:        "shexpired",
+		ConversationID: conv.ConversationID,
+		ExpiresAt:      time.Now().Add(-time.Minute).Truncate(time.Second).UTC(),
+	})
+	if err != nil {
+		t.Fatalf("create share link: %v", err)
+	}
+	token, err := server.shareToken(ctx, link)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := server.resolveShareToken(ctx, token); err != errShareLinkInvalid {
+		t.Errorf("expired token: err=%v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"expires_in":"9000h"}`))
+	w := httptest.NewRecorder()
+	server.handleCreateShareLink(w, req, conv.ConversationID)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("too long expires_in: status=%d", w.Code)
+	}
+}
+
+func TestShareLinkStreamEndsOnRevokeAndExpiry(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	ctx := context.Background()
+	conv := seedExportConversation(t, database)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+
+	// stream opens a shared stream and waits for its first frame.
+	stream := func(url string) <-chan struct{} {
+		t.Helper()
+		rec := newFlusherRecorder()
+		req := httptest.NewRequest("GET", url+"/stream", nil)
+		done := make(chan struct{})
+		go func() {
+			mux.ServeHTTP(rec, req)
+			close(done)
+		}()
+		select {
+		case <-rec.flushed:
+		case <-done:
+			t.Fatalf("stream ended at once: status=%d body=%s", rec.Code, rec.Body.String())
+		case <-time.After(5 * time.Second):
+			t.Fatal("no frame within 5s")
+		}
+		return done
+	}
+
+	link := createShareLink(t, server, conv.ConversationID, "")
+	done := stream(link.URL)
+	req := httptest.NewRequest("POST", "/", nil)
+	rw := httptest.NewRecorder()
+	server.handleRevokeShareLink(rw, req, conv.ConversationID, link.ShareID)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("revoke: status=%d body=%s", rw.Code, rw.Body.String())
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after the link was revoked")
+	}
+
+	expiring, err := database.CreateShareLink(ctx, generated.CreateShareLinkParams{
+		ShareID:        "shexpiring",
+		ConversationID: conv.ConversationID,
+		ExpiresAt:      time.Now().Add(2 * time.Second).Truncate(time.Second).UTC(),
+	})
+	if err != nil {
+		t.Fatalf("create share link: %v", err)
+	}
+	token, err := server.shareToken(ctx, expiring)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	done = stream("/api/shared/" + token + "/conversation/" + conv.ConversationID)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after the link expired")
+	}
+	server.shareStreamsMu.Lock()
+	defer server.shareStreamsMu.Unlock()
+	if len(server.shareStreams) != 0 {
+		t.Errorf("streams still registered: %v", server.shareStreams)
+	}
+}
+
+func TestShareView(t *testing.T) {
+	t.Parallel()
+	view := shareView(&generated.ShareLink{RedactToolOutput: true}, "c1")
+
+	for name, frame := range map[string]StreamResponse{
+		"approval":           {ApprovalRequest: &approval.Request{}},
+		"list update":        {ConversationListUpdate: &ConversationListUpdate{Type: "update"}},
+		"other conversation": {ConversationID: "c2", ConversationState: &ConversationState{ConversationID: "c2", Working: true}},
+		"tool progress":      {ToolProgress: &llm.ToolProgress{}},
+	} {
+		if out, ok := view(frame); ok {
+			t.Errorf("%s: passed as %+v", name, out)
+		}
+	}
+
+	out, ok := view(StreamResponse{
+		ConversationID: "c1",
+		ConversationState: &ConversationState{
+			ConversationID:   "c1",
+			Working:          true,
+			PendingApprovals: []approval.Request{{}},
+		},
+		ApprovalRequest: &approval.Request{},
+	})
+	if !ok || out.ApprovalRequest != nil || !out.ConversationState.Working || out.ConversationState.PendingApprovals != nil {
+		t.Errorf("state frame = %+v, %v", out, ok)
+	}
+}
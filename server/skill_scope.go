@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"shelley.exe.dev/llm"
+	"shelley.exe.dev/skills"
+)
+
+// A skill is activated when the agent reads its SKILL.md, normally with
+// `shelley skill cat` as the <available_skills> section of the system prompt
+// tells it to. If the skill lists allowed-tools, the conversation's tool
+// calls are restricted to them until the agent's turn ends; activating
+// another skill replaces the restriction.
+
+// checkSkillScope returns an error, for the LLM, if the active skill does
+// not allow the named tool.
+func (cm *ConversationManager) checkSkillScope(tool string) error {
+	cm.mu.Lock()
+	active := cm.activeSkill
+	cm.mu.Unlock()
+	if active == nil || active.AllowsTool(tool) {
+		return nil
+	}
+	return fmt.Errorf("the %s tool is not available while the %q skill is active; it allows only: %s",
+		tool, active.Name, strings.Join(active.ToolPatterns(), ", "))
+}
+
+// noteSkillActivation activates the skill, if any, whose file a successful
+// bash or shell call printed, and returns the call's result with a note
+// telling the LLM about any tool restriction. Skills are looked up as the
+// system prompt's discovery does, from cwd and its git root.
+func (cm *ConversationManager) noteSkillActivation(ctx context.Context, call llm.Content, content []llm.Content, isError bool, cwd string) []llm.Content {
+	if isError || (call.ToolName != "bash" && call.ToolName != "shell") {
+		return content
+	}
+	var text []string
+	for _, c := range content {
+		if c.Type == llm.ContentTypeText {
+			text = append(text, c.Text)
+		}
+	}
+	skill, ok := skills.ReadSkill(strings.Join(text, "\n"), func() []skills.Skill {
+		var gitRoot string
+		if gitInfo, err := collectGitInfo(cwd); err == nil {
+			gitRoot = gitInfo.Root
+		}
+		return skills.ListAll(cwd, gitRoot)
+	})
+	if !ok {
+		return content
+	}
+
+	cm.mu.Lock()
+	cm.activeSkill = &skill
+	cm.mu.Unlock()
+	patterns := skill.ToolPatterns()
+	if len(patterns) == 0 {
+		return content
+	}
+	cm.logger.InfoContext(ctx, "skill restricts tools", "skill", skill.Name, "allowed_tools", patterns)
+	return append(content, llm.Content{
+		Type: llm.ContentTypeText,
+		Text: fmt.Sprintf("The %q skill is now active. Until this task is done, only these tools are available: %s",
+			skill.Name, strings.Join(patterns, ", ")),
+	})
+}
+
+// modelCapabilities lists the capabilities of svc that skills can require
+// with `when: model(...)`.
+func modelCapabilities(svc llm.Service) []string {
+	var caps []string
+	if svc.SupportsImages() {
+		caps = append(caps, "images")
+	}
+	if llm.SupportsReasoning(svc) {
+		caps = append(caps, "reasoning")
+	}
+	return caps
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shelley.exe.dev/llm"
+)
+
+func TestSkillScopeRestrictsToolsUntilTurnEnds(t *testing.T) {
+	cwd := t.TempDir()
+	skillDir := filepath.Join(cwd, ".skills", "scoped")
+	if err := os.MkdirAll(skillDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	skillMD := "---\nname: scoped\ndescription: A scoped skill.\nallowed-tools: bash keyword_search\n---\n\nbody\n"
+	if err := os.WriteFile(filepath.Join(skillDir, "SKILL.md"), []byte(skillMD), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cm := &ConversationManager{logger: slog.Default(), agentWorking: true}
+	ctx := context.Background()
+	call := func(command string) llm.Content {
+		input, _ := json.Marshal(map[string]string{"command": command})
+		return llm.Content{Type: llm.ContentTypeToolUse, ToolName: "bash", ToolInput: input}
+	}
+	result := []llm.Content{{Type: llm.ContentTypeText, Text: skillMD}}
+
+	if got := cm.noteSkillActivation(ctx, call("ls"), []llm.Content{{Type: llm.ContentTypeText, Text: "SKILL.md"}}, false, cwd); len(got) != 1 {
+		t.Errorf("unrelated command changed the result: %+v", got)
+	}
+	if got := cm.noteSkillActivation(ctx, call("shelley skill cat scoped"), result, true, cwd); len(got) != 1 || cm.checkSkillScope("patch") != nil {
+		t.Error("a failed read should not activate the skill")
+	}
+	if got := cm.noteSkillActivation(ctx, call("echo shelley skill cat scoped"), []llm.Content{{Type: llm.ContentTypeText, Text: "shelley skill cat scoped"}}, false, cwd); len(got) != 1 || cm.checkSkillScope("patch") != nil {
+		t.Error("mentioning the command without reading the skill should not activate it")
+	}
+
+	// Reading the file directly activates the skill as well as `shelley skill cat` does.
+	got := cm.noteSkillActivation(ctx, call("cat .skills/scoped/SKILL.md"), result, false, cwd)
+	if len(got) != 2 || !strings.Contains(got[1].Text, "bash, keyword_search") {
+		t.Errorf("activation result = %+v", got)
+	}
+	if err := cm.checkSkillScope("bash"); err != nil {
+		t.Errorf("bash should be allowed: %v", err)
+	}
+	if err := cm.checkSkillScope("patch"); err == nil || !strings.Contains(err.Error(), `"scoped" skill`) {
+		t.Errorf("patch should be refused, got %v", err)
+	}
+
+	cm.syncAgentWorking(false)
+	if err := cm.checkSkillScope("patch"); err != nil {
+		t.Errorf("restriction should end with the turn: %v", err)
+	}
+}
@@ -303,6 +303,7 @@ func (r *SubagentRunner) waitForResponse(ctx context.Context, manager *Conversat
 			// synchronously, so we are the delivery path.
 			response, err := r.getLastAssistantResponse(ctx, conversationID)
 			if err == nil {
+				response += s.subagentWorktreeReport(ctx, conversationID)
 				// Scrub any completion notification for this subagent still
 				// queued on the parent: it predates this wait (the waiter slot
 				// suppresses onDone while held, so nothing fresh can be queued)
@@ -756,6 +757,9 @@ func (s *Server) notifyParentSubagentDone(subagentConversationID, response strin
 	if len(response) > 500 {
 		response = response[:500] + "..."
 	}
+	// The diff of an isolated subagent is what the parent needs to decide
+	// whether to merge it, so it gets its own, larger cap.
+	response += s.subagentWorktreeReport(ctx, subagentConversationID)
 
 	// Splice in a synthetic tool_use/tool_result pair as if the parent had
 	// just called the subagent tool with wait=true. This gives the LLM the
@@ -879,6 +883,10 @@ var _ claudetool.SubagentRunner = (*SubagentRunner)(nil)
 // hold a hydrated loop, and CancelConversation would record a spurious
 // "[Operation cancelled]" end-of-turn message on a turn that already
 // finished.
+//
+// A cancelled subagent's worktree, if it was isolated in one, is abandoned
+// and removed (see abandonSubagentWorktree). Idle subagents keep theirs for
+// the parent to merge or discard.
 func (s *Server) cancelSubagentTree(ctx context.Context, parentID string) {
 	visited := map[string]bool{parentID: true}
 	queue := []string{parentID}
@@ -909,6 +917,7 @@ func (s *Server) cancelSubagentTree(ctx context.Context, parentID string) {
 				continue
 			}
 			s.logger.Info("Cancelled subagent conversation", "conversationID", child.ConversationID, "parent", id)
+			s.abandonSubagentWorktree(ctx, child.ConversationID)
 		}
 	}
 }
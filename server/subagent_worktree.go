@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/db/generated"
+)
+
+// maxWorktreeDiffBytes caps the diff included in an isolated subagent's
+// response. The parent can read the rest with git in the worktree.
+const maxWorktreeDiffBytes = 16 * 1024
+
+// worktreeGitTimeout bounds each git command run on a subagent worktree.
+const worktreeGitTimeout = time.Minute
+
+// worktreeGit runs git in dir and returns its trimmed output.
+func worktreeGit(ctx context.Context, dir string, args ...string) (string, error) {
+	return worktreeGitEnv(ctx, dir, nil, args...)
+}
+
+// worktreeGitEnv is worktreeGit with env added to git's environment.
+func worktreeGitEnv(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, worktreeGitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// mainRepoRoot returns the working tree of the main repository dir belongs
+// to, which is not dir's own if dir is in a linked worktree.
+func mainRepoRoot(dir string) (gitRoot, mainRoot string, err error) {
+	gitRoot, err = getGitRoot(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("%s is not in a git repository", dir)
+	}
+	mainRoot = gitRoot
+	if root := getGitWorktreeRoot(gitRoot); root != "" {
+		mainRoot = root
+	}
+	return gitRoot, mainRoot, nil
+}
+
+// IsolateSubagent implements claudetool.SubagentWorktrees. The worktree is
+// a sibling of the main repository named after it and the subagent's slug,
+// and the subagent starts at the same place in it as parentDir is in the
+// parent's checkout.
+func (r *SubagentRunner) IsolateSubagent(ctx context.Context, conversationID, parentDir string) error {
+	s := r.server
+	existing, err := s.db.GetSubagentWorktree(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	conv, err := s.db.GetConversationByID(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+	msgs, err := s.db.ListMessages(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("the subagent already works in the shared directory; use a new slug for an isolated one")
+	}
+
+	gitRoot, mainRoot, err := mainRepoRoot(parentDir)
+	if err != nil {
+		return err
+	}
+	base, err := worktreeGit(ctx, parentDir, "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("the repository has no commit to branch from: %w", err)
+	}
+	path, err := addWorktree(mainRoot, filepath.Base(mainRoot)+"-subagent-"+derefString(conv.Slug), base)
+	if err != nil {
+		return err
+	}
+	branch := filepath.Base(path)
+	if err := s.db.CreateSubagentWorktree(ctx, generated.CreateSubagentWorktreeParams{
+		ConversationID: conversationID,
+		RepoRoot:       mainRoot,
+		Path:           path,
+		Branch:         branch,
+		BaseCommit:     base,
+	}); err != nil {
+		removeWorktree(ctx, mainRoot, path, branch, true)
+		return err
+	}
+
+	cwd := path
+	if rel, err := filepath.Rel(gitRoot, parentDir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		if info, err := os.Stat(filepath.Join(path, rel)); err == nil && info.IsDir() {
+			cwd = filepath.Join(path, rel)
+		}
+	}
+	if err := s.db.UpdateConversationCwd(ctx, conversationID, cwd); err != nil {
+		return err
+	}
+	s.logger.Info("Isolated subagent in a git worktree", "conversationID", conversationID, "path", path, "branch", branch)
+	return nil
+}
+
+// lookupSubagentWorktree finds the worktree of the subagent named slug
+// beneath parentID, which must not be working.
+func (r *SubagentRunner) lookupSubagentWorktree(ctx context.Context, parentID, slug string) (*generated.SubagentWorktree, error) {
+	s := r.server
+	conv, err := s.db.GetConversationBySlugAndParent(ctx, slug, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, fmt.Errorf("there is no subagent %q", slug)
+	}
+	wt, err := s.db.GetSubagentWorktree(ctx, conv.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if wt == nil {
+		return nil, fmt.Errorf("subagent %q has no worktree", slug)
+	}
+	if working, _ := r.isAgentWorking(ctx, conv.ConversationID); working {
+		return nil, fmt.Errorf("subagent %q is still working", slug)
+	}
+	return wt, nil
+}
+
+// MergeSubagentWorktree implements claudetool.SubagentWorktrees. A merge
+// that conflicts is aborted, leaving both checkouts as they were.
+func (r *SubagentRunner) MergeSubagentWorktree(ctx context.Context, parentID, slug, parentDir string) (string, error) {
+	wt, err := r.lookupSubagentWorktree(ctx, parentID, slug)
+	if err != nil {
+		return "", err
+	}
+	if _, mainRoot, err := mainRepoRoot(parentDir); err != nil {
+		return "", err
+	} else if mainRoot != wt.RepoRoot {
+		return "", fmt.Errorf("%s is not in %s, the repository branch %s belongs to", parentDir, wt.RepoRoot, wt.Branch)
+	}
+
+	status, err := worktreeGit(ctx, wt.Path, "status", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	if status != "" {
+		if _, err := worktreeGit(ctx, wt.Path, "add", "-A"); err != nil {
+			return "", err
+		}
+		if _, err := worktreeGit(ctx, wt.Path, "commit", "--quiet", "-m", fmt.Sprintf("Uncommitted changes from subagent %s", slug)); err != nil {
+			return "", err
+		}
+	}
+
+	var report string
+	if commits, err := worktreeGit(ctx, wt.Path, "rev-list", "--count", wt.BaseCommit+"..HEAD"); err != nil {
+		return "", err
+	} else if commits == "0" {
+		report = fmt.Sprintf("Subagent %q made no changes; removed its worktree and branch %s.", slug, wt.Branch)
+	} else {
+		out, err := worktreeGit(ctx, parentDir, "merge", "--no-ff", "--no-edit", wt.Branch)
+		if err != nil {
+			worktreeGit(ctx, parentDir, "merge", "--abort")
+			return "", fmt.Errorf("merge aborted; the worktree %s and branch %s are kept: %w", wt.Path, wt.Branch, err)
+		}
+		report = fmt.Sprintf("Merged branch %s of subagent %q into %s and removed its worktree.\n%s", wt.Branch, slug, parentDir, out)
+	}
+	r.server.forgetSubagentWorktree(ctx, wt, true)
+	return report, nil
+}
+
+// DiscardSubagentWorktree implements claudetool.SubagentWorktrees.
+func (r *SubagentRunner) DiscardSubagentWorktree(ctx context.Context, parentID, slug string) (string, error) {
+	wt, err := r.lookupSubagentWorktree(ctx, parentID, slug)
+	if err != nil {
+		return "", err
+	}
+	r.server.forgetSubagentWorktree(ctx, wt, true)
+	return fmt.Sprintf("Discarded the worktree and branch %s of subagent %q.", wt.Branch, slug), nil
+}
+
+// forgetSubagentWorktree removes a subagent's worktree, and its branch if
+// deleteBranch is set, and deletes its record. Failures are logged: the
+// worktree may already be gone.
+func (s *Server) forgetSubagentWorktree(ctx context.Context, wt *generated.SubagentWorktree, deleteBranch bool) {
+	removeWorktree(ctx, wt.RepoRoot, wt.Path, wt.Branch, deleteBranch)
+	if err := s.db.DeleteSubagentWorktree(ctx, wt.ConversationID); err != nil {
+		s.logger.Error("Failed to delete subagent worktree record", "conversationID", wt.ConversationID, "error", err)
+	}
+}
+
+// removeWorktree removes a worktree, changes and all, and optionally its
+// branch. It is best-effort, and goes ahead when ctx is already cancelled,
+// as it is when a cancelled subagent is cleaned up.
+func removeWorktree(ctx context.Context, mainRoot, path, branch string, deleteBranch bool) {
+	ctx = context.WithoutCancel(ctx)
+	worktreeGit(ctx, mainRoot, "worktree", "remove", "--force", path)
+	worktreeGit(ctx, mainRoot, "worktree", "prune")
+	if deleteBranch {
+		worktreeGit(ctx, mainRoot, "branch", "-D", branch)
+	}
+}
+
+// abandonSubagentWorktree cleans up after a subagent cancelled mid-turn:
+// its worktree is removed, and so is its branch unless the subagent had
+// committed to it.
+func (s *Server) abandonSubagentWorktree(ctx context.Context, conversationID string) {
+	wt, err := s.db.GetSubagentWorktree(ctx, conversationID)
+	if err != nil || wt == nil {
+		return
+	}
+	commits, err := worktreeGit(ctx, wt.Path, "rev-list", "--count", wt.BaseCommit+"..HEAD")
+	keepBranch := err != nil || commits != "0"
+	s.forgetSubagentWorktree(ctx, wt, !keepBranch)
+	s.logger.Info("Removed the worktree of a cancelled subagent", "conversationID", conversationID, "path", wt.Path, "branch", wt.Branch, "branchKept", keepBranch)
+}
+
+// subagentWorktreeReport describes what an isolated subagent changed, for
+// appending to its response: the branch, its commits and the diff from the
+// base commit, uncommitted and new files included. It returns "" for a
+// subagent without a worktree.
+func (s *Server) subagentWorktreeReport(ctx context.Context, conversationID string) string {
+	wt, err := s.db.GetSubagentWorktree(ctx, conversationID)
+	if err != nil || wt == nil {
+		return ""
+	}
+	slug := "unknown"
+	if conv, err := s.db.GetConversationByID(ctx, conversationID); err == nil && conv.Slug != nil {
+		slug = *conv.Slug
+	}
+	next := fmt.Sprintf(`Call subagent with slug %q and worktree_action "merge" to merge the branch into your working directory, or "discard" to throw it away.`, slug)
+
+	stat, patch, err := worktreeDiff(ctx, wt.Path, wt.BaseCommit)
+	if err != nil {
+		return fmt.Sprintf("\n\n[Worktree: the subagent works on branch %s in %s, but its changes could not be read: %v]", wt.Branch, wt.Path, err)
+	}
+	if stat == "" {
+		return fmt.Sprintf("\n\n[Worktree: the subagent made no changes on branch %s in %s.] %s", wt.Branch, wt.Path, next)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\n[Worktree: the subagent worked on branch %s in %s, cut from %.12s.]\n", wt.Branch, wt.Path, wt.BaseCommit)
+	if log, _ := worktreeGit(ctx, wt.Path, "log", "--oneline", wt.BaseCommit+"..HEAD"); log != "" {
+		fmt.Fprintf(&b, "\nCommits:\n%s\n", log)
+	}
+	fmt.Fprintf(&b, "\nChanges, uncommitted ones included:\n%s\n", stat)
+	if len(patch) > maxWorktreeDiffBytes {
+		kept := truncateUTF8(patch, maxWorktreeDiffBytes)
+		patch = fmt.Sprintf("%s\n[diff truncated; %d more bytes. Run git diff %.12s in the worktree for the rest.]", kept, len(patch)-len(kept)+len("..."), wt.BaseCommit)
+	}
+	fmt.Fprintf(&b, "\n%s\n\n%s", patch, next)
+	return b.String()
+}
+
+// worktreeDiff returns the diffstat and the diff of the worktree at path
+// against base, new files included. New files are marked intent-to-add in
+// a temporary copy of the index, so reading the changes leaves the
+// worktree's own index alone.
+func worktreeDiff(ctx context.Context, path, base string) (stat, patch string, err error) {
+	index, err := worktreeGit(ctx, path, "rev-parse", "--path-format=absolute", "--git-path", "index")
+	if err != nil {
+		return "", "", err
+	}
+	data, err := os.ReadFile(index)
+	if err != nil {
+		return "", "", err
+	}
+	tmp, err := os.CreateTemp("", "shelley-worktree-index-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", err
+	}
+	env := []string{"GIT_INDEX_FILE=" + tmp.Name()}
+	if _, err := worktreeGitEnv(ctx, path, env, "add", "--intent-to-add", "--all"); err != nil {
+		return "", "", err
+	}
+	stat, _ = worktreeGitEnv(ctx, path, env, "diff", "--stat", base)
+	patch, _ = worktreeGitEnv(ctx, path, env, "diff", base)
+	return stat, patch, nil
+}
+
+// Ensure SubagentRunner implements claudetool.SubagentWorktrees.
+var _ claudetool.SubagentWorktrees = (*SubagentRunner)(nil)
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"shelley.exe.dev/db"
+)
+
+// worktreeFixture is a git repository with one commit, a parent
+// conversation working in it and a subagent isolated in a worktree.
+type worktreeFixture struct {
+	server   *Server
+	database *db.DB
+	runner   *SubagentRunner
+	repo     string
+	parentID string
+	subID    string
+}
+
+func newWorktreeFixture(t *testing.T) *worktreeFixture {
+	t.Helper()
+	server, database, _ := newTestServer(t)
+	ctx := context.Background()
+
+	repo := filepath.Join(t.TempDir(), "myrepo")
+	if err := os.Mkdir(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@test.com"},
+		{"commit", "--quiet", "--allow-empty", "-m", "initial"},
+	} {
+		if _, err := worktreeGit(context.Background(), repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo, _ = filepath.EvalSymlinks(repo)
+
+	parent, err := database.CreateConversation(ctx, nil, true, &repo, nil, db.ConversationOptions{})
+	if err != nil {
+		t.Fatalf("create parent: %v", err)
+	}
+	sub, err := database.CreateSubagentConversation(ctx, "fixer", parent.ConversationID, &repo)
+	if err != nil {
+		t.Fatalf("create subagent: %v", err)
+	}
+	f := &worktreeFixture{
+		server:   server,
+		database: database,
+		runner:   NewSubagentRunner(server),
+		repo:     repo,
+		parentID: parent.ConversationID,
+		subID:    sub.ConversationID,
+	}
+	if err := f.runner.IsolateSubagent(ctx, f.subID, repo); err != nil {
+		t.Fatalf("IsolateSubagent: %v", err)
+	}
+	return f
+}
+
+func (f *worktreeFixture) worktreePath(t *testing.T) string {
+	t.Helper()
+	wt, err := f.database.GetSubagentWorktree(context.Background(), f.subID)
+	if err != nil || wt == nil {
+		t.Fatalf("GetSubagentWorktree = %v, %v", wt, err)
+	}
+	return wt.Path
+}
+
+func branchExists(repo, branch string) bool {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	cmd.Dir = repo
+	return cmd.Run() == nil
+}
+
+func TestIsolatedSubagentReturnsDiffAndMerges(t *testing.T) {
+	t.Parallel()
+	f := newWorktreeFixture(t)
+	ctx := context.Background()
+
+	path := f.worktreePath(t)
+	if filepath.Dir(path) != filepath.Dir(f.repo) || filepath.Base(path) != "myrepo-subagent-fixer" {
+		t.Errorf("worktree path = %q, want a sibling named myrepo-subagent-fixer", path)
+	}
+	conv, err := f.database.GetConversationByID(ctx, f.subID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if derefString(conv.Cwd) != path {
+		t.Errorf("subagent cwd = %q, want %q", derefString(conv.Cwd), path)
+	}
+	// Isolating again is a no-op.
+	if err := f.runner.IsolateSubagent(ctx, f.subID, f.repo); err != nil {
+		t.Fatalf("second IsolateSubagent: %v", err)
+	}
+
+	response, err := f.runner.RunSubagent(ctx, f.subID, "bash: echo fixed > fix.txt", true, 30*time.Second, "predictable", "")
+	if err != nil {
+		t.Fatalf("RunSubagent: %v", err)
+	}
+	for _, want := range []string{"branch myrepo-subagent-fixer", "fix.txt", "+fixed", `worktree_action "merge"`} {
+		if !strings.Contains(response, want) {
+			t.Errorf("response does not mention %q:\n%s", want, response)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(f.repo, "fix.txt")); err == nil {
+		t.Fatal("the subagent wrote to the parent's checkout")
+	}
+
+	report, err := f.runner.MergeSubagentWorktree(ctx, f.parentID, "fixer", f.repo)
+	if err != nil {
+		t.Fatalf("MergeSubagentWorktree: %v", err)
+	}
+	if !strings.Contains(report, "Merged branch myrepo-subagent-fixer") {
+		t.Errorf("merge report = %q", report)
+	}
+	if data, err := os.ReadFile(filepath.Join(f.repo, "fix.txt")); err != nil || string(data) != "fixed\n" {
+		t.Errorf("fix.txt after merge = %q, %v", data, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("worktree still exists after merge: %v", err)
+	}
+	if branchExists(f.repo, "myrepo-subagent-fixer") {
+		t.Error("branch still exists after merge")
+	}
+	if wt, _ := f.database.GetSubagentWorktree(ctx, f.subID); wt != nil {
+		t.Errorf("worktree record survived the merge: %+v", wt)
+	}
+	if _, err := f.runner.MergeSubagentWorktree(ctx, f.parentID, "fixer", f.repo); err == nil || !strings.Contains(err.Error(), "no worktree") {
+		t.Errorf("second merge err = %v, want no worktree", err)
+	}
+}
+
+func TestWorktreeReportLeavesIndexAlone(t *testing.T) {
+	t.Parallel()
+	f := newWorktreeFixture(t)
+	ctx := context.Background()
+	path := f.worktreePath(t)
+	// Two-byte runes put a rune boundary off the byte cap.
+	big := strings.Repeat("é", maxWorktreeDiffBytes)
+	if err := os.WriteFile(filepath.Join(path, "big.txt"), []byte(big+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := f.server.subagentWorktreeReport(ctx, f.subID)
+	if !strings.Contains(report, "big.txt") || !strings.Contains(report, "diff truncated") {
+		t.Fatalf("report lacks the truncated diff of big.txt:\n%.500s", report)
+	}
+	if !utf8.ValidString(report) {
+		t.Error("the truncated diff splits a rune")
+	}
+	status, err := worktreeGit(ctx, path, "status", "--porcelain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "?? big.txt" {
+		t.Errorf("status after the report = %q, want the new file still untracked", status)
+	}
+}
+
+func TestIsolatedSubagentDiscard(t *testing.T) {
+	t.Parallel()
+	f := newWorktreeFixture(t)
+	ctx := context.Background()
+	path := f.worktreePath(t)
+	if err := os.WriteFile(filepath.Join(path, "scratch.txt"), []byte("x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.runner.DiscardSubagentWorktree(ctx, f.parentID, "fixer"); err != nil {
+		t.Fatalf("DiscardSubagentWorktree: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("worktree still exists after discard: %v", err)
+	}
+	if branchExists(f.repo, "myrepo-subagent-fixer") {
+		t.Error("branch still exists after discard")
+	}
+	if _, err := f.runner.DiscardSubagentWorktree(ctx, f.parentID, "nobody"); err == nil {
+		t.Error("expected an error for an unknown subagent")
+	}
+}
+
+func TestIsolateStartedSubagentFails(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	ctx := context.Background()
+	repo := t.TempDir()
+	if _, err := worktreeGit(context.Background(), repo, "init", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := database.CreateConversation(ctx, nil, true, &repo, nil, db.ConversationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := database.CreateSubagentConversation(ctx, "shared", parent.ConversationID, &repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewSubagentRunner(server)
+	if err := runner.IsolateSubagent(ctx, sub.ConversationID, repo); err == nil || !strings.Contains(err.Error(), "no commit") {
+		t.Errorf("isolating in a repository without commits: err = %v", err)
+	}
+	if _, err := runner.RunSubagent(ctx, sub.ConversationID, "echo: hi", true, 30*time.Second, "predictable", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.IsolateSubagent(ctx, sub.ConversationID, repo); err == nil || !strings.Contains(err.Error(), "new slug") {
+		t.Errorf("isolating a started subagent: err = %v", err)
+	}
+}
+
+func TestCancelParentRemovesAbandonedWorktree(t *testing.T) {
+	t.Parallel()
+	f := newWorktreeFixture(t)
+	path := f.worktreePath(t)
+
+	startSlowTurn(t, f.server, f.subID)
+	cancelConversation(t, f.server, f.parentID)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("worktree still exists after cancellation: %v", err)
+	}
+	if branchExists(f.repo, "myrepo-subagent-fixer") {
+		t.Error("a branch without commits should be removed with its worktree")
+	}
+	if wt, _ := f.database.GetSubagentWorktree(context.Background(), f.subID); wt != nil {
+		t.Errorf("worktree record survived cancellation: %+v", wt)
+	}
+}
@@ -40,6 +40,13 @@ type SystemPromptData struct {
 	SkillsXML        string // XML block for available skills
 	UserEmail        string // The exe.dev auth email of the user, if known
 	CurrentDate      string // Current date in human-readable format
+
+	// ModelCapabilities gates skills with a `when: model(...)` condition.
+	ModelCapabilities []string
+
+	// Sandbox describes the sandbox bash, shell and custom tool commands
+	// run in, or is empty if they are not sandboxed.
+	Sandbox string
 }
 
 // DBPath is the path to the shelley database, set at startup
@@ -87,18 +94,30 @@ func WithUserEmail(email string) SystemPromptOption {
 	}
 }
 
+// WithModelCapabilities sets the capabilities of the conversation's model
+// (see modelCapabilities), which decide the skills offered.
+func WithModelCapabilities(caps []string) SystemPromptOption {
+	return func(d *SystemPromptData) {
+		d.ModelCapabilities = caps
+	}
+}
+
+// WithSandbox describes the conversation's command sandbox (see
+// sandbox.Sandbox.Summary) in the system prompt.
+func WithSandbox(summary string) SystemPromptOption {
+	return func(d *SystemPromptData) {
+		d.Sandbox = summary
+	}
+}
+
 // GenerateSystemPrompt generates the system prompt using the embedded template.
 // If workingDir is empty, it uses the current working directory.
 func GenerateSystemPrompt(workingDir string, opts ...SystemPromptOption) (string, error) {
-	data, err := collectSystemData(workingDir)
+	data, err := collectSystemData(workingDir, opts...)
 	if err != nil {
 		return "", fmt.Errorf("failed to collect system data: %w", err)
 	}
 
-	for _, opt := range opts {
-		opt(data)
-	}
-
 	tmpl, err := template.New("system_prompt").Parse(systemPromptTemplate)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %w", err)
@@ -129,6 +148,8 @@ const (
 	hookNewConversation = "new-conversation"
 	hookEndOfTurn       = "end-of-turn"
 	hookChatMessage     = "chat-message"
+	hookPreToolUse      = "pre-tool-use"
+	hookPostToolUse     = "post-tool-use"
 )
 
 // HookHeaders converts an http.Header to a sorted list of [name, value]
@@ -633,7 +654,7 @@ func runHook(name, prompt string) (string, error) {
 	return result, nil
 }
 
-func collectSystemData(workingDir string) (*SystemPromptData, error) {
+func collectSystemData(workingDir string, opts ...SystemPromptOption) (*SystemPromptData, error) {
 	wd := workingDir
 	if wd == "" {
 		var err error
@@ -647,6 +668,9 @@ func collectSystemData(workingDir string) (*SystemPromptData, error) {
 		WorkingDirectory: wd,
 		CurrentDate:      time.Now().Format("Monday, January 2, 2006"),
 	}
+	for _, opt := range opts {
+		opt(data)
+	}
 
 	// collectGitInfo shells out to `git rev-parse`; resolve it first so the
 	// codebase and skill walks below can scope to the git root.
@@ -681,7 +705,7 @@ func collectSystemData(workingDir string) (*SystemPromptData, error) {
 	}()
 	go func() {
 		defer wg.Done()
-		skillsXML = collectSkills(wd, gitRoot, skills.Env{ExeDev: data.IsExeDev})
+		skillsXML = collectSkills(wd, gitRoot, skills.Env{ExeDev: data.IsExeDev, ModelCapabilities: data.ModelCapabilities})
 	}()
 
 	// Run the remaining cheap synchronous probes while the walks are in flight.
@@ -926,8 +950,12 @@ func exeDevDefaultPortIn(env exeenv.Environment) int {
 
 // collectSkills discovers skills from default directories, project .skills dirs,
 // the project tree, and built-in skills. See skills.ListAll for precedence rules.
-// Skills with a `when:` clause are filtered against env.
+// Skills with a `when:` clause are filtered against env, completed with the
+// directories and the process environment.
 func collectSkills(workingDir, gitRoot string, env skills.Env) string {
+	env.WorkingDir = workingDir
+	env.GitRoot = gitRoot
+	env.Getenv = os.Getenv
 	return skills.ToPromptXML(skills.Filter(skills.ListAll(workingDir, gitRoot), env))
 }
 
@@ -5,9 +5,17 @@ import (
 	"net/http"
 	"os"
 	"testing"
+
+	"shelley.exe.dev/claudetool/sandbox"
 )
 
+// packageDir is the server package directory, where tests start before
+// TestMain moves them to an empty one; testdata paths are relative to it.
+var packageDir string
+
 func TestMain(m *testing.M) {
+	// Sandboxed commands re-execute the test binary as their init process.
+	sandbox.Main()
 	exeDevDefaultPortHTTPClient = &http.Client{Transport: defaultPortTestTransport{}}
 	// Default to a failing reflection client so server tests never make real
 	// network calls. Tests that exercise reflection override this explicitly.
@@ -27,6 +35,7 @@ func TestMain(m *testing.M) {
 	// the last test finished). An empty cwd keeps those walks trivially
 	// small without changing what the tests exercise; tests that care about
 	// specific trees pass an explicit cwd already.
+	packageDir, _ = os.Getwd()
 	tmp, err := os.MkdirTemp("", "shelley-server-test-cwd-")
 	if err != nil {
 		panic(err)
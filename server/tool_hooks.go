@@ -0,0 +1,218 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/llm"
+)
+
+// ToolUseReadonly is the readonly context passed to the pre-tool-use and
+// post-tool-use hooks.
+type ToolUseReadonly struct {
+	Tool           string `json:"tool"`
+	ToolUseID      string `json:"tool_use_id"`
+	ConversationID string `json:"conversation_id"`
+	Model          string `json:"model,omitempty"`
+	Cwd            string `json:"cwd,omitempty"`
+}
+
+// PreToolUseHookInput is the JSON data passed to the pre-tool-use hook on
+// stdin, before each tool call.
+type PreToolUseHookInput struct {
+	// Mutable — the hook may return a replacement.
+	Input json.RawMessage `json:"input"`
+
+	Readonly ToolUseReadonly `json:"readonly"`
+}
+
+// PreToolUseHookResult is the pre-tool-use hook's stdout. Empty output
+// allows the call unchanged.
+type PreToolUseHookResult struct {
+	// Decision is "allow" (the default) or "deny".
+	Decision string `json:"decision,omitempty"`
+	// Reason is sent to the LLM when the call is denied.
+	Reason string `json:"reason,omitempty"`
+	// Input, if set, replaces the tool call's input.
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+// PostToolUseHookInput is the JSON data passed to the post-tool-use hook on
+// stdin, after each tool call.
+type PostToolUseHookInput struct {
+	Input json.RawMessage `json:"input"`
+	// Output is the text of the result the LLM is about to see; for a
+	// failed call, the error message.
+	Output  string `json:"output"`
+	IsError bool   `json:"is_error"`
+
+	Readonly ToolUseReadonly `json:"readonly"`
+}
+
+// PostToolUseHookResult is the post-tool-use hook's stdout. Empty output
+// leaves the result unchanged.
+type PostToolUseHookResult struct {
+	// Replace, if set, replaces the result's content with this text. An
+	// empty string becomes "(no output)", since the LLM APIs reject empty
+	// text blocks.
+	Replace *string `json:"replace,omitempty"`
+	// Append is added to the result as a further text block.
+	Append string `json:"append,omitempty"`
+}
+
+// RunPreToolUseHookIn runs the pre-tool-use hook from an explicit hooks
+// dir. If no hook is installed it allows the call. A non-nil error means
+// the hook failed (non-zero exit, invalid JSON, etc.) and the tool call
+// should be refused. The hook is killed if ctx, the tool call's context,
+// ends first.
+func RunPreToolUseHookIn(ctx context.Context, hooksDir string, input PreToolUseHookInput) (PreToolUseHookResult, error) {
+	var result PreToolUseHookResult
+	if err := runJSONHook(ctx, hooksDir, hookPreToolUse, input, &result); err != nil {
+		return PreToolUseHookResult{}, err
+	}
+	switch result.Decision {
+	case "", "allow", "deny":
+	default:
+		return PreToolUseHookResult{}, fmt.Errorf("pre-tool-use hook: unknown decision %q", result.Decision)
+	}
+	if len(result.Input) > 0 && !json.Valid(result.Input) {
+		return PreToolUseHookResult{}, fmt.Errorf("pre-tool-use hook: invalid input %q", result.Input)
+	}
+	return result, nil
+}
+
+// RunPostToolUseHookIn runs the post-tool-use hook from an explicit hooks
+// dir. If no hook is installed the result is unchanged. A non-nil error
+// means the hook failed.
+func RunPostToolUseHookIn(ctx context.Context, hooksDir string, input PostToolUseHookInput) (PostToolUseHookResult, error) {
+	var result PostToolUseHookResult
+	if err := runJSONHook(ctx, hooksDir, hookPostToolUse, input, &result); err != nil {
+		return PostToolUseHookResult{}, err
+	}
+	if result.Replace != nil && strings.TrimSpace(*result.Replace) == "" {
+		noOutput := "(no output)"
+		result.Replace = &noOutput
+	}
+	return result, nil
+}
+
+// runJSONHook runs the named hook with input as JSON on stdin and decodes
+// its stdout into out. Missing hooks and empty output leave out untouched.
+// The hook gets at most 30 seconds, and less if ctx ends sooner.
+func runJSONHook(ctx context.Context, hooksDir, name string, input, out any) error {
+	hookPath, err := findHookIn(hooksDir, name)
+	if err != nil {
+		return fmt.Errorf("%s hook: %w", name, err)
+	}
+	if hookPath == "" {
+		return nil
+	}
+
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("%s hook: marshal input: %w", name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hookPath)
+	cmd.Stdin = bytes.NewReader(inputJSON)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook %s failed: %w (stderr: %s)", name, hookPath, err, stderr.String())
+	}
+
+	output := strings.TrimSpace(stdout.String())
+	if output == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(output), out); err != nil {
+		return fmt.Errorf("%s hook %s: invalid JSON output %q: %w", name, hookPath, output, err)
+	}
+	slog.Info("hook applied", "name", name, "hook", hookPath)
+	return nil
+}
+
+// toolUseHooks returns the loop's PreToolUse and PostToolUse callbacks,
+// which enforce the active skill's allowed-tools (see checkSkillScope) and
+// run the pre-tool-use and post-tool-use hooks. Hooks are looked up on every
+// call, like the other hooks, so installing one takes effect at once.
+func (cm *ConversationManager) toolUseHooks(modelID string, wd *claudetool.MutableWorkingDir) (
+	pre func(context.Context, llm.Content) (json.RawMessage, error),
+	post func(context.Context, llm.Content, []llm.Content, bool) ([]llm.Content, error),
+) {
+	hooksDir := cm.hooksDir
+	readonly := func(ctx context.Context, call llm.Content) ToolUseReadonly {
+		return ToolUseReadonly{
+			Tool:           call.ToolName,
+			ToolUseID:      llm.ToolUseID(ctx),
+			ConversationID: cm.conversationID,
+			Model:          modelID,
+			Cwd:            wd.Get(),
+		}
+	}
+	pre = func(ctx context.Context, call llm.Content) (json.RawMessage, error) {
+		if err := cm.checkSkillScope(call.ToolName); err != nil {
+			return nil, err
+		}
+		if hooksDir == "" {
+			return nil, nil
+		}
+		result, err := RunPreToolUseHookIn(ctx, hooksDir, PreToolUseHookInput{Input: call.ToolInput, Readonly: readonly(ctx, call)})
+		if err != nil {
+			return nil, err
+		}
+		if result.Decision == "deny" {
+			reason := result.Reason
+			if reason == "" {
+				reason = "no reason given"
+			}
+			return nil, fmt.Errorf("this tool call was denied by a pre-tool-use hook: %s", reason)
+		}
+		return result.Input, nil
+	}
+	post = func(ctx context.Context, call llm.Content, content []llm.Content, isError bool) ([]llm.Content, error) {
+		content = cm.noteSkillActivation(ctx, call, content, isError, wd.Get())
+		if hooksDir == "" {
+			return content, nil
+		}
+		var text []string
+		for _, c := range content {
+			if c.Type == llm.ContentTypeText {
+				text = append(text, c.Text)
+			}
+		}
+		result, err := RunPostToolUseHookIn(ctx, hooksDir, PostToolUseHookInput{
+			Input:    call.ToolInput,
+			Output:   strings.Join(text, "\n"),
+			IsError:  isError,
+			Readonly: readonly(ctx, call),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result.Replace != nil {
+			content = []llm.Content{{Type: llm.ContentTypeText, Text: *result.Replace}}
+		}
+		if result.Append != "" {
+			content = append(content, llm.Content{Type: llm.ContentTypeText, Text: result.Append})
+		}
+		if len(content) == 0 {
+			return nil, errors.New("post-tool-use hook left the tool result empty")
+		}
+		return content, nil
+	}
+	return pre, post
+}
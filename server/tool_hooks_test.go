@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shelley.exe.dev/db"
+)
+
+func writeHook(t *testing.T, hooksDir, name, script string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(hooksDir, name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunPreToolUseHookNoHook(t *testing.T) {
+	result, err := RunPreToolUseHookIn(context.Background(), t.TempDir(), PreToolUseHookInput{Input: json.RawMessage(`{}`)})
+	if err != nil || result.Decision != "" || result.Input != nil {
+		t.Errorf("got %+v, %v; want an empty allow", result, err)
+	}
+}
+
+func TestRunPreToolUseHookReceivesContext(t *testing.T) {
+	hooksDir := t.TempDir()
+	dumpFile := filepath.Join(t.TempDir(), "pre-tool-use.json")
+	writeHook(t, hooksDir, "pre-tool-use", "#!/bin/sh\ncat > "+dumpFile+"\n")
+
+	if _, err := RunPreToolUseHookIn(context.Background(), hooksDir, PreToolUseHookInput{
+		Input: json.RawMessage(`{"command":"ls"}`),
+		Readonly: ToolUseReadonly{
+			Tool:           "bash",
+			ToolUseID:      "tu_1",
+			ConversationID: "conv-42",
+			Model:          "predictable",
+			Cwd:            "/work",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(dumpFile)
+	if err != nil {
+		t.Fatalf("failed to read hook input: %v", err)
+	}
+	for _, expected := range []string{
+		`"input":{"command":"ls"}`,
+		`"tool":"bash"`,
+		`"tool_use_id":"tu_1"`,
+		`"conversation_id":"conv-42"`,
+		`"cwd":"/work"`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("hook input missing %q\ngot: %s", expected, data)
+		}
+	}
+}
+
+func TestRunPreToolUseHookErrors(t *testing.T) {
+	for name, script := range map[string]string{
+		"exit":     "#!/bin/sh\nexit 1\n",
+		"json":     "#!/bin/sh\necho 'not json'\n",
+		"decision": "#!/bin/sh\necho '{\"decision\":\"maybe\"}'\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			hooksDir := t.TempDir()
+			writeHook(t, hooksDir, "pre-tool-use", script)
+			if _, err := RunPreToolUseHookIn(context.Background(), hooksDir, PreToolUseHookInput{}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRunPostToolUseHook(t *testing.T) {
+	hooksDir := t.TempDir()
+	writeHook(t, hooksDir, "post-tool-use", `#!/bin/sh
+echo '{"replace": "short", "append": "note"}'`)
+	result, err := RunPostToolUseHookIn(context.Background(), hooksDir, PostToolUseHookInput{Output: "long output"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Replace == nil || *result.Replace != "short" || result.Append != "note" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestRunPostToolUseHookEmptyReplace(t *testing.T) {
+	hooksDir := t.TempDir()
+	writeHook(t, hooksDir, "post-tool-use", `#!/bin/sh
+echo '{"replace": ""}'`)
+	result, err := RunPostToolUseHookIn(context.Background(), hooksDir, PostToolUseHookInput{Output: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Replace == nil || *result.Replace != "(no output)" {
+		t.Errorf("result = %+v, want replace %q", result, "(no output)")
+	}
+}
+
+func TestRunToolUseHookFollowsCallContext(t *testing.T) {
+	hooksDir := t.TempDir()
+	writeHook(t, hooksDir, "pre-tool-use", "#!/bin/sh\nexec sleep 30\n")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := RunPreToolUseHookIn(ctx, hooksDir, PreToolUseHookInput{}); err == nil {
+		t.Error("expected an error from a hook cut off by its call's context")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("hook ran for %v after its call's context ended", d)
+	}
+}
+
+func TestToolUseHooksInConversation(t *testing.T) {
+	t.Parallel()
+	h := NewTestHarness(t)
+	defer stopActiveConversationLoops(h.server)
+	ctx := context.Background()
+	cwd := t.TempDir()
+
+	// Deny any bash command mentioning "forbidden", rewrite "ls" to "echo
+	// rewritten", and tag every tool result.
+	writeHook(t, h.server.hooksDir, "pre-tool-use", `#!/bin/sh
+input=$(cat)
+case "$input" in
+*forbidden*) echo '{"decision":"deny","reason":"policy says no"}' ;;
+*'"command":"ls"'*) echo '{"input":{"command":"echo rewritten"}}' ;;
+esac`)
+	writeHook(t, h.server.hooksDir, "post-tool-use", `#!/bin/sh
+echo '{"append":"[checked]"}'`)
+
+	conv, err := h.db.CreateConversation(ctx, nil, true, &cwd, nil, db.ConversationOptions{})
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+	h.convID = conv.ConversationID
+
+	resultText := func() (string, bool) {
+		t.Helper()
+		waitAgentIdle(t, h)
+		msgs, err := h.db.ListMessagesByType(ctx, h.convID, db.MessageTypeUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := len(msgs) - 1; i >= 0; i-- {
+			if msgs[i].LlmData == nil {
+				continue
+			}
+			var m struct {
+				Content []struct {
+					ToolError  bool `json:"ToolError"`
+					ToolResult []struct {
+						Text string `json:"Text"`
+					} `json:"ToolResult"`
+				} `json:"Content"`
+			}
+			if err := json.Unmarshal([]byte(*msgs[i].LlmData), &m); err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range m.Content {
+				if len(c.ToolResult) > 0 {
+					var texts []string
+					for _, r := range c.ToolResult {
+						texts = append(texts, r.Text)
+					}
+					return strings.Join(texts, "|"), c.ToolError
+				}
+			}
+		}
+		t.Fatal("no tool result recorded")
+		return "", false
+	}
+
+	h.Chat("bash: ls")
+	h.WaitResponse()
+	if text, isErr := resultText(); isErr || !strings.Contains(text, "rewritten") || !strings.HasSuffix(text, "|[checked]") {
+		t.Errorf("rewritten call result = %q (error %v)", text, isErr)
+	}
+
+	h.Chat("bash: echo forbidden")
+	h.WaitResponse()
+	if text, isErr := resultText(); !isErr || !strings.Contains(text, "policy says no") {
+		t.Errorf("denied call result = %q (error %v)", text, isErr)
+	}
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+)
+
+// maxTriggerPayload caps the body of a request firing a trigger.
+const maxTriggerPayload = 1 << 20
+
+var triggerNameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// triggerFuncs are the functions prompt templates may call, besides
+// text/template's own.
+var triggerFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// TriggerAPI is a trigger as the API returns it. Secret is only set when
+// a trigger is created or its secret replaced.
+type TriggerAPI struct {
+	Name                string                 `json:"name"`
+	PromptTemplate      string                 `json:"prompt_template"`
+	Model               string                 `json:"model,omitempty"`
+	Cwd                 string                 `json:"cwd,omitempty"`
+	ConversationOptions db.ConversationOptions `json:"conversation_options"`
+	Tags                []string               `json:"tags"`
+	Enabled             bool                   `json:"enabled"`
+	// URL is the path to POST payloads to.
+	URL                string     `json:"url"`
+	Secret             string     `json:"secret,omitempty"`
+	LastFiredAt        *time.Time `json:"last_fired_at,omitempty"`
+	LastConversationID string     `json:"last_conversation_id,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// TriggerRequest creates or replaces a trigger.
+type TriggerRequest struct {
+	// Name is only read when creating a trigger.
+	Name                string                  `json:"name"`
+	PromptTemplate      string                  `json:"prompt_template"`
+	Model               string                  `json:"model,omitempty"`
+	Cwd                 string                  `json:"cwd,omitempty"`
+	ConversationOptions *db.ConversationOptions `json:"conversation_options,omitempty"`
+	Tags                []string                `json:"tags,omitempty"`
+	// Enabled defaults to true.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+func toTriggerAPI(trigger generated.Trigger) TriggerAPI {
+	var opts db.ConversationOptions
+	json.Unmarshal([]byte(trigger.ConversationOptions), &opts)
+	tags := []string{}
+	json.Unmarshal([]byte(trigger.Tags), &tags)
+	return TriggerAPI{
+		Name:                trigger.Name,
+		PromptTemplate:      trigger.PromptTemplate,
+		Model:               derefString(trigger.Model),
+		Cwd:                 derefString(trigger.Cwd),
+		ConversationOptions: opts,
+		Tags:                tags,
+		Enabled:             trigger.Enabled,
+		URL:                 "/api/triggers/" + trigger.Name,
+		LastFiredAt:         trigger.LastFiredAt,
+		LastConversationID:  derefString(trigger.LastConversationID),
+		CreatedAt:           trigger.CreatedAt,
+		UpdatedAt:           trigger.UpdatedAt,
+	}
+}
+
+// triggerParams validates req for the trigger called name. Errors are the
+// client's fault.
+func (s *Server) triggerParams(name string, req TriggerRequest) (generated.UpdateTriggerParams, error) {
+	p := generated.UpdateTriggerParams{Name: name, PromptTemplate: req.PromptTemplate}
+	if strings.TrimSpace(req.PromptTemplate) == "" {
+		return p, errors.New("prompt_template is required")
+	}
+	if _, err := template.New(name).Funcs(triggerFuncs).Parse(req.PromptTemplate); err != nil {
+		return p, fmt.Errorf("invalid prompt_template: %w", err)
+	}
+
+	modelID := req.Model
+	if modelID != "" {
+		if _, err := s.llmManager.GetService(modelID); err != nil {
+			return p, errors.New(unsupportedModelMessage(modelID, s.getModelList()))
+		}
+		p.Model = &modelID
+	} else {
+		modelID = s.effectiveDefaultModel(s.getModelList())
+	}
+	var opts db.ConversationOptions
+	if req.ConversationOptions != nil {
+		opts = *req.ConversationOptions
+	}
+	if msg := validateConversationOptions(opts); msg != "" {
+		return p, errors.New(msg)
+	}
+	if msg := validateModelReasoningLevel(findModelInfo(modelID, s.getModelList()), opts.ThinkingLevel); msg != "" {
+		return p, errors.New(msg)
+	}
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return p, err
+	}
+	p.ConversationOptions = string(optsJSON)
+	tagsJSON, err := json.Marshal(normalizeTags(req.Tags))
+	if err != nil {
+		return p, err
+	}
+	p.Tags = string(tagsJSON)
+
+	if req.Cwd != "" {
+		p.Cwd = &req.Cwd
+	}
+	p.Enabled = req.Enabled == nil || *req.Enabled
+	return p, nil
+}
+
+// triggerAuthorized reports whether r proves it knows secret: with an
+// HMAC-SHA256 of body, as "sha256=<hex>" in X-Shelley-Signature or
+// GitHub's X-Hub-Signature-256, or with the secret itself as a bearer
+// token.
+func triggerAuthorized(r *http.Request, secret string, body []byte) bool {
+	for _, header := range []string{"X-Shelley-Signature", "X-Hub-Signature-256"} {
+		sig := r.Header.Get(header)
+		if sig == "" {
+			continue
+		}
+		hexSig, ok := strings.CutPrefix(sig, "sha256=")
+		got, err := hex.DecodeString(hexSig)
+		if !ok || err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// renderTriggerPrompt executes a trigger's prompt template with the JSON
+// payload, decoded, as dot. An empty payload is nil.
+func renderTriggerPrompt(trigger generated.Trigger, payload []byte) (string, error) {
+	tmpl, err := template.New(trigger.Name).Funcs(triggerFuncs).Parse(trigger.PromptTemplate)
+	if err != nil {
+		return "", err
+	}
+	var data any
+	if len(bytes.TrimSpace(payload)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(payload))
+		dec.UseNumber()
+		if err := dec.Decode(&data); err != nil {
+			return "", fmt.Errorf("payload is not JSON: %w", err)
+		}
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	prompt := strings.TrimSpace(b.String())
+	if prompt == "" {
+		return "", errors.New("prompt template rendered an empty prompt")
+	}
+	return prompt, nil
+}
+
+// handleFireTrigger handles POST /api/triggers/{name}: it starts a
+// conversation with the trigger's prompt for the payload. The request is
+// authenticated by the trigger's secret, not the usual headers.
+func (s *Server) handleFireTrigger(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTriggerPayload))
+	if err != nil {
+		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	trigger, err := s.db.GetTrigger(ctx, r.PathValue("name"))
+	if err != nil {
+		s.logger.Error("Failed to get trigger", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if trigger == nil {
+		http.Error(w, "Trigger not found", http.StatusNotFound)
+		return
+	}
+	if !triggerAuthorized(r, trigger.Secret, body) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if !trigger.Enabled {
+		http.Error(w, "Trigger is disabled", http.StatusForbidden)
+		return
+	}
+	prompt, err := renderTriggerPrompt(*trigger, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	api := toTriggerAPI(*trigger)
+	conversationID, err := s.startConversation(context.WithoutCancel(ctx), api.Model, trigger.Cwd, api.ConversationOptions, api.Tags, prompt)
+	if err != nil {
+		s.logger.Error("Trigger failed to start a conversation", "trigger", trigger.Name, "conversationID", conversationID, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.RecordTriggerFired(ctx, trigger.Name, conversationID, time.Now().UTC()); err != nil {
+		s.logger.Error("Failed to record trigger firing", "trigger", trigger.Name, "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"conversation_id": conversationID,
+		"url":             s.conversationURL(conversationID),
+	})
+}
+
+func (s *Server) handleListTriggers(w http.ResponseWriter, r *http.Request) {
+	triggers, err := s.db.ListTriggers(r.Context())
+	if err != nil {
+		s.logger.Error("Failed to list triggers", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	out := make([]TriggerAPI, 0, len(triggers))
+	for _, trigger := range triggers {
+		out = append(out, toTriggerAPI(trigger))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (s *Server) handleCreateTrigger(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req TriggerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !triggerNameRE.MatchString(req.Name) {
+		http.Error(w, "name must be 1-64 lowercase letters, digits, '-' or '_', starting with a letter or digit", http.StatusBadRequest)
+		return
+	}
+	p, err := s.triggerParams(req.Name, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if existing, err := s.db.GetTrigger(ctx, req.Name); err != nil || existing != nil {
+		http.Error(w, fmt.Sprintf("Trigger %q already exists", req.Name), http.StatusConflict)
+		return
+	}
+	trigger, err := s.db.CreateTrigger(ctx, generated.CreateTriggerParams{
+		Name:                p.Name,
+		Secret:              rand.Text(),
+		PromptTemplate:      p.PromptTemplate,
+		Model:               p.Model,
+		Cwd:                 p.Cwd,
+		ConversationOptions: p.ConversationOptions,
+		Tags:                p.Tags,
+		Enabled:             p.Enabled,
+	})
+	if err != nil {
+		s.logger.Error("Failed to create trigger", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	out := toTriggerAPI(*trigger)
+	out.Secret = trigger.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out)
+}
+
+func (s *Server) handleGetTrigger(w http.ResponseWriter, r *http.Request) {
+	trigger, err := s.db.GetTrigger(r.Context(), r.PathValue("name"))
+	if err != nil {
+		s.logger.Error("Failed to get trigger", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if trigger == nil {
+		http.Error(w, "Trigger not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toTriggerAPI(*trigger))
+}
+
+// handleUpdateTrigger replaces a trigger's definition. Its name and
+// secret stay the same.
+func (s *Server) handleUpdateTrigger(w http.ResponseWriter, r *http.Request) {
+	var req TriggerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	p, err := s.triggerParams(r.PathValue("name"), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	trigger, err := s.db.UpdateTrigger(r.Context(), p)
+	if err != nil {
+		s.logger.Error("Failed to update trigger", "trigger", p.Name, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if trigger == nil {
+		http.Error(w, "Trigger not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toTriggerAPI(*trigger))
+}
+
+// handleRotateTriggerSecret replaces a trigger's secret, returning the
+// new one. The old one stops working at once.
+func (s *Server) handleRotateTriggerSecret(w http.ResponseWriter, r *http.Request) {
+	trigger, err := s.db.SetTriggerSecret(r.Context(), r.PathValue("name"), rand.Text())
+	if err != nil {
+		s.logger.Error("Failed to rotate trigger secret", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if trigger == nil {
+		http.Error(w, "Trigger not found", http.StatusNotFound)
+		return
+	}
+	out := toTriggerAPI(*trigger)
+	out.Secret = trigger.Secret
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (s *Server) handleDeleteTrigger(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.db.DeleteTrigger(r.Context(), r.PathValue("name"))
+	if err != nil {
+		s.logger.Error("Failed to delete trigger", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Trigger not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/db/generated"
+)
+
+func TestTriggerCRUD(t *testing.T) {
+	t.Parallel()
+	server, _, _ := newTestServer(t)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	for _, body := range []string{
+		`{"name":"ci","prompt_template":""}`,
+		`{"name":"CI","prompt_template":"p"}`,
+		`{"name":"ci/x","prompt_template":"p"}`,
+		`{"name":"ci","prompt_template":"{{.unclosed"}`,
+	} {
+		if w := do("POST", "/api/triggers", body); w.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status=%d body=%s", body, w.Code, w.Body.String())
+		}
+	}
+
+	w := do("POST", "/api/triggers", `{"name":"ci","prompt_template":"Build {{.build}} failed.","tags":["ci"," ci "]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status=%d body=%s", w.Code, w.Body.String())
+	}
+	var created TriggerAPI
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if created.Secret == "" || !created.Enabled || created.URL != "/api/triggers/ci" || len(created.Tags) != 1 || created.Tags[0] != "ci" {
+		t.Errorf("created = %+v", created)
+	}
+	if w := do("POST", "/api/triggers", `{"name":"ci","prompt_template":"p"}`); w.Code != http.StatusConflict {
+		t.Errorf("create duplicate: status=%d", w.Code)
+	}
+
+	w = do("GET", "/api/triggers", "")
+	if strings.Contains(w.Body.String(), created.Secret) {
+		t.Errorf("list leaks the secret: %s", w.Body.String())
+	}
+	var list []TriggerAPI
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Name != "ci" {
+		t.Errorf("list = %+v", list)
+	}
+
+	w = do("PUT", "/api/triggers/ci", `{"prompt_template":"Alert: {{.title}}","enabled":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: status=%d body=%s", w.Code, w.Body.String())
+	}
+	var updated TriggerAPI
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	if updated.Enabled || updated.PromptTemplate != "Alert: {{.title}}" || updated.Secret != "" {
+		t.Errorf("updated = %+v", updated)
+	}
+	if w := do("PUT", "/api/triggers/nope", `{"prompt_template":"p"}`); w.Code != http.StatusNotFound {
+		t.Errorf("update missing: status=%d", w.Code)
+	}
+
+	w = do("POST", "/api/triggers/ci/secret", "")
+	var rotated TriggerAPI
+	json.Unmarshal(w.Body.Bytes(), &rotated)
+	if w.Code != http.StatusOK || rotated.Secret == "" || rotated.Secret == created.Secret {
+		t.Errorf("rotate: status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	if w := do("DELETE", "/api/triggers/ci", ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status=%d", w.Code)
+	}
+	if w := do("GET", "/api/triggers/ci", ""); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted: status=%d", w.Code)
+	}
+	if w := do("DELETE", "/api/triggers/ci", ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete twice: status=%d", w.Code)
+	}
+}
+
+func TestFireTrigger(t *testing.T) {
+	t.Parallel()
+	server, database, _ := newTestServer(t)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	ctx := context.Background()
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/triggers", strings.NewReader(
+		`{"name":"ci","prompt_template":"echo: {{.repo}} build {{.build}} failed: {{json .jobs}}","tags":["ci"]}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status=%d body=%s", w.Code, w.Body.String())
+	}
+	var trigger TriggerAPI
+	json.Unmarshal(w.Body.Bytes(), &trigger)
+
+	payload := `{"repo":"shelley","build":1234,"jobs":["lint"]}`
+	sign := func(secret, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	fire := func(body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/triggers/ci", strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, header := range []map[string]string{
+		nil,
+		{"X-Shelley-Signature": sign("wrong", payload)},
+		{"X-Shelley-Signature": trigger.Secret},
+		{"Authorization": "Bearer wrong"},
+	} {
+		if w := fire(payload, header); w.Code != http.StatusUnauthorized {
+			t.Errorf("fire with %v: status=%d", header, w.Code)
+		}
+	}
+	if w := fire("not json", map[string]string{"Authorization": "Bearer " + trigger.Secret}); w.Code != http.StatusBadRequest {
+		t.Errorf("fire with bad payload: status=%d", w.Code)
+	}
+
+	w = fire(payload, map[string]string{"X-Hub-Signature-256": sign(trigger.Secret, payload)})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("fire: status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		ConversationID string `json:"conversation_id"`
+		URL            string `json:"url"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.ConversationID == "" || !strings.HasSuffix(resp.URL, "/c/"+resp.ConversationID) {
+		t.Fatalf("fire response = %s", w.Body.String())
+	}
+
+	msgs, err := database.ListMessagesByType(ctx, resp.ConversationID, db.MessageTypeUser)
+	if err != nil || len(msgs) == 0 {
+		t.Fatalf("messages = %v, %v", msgs, err)
+	}
+	if body := derefString(msgs[0].LlmData); !strings.Contains(body, `shelley build 1234 failed: [\"lint\"]`) {
+		t.Errorf("prompt = %s", body)
+	}
+	conv, err := database.GetConversationByID(ctx, resp.ConversationID)
+	if err != nil || conv.Tags != `["ci"]` {
+		t.Errorf("conversation = %+v, %v", conv, err)
+	}
+	fired, err := database.GetTrigger(ctx, "ci")
+	if err != nil || fired.LastFiredAt == nil || derefString(fired.LastConversationID) != resp.ConversationID {
+		t.Errorf("trigger after firing = %+v, %v", fired, err)
+	}
+
+	if w := fire(payload, map[string]string{"Authorization": "Bearer " + trigger.Secret}); w.Code != http.StatusCreated {
+		t.Errorf("fire with bearer token: status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	if _, err := database.UpdateTrigger(ctx, generated.UpdateTriggerParams{
+		Name:                "ci",
+		PromptTemplate:      fired.PromptTemplate,
+		ConversationOptions: fired.ConversationOptions,
+		Tags:                fired.Tags,
+		Enabled:             false,
+	}); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if w := fire(payload, map[string]string{"Authorization": "Bearer " + trigger.Secret}); w.Code != http.StatusForbidden {
+		t.Errorf("fire disabled: status=%d", w.Code)
+	}
+	req := httptest.NewRequest("POST", "/api/triggers/nope", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("fire missing: status=%d", w.Code)
+	}
+}
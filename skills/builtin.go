@@ -48,17 +48,22 @@ func BuiltinSkills() []Skill {
 
 		var when string
 		if w, ok := frontmatter["when"].(string); ok {
+			if _, err := ParseWhen(w); err != nil {
+				panic(fmt.Sprintf("embedded skill %s: %v", path, err))
+			}
 			when = w
 		}
+		allowedTools, _ := frontmatter["allowed-tools"].(string)
 
 		// Extract the body (everything after the second ---)
 		body := extractBody(string(data))
 
 		out = append(out, Skill{
-			Name:        name,
-			Description: description,
-			When:        when,
-			Body:        body,
+			Name:         name,
+			Description:  description,
+			When:         when,
+			AllowedTools: allowedTools,
+			Body:         body,
 		})
 		return nil
 	})
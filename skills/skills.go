@@ -180,9 +180,14 @@ func Parse(path string) (Skill, error) {
 
 	if tools, ok := frontmatter["allowed-tools"].(string); ok {
 		skill.AllowedTools = tools
+	} else if tools, ok := frontmatter["allowed_tools"].(string); ok {
+		skill.AllowedTools = tools
 	}
 
 	if when, ok := frontmatter["when"].(string); ok {
+		if _, err := ParseWhen(when); err != nil {
+			return Skill{}, &ValidationError{Message: err.Error()}
+		}
 		skill.When = when
 	}
 
@@ -555,17 +560,10 @@ func ListAll(workingDir, gitRoot string) []Skill {
 	return all
 }
 
-// Env describes the runtime environment used to gate skills with a `when:`
-// condition. Currently only ExeDev is checked; extend as new conditions are
-// added. The zero value satisfies no conditions, so skills with a `when:`
-// clause are filtered out by default.
-type Env struct {
-	ExeDev bool
-}
-
 // Filter returns the subset of skills whose `when:` condition is satisfied by
-// env. Skills without a `when:` clause are always included. Unknown condition
-// values cause the skill to be filtered out (fail-closed).
+// env (see Condition). Skills without a `when:` clause are always included.
+// Unknown conditions and clauses that do not parse cause the skill to be
+// filtered out (fail-closed).
 func Filter(in []Skill, env Env) []Skill {
 	out := make([]Skill, 0, len(in))
 	for _, s := range in {
@@ -576,15 +574,6 @@ func Filter(in []Skill, env Env) []Skill {
 	return out
 }
 
-func matchWhen(when string, env Env) bool {
-	switch strings.TrimSpace(when) {
-	case "exe.dev":
-		return env.ExeDev
-	default:
-		return false
-	}
-}
-
 // FindByName looks up a skill by name and returns its raw SKILL.md content.
 //
 // Filesystem skills take priority: if a SKILL.md exists on the filesystem
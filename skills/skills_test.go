@@ -657,7 +657,7 @@ func TestFindByNameBuiltin(t *testing.T) {
 	if !strings.Contains(content, "name: schedule") {
 		t.Error("expected content to contain frontmatter")
 	}
-	if !strings.Contains(content, "systemd") {
+	if !strings.Contains(content, "`schedule` tool") {
 		t.Error("expected content to contain skill body")
 	}
 }
@@ -873,3 +873,146 @@ func TestFilterWhen(t *testing.T) {
 		t.Errorf("ExeDev=true: got %v, want [always on-exe]", skillNames(got))
 	}
 }
+
+func TestWhenExpressions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"go.mod", "Makefile"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := Env{
+		WorkingDir: dir,
+		GitRoot:    dir,
+		Getenv: func(name string) string {
+			if name == "CI" {
+				return "true"
+			}
+			return ""
+		},
+		ModelCapabilities: []string{"images"},
+	}
+
+	tests := []struct {
+		when string
+		want bool
+	}{
+		{"git", true},
+		{"exe.dev", false},
+		{"file(Makefile)", true},
+		{"file(*.mod)", true},
+		{"file(*.py)", false},
+		{"lang(go)", true},
+		{"lang(Go)", true},
+		{"lang(python)", false},
+		{"env(CI)", true},
+		{"env(CI=true)", true},
+		{"env(CI=false)", false},
+		{"env(HOME)", false},
+		{"model(images)", true},
+		{"model(reasoning)", false},
+		{"git && lang(go)", true},
+		{"git and exe.dev", false},
+		{"exe.dev || file(Makefile)", true},
+		{"!env(CI)", false},
+		{"not exe.dev", true},
+		{"git && (exe.dev || model(images)) && !lang(rust)", true},
+		{"mars", false},
+		{"not mars", false},
+		{"git || mars", false},
+		{"!(mars && exe.dev)", false},
+	}
+	for _, tt := range tests {
+		c, err := ParseWhen(tt.when)
+		if err != nil {
+			t.Errorf("ParseWhen(%q): %v", tt.when, err)
+			continue
+		}
+		if got := c.Match(env); got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.when, got, tt.want)
+		}
+	}
+
+	if matchWhen("git", Env{}) {
+		t.Error("the zero Env should not satisfy git")
+	}
+}
+
+func TestParseWhenErrors(t *testing.T) {
+	for _, when := range []string{"", "git &&", "(git", "git)", "file()", "file(x", "git exe.dev", "&& git"} {
+		if _, err := ParseWhen(when); err == nil {
+			t.Errorf("ParseWhen(%q) should fail", when)
+		}
+	}
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "SKILL.md")
+	content := "---\nname: foo\ndescription: Foo skill.\nwhen: git &&\n---\n\nbody\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(path); err == nil {
+		t.Error("Parse should reject a malformed when clause")
+	}
+}
+
+func TestAllowsTool(t *testing.T) {
+	s := Skill{AllowedTools: "bash, Patch browser_* Bash(git log:*)"}
+	if got := strings.Join(s.ToolPatterns(), "|"); got != "bash|Patch|browser_*|Bash(git log:*)" {
+		t.Errorf("ToolPatterns = %q", got)
+	}
+	for tool, want := range map[string]bool{
+		"bash":               true,
+		"patch":              true,
+		"browser_screenshot": true,
+		"keyword_search":     false,
+	} {
+		if got := s.AllowsTool(tool); got != want {
+			t.Errorf("AllowsTool(%q) = %v, want %v", tool, got, want)
+		}
+	}
+	if !(Skill{}).AllowsTool("anything") {
+		t.Error("a skill without allowed-tools should allow every tool")
+	}
+}
+
+func TestReadSkill(t *testing.T) {
+	dir := t.TempDir()
+	skillMD := "---\nname: my-skill\ndescription: Mine.\n---\n\nDo the thing.\n"
+	path := filepath.Join(dir, "my-skill", "SKILL.md")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(skillMD), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	listed := 0
+	list := func() []Skill {
+		listed++
+		return append([]Skill{{Name: "my-skill", Path: path}}, BuiltinSkills()...)
+	}
+
+	for output, want := range map[string]string{
+		skillMD:                            "my-skill",
+		"$ cat SKILL.md\n" + skillMD + "$": "my-skill",
+		"---\nname: my-skill\n---\n":       "", // only part of the file
+		"shelley skill cat my-skill":       "", // the command, not the file
+	} {
+		got, ok := ReadSkill(output, list)
+		if got.Name != want || ok != (want != "") {
+			t.Errorf("ReadSkill(%q) = %q, %v; want %q", output, got.Name, ok, want)
+		}
+	}
+	if listed != 3 {
+		t.Errorf("listed skills %d times, want 3 (not for output without a name line)", listed)
+	}
+
+	builtin := BuiltinSkills()[0]
+	content, err := builtin.file()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := ReadSkill(content, list); !ok || got.Name != builtin.Name {
+		t.Errorf("built-in skill: ReadSkill = %q, %v; want %q", got.Name, ok, builtin.Name)
+	}
+}
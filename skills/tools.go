@@ -0,0 +1,99 @@
+package skills
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ToolPatterns returns the entries of the skill's allowed-tools field. The
+// field is a space- or comma-separated list of tool names, which may use
+// path.Match wildcards (e.g. "browser_*"). An entry may carry an argument
+// qualifier in the Claude Code style, such as "Bash(git log:*)"; Shelley
+// cannot restrict a tool's arguments, so the qualifier is kept but ignored.
+func (s Skill) ToolPatterns() []string {
+	var patterns []string
+	var cur strings.Builder
+	depth := 0
+	flush := func() {
+		if cur.Len() > 0 {
+			patterns = append(patterns, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range s.AllowedTools {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0 && (r == ',' || r == ' ' || r == '\t' || r == '\n'):
+			flush()
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	flush()
+	return patterns
+}
+
+// AllowsTool reports whether the skill's allowed-tools field permits the
+// named tool. Matching is case-insensitive. A skill without allowed-tools
+// permits every tool.
+func (s Skill) AllowsTool(name string) bool {
+	patterns := s.ToolPatterns()
+	if len(patterns) == 0 {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		p, _, _ = strings.Cut(p, "(")
+		if ok, _ := path.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skillNameRe matches the name line of a SKILL.md frontmatter.
+var skillNameRe = regexp.MustCompile(`(?m)^name:\s*["']?([a-z0-9-]+)`)
+
+// ReadSkill returns the skill whose SKILL.md appears in full in output: the
+// skill a command read, whether with `shelley skill cat` (as the
+// <available_skills> section advertises), cat, or anything else that
+// prints the file. list supplies the candidates; it is only called when
+// output has a SKILL.md name line, since listing skills walks the project
+// tree.
+func ReadSkill(output string, list func() []Skill) (Skill, bool) {
+	names := make(map[string]bool)
+	for _, m := range skillNameRe.FindAllStringSubmatch(output, -1) {
+		names[m[1]] = true
+	}
+	if len(names) == 0 {
+		return Skill{}, false
+	}
+	for _, s := range list() {
+		if !names[s.Name] {
+			continue
+		}
+		content, err := s.file()
+		if content = strings.TrimSpace(content); err != nil || content == "" {
+			continue
+		}
+		if strings.Contains(output, content) {
+			return s, true
+		}
+	}
+	return Skill{}, false
+}
+
+// file returns the contents of the skill's SKILL.md.
+func (s Skill) file() (string, error) {
+	if s.Path == "" {
+		data, err := builtinFS.ReadFile("builtin/" + s.Name + "/SKILL.md")
+		return string(data), err
+	}
+	data, err := os.ReadFile(s.Path)
+	return string(data), err
+}
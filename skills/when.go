@@ -0,0 +1,314 @@
+package skills
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Env describes the runtime environment used to gate skills with a `when:`
+// condition. The zero value satisfies no conditions except negated ones, so
+// skills whose `when:` clause needs something from the environment are
+// filtered out by default.
+type Env struct {
+	// ExeDev reports whether Shelley is running on exe.dev.
+	ExeDev bool
+	// WorkingDir is the conversation's working directory, searched by the
+	// file() and lang() conditions.
+	WorkingDir string
+	// GitRoot is the root of the git repository containing WorkingDir, or
+	// empty when it is not in one. lang() also looks here.
+	GitRoot string
+	// Getenv looks up environment variables for the env() condition. Nil
+	// means no variables are set.
+	Getenv func(string) string
+	// ModelCapabilities lists what the conversation's model supports, for
+	// the model() condition: "images" and "reasoning".
+	ModelCapabilities []string
+}
+
+// Condition is a parsed `when:` clause, a boolean expression over
+// conditions:
+//
+//	exe.dev             running on exe.dev
+//	git                 the working directory is in a git repository
+//	file(GLOB)          a file in the working directory matches GLOB
+//	lang(NAME)          the project uses language NAME (see langMarkers)
+//	env(NAME)           environment variable NAME is set and non-empty
+//	env(NAME=VALUE)     environment variable NAME equals VALUE
+//	model(CAPABILITY)   the conversation's model has CAPABILITY
+//
+// combined with `&&`/`and`, `||`/`or`, `!`/`not` and parentheses, e.g.
+// `git && (lang(go) || file(Makefile)) && not env(CI)`.
+//
+// A clause naming a condition this version does not know parses, but never
+// matches, however it is combined: a skill written for a newer Shelley
+// stays hidden.
+type Condition struct {
+	root    whenNode
+	unknown bool
+}
+
+type whenNode interface {
+	match(env Env) bool
+}
+
+type (
+	whenAnd  struct{ left, right whenNode }
+	whenOr   struct{ left, right whenNode }
+	whenNot  struct{ node whenNode }
+	whenAtom struct{ name, arg string }
+)
+
+func (n whenAnd) match(env Env) bool { return n.left.match(env) && n.right.match(env) }
+func (n whenOr) match(env Env) bool  { return n.left.match(env) || n.right.match(env) }
+func (n whenNot) match(env Env) bool { return !n.node.match(env) }
+
+// match evaluates a single, known condition.
+func (n whenAtom) match(env Env) bool {
+	switch n.name {
+	case "exe.dev":
+		return env.ExeDev
+	case "git":
+		return env.GitRoot != ""
+	case "file":
+		return hasFileMatching(env.WorkingDir, n.arg)
+	case "lang":
+		return detectLang(env, n.arg)
+	case "env":
+		if env.Getenv == nil {
+			return false
+		}
+		name, value, hasValue := strings.Cut(n.arg, "=")
+		if hasValue {
+			return env.Getenv(name) == value
+		}
+		return env.Getenv(name) != ""
+	case "model":
+		return slices.Contains(env.ModelCapabilities, n.arg)
+	default:
+		return false
+	}
+}
+
+// ParseWhen parses a `when:` clause.
+func ParseWhen(expr string) (*Condition, error) {
+	p := &whenParser{tokens: tokenizeWhen(expr)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty when expression")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("when %q: %w", expr, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("when %q: unexpected %q", expr, p.tokens[p.pos])
+	}
+	return &Condition{root: node, unknown: p.unknown}, nil
+}
+
+// Match reports whether env satisfies the condition. It is false for a
+// clause with an unknown condition.
+func (c *Condition) Match(env Env) bool {
+	return !c.unknown && c.root.match(env)
+}
+
+// tokenizeWhen splits a `when:` clause into operators, parentheses and
+// conditions. A condition's argument list, parentheses included, stays
+// part of the condition's token.
+func tokenizeWhen(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '!':
+			tokens = append(tokens, string(c))
+			i++
+		case strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		default:
+			j := i
+			for j < len(s) && isWhenIdentByte(s[j]) {
+				j++
+			}
+			if j == i {
+				// A stray character; keep it so the parser reports it.
+				tokens = append(tokens, string(c))
+				i++
+				continue
+			}
+			if j < len(s) && s[j] == '(' {
+				if end := strings.IndexByte(s[j:], ')'); end >= 0 {
+					j += end + 1
+				}
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+func isWhenIdentByte(c byte) bool {
+	r := rune(c)
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || c == '.' || c == '-' || c == '_'
+}
+
+type whenParser struct {
+	tokens  []string
+	pos     int
+	unknown bool // an unknown condition was parsed
+}
+
+func (p *whenParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *whenParser) parseOr() (whenNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok == "||" || tok == "or"; tok = p.peek() {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = whenOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseAnd() (whenNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok == "&&" || tok == "and"; tok = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = whenAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseUnary() (whenNode, error) {
+	switch tok := p.peek(); tok {
+	case "!", "not":
+		p.pos++
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return whenNot{node}, nil
+	case "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		p.pos++
+		node, err := parseWhenAtom(tok)
+		if err == nil && !knownWhenConditions[node.name] {
+			p.unknown = true
+		}
+		return node, err
+	}
+}
+
+// knownWhenConditions are the conditions whenAtom.match evaluates.
+var knownWhenConditions = map[string]bool{
+	"exe.dev": true, "git": true, "file": true, "lang": true, "env": true, "model": true,
+}
+
+func parseWhenAtom(tok string) (whenAtom, error) {
+	name, rest, hasArg := strings.Cut(tok, "(")
+	if name == "" || !isWhenIdentByte(name[0]) || name == "and" || name == "or" {
+		return whenAtom{}, fmt.Errorf("unexpected %q", tok)
+	}
+	if !hasArg {
+		return whenAtom{name: name}, nil
+	}
+	arg, ok := strings.CutSuffix(rest, ")")
+	if !ok {
+		return whenAtom{}, fmt.Errorf("missing ) after %s(", name)
+	}
+	arg = unquoteYAML(strings.TrimSpace(arg))
+	if arg == "" {
+		return whenAtom{}, fmt.Errorf("%s() needs an argument", name)
+	}
+	return whenAtom{name: name, arg: arg}, nil
+}
+
+// matchWhen evaluates a `when:` clause against env. Clauses that do not
+// parse are false.
+func matchWhen(when string, env Env) bool {
+	c, err := ParseWhen(when)
+	if err != nil {
+		return false
+	}
+	return c.Match(env)
+}
+
+// hasFileMatching reports whether a path under dir matches the glob
+// pattern (relative to dir, in filepath.Match syntax).
+func hasFileMatching(dir, pattern string) bool {
+	if dir == "" || filepath.IsAbs(pattern) {
+		return false
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	return err == nil && len(matches) > 0
+}
+
+// langMarkers maps the languages lang() knows to the files that mark a
+// project as using them. Globs are matched in the working directory and at
+// the git root.
+var langMarkers = map[string][]string{
+	"go":         {"go.mod", "*.go"},
+	"python":     {"pyproject.toml", "setup.py", "requirements.txt", "Pipfile", "*.py"},
+	"javascript": {"package.json", "*.js", "*.mjs"},
+	"typescript": {"tsconfig.json", "*.ts", "*.tsx"},
+	"rust":       {"Cargo.toml"},
+	"ruby":       {"Gemfile", "*.gemspec"},
+	"java":       {"pom.xml", "build.gradle", "build.gradle.kts"},
+	"c":          {"*.c", "*.h"},
+	"cpp":        {"*.cc", "*.cpp", "*.hpp"},
+	"elixir":     {"mix.exs"},
+	"php":        {"composer.json"},
+	"swift":      {"Package.swift"},
+}
+
+func detectLang(env Env, lang string) bool {
+	markers := langMarkers[strings.ToLower(lang)]
+	for _, dir := range []string{env.WorkingDir, env.GitRoot} {
+		if dir == "" {
+			continue
+		}
+		for _, marker := range markers {
+			if hasFileMatching(dir, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -131,8 +131,10 @@ func preferredModels(available []string, tried map[string]bool) []string {
 // 4. Try models matching preferredModelSubstrings (covers untagged gateway models)
 // 5. Fall back to the conversation's model (conversationModelID)
 func generateSlugText(ctx context.Context, llmProvider LLMServiceProvider, logger *slog.Logger, userMessage, conversationModelID string) (string, error) {
-	// If conversation is using predictable model, use it for slug generation too
-	if conversationModelID == "predictable" {
+	// If conversation is using predictable model (or a scenario played by
+	// it), use it for slug generation too
+	predictable := conversationModelID == "predictable" || strings.HasPrefix(conversationModelID, "predictable:")
+	if predictable {
 		llmService, err := llmProvider.GetService("predictable")
 		if err == nil {
 			logger.Debug("Using predictable model for slug generation")
@@ -189,7 +191,7 @@ func generateSlugText(ctx context.Context, llmProvider LLMServiceProvider, logge
 	}
 
 	// Fall back to the conversation's model
-	if conversationModelID != "" && conversationModelID != "predictable" && !tried[conversationModelID] {
+	if conversationModelID != "" && !predictable && !tried[conversationModelID] {
 		llmService, err := llmProvider.GetService(conversationModelID)
 		if err == nil {
 			logger.Debug("Using conversation model for slug generation", "model", conversationModelID)
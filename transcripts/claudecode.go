@@ -0,0 +1,174 @@
+package transcripts
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/llm"
+)
+
+type claudeRecord struct {
+	Type        string `json:"type"`
+	IsSidechain bool   `json:"isSidechain"`
+	IsMeta      bool   `json:"isMeta"`
+	Timestamp   string `json:"timestamp"`
+	Cwd         string `json:"cwd"`
+	Summary     string `json:"summary"`
+	Message     struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"message"`
+}
+
+type claudeBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	Thinking  string          `json:"thinking"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	IsError   bool            `json:"is_error"`
+	Source    struct {
+		Type      string `json:"type"`
+		MediaType string `json:"media_type"`
+		Data      string `json:"data"`
+	} `json:"source"`
+}
+
+// claudeBlocks decodes message content, which is either a string or a list
+// of content blocks.
+func claudeBlocks(raw json.RawMessage) []claudeBlock {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return []claudeBlock{{Type: "text", Text: s}}
+	}
+	var blocks []claudeBlock
+	json.Unmarshal(raw, &blocks)
+	return blocks
+}
+
+// parseClaudeCode reads a Claude Code session log. Sidechain records, the
+// work of Task subagents, are skipped, as are records Claude Code adds for
+// its own bookkeeping.
+func parseClaudeCode(r io.Reader) (*builder, error) {
+	b := newBuilder()
+	var summary string
+	err := decodeRecords(r, func(raw json.RawMessage) error {
+		var rec claudeRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return err
+		}
+		if rec.Type == "summary" && summary == "" {
+			summary = rec.Summary
+		}
+		if rec.IsSidechain || rec.IsMeta || (rec.Type != "user" && rec.Type != "assistant") {
+			return nil
+		}
+		if b.cwd == "" {
+			b.cwd = rec.Cwd
+		}
+		at := parseTime(rec.Timestamp)
+		for _, block := range claudeBlocks(rec.Message.Content) {
+			switch block.Type {
+			case "text":
+				if rec.Type == "user" {
+					b.userText(at, block.Text)
+				} else {
+					b.agentText(at, block.Text)
+				}
+			case "image":
+				if block.Source.Type == "base64" {
+					b.userImage(at, block.Source.MediaType, block.Source.Data)
+				}
+			case "thinking":
+				b.agentThinking(at, block.Thinking)
+			case "tool_use", "server_tool_use":
+				tool, input := claudeToolEquivalent(block.Name, block.Input)
+				b.toolCall(at, block.ID, block.Name, block.Input, tool, input)
+			case "tool_result":
+				b.toolResult(at, block.ToolUseID, block.IsError, claudeToolResult(block.Content))
+			}
+		}
+		return nil
+	})
+	if summary != "" {
+		b.title = summary
+	}
+	return b, err
+}
+
+// claudeToolEquivalent maps a Claude Code tool call to a Shelley one:
+// Bash to bash, and Write, Edit and MultiEdit to patch. Edits replacing
+// every occurrence have no patch equivalent.
+func claudeToolEquivalent(name string, input json.RawMessage) (string, any) {
+	var in struct {
+		Command    string `json:"command"`
+		FilePath   string `json:"file_path"`
+		Content    string `json:"content"`
+		OldString  string `json:"old_string"`
+		NewString  string `json:"new_string"`
+		ReplaceAll bool   `json:"replace_all"`
+		Edits      []struct {
+			OldString  string `json:"old_string"`
+			NewString  string `json:"new_string"`
+			ReplaceAll bool   `json:"replace_all"`
+		} `json:"edits"`
+	}
+	if json.Unmarshal(input, &in) != nil {
+		return "", nil
+	}
+	switch name {
+	case "Bash":
+		if in.Command != "" {
+			return "bash", bashCall{Command: in.Command}
+		}
+	case "Write":
+		if in.FilePath != "" {
+			return "patch", claudetool.PatchInput{
+				Path:    in.FilePath,
+				Patches: []claudetool.PatchRequest{{Operation: "overwrite", NewText: in.Content}},
+			}
+		}
+	case "Edit":
+		if in.FilePath != "" && !in.ReplaceAll {
+			return "patch", claudetool.PatchInput{
+				Path:    in.FilePath,
+				Patches: []claudetool.PatchRequest{{Operation: "replace", OldText: in.OldString, NewText: in.NewString}},
+			}
+		}
+	case "MultiEdit":
+		patch := claudetool.PatchInput{Path: in.FilePath}
+		for _, e := range in.Edits {
+			if e.ReplaceAll {
+				return "", nil
+			}
+			patch.Patches = append(patch.Patches, claudetool.PatchRequest{Operation: "replace", OldText: e.OldString, NewText: e.NewString})
+		}
+		if in.FilePath != "" && len(patch.Patches) > 0 {
+			return "patch", patch
+		}
+	}
+	return "", nil
+}
+
+// claudeToolResult decodes tool_result content: a string or a list of text
+// and image blocks.
+func claudeToolResult(raw json.RawMessage) []llm.Content {
+	var result []llm.Content
+	for _, block := range claudeBlocks(raw) {
+		switch block.Type {
+		case "text":
+			if strings.TrimSpace(block.Text) != "" {
+				result = append(result, textContent(block.Text))
+			}
+		case "image":
+			if block.Source.Type == "base64" {
+				result = append(result, imageContent(block.Source.MediaType, block.Source.Data))
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,211 @@
+package transcripts
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"shelley.exe.dev/llm"
+)
+
+// codexLine is a record of a rollout log. Current logs wrap every item in
+// {timestamp, type, payload}; older ones have the items bare.
+type codexLine struct {
+	Timestamp string          `json:"timestamp"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+type codexItem struct {
+	Type    string `json:"type"`
+	Role    string `json:"role"`
+	Cwd     string `json:"cwd"`
+	Content []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		ImageURL string `json:"image_url"`
+	} `json:"content"`
+	Summary []struct {
+		Text string `json:"text"`
+	} `json:"summary"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Input     string          `json:"input"`
+	CallID    string          `json:"call_id"`
+	Output    json.RawMessage `json:"output"`
+	Action    struct {
+		Command          []string `json:"command"`
+		WorkingDirectory string   `json:"working_directory"`
+	} `json:"action"`
+}
+
+// parseCodex reads a Codex rollout log. The environment and instructions
+// Codex sends as user messages are skipped.
+func parseCodex(r io.Reader) (*builder, error) {
+	b := newBuilder()
+	var last time.Time
+	err := decodeRecords(r, func(raw json.RawMessage) error {
+		var line codexLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return err
+		}
+		if at := parseTime(line.Timestamp); !at.IsZero() {
+			last = at
+		}
+		itemJSON := raw
+		switch {
+		case line.Type == "session_meta":
+			var meta codexItem
+			json.Unmarshal(line.Payload, &meta)
+			b.cwd = meta.Cwd
+			return nil
+		case line.Type == "response_item":
+			itemJSON = line.Payload
+		case line.Payload != nil:
+			// Events and turn context duplicate the response items.
+			return nil
+		}
+		var item codexItem
+		if err := json.Unmarshal(itemJSON, &item); err != nil {
+			return err
+		}
+		b.addCodexItem(last, item)
+		return nil
+	})
+	return b, err
+}
+
+func (b *builder) addCodexItem(at time.Time, item codexItem) {
+	switch item.Type {
+	case "message":
+		for _, c := range item.Content {
+			switch {
+			case item.Role == "assistant" && c.Type == "output_text":
+				b.agentText(at, c.Text)
+			case item.Role == "user" && c.Type == "input_text" && !isCodexContext(c.Text):
+				b.userText(at, c.Text)
+			case item.Role == "user" && c.Type == "input_image":
+				if mediaType, data, ok := parseDataURL(c.ImageURL); ok {
+					b.userImage(at, mediaType, data)
+				}
+			}
+		}
+	case "reasoning":
+		var texts []string
+		for _, s := range item.Summary {
+			texts = append(texts, s.Text)
+		}
+		b.agentThinking(at, strings.Join(texts, "\n\n"))
+	case "function_call":
+		tool, input := codexToolEquivalent(item.Name, json.RawMessage(item.Arguments), b.cwd)
+		b.toolCall(at, item.CallID, item.Name, json.RawMessage(item.Arguments), tool, input)
+	case "custom_tool_call":
+		input, _ := json.Marshal(item.Input)
+		b.toolCall(at, item.CallID, item.Name, input, "", nil)
+	case "local_shell_call":
+		input, _ := json.Marshal(item.Action)
+		tool, call := "", any(nil)
+		if len(item.Action.Command) > 0 {
+			tool, call = "bash", bashCall{Command: codexCommand(item.Action.Command, item.Action.WorkingDirectory, b.cwd)}
+		}
+		b.toolCall(at, item.CallID, "local_shell", input, tool, call)
+	case "function_call_output", "custom_tool_call_output":
+		isError, result := codexOutput(item.Output)
+		b.toolResult(at, item.CallID, isError, result)
+	}
+}
+
+// isCodexContext reports whether a user message is context Codex supplied
+// rather than something the user typed.
+func isCodexContext(text string) bool {
+	text = strings.TrimSpace(text)
+	for _, prefix := range []string{"<environment_context>", "<user_instructions>", "# AGENTS.md instructions"} {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// codexToolEquivalent maps a Codex shell call to a bash call. Codex's
+// apply_patch uses its own patch language, which has no patch tool
+// equivalent.
+func codexToolEquivalent(name string, arguments json.RawMessage, cwd string) (string, any) {
+	var in struct {
+		Command json.RawMessage `json:"command"`
+		Workdir string          `json:"workdir"`
+	}
+	if json.Unmarshal(arguments, &in) != nil {
+		return "", nil
+	}
+	switch name {
+	case "shell", "shell_command", "container.exec":
+		var argv []string
+		if json.Unmarshal(in.Command, &argv) == nil && len(argv) > 0 {
+			return "bash", bashCall{Command: codexCommand(argv, in.Workdir, cwd)}
+		}
+		var command string
+		if json.Unmarshal(in.Command, &command) == nil && command != "" {
+			return "bash", bashCall{Command: codexCommand([]string{"bash", "-lc", command}, in.Workdir, cwd)}
+		}
+	}
+	return "", nil
+}
+
+// codexCommand turns a Codex argv into a bash command line, unwrapping
+// "bash -lc SCRIPT" and changing to workdir when it isn't the session's.
+func codexCommand(argv []string, workdir, cwd string) string {
+	var command string
+	if len(argv) == 3 && (argv[0] == "bash" || argv[0] == "sh" || argv[0] == "zsh") && (argv[1] == "-lc" || argv[1] == "-c") {
+		command = argv[2]
+	} else {
+		command = shellJoin(argv)
+	}
+	if workdir != "" && workdir != cwd {
+		command = "cd " + shellJoin([]string{workdir}) + " && " + command
+	}
+	return command
+}
+
+// codexOutput decodes a tool call's output. Depending on the Codex version
+// it is plain text, JSON text holding {output, metadata: {exit_code}}, or a
+// list of content items.
+func codexOutput(raw json.RawMessage) (bool, []llm.Content) {
+	var items []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		ImageURL string `json:"image_url"`
+	}
+	if json.Unmarshal(raw, &items) == nil {
+		var result []llm.Content
+		for _, item := range items {
+			if mediaType, data, ok := parseDataURL(item.ImageURL); ok {
+				result = append(result, imageContent(mediaType, data))
+			} else if item.Text != "" {
+				result = append(result, textContent(item.Text))
+			}
+		}
+		return false, result
+	}
+
+	var text string
+	if json.Unmarshal(raw, &text) != nil {
+		var wrapped struct {
+			Content string `json:"content"`
+			Success *bool  `json:"success"`
+		}
+		json.Unmarshal(raw, &wrapped)
+		return wrapped.Success != nil && !*wrapped.Success, []llm.Content{textContent(wrapped.Content)}
+	}
+	var shell struct {
+		Output   *string `json:"output"`
+		Metadata struct {
+			ExitCode int `json:"exit_code"`
+		} `json:"metadata"`
+	}
+	if json.Unmarshal([]byte(text), &shell) == nil && shell.Output != nil {
+		return shell.Metadata.ExitCode != 0, []llm.Content{textContent(*shell.Output)}
+	}
+	return false, []llm.Content{textContent(text)}
+}
@@ -0,0 +1,349 @@
+// Package transcripts converts the session logs of other coding agents into
+// conversations for db.ImportConversation.
+//
+// Tool calls that have a Shelley equivalent become calls of that tool (bash
+// or patch), so the conversation reads and continues like a native one.
+// Other tool calls, and their results, are preserved as text.
+package transcripts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/llm"
+	"shelley.exe.dev/slug"
+)
+
+// Format names a session log format.
+type Format string
+
+const (
+	// FormatClaudeCode is a Claude Code session log
+	// (~/.claude/projects/<project>/<session>.jsonl).
+	FormatClaudeCode Format = "claude-code"
+	// FormatCodex is a Codex rollout log
+	// (~/.codex/sessions/YYYY/MM/DD/rollout-*.jsonl).
+	FormatCodex Format = "codex"
+)
+
+// Formats lists the formats Parse accepts.
+func Formats() []Format {
+	return []Format{FormatClaudeCode, FormatCodex}
+}
+
+// Detect guesses the format of a session log from its first records.
+func Detect(data []byte) (Format, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for range 20 {
+		var record map[string]json.RawMessage
+		if err := dec.Decode(&record); err != nil {
+			return "", false
+		}
+		var typ string
+		json.Unmarshal(record["type"], &typ)
+		switch {
+		case record["sessionId"] != nil, typ == "summary" && record["leafUuid"] != nil:
+			return FormatClaudeCode, true
+		case record["payload"] != nil, record["record_type"] != nil, typ == "function_call", typ == "reasoning":
+			return FormatCodex, true
+		}
+	}
+	return "", false
+}
+
+// Parse converts a session log in format into a conversation, tagged with
+// the format's name. The conversation has no model, so it continues with
+// whichever Shelley model the next message picks.
+func Parse(format Format, r io.Reader) (db.ImportConversationParams, error) {
+	var b *builder
+	var err error
+	switch format {
+	case FormatClaudeCode:
+		b, err = parseClaudeCode(r)
+	case FormatCodex:
+		b, err = parseCodex(r)
+	default:
+		return db.ImportConversationParams{}, fmt.Errorf("unknown transcript format %q", format)
+	}
+	if err != nil {
+		return db.ImportConversationParams{}, fmt.Errorf("parsing %s transcript: %w", format, err)
+	}
+	params := b.finish()
+	if len(params.Messages) == 0 {
+		return db.ImportConversationParams{}, fmt.Errorf("%s transcript has no messages", format)
+	}
+	params.Tags = []string{string(format)}
+	return params, nil
+}
+
+// decodeRecords calls fn with each JSON value of a JSONL stream.
+func decodeRecords(r io.Reader, fn func(json.RawMessage) error) error {
+	dec := json.NewDecoder(r)
+	for {
+		var record json.RawMessage
+		err := dec.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// builder accumulates a conversation in Shelley's message shape. It merges
+// consecutive records of one role, which both agents log separately, and
+// keeps every tool call paired with a result so the conversation can be
+// sent to a model again.
+type builder struct {
+	cwd      string
+	title    string
+	messages []builtMessage
+	// open holds the ids of tool calls kept as calls whose results have
+	// not arrived yet, in order; names maps every call id to its tool.
+	open  []string
+	names map[string]string
+}
+
+type builtMessage struct {
+	typ db.MessageType
+	at  time.Time
+	msg llm.Message
+}
+
+func newBuilder() *builder {
+	return &builder{names: map[string]string{}}
+}
+
+func (b *builder) add(typ db.MessageType, at time.Time, contents ...llm.Content) {
+	if len(contents) == 0 {
+		return
+	}
+	if n := len(b.messages); n > 0 && b.messages[n-1].typ == typ {
+		b.messages[n-1].msg.Content = append(b.messages[n-1].msg.Content, contents...)
+		return
+	}
+	role := llm.MessageRoleUser
+	if typ == db.MessageTypeAgent {
+		role = llm.MessageRoleAssistant
+	}
+	b.messages = append(b.messages, builtMessage{typ: typ, at: at, msg: llm.Message{Role: role, Content: contents}})
+}
+
+// userText records text the user typed.
+func (b *builder) userText(at time.Time, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	b.closeOpen(at)
+	if b.title == "" {
+		b.title = text
+	}
+	b.add(db.MessageTypeUser, at, textContent(text))
+}
+
+// userImage records an image the user attached.
+func (b *builder) userImage(at time.Time, mediaType, data string) {
+	b.closeOpen(at)
+	b.add(db.MessageTypeUser, at, imageContent(mediaType, data))
+}
+
+func (b *builder) agentText(at time.Time, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	b.closeOpenBeforeAgent(at)
+	b.add(db.MessageTypeAgent, at, textContent(text))
+}
+
+// agentThinking records reasoning. It carries no signature, so providers
+// that require one drop it from requests; it stays searchable.
+func (b *builder) agentThinking(at time.Time, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	b.closeOpenBeforeAgent(at)
+	b.add(db.MessageTypeAgent, at, llm.Content{Type: llm.ContentTypeThinking, Thinking: text})
+}
+
+// toolCall records a call of the foreign tool name. If shelleyTool is not
+// empty the call becomes a call of that Shelley tool with input
+// shelleyInput; otherwise it is preserved as text.
+func (b *builder) toolCall(at time.Time, id, name string, input json.RawMessage, shelleyTool string, shelleyInput any) {
+	b.closeOpenBeforeAgent(at)
+	b.names[id] = name
+	if shelleyTool != "" {
+		if data, err := json.Marshal(shelleyInput); err == nil {
+			b.open = append(b.open, id)
+			b.add(db.MessageTypeAgent, at, llm.Content{Type: llm.ContentTypeToolUse, ID: id, ToolName: shelleyTool, ToolInput: data})
+			return
+		}
+	}
+	b.add(db.MessageTypeAgent, at, llm.Content{
+		Type: llm.ContentTypeText,
+		Text: fmt.Sprintf("Called `%s`:\n\n```\n%s\n```", name, strings.TrimSpace(inputText(input))),
+	})
+}
+
+// toolResult records the result of call id: text and images.
+func (b *builder) toolResult(at time.Time, id string, isError bool, result []llm.Content) {
+	if i := slices.Index(b.open, id); i >= 0 {
+		b.open = slices.Delete(b.open, i, i+1)
+		b.add(db.MessageTypeUser, at, llm.Content{Type: llm.ContentTypeToolResult, ToolUseID: id, ToolError: isError, ToolResult: result})
+		return
+	}
+	name := b.names[id]
+	if name == "" {
+		name = "tool"
+	}
+	label := fmt.Sprintf("Result of `%s`", name)
+	if isError {
+		label += " (error)"
+	}
+	var texts []string
+	var images []llm.Content
+	for _, c := range result {
+		if c.MediaType != "" {
+			images = append(images, c)
+		} else if c.Text != "" {
+			texts = append(texts, c.Text)
+		}
+	}
+	contents := []llm.Content{{
+		Type: llm.ContentTypeText,
+		Text: fmt.Sprintf("%s:\n\n```\n%s\n```", label, strings.TrimSpace(strings.Join(texts, "\n"))),
+	}}
+	b.add(db.MessageTypeUser, at, append(contents, images...)...)
+}
+
+// closeOpenBeforeAgent closes the open tool calls when an agent message
+// starts without their results having been recorded.
+func (b *builder) closeOpenBeforeAgent(at time.Time) {
+	if n := len(b.messages); n > 0 && b.messages[n-1].typ != db.MessageTypeAgent {
+		b.closeOpen(at)
+	}
+}
+
+// closeOpen gives every open tool call an error result, as models require
+// a result for each call.
+func (b *builder) closeOpen(at time.Time) {
+	for _, id := range b.open {
+		b.add(db.MessageTypeUser, at, llm.Content{
+			Type:       llm.ContentTypeToolResult,
+			ToolUseID:  id,
+			ToolError:  true,
+			ToolResult: []llm.Content{textContent("No result was recorded in the imported transcript.")},
+		})
+	}
+	b.open = nil
+}
+
+func (b *builder) finish() db.ImportConversationParams {
+	var last time.Time
+	if n := len(b.messages); n > 0 {
+		last = b.messages[n-1].at
+	}
+	b.closeOpen(last)
+
+	var params db.ImportConversationParams
+	if b.cwd != "" {
+		params.Cwd = &b.cwd
+	}
+	if s := titleSlug(b.title); s != "" {
+		params.Slug = &s
+	}
+	for _, m := range b.messages {
+		m.msg.EndOfTurn = m.typ == db.MessageTypeAgent && !slices.ContainsFunc(m.msg.Content, func(c llm.Content) bool {
+			return c.Type == llm.ContentTypeToolUse
+		})
+		im := db.ImportedMessage{
+			CreateMessageParams: db.CreateMessageParams{Type: m.typ, LLMData: m.msg},
+			Generation:          1,
+		}
+		if !m.at.IsZero() {
+			at := m.at
+			im.CreatedAt = &at
+		}
+		params.Messages = append(params.Messages, im)
+	}
+	return params
+}
+
+// titleSlug makes a slug of the first few words of title.
+func titleSlug(title string) string {
+	words := strings.Fields(title)
+	if len(words) > 6 {
+		words = words[:6]
+	}
+	return slug.Sanitize(strings.Join(words, " "))
+}
+
+// parseTime parses a log timestamp, returning the zero time if it can't.
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+// inputText renders a tool input for a call preserved as text: JSON
+// indented, anything else as is.
+func inputText(input json.RawMessage) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, input, "", "  ") == nil {
+		return buf.String()
+	}
+	var s string
+	if json.Unmarshal(input, &s) == nil {
+		return s
+	}
+	return string(input)
+}
+
+// bashCall is the input of Shelley's bash tool.
+type bashCall struct {
+	Command string `json:"command"`
+}
+
+// shellJoin quotes argv for a POSIX shell, leaving simple words bare.
+func shellJoin(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:@,+%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func textContent(text string) llm.Content {
+	return llm.Content{Type: llm.ContentTypeText, Text: text}
+}
+
+func imageContent(mediaType, data string) llm.Content {
+	return llm.Content{Type: llm.ContentTypeText, MediaType: mediaType, Data: data}
+}
+
+// parseDataURL splits a base64 data: URL into media type and data.
+func parseDataURL(u string) (mediaType, data string, ok bool) {
+	rest, ok := strings.CutPrefix(u, "data:")
+	if !ok {
+		return "", "", false
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mediaType, ok = strings.CutSuffix(meta, ";base64")
+	return mediaType, data, ok
+}
@@ -0,0 +1,198 @@
+package transcripts
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"shelley.exe.dev/claudetool"
+	"shelley.exe.dev/db"
+	"shelley.exe.dev/llm"
+)
+
+const claudeCodeLog = `{"type":"summary","summary":"Fix the flaky login test","leafUuid":"u9"}
+{"type":"user","sessionId":"s1","cwd":"/src/app","timestamp":"2026-03-01T10:00:00Z","message":{"role":"user","content":"the login test is flaky, please fix it"}}
+{"type":"user","sessionId":"s1","isMeta":true,"timestamp":"2026-03-01T10:00:00Z","message":{"role":"user","content":"Caveat: meta"}}
+{"type":"assistant","sessionId":"s1","timestamp":"2026-03-01T10:00:01Z","message":{"id":"m1","role":"assistant","content":[{"type":"thinking","thinking":"Run it first.","signature":"sig"}]}}
+{"type":"assistant","sessionId":"s1","timestamp":"2026-03-01T10:00:01Z","message":{"id":"m1","role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"go test ./login","description":"Run"}}]}}
+{"type":"assistant","sessionId":"s1","timestamp":"2026-03-01T10:00:01Z","message":{"id":"m1","role":"assistant","content":[{"type":"tool_use","id":"t2","name":"Read","input":{"file_path":"/src/app/login_test.go"}}]}}
+{"type":"user","sessionId":"s1","timestamp":"2026-03-01T10:00:02Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"FAIL","is_error":true}]}}
+{"type":"user","sessionId":"s1","timestamp":"2026-03-01T10:00:02Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t2","content":[{"type":"text","text":"package login"}]}]}}
+{"type":"assistant","sessionId":"s1","isSidechain":true,"timestamp":"2026-03-01T10:00:03Z","message":{"id":"m9","role":"assistant","content":[{"type":"text","text":"subagent chatter"}]}}
+{"type":"assistant","sessionId":"s1","timestamp":"2026-03-01T10:00:03Z","message":{"id":"m2","role":"assistant","content":[{"type":"tool_use","id":"t3","name":"Edit","input":{"file_path":"/src/app/login_test.go","old_string":"Sleep(1)","new_string":"Sleep(5)"}}]}}
+{"type":"user","sessionId":"s1","timestamp":"2026-03-01T10:00:04Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t3","content":"ok"}]}}
+{"type":"assistant","sessionId":"s1","timestamp":"2026-03-01T10:00:05Z","message":{"id":"m3","role":"assistant","content":[{"type":"tool_use","id":"t4","name":"Bash","input":{"command":"go test ./login"}}]}}
+{"type":"user","sessionId":"s1","timestamp":"2026-03-01T10:00:06Z","message":{"role":"user","content":"[Request interrupted by user]"}}
+{"type":"assistant","sessionId":"s1","timestamp":"2026-03-01T10:00:07Z","message":{"id":"m4","role":"assistant","content":[{"type":"text","text":"Fixed by lengthening the sleep."}]}}
+`
+
+const codexLog = `{"timestamp":"2026-03-02T09:00:00Z","type":"session_meta","payload":{"id":"x","cwd":"/src/api"}}
+{"timestamp":"2026-03-02T09:00:00Z","type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"<environment_context>\n  <cwd>/src/api</cwd>\n</environment_context>"}]}}
+{"timestamp":"2026-03-02T09:00:01Z","type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"count the handlers"}]}}
+{"timestamp":"2026-03-02T09:00:01Z","type":"event_msg","payload":{"type":"user_message","message":"count the handlers"}}
+{"timestamp":"2026-03-02T09:00:02Z","type":"response_item","payload":{"type":"reasoning","summary":[{"type":"summary_text","text":"Grep for them."}],"encrypted_content":"xyz"}}
+{"timestamp":"2026-03-02T09:00:02Z","type":"response_item","payload":{"type":"function_call","name":"shell","arguments":"{\"command\":[\"bash\",\"-lc\",\"grep -c Handle *.go\"],\"workdir\":\"/src/api/server\"}","call_id":"c1"}}
+{"timestamp":"2026-03-02T09:00:03Z","type":"response_item","payload":{"type":"function_call_output","call_id":"c1","output":"{\"output\":\"12\\n\",\"metadata\":{\"exit_code\":0}}"}}
+{"timestamp":"2026-03-02T09:00:04Z","type":"response_item","payload":{"type":"custom_tool_call","name":"apply_patch","input":"*** Begin Patch\n*** End Patch","call_id":"c2"}}
+{"timestamp":"2026-03-02T09:00:05Z","type":"response_item","payload":{"type":"custom_tool_call_output","call_id":"c2","output":"Success."}}
+{"timestamp":"2026-03-02T09:00:06Z","type":"response_item","payload":{"type":"message","role":"assistant","content":[{"type":"output_text","text":"There are 12 handlers."}]}}
+`
+
+func messages(t *testing.T, params db.ImportConversationParams) []llm.Message {
+	t.Helper()
+	var msgs []llm.Message
+	for _, m := range params.Messages {
+		msg, ok := m.LLMData.(llm.Message)
+		if !ok {
+			t.Fatalf("LLMData is %T", m.LLMData)
+		}
+		if want := db.MessageTypeUser; msg.Role == llm.MessageRoleAssistant {
+			want = db.MessageTypeAgent
+			if m.Type != want {
+				t.Errorf("assistant message has type %s", m.Type)
+			}
+		} else if m.Type != want {
+			t.Errorf("user message has type %s", m.Type)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		log  string
+		want Format
+	}{
+		{claudeCodeLog, FormatClaudeCode},
+		{codexLog, FormatCodex},
+		{`{"id":"x","timestamp":"2025-05-01","instructions":""}` + "\n" + `{"type":"function_call","name":"shell","arguments":"{}","call_id":"c"}`, FormatCodex},
+	} {
+		if got, ok := Detect([]byte(tc.log)); !ok || got != tc.want {
+			t.Errorf("Detect = %q, %v; want %q", got, ok, tc.want)
+		}
+	}
+	if _, ok := Detect([]byte(`{"format":"shelley-conversation","version":1}`)); ok {
+		t.Error("Detect claimed a Shelley export")
+	}
+}
+
+func TestParseClaudeCode(t *testing.T) {
+	params, err := Parse(FormatClaudeCode, strings.NewReader(claudeCodeLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Slug == nil || *params.Slug != "fix-the-flaky-login-test" || params.Cwd == nil || *params.Cwd != "/src/app" {
+		t.Errorf("slug %v, cwd %v", params.Slug, params.Cwd)
+	}
+	if len(params.Tags) != 1 || params.Tags[0] != "claude-code" || params.Model != nil {
+		t.Errorf("tags %v, model %v", params.Tags, params.Model)
+	}
+	msgs := messages(t, params)
+	if len(msgs) != 8 {
+		t.Fatalf("got %d messages, want 8: %+v", len(msgs), msgs)
+	}
+
+	// The three records of message m1 are one agent message; the Read call
+	// is kept as text.
+	agent := msgs[1].Content
+	if len(agent) != 3 || agent[0].Thinking != "Run it first." || agent[0].Signature != "" {
+		t.Fatalf("first agent message = %+v", agent)
+	}
+	if agent[1].Type != llm.ContentTypeToolUse || agent[1].ToolName != "bash" || string(agent[1].ToolInput) != `{"command":"go test ./login"}` {
+		t.Errorf("Bash call = %+v", agent[1])
+	}
+	if agent[2].Type != llm.ContentTypeText || !strings.Contains(agent[2].Text, "Called `Read`") || !strings.Contains(agent[2].Text, "login_test.go") {
+		t.Errorf("Read call = %+v", agent[2])
+	}
+	if msgs[1].EndOfTurn {
+		t.Error("a message with a tool call ends the turn")
+	}
+
+	results := msgs[2].Content
+	if len(results) != 2 || results[0].ToolUseID != "t1" || !results[0].ToolError || results[0].ToolResult[0].Text != "FAIL" {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[1].Type != llm.ContentTypeText || !strings.Contains(results[1].Text, "Result of `Read`") || !strings.Contains(results[1].Text, "package login") {
+		t.Errorf("Read result = %+v", results[1])
+	}
+
+	var patch claudetool.PatchInput
+	json.Unmarshal(msgs[3].Content[0].ToolInput, &patch)
+	if msgs[3].Content[0].ToolName != "patch" || patch.Path != "/src/app/login_test.go" || patch.Patches[0].Operation != "replace" || patch.Patches[0].NewText != "Sleep(5)" {
+		t.Errorf("Edit call = %+v", msgs[3].Content[0])
+	}
+
+	// The interrupted call gets an error result before the user's text.
+	interrupted := msgs[6].Content
+	if len(interrupted) != 2 || interrupted[0].ToolUseID != "t4" || !interrupted[0].ToolError || interrupted[1].Text != "[Request interrupted by user]" {
+		t.Errorf("interrupted = %+v", interrupted)
+	}
+	if last := msgs[7]; !last.EndOfTurn || last.Content[0].Text != "Fixed by lengthening the sleep." {
+		t.Errorf("last message = %+v", last)
+	}
+	for _, m := range msgs {
+		for _, c := range m.Content {
+			if strings.Contains(c.Text, "subagent chatter") || strings.Contains(c.Text, "Caveat") {
+				t.Errorf("sidechain or meta record imported: %q", c.Text)
+			}
+		}
+	}
+	if at := params.Messages[0].CreatedAt; at == nil || at.Format("15:04:05") != "10:00:00" {
+		t.Errorf("created at = %v", at)
+	}
+}
+
+func TestParseCodex(t *testing.T) {
+	params, err := Parse(FormatCodex, strings.NewReader(codexLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Slug == nil || *params.Slug != "count-the-handlers" || params.Cwd == nil || *params.Cwd != "/src/api" {
+		t.Errorf("slug %v, cwd %v", params.Slug, params.Cwd)
+	}
+	msgs := messages(t, params)
+	if len(msgs) != 6 {
+		t.Fatalf("got %d messages, want 6: %+v", len(msgs), msgs)
+	}
+	if len(msgs[0].Content) != 1 || msgs[0].Content[0].Text != "count the handlers" {
+		t.Errorf("user message = %+v", msgs[0])
+	}
+	agent := msgs[1].Content
+	if len(agent) != 2 || agent[0].Thinking != "Grep for them." {
+		t.Fatalf("agent message = %+v", agent)
+	}
+	var call bashCall
+	json.Unmarshal(agent[1].ToolInput, &call)
+	if agent[1].ToolName != "bash" || call.Command != "cd /src/api/server && grep -c Handle *.go" {
+		t.Errorf("shell call = %+v", agent[1])
+	}
+	if r := msgs[2].Content[0]; r.ToolUseID != "c1" || r.ToolError || r.ToolResult[0].Text != "12\n" {
+		t.Errorf("shell result = %+v", r)
+	}
+	if !strings.Contains(msgs[3].Content[0].Text, "Called `apply_patch`") || !strings.Contains(msgs[3].Content[0].Text, "*** Begin Patch") {
+		t.Errorf("apply_patch call = %+v", msgs[3])
+	}
+	if !strings.Contains(msgs[4].Content[0].Text, "Result of `apply_patch`") || !strings.Contains(msgs[4].Content[0].Text, "Success.") {
+		t.Errorf("apply_patch result = %+v", msgs[4])
+	}
+	if last := msgs[5]; !last.EndOfTurn || last.Content[0].Text != "There are 12 handlers." {
+		t.Errorf("last message = %+v", last)
+	}
+}
+
+func TestCodexCommand(t *testing.T) {
+	for _, tc := range []struct {
+		argv    []string
+		workdir string
+		want    string
+	}{
+		{[]string{"bash", "-lc", "ls -la"}, "", "ls -la"},
+		{[]string{"rg", "-n", "foo bar", "src/"}, "/s", "rg -n 'foo bar' src/"},
+		{[]string{"echo", "it's"}, "/other dir", `cd '/other dir' && echo 'it'\''s'`},
+	} {
+		if got := codexCommand(tc.argv, tc.workdir, "/s"); got != tc.want {
+			t.Errorf("codexCommand(%q, %q) = %q, want %q", tc.argv, tc.workdir, got, tc.want)
+		}
+	}
+}
@@ -53,10 +53,21 @@ export interface ApiMessageForTS {
   user_email?: string | null;
 }
 
+export interface ApprovalRequestForTS {
+  id: string;
+  tool_use_id?: string;
+  tool: string;
+  command?: string;
+  path?: string;
+  input?: string;
+  subjects?: string[] | null;
+}
+
 export interface ConversationStateForTS {
   conversation_id: string;
   working: boolean;
   model?: string;
+  pending_approvals?: ApprovalRequestForTS[] | null;
 }
 
 export interface NotificationEventForTS {
@@ -74,6 +85,7 @@ export interface StreamResponseForTS {
   heartbeat?: boolean;
   notification_event?: NotificationEventForTS | null;
   max_sequence_id?: number;
+  approval_request?: ApprovalRequestForTS | null;
 }
 
 export interface ConversationWithStateForTS {
@@ -800,6 +800,63 @@ export const featureFlagsApi = {
   },
 };
 
+export interface Trigger {
+  name: string;
+  prompt_template: string;
+  model?: string;
+  cwd?: string;
+  conversation_options: Record<string, unknown>;
+  tags: string[];
+  enabled: boolean;
+  // Path to POST payloads to.
+  url: string;
+  // Only present right after creation or rotation.
+  secret?: string;
+  last_fired_at?: string;
+  last_conversation_id?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export const triggersApi = {
+  async list(): Promise<Trigger[]> {
+    const r = await fetch("/api/triggers");
+    if (!r.ok) throw new Error(`Failed to load triggers: ${r.statusText}`);
+    return r.json();
+  },
+  async setEnabled(trigger: Trigger, enabled: boolean): Promise<Trigger> {
+    const r = await fetch(`/api/triggers/${encodeURIComponent(trigger.name)}`, {
+      method: "PUT",
+      headers: { "Content-Type": "application/json", "X-Shelley-Request": "1" },
+      body: JSON.stringify({
+        prompt_template: trigger.prompt_template,
+        model: trigger.model,
+        cwd: trigger.cwd,
+        conversation_options: trigger.conversation_options,
+        tags: trigger.tags,
+        enabled,
+      }),
+    });
+    if (!r.ok) throw new Error((await r.text()) || r.statusText);
+    return r.json();
+  },
+  async rotateSecret(name: string): Promise<Trigger> {
+    const r = await fetch(`/api/triggers/${encodeURIComponent(name)}/secret`, {
+      method: "POST",
+      headers: { "X-Shelley-Request": "1" },
+    });
+    if (!r.ok) throw new Error((await r.text()) || r.statusText);
+    return r.json();
+  },
+  async delete(name: string): Promise<void> {
+    const r = await fetch(`/api/triggers/${encodeURIComponent(name)}`, {
+      method: "DELETE",
+      headers: { "X-Shelley-Request": "1" },
+    });
+    if (!r.ok) throw new Error((await r.text()) || r.statusText);
+  },
+};
+
 // models.dev pricing, USD per million tokens. null = model known but unpriced.
 export interface ModelCostDTO {
   input: number;
@@ -856,7 +913,13 @@ export const subagentUsageApi = {
 export interface CustomModel {
   model_id: string;
   display_name: string;
-  provider_type: "anthropic" | "openai" | "openai-responses" | "gemini";
+  provider_type:
+    | "anthropic"
+    | "anthropic-bedrock"
+    | "anthropic-vertex"
+    | "openai"
+    | "openai-responses"
+    | "gemini";
   endpoint: string;
   api_key: string;
   model_name: string;
@@ -872,7 +935,13 @@ export interface CustomModel {
 
 export interface CreateCustomModelRequest {
   display_name: string;
-  provider_type: "anthropic" | "openai" | "openai-responses" | "gemini";
+  provider_type:
+    | "anthropic"
+    | "anthropic-bedrock"
+    | "anthropic-vertex"
+    | "openai"
+    | "openai-responses"
+    | "gemini";
   endpoint: string;
   api_key: string;
   model_name: string;
@@ -886,7 +955,13 @@ export interface CreateCustomModelRequest {
 
 export interface TestCustomModelRequest {
   model_id?: string; // If provided with empty api_key, use stored key
-  provider_type: "anthropic" | "openai" | "openai-responses" | "gemini";
+  provider_type:
+    | "anthropic"
+    | "anthropic-bedrock"
+    | "anthropic-vertex"
+    | "openai"
+    | "openai-responses"
+    | "gemini";
   endpoint: string;
   api_key: string;
   model_name: string;
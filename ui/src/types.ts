@@ -119,6 +119,9 @@ export interface ToolProgress {
   tool_use_id: string;
   tool_name: string;
   output: string;
+  // Structured progress in the shape of the tool's display data
+  // (subagent_map reports its items here).
+  display?: unknown;
 }
 
 // StreamDelta represents a partial text delta from the LLM.
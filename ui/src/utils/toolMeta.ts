@@ -58,6 +58,7 @@ export function toolEmoji(name: string | undefined | null, input?: unknown): str
     case "browser_eval":
       return "⚡";
     case "subagent":
+    case "subagent_map":
       return "⚡";
     case "keyword_search":
       return "🔍";
@@ -80,6 +81,8 @@ export function toolEmoji(name: string | undefined | null, input?: unknown): str
       return "📂";
     case "llm_one_shot":
       return "🤖";
+    case "schedule":
+      return "⏰";
     case "output_iframe":
       return "✨";
     case "web_search":
@@ -108,7 +111,9 @@ const TOOL_DISPLAY_NAMES: Record<string, string> = {
   keyword_search: "Keyword search",
   web_search: "Web search",
   subagent: "Subagent",
+  subagent_map: "Subagent batch",
   llm_one_shot: "LLM request",
+  schedule: "Schedule",
   output_iframe: "HTML preview",
   screenshot: "Screenshot",
   browser: "Browser",
@@ -405,6 +410,8 @@ function inputSummary(name: string | undefined | null, input: unknown): string {
       return pick("query");
     case "subagent":
       return pick("slug", "prompt");
+    case "subagent_map":
+      return pick("slug_prefix", "prompt_template");
     case "llm_one_shot": {
       const files = o.prompt_files;
       if (Array.isArray(files) && files.length > 0) return files.join(", ");
@@ -413,6 +420,8 @@ function inputSummary(name: string | undefined | null, input: unknown): string {
     }
     case "output_iframe":
       return pick("title", "path");
+    case "schedule":
+      return pick("name", "schedule_id", "action");
     case "browser_eval":
       return pick("expression");
     case "browser_emulate":
@@ -1,10 +1,20 @@
 // Shared constants + form types for the custom-model UI, used by both
 // ModelsModal.vue (the list) and ModelFormModal.vue (the add/edit dialog).
 
-export type ProviderType = "anthropic" | "openai" | "openai-responses" | "gemini";
+export type ProviderType =
+  | "anthropic"
+  | "anthropic-bedrock"
+  | "anthropic-vertex"
+  | "openai"
+  | "openai-responses"
+  | "gemini";
 
 export const DEFAULT_ENDPOINTS: Record<ProviderType, string> = {
   anthropic: "https://api.anthropic.com/v1/messages",
+  // Bedrock endpoints name the region; Vertex ones the project and region.
+  "anthropic-bedrock": "https://bedrock-runtime.us-east-1.amazonaws.com",
+  "anthropic-vertex":
+    "https://us-east5-aiplatform.googleapis.com/v1/projects/PROJECT/locations/us-east5/publishers/anthropic/models",
   openai: "https://api.openai.com/v1",
   "openai-responses": "https://api.openai.com/v1",
   gemini: "https://generativelanguage.googleapis.com/v1beta",
@@ -12,6 +22,8 @@ export const DEFAULT_ENDPOINTS: Record<ProviderType, string> = {
 
 export const PROVIDER_LABELS: Record<ProviderType, string> = {
   anthropic: "Anthropic",
+  "anthropic-bedrock": "Anthropic on Bedrock",
+  "anthropic-vertex": "Anthropic on Vertex AI",
   openai: "OpenAI (Chat API)",
   "openai-responses": "OpenAI (Responses API)",
   gemini: "Google Gemini",
@@ -24,6 +36,16 @@ export const DEFAULT_MODELS: Record<ProviderType, { name: string; model_name: st
     { name: "Claude Opus 4.6", model_name: "claude-opus-4-6" },
     { name: "Claude Haiku 4.5", model_name: "claude-haiku-4-5" },
   ],
+  "anthropic-bedrock": [
+    { name: "Claude Sonnet 4.6", model_name: "us.anthropic.claude-sonnet-4-6-v1" },
+    { name: "Claude Opus 4.6", model_name: "us.anthropic.claude-opus-4-6-v1" },
+    { name: "Claude Haiku 4.5", model_name: "us.anthropic.claude-haiku-4-5-20251001-v1:0" },
+  ],
+  "anthropic-vertex": [
+    { name: "Claude Sonnet 4.6", model_name: "claude-sonnet-4-6" },
+    { name: "Claude Opus 4.6", model_name: "claude-opus-4-6" },
+    { name: "Claude Haiku 4.5", model_name: "claude-haiku-4-5@20251001" },
+  ],
   openai: [
     { name: "GPT-5.6 Sol", model_name: "gpt-5.6-sol" },
     { name: "GPT-5.5", model_name: "gpt-5.5" },
@@ -60,7 +82,14 @@ export const DEFAULT_REASONING_MAP: ReasoningMap = Object.fromEntries(
   REASONING_LEVELS.map((level) => [level, level]),
 ) as ReasoningMap;
 
-export const providerTypes: ProviderType[] = ["anthropic", "openai", "openai-responses", "gemini"];
+export const providerTypes: ProviderType[] = [
+  "anthropic",
+  "anthropic-bedrock",
+  "anthropic-vertex",
+  "openai",
+  "openai-responses",
+  "gemini",
+];
 
 export interface FormData {
   display_name: string;
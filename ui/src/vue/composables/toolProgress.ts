@@ -37,3 +37,16 @@ export function useToolStreamingOutput(
     return (progress?.value ?? EMPTY)[id]?.output;
   });
 }
+
+/** Structured progress (ToolProgress.display) for one tool call, for tools
+ *  that report more than an output tail, e.g. subagent_map. */
+export function useToolProgressDisplay(
+  toolUseId: () => string | undefined,
+): ComputedRef<unknown> {
+  const progress = inject(ToolProgressKey, undefined);
+  return computed(() => {
+    const id = toolUseId();
+    if (!id) return undefined;
+    return (progress?.value ?? EMPTY)[id]?.display;
+  });
+}